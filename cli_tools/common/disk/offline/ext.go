@@ -0,0 +1,340 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	extSuperblockOffset = 1024
+	extRootInode        = 2
+
+	extCompatJournal      = 0x4
+	extIncompatFiletype   = 0x2
+	extIncompatMetaBG     = 0x10
+	extIncompatExtents    = 0x40
+	extIncompat64Bit      = 0x80
+	extIncompatFlexBG     = 0x200
+	extIncompatInlineData = 0x8000
+
+	extExtentsFlag    = 0x80000
+	extInlineDataFlag = 0x10000000
+
+	extExtentMagic    = 0xf30a
+	maxExtentDepth    = 5
+	extUninitialized  = 32768
+	extFastSymlinkMax = 60
+)
+
+// extFS reads ext2, ext3, and ext4 filesystems.
+type extFS struct {
+	r              io.ReaderAt
+	blockSize      int64
+	inodesPerGroup uint32
+	inodeSize      int64
+	descSize       int64
+	descOffset     int64
+	is64Bit        bool
+	hasFiletype    bool
+	fsName         string
+}
+
+func openExt(r io.ReaderAt) (*extFS, error) {
+	sb := make([]byte, 1024)
+	if _, err := r.ReadAt(sb, extSuperblockOffset); err != nil {
+		return nil, fmt.Errorf("failed to read ext superblock: %w", err)
+	}
+	logBlockSize := binary.LittleEndian.Uint32(sb[24:])
+	if logBlockSize > 6 {
+		return nil, fmt.Errorf("invalid ext block size: 2^%d KiB", logBlockSize)
+	}
+	fs := &extFS{
+		r:              r,
+		blockSize:      1024 << logBlockSize,
+		inodesPerGroup: binary.LittleEndian.Uint32(sb[40:]),
+		inodeSize:      128,
+		descSize:       32,
+	}
+	if binary.LittleEndian.Uint32(sb[76:]) > 0 {
+		fs.inodeSize = int64(binary.LittleEndian.Uint16(sb[88:]))
+	}
+	if fs.inodesPerGroup == 0 || fs.inodeSize < 128 || fs.inodeSize > fs.blockSize {
+		return nil, errors.New("invalid ext superblock")
+	}
+
+	compat, incompat := binary.LittleEndian.Uint32(sb[92:]), binary.LittleEndian.Uint32(sb[96:])
+	if incompat&extIncompatMetaBG != 0 {
+		return nil, errors.New("ext filesystems with meta_bg are not supported")
+	}
+	fs.hasFiletype = incompat&extIncompatFiletype != 0
+	if incompat&extIncompat64Bit != 0 {
+		fs.is64Bit = true
+		if size := int64(binary.LittleEndian.Uint16(sb[254:])); size > 32 {
+			fs.descSize = size
+		}
+	}
+	// The group descriptors follow the superblock's block.
+	fs.descOffset = (int64(binary.LittleEndian.Uint32(sb[20:])) + 1) * fs.blockSize
+
+	switch {
+	case incompat&(extIncompatExtents|extIncompat64Bit|extIncompatFlexBG|extIncompatInlineData) != 0:
+		fs.fsName = "ext4"
+	case compat&extCompatJournal != 0:
+		fs.fsName = "ext3"
+	default:
+		fs.fsName = "ext2"
+	}
+	return fs, nil
+}
+
+func (fs *extFS) name() string {
+	return fs.fsName
+}
+
+func (fs *extFS) root() uint64 {
+	return extRootInode
+}
+
+func (fs *extFS) inode(n uint64) ([]byte, error) {
+	if n == 0 {
+		return nil, fmt.Errorf("invalid ext inode %d", n)
+	}
+	group, index := (n-1)/uint64(fs.inodesPerGroup), (n-1)%uint64(fs.inodesPerGroup)
+	desc := make([]byte, fs.descSize)
+	if _, err := fs.r.ReadAt(desc, fs.descOffset+int64(group)*fs.descSize); err != nil {
+		return nil, fmt.Errorf("failed to read ext group descriptor %d: %w", group, err)
+	}
+	table := uint64(binary.LittleEndian.Uint32(desc[8:]))
+	if fs.is64Bit && fs.descSize >= 64 {
+		table |= uint64(binary.LittleEndian.Uint32(desc[0x28:])) << 32
+	}
+	inode := make([]byte, fs.inodeSize)
+	if _, err := fs.r.ReadAt(inode, int64(table)*fs.blockSize+int64(index)*fs.inodeSize); err != nil {
+		return nil, fmt.Errorf("failed to read ext inode %d: %w", n, err)
+	}
+	return inode, nil
+}
+
+func (fs *extFS) kind(n uint64) (fileKind, error) {
+	inode, err := fs.inode(n)
+	if err != nil {
+		return 0, err
+	}
+	switch binary.LittleEndian.Uint16(inode) & 0xf000 {
+	case 0x8000:
+		return kindFile, nil
+	case 0x4000:
+		return kindDirectory, nil
+	case 0xa000:
+		return kindSymlink, nil
+	}
+	return kindOther, nil
+}
+
+func (fs *extFS) read(n uint64) ([]byte, error) {
+	inode, err := fs.inode(n)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(binary.LittleEndian.Uint32(inode[4:])) | int64(binary.LittleEndian.Uint32(inode[108:]))<<32
+	if size > maxFileSize {
+		return nil, fmt.Errorf("ext inode %d is too large: %d bytes", n, size)
+	}
+	flags := binary.LittleEndian.Uint32(inode[32:])
+	iBlock := inode[40:100]
+	isSymlink := binary.LittleEndian.Uint16(inode)&0xf000 == 0xa000
+
+	// Short symlinks, and files with inline data, are stored in i_block.
+	if flags&extInlineDataFlag != 0 || (isSymlink && size < extFastSymlinkMax && flags&extExtentsFlag == 0) {
+		if size > int64(len(iBlock)) {
+			return nil, fmt.Errorf("ext inode %d: inline data in extended attributes is not supported", n)
+		}
+		return append([]byte{}, iBlock[:size]...), nil
+	}
+
+	var extents []extent
+	if flags&extExtentsFlag != 0 {
+		extents, err = fs.extentTree(iBlock, 0)
+	} else {
+		extents, err = fs.blockMap(iBlock, (size+fs.blockSize-1)/fs.blockSize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blocks of ext inode %d: %w", n, err)
+	}
+	return readExtents(fs.r, extents, fs.blockSize, size)
+}
+
+func (fs *extFS) lookup(dir uint64, name string) (uint64, error) {
+	data, err := fs.read(dir)
+	if err != nil {
+		return 0, err
+	}
+	// Each block has a linked list of entries. The blocks of hashed
+	// directories also have an index, which is stored in empty entries.
+	for block := int64(0); block < int64(len(data)); block += fs.blockSize {
+		b := data[block:min64(block+fs.blockSize, int64(len(data)))]
+		for pos := 0; pos+8 <= len(b); {
+			inode := binary.LittleEndian.Uint32(b[pos:])
+			recLen := int(binary.LittleEndian.Uint16(b[pos+4:]))
+			nameLen := int(b[pos+6])
+			if !fs.hasFiletype {
+				nameLen = int(binary.LittleEndian.Uint16(b[pos+6:]))
+			}
+			if recLen < 8 || pos+8+nameLen > len(b) {
+				break
+			}
+			if inode != 0 && string(b[pos+8:pos+8+nameLen]) == name {
+				return uint64(inode), nil
+			}
+			pos += recLen
+		}
+	}
+	return 0, errNotExist
+}
+
+// extent maps a range of a file's blocks to the filesystem's blocks. Blocks
+// of unwritten extents read as zeros, as do blocks that aren't mapped.
+type extent struct {
+	logical, physical, length int64
+	unwritten                 bool
+}
+
+// extentTree returns the extents of an ext4 extent tree node.
+func (fs *extFS) extentTree(node []byte, level int) ([]extent, error) {
+	if level > maxExtentDepth || len(node) < 12 || binary.LittleEndian.Uint16(node) != extExtentMagic {
+		return nil, errors.New("invalid extent tree")
+	}
+	entries, depth := int(binary.LittleEndian.Uint16(node[2:])), binary.LittleEndian.Uint16(node[6:])
+	if 12+12*entries > len(node) {
+		return nil, errors.New("invalid extent tree")
+	}
+	var extents []extent
+	for i := 0; i < entries; i++ {
+		e := node[12+12*i:]
+		if depth == 0 {
+			length := int64(binary.LittleEndian.Uint16(e[4:]))
+			unwritten := length > extUninitialized
+			if unwritten {
+				length -= extUninitialized
+			}
+			extents = append(extents, extent{
+				logical:   int64(binary.LittleEndian.Uint32(e)),
+				physical:  int64(binary.LittleEndian.Uint16(e[6:]))<<32 | int64(binary.LittleEndian.Uint32(e[8:])),
+				length:    length,
+				unwritten: unwritten,
+			})
+			continue
+		}
+		child := make([]byte, fs.blockSize)
+		leaf := int64(binary.LittleEndian.Uint32(e[4:])) | int64(binary.LittleEndian.Uint16(e[8:]))<<32
+		if _, err := fs.r.ReadAt(child, leaf*fs.blockSize); err != nil {
+			return nil, err
+		}
+		childExtents, err := fs.extentTree(child, level+1)
+		if err != nil {
+			return nil, err
+		}
+		extents = append(extents, childExtents...)
+	}
+	return extents, nil
+}
+
+// blockMap returns the extents of an ext2/ext3 block map, which has twelve
+// direct blocks, followed by an indirect, double indirect, and triple
+// indirect block.
+func (fs *extFS) blockMap(iBlock []byte, blocks int64) ([]extent, error) {
+	m := &extBlockMapper{fs: fs, remaining: blocks}
+	for i := 0; i < 15 && m.remaining > 0; i++ {
+		depth := 0
+		if i >= 12 {
+			depth = i - 11
+		}
+		if err := m.add(int64(binary.LittleEndian.Uint32(iBlock[4*i:])), depth); err != nil {
+			return nil, err
+		}
+	}
+	return m.extents, nil
+}
+
+type extBlockMapper struct {
+	fs        *extFS
+	extents   []extent
+	logical   int64
+	remaining int64
+}
+
+// add maps the blocks referenced by block, which is an indirect block when
+// depth > 0.
+func (m *extBlockMapper) add(block int64, depth int) error {
+	perBlock := m.fs.blockSize / 4
+	if block == 0 {
+		// A hole, which covers all blocks that would have been referenced.
+		n := int64(1)
+		for i := 0; i < depth; i++ {
+			n *= perBlock
+		}
+		m.logical += n
+		m.remaining -= n
+		return nil
+	}
+	if depth == 0 {
+		if last := len(m.extents) - 1; last >= 0 && m.extents[last].physical+m.extents[last].length == block &&
+			m.extents[last].logical+m.extents[last].length == m.logical {
+			m.extents[last].length++
+		} else {
+			m.extents = append(m.extents, extent{logical: m.logical, physical: block, length: 1})
+		}
+		m.logical++
+		m.remaining--
+		return nil
+	}
+	b := make([]byte, m.fs.blockSize)
+	if _, err := m.fs.r.ReadAt(b, block*m.fs.blockSize); err != nil {
+		return err
+	}
+	for i := int64(0); i < perBlock && m.remaining > 0; i++ {
+		if err := m.add(int64(binary.LittleEndian.Uint32(b[4*i:])), depth-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readExtents reads size bytes of a file with blocks of blockSize.
+func readExtents(r io.ReaderAt, extents []extent, blockSize, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	for _, e := range extents {
+		start := e.logical * blockSize
+		if e.unwritten || start >= size {
+			continue
+		}
+		end := min64(start+e.length*blockSize, size)
+		if _, err := r.ReadAt(data[start:end], e.physical*blockSize); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
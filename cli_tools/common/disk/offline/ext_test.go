@@ -0,0 +1,96 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The fixtures in testdata were created with mke2fs -d:
+//
+//	ext4.img: Debian 10.9, with /etc/os-release symlinked to /usr/lib, a
+//	  /bin symlink, and a two-block /usr/bin directory.
+//	ext2.img: CentOS 6.10, without /etc/os-release, and with a file that
+//	  uses indirect blocks.
+func readFixture(t *testing.T, name string) []byte {
+	f, err := os.Open(filepath.Join("testdata", name+".gz"))
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return content
+}
+
+func TestOpenExt_Ext4(t *testing.T) {
+	fs, err := openFilesystem(bytes.NewReader(readFixture(t, "ext4.img")))
+	require.NoError(t, err)
+	assert.Equal(t, "ext4", fs.name())
+
+	osRelease, err := readFile(fs, "/etc/os-release")
+	assert.NoError(t, err)
+	assert.Contains(t, string(osRelease), `VERSION_ID="10"`)
+
+	ls, err := readFile(fs, "/bin/ls")
+	assert.NoError(t, err)
+	assert.Len(t, ls, 64)
+	assert.Equal(t, "\x7fELF", string(ls[:4]))
+
+	assert.True(t, isFile(fs, "/usr/bin/tool-399"), "Entries in the second block of a directory should be found")
+	assert.True(t, isDir(fs, "/bin"))
+	assert.True(t, isDir(fs, "/usr/bin/../lib"))
+	assert.False(t, isFile(fs, "/etc/missing"))
+	assert.False(t, isFile(fs, "/etc"))
+}
+
+func TestOpenExt_Ext2(t *testing.T) {
+	fs, err := openFilesystem(bytes.NewReader(readFixture(t, "ext2.img")))
+	require.NoError(t, err)
+	assert.Equal(t, "ext2", fs.name())
+
+	release, err := readFile(fs, "/etc/centos-release")
+	assert.NoError(t, err)
+	assert.Equal(t, "CentOS release 6.10 (Final)\n", string(release))
+
+	services, err := readFile(fs, "/etc/services")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(services), "\n"), "\n")
+	assert.Len(t, lines, 3000)
+	for i, line := range lines {
+		if !assert.Equal(t, fmt.Sprintf("service-%d %d/tcp", i, i), line) {
+			break
+		}
+	}
+	assert.False(t, isFile(fs, "/etc/os-release"))
+}
+
+func TestOpenExt_RejectsInvalidSuperblock(t *testing.T) {
+	disk := readFixture(t, "ext4.img")
+	// s_inodes_per_group
+	copy(disk[1024+40:], []byte{0, 0, 0, 0})
+	_, err := openFilesystem(bytes.NewReader(disk))
+	assert.EqualError(t, err, "invalid ext superblock")
+}
@@ -0,0 +1,159 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// Files larger than this aren't read. The largest files that are
+	// read are registry hives.
+	maxFileSize = 512 * 1024 * 1024
+	// Same as the limit used by Linux when resolving paths.
+	maxSymlinks = 40
+)
+
+var errNotExist = errors.New("file does not exist")
+
+type fileKind int
+
+const (
+	kindOther fileKind = iota
+	kindFile
+	kindDirectory
+	kindSymlink
+)
+
+// filesystem reads the files of a filesystem, which are identified by their
+// inode number.
+type filesystem interface {
+	// name returns the type of the filesystem, such as "ext4".
+	name() string
+	root() uint64
+	// lookup returns the inode of name in the directory dir, or errNotExist.
+	lookup(dir uint64, name string) (uint64, error)
+	kind(inode uint64) (fileKind, error)
+	// read returns the content of a file, or the target of a symlink.
+	read(inode uint64) ([]byte, error)
+}
+
+// openFilesystem returns the filesystem of a partition, or nil when its type
+// isn't supported.
+func openFilesystem(r io.ReaderAt) (filesystem, error) {
+	magic := make([]byte, 2048)
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case magic[1080] == 0x53 && magic[1081] == 0xef:
+		return openExt(r)
+	case string(magic[:4]) == "XFSB":
+		return openXFS(r)
+	case string(magic[3:11]) == "NTFS    ":
+		return openNTFS(r)
+	}
+	return nil, nil
+}
+
+// readFile returns the content of the file at an absolute path.
+func readFile(fs filesystem, path string) ([]byte, error) {
+	inode, kind, err := resolve(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	if kind != kindFile {
+		return nil, fmt.Errorf("%s is not a file", path)
+	}
+	return fs.read(inode)
+}
+
+// isFile returns whether path is a file, after following symlinks.
+func isFile(fs filesystem, path string) bool {
+	_, kind, err := resolve(fs, path)
+	return err == nil && kind == kindFile
+}
+
+// isDir returns whether path is a directory, after following symlinks.
+func isDir(fs filesystem, path string) bool {
+	_, kind, err := resolve(fs, path)
+	return err == nil && kind == kindDirectory
+}
+
+// resolve finds the inode of path, following symlinks. Absolute symlinks
+// are resolved from the root of fs.
+func resolve(fs filesystem, path string) (uint64, fileKind, error) {
+	// parents is the stack of directories from the root to the current one.
+	parents := []uint64{fs.root()}
+	remaining := splitPath(path)
+	symlinks := 0
+	for len(remaining) > 0 {
+		name := remaining[0]
+		remaining = remaining[1:]
+		switch name {
+		case ".":
+			continue
+		case "..":
+			if len(parents) > 1 {
+				parents = parents[:len(parents)-1]
+			}
+			continue
+		}
+
+		inode, err := fs.lookup(parents[len(parents)-1], name)
+		if err != nil {
+			return 0, 0, err
+		}
+		kind, err := fs.kind(inode)
+		if err != nil {
+			return 0, 0, err
+		}
+		switch kind {
+		case kindSymlink:
+			if symlinks++; symlinks > maxSymlinks {
+				return 0, 0, fmt.Errorf("too many symlinks in %s", path)
+			}
+			target, err := fs.read(inode)
+			if err != nil {
+				return 0, 0, err
+			}
+			if strings.HasPrefix(string(target), "/") {
+				parents = parents[:1]
+			}
+			remaining = append(splitPath(string(target)), remaining...)
+		case kindDirectory:
+			parents = append(parents, inode)
+		default:
+			if len(remaining) > 0 {
+				return 0, 0, errNotExist
+			}
+			return inode, kind, nil
+		}
+	}
+	return parents[len(parents)-1], kindDirectory, nil
+}
+
+func splitPath(path string) []string {
+	var parts []string
+	for _, part := range strings.Split(path, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
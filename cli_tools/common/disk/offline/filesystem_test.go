@@ -0,0 +1,135 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memFS is a filesystem whose files are keyed by absolute path. Parent
+// directories are implicit.
+type memFS struct {
+	files map[string]memFile
+	// paths maps inodes to paths; it's built on first use.
+	paths []string
+}
+
+type memFile struct {
+	kind    fileKind
+	content string
+}
+
+func (fs *memFS) name() string {
+	return "memfs"
+}
+
+func (fs *memFS) index() {
+	if fs.paths != nil {
+		return
+	}
+	paths := map[string]bool{"/": true}
+	for p := range fs.files {
+		for ; p != "/"; p = path.Dir(p) {
+			paths[p] = true
+		}
+	}
+	for p := range paths {
+		fs.paths = append(fs.paths, p)
+	}
+	sort.Strings(fs.paths)
+}
+
+func (fs *memFS) root() uint64 {
+	fs.index()
+	return 0
+}
+
+func (fs *memFS) lookup(dir uint64, name string) (uint64, error) {
+	fs.index()
+	target := path.Join(fs.paths[dir], name)
+	for i, p := range fs.paths {
+		if p == target {
+			return uint64(i), nil
+		}
+	}
+	return 0, errNotExist
+}
+
+func (fs *memFS) kind(inode uint64) (fileKind, error) {
+	fs.index()
+	if f, ok := fs.files[fs.paths[inode]]; ok {
+		return f.kind, nil
+	}
+	return kindDirectory, nil
+}
+
+func (fs *memFS) read(inode uint64) ([]byte, error) {
+	fs.index()
+	return []byte(fs.files[fs.paths[inode]].content), nil
+}
+
+func TestResolve(t *testing.T) {
+	fs := &memFS{files: map[string]memFile{
+		"/usr/lib/os-release": {kind: kindFile, content: "ID=debian"},
+		"/etc/os-release":     {kind: kindSymlink, content: "../usr/lib/os-release"},
+		"/lib":                {kind: kindSymlink, content: "usr/lib"},
+		"/etc/absolute":       {kind: kindSymlink, content: "/lib/os-release"},
+		"/dev/null":           {kind: kindOther},
+		"/loop/a":             {kind: kindSymlink, content: "/loop/b"},
+		"/loop/b":             {kind: kindSymlink, content: "a"},
+	}}
+	for _, tt := range []struct {
+		path     string
+		expected string
+	}{
+		{"/usr/lib/os-release", "ID=debian"},
+		{"/etc/os-release", "ID=debian"},
+		{"/lib/os-release", "ID=debian"},
+		{"/etc/absolute", "ID=debian"},
+		{"/../etc/./os-release", "ID=debian"},
+		{"//usr//lib/../lib/os-release", "ID=debian"},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			content, err := readFile(fs, tt.path)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(content))
+		})
+	}
+
+	assert.True(t, isDir(fs, "/lib"))
+	assert.True(t, isDir(fs, "/"))
+	assert.False(t, isFile(fs, "/dev/null"))
+	assert.False(t, isFile(fs, "/dev/null/child"))
+
+	_, err := readFile(fs, "/missing")
+	assert.Equal(t, errNotExist, err)
+	_, err = readFile(fs, "/usr")
+	assert.EqualError(t, err, "/usr is not a file")
+	_, err = readFile(fs, "/loop/a")
+	assert.EqualError(t, err, "too many symlinks in /loop/a")
+}
+
+func TestOpenFilesystem_ReturnsNilForUnknownFilesystems(t *testing.T) {
+	for _, disk := range [][]byte{make([]byte, 4096), make([]byte, 512)} {
+		fs, err := openFilesystem(bytes.NewReader(disk))
+		assert.NoError(t, err)
+		assert.Nil(t, fs)
+	}
+}
@@ -0,0 +1,76 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package offline inspects disk image files locally, by reading their
+// partition tables and filesystems directly, rather than booting or mounting
+// them.
+package offline
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/imagefile"
+)
+
+// Image is the virtual disk of an image file.
+type Image interface {
+	io.ReaderAt
+	io.Closer
+	// Size returns the size of the virtual disk, in bytes.
+	Size() int64
+}
+
+// OpenImage opens a raw or qcow2 image file.
+func OpenImage(filename string) (Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	info, err := imagefile.ReadImageInfo(f, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read %q: %w", filename, err)
+	}
+	switch info.Format {
+	case "raw":
+		return rawImage{File: f, size: stat.Size()}, nil
+	case "qcow2":
+		image, err := newQCOW2Image(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read %q: %w", filename, err)
+		}
+		return image, nil
+	default:
+		f.Close()
+		return nil, fmt.Errorf("%q is a %s file: only raw and qcow2 files are supported", filename, info.Format)
+	}
+}
+
+// rawImage is an image file whose content is the virtual disk.
+type rawImage struct {
+	*os.File
+	size int64
+}
+
+func (image rawImage) Size() int64 {
+	return image.size
+}
@@ -0,0 +1,72 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTempFile(t *testing.T, content []byte) string {
+	dir, err := ioutil.TempDir("", "offline")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	filename := filepath.Join(dir, "disk")
+	require.NoError(t, ioutil.WriteFile(filename, content, 0600))
+	return filename
+}
+
+func TestOpenImage(t *testing.T) {
+	disk := testDisk(64*1024+512, 4096)
+	for _, tt := range []struct {
+		name    string
+		content []byte
+	}{
+		{"raw", disk},
+		{"qcow2", encodeQCOW2(disk, 3, 12)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			image, err := OpenImage(writeTempFile(t, tt.content))
+			require.NoError(t, err)
+			defer image.Close()
+			assert.Equal(t, int64(len(disk)), image.Size())
+			actual, err := ioutil.ReadAll(io.NewSectionReader(image, 0, image.Size()))
+			assert.NoError(t, err)
+			assert.Equal(t, disk, actual)
+		})
+	}
+}
+
+func TestOpenImage_RejectsOtherFormats(t *testing.T) {
+	vdi := make([]byte, 4096)
+	binary.LittleEndian.PutUint32(vdi[0x40:], 0xbeda107f)
+	binary.LittleEndian.PutUint64(vdi[0x170:], 1024*1024)
+	filename := writeTempFile(t, vdi)
+	_, err := OpenImage(filename)
+	assert.EqualError(t, err, fmt.Sprintf("%q is a vdi file: only raw and qcow2 files are supported", filename))
+}
+
+func TestOpenImage_FailsWhenFileIsMissing(t *testing.T) {
+	_, err := OpenImage(filepath.Join(os.TempDir(), "missing", "disk.qcow2"))
+	assert.True(t, os.IsNotExist(err))
+}
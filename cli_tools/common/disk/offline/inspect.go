@@ -0,0 +1,175 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
+)
+
+const (
+	elfMachineX86 = 3
+	elfMachineX64 = 62
+	peMachineX86  = 0x14c
+	peMachineX64  = 0x8664
+)
+
+// Executables whose headers are used to find the architecture of a Linux
+// system, in order of preference.
+var linuxExecutables = []string{"/bin/ls", "/usr/bin/ls", "/bin/sh", "/sbin/init", "/usr/bin/bash"}
+
+const windowsExecutable = "/Windows/System32/cmd.exe"
+
+// Inspect finds the boot-related properties of a disk, and the operating
+// system that is installed on it. As with the boot-inspect worker, OsRelease
+// is only populated when one operating system is found, and the fields that
+// are specific to import, such as CliFormatted, are left empty.
+//
+// When an error is returned, the results' ErrorWhen field is set.
+func Inspect(disk io.ReaderAt, size int64) (*pb.InspectionResults, error) {
+	results := &pb.InspectionResults{}
+	table, err := readPartitionTable(disk, size)
+	if err != nil {
+		results.ErrorWhen = pb.InspectionResults_INSPECTING_BOOTLOADER
+		return results, err
+	}
+	results.BiosBootable = table.biosBootable()
+	results.UefiBootable = table.uefiBootable()
+
+	volumes, err := readVolumes(disk, table)
+	if err != nil {
+		results.ErrorWhen = pb.InspectionResults_INSPECTING_OS
+		return results, err
+	}
+	var releases []*pb.OsRelease
+	var rootFS string
+	for _, volume := range volumes {
+		// Like libguestfs, volumes that can't be mounted are skipped.
+		fs, err := openFilesystem(volume)
+		if err != nil || fs == nil {
+			continue
+		}
+		release, err := inspectOS(fs)
+		if err != nil {
+			results.ErrorWhen = pb.InspectionResults_INSPECTING_OS
+			return results, fmt.Errorf("failed to inspect %s filesystem: %w", fs.name(), err)
+		}
+		if release != nil {
+			releases = append(releases, release)
+			rootFS = fs.name()
+		}
+	}
+
+	results.OsCount = int32(len(releases))
+	if len(releases) == 1 {
+		results.OsRelease = releases[0]
+		results.RootFs = rootFS
+	}
+	return results, nil
+}
+
+// readVolumes returns the volumes that may contain a filesystem: the
+// partitions of the disk, with LVM physical volumes replaced by their
+// logical volumes.
+func readVolumes(disk io.ReaderAt, table partitionTable) ([]io.ReaderAt, error) {
+	var volumes []io.ReaderAt
+	for _, p := range table.partitions {
+		section := io.NewSectionReader(disk, p.offset, p.size)
+		lvs, err := readLogicalVolumes(section)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LVM volumes: %w", err)
+		}
+		if lvs == nil {
+			volumes = append(volumes, section)
+			continue
+		}
+		for _, lv := range lvs {
+			volumes = append(volumes, lv)
+		}
+	}
+	return volumes, nil
+}
+
+// inspectOS returns the operating system that is installed on fs, or nil
+// when one isn't found.
+func inspectOS(fs filesystem) (*pb.OsRelease, error) {
+	release, err := inspectLinux(fs)
+	if err != nil {
+		return nil, err
+	}
+	executables := linuxExecutables
+	if release == nil {
+		if release, err = inspectWindows(fs); err != nil || release == nil {
+			return nil, err
+		}
+		executables = []string{windowsExecutable}
+	}
+	release.Architecture = inspectArchitecture(fs, executables)
+	return release, nil
+}
+
+// inspectArchitecture returns the architecture of the first executable that
+// can be read.
+func inspectArchitecture(fs filesystem, executables []string) pb.Architecture {
+	for _, path := range executables {
+		if !isFile(fs, path) {
+			continue
+		}
+		content, err := readFile(fs, path)
+		if err != nil {
+			continue
+		}
+		if arch, ok := executableArchitecture(content); ok {
+			return arch
+		}
+	}
+	return pb.Architecture_ARCHITECTURE_UNKNOWN
+}
+
+// executableArchitecture reads the machine type of an ELF or PE executable.
+func executableArchitecture(b []byte) (pb.Architecture, bool) {
+	var machine uint16
+	switch {
+	case len(b) >= 20 && string(b[:4]) == "\x7fELF":
+		if b[5] == 2 {
+			machine = binary.BigEndian.Uint16(b[18:])
+		} else {
+			machine = binary.LittleEndian.Uint16(b[18:])
+		}
+		switch machine {
+		case elfMachineX86:
+			return pb.Architecture_X86, true
+		case elfMachineX64:
+			return pb.Architecture_X64, true
+		}
+		return pb.Architecture_ARCHITECTURE_UNKNOWN, true
+	case len(b) >= 64 && string(b[:2]) == "MZ":
+		peOffset := int(binary.LittleEndian.Uint32(b[0x3c:]))
+		if peOffset < 0 || peOffset+6 > len(b) || string(b[peOffset:peOffset+4]) != "PE\x00\x00" {
+			return pb.Architecture_ARCHITECTURE_UNKNOWN, false
+		}
+		switch binary.LittleEndian.Uint16(b[peOffset+4:]) {
+		case peMachineX86:
+			return pb.Architecture_X86, true
+		case peMachineX64:
+			return pb.Architecture_X64, true
+		}
+		return pb.Architecture_ARCHITECTURE_UNKNOWN, true
+	}
+	return pb.Architecture_ARCHITECTURE_UNKNOWN, false
+}
@@ -0,0 +1,215 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
+)
+
+// diskWith returns a disk that starts with a 1 MiB gap for the partition
+// table, followed by volumes, each of which is aligned to a MiB.
+func diskWith(volumes ...[]byte) ([]byte, []uint32) {
+	const alignment = 1024 * 1024
+	disk := make([]byte, alignment)
+	var starts []uint32
+	for _, v := range volumes {
+		starts = append(starts, uint32(len(disk)/sectorSize))
+		disk = append(disk, v...)
+		disk = append(disk, make([]byte, (alignment-len(disk)%alignment)%alignment)...)
+	}
+	return disk, starts
+}
+
+// peExecutable returns the headers of a PE executable.
+func peExecutable(machine uint16) []byte {
+	b := make([]byte, 128)
+	copy(b, "MZ")
+	binary.LittleEndian.PutUint32(b[0x3c:], 64)
+	copy(b[64:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(b[68:], machine)
+	return b
+}
+
+// windowsNTFS returns an NTFS filesystem with a Windows Server 2019
+// installation.
+func windowsNTFS() []byte {
+	hive := softwareHiveWith(
+		named("CurrentMajorVersionNumber", dwordValue(10)),
+		named("CurrentMinorVersionNumber", dwordValue(0)),
+		named("InstallationType", stringValue("Server")),
+		named("ProductName", stringValue("Windows Server 2019 Datacenter")),
+	)
+	// The test filesystem splits the hive across two records.
+	if len(hive) <= testNTFSClusterSize {
+		hive = append(hive, make([]byte, 2*testNTFSClusterSize-len(hive))...)
+	}
+	return buildNTFS(peExecutable(peMachineX64), hive)
+}
+
+func TestInspect(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		disk     func(t *testing.T) []byte
+		expected *pb.InspectionResults
+	}{
+		{
+			name: "ext4 on gpt",
+			disk: func(t *testing.T) []byte {
+				disk, starts := diskWith(make([]byte, 4096), readFixture(t, "ext4.img"))
+				last := uint64(len(disk)/sectorSize - 1)
+				writeMBR(disk, mbrEntry{0xee, 1, uint32(last)})
+				writeGPT(disk,
+					gptEntry{biosBootGUID, 34, 41},
+					gptEntry{espGUID, uint64(starts[0]), uint64(starts[1] - 1)},
+					gptEntry{linuxDataGUID, uint64(starts[1]), last})
+				return disk
+			},
+			expected: &pb.InspectionResults{
+				OsRelease: &pb.OsRelease{
+					DistroId:     pb.Distro_DEBIAN,
+					MajorVersion: "10",
+					MinorVersion: "9",
+					Architecture: pb.Architecture_X64,
+				},
+				OsCount:      1,
+				RootFs:       "ext4",
+				BiosBootable: true,
+				UefiBootable: true,
+			},
+		},
+		{
+			name: "ext2 on lvm",
+			disk: func(t *testing.T) []byte {
+				root := readFixture(t, "ext2.img")
+				pv := buildPV(volumeGroup(linearLV("root", 0, 1)), root)
+				disk, starts := diskWith(pv)
+				writeMBR(disk, mbrEntry{0x8e, starts[0], uint32(len(pv) / sectorSize)})
+				return disk
+			},
+			expected: &pb.InspectionResults{
+				OsRelease: &pb.OsRelease{
+					DistroId:     pb.Distro_CENTOS,
+					MajorVersion: "6",
+					MinorVersion: "10",
+					Architecture: pb.Architecture_X86,
+				},
+				OsCount: 1,
+				RootFs:  "ext2",
+			},
+		},
+		{
+			name: "windows without partition table",
+			disk: func(t *testing.T) []byte {
+				return windowsNTFS()
+			},
+			expected: &pb.InspectionResults{
+				OsRelease: &pb.OsRelease{
+					DistroId:     pb.Distro_WINDOWS,
+					MajorVersion: "2019",
+					Architecture: pb.Architecture_X64,
+				},
+				OsCount: 1,
+				RootFs:  "ntfs",
+			},
+		},
+		{
+			name: "multiple operating systems",
+			disk: func(t *testing.T) []byte {
+				ext4, ext2 := readFixture(t, "ext4.img"), readFixture(t, "ext2.img")
+				disk, starts := diskWith(ext4, ext2)
+				writeMBR(disk,
+					mbrEntry{0x83, starts[0], uint32(len(ext4) / sectorSize)},
+					mbrEntry{0x83, starts[1], uint32(len(ext2) / sectorSize)})
+				return disk
+			},
+			expected: &pb.InspectionResults{OsCount: 2},
+		},
+		{
+			name: "no operating system",
+			disk: func(t *testing.T) []byte {
+				return make([]byte, 1024*1024)
+			},
+			expected: &pb.InspectionResults{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			disk := tt.disk(t)
+			actual, err := Inspect(bytes.NewReader(disk), int64(len(disk)))
+			require.NoError(t, err)
+			if diff := cmp.Diff(tt.expected, actual, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected difference:\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestInspect_ReportsWhenErrorsOccur(t *testing.T) {
+	disk := make([]byte, 64*sectorSize)
+	writeMBR(disk, mbrEntry{0xee, 1, 63})
+	results, err := Inspect(bytes.NewReader(disk), int64(len(disk)))
+	assert.EqualError(t, err, "GPT header not found")
+	assert.Equal(t, pb.InspectionResults_INSPECTING_BOOTLOADER, results.ErrorWhen)
+
+	disk, starts := diskWith(buildPV(volumeGroup(), nil))
+	copy(disk[int(starts[0])*sectorSize+sectorSize+32:], "someotherphysicalvolumeid0000000")
+	writeMBR(disk, mbrEntry{0x8e, starts[0], 2048})
+	results, err = Inspect(bytes.NewReader(disk), int64(len(disk)))
+	assert.EqualError(t, err, "failed to read LVM volumes: LVM physical volume not found in metadata")
+	assert.Equal(t, pb.InspectionResults_INSPECTING_OS, results.ErrorWhen)
+}
+
+func TestExecutableArchitecture(t *testing.T) {
+	elf := func(class, endianness byte, machine uint16) []byte {
+		b := make([]byte, 64)
+		copy(b, "\x7fELF")
+		b[4], b[5] = class, endianness
+		if endianness == 2 {
+			binary.BigEndian.PutUint16(b[18:], machine)
+		} else {
+			binary.LittleEndian.PutUint16(b[18:], machine)
+		}
+		return b
+	}
+	for _, tt := range []struct {
+		name       string
+		executable []byte
+		expected   pb.Architecture
+		expectedOK bool
+	}{
+		{"elf x86", elf(1, 1, elfMachineX86), pb.Architecture_X86, true},
+		{"elf x64", elf(2, 1, elfMachineX64), pb.Architecture_X64, true},
+		{"big endian elf", elf(2, 2, 43), pb.Architecture_ARCHITECTURE_UNKNOWN, true},
+		{"pe x86", peExecutable(peMachineX86), pb.Architecture_X86, true},
+		{"pe x64", peExecutable(peMachineX64), pb.Architecture_X64, true},
+		{"pe arm64", peExecutable(0xaa64), pb.Architecture_ARCHITECTURE_UNKNOWN, true},
+		{"dos executable", peExecutable(peMachineX64)[:64], pb.Architecture_ARCHITECTURE_UNKNOWN, false},
+		{"script", []byte("#!/bin/sh\nexec /bin/busybox \"$@\"\n"), pb.Architecture_ARCHITECTURE_UNKNOWN, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, ok := executableArchitecture(tt.executable)
+			assert.Equal(t, tt.expected, actual)
+			assert.Equal(t, tt.expectedOK, ok)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
+)
+
+// fingerprint identifies a Linux distro, using /etc/os-release, with
+// fallback to the metadata files that predate systemd.
+type fingerprint struct {
+	distro pb.Distro
+	// aliases are the IDs in /etc/os-release, besides the distro's name,
+	// that indicate a match.
+	aliases []string
+	// require lists files that must all be present to match, and disallow
+	// lists files that must all be absent.
+	require, disallow []string
+	// versionFile is a legacy metadata file that has the version.
+	versionFile string
+}
+
+var legacyVersionPattern = regexp.MustCompile(`\d+\.\d+`)
+
+// linuxFingerprints are searched in order. They're the same as the
+// fingerprints of the boot-inspect worker.
+var linuxFingerprints = []fingerprint{
+	{distro: pb.Distro_AMAZON, aliases: []string{"amzn", "amazonlinux"}},
+	{
+		distro:      pb.Distro_CENTOS,
+		require:     []string{"/etc/centos-release"},
+		disallow:    []string{"/etc/fedora-release", "/etc/oracle-release"},
+		versionFile: "/etc/centos-release",
+	},
+	{distro: pb.Distro_DEBIAN, versionFile: "/etc/debian_version"},
+	{distro: pb.Distro_FEDORA},
+	{distro: pb.Distro_KALI},
+	{
+		distro:      pb.Distro_RHEL,
+		require:     []string{"/etc/redhat-release"},
+		disallow:    []string{"/etc/fedora-release", "/etc/oracle-release", "/etc/centos-release"},
+		versionFile: "/etc/redhat-release",
+	},
+	// Depending on the version, SLES for SAP has a variety of IDs in
+	// /etc/os-release, so the product file is required as well.
+	{
+		distro:  pb.Distro_SLES_SAP,
+		aliases: []string{"sles", "sles_sap"},
+		require: []string{"/etc/products.d/SLES_SAP.prod"},
+	},
+	{distro: pb.Distro_SLES},
+	{distro: pb.Distro_OPENSUSE, aliases: []string{"opensuse-leap"}},
+	{distro: pb.Distro_ORACLE, aliases: []string{"ol", "oraclelinux"}},
+	{distro: pb.Distro_UBUNTU},
+}
+
+// inspectLinux returns the Linux distro that is installed on fs, or nil
+// when one isn't found.
+func inspectLinux(fs filesystem) (*pb.OsRelease, error) {
+	osRelease := map[string]string{}
+	if isFile(fs, "/etc/os-release") {
+		content, err := readFile(fs, "/etc/os-release")
+		if err != nil {
+			return nil, err
+		}
+		osRelease = parseConfigFile(string(content))
+	}
+	for _, f := range linuxFingerprints {
+		release, err := f.match(fs, osRelease)
+		if release != nil || err != nil {
+			return release, err
+		}
+	}
+	return nil, nil
+}
+
+func (f fingerprint) match(fs filesystem, osRelease map[string]string) (*pb.OsRelease, error) {
+	hasPredicate := len(f.require) > 0 || len(f.disallow) > 0
+	var matches bool
+	if id, ok := osRelease["ID"]; ok {
+		matches = f.matchesID(id) && (!hasPredicate || f.matchesFiles(fs))
+	} else {
+		matches = hasPredicate && f.matchesFiles(fs)
+	}
+	if !matches {
+		return nil, nil
+	}
+
+	legacyVersion := ""
+	if f.versionFile != "" && isFile(fs, f.versionFile) {
+		content, err := readFile(fs, f.versionFile)
+		if err != nil {
+			return nil, err
+		}
+		legacyVersion = legacyVersionPattern.FindString(string(content))
+	}
+	// The longer version is assumed to be better. For example, Debian 8.8
+	// has "8" in /etc/os-release, and "8.8" in /etc/debian_version.
+	version := legacyVersion
+	if osRelease["VERSION_ID"] > legacyVersion {
+		version = osRelease["VERSION_ID"]
+	}
+	major, minor := version, ""
+	if i := strings.Index(version, "."); i >= 0 {
+		major, minor = version[:i], version[i+1:]
+	}
+	return &pb.OsRelease{
+		MajorVersion: major,
+		MinorVersion: minor,
+		DistroId:     f.distro,
+	}, nil
+}
+
+func (f fingerprint) matchesID(id string) bool {
+	for _, name := range append([]string{f.distro.String()}, f.aliases...) {
+		if strings.EqualFold(id, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fingerprint) matchesFiles(fs filesystem) bool {
+	for _, path := range f.require {
+		if !isFile(fs, path) {
+			return false
+		}
+	}
+	for _, path := range f.disallow {
+		if isFile(fs, path) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseConfigFile parses the key=value lines of a file such as
+// /etc/os-release. Values are unquoted, and other lines are ignored.
+func parseConfigFile(content string) map[string]string {
+	config := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		i := strings.Index(line, "=")
+		if strings.HasPrefix(line, "#") || i < 0 {
+			continue
+		}
+		config[line[:i]] = strings.Trim(strings.TrimSpace(line[i+1:]), `"'`)
+	}
+	return config
+}
@@ -0,0 +1,140 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
+)
+
+func TestInspectLinux(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		files    map[string]string
+		expected *pb.OsRelease
+	}{
+		{
+			name:     "no metadata",
+			files:    map[string]string{"/etc/hostname": "vm"},
+			expected: nil,
+		},
+		{
+			name:     "unknown ID",
+			files:    map[string]string{"/etc/os-release": "ID=gentoo\nVERSION_ID=2.7"},
+			expected: nil,
+		},
+		{
+			name:     "ubuntu",
+			files:    map[string]string{"/etc/os-release": "NAME=\"Ubuntu\"\nID=ubuntu\nVERSION_ID=\"18.04\"\n"},
+			expected: &pb.OsRelease{DistroId: pb.Distro_UBUNTU, MajorVersion: "18", MinorVersion: "04"},
+		},
+		{
+			name:     "ID is case-insensitive",
+			files:    map[string]string{"/etc/os-release": "ID='Fedora'\nVERSION_ID=33"},
+			expected: &pb.OsRelease{DistroId: pb.Distro_FEDORA, MajorVersion: "33"},
+		},
+		{
+			name:     "alias",
+			files:    map[string]string{"/etc/os-release": "ID=\"amzn\"\r\nVERSION_ID=\"2\"\r\n"},
+			expected: &pb.OsRelease{DistroId: pb.Distro_AMAZON, MajorVersion: "2"},
+		},
+		{
+			name: "debian uses the longer legacy version",
+			files: map[string]string{
+				"/etc/os-release":     "# comment\nID=debian\nVERSION_ID=\"8\"",
+				"/etc/debian_version": "8.8\n",
+			},
+			expected: &pb.OsRelease{DistroId: pb.Distro_DEBIAN, MajorVersion: "8", MinorVersion: "8"},
+		},
+		{
+			name: "debian without os-release isn't matched, since it has no predicate",
+			files: map[string]string{
+				"/etc/debian_version": "6.0.10\n",
+			},
+			expected: nil,
+		},
+		{
+			name: "centos without os-release",
+			files: map[string]string{
+				"/etc/centos-release": "CentOS release 6.10 (Final)",
+				"/etc/redhat-release": "CentOS release 6.10 (Final)",
+			},
+			expected: &pb.OsRelease{DistroId: pb.Distro_CENTOS, MajorVersion: "6", MinorVersion: "10"},
+		},
+		{
+			name: "rhel without os-release",
+			files: map[string]string{
+				"/etc/redhat-release": "Red Hat Enterprise Linux Server release 6.10 (Santiago)",
+			},
+			expected: &pb.OsRelease{DistroId: pb.Distro_RHEL, MajorVersion: "6", MinorVersion: "10"},
+		},
+		{
+			name: "oracle isn't rhel",
+			files: map[string]string{
+				"/etc/redhat-release": "Red Hat Enterprise Linux Server release 6.10 (Santiago)",
+				"/etc/oracle-release": "Oracle Linux Server release 6.10",
+			},
+			expected: nil,
+		},
+		{
+			name: "rhel requires redhat-release",
+			files: map[string]string{
+				"/etc/os-release": "ID=\"rhel\"\nVERSION_ID=\"8.3\"",
+			},
+			expected: nil,
+		},
+		{
+			name: "sles for sap",
+			files: map[string]string{
+				"/etc/os-release":               "ID=\"sles\"\nVERSION_ID=\"15.1\"",
+				"/etc/products.d/SLES_SAP.prod": "<product/>",
+			},
+			expected: &pb.OsRelease{DistroId: pb.Distro_SLES_SAP, MajorVersion: "15", MinorVersion: "1"},
+		},
+		{
+			name: "sles",
+			files: map[string]string{
+				"/etc/os-release": "ID=\"sles\"\nVERSION_ID=\"15.1\"",
+			},
+			expected: &pb.OsRelease{DistroId: pb.Distro_SLES, MajorVersion: "15", MinorVersion: "1"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]memFile{}
+			for p, content := range tt.files {
+				files[p] = memFile{kind: kindFile, content: content}
+			}
+			actual, err := inspectLinux(&memFS{files: files})
+			assert.NoError(t, err)
+			if diff := cmp.Diff(tt.expected, actual, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected difference:\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestParseConfigFile(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"ID":          "debian",
+		"VERSION_ID":  "10",
+		"PRETTY_NAME": "Debian GNU/Linux 10 (buster)",
+		"EMPTY":       "",
+	}, parseConfigFile("ID=debian\n\n# VERSION_ID=9\nVERSION_ID=\"10\"\nPRETTY_NAME=\"Debian GNU/Linux 10 (buster)\"\nEMPTY=\nnot a pair\n"))
+}
@@ -0,0 +1,373 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	lvmMetadataMagic = " LVM2 x[5A%r0N*>"
+	// Limits the size of the metadata text that is read.
+	maxLVMMetadataSize = 4 * 1024 * 1024
+)
+
+// logicalVolume is an LVM2 logical volume, with the ranges of the physical
+// volume that it maps to.
+type logicalVolume struct {
+	name     string
+	pv       io.ReaderAt
+	segments []lvmSegment
+	size     int64
+}
+
+// lvmSegment maps a range of a logical volume to the physical volume.
+type lvmSegment struct {
+	offset, size, pvOffset int64
+}
+
+func (lv *logicalVolume) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		if off >= lv.size {
+			return read, io.EOF
+		}
+		i := sort.Search(len(lv.segments), func(i int) bool {
+			return lv.segments[i].offset+lv.segments[i].size > off
+		})
+		if i == len(lv.segments) || lv.segments[i].offset > off {
+			return read, fmt.Errorf("offset %d of logical volume %q is not mapped", off, lv.name)
+		}
+		seg := lv.segments[i]
+		n := int64(len(p) - read)
+		if n > seg.offset+seg.size-off {
+			n = seg.offset + seg.size - off
+		}
+		m, err := lv.pv.ReadAt(p[read:read+int(n)], seg.pvOffset+off-seg.offset)
+		read += m
+		off += int64(m)
+		if err != nil && !(err == io.EOF && int64(m) == n) {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+// readLogicalVolumes returns the logical volumes of the LVM2 physical volume
+// r, or nil when r isn't a physical volume. Only linear volumes that are
+// fully contained in r are returned, since volumes on other disks can't be
+// read.
+func readLogicalVolumes(r io.ReaderAt) ([]*logicalVolume, error) {
+	pvID, metadataOffset, metadataSize, err := readPVHeader(r)
+	if err != nil || pvID == "" {
+		return nil, err
+	}
+	text, err := readLVMMetadata(r, metadataOffset, metadataSize)
+	if err != nil {
+		return nil, err
+	}
+	config, err := parseLVMConfig(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse LVM metadata: %w", err)
+	}
+
+	for _, v := range config {
+		vg, ok := v.(lvmConfig)
+		if !ok || vg["physical_volumes"] == nil {
+			continue
+		}
+		return volumeGroupLVs(r, vg, pvID)
+	}
+	return nil, errors.New("LVM volume group not found in metadata")
+}
+
+// readPVHeader finds the label of a physical volume in its first four
+// sectors, and returns the PV's ID and the location of its first metadata
+// area.
+func readPVHeader(r io.ReaderAt) (id string, metadataOffset, metadataSize int64, err error) {
+	sectors := make([]byte, 4*sectorSize)
+	if _, err := r.ReadAt(sectors, 0); err != nil && err != io.EOF {
+		return "", 0, 0, err
+	}
+	for i := 0; i < 4; i++ {
+		label := sectors[i*sectorSize : (i+1)*sectorSize]
+		if !bytes.HasPrefix(label, []byte("LABELONE")) || !bytes.Equal(label[24:32], []byte("LVM2 001")) {
+			continue
+		}
+		pvHeaderOffset := binary.LittleEndian.Uint32(label[20:])
+		if pvHeaderOffset < 32 || pvHeaderOffset >= sectorSize-40 {
+			return "", 0, 0, errors.New("invalid LVM label")
+		}
+		pvHeader := label[pvHeaderOffset:]
+		id = string(pvHeader[:32])
+		// The UUID and device size are followed by two lists of locations,
+		// each terminated by a zero entry: data areas, then metadata areas.
+		locations := pvHeader[40:]
+		for len(locations) >= 16 && binary.LittleEndian.Uint64(locations) != 0 {
+			locations = locations[16:]
+		}
+		if len(locations) < 32 {
+			break
+		}
+		locations = locations[16:]
+		metadataOffset = int64(binary.LittleEndian.Uint64(locations))
+		metadataSize = int64(binary.LittleEndian.Uint64(locations[8:]))
+		if metadataOffset == 0 {
+			return "", 0, 0, errors.New("LVM physical volume has no metadata area")
+		}
+		return id, metadataOffset, metadataSize, nil
+	}
+	return "", 0, 0, nil
+}
+
+// readLVMMetadata reads the current metadata text of a metadata area, which
+// is a circular buffer following the 512-byte header.
+func readLVMMetadata(r io.ReaderAt, offset, size int64) (string, error) {
+	header := make([]byte, sectorSize)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		return "", fmt.Errorf("failed to read LVM metadata area: %w", err)
+	}
+	if !bytes.Equal(header[4:20], []byte(lvmMetadataMagic)) {
+		return "", errors.New("invalid LVM metadata area")
+	}
+	textOffset := int64(binary.LittleEndian.Uint64(header[40:]))
+	textSize := int64(binary.LittleEndian.Uint64(header[48:]))
+	if textOffset < sectorSize || textOffset >= size || textSize > maxLVMMetadataSize || textSize > size-sectorSize {
+		return "", errors.New("invalid LVM metadata location")
+	}
+	text := make([]byte, textSize)
+	first := textSize
+	if textOffset+textSize > size {
+		first = size - textOffset
+	}
+	if _, err := r.ReadAt(text[:first], offset+textOffset); err != nil {
+		return "", fmt.Errorf("failed to read LVM metadata: %w", err)
+	}
+	if _, err := r.ReadAt(text[first:], offset+sectorSize); err != nil {
+		return "", fmt.Errorf("failed to read LVM metadata: %w", err)
+	}
+	return string(bytes.TrimRight(text, "\x00")), nil
+}
+
+// volumeGroupLVs returns the logical volumes of a volume group that are
+// linear, and fully contained in the physical volume with ID pvID.
+func volumeGroupLVs(r io.ReaderAt, vg lvmConfig, pvID string) ([]*logicalVolume, error) {
+	extentSize := vg.int("extent_size") * sectorSize
+	var pvName string
+	var peStart int64
+	pvs, _ := vg["physical_volumes"].(lvmConfig)
+	for name, v := range pvs {
+		pv, ok := v.(lvmConfig)
+		if ok && strings.ReplaceAll(pv.string("id"), "-", "") == pvID {
+			pvName, peStart = name, pv.int("pe_start")*sectorSize
+		}
+	}
+	if pvName == "" || extentSize <= 0 {
+		return nil, errors.New("LVM physical volume not found in metadata")
+	}
+
+	var volumes []*logicalVolume
+	lvs, _ := vg["logical_volumes"].(lvmConfig)
+	for name, v := range lvs {
+		lv, ok := v.(lvmConfig)
+		if !ok {
+			continue
+		}
+		volume := &logicalVolume{name: name, pv: r}
+		for key, s := range lv {
+			seg, ok := s.(lvmConfig)
+			if !ok || !strings.HasPrefix(key, "segment") {
+				continue
+			}
+			stripes, _ := seg["stripes"].([]interface{})
+			if seg.string("type") != "striped" || seg.int("stripe_count") != 1 || len(stripes) != 2 || stripes[0] != pvName {
+				volume = nil
+				break
+			}
+			pvExtent, _ := stripes[1].(int64)
+			volume.segments = append(volume.segments, lvmSegment{
+				offset:   seg.int("start_extent") * extentSize,
+				size:     seg.int("extent_count") * extentSize,
+				pvOffset: peStart + pvExtent*extentSize,
+			})
+		}
+		if volume == nil || len(volume.segments) == 0 {
+			continue
+		}
+		sort.Slice(volume.segments, func(i, j int) bool {
+			return volume.segments[i].offset < volume.segments[j].offset
+		})
+		last := volume.segments[len(volume.segments)-1]
+		volume.size = last.offset + last.size
+		volumes = append(volumes, volume)
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].name < volumes[j].name
+	})
+	return volumes, nil
+}
+
+// lvmConfig is a section of LVM2 metadata. Values are int64, string,
+// []interface{}, or lvmConfig for subsections.
+type lvmConfig map[string]interface{}
+
+func (c lvmConfig) int(key string) int64 {
+	v, _ := c[key].(int64)
+	return v
+}
+
+func (c lvmConfig) string(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+// parseLVMConfig parses the text format of LVM2 metadata, such as:
+//
+//	vg0 {
+//	  extent_size = 8192
+//	  physical_volumes {
+//	    pv0 {
+//	      id = "..."
+//	    }
+//	  }
+//	}
+func parseLVMConfig(text string) (lvmConfig, error) {
+	p := &lvmParser{tokens: tokenizeLVMConfig(text)}
+	config, err := p.section()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return config, nil
+}
+
+type lvmParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *lvmParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+// section parses assignments and subsections, until a closing brace or the
+// end of the text.
+func (p *lvmParser) section() (lvmConfig, error) {
+	config := lvmConfig{}
+	for p.pos < len(p.tokens) && p.tokens[p.pos] != "}" {
+		key := p.next()
+		switch p.next() {
+		case "{":
+			sub, err := p.section()
+			if err != nil {
+				return nil, err
+			}
+			if p.next() != "}" {
+				return nil, fmt.Errorf("section %q is not closed", key)
+			}
+			config[key] = sub
+		case "=":
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			config[key] = v
+		default:
+			return nil, fmt.Errorf("expected '=' or '{' after %q", key)
+		}
+	}
+	return config, nil
+}
+
+func (p *lvmParser) value() (interface{}, error) {
+	token := p.next()
+	switch {
+	case token == "[":
+		list := []interface{}{}
+		for p.pos < len(p.tokens) && p.tokens[p.pos] != "]" {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if p.pos < len(p.tokens) && p.tokens[p.pos] == "," {
+				p.pos++
+			}
+		}
+		if p.next() != "]" {
+			return nil, errors.New("list is not closed")
+		}
+		return list, nil
+	case strings.HasPrefix(token, `"`):
+		return token[1:], nil
+	default:
+		n, err := strconv.ParseInt(token, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", token)
+		}
+		return n, nil
+	}
+}
+
+// tokenizeLVMConfig splits text into punctuation, words, and strings. Strings
+// are unescaped, and keep their opening quote to tell them apart from words.
+func tokenizeLVMConfig(text string) []string {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '#':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.IndexByte("{}[]=,", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			var s strings.Builder
+			s.WriteByte('"')
+			for i++; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' && i+1 < len(text) {
+					i++
+				}
+				s.WriteByte(text[i])
+			}
+			tokens = append(tokens, s.String())
+			i++
+		default:
+			start := i
+			for i < len(text) && strings.IndexByte("{}[]=,\"# \t\n\r", text[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, text[start:i])
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,199 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPVID          = "Z4Ek3lWq0f9HcSpV1yKj7aNQmLx2BtRu"
+	testPVIDFormatted = "Z4Ek3l-Wq0f-9HcS-pV1y-Kj7a-NQmL-x2BtRu"
+	// The data of test PVs starts at 1 MiB, as with pvcreate's defaults.
+	testPEStart = 1024 * 1024
+)
+
+// buildPV creates a physical volume with metadata, and with data at
+// testPEStart.
+func buildPV(metadata string, data []byte) []byte {
+	pv := make([]byte, testPEStart+len(data))
+	label := pv[sectorSize:]
+	copy(label, "LABELONE")
+	binary.LittleEndian.PutUint64(label[8:], 1)
+	binary.LittleEndian.PutUint32(label[20:], 32)
+	copy(label[24:], "LVM2 001")
+	pvHeader := label[32:]
+	copy(pvHeader, testPVID)
+	binary.LittleEndian.PutUint64(pvHeader[32:], uint64(len(pv)))
+	// One data area, and one metadata area, each followed by a zero entry.
+	binary.LittleEndian.PutUint64(pvHeader[40:], testPEStart)
+	binary.LittleEndian.PutUint64(pvHeader[72:], 4096)
+	binary.LittleEndian.PutUint64(pvHeader[80:], testPEStart-4096)
+
+	writeMetadataArea(pv[4096:testPEStart], sectorSize, metadata)
+	copy(pv[testPEStart:], data)
+	return pv
+}
+
+// writeMetadataArea writes the header of a metadata area, and its text at
+// textOffset, wrapping around to the start of the circular buffer.
+func writeMetadataArea(area []byte, textOffset int, text string) {
+	copy(area[4:], lvmMetadataMagic)
+	binary.LittleEndian.PutUint32(area[20:], 1)
+	binary.LittleEndian.PutUint64(area[32:], uint64(len(area)))
+	binary.LittleEndian.PutUint64(area[40:], uint64(textOffset))
+	binary.LittleEndian.PutUint64(area[48:], uint64(len(text)))
+	n := copy(area[textOffset:], text)
+	copy(area[sectorSize:], text[n:])
+}
+
+// volumeGroup returns metadata for a volume group with the logical
+// volumes lvs, whose extents are on the test PV.
+func volumeGroup(lvs ...string) string {
+	return fmt.Sprintf(`vg0 {
+id = "vHfK3p-0000-0000-0000-0000-0000-000000"
+seqno = 3
+extent_size = 8192 # 4 MiB
+physical_volumes {
+pv0 {
+id = "%s"
+device = "/dev/sda2"
+pe_start = 2048
+pe_count = 16
+}
+}
+logical_volumes {
+%s}
+}
+# Generated by LVM2
+contents = "Text Format Volume Group"
+version = 1
+`, testPVIDFormatted, strings.Join(lvs, ""))
+}
+
+// linearLV returns the metadata of a logical volume that maps to one
+// physical extent per segment.
+func linearLV(name string, extents ...int) string {
+	lv := fmt.Sprintf("%s {\nsegment_count = %d\n", name, len(extents))
+	for i, pe := range extents {
+		lv += fmt.Sprintf("segment%d {\nstart_extent = %d\nextent_count = 1\ntype = \"striped\"\n"+
+			"stripe_count = 1\nstripes = [\n\"pv0\", %d\n]\n}\n", i+1, i, pe)
+	}
+	return lv + "}\n"
+}
+
+func TestReadLogicalVolumes(t *testing.T) {
+	const extentSize = 4 * 1024 * 1024
+	data := make([]byte, 3*extentSize)
+	copy(data[2*extentSize:], "first extent")
+	copy(data[extentSize-6:], "second")
+	metadata := volumeGroup(
+		linearLV("swap", 1),
+		linearLV("root", 2, 0),
+		"mirror {\nsegment1 {\nstart_extent = 0\nextent_count = 1\ntype = \"mirror\"\nmirror_count = 2\n}\n}\n",
+	)
+	lvs, err := readLogicalVolumes(bytes.NewReader(buildPV(metadata, data)))
+	require.NoError(t, err)
+	require.Len(t, lvs, 2)
+	assert.Equal(t, "root", lvs[0].name)
+	assert.Equal(t, int64(2*extentSize), lvs[0].size)
+	assert.Equal(t, "swap", lvs[1].name)
+
+	b := make([]byte, 18)
+	_, err = lvs[0].ReadAt(b, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "first extent\x00\x00\x00\x00\x00\x00", string(b))
+	_, err = lvs[0].ReadAt(b, 2*extentSize-12)
+	assert.Equal(t, io.EOF, err)
+	_, err = lvs[0].ReadAt(b[:12], 2*extentSize-12)
+	assert.NoError(t, err)
+	assert.Equal(t, "\x00\x00\x00\x00\x00\x00second", string(b[:12]))
+}
+
+func TestReadLogicalVolumes_ReturnsNilWhenNotPhysicalVolume(t *testing.T) {
+	lvs, err := readLogicalVolumes(bytes.NewReader(make([]byte, 4096)))
+	assert.NoError(t, err)
+	assert.Nil(t, lvs)
+}
+
+func TestReadLogicalVolumes_RequiresPhysicalVolumeInMetadata(t *testing.T) {
+	pv := buildPV(volumeGroup(), nil)
+	copy(pv[sectorSize+32:], "someotherphysicalvolumeid0000000")
+	_, err := readLogicalVolumes(bytes.NewReader(pv))
+	assert.EqualError(t, err, "LVM physical volume not found in metadata")
+}
+
+func TestReadLVMMetadata_WrapsAround(t *testing.T) {
+	area := make([]byte, 2*sectorSize)
+	text := "vg0 { seqno = 1 }"
+	writeMetadataArea(area, len(area)-5, text)
+	actual, err := readLVMMetadata(bytes.NewReader(area), 0, int64(len(area)))
+	assert.NoError(t, err)
+	assert.Equal(t, text, actual)
+}
+
+func TestParseLVMConfig(t *testing.T) {
+	config, err := parseLVMConfig(`
+# comment
+vg0 {
+	id = "a-b"	# trailing comment
+	flags = []
+	status = ["READ", "WRITE"]
+	description = "quoted \"text\""
+	negative = -1
+	nested {
+		stripes = [
+			"pv0", 0,
+			"pv1", 10
+		]
+	}
+}
+`)
+	require.NoError(t, err)
+	assert.Equal(t, lvmConfig{
+		"vg0": lvmConfig{
+			"id":          "a-b",
+			"flags":       []interface{}{},
+			"status":      []interface{}{"READ", "WRITE"},
+			"description": `quoted "text"`,
+			"negative":    int64(-1),
+			"nested": lvmConfig{
+				"stripes": []interface{}{"pv0", int64(0), "pv1", int64(10)},
+			},
+		},
+	}, config)
+}
+
+func TestParseLVMConfig_Errors(t *testing.T) {
+	for text, expected := range map[string]string{
+		"vg0 {":               `section "vg0" is not closed`,
+		"vg0 }":               `expected '=' or '{' after "vg0"`,
+		"key = [1, 2":         "list is not closed",
+		"key = value":         `invalid value "value"`,
+		"vg0 { a = 1 } }":     `unexpected "}"`,
+		"vg0 { a = 1 } b = x": `invalid value "x"`,
+	} {
+		_, err := parseLVMConfig(text)
+		assert.EqualError(t, err, expected, text)
+	}
+}
@@ -0,0 +1,468 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	ntfsRootRecord = 5
+
+	ntfsAttrList            = 0x20
+	ntfsAttrData            = 0x80
+	ntfsAttrIndexRoot       = 0x90
+	ntfsAttrIndexAllocation = 0xa0
+	ntfsAttrBitmap          = 0xb0
+	ntfsAttrEnd             = 0xffffffff
+
+	ntfsRecordDirectory = 0x2
+	ntfsAttrCompressed  = 0x1
+	ntfsAttrEncrypted   = 0x4000
+
+	ntfsIndexEntryHasChild = 0x1
+	ntfsIndexEntryLast     = 0x2
+
+	// Record references use the low 48 bits for the record number, and the
+	// rest for a sequence number.
+	ntfsRecordMask = 1<<48 - 1
+)
+
+// ntfsFS reads NTFS filesystems, using MFT record numbers as inodes.
+// Compressed and encrypted files can't be read.
+type ntfsFS struct {
+	r           io.ReaderAt
+	clusterSize int64
+	recordSize  int64
+	// mft is the $DATA attribute of the MFT.
+	mft *ntfsAttribute
+}
+
+// ntfsAttribute is an attribute of a file. Non-resident attributes that are
+// split into several pieces, with an attribute list, are merged.
+type ntfsAttribute struct {
+	typ         uint32
+	name        string
+	flags       uint16
+	resident    bool
+	value       []byte
+	startVCN    int64
+	runs        []ntfsRun
+	size        int64
+	initialized int64
+}
+
+// ntfsRun is a run of clusters, which reads as zeros when lcn is negative.
+type ntfsRun struct {
+	vcn, lcn, length int64
+}
+
+func openNTFS(r io.ReaderAt) (*ntfsFS, error) {
+	boot := make([]byte, 512)
+	if _, err := r.ReadAt(boot, 0); err != nil {
+		return nil, fmt.Errorf("failed to read ntfs boot sector: %w", err)
+	}
+	bytesPerSector := int64(binary.LittleEndian.Uint16(boot[11:]))
+	// Sizes are either a count, or a negative power of two.
+	sectorsPerCluster := int64(boot[13])
+	if sectorsPerCluster > 0x80 {
+		sectorsPerCluster = 1 << (256 - sectorsPerCluster)
+	}
+	fs := &ntfsFS{r: r, clusterSize: bytesPerSector * sectorsPerCluster}
+	if v := int8(boot[64]); v > 0 {
+		fs.recordSize = int64(v) * fs.clusterSize
+	} else {
+		fs.recordSize = 1 << uint(-v)
+	}
+	if bytesPerSector < 256 || fs.clusterSize == 0 || fs.clusterSize > 2*1024*1024 ||
+		fs.recordSize < 512 || fs.recordSize > 64*1024 {
+		return nil, errors.New("invalid ntfs boot sector")
+	}
+
+	// The MFT's record describes the location of the MFT.
+	mftOffset := int64(binary.LittleEndian.Uint64(boot[48:])) * fs.clusterSize
+	record := make([]byte, fs.recordSize)
+	if _, err := r.ReadAt(record, mftOffset); err != nil {
+		return nil, fmt.Errorf("failed to read ntfs MFT: %w", err)
+	}
+	if err := applyFixups(record, "FILE"); err != nil {
+		return nil, err
+	}
+	attrs, err := parseAttributes(record)
+	if err != nil {
+		return nil, err
+	}
+	if fs.mft = findAttribute(attrs, ntfsAttrData, ""); fs.mft == nil || fs.mft.resident {
+		return nil, errors.New("ntfs MFT has no data")
+	}
+	return fs, nil
+}
+
+func (fs *ntfsFS) name() string {
+	return "ntfs"
+}
+
+func (fs *ntfsFS) root() uint64 {
+	return ntfsRootRecord
+}
+
+func (fs *ntfsFS) record(n uint64) ([]byte, error) {
+	record := make([]byte, fs.recordSize)
+	if err := fs.readNonResident(fs.mft, record, int64(n)*fs.recordSize); err != nil {
+		return nil, fmt.Errorf("failed to read ntfs record %d: %w", n, err)
+	}
+	if err := applyFixups(record, "FILE"); err != nil {
+		return nil, fmt.Errorf("invalid ntfs record %d: %w", n, err)
+	}
+	return record, nil
+}
+
+// attributes returns the attributes of the file with record n, including
+// the attributes stored in other records.
+func (fs *ntfsFS) attributes(n uint64) ([]*ntfsAttribute, error) {
+	record, err := fs.record(n)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := parseAttributes(record)
+	if err != nil {
+		return nil, err
+	}
+	list := findAttribute(attrs, ntfsAttrList, "")
+	if list == nil {
+		return attrs, nil
+	}
+	listValue, err := fs.value(list)
+	if err != nil {
+		return nil, err
+	}
+	// The attribute list references all attributes, including the ones in
+	// the base record.
+	seen := map[uint64]bool{n: true}
+	for pos := 0; pos+26 <= len(listValue); {
+		length := int(binary.LittleEndian.Uint16(listValue[pos+4:]))
+		ref := binary.LittleEndian.Uint64(listValue[pos+16:]) & ntfsRecordMask
+		if length < 26 {
+			break
+		}
+		pos += length
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		extension, err := fs.record(ref)
+		if err != nil {
+			return nil, err
+		}
+		extensionAttrs, err := parseAttributes(extension)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, extensionAttrs...)
+	}
+	return mergeAttributes(attrs), nil
+}
+
+func (fs *ntfsFS) kind(n uint64) (fileKind, error) {
+	record, err := fs.record(n)
+	if err != nil {
+		return 0, err
+	}
+	if binary.LittleEndian.Uint16(record[22:])&ntfsRecordDirectory != 0 {
+		return kindDirectory, nil
+	}
+	return kindFile, nil
+}
+
+func (fs *ntfsFS) read(n uint64) ([]byte, error) {
+	attrs, err := fs.attributes(n)
+	if err != nil {
+		return nil, err
+	}
+	data := findAttribute(attrs, ntfsAttrData, "")
+	if data == nil {
+		return nil, fmt.Errorf("ntfs record %d has no data", n)
+	}
+	return fs.value(data)
+}
+
+// value returns the content of an attribute.
+func (fs *ntfsFS) value(attr *ntfsAttribute) ([]byte, error) {
+	if attr.resident {
+		return attr.value, nil
+	}
+	if attr.flags&(ntfsAttrCompressed|ntfsAttrEncrypted) != 0 {
+		return nil, errors.New("compressed and encrypted ntfs files are not supported")
+	}
+	if attr.size < 0 || attr.size > maxFileSize {
+		return nil, fmt.Errorf("ntfs attribute is too large: %d bytes", attr.size)
+	}
+	data := make([]byte, attr.size)
+	if err := fs.readNonResident(attr, data, 0); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readNonResident fills p with the content of attr at offset.
+func (fs *ntfsFS) readNonResident(attr *ntfsAttribute, p []byte, offset int64) error {
+	zero(p)
+	end := offset + int64(len(p))
+	if end > attr.initialized {
+		end = attr.initialized
+	}
+	for _, run := range attr.runs {
+		runStart, runEnd := run.vcn*fs.clusterSize, (run.vcn+run.length)*fs.clusterSize
+		start, stop := runStart, runEnd
+		if start < offset {
+			start = offset
+		}
+		if stop > end {
+			stop = end
+		}
+		if start >= stop || run.lcn < 0 {
+			continue
+		}
+		if _, err := fs.r.ReadAt(p[start-offset:stop-offset], run.lcn*fs.clusterSize+start-runStart); err != nil {
+			return err
+		}
+	}
+	if offset+int64(len(p)) > attr.size {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (fs *ntfsFS) lookup(dir uint64, name string) (uint64, error) {
+	attrs, err := fs.attributes(dir)
+	if err != nil {
+		return 0, err
+	}
+	root := findAttribute(attrs, ntfsAttrIndexRoot, "$I30")
+	if root == nil || len(root.value) < 32 {
+		return 0, fmt.Errorf("ntfs record %d is not a directory", dir)
+	}
+	if ref, ok := lookupIndexNode(root.value[16:], name); ok {
+		return ref, nil
+	}
+
+	// Rather than following the b-tree, all index blocks that are in use
+	// are searched.
+	allocation := findAttribute(attrs, ntfsAttrIndexAllocation, "$I30")
+	if allocation == nil {
+		return 0, errNotExist
+	}
+	blockSize := int64(binary.LittleEndian.Uint32(root.value[8:]))
+	if blockSize < 512 || blockSize > 64*1024 {
+		return 0, fmt.Errorf("invalid ntfs index block size %d", blockSize)
+	}
+	blocks, err := fs.value(allocation)
+	if err != nil {
+		return 0, err
+	}
+	var bitmap []byte
+	if attr := findAttribute(attrs, ntfsAttrBitmap, "$I30"); attr != nil {
+		if bitmap, err = fs.value(attr); err != nil {
+			return 0, err
+		}
+	}
+	for i := int64(0); (i+1)*blockSize <= int64(len(blocks)); i++ {
+		if bitmap != nil && (i/8 >= int64(len(bitmap)) || bitmap[i/8]&(1<<uint(i%8)) == 0) {
+			continue
+		}
+		block := blocks[i*blockSize : (i+1)*blockSize]
+		if err := applyFixups(block, "INDX"); err != nil {
+			continue
+		}
+		if ref, ok := lookupIndexNode(block[24:], name); ok {
+			return ref, nil
+		}
+	}
+	return 0, errNotExist
+}
+
+// lookupIndexNode finds name in the entries of an index node. Names are
+// compared case-insensitively, as Windows does.
+func lookupIndexNode(node []byte, name string) (uint64, bool) {
+	start := int(binary.LittleEndian.Uint32(node))
+	end := int(binary.LittleEndian.Uint32(node[4:]))
+	if end > len(node) {
+		end = len(node)
+	}
+	for pos := start; pos+16 <= end; {
+		length := int(binary.LittleEndian.Uint16(node[pos+8:]))
+		keyLength := int(binary.LittleEndian.Uint16(node[pos+10:]))
+		flags := binary.LittleEndian.Uint32(node[pos+12:])
+		if flags&ntfsIndexEntryLast != 0 || length < 16 || pos+length > end {
+			break
+		}
+		// The key is a $FILE_NAME attribute.
+		if key := node[pos+16 : pos+16+keyLength]; len(key) >= 66 {
+			nameLength := int(key[64])
+			if 66+2*nameLength <= len(key) && strings.EqualFold(decodeUTF16(key[66:66+2*nameLength]), name) {
+				return binary.LittleEndian.Uint64(node[pos:]) & ntfsRecordMask, true
+			}
+		}
+		pos += length
+	}
+	return 0, false
+}
+
+// applyFixups checks the magic of a multi-sector record, and restores the
+// last two bytes of each sector, which are replaced by a sequence number
+// when the record is written.
+func applyFixups(record []byte, magic string) error {
+	if !bytes.HasPrefix(record, []byte(magic)) {
+		return fmt.Errorf("%s record not found", magic)
+	}
+	offset := int(binary.LittleEndian.Uint16(record[4:]))
+	count := int(binary.LittleEndian.Uint16(record[6:]))
+	if count == 0 || offset+2*count > len(record) || (count-1)*512 > len(record) {
+		return fmt.Errorf("invalid %s record", magic)
+	}
+	for i := 1; i < count; i++ {
+		end := i * 512
+		if !bytes.Equal(record[end-2:end], record[offset:offset+2]) {
+			return fmt.Errorf("torn %s record", magic)
+		}
+		copy(record[end-2:end], record[offset+2*i:offset+2*i+2])
+	}
+	return nil
+}
+
+// parseAttributes returns the attributes of a record.
+func parseAttributes(record []byte) ([]*ntfsAttribute, error) {
+	var attrs []*ntfsAttribute
+	for pos := int(binary.LittleEndian.Uint16(record[20:])); pos+16 <= len(record); {
+		typ := binary.LittleEndian.Uint32(record[pos:])
+		if typ == ntfsAttrEnd {
+			break
+		}
+		length := int(binary.LittleEndian.Uint32(record[pos+4:]))
+		if length < 16 || pos+length > len(record) {
+			return nil, errors.New("invalid ntfs attribute")
+		}
+		a := record[pos : pos+length]
+		pos += length
+
+		attr := &ntfsAttribute{typ: typ, flags: binary.LittleEndian.Uint16(a[12:])}
+		if nameLength, nameOffset := int(a[9]), int(binary.LittleEndian.Uint16(a[10:])); nameLength > 0 {
+			if nameOffset+2*nameLength > len(a) {
+				return nil, errors.New("invalid ntfs attribute name")
+			}
+			attr.name = decodeUTF16(a[nameOffset : nameOffset+2*nameLength])
+		}
+		if a[8] == 0 {
+			valueLength, valueOffset := int(binary.LittleEndian.Uint32(a[16:])), int(binary.LittleEndian.Uint16(a[20:]))
+			if valueOffset+valueLength > len(a) {
+				return nil, errors.New("invalid ntfs attribute value")
+			}
+			attr.resident = true
+			attr.value = a[valueOffset : valueOffset+valueLength]
+		} else {
+			if len(a) < 64 {
+				return nil, errors.New("invalid ntfs attribute")
+			}
+			attr.startVCN = int64(binary.LittleEndian.Uint64(a[16:]))
+			attr.size = int64(binary.LittleEndian.Uint64(a[48:]))
+			attr.initialized = int64(binary.LittleEndian.Uint64(a[56:]))
+			runs, err := decodeRuns(a[binary.LittleEndian.Uint16(a[32:]):], attr.startVCN)
+			if err != nil {
+				return nil, err
+			}
+			attr.runs = runs
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
+
+// decodeRuns decodes a run list, which is a sequence of variable-length
+// lengths and relative cluster offsets.
+func decodeRuns(b []byte, vcn int64) ([]ntfsRun, error) {
+	var runs []ntfsRun
+	var lcn int64
+	for pos := 0; pos < len(b) && b[pos] != 0; {
+		lengthSize, offsetSize := int(b[pos]&0xf), int(b[pos]>>4)
+		pos++
+		if lengthSize == 0 || lengthSize > 8 || offsetSize > 8 || pos+lengthSize+offsetSize > len(b) {
+			return nil, errors.New("invalid ntfs run list")
+		}
+		length := int64(readLittleEndian(b[pos:pos+lengthSize], false))
+		pos += lengthSize
+		run := ntfsRun{vcn: vcn, lcn: -1, length: length}
+		if offsetSize > 0 {
+			lcn += readLittleEndian(b[pos:pos+offsetSize], true)
+			run.lcn = lcn
+			pos += offsetSize
+		}
+		runs = append(runs, run)
+		vcn += length
+	}
+	return runs, nil
+}
+
+// readLittleEndian decodes an integer of up to eight bytes.
+func readLittleEndian(b []byte, signed bool) int64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	if signed && len(b) < 8 && b[len(b)-1]&0x80 != 0 {
+		v |= ^uint64(0) << (8 * uint(len(b)))
+	}
+	return int64(v)
+}
+
+// mergeAttributes merges the pieces of non-resident attributes that are
+// split across records.
+func mergeAttributes(attrs []*ntfsAttribute) []*ntfsAttribute {
+	sort.SliceStable(attrs, func(i, j int) bool {
+		return attrs[i].startVCN < attrs[j].startVCN
+	})
+	var merged []*ntfsAttribute
+	for _, attr := range attrs {
+		if first := findAttribute(merged, attr.typ, attr.name); first != nil && !attr.resident && attr.startVCN > 0 {
+			first.runs = append(first.runs, attr.runs...)
+			continue
+		}
+		merged = append(merged, attr)
+	}
+	return merged
+}
+
+func findAttribute(attrs []*ntfsAttribute, typ uint32, name string) *ntfsAttribute {
+	for _, attr := range attrs {
+		if attr.typ == typ && attr.name == name {
+			return attr
+		}
+	}
+	return nil
+}
+
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
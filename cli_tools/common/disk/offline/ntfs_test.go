@@ -0,0 +1,334 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testNTFSClusterSize = 4096
+	testNTFSRecordSize  = 1024
+	testNTFSMFTCluster  = 4
+	testNTFSMFTRecords  = 32
+	testNTFSClusters    = 64
+)
+
+// ntfsBuilder creates NTFS filesystems whose MFT is in contiguous clusters.
+type ntfsBuilder struct {
+	disk        []byte
+	nextCluster int64
+}
+
+type ntfsEntry struct {
+	name   string
+	record uint64
+}
+
+func newNTFSBuilder() *ntfsBuilder {
+	b := &ntfsBuilder{
+		disk:        make([]byte, testNTFSClusters*testNTFSClusterSize),
+		nextCluster: testNTFSMFTCluster + testNTFSMFTRecords*testNTFSRecordSize/testNTFSClusterSize,
+	}
+	boot := b.disk
+	copy(boot[3:], "NTFS    ")
+	binary.LittleEndian.PutUint16(boot[11:], 512)
+	boot[13] = testNTFSClusterSize / 512
+	binary.LittleEndian.PutUint64(boot[48:], testNTFSMFTCluster)
+	// Records of 2^10 bytes.
+	boot[64] = 0xf6
+	boot[510], boot[511] = 0x55, 0xaa
+
+	mftSize := int64(testNTFSMFTRecords * testNTFSRecordSize)
+	b.record(0, 0, b.nonResidentAttr(ntfsAttrData, "", 0,
+		[]ntfsRun{{vcn: 0, lcn: testNTFSMFTCluster, length: mftSize / testNTFSClusterSize}}, mftSize, mftSize, 0))
+	return b
+}
+
+// protect replaces the last two bytes of each sector of a multi-sector
+// record with a sequence number, saving them in the update sequence array.
+func protect(record []byte, usaOffset int) {
+	count := len(record)/512 + 1
+	binary.LittleEndian.PutUint16(record[4:], uint16(usaOffset))
+	binary.LittleEndian.PutUint16(record[6:], uint16(count))
+	copy(record[usaOffset:], []byte{0x42, 0x00})
+	for i := 1; i < count; i++ {
+		end := i * 512
+		copy(record[usaOffset+2*i:], record[end-2:end])
+		copy(record[end-2:end], []byte{0x42, 0x00})
+	}
+}
+
+func (b *ntfsBuilder) record(n uint64, flags uint16, attrs ...[]byte) {
+	record := make([]byte, testNTFSRecordSize)
+	copy(record, "FILE")
+	const firstAttr = 56
+	binary.LittleEndian.PutUint16(record[20:], firstAttr)
+	binary.LittleEndian.PutUint16(record[22:], 1|flags)
+	pos := firstAttr
+	for _, attr := range attrs {
+		pos += copy(record[pos:], attr)
+	}
+	binary.LittleEndian.PutUint32(record[pos:], ntfsAttrEnd)
+	protect(record, 48)
+	copy(b.disk[testNTFSMFTCluster*testNTFSClusterSize+int(n)*testNTFSRecordSize:], record)
+}
+
+func attrHeader(typ uint32, name string, headerSize int, nonResident bool) []byte {
+	encodedName := encodeUTF16(name)
+	attr := make([]byte, headerSize+len(encodedName))
+	binary.LittleEndian.PutUint32(attr, typ)
+	if nonResident {
+		attr[8] = 1
+	}
+	attr[9] = byte(len(name))
+	binary.LittleEndian.PutUint16(attr[10:], uint16(headerSize))
+	copy(attr[headerSize:], encodedName)
+	return attr
+}
+
+func finishAttr(attr []byte) []byte {
+	attr = append(attr, make([]byte, (8-len(attr)%8)%8)...)
+	binary.LittleEndian.PutUint32(attr[4:], uint32(len(attr)))
+	return attr
+}
+
+func (b *ntfsBuilder) residentAttr(typ uint32, name string, value []byte) []byte {
+	attr := attrHeader(typ, name, 24, false)
+	attr = append(attr, make([]byte, (8-len(attr)%8)%8)...)
+	binary.LittleEndian.PutUint32(attr[16:], uint32(len(value)))
+	binary.LittleEndian.PutUint16(attr[20:], uint16(len(attr)))
+	return finishAttr(append(attr, value...))
+}
+
+func (b *ntfsBuilder) nonResidentAttr(typ uint32, name string, startVCN int64, runs []ntfsRun,
+	size, initialized int64, flags uint16) []byte {
+	attr := attrHeader(typ, name, 64, true)
+	binary.LittleEndian.PutUint16(attr[12:], flags)
+	binary.LittleEndian.PutUint64(attr[16:], uint64(startVCN))
+	binary.LittleEndian.PutUint16(attr[32:], uint16(len(attr)))
+	binary.LittleEndian.PutUint64(attr[48:], uint64(size))
+	binary.LittleEndian.PutUint64(attr[56:], uint64(initialized))
+	return finishAttr(append(attr, encodeRuns(runs)...))
+}
+
+// encodeRuns encodes a run list, with the smallest sizes that fit.
+func encodeRuns(runs []ntfsRun) []byte {
+	var b []byte
+	var lcn int64
+	for _, run := range runs {
+		length := encodeLittleEndian(run.length)
+		var offset []byte
+		if run.lcn >= 0 {
+			offset = encodeLittleEndian(run.lcn - lcn)
+			lcn = run.lcn
+		}
+		b = append(b, byte(len(offset)<<4|len(length)))
+		b = append(append(b, length...), offset...)
+	}
+	return append(b, 0)
+}
+
+// encodeLittleEndian encodes a signed integer in as few bytes as possible.
+func encodeLittleEndian(v int64) []byte {
+	var b []byte
+	for {
+		b = append(b, byte(v))
+		v >>= 8
+		last := b[len(b)-1]
+		if (v == 0 && last&0x80 == 0) || (v == -1 && last&0x80 != 0) {
+			return b
+		}
+	}
+}
+
+// write stores content in clusters, and returns their runs. Content of more
+// than one cluster is split into runs that are in reverse order on disk.
+func (b *ntfsBuilder) write(content []byte) []ntfsRun {
+	clusters := (int64(len(content)) + testNTFSClusterSize - 1) / testNTFSClusterSize
+	runs := make([]ntfsRun, clusters)
+	for i := clusters - 1; i >= 0; i-- {
+		lcn := b.nextCluster
+		b.nextCluster++
+		copy(b.disk[lcn*testNTFSClusterSize:], content[i*testNTFSClusterSize:])
+		runs[i] = ntfsRun{vcn: i, lcn: lcn, length: 1}
+	}
+	return runs
+}
+
+// indexEntries encodes index entries, followed by the last entry.
+func indexEntries(entries []ntfsEntry) []byte {
+	var b []byte
+	for _, e := range entries {
+		name := encodeUTF16(e.name)
+		key := make([]byte, 66+len(name))
+		key[64] = byte(len(e.name))
+		copy(key[66:], name)
+		entry := make([]byte, (16+len(key)+7)&^7)
+		binary.LittleEndian.PutUint64(entry, e.record|uint64(1)<<48)
+		binary.LittleEndian.PutUint16(entry[8:], uint16(len(entry)))
+		binary.LittleEndian.PutUint16(entry[10:], uint16(len(key)))
+		copy(entry[16:], key)
+		b = append(b, entry...)
+	}
+	last := make([]byte, 16)
+	binary.LittleEndian.PutUint16(last[8:], 16)
+	binary.LittleEndian.PutUint32(last[12:], ntfsIndexEntryLast)
+	return append(b, last...)
+}
+
+// indexNode encodes the header of an index node, followed by its entries.
+func indexNode(entries []ntfsEntry) []byte {
+	encoded := indexEntries(entries)
+	node := make([]byte, 16)
+	binary.LittleEndian.PutUint32(node, 16)
+	binary.LittleEndian.PutUint32(node[4:], uint32(16+len(encoded)))
+	binary.LittleEndian.PutUint32(node[8:], uint32(16+len(encoded)))
+	return append(node, encoded...)
+}
+
+func (b *ntfsBuilder) indexRoot(entries []ntfsEntry) []byte {
+	root := make([]byte, 16)
+	binary.LittleEndian.PutUint32(root, 0x30)
+	binary.LittleEndian.PutUint32(root[8:], testNTFSClusterSize)
+	root[12] = 1
+	return b.residentAttr(ntfsAttrIndexRoot, "$I30", append(root, indexNode(entries)...))
+}
+
+func (b *ntfsBuilder) dir(n uint64, entries ...ntfsEntry) {
+	b.record(n, ntfsRecordDirectory, b.indexRoot(entries))
+}
+
+// largeDir writes a directory whose entries are in an index block. A
+// second index block, that isn't in use, has stale entries.
+func (b *ntfsBuilder) largeDir(n uint64, entries []ntfsEntry, stale []ntfsEntry) {
+	var blocks []byte
+	for _, e := range [][]ntfsEntry{entries, stale} {
+		block := make([]byte, testNTFSClusterSize)
+		copy(block, "INDX")
+		// The entries follow the node header, and the update sequence
+		// array.
+		encoded := indexEntries(e)
+		const entriesOffset = 16 + 64
+		binary.LittleEndian.PutUint32(block[24:], entriesOffset)
+		binary.LittleEndian.PutUint32(block[28:], uint32(entriesOffset+len(encoded)))
+		binary.LittleEndian.PutUint32(block[32:], testNTFSClusterSize-24)
+		copy(block[24+entriesOffset:], encoded)
+		protect(block, 40)
+		blocks = append(blocks, block...)
+	}
+	size := int64(len(blocks))
+	b.record(n, ntfsRecordDirectory,
+		b.indexRoot(nil),
+		b.nonResidentAttr(ntfsAttrIndexAllocation, "$I30", 0, b.write(blocks), size, size, 0),
+		b.residentAttr(ntfsAttrBitmap, "$I30", []byte{1, 0, 0, 0, 0, 0, 0, 0}))
+}
+
+// buildNTFS creates a filesystem with:
+//
+//	/Windows: a directory with an index block
+//	/Windows/System32/cmd.exe: a resident file
+//	/Windows/System32/config/SOFTWARE: a file of at least two clusters,
+//	  whose data is split across two extension records, referenced by an
+//	  attribute list
+//	/Windows/System32/sparse: a sparse file, that's partly initialized
+func buildNTFS(cmd, software []byte) []byte {
+	b := newNTFSBuilder()
+	b.dir(ntfsRootRecord, ntfsEntry{"Windows", 16}, ntfsEntry{"$Recycle.Bin", 30})
+	b.largeDir(16, []ntfsEntry{{"Fonts", 30}, {"System32", 17}}, []ntfsEntry{{"Temp", 17}})
+	b.dir(17, ntfsEntry{"cmd.exe", 18}, ntfsEntry{"config", 19}, ntfsEntry{"sparse", 23})
+	b.record(18, 0, b.residentAttr(ntfsAttrData, "", cmd))
+	b.dir(19, ntfsEntry{"SOFTWARE", 20})
+
+	runs := b.write(software)
+	size := int64(len(software))
+	var list []byte
+	for i, ref := range []uint64{20, 21, 22} {
+		entry := make([]byte, 32)
+		binary.LittleEndian.PutUint32(entry, ntfsAttrData)
+		binary.LittleEndian.PutUint16(entry[4:], 32)
+		if i > 0 {
+			binary.LittleEndian.PutUint64(entry[8:], uint64(runs[i-1].vcn))
+		}
+		binary.LittleEndian.PutUint64(entry[16:], ref)
+		list = append(list, entry...)
+	}
+	b.record(20, 0, b.residentAttr(ntfsAttrList, "", list))
+	b.record(21, 0, b.nonResidentAttr(ntfsAttrData, "", 0, runs[:1], size, size, 0))
+	b.record(22, 0, b.nonResidentAttr(ntfsAttrData, "", 1, runs[1:], 0, 0, 0))
+
+	sparse := []ntfsRun{b.write([]byte("initialized, then uninitialized"))[0], {vcn: 1, lcn: -1, length: 1}}
+	b.record(23, 0, b.nonResidentAttr(ntfsAttrData, "", 0, sparse, 2*testNTFSClusterSize, 11, 0))
+	return b.disk
+}
+
+func TestOpenNTFS(t *testing.T) {
+	software := bytes.Repeat([]byte("hive"), 2000)
+	fs, err := openFilesystem(bytes.NewReader(buildNTFS([]byte("MZ"), software)))
+	require.NoError(t, err)
+	assert.Equal(t, "ntfs", fs.name())
+
+	cmd, err := readFile(fs, "/windows/system32/CMD.EXE")
+	assert.NoError(t, err)
+	assert.Equal(t, "MZ", string(cmd))
+
+	actual, err := readFile(fs, "/Windows/System32/config/SOFTWARE")
+	assert.NoError(t, err)
+	assert.Equal(t, software, actual)
+
+	sparse, err := readFile(fs, "/Windows/System32/sparse")
+	assert.NoError(t, err)
+	assert.Equal(t, append([]byte("initialized"), make([]byte, 2*testNTFSClusterSize-11)...), sparse)
+
+	assert.True(t, isDir(fs, "/Windows/System32/config"))
+	assert.False(t, isDir(fs, "/Windows/Temp"), "Entries of index blocks that aren't in use should be ignored")
+	assert.False(t, isFile(fs, "/Windows/System32/missing"))
+}
+
+func TestOpenNTFS_RejectsTornRecords(t *testing.T) {
+	disk := buildNTFS(nil, make([]byte, 2*testNTFSClusterSize))
+	// The end of the second sector of the root directory's record.
+	disk[testNTFSMFTCluster*testNTFSClusterSize+ntfsRootRecord*testNTFSRecordSize+1022] = 0
+	fs, err := openFilesystem(bytes.NewReader(disk))
+	require.NoError(t, err)
+	_, err = readFile(fs, "/Windows/System32/cmd.exe")
+	assert.EqualError(t, err, "invalid ntfs record 5: torn FILE record")
+}
+
+func TestReadNTFSValue_RejectsCompressedFiles(t *testing.T) {
+	fs := &ntfsFS{clusterSize: testNTFSClusterSize}
+	_, err := fs.value(&ntfsAttribute{flags: ntfsAttrCompressed})
+	assert.EqualError(t, err, "compressed and encrypted ntfs files are not supported")
+}
+
+func TestDecodeRuns(t *testing.T) {
+	runs := []ntfsRun{
+		{vcn: 0, lcn: 1000, length: 10},
+		{vcn: 10, lcn: -1, length: 300},
+		{vcn: 310, lcn: 20, length: 1},
+		{vcn: 311, lcn: 70000, length: 70000},
+	}
+	actual, err := decodeRuns(encodeRuns(runs), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, runs, actual)
+
+	_, err = decodeRuns([]byte{0x21, 1}, 0)
+	assert.EqualError(t, err, "invalid ntfs run list")
+}
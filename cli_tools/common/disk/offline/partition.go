@@ -0,0 +1,225 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	sectorSize = 512
+
+	mbrProtectiveType = 0xee
+	mbrEFIType        = 0xef
+
+	// Limits the number of logical partitions, and of GPT entries, that are read.
+	maxLogicalPartitions = 128
+	maxGPTEntries        = 1024
+
+	espGUID      = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+	biosBootGUID = "21686148-6449-6E6F-744E-656564454649"
+)
+
+// partition is a range of the disk. A disk without a partition table is a
+// single partition.
+type partition struct {
+	offset, size int64
+	// mbrType is the type of MBR partitions.
+	mbrType byte
+	// gptType is the type GUID of GPT partitions.
+	gptType string
+}
+
+// partitionTable describes the partitions of a disk.
+type partitionTable struct {
+	partitions []partition
+	// hybridMBR is true when a disk has a GPT, and its MBR has partitions
+	// besides the protective one.
+	hybridMBR bool
+}
+
+// biosBootable returns whether the disk can be booted with BIOS, using the
+// same criteria as the boot-inspect worker: a disk with a GPT needs either
+// a BIOS boot partition, or a hybrid MBR.
+func (table partitionTable) biosBootable() bool {
+	if table.hybridMBR {
+		return true
+	}
+	for _, p := range table.partitions {
+		if p.gptType == biosBootGUID {
+			return true
+		}
+	}
+	return false
+}
+
+// uefiBootable returns whether the disk has an EFI system partition.
+func (table partitionTable) uefiBootable() bool {
+	for _, p := range table.partitions {
+		if p.gptType == espGUID || p.mbrType == mbrEFIType {
+			return true
+		}
+	}
+	return false
+}
+
+// readPartitionTable reads the MBR and, when the MBR is protective or
+// hybrid, the GPT of a disk.
+func readPartitionTable(r io.ReaderAt, size int64) (partitionTable, error) {
+	mbr := make([]byte, sectorSize)
+	if _, err := r.ReadAt(mbr, 0); err != nil && err != io.EOF {
+		return partitionTable{}, fmt.Errorf("failed to read MBR: %w", err)
+	}
+	entries, ok := mbrEntries(mbr)
+	if !ok {
+		return partitionTable{partitions: []partition{{offset: 0, size: size}}}, nil
+	}
+
+	var table partitionTable
+	var protective bool
+	for _, e := range entries {
+		switch e.mbrType {
+		case mbrProtectiveType:
+			protective = true
+		case 0x05, 0x0f, 0x85:
+			logical, err := readLogicalPartitions(r, e.offset)
+			if err != nil {
+				return partitionTable{}, err
+			}
+			table.partitions = append(table.partitions, logical...)
+		default:
+			table.partitions = append(table.partitions, e)
+		}
+	}
+	if !protective {
+		return table, nil
+	}
+
+	gpt, err := readGPT(r)
+	if err != nil {
+		return partitionTable{}, err
+	}
+	table.hybridMBR = len(table.partitions) > 0
+	table.partitions = gpt
+	return table, nil
+}
+
+// mbrEntries returns the non-empty entries of an MBR. It returns false
+// when the sector isn't an MBR, as is the case for disks without a partition
+// table, whose first sector is the boot sector of a filesystem.
+func mbrEntries(mbr []byte) ([]partition, bool) {
+	if mbr[510] != 0x55 || mbr[511] != 0xaa {
+		return nil, false
+	}
+	// NTFS and FAT boot sectors have the same signature.
+	if bytes.Equal(mbr[3:11], []byte("NTFS    ")) || bytes.HasPrefix(mbr[0x36:], []byte("FAT")) ||
+		bytes.HasPrefix(mbr[0x52:], []byte("FAT32")) {
+		return nil, false
+	}
+	var entries []partition
+	for i := 0; i < 4; i++ {
+		e := mbr[446+16*i : 446+16*(i+1)]
+		if e[0] != 0 && e[0] != 0x80 {
+			return nil, false
+		}
+		if e[4] == 0 {
+			continue
+		}
+		entries = append(entries, partition{
+			offset:  int64(binary.LittleEndian.Uint32(e[8:])) * sectorSize,
+			size:    int64(binary.LittleEndian.Uint32(e[12:])) * sectorSize,
+			mbrType: e[4],
+		})
+	}
+	return entries, true
+}
+
+// readLogicalPartitions follows the chain of extended boot records of the
+// extended partition at offset.
+func readLogicalPartitions(r io.ReaderAt, offset int64) ([]partition, error) {
+	var logical []partition
+	ebr := make([]byte, sectorSize)
+	for next := offset; len(logical) < maxLogicalPartitions; {
+		if _, err := r.ReadAt(ebr, next); err != nil {
+			return nil, fmt.Errorf("failed to read extended boot record: %w", err)
+		}
+		if ebr[510] != 0x55 || ebr[511] != 0xaa {
+			break
+		}
+		// The first entry is relative to the EBR, the second to the
+		// extended partition.
+		if e := ebr[446:462]; e[4] != 0 {
+			logical = append(logical, partition{
+				offset:  next + int64(binary.LittleEndian.Uint32(e[8:]))*sectorSize,
+				size:    int64(binary.LittleEndian.Uint32(e[12:])) * sectorSize,
+				mbrType: e[4],
+			})
+		}
+		e := ebr[462:478]
+		if e[4] == 0 {
+			break
+		}
+		next = offset + int64(binary.LittleEndian.Uint32(e[8:]))*sectorSize
+	}
+	return logical, nil
+}
+
+func readGPT(r io.ReaderAt) ([]partition, error) {
+	header := make([]byte, sectorSize)
+	if _, err := r.ReadAt(header, sectorSize); err != nil {
+		return nil, fmt.Errorf("failed to read GPT header: %w", err)
+	}
+	if !bytes.HasPrefix(header, []byte("EFI PART")) {
+		return nil, fmt.Errorf("GPT header not found")
+	}
+	entriesOffset := int64(binary.LittleEndian.Uint64(header[72:])) * sectorSize
+	count := binary.LittleEndian.Uint32(header[80:])
+	entrySize := binary.LittleEndian.Uint32(header[84:])
+	if count > maxGPTEntries || entrySize < 128 || entrySize > 4096 {
+		return nil, fmt.Errorf("invalid GPT: %d entries of %d bytes", count, entrySize)
+	}
+	entries := make([]byte, count*entrySize)
+	if _, err := r.ReadAt(entries, entriesOffset); err != nil {
+		return nil, fmt.Errorf("failed to read GPT entries: %w", err)
+	}
+
+	var partitions []partition
+	for i := uint32(0); i < count; i++ {
+		e := entries[i*entrySize:]
+		typeGUID := formatGUID(e[:16])
+		if typeGUID == "00000000-0000-0000-0000-000000000000" {
+			continue
+		}
+		first, last := int64(binary.LittleEndian.Uint64(e[32:])), int64(binary.LittleEndian.Uint64(e[40:]))
+		if first <= 0 || last < first {
+			return nil, fmt.Errorf("invalid GPT entry %d: LBAs %d to %d", i, first, last)
+		}
+		partitions = append(partitions, partition{
+			offset:  first * sectorSize,
+			size:    (last - first + 1) * sectorSize,
+			gptType: typeGUID,
+		})
+	}
+	return partitions, nil
+}
+
+// formatGUID formats a GUID in its mixed-endian encoding.
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X", binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint16(b[4:]),
+		binary.LittleEndian.Uint16(b[6:]), b[8:10], b[10:16])
+}
@@ -0,0 +1,198 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const linuxDataGUID = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
+
+type mbrEntry struct {
+	typ            byte
+	start, sectors uint32
+}
+
+// writeMBR writes a partition table to the first sector of disk, or to an
+// extended boot record.
+func writeMBR(sector []byte, entries ...mbrEntry) {
+	for i, e := range entries {
+		b := sector[446+16*i:]
+		b[4] = e.typ
+		binary.LittleEndian.PutUint32(b[8:], e.start)
+		binary.LittleEndian.PutUint32(b[12:], e.sectors)
+	}
+	sector[510], sector[511] = 0x55, 0xaa
+}
+
+type gptEntry struct {
+	typ         string
+	first, last uint64
+}
+
+// writeGPT writes a GPT header at LBA 1, and its entries at LBA 2.
+func writeGPT(disk []byte, entries ...gptEntry) {
+	header := disk[sectorSize:]
+	copy(header, "EFI PART")
+	binary.LittleEndian.PutUint64(header[72:], 2)
+	binary.LittleEndian.PutUint32(header[80:], 128)
+	binary.LittleEndian.PutUint32(header[84:], 128)
+	for i, e := range entries {
+		b := disk[2*sectorSize+128*i:]
+		copy(b, parseGUID(e.typ))
+		binary.LittleEndian.PutUint64(b[32:], e.first)
+		binary.LittleEndian.PutUint64(b[40:], e.last)
+	}
+}
+
+// parseGUID encodes a GUID, which is the inverse of formatGUID.
+func parseGUID(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil {
+		panic(err)
+	}
+	b[0], b[1], b[2], b[3] = b[3], b[2], b[1], b[0]
+	b[4], b[5] = b[5], b[4]
+	b[6], b[7] = b[7], b[6]
+	return b
+}
+
+func TestFormatGUID(t *testing.T) {
+	assert.Equal(t, espGUID, formatGUID(parseGUID(espGUID)))
+}
+
+func TestReadPartitionTable(t *testing.T) {
+	const diskSize = 64 * sectorSize
+	for _, tt := range []struct {
+		name          string
+		setup         func(disk []byte)
+		expected      []partition
+		expectedBIOS  bool
+		expectedUEFI  bool
+		expectedError string
+	}{
+		{
+			name:     "no partition table",
+			setup:    func(disk []byte) {},
+			expected: []partition{{offset: 0, size: diskSize}},
+		},
+		{
+			name: "filesystem boot sector",
+			setup: func(disk []byte) {
+				copy(disk[3:], "NTFS    ")
+				disk[446] = 0x12
+				disk[510], disk[511] = 0x55, 0xaa
+			},
+			expected: []partition{{offset: 0, size: diskSize}},
+		},
+		{
+			name: "mbr",
+			setup: func(disk []byte) {
+				writeMBR(disk, mbrEntry{0x83, 2, 10}, mbrEntry{0xef, 12, 4})
+			},
+			expected: []partition{
+				{offset: 2 * sectorSize, size: 10 * sectorSize, mbrType: 0x83},
+				{offset: 12 * sectorSize, size: 4 * sectorSize, mbrType: 0xef},
+			},
+			expectedUEFI: true,
+		},
+		{
+			name: "logical partitions",
+			setup: func(disk []byte) {
+				writeMBR(disk, mbrEntry{0x83, 2, 10}, mbrEntry{0x0f, 20, 40})
+				// The first EBR describes the logical partition at 22, and
+				// points to the next EBR at 40.
+				writeMBR(disk[20*sectorSize:], mbrEntry{0x83, 2, 8}, mbrEntry{0x05, 20, 20})
+				writeMBR(disk[40*sectorSize:], mbrEntry{0x8e, 1, 19})
+			},
+			expected: []partition{
+				{offset: 2 * sectorSize, size: 10 * sectorSize, mbrType: 0x83},
+				{offset: 22 * sectorSize, size: 8 * sectorSize, mbrType: 0x83},
+				{offset: 41 * sectorSize, size: 19 * sectorSize, mbrType: 0x8e},
+			},
+		},
+		{
+			name: "gpt",
+			setup: func(disk []byte) {
+				writeMBR(disk, mbrEntry{0xee, 1, diskSize/sectorSize - 1})
+				writeGPT(disk, gptEntry{espGUID, 34, 39}, gptEntry{linuxDataGUID, 40, 63})
+			},
+			expected: []partition{
+				{offset: 34 * sectorSize, size: 6 * sectorSize, gptType: espGUID},
+				{offset: 40 * sectorSize, size: 24 * sectorSize, gptType: linuxDataGUID},
+			},
+			expectedUEFI: true,
+		},
+		{
+			name: "gpt with bios boot partition",
+			setup: func(disk []byte) {
+				writeMBR(disk, mbrEntry{0xee, 1, diskSize/sectorSize - 1})
+				writeGPT(disk, gptEntry{biosBootGUID, 34, 35}, gptEntry{linuxDataGUID, 40, 63})
+			},
+			expected: []partition{
+				{offset: 34 * sectorSize, size: 2 * sectorSize, gptType: biosBootGUID},
+				{offset: 40 * sectorSize, size: 24 * sectorSize, gptType: linuxDataGUID},
+			},
+			expectedBIOS: true,
+		},
+		{
+			name: "hybrid mbr",
+			setup: func(disk []byte) {
+				writeMBR(disk, mbrEntry{0xee, 1, 39}, mbrEntry{0x83, 40, 24})
+				writeGPT(disk, gptEntry{linuxDataGUID, 40, 63})
+			},
+			expected: []partition{
+				{offset: 40 * sectorSize, size: 24 * sectorSize, gptType: linuxDataGUID},
+			},
+			expectedBIOS: true,
+		},
+		{
+			name: "protective mbr without gpt",
+			setup: func(disk []byte) {
+				writeMBR(disk, mbrEntry{0xee, 1, diskSize/sectorSize - 1})
+			},
+			expectedError: "GPT header not found",
+		},
+		{
+			name: "invalid gpt entry",
+			setup: func(disk []byte) {
+				writeMBR(disk, mbrEntry{0xee, 1, diskSize/sectorSize - 1})
+				writeGPT(disk, gptEntry{linuxDataGUID, 40, 39})
+			},
+			expectedError: "invalid GPT entry 0: LBAs 40 to 39",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			disk := make([]byte, diskSize)
+			tt.setup(disk)
+			table, err := readPartitionTable(bytes.NewReader(disk), diskSize)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, table.partitions)
+			assert.Equal(t, tt.expectedBIOS, table.biosBootable())
+			assert.Equal(t, tt.expectedUEFI, table.uefiBootable())
+		})
+	}
+}
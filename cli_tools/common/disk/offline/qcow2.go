@@ -0,0 +1,214 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	qcow2HeaderSize = 104
+	// Host offsets of L1 and L2 entries are stored in bits 9-55.
+	qcow2OffsetMask     = 0x00fffffffffffe00
+	qcow2CompressedFlag = 1 << 62
+	qcow2ZeroFlag       = 1
+	// The dirty bit is the only incompatible feature that doesn't
+	// change how clusters are read.
+	qcow2DirtyFeature = 1
+	// Bounds the memory used by the L1 table, which covers 16 PiB with
+	// 64 KiB clusters.
+	maxQCOW2L1Entries = 32 * 1024 * 1024
+)
+
+// qcow2Image reads the virtual disk of a qcow2 file. Backing files, encryption,
+// and extended L2 entries aren't supported.
+type qcow2Image struct {
+	file        fileReaderAt
+	size        int64
+	clusterBits uint
+	l1          []uint64
+
+	mx       sync.Mutex
+	l2Tables map[uint64][]uint64
+}
+
+// fileReaderAt is the part of *os.File used to read image files.
+type fileReaderAt interface {
+	io.ReaderAt
+	io.Closer
+}
+
+func newQCOW2Image(file fileReaderAt) (*qcow2Image, error) {
+	header := make([]byte, qcow2HeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read qcow2 header: %w", err)
+	}
+	version := binary.BigEndian.Uint32(header[4:])
+	if version != 2 && version != 3 {
+		return nil, fmt.Errorf("qcow2 version %d is not supported", version)
+	}
+	if binary.BigEndian.Uint64(header[8:]) != 0 {
+		return nil, errors.New("qcow2 files with a backing file are not supported")
+	}
+	clusterBits := uint(binary.BigEndian.Uint32(header[20:]))
+	if clusterBits < 9 || clusterBits > 21 {
+		return nil, fmt.Errorf("invalid qcow2 cluster size: 2^%d", clusterBits)
+	}
+	if binary.BigEndian.Uint32(header[32:]) != 0 {
+		return nil, errors.New("encrypted qcow2 files are not supported")
+	}
+	if version == 3 {
+		if features := binary.BigEndian.Uint64(header[72:]); features&^qcow2DirtyFeature != 0 {
+			return nil, fmt.Errorf("qcow2 incompatible features %#x are not supported", features)
+		}
+	}
+
+	l1Entries := binary.BigEndian.Uint32(header[36:])
+	if l1Entries > maxQCOW2L1Entries {
+		return nil, fmt.Errorf("invalid qcow2 L1 table size: %d", l1Entries)
+	}
+	l1, err := readTable(file, int64(binary.BigEndian.Uint64(header[40:])), int(l1Entries))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read qcow2 L1 table: %w", err)
+	}
+	return &qcow2Image{
+		file:        file,
+		size:        int64(binary.BigEndian.Uint64(header[24:])),
+		clusterBits: clusterBits,
+		l1:          l1,
+		l2Tables:    map[uint64][]uint64{},
+	}, nil
+}
+
+func (image *qcow2Image) Size() int64 {
+	return image.size
+}
+
+func (image *qcow2Image) Close() error {
+	return image.file.Close()
+}
+
+func (image *qcow2Image) ReadAt(p []byte, off int64) (int, error) {
+	clusterSize := int64(1) << image.clusterBits
+	read := 0
+	for read < len(p) {
+		if off >= image.size {
+			return read, io.EOF
+		}
+		inCluster := off & (clusterSize - 1)
+		n := int64(len(p) - read)
+		if n > clusterSize-inCluster {
+			n = clusterSize - inCluster
+		}
+		if n > image.size-off {
+			n = image.size - off
+		}
+		dst := p[read : read+int(n)]
+		if err := image.readCluster(dst, off>>image.clusterBits, inCluster); err != nil {
+			return read, err
+		}
+		read += int(n)
+		off += n
+	}
+	return read, nil
+}
+
+// readCluster fills dst with the content of cluster index, from offset.
+func (image *qcow2Image) readCluster(dst []byte, index int64, offset int64) error {
+	l2Entries := int64(1) << (image.clusterBits - 3)
+	l1Index := index / l2Entries
+	if l1Index >= int64(len(image.l1)) || image.l1[l1Index]&qcow2OffsetMask == 0 {
+		zero(dst)
+		return nil
+	}
+	l2, err := image.l2Table(image.l1[l1Index] & qcow2OffsetMask)
+	if err != nil {
+		return err
+	}
+	entry := l2[index%l2Entries]
+	switch {
+	case entry&qcow2CompressedFlag != 0:
+		cluster, err := image.decompress(entry)
+		if err != nil {
+			return err
+		}
+		copy(dst, cluster[offset:])
+	case entry&qcow2ZeroFlag != 0, entry&qcow2OffsetMask == 0:
+		zero(dst)
+	default:
+		if _, err := image.file.ReadAt(dst, int64(entry&qcow2OffsetMask)+offset); err != nil {
+			return fmt.Errorf("failed to read qcow2 cluster %d: %w", index, err)
+		}
+	}
+	return nil
+}
+
+func (image *qcow2Image) l2Table(offset uint64) ([]uint64, error) {
+	image.mx.Lock()
+	defer image.mx.Unlock()
+	if table, ok := image.l2Tables[offset]; ok {
+		return table, nil
+	}
+	table, err := readTable(image.file, int64(offset), 1<<(image.clusterBits-3))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read qcow2 L2 table: %w", err)
+	}
+	image.l2Tables[offset] = table
+	return table, nil
+}
+
+// decompress reads a compressed cluster, which is a raw deflate stream.
+func (image *qcow2Image) decompress(entry uint64) ([]byte, error) {
+	// The number of bits used for the offset depends on the cluster size,
+	// the remaining bits store the number of additional 512-byte sectors.
+	offsetBits := 62 - (image.clusterBits - 8)
+	offset := int64(entry & (1<<offsetBits - 1))
+	sectors := int64((entry>>offsetBits)&(1<<(image.clusterBits-8)-1)) + 1
+	compressed := make([]byte, sectors*512-offset%512)
+	n, err := image.file.ReadAt(compressed, offset)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read compressed qcow2 cluster: %w", err)
+	}
+	cluster := make([]byte, 1<<image.clusterBits)
+	if _, err := io.ReadFull(flate.NewReader(bytes.NewReader(compressed[:n])), cluster); err != nil {
+		return nil, fmt.Errorf("failed to decompress qcow2 cluster: %w", err)
+	}
+	return cluster, nil
+}
+
+// readTable reads a table of big-endian uint64s.
+func readTable(r io.ReaderAt, offset int64, entries int) ([]uint64, error) {
+	b := make([]byte, entries*8)
+	if _, err := r.ReadAt(b, offset); err != nil {
+		return nil, err
+	}
+	table := make([]uint64, entries)
+	for i := range table {
+		table[i] = binary.BigEndian.Uint64(b[i*8:])
+	}
+	return table, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,179 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeQCOW2 converts a raw disk to qcow2. Clusters of zeros are either
+// unallocated, or use the zero flag with version 3. Other clusters are
+// alternately compressed, when that makes them smaller, and stored as-is.
+func encodeQCOW2(disk []byte, version uint32, clusterBits uint) []byte {
+	clusterSize := 1 << clusterBits
+	l2Entries := clusterSize / 8
+	clusters := (len(disk) + clusterSize - 1) / clusterSize
+	l1Entries := (clusters + l2Entries - 1) / l2Entries
+	l1Clusters := (l1Entries*8 + clusterSize - 1) / clusterSize
+
+	// The header, L1 table, and L2 tables are followed by the data.
+	metadataSize := (1 + l1Clusters + l1Entries) * clusterSize
+	file := make([]byte, metadataSize)
+	copy(file, "QFI\xfb")
+	binary.BigEndian.PutUint32(file[4:], version)
+	binary.BigEndian.PutUint32(file[20:], uint32(clusterBits))
+	binary.BigEndian.PutUint64(file[24:], uint64(len(disk)))
+	binary.BigEndian.PutUint32(file[36:], uint32(l1Entries))
+	binary.BigEndian.PutUint64(file[40:], uint64(clusterSize))
+	if version == 3 {
+		binary.BigEndian.PutUint32(file[96:], 4)
+		binary.BigEndian.PutUint32(file[100:], qcow2HeaderSize)
+	}
+	for i := 0; i < l1Entries; i++ {
+		l2Offset := uint64((1 + l1Clusters + i) * clusterSize)
+		binary.BigEndian.PutUint64(file[clusterSize+8*i:], l2Offset|1<<63)
+	}
+
+	for i := 0; i < clusters; i++ {
+		cluster := make([]byte, clusterSize)
+		copy(cluster, disk[i*clusterSize:])
+		var compressed bytes.Buffer
+		w, _ := flate.NewWriter(&compressed, flate.BestCompression)
+		w.Write(cluster)
+		w.Close()
+
+		var entry uint64
+		switch {
+		case bytes.Equal(cluster, make([]byte, clusterSize)):
+			if version == 3 && i%2 == 0 {
+				entry = qcow2ZeroFlag
+			}
+		case i%2 == 0 && compressed.Len() < clusterSize:
+			offset := uint64(len(file))
+			additionalSectors := (offset+uint64(compressed.Len())-1)/512 - offset/512
+			offsetBits := 62 - (clusterBits - 8)
+			entry = qcow2CompressedFlag | additionalSectors<<offsetBits | offset
+			file = append(file, compressed.Bytes()...)
+		default:
+			// Uncompressed clusters are aligned.
+			file = append(file, make([]byte, (clusterSize-len(file)%clusterSize)%clusterSize)...)
+			entry = uint64(len(file)) | 1<<63
+			file = append(file, cluster...)
+		}
+		l2 := (1 + l1Clusters + i/l2Entries) * clusterSize
+		binary.BigEndian.PutUint64(file[l2+8*(i%l2Entries):], entry)
+	}
+	return file
+}
+
+type nopCloser struct {
+	io.ReaderAt
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// testDisk returns a disk whose clusters are random, compressible, or zeros.
+func testDisk(size, clusterSize int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	disk := make([]byte, size)
+	for offset := 0; offset < size; offset += clusterSize {
+		cluster := disk[offset:minInt(offset+clusterSize, size)]
+		switch (offset / clusterSize) % 5 {
+		case 0, 3:
+			rnd.Read(cluster)
+		case 1, 2:
+			copy(cluster, bytes.Repeat([]byte(fmt.Sprintf("cluster %d ", offset/clusterSize)), clusterSize))
+		}
+	}
+	return disk
+}
+
+func TestQCOW2Image_ReadAt(t *testing.T) {
+	for _, tt := range []struct {
+		version     uint32
+		clusterBits uint
+		size        int
+	}{
+		{2, 9, 200*512 + 100},
+		{3, 12, 1024 * 1024},
+		{3, 16, 3*64*1024 + 1},
+	} {
+		t.Run(fmt.Sprintf("v%d-%d", tt.version, tt.clusterBits), func(t *testing.T) {
+			disk := testDisk(tt.size, 1<<tt.clusterBits)
+			image, err := newQCOW2Image(nopCloser{bytes.NewReader(encodeQCOW2(disk, tt.version, tt.clusterBits))})
+			require.NoError(t, err)
+			assert.Equal(t, int64(tt.size), image.Size())
+
+			actual, err := ioutil.ReadAll(io.NewSectionReader(image, 0, image.Size()))
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(disk, actual), "content differs")
+
+			// Reads that span clusters, and the end of the disk.
+			b := make([]byte, 1000)
+			n, err := image.ReadAt(b, int64(1<<tt.clusterBits)-500)
+			assert.NoError(t, err)
+			assert.Equal(t, disk[(1<<tt.clusterBits)-500:(1<<tt.clusterBits)+500], b[:n])
+			n, err = image.ReadAt(b, int64(tt.size-10))
+			assert.Equal(t, io.EOF, err)
+			assert.Equal(t, disk[tt.size-10:], b[:n])
+		})
+	}
+}
+
+func TestNewQCOW2Image_RejectsUnsupportedFiles(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		offset   int
+		value    uint64
+		size     int
+		expected string
+	}{
+		{"version", 4, 1, 4, "qcow2 version 1 is not supported"},
+		{"backing file", 8, 1024, 8, "qcow2 files with a backing file are not supported"},
+		{"cluster size", 20, 30, 4, "invalid qcow2 cluster size: 2^30"},
+		{"encryption", 32, 1, 4, "encrypted qcow2 files are not supported"},
+		{"incompatible features", 72, 3, 8, "qcow2 incompatible features 0x3 are not supported"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			file := encodeQCOW2(make([]byte, 4096), 3, 9)
+			if tt.size == 4 {
+				binary.BigEndian.PutUint32(file[tt.offset:], uint32(tt.value))
+			} else {
+				binary.BigEndian.PutUint64(file[tt.offset:], tt.value)
+			}
+			_, err := newQCOW2Image(nopCloser{bytes.NewReader(file)})
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
+
+func TestNewQCOW2Image_AllowsDirtyImages(t *testing.T) {
+	file := encodeQCOW2(make([]byte, 4096), 3, 9)
+	binary.BigEndian.PutUint64(file[72:], qcow2DirtyFeature)
+	_, err := newQCOW2Image(nopCloser{bytes.NewReader(file)})
+	assert.NoError(t, err)
+}
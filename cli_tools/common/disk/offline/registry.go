@@ -0,0 +1,259 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Cell offsets are relative to the first hive bin, which follows the
+	// base block.
+	regBaseBlockSize = 4096
+
+	regKeyCompressedName   = 0x20
+	regValueCompressedName = 0x1
+	regValueInline         = 0x80000000
+
+	regSZ         = 1
+	regExpandSZ   = 2
+	regDWORD      = 4
+	maxRegSubkeys = 64 * 1024
+)
+
+// registryHive reads keys and values of a Windows registry hive file.
+type registryHive struct {
+	data []byte
+}
+
+// registryKey is the nk cell of a key.
+type registryKey struct {
+	hive *registryHive
+	cell []byte
+}
+
+func openRegistryHive(data []byte) (*registryHive, error) {
+	if len(data) < regBaseBlockSize || string(data[:4]) != "regf" {
+		return nil, errors.New("invalid registry hive")
+	}
+	return &registryHive{data: data}, nil
+}
+
+// cell returns the data of the cell at offset.
+func (h *registryHive) cell(offset uint32) ([]byte, error) {
+	pos := int64(regBaseBlockSize) + int64(offset)
+	if pos+4 > int64(len(h.data)) {
+		return nil, fmt.Errorf("registry cell %d is out of bounds", offset)
+	}
+	// Allocated cells have a negative size.
+	size := int64(int32(binary.LittleEndian.Uint32(h.data[pos:])))
+	if size < 0 {
+		size = -size
+	}
+	if size < 4 || pos+size > int64(len(h.data)) {
+		return nil, fmt.Errorf("invalid registry cell %d", offset)
+	}
+	return h.data[pos+4 : pos+size], nil
+}
+
+func (h *registryHive) key(offset uint32) (*registryKey, error) {
+	cell, err := h.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(cell) < 76 || string(cell[:2]) != "nk" {
+		return nil, fmt.Errorf("invalid registry key %d", offset)
+	}
+	return &registryKey{hive: h, cell: cell}, nil
+}
+
+func (h *registryHive) root() (*registryKey, error) {
+	return h.key(binary.LittleEndian.Uint32(h.data[36:]))
+}
+
+func (k *registryKey) name() string {
+	length := int(binary.LittleEndian.Uint16(k.cell[72:]))
+	if 76+length > len(k.cell) {
+		return ""
+	}
+	return decodeRegistryName(k.cell[76:76+length], binary.LittleEndian.Uint16(k.cell[2:])&regKeyCompressedName != 0)
+}
+
+// subkey returns the key at a backslash-separated path below k. Names are
+// compared case-insensitively.
+func (k *registryKey) subkey(path string) (*registryKey, error) {
+	key := k
+	for _, name := range strings.Split(path, `\`) {
+		if name == "" {
+			continue
+		}
+		offsets, err := key.hive.subkeyOffsets(binary.LittleEndian.Uint32(key.cell[28:]), 0)
+		if err != nil {
+			return nil, err
+		}
+		var found *registryKey
+		for _, offset := range offsets {
+			child, err := key.hive.key(offset)
+			if err != nil {
+				return nil, err
+			}
+			if strings.EqualFold(child.name(), name) {
+				found = child
+				break
+			}
+		}
+		if found == nil {
+			return nil, errNotExist
+		}
+		key = found
+	}
+	return key, nil
+}
+
+// subkeyOffsets returns the offsets of the keys in a subkey list. Index
+// roots (ri) reference other lists, while the others reference keys, with
+// or without a hash of their names.
+func (h *registryHive) subkeyOffsets(offset uint32, depth int) ([]uint32, error) {
+	if offset == 0xffffffff {
+		return nil, nil
+	}
+	cell, err := h.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(cell) < 4 || depth > 1 {
+		return nil, fmt.Errorf("invalid registry subkey list %d", offset)
+	}
+	count := int(binary.LittleEndian.Uint16(cell[2:]))
+	elementSize := 4
+	switch string(cell[:2]) {
+	case "lf", "lh":
+		elementSize = 8
+	case "li", "ri":
+	default:
+		return nil, fmt.Errorf("invalid registry subkey list %d", offset)
+	}
+	if count > maxRegSubkeys || 4+count*elementSize > len(cell) {
+		return nil, fmt.Errorf("invalid registry subkey list %d", offset)
+	}
+	var offsets []uint32
+	for i := 0; i < count; i++ {
+		element := binary.LittleEndian.Uint32(cell[4+i*elementSize:])
+		if string(cell[:2]) != "ri" {
+			offsets = append(offsets, element)
+			continue
+		}
+		child, err := h.subkeyOffsets(element, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, child...)
+	}
+	return offsets, nil
+}
+
+// value returns the type and data of the value with name.
+func (k *registryKey) value(name string) (uint32, []byte, error) {
+	count := int(binary.LittleEndian.Uint32(k.cell[36:]))
+	if count == 0 {
+		return 0, nil, errNotExist
+	}
+	list, err := k.hive.cell(binary.LittleEndian.Uint32(k.cell[40:]))
+	if err != nil {
+		return 0, nil, err
+	}
+	if count*4 > len(list) {
+		return 0, nil, errors.New("invalid registry value list")
+	}
+	for i := 0; i < count; i++ {
+		vk, err := k.hive.cell(binary.LittleEndian.Uint32(list[4*i:]))
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(vk) < 20 || string(vk[:2]) != "vk" {
+			return 0, nil, errors.New("invalid registry value")
+		}
+		nameLength := int(binary.LittleEndian.Uint16(vk[2:]))
+		if 20+nameLength > len(vk) {
+			return 0, nil, errors.New("invalid registry value")
+		}
+		compressed := binary.LittleEndian.Uint16(vk[16:])&regValueCompressedName != 0
+		if !strings.EqualFold(decodeRegistryName(vk[20:20+nameLength], compressed), name) {
+			continue
+		}
+
+		typ := binary.LittleEndian.Uint32(vk[12:])
+		size := binary.LittleEndian.Uint32(vk[4:])
+		// Values of up to four bytes are stored in the offset field.
+		if size&regValueInline != 0 {
+			size &^= regValueInline
+			if size > 4 {
+				return 0, nil, errors.New("invalid registry value")
+			}
+			return typ, vk[8 : 8+size], nil
+		}
+		data, err := k.hive.cell(binary.LittleEndian.Uint32(vk[8:]))
+		if err != nil {
+			return 0, nil, err
+		}
+		// Larger values are split into blocks, which aren't needed to read
+		// versions.
+		if int(size) > len(data) {
+			return 0, nil, fmt.Errorf("registry value %q is too large", name)
+		}
+		return typ, data[:size], nil
+	}
+	return 0, nil, errNotExist
+}
+
+// stringValue returns a REG_SZ or REG_EXPAND_SZ value.
+func (k *registryKey) stringValue(name string) (string, error) {
+	typ, data, err := k.value(name)
+	if err != nil {
+		return "", err
+	}
+	if typ != regSZ && typ != regExpandSZ {
+		return "", fmt.Errorf("registry value %q is not a string", name)
+	}
+	return strings.TrimRight(decodeUTF16(data), "\x00"), nil
+}
+
+// dwordValue returns a REG_DWORD value.
+func (k *registryKey) dwordValue(name string) (uint32, error) {
+	typ, data, err := k.value(name)
+	if err != nil {
+		return 0, err
+	}
+	if typ != regDWORD || len(data) != 4 {
+		return 0, fmt.Errorf("registry value %q is not a DWORD", name)
+	}
+	return binary.LittleEndian.Uint32(data), nil
+}
+
+// decodeRegistryName decodes the name of a key or value, which is either
+// Latin-1 or UTF-16.
+func decodeRegistryName(b []byte, compressed bool) string {
+	if !compressed {
+		return decodeUTF16(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
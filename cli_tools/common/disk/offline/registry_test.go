@@ -0,0 +1,217 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testKey struct {
+	name    string
+	values  []testValue
+	subkeys []testKey
+	// indexRoot splits the subkeys into two lists, referenced by an ri list.
+	indexRoot bool
+}
+
+type testValue struct {
+	name string
+	typ  uint32
+	data []byte
+}
+
+// buildHive creates a hive file with a single hive bin.
+func buildHive(root testKey) []byte {
+	b := &hiveBuilder{cells: append([]byte("hbin"), make([]byte, 28)...)}
+	rootOffset := b.key(root)
+	hive := make([]byte, regBaseBlockSize)
+	copy(hive, "regf")
+	binary.LittleEndian.PutUint32(hive[36:], rootOffset)
+	return append(hive, b.cells...)
+}
+
+type hiveBuilder struct {
+	cells []byte
+}
+
+func (b *hiveBuilder) cell(data []byte) uint32 {
+	offset := uint32(len(b.cells))
+	size := (4 + len(data) + 7) &^ 7
+	cell := make([]byte, size)
+	binary.LittleEndian.PutUint32(cell, uint32(-int32(size)))
+	copy(cell[4:], data)
+	b.cells = append(b.cells, cell...)
+	return offset
+}
+
+func (b *hiveBuilder) list(signature string, elementSize int, offsets []uint32) uint32 {
+	list := make([]byte, 4+elementSize*len(offsets))
+	copy(list, signature)
+	binary.LittleEndian.PutUint16(list[2:], uint16(len(offsets)))
+	for i, offset := range offsets {
+		binary.LittleEndian.PutUint32(list[4+i*elementSize:], offset)
+	}
+	return b.cell(list)
+}
+
+func (b *hiveBuilder) key(k testKey) uint32 {
+	var subkeys []uint32
+	for _, subkey := range k.subkeys {
+		subkeys = append(subkeys, b.key(subkey))
+	}
+	subkeyList := uint32(0xffffffff)
+	switch {
+	case len(subkeys) == 0:
+	case k.indexRoot:
+		half := len(subkeys) / 2
+		subkeyList = b.list("ri", 4, []uint32{
+			b.list("li", 4, subkeys[:half]),
+			b.list("lf", 8, subkeys[half:]),
+		})
+	default:
+		subkeyList = b.list("lh", 8, subkeys)
+	}
+
+	var values []uint32
+	for _, v := range k.values {
+		// Value names are stored as UTF-16, and key names as Latin-1.
+		name := encodeUTF16(v.name)
+		vk := make([]byte, 20+len(name))
+		copy(vk, "vk")
+		binary.LittleEndian.PutUint16(vk[2:], uint16(len(name)))
+		if len(v.data) <= 4 {
+			binary.LittleEndian.PutUint32(vk[4:], uint32(len(v.data))|regValueInline)
+			copy(vk[8:12], v.data)
+		} else {
+			binary.LittleEndian.PutUint32(vk[4:], uint32(len(v.data)))
+			binary.LittleEndian.PutUint32(vk[8:], b.cell(v.data))
+		}
+		binary.LittleEndian.PutUint32(vk[12:], v.typ)
+		copy(vk[20:], name)
+		values = append(values, b.cell(vk))
+	}
+	valueList := make([]byte, 4*len(values))
+	for i, offset := range values {
+		binary.LittleEndian.PutUint32(valueList[4*i:], offset)
+	}
+
+	nk := make([]byte, 76+len(k.name))
+	copy(nk, "nk")
+	binary.LittleEndian.PutUint16(nk[2:], regKeyCompressedName)
+	binary.LittleEndian.PutUint32(nk[20:], uint32(len(subkeys)))
+	binary.LittleEndian.PutUint32(nk[28:], subkeyList)
+	binary.LittleEndian.PutUint32(nk[36:], uint32(len(values)))
+	binary.LittleEndian.PutUint32(nk[40:], b.cell(valueList))
+	binary.LittleEndian.PutUint16(nk[72:], uint16(len(k.name)))
+	copy(nk[76:], k.name)
+	return b.cell(nk)
+}
+
+func encodeUTF16(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+func stringValue(s string) testValue {
+	return testValue{typ: regSZ, data: encodeUTF16(s + "\x00")}
+}
+
+func dwordValue(v uint32) testValue {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return testValue{typ: regDWORD, data: b}
+}
+
+func named(name string, v testValue) testValue {
+	v.name = name
+	return v
+}
+
+func TestRegistryHive(t *testing.T) {
+	hive, err := openRegistryHive(buildHive(testKey{
+		name: "ROOT",
+		subkeys: []testKey{
+			{name: "Classes"},
+			{
+				name:      "Microsoft",
+				indexRoot: true,
+				subkeys: []testKey{
+					{name: "Cryptography"},
+					{name: "Windows"},
+					{
+						name: "Windows NT",
+						subkeys: []testKey{{
+							name: "CurrentVersion",
+							values: []testValue{
+								named("ProductName", stringValue("Windows Server 2019 Datacenter")),
+								named("CurrentMajorVersionNumber", dwordValue(10)),
+								named("Binary", testValue{typ: 3, data: []byte{1, 2, 3, 4, 5, 6}}),
+							},
+						}},
+					},
+				},
+			},
+		},
+	}))
+	require.NoError(t, err)
+	root, err := hive.root()
+	require.NoError(t, err)
+	assert.Equal(t, "ROOT", root.name())
+
+	key, err := root.subkey(`microsoft\WINDOWS NT\CurrentVersion`)
+	require.NoError(t, err)
+	assert.Equal(t, "CurrentVersion", key.name())
+
+	productName, err := key.stringValue("productname")
+	assert.NoError(t, err)
+	assert.Equal(t, "Windows Server 2019 Datacenter", productName)
+	major, err := key.dwordValue("CurrentMajorVersionNumber")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(10), major)
+
+	_, err = key.stringValue("CurrentMajorVersionNumber")
+	assert.EqualError(t, err, `registry value "CurrentMajorVersionNumber" is not a string`)
+	_, err = key.dwordValue("Binary")
+	assert.EqualError(t, err, `registry value "Binary" is not a DWORD`)
+	_, err = key.stringValue("Missing")
+	assert.Equal(t, errNotExist, err)
+	_, err = root.subkey(`Microsoft\Missing`)
+	assert.Equal(t, errNotExist, err)
+	_, err = root.subkey(`Classes\Empty`)
+	assert.Equal(t, errNotExist, err)
+}
+
+func TestOpenRegistryHive_RejectsInvalidHives(t *testing.T) {
+	_, err := openRegistryHive([]byte("regf"))
+	assert.EqualError(t, err, "invalid registry hive")
+	_, err = openRegistryHive(make([]byte, 8192))
+	assert.EqualError(t, err, "invalid registry hive")
+
+	hive := buildHive(testKey{name: "ROOT"})
+	binary.LittleEndian.PutUint32(hive[36:], uint32(len(hive)))
+	h, err := openRegistryHive(hive)
+	require.NoError(t, err)
+	_, err = h.root()
+	assert.Error(t, err)
+}
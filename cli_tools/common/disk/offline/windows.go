@@ -0,0 +1,141 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
+)
+
+const (
+	softwareHive      = "/Windows/System32/config/SOFTWARE"
+	currentVersionKey = `Microsoft\Windows NT\CurrentVersion`
+)
+
+type ntVersion struct {
+	major, minor int
+}
+
+// Mappings of NT versions to marketing versions, which differ for server
+// and client. NT 10.0 servers are resolved using their product name, since
+// it's used by both Windows 2016 and Windows 2019.
+// Source: https://wikipedia.org/wiki/List_of_Microsoft_Windows_versions
+var (
+	serverVersions = map[ntVersion][2]string{
+		{6, 0}: {"2008", ""},
+		{6, 1}: {"2008", "r2"},
+		{6, 2}: {"2012", ""},
+		{6, 3}: {"2012", "r2"},
+	}
+	clientVersions = map[ntVersion][2]string{
+		{6, 0}:  {"Vista", ""},
+		{6, 1}:  {"7", ""},
+		{6, 2}:  {"8", ""},
+		{6, 3}:  {"8", "1"},
+		{10, 0}: {"10", ""},
+	}
+)
+
+// inspectWindows returns the version of Windows that is installed on fs,
+// using its registry, or nil when Windows isn't found or its version isn't
+// supported.
+func inspectWindows(fs filesystem) (*pb.OsRelease, error) {
+	if !isFile(fs, softwareHive) {
+		return nil, nil
+	}
+	content, err := readFile(fs, softwareHive)
+	if err != nil {
+		return nil, err
+	}
+	hive, err := openRegistryHive(content)
+	if err != nil {
+		return nil, err
+	}
+	root, err := hive.root()
+	if err != nil {
+		return nil, err
+	}
+	key, err := root.subkey(currentVersionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry key %s: %w", currentVersionKey, err)
+	}
+
+	version, err := readNTVersion(key)
+	if err != nil {
+		return nil, err
+	}
+	productName, _ := key.stringValue("ProductName")
+	// Versions before Windows 7 don't have an installation type.
+	installationType, err := key.stringValue("InstallationType")
+	if err != nil {
+		installationType = "Client"
+		if strings.Contains(strings.ToLower(productName), "server") {
+			installationType = "Server"
+		}
+	}
+
+	var marketing [2]string
+	var ok bool
+	if strings.Contains(strings.ToLower(installationType), "client") {
+		marketing, ok = clientVersions[version]
+	} else if strings.Contains(strings.ToLower(installationType), "server") {
+		marketing, ok = serverVersions[version]
+		if version == (ntVersion{10, 0}) {
+			switch {
+			case strings.Contains(productName, "2016"):
+				marketing, ok = [2]string{"2016", ""}, true
+			case strings.Contains(productName, "2019"):
+				marketing, ok = [2]string{"2019", ""}, true
+			}
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &pb.OsRelease{
+		MajorVersion: marketing[0],
+		MinorVersion: marketing[1],
+		DistroId:     pb.Distro_WINDOWS,
+	}, nil
+}
+
+// readNTVersion reads the NT version. Since Windows 10, CurrentVersion is
+// fixed at 6.3, and the version is in separate values.
+func readNTVersion(key *registryKey) (ntVersion, error) {
+	major, majorErr := key.dwordValue("CurrentMajorVersionNumber")
+	minor, minorErr := key.dwordValue("CurrentMinorVersionNumber")
+	if majorErr == nil && minorErr == nil {
+		return ntVersion{int(major), int(minor)}, nil
+	}
+	current, err := key.stringValue("CurrentVersion")
+	if err != nil {
+		return ntVersion{}, fmt.Errorf("failed to read Windows version: %w", err)
+	}
+	parts := strings.Split(current, ".")
+	if len(parts) != 2 {
+		return ntVersion{}, fmt.Errorf("invalid Windows version %q", current)
+	}
+	var version ntVersion
+	if version.major, err = strconv.Atoi(parts[0]); err == nil {
+		version.minor, err = strconv.Atoi(parts[1])
+	}
+	if err != nil {
+		return ntVersion{}, fmt.Errorf("invalid Windows version %q", current)
+	}
+	return version, nil
+}
@@ -0,0 +1,139 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
+)
+
+// softwareHiveWith returns a SOFTWARE hive whose CurrentVersion key has
+// values.
+func softwareHiveWith(values ...testValue) []byte {
+	return buildHive(testKey{
+		name: "ROOT",
+		subkeys: []testKey{{
+			name: "Microsoft",
+			subkeys: []testKey{{
+				name:    "Windows NT",
+				subkeys: []testKey{{name: "CurrentVersion", values: values}},
+			}},
+		}},
+	})
+}
+
+// windowsFS returns a filesystem with a SOFTWARE hive whose CurrentVersion
+// key has values.
+func windowsFS(values ...testValue) *memFS {
+	return &memFS{files: map[string]memFile{
+		softwareHive: {kind: kindFile, content: string(softwareHiveWith(values...))},
+	}}
+}
+
+func TestInspectWindows(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		values   []testValue
+		expected *pb.OsRelease
+	}{
+		{
+			name: "2008r2, without major and minor numbers",
+			values: []testValue{
+				named("CurrentVersion", stringValue("6.1")),
+				named("InstallationType", stringValue("Server")),
+				named("ProductName", stringValue("Windows Server 2008 R2 Standard")),
+			},
+			expected: &pb.OsRelease{DistroId: pb.Distro_WINDOWS, MajorVersion: "2008", MinorVersion: "r2"},
+		},
+		{
+			name: "2008, without installation type",
+			values: []testValue{
+				named("CurrentVersion", stringValue("6.0")),
+				named("ProductName", stringValue("Windows Server (R) 2008 Standard")),
+			},
+			expected: &pb.OsRelease{DistroId: pb.Distro_WINDOWS, MajorVersion: "2008"},
+		},
+		{
+			name: "8.1",
+			values: []testValue{
+				named("CurrentVersion", stringValue("6.3")),
+				named("InstallationType", stringValue("Client")),
+				named("ProductName", stringValue("Windows 8.1 Pro")),
+			},
+			expected: &pb.OsRelease{DistroId: pb.Distro_WINDOWS, MajorVersion: "8", MinorVersion: "1"},
+		},
+		{
+			name: "2019 server core",
+			values: []testValue{
+				named("CurrentVersion", stringValue("6.3")),
+				named("CurrentMajorVersionNumber", dwordValue(10)),
+				named("CurrentMinorVersionNumber", dwordValue(0)),
+				named("InstallationType", stringValue("Server Core")),
+				named("ProductName", stringValue("Windows Server 2019 Datacenter")),
+			},
+			expected: &pb.OsRelease{DistroId: pb.Distro_WINDOWS, MajorVersion: "2019"},
+		},
+		{
+			name: "10",
+			values: []testValue{
+				named("CurrentVersion", stringValue("6.3")),
+				named("CurrentMajorVersionNumber", dwordValue(10)),
+				named("CurrentMinorVersionNumber", dwordValue(0)),
+				named("InstallationType", stringValue("Client")),
+				named("ProductName", stringValue("Windows 10 Pro")),
+			},
+			expected: &pb.OsRelease{DistroId: pb.Distro_WINDOWS, MajorVersion: "10"},
+		},
+		{
+			name: "unknown server version",
+			values: []testValue{
+				named("CurrentMajorVersionNumber", dwordValue(10)),
+				named("CurrentMinorVersionNumber", dwordValue(0)),
+				named("InstallationType", stringValue("Server")),
+				named("ProductName", stringValue("Windows Server 2022 Datacenter")),
+			},
+			expected: nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := inspectWindows(windowsFS(tt.values...))
+			assert.NoError(t, err)
+			if diff := cmp.Diff(tt.expected, actual, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected difference:\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestInspectWindows_ReturnsNilWhenHiveIsMissing(t *testing.T) {
+	actual, err := inspectWindows(&memFS{files: map[string]memFile{
+		"/Windows/System32/cmd.exe": {kind: kindFile},
+	}})
+	assert.NoError(t, err)
+	assert.Nil(t, actual)
+}
+
+func TestInspectWindows_FailsWhenVersionIsMissing(t *testing.T) {
+	_, err := inspectWindows(windowsFS(named("CurrentVersion", stringValue("six"))))
+	assert.EqualError(t, err, `invalid Windows version "six"`)
+
+	_, err = inspectWindows(windowsFS(named("ProductName", stringValue("Windows 7"))))
+	assert.EqualError(t, err, "failed to read Windows version: file does not exist")
+}
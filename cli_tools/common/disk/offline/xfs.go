@@ -0,0 +1,380 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	xfsFormatLocal   = 1
+	xfsFormatExtents = 2
+	xfsFormatBtree   = 3
+
+	xfsVersion5        = 5
+	xfsV5FtypeFeature  = 0x1
+	xfsV4FtypeFeature  = 0x200
+	xfsV2InodeCoreSize = 100
+	xfsV3InodeCoreSize = 176
+	maxXFSBtreeDepth   = 8
+
+	// Directory blocks are stored below this offset, and their
+	// indexes above it.
+	xfsDirLeafOffset = 32 * 1024 * 1024 * 1024
+)
+
+// xfsFS reads XFS filesystems.
+type xfsFS struct {
+	r            io.ReaderAt
+	blockSize    int64
+	dirBlockSize int64
+	agBlocks     int64
+	agBlockLog   uint
+	inodeSize    int64
+	inoPerBlkLog uint
+	rootInode    uint64
+	v5           bool
+	ftype        bool
+}
+
+func openXFS(r io.ReaderAt) (*xfsFS, error) {
+	sb := make([]byte, 512)
+	if _, err := r.ReadAt(sb, 0); err != nil {
+		return nil, fmt.Errorf("failed to read xfs superblock: %w", err)
+	}
+	fs := &xfsFS{
+		r:            r,
+		blockSize:    int64(binary.BigEndian.Uint32(sb[4:])),
+		rootInode:    binary.BigEndian.Uint64(sb[56:]),
+		agBlocks:     int64(binary.BigEndian.Uint32(sb[84:])),
+		inodeSize:    int64(binary.BigEndian.Uint16(sb[104:])),
+		inoPerBlkLog: uint(sb[123]),
+		agBlockLog:   uint(sb[124]),
+		v5:           binary.BigEndian.Uint16(sb[100:])&0xf == xfsVersion5,
+	}
+	fs.dirBlockSize = fs.blockSize << sb[192]
+	if fs.v5 {
+		fs.ftype = binary.BigEndian.Uint32(sb[216:])&xfsV5FtypeFeature != 0
+	} else {
+		fs.ftype = binary.BigEndian.Uint32(sb[200:])&xfsV4FtypeFeature != 0
+	}
+	if fs.blockSize < 512 || fs.blockSize > 65536 || fs.inodeSize < 256 || fs.inodeSize > fs.blockSize ||
+		fs.agBlocks == 0 || fs.agBlockLog > 31 || fs.inoPerBlkLog > 8 {
+		return nil, errors.New("invalid xfs superblock")
+	}
+	return fs, nil
+}
+
+func (fs *xfsFS) name() string {
+	return "xfs"
+}
+
+func (fs *xfsFS) root() uint64 {
+	return fs.rootInode
+}
+
+// blockOffset returns the disk offset of a filesystem block number, whose
+// high bits are the allocation group.
+func (fs *xfsFS) blockOffset(fsBlock uint64) int64 {
+	ag := int64(fsBlock >> fs.agBlockLog)
+	block := int64(fsBlock & (1<<fs.agBlockLog - 1))
+	return (ag*fs.agBlocks + block) * fs.blockSize
+}
+
+func (fs *xfsFS) inode(n uint64) ([]byte, error) {
+	block := n >> fs.inoPerBlkLog
+	index := int64(n & (1<<fs.inoPerBlkLog - 1))
+	inode := make([]byte, fs.inodeSize)
+	if _, err := fs.r.ReadAt(inode, fs.blockOffset(block)+index*fs.inodeSize); err != nil {
+		return nil, fmt.Errorf("failed to read xfs inode %d: %w", n, err)
+	}
+	if inode[0] != 'I' || inode[1] != 'N' {
+		return nil, fmt.Errorf("invalid xfs inode %d", n)
+	}
+	return inode, nil
+}
+
+// dataFork returns the data fork of an inode, which follows the inode core
+// and precedes the attribute fork, if any.
+func (fs *xfsFS) dataFork(inode []byte) []byte {
+	start := int64(xfsV2InodeCoreSize)
+	if inode[4] >= 3 {
+		start = xfsV3InodeCoreSize
+	}
+	end := fs.inodeSize
+	if forkOffset := int64(inode[82]); forkOffset != 0 && start+forkOffset*8 < end {
+		end = start + forkOffset*8
+	}
+	return inode[start:end]
+}
+
+func (fs *xfsFS) kind(n uint64) (fileKind, error) {
+	inode, err := fs.inode(n)
+	if err != nil {
+		return 0, err
+	}
+	switch binary.BigEndian.Uint16(inode[2:]) & 0xf000 {
+	case 0x8000:
+		return kindFile, nil
+	case 0x4000:
+		return kindDirectory, nil
+	case 0xa000:
+		return kindSymlink, nil
+	}
+	return kindOther, nil
+}
+
+func (fs *xfsFS) read(n uint64) ([]byte, error) {
+	inode, err := fs.inode(n)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint64(inode[56:]))
+	if size < 0 || size > maxFileSize {
+		return nil, fmt.Errorf("xfs inode %d is too large: %d bytes", n, size)
+	}
+	fork := fs.dataFork(inode)
+	format := inode[5]
+	if format == xfsFormatLocal {
+		if size > int64(len(fork)) {
+			return nil, fmt.Errorf("invalid xfs inode %d", n)
+		}
+		return append([]byte{}, fork[:size]...), nil
+	}
+
+	extents, err := fs.extents(inode, fork)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extents of xfs inode %d: %w", n, err)
+	}
+	isSymlink := binary.BigEndian.Uint16(inode[2:])&0xf000 == 0xa000
+	if isSymlink && fs.v5 {
+		return fs.readRemoteSymlink(extents, size)
+	}
+	return readExtents(fs.r, extents, fs.blockSize, size)
+}
+
+// extents returns the extents of a file, in filesystem blocks. Their
+// physical blocks are disk offsets in blocks, rather than filesystem block
+// numbers.
+func (fs *xfsFS) extents(inode, fork []byte) ([]extent, error) {
+	count := int(binary.BigEndian.Uint32(inode[76:]))
+	switch inode[5] {
+	case xfsFormatExtents:
+		if count*16 > len(fork) {
+			return nil, errors.New("invalid extent count")
+		}
+		return fs.decodeExtents(fork, count), nil
+	case xfsFormatBtree:
+		// The root of the btree is in the inode, and its pointers follow
+		// as many keys as would fit in the fork.
+		level, records := binary.BigEndian.Uint16(fork), int(binary.BigEndian.Uint16(fork[2:]))
+		maxRecords := (len(fork) - 4) / 16
+		if records > maxRecords {
+			return nil, errors.New("invalid btree root")
+		}
+		return fs.btreeExtents(fork[4+maxRecords*8:], records, int(level))
+	}
+	return nil, fmt.Errorf("unsupported xfs inode format %d", inode[5])
+}
+
+// btreeExtents returns the extents in the btree blocks of ptrs.
+func (fs *xfsFS) btreeExtents(ptrs []byte, count int, level int) ([]extent, error) {
+	if level <= 0 || level > maxXFSBtreeDepth {
+		return nil, errors.New("invalid btree depth")
+	}
+	headerSize := 24
+	if fs.v5 {
+		headerSize = 72
+	}
+	var extents []extent
+	for i := 0; i < count; i++ {
+		block := make([]byte, fs.blockSize)
+		if _, err := fs.r.ReadAt(block, fs.blockOffset(binary.BigEndian.Uint64(ptrs[8*i:]))); err != nil {
+			return nil, err
+		}
+		if magic := string(block[:4]); magic != "BMAP" && magic != "BMA3" {
+			return nil, errors.New("invalid btree block")
+		}
+		records := int(binary.BigEndian.Uint16(block[6:]))
+		if level == 1 {
+			if headerSize+records*16 > len(block) {
+				return nil, errors.New("invalid btree block")
+			}
+			extents = append(extents, fs.decodeExtents(block[headerSize:], records)...)
+			continue
+		}
+		maxRecords := (len(block) - headerSize) / 16
+		if records > maxRecords {
+			return nil, errors.New("invalid btree block")
+		}
+		child, err := fs.btreeExtents(block[headerSize+maxRecords*8:], records, level-1)
+		if err != nil {
+			return nil, err
+		}
+		extents = append(extents, child...)
+	}
+	return extents, nil
+}
+
+// decodeExtents decodes packed 128-bit extent records: a flag bit for
+// unwritten extents, a 54-bit file offset, a 52-bit block number, and a
+// 21-bit length.
+func (fs *xfsFS) decodeExtents(b []byte, count int) []extent {
+	extents := make([]extent, count)
+	for i := range extents {
+		l0, l1 := binary.BigEndian.Uint64(b[16*i:]), binary.BigEndian.Uint64(b[16*i+8:])
+		extents[i] = extent{
+			logical:   int64(l0 & (1<<63 - 1) >> 9),
+			physical:  fs.blockOffset(l0&0x1ff<<43|l1>>21) / fs.blockSize,
+			length:    int64(l1 & (1<<21 - 1)),
+			unwritten: l0>>63 != 0,
+		}
+	}
+	return extents
+}
+
+// readRemoteSymlink reads a symlink target that's stored in blocks, each of
+// which starts with a header on v5 filesystems.
+func (fs *xfsFS) readRemoteSymlink(extents []extent, size int64) ([]byte, error) {
+	const headerSize = 56
+	var target []byte
+	for _, e := range extents {
+		for i := int64(0); i < e.length && int64(len(target)) < size; i++ {
+			block := make([]byte, fs.blockSize)
+			if _, err := fs.r.ReadAt(block, (e.physical+i)*fs.blockSize); err != nil {
+				return nil, err
+			}
+			n := min64(fs.blockSize-headerSize, size-int64(len(target)))
+			target = append(target, block[headerSize:headerSize+n]...)
+		}
+	}
+	return target, nil
+}
+
+func (fs *xfsFS) lookup(dir uint64, name string) (uint64, error) {
+	inode, err := fs.inode(dir)
+	if err != nil {
+		return 0, err
+	}
+	if inode[5] == xfsFormatLocal {
+		return fs.lookupShortform(fs.dataFork(inode), name)
+	}
+
+	// The size of a directory covers its data blocks.
+	data, err := fs.read(dir)
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(data)) > xfsDirLeafOffset {
+		data = data[:xfsDirLeafOffset]
+	}
+	for start := int64(0); start+fs.dirBlockSize <= int64(len(data)); start += fs.dirBlockSize {
+		if inode, ok := fs.lookupDataBlock(data[start:start+fs.dirBlockSize], name); ok {
+			return inode, nil
+		}
+	}
+	return 0, errNotExist
+}
+
+// lookupShortform finds name in a directory that's stored in its inode.
+func (fs *xfsFS) lookupShortform(fork []byte, name string) (uint64, error) {
+	count, wideInodes := int(fork[0]), fork[1] > 0
+	inodeSize := 4
+	if wideInodes {
+		inodeSize = 8
+	}
+	// The header has the counts, and the parent's inode.
+	pos := 2 + inodeSize
+	for i := 0; i < count; i++ {
+		if pos+3 > len(fork) {
+			break
+		}
+		nameLen := int(fork[pos])
+		entryName := fork[pos+3 : minInt(pos+3+nameLen, len(fork))]
+		pos += 3 + nameLen
+		if fs.ftype {
+			pos++
+		}
+		if pos+inodeSize > len(fork) {
+			break
+		}
+		var inode uint64
+		if wideInodes {
+			inode = binary.BigEndian.Uint64(fork[pos:])
+		} else {
+			inode = uint64(binary.BigEndian.Uint32(fork[pos:]))
+		}
+		pos += inodeSize
+		if string(entryName) == name {
+			return inode, nil
+		}
+	}
+	return 0, errNotExist
+}
+
+// lookupDataBlock finds name in a directory data block.
+func (fs *xfsFS) lookupDataBlock(block []byte, name string) (uint64, bool) {
+	headerSize := 16
+	if fs.v5 {
+		headerSize = 64
+	}
+	end := len(block)
+	switch string(block[:4]) {
+	case "XD2B", "XDB3":
+		// Single-block directories end with their leaf entries, and a
+		// tail with the number of entries.
+		leafEntries := int(binary.BigEndian.Uint32(block[end-8:]))
+		end -= 8 + leafEntries*8
+	case "XD2D", "XDD3":
+	default:
+		return 0, false
+	}
+	for pos := headerSize; pos+11 <= end; {
+		if binary.BigEndian.Uint16(block[pos:]) == 0xffff {
+			// An unused entry, with its length.
+			length := int(binary.BigEndian.Uint16(block[pos+2:]))
+			if length < 8 {
+				break
+			}
+			pos += length
+			continue
+		}
+		nameLen := int(block[pos+8])
+		if pos+9+nameLen > end {
+			break
+		}
+		if string(block[pos+9:pos+9+nameLen]) == name {
+			return binary.BigEndian.Uint64(block[pos:]), true
+		}
+		// The inode, name length, name, file type, and tag, aligned to
+		// eight bytes.
+		length := 8 + 1 + nameLen + 2
+		if fs.ftype {
+			length++
+		}
+		pos += (length + 7) &^ 7
+	}
+	return 0, false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
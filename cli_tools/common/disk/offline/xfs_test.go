@@ -0,0 +1,296 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package offline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testXFSBlockSize  = 4096
+	testXFSInodeSize  = 512
+	testXFSAGBlockLog = 6
+	testXFSInoPerBlk  = testXFSBlockSize / testXFSInodeSize
+	testXFSAGs        = 2
+)
+
+// xfsBuilder creates XFS filesystems with two small allocation groups.
+type xfsBuilder struct {
+	disk []byte
+	v5   bool
+	// next is the index of the next free block, across allocation groups.
+	next       int
+	inodeBlock uint64
+	inodes     int
+}
+
+type xfsEntry struct {
+	name  string
+	inode uint64
+}
+
+func newXFSBuilder(v5 bool) *xfsBuilder {
+	b := &xfsBuilder{
+		disk: make([]byte, testXFSAGs<<testXFSAGBlockLog*testXFSBlockSize),
+		v5:   v5,
+		// Allocations start near the end of the first group, so that
+		// files span both groups.
+		next: 1<<testXFSAGBlockLog - 8,
+	}
+	sb := b.disk
+	copy(sb, "XFSB")
+	binary.BigEndian.PutUint32(sb[4:], testXFSBlockSize)
+	binary.BigEndian.PutUint32(sb[84:], 1<<testXFSAGBlockLog)
+	binary.BigEndian.PutUint16(sb[104:], testXFSInodeSize)
+	sb[123] = 3
+	sb[124] = testXFSAGBlockLog
+	if v5 {
+		binary.BigEndian.PutUint16(sb[100:], xfsVersion5)
+		binary.BigEndian.PutUint32(sb[216:], xfsV5FtypeFeature)
+	} else {
+		binary.BigEndian.PutUint16(sb[100:], 4)
+	}
+	return b
+}
+
+// alloc returns the filesystem block numbers of count contiguous blocks.
+func (b *xfsBuilder) alloc(count int) uint64 {
+	perAG := 1 << testXFSAGBlockLog
+	if b.next%perAG+count > perAG {
+		b.next += perAG - b.next%perAG
+	}
+	start := b.next
+	b.next += count
+	return uint64(start/perAG)<<testXFSAGBlockLog | uint64(start%perAG)
+}
+
+func (b *xfsBuilder) block(fsBlock uint64) []byte {
+	offset := (int(fsBlock>>testXFSAGBlockLog)<<testXFSAGBlockLog + int(fsBlock&(1<<testXFSAGBlockLog-1))) * testXFSBlockSize
+	return b.disk[offset : offset+testXFSBlockSize]
+}
+
+// inode writes an inode, and returns its number and data fork.
+func (b *xfsBuilder) inode(mode uint16, format byte, size int, extents int) (uint64, []byte) {
+	if b.inodes%testXFSInoPerBlk == 0 {
+		b.inodeBlock = b.alloc(1)
+	}
+	index := b.inodes % testXFSInoPerBlk
+	b.inodes++
+	inode := b.block(b.inodeBlock)[index*testXFSInodeSize : (index+1)*testXFSInodeSize]
+	copy(inode, "IN")
+	binary.BigEndian.PutUint16(inode[2:], mode)
+	inode[4], inode[5] = 2, format
+	forkStart := xfsV2InodeCoreSize
+	if b.v5 {
+		inode[4] = 3
+		forkStart = xfsV3InodeCoreSize
+	}
+	binary.BigEndian.PutUint64(inode[56:], uint64(size))
+	binary.BigEndian.PutUint32(inode[76:], uint32(extents))
+	return b.inodeBlock<<3 | uint64(index), inode[forkStart:]
+}
+
+func encodeXFSExtent(b []byte, logical, physical uint64, length int) {
+	binary.BigEndian.PutUint64(b, logical<<9|physical>>43)
+	binary.BigEndian.PutUint64(b[8:], (physical&(1<<43-1))<<21|uint64(length))
+}
+
+// file writes content to blocks, and returns an inode with their extents.
+// Files of more than one block are split into an extent per block, in
+// reverse order on disk.
+func (b *xfsBuilder) file(mode uint16, content []byte) uint64 {
+	blocks := (len(content) + testXFSBlockSize - 1) / testXFSBlockSize
+	ino, fork := b.inode(mode, xfsFormatExtents, len(content), blocks)
+	for i := blocks - 1; i >= 0; i-- {
+		block := b.alloc(1)
+		copy(b.block(block), content[i*testXFSBlockSize:])
+		encodeXFSExtent(fork[16*i:], uint64(i), block, 1)
+	}
+	return ino
+}
+
+// btreeFile writes a file whose extents are in a btree block.
+func (b *xfsBuilder) btreeFile(content []byte) uint64 {
+	blocks := (len(content) + testXFSBlockSize - 1) / testXFSBlockSize
+	ino, fork := b.inode(0x81a4, xfsFormatBtree, len(content), blocks)
+	leaf := b.alloc(1)
+	binary.BigEndian.PutUint16(fork, 1)
+	binary.BigEndian.PutUint16(fork[2:], 1)
+	maxRecords := (len(fork) - 4) / 16
+	binary.BigEndian.PutUint64(fork[4+maxRecords*8:], leaf)
+
+	leafBlock := b.block(leaf)
+	headerSize := 24
+	copy(leafBlock, "BMAP")
+	if b.v5 {
+		headerSize = 72
+		copy(leafBlock, "BMA3")
+	}
+	binary.BigEndian.PutUint16(leafBlock[6:], uint16(blocks))
+	for i := 0; i < blocks; i++ {
+		block := b.alloc(1)
+		copy(b.block(block), content[i*testXFSBlockSize:])
+		encodeXFSExtent(leafBlock[headerSize+16*i:], uint64(i), block, 1)
+	}
+	return ino
+}
+
+func (b *xfsBuilder) symlink(target string) uint64 {
+	if len(target) < 100 {
+		ino, fork := b.inode(0xa1ff, xfsFormatLocal, len(target), 0)
+		copy(fork, target)
+		return ino
+	}
+	if !b.v5 {
+		return b.file(0xa1ff, []byte(target))
+	}
+	// Remote symlinks of v5 filesystems have a header in each block.
+	ino, fork := b.inode(0xa1ff, xfsFormatExtents, len(target), 1)
+	block := b.alloc(1)
+	copy(b.block(block), "XSLM")
+	copy(b.block(block)[56:], target)
+	encodeXFSExtent(fork, 0, block, 1)
+	return ino
+}
+
+func (b *xfsBuilder) shortformDir(parent uint64, entries ...xfsEntry) uint64 {
+	var fork bytes.Buffer
+	fork.Write([]byte{byte(len(entries)), 0})
+	binary.Write(&fork, binary.BigEndian, uint32(parent))
+	for i, e := range entries {
+		fork.WriteByte(byte(len(e.name)))
+		binary.Write(&fork, binary.BigEndian, uint16(i))
+		fork.WriteString(e.name)
+		if b.v5 {
+			fork.WriteByte(1)
+		}
+		binary.Write(&fork, binary.BigEndian, uint32(e.inode))
+	}
+	ino, inodeFork := b.inode(0x41ed, xfsFormatLocal, fork.Len(), 0)
+	copy(inodeFork, fork.Bytes())
+	return ino
+}
+
+// blockDir writes a directory whose entries are in data blocks, each of
+// which has perBlock entries. Single-block directories have a tail.
+func (b *xfsBuilder) blockDir(perBlock int, entries ...xfsEntry) uint64 {
+	var blocks [][]byte
+	headerSize, magic := 16, "XD2D"
+	if b.v5 {
+		headerSize, magic = 64, "XDD3"
+	}
+	single := len(entries) <= perBlock
+	if single {
+		magic = map[string]string{"XD2D": "XD2B", "XDD3": "XDB3"}[magic]
+	}
+	for len(entries) > 0 {
+		n := minInt(perBlock, len(entries))
+		block := make([]byte, testXFSBlockSize)
+		copy(block, magic)
+		pos := headerSize
+		// An unused entry precedes the others.
+		binary.BigEndian.PutUint16(block[pos:], 0xffff)
+		binary.BigEndian.PutUint16(block[pos+2:], 16)
+		pos += 16
+		for _, e := range entries[:n] {
+			binary.BigEndian.PutUint64(block[pos:], e.inode)
+			block[pos+8] = byte(len(e.name))
+			copy(block[pos+9:], e.name)
+			length := 8 + 1 + len(e.name) + 2
+			if b.v5 {
+				length++
+			}
+			pos += (length + 7) &^ 7
+		}
+		if single {
+			binary.BigEndian.PutUint32(block[testXFSBlockSize-8:], uint32(n))
+		}
+		blocks = append(blocks, block)
+		entries = entries[n:]
+	}
+	return b.file(0x41ed, bytes.Join(blocks, nil))
+}
+
+// buildXFS creates a filesystem with:
+//
+//	/etc/os-release
+//	/etc/hostname -> a symlink with a long target
+//	/usr/bin/*: many entries, in two data blocks
+//	/usr/bin/ls: a file whose extents are in a btree
+//	/usr/lib/large: a file of two blocks
+//	/bin -> usr/bin
+func buildXFS(v5 bool) []byte {
+	b := newXFSBuilder(v5)
+	// The root inode is written last, and its number is updated.
+	osRelease := b.file(0x81a4, []byte("ID=rhel\nVERSION_ID=\"8.3\"\n"))
+	hostname := b.symlink("/" + strings.Repeat("usr/../", 20) + "etc/os-release")
+	etc := b.blockDir(10, xfsEntry{"os-release", osRelease}, xfsEntry{"hostname", hostname})
+
+	ls := b.btreeFile(bytes.Repeat([]byte("ls"), testXFSBlockSize+1))
+	binEntries := []xfsEntry{}
+	for i := 0; i < 100; i++ {
+		binEntries = append(binEntries, xfsEntry{fmt.Sprintf("tool-%d", i), osRelease})
+	}
+	binEntries = append(binEntries, xfsEntry{"ls", ls})
+	bin := b.blockDir(60, binEntries...)
+
+	large := b.file(0x81a4, bytes.Repeat([]byte("0123456789abcdef"), testXFSBlockSize/8))
+	lib := b.shortformDir(0, xfsEntry{"large", large})
+	usr := b.shortformDir(0, xfsEntry{"bin", bin}, xfsEntry{"lib", lib})
+	binLink := b.symlink("usr/bin")
+	root := b.shortformDir(0, xfsEntry{"etc", etc}, xfsEntry{"usr", usr}, xfsEntry{"bin", binLink})
+	binary.BigEndian.PutUint64(b.disk[56:], root)
+	return b.disk
+}
+
+func TestOpenXFS(t *testing.T) {
+	for _, v5 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("v5=%v", v5), func(t *testing.T) {
+			fs, err := openFilesystem(bytes.NewReader(buildXFS(v5)))
+			require.NoError(t, err)
+			assert.Equal(t, "xfs", fs.name())
+
+			osRelease, err := readFile(fs, "/etc/hostname")
+			assert.NoError(t, err)
+			assert.Equal(t, "ID=rhel\nVERSION_ID=\"8.3\"\n", string(osRelease))
+
+			ls, err := readFile(fs, "/bin/ls")
+			assert.NoError(t, err)
+			assert.Equal(t, bytes.Repeat([]byte("ls"), testXFSBlockSize+1), ls)
+
+			large, err := readFile(fs, "/usr/lib/large")
+			assert.NoError(t, err)
+			assert.Equal(t, bytes.Repeat([]byte("0123456789abcdef"), testXFSBlockSize/8), large)
+
+			assert.True(t, isFile(fs, "/usr/bin/tool-99"))
+			assert.True(t, isDir(fs, "/bin"))
+			assert.False(t, isFile(fs, "/usr/bin/tool-100"))
+		})
+	}
+}
+
+func TestOpenXFS_RejectsInvalidSuperblock(t *testing.T) {
+	disk := buildXFS(true)
+	binary.BigEndian.PutUint16(disk[104:], 64)
+	_, err := openFilesystem(bytes.NewReader(disk))
+	assert.EqualError(t, err, "invalid xfs superblock")
+}
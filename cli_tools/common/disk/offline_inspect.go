@@ -0,0 +1,73 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package disk
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/disk/offline"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
+)
+
+// NewOfflineInspector creates an Inspector that inspects local raw and
+// qcow2 image files, without a worker VM. It supports MBR and GPT partition
+// tables, LVM, and ext2/3/4, xfs, and NTFS filesystems.
+func NewOfflineInspector(logger logging.Logger) Inspector {
+	return &offlineInspector{logger}
+}
+
+// offlineInspector implements disk.Inspector by reading image files directly.
+type offlineInspector struct {
+	logger logging.Logger
+}
+
+// Cancel is a no-op, since inspections don't create resources.
+func (i *offlineInspector) Cancel(reason string) bool {
+	return false
+}
+
+// Inspect finds partition and boot-related properties for an image file, and
+// returns an InspectionResult. `reference` is the path to a local raw or
+// qcow2 file.
+func (i *offlineInspector) Inspect(reference string) (*pb.InspectionResults, error) {
+	startTime := time.Now()
+	results := &pb.InspectionResults{}
+
+	image, err := offline.OpenImage(reference)
+	if err != nil {
+		return assembleErrors(reference, results, pb.InspectionResults_MOUNTING_GUEST, err, startTime)
+	}
+	defer image.Close()
+
+	results, err = offline.Inspect(image, image.Size())
+	if err != nil {
+		return assembleErrors(reference, results, results.ErrorWhen, err, startTime)
+	}
+	i.logger.Debug(fmt.Sprintf("Detection results: %s", results.String()))
+
+	if err = validate(results); err != nil {
+		return assembleErrors(reference, results, pb.InspectionResults_INTERPRETING_INSPECTION_RESULTS, err, startTime)
+	}
+
+	if err = populate(results, i.logger); err != nil {
+		return assembleErrors(reference, results, pb.InspectionResults_INTERPRETING_INSPECTION_RESULTS, err, startTime)
+	}
+
+	results.ElapsedTimeMs = time.Now().Sub(startTime).Milliseconds()
+	i.logger.Metric(&pb.OutputInfo{InspectionResults: results})
+	return results, nil
+}
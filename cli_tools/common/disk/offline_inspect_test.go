@@ -0,0 +1,67 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package disk
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
+)
+
+func TestOfflineInspector_Inspect(t *testing.T) {
+	f, err := os.Open("offline/testdata/ext4.img.gz")
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "offline-inspect")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "disk.raw")
+	require.NoError(t, ioutil.WriteFile(filename, content, 0600))
+
+	logger := logging.NewToolLogger(t.Name())
+	actual, err := NewOfflineInspector(logger).Inspect(filename)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), actual.OsCount)
+	assert.Equal(t, "ext4", actual.RootFs)
+	assert.Equal(t, pb.Distro_DEBIAN, actual.OsRelease.DistroId)
+	assert.Equal(t, "debian-10", actual.OsRelease.CliFormatted)
+	if diff := cmp.Diff(actual, logger.ReadOutputInfo().InspectionResults, protocmp.Transform()); diff != "" {
+		t.Errorf("metric should include results:\n%v", diff)
+	}
+}
+
+func TestOfflineInspector_Inspect_ReportsMissingFiles(t *testing.T) {
+	actual, err := NewOfflineInspector(logging.NewToolLogger(t.Name())).Inspect("/missing/disk.raw")
+	assert.Error(t, err)
+	assert.Equal(t, pb.InspectionResults_MOUNTING_GUEST, actual.ErrorWhen)
+}
+
+func TestOfflineInspector_Cancel(t *testing.T) {
+	assert.False(t, NewOfflineInspector(logging.NewToolLogger(t.Name())).Cancel("reason"))
+}
@@ -77,6 +77,7 @@ type StorageObject interface {
 	Delete() error
 	GetObjectHandle() *storage.ObjectHandle
 	NewReader() (io.ReadCloser, error)
+	NewRangeReader(offset, length int64) (io.ReadCloser, error)
 	NewWriter() io.WriteCloser
 	ObjectName() string
 	Compose(src ...StorageObject) (*storage.ObjectAttrs, error)
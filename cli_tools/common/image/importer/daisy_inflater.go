@@ -109,6 +109,11 @@ func newDaisyInflater(request ImageImportRequest, fileInspector imagefile.Inspec
 	if err != nil {
 		return nil, err
 	}
+	if isTarMember(request.Source) {
+		// The worker reads the file from the archive, so the archive isn't
+		// copied to the workflow's sources.
+		delete(wf.Sources, "source_disk_file")
+	}
 
 	for k, v := range vars {
 		wf.AddVar(k, v)
@@ -170,6 +175,12 @@ func createDaisyVarsForFile(request ImageImportRequest,
 		"import_subnet":    request.Subnet,
 		"disk_name":        diskName,
 	}
+	tarMember, inArchive := request.Source.(tarMemberSource)
+	if inArchive {
+		for k, v := range tarMember.daisyVars() {
+			vars[k] = v
+		}
+	}
 
 	if request.ComputeServiceAccount != "" {
 		vars["compute_service_account"] = request.ComputeServiceAccount
@@ -181,7 +192,13 @@ func createDaisyVarsForFile(request ImageImportRequest,
 	// a padding factor to account for filesystem overhead.
 	deadline, cancelFunc := context.WithDeadline(context.Background(), time.Now().Add(inspectionTimeout))
 	defer cancelFunc()
-	metadata, err := fileInspector.Inspect(deadline, request.Source.Path())
+	var metadata imagefile.Metadata
+	var err error
+	if inArchive {
+		metadata, err = tarMember.inspect()
+	} else {
+		metadata, err = fileInspector.Inspect(deadline, request.Source.Path())
+	}
 	if err == nil {
 		vars["inflated_disk_size_gb"] = fmt.Sprintf("%d", calculateInflatedSize(metadata))
 		vars["scratch_disk_size_gb"] = fmt.Sprintf("%d", calculateScratchDiskSize(metadata))
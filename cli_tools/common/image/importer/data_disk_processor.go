@@ -22,6 +22,9 @@ import (
 	daisyCompute "github.com/GoogleCloudPlatform/compute-image-tools/daisy/compute"
 )
 
+// dataDiskLicense is added to images of data disks.
+const dataDiskLicense = "projects/compute-image-tools/global/licenses/virtual-disk-import"
+
 type dataDiskProcessor struct {
 	computeImageClient daisyCompute.Client
 	project            string
@@ -50,7 +53,7 @@ func newDataDiskProcessor(pd persistentDisk, client daisyCompute.Client, project
 			Name:             imageName,
 			SourceDisk:       pd.uri,
 			StorageLocations: storageLocation,
-			Licenses:         []string{"projects/compute-image-tools/global/licenses/virtual-disk-import"},
+			Licenses:         []string{dataDiskLicense},
 		},
 	}
 }
@@ -16,6 +16,7 @@ package importer
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"path"
 	"sync"
@@ -46,29 +47,68 @@ func NewImporter(request ImageImportRequest, computeClient compute.Client, stora
 		return nil, err
 	}
 
-	inflater, err := newInflater(request, computeClient, storageClient, imagefile.NewGCSInspector(), logger)
+	inspector, err := disk.NewInspector(request.EnvironmentSettings(), logger)
 	if err != nil {
 		return nil, err
 	}
 
-	inspector, err := disk.NewInspector(request.EnvironmentSettings(), logger)
+	i, err := newImporter(request, computeClient, storageClient, logger)
 	if err != nil {
 		return nil, err
 	}
+	request.Labels = i.labels
+	i.processorProvider = defaultProcessorProvider{
+		request,
+		computeClient,
+		newProcessPlanner(request, inspector, logger),
+		logger,
+	}
+	return i, nil
+}
+
+// NewFileInspector returns the inspector of the request's source file.
+func NewFileInspector(request ImageImportRequest, storageClient domain.StorageClientInterface) imagefile.Inspector {
+	if request.InspectHeaders {
+		return imagefile.NewGCSHeaderInspector(storageClient)
+	}
+	return imagefile.NewGCSInspector()
+}
+
+// newImporter constructs an importer of a validated request, without its
+// processorProvider. When the request verifies integrity, the importer's
+// labels are a copy of the request's, which the processors need to use.
+func newImporter(request ImageImportRequest, computeClient compute.Client, storageClient domain.StorageClientInterface, logger logging.Logger) (*importer, error) {
+	inflater, err := newInflater(request, computeClient, storageClient, NewFileInspector(request, storageClient), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var checker integrityChecker
+	var writer provenanceWriter
+	if request.VerifyIntegrity {
+		// The hash is added to the labels after the disk is verified, so
+		// the processors are given a map that the importer can update.
+		labels := map[string]string{}
+		for k, v := range request.Labels {
+			labels[k] = v
+		}
+		request.Labels = labels
+		checker = newWorkerIntegrityChecker(request, logger)
+		if writer, err = newProvenanceWriter(request, storageClient, computeClient, logger); err != nil {
+			return nil, err
+		}
+	}
 	return &importer{
-		project:      request.Project,
-		zone:         request.Zone,
-		timeout:      request.Timeout,
-		preValidator: newPreValidator(request, computeClient),
-		inflater:     inflater,
-		processorProvider: defaultProcessorProvider{
-			request,
-			computeClient,
-			newProcessPlanner(request, inspector, logger),
-			logger,
-		},
-		diskClient: computeClient,
-		logger:     logger,
+		project:          request.Project,
+		zone:             request.Zone,
+		timeout:          request.Timeout,
+		preValidator:     newPreValidator(request, computeClient),
+		inflater:         inflater,
+		diskClient:       computeClient,
+		integrityChecker: checker,
+		provenanceWriter: writer,
+		labels:           request.Labels,
+		logger:           logger,
 	}, nil
 }
 
@@ -81,6 +121,10 @@ type importer struct {
 	inflater          Inflater
 	processorProvider processorProvider
 	diskClient        diskClient
+	integrityChecker  integrityChecker
+	integrity         integrityReport
+	provenanceWriter  provenanceWriter
+	labels            map[string]string
 	logger            logging.Logger
 	timeout           time.Duration
 }
@@ -101,12 +145,31 @@ func (i *importer) Run(ctx context.Context) error {
 		return err
 	}
 
+	if i.integrityChecker != nil {
+		if err := i.runIntegrityCheck(ctx); err != nil {
+			return err
+		}
+	}
+
 	err := i.runProcess(ctx)
 	if err != nil {
 		return err
 	}
 
-	return err
+	i.writeProvenance()
+	return nil
+}
+
+// writeProvenance writes the provenance record of the image, if requested.
+// The image passed the integrity check by then and is kept, so a record that
+// can't be written is logged as a warning instead of failing the import.
+func (i *importer) writeProvenance() {
+	if i.provenanceWriter == nil {
+		return
+	}
+	if err := i.provenanceWriter.write(i.integrity); err != nil {
+		i.logger.User(fmt.Sprintf("Warning: the image was imported, but its provenance record wasn't written: %v", err))
+	}
 }
 
 func (i *importer) runInflate(ctx context.Context) (err error) {
@@ -124,6 +187,28 @@ func (i *importer) runInflate(ctx context.Context) (err error) {
 	}, i.inflater.Cancel)
 }
 
+// runIntegrityCheck fails the import when the inflated disk doesn't have the
+// content of the source file.
+func (i *importer) runIntegrityCheck(ctx context.Context) error {
+	return i.runStep(ctx, func() error {
+		report, err := i.integrityChecker.check(ctx, i.pd)
+		if err != nil {
+			return err
+		}
+		if !report.matches() {
+			return daisy.Errf("The imported disk doesn't match the source file. "+
+				"SHA-256 of the source file's disk: %q, SHA-256 of the imported disk: %q",
+				report.sourceSHA256, report.diskSHA256)
+		}
+		i.logger.User("The disk matches the source file, with SHA-256 " + report.sourceSHA256)
+		i.integrity = report
+		for k, v := range report.labels() {
+			i.labels[k] = v
+		}
+		return nil
+	}, i.integrityChecker.cancel)
+}
+
 func (i *importer) runProcess(ctx context.Context) error {
 	processors, err := i.processorProvider.provide(i.pd)
 	if err != nil {
@@ -30,10 +30,20 @@ import (
 	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
 
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/imagefile"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/mocks"
 	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
 )
 
+func TestNewFileInspector_DefaultsToQemuInspector(t *testing.T) {
+	assert.IsType(t, imagefile.NewGCSInspector(), NewFileInspector(ImageImportRequest{}, nil))
+}
+
+func TestNewFileInspector_UsesHeaderInspector_WhenInspectHeaders(t *testing.T) {
+	assert.IsType(t, imagefile.NewGCSHeaderInspector(nil),
+		NewFileInspector(ImageImportRequest{InspectHeaders: true}, nil))
+}
+
 func TestRun_HappyCase_CollectDiskMetrics(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -222,6 +232,91 @@ func TestRun_DontRunProcessIfInflateFails(t *testing.T) {
 	assert.Equal(t, 0, mockProcessorProvider.interactions)
 }
 
+func TestRun_DontRunProcessIfIntegrityCheckFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockProcessorProvider := &mockProcessorProvider{}
+	mockProvenanceWriter := &mockProvenanceWriter{}
+	importer := importer{
+		preValidator:      mockValidator{},
+		inflater:          &mockInflater{},
+		processorProvider: mockProcessorProvider,
+		integrityChecker: &mockIntegrityChecker{report: integrityReport{
+			sourceSHA256: sha256Of("source"),
+			diskSHA256:   sha256Of("disk"),
+		}},
+		provenanceWriter: mockProvenanceWriter,
+		labels:           map[string]string{},
+		logger:           mockLogger,
+	}
+	actualError := importer.Run(context.Background())
+	assert.EqualError(t, actualError, fmt.Sprintf("The imported disk doesn't match the source file. "+
+		"SHA-256 of the source file's disk: %q, SHA-256 of the imported disk: %q", sha256Of("source"), sha256Of("disk")))
+	assert.Equal(t, 0, mockProcessorProvider.interactions)
+	assert.Equal(t, 0, mockProvenanceWriter.interactions)
+	assert.Empty(t, importer.labels)
+}
+
+func TestRun_LabelsImageAndWritesProvenance_WhenIntegrityCheckPasses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockLogger.EXPECT().User("The disk matches the source file, with SHA-256 " + sha256Of("source"))
+	report := integrityReport{
+		sourceSizeBytes: 1024,
+		sourceSHA256:    sha256Of("source"),
+		diskSHA256:      sha256Of("source"),
+	}
+	labels := map[string]string{"env": "test"}
+	mockProcessor := mockProcessor{}
+	mockProvenanceWriter := &mockProvenanceWriter{}
+	importer := importer{
+		preValidator: mockValidator{},
+		inflater:     &mockInflater{},
+		processorProvider: &mockProcessorProvider{
+			processors: []processor{&mockProcessor},
+		},
+		integrityChecker: &mockIntegrityChecker{report: report},
+		provenanceWriter: mockProvenanceWriter,
+		labels:           labels,
+		logger:           mockLogger,
+	}
+	assert.NoError(t, importer.Run(context.Background()))
+	assert.Equal(t, 1, mockProcessor.interactions)
+	assert.Equal(t, 1, mockProvenanceWriter.interactions)
+	assert.Equal(t, report, mockProvenanceWriter.report)
+	assert.Equal(t, map[string]string{
+		"env":             "test",
+		sourceSHA256Label: sha256Of("source")[:32],
+	}, labels)
+}
+
+func TestRun_WarnsButSucceeds_WhenProvenanceCantBeWritten(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockLogger := mocks.NewMockLogger(ctrl)
+	mockLogger.EXPECT().User("The disk matches the source file, with SHA-256 " + sha256Of("source"))
+	mockLogger.EXPECT().User("Warning: the image was imported, but its provenance record wasn't written: bucket not found")
+	mockProcessor := mockProcessor{}
+	importer := importer{
+		preValidator: mockValidator{},
+		inflater:     &mockInflater{},
+		processorProvider: &mockProcessorProvider{
+			processors: []processor{&mockProcessor},
+		},
+		integrityChecker: &mockIntegrityChecker{report: integrityReport{
+			sourceSHA256: sha256Of("source"),
+			diskSHA256:   sha256Of("source"),
+		}},
+		provenanceWriter: &mockProvenanceWriter{err: errors.New("bucket not found")},
+		labels:           map[string]string{},
+		logger:           mockLogger,
+	}
+	assert.NoError(t, importer.Run(context.Background()))
+	assert.Equal(t, 1, mockProcessor.interactions)
+}
+
 func TestRun_IncludeInflaterLogs_WhenFailureToCreateProcessor(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -527,6 +622,33 @@ func (m *mockInflater) Cancel(reason string) bool {
 	return true
 }
 
+type mockIntegrityChecker struct {
+	report       integrityReport
+	err          error
+	interactions int
+}
+
+func (m *mockIntegrityChecker) check(ctx context.Context, pd persistentDisk) (integrityReport, error) {
+	m.interactions++
+	return m.report, m.err
+}
+
+func (m *mockIntegrityChecker) cancel(reason string) bool {
+	return true
+}
+
+type mockProvenanceWriter struct {
+	report       integrityReport
+	err          error
+	interactions int
+}
+
+func (m *mockProvenanceWriter) write(report integrityReport) error {
+	m.interactions++
+	m.report = report
+	return m.err
+}
+
 type mockDiskClient struct {
 	interactions                 int
 	project, zone, uri, diskName string
@@ -52,26 +52,70 @@ func newInflater(request ImageImportRequest, computeClient daisyCompute.Client,
 		return nil, err
 	}
 
-	// This boolean switch controls whether native PD inflation is used, either
-	// as the primary inflation method or in a shadow test mode
-	tryNativePDInflation := true
-	if isImage(request.Source) || !tryNativePDInflation {
-		return di, nil
-	}
-
-	if isShadowTestFormat(request) {
+	switch chooseInflationMethod(request) {
+	case shadowTestInflation:
 		return &shadowTestInflaterFacade{
 			mainInflater:   di,
 			shadowInflater: createAPIInflater(request, computeClient, storageClient, logger, true),
 			logger:         logger,
 		}, nil
+	case fallbackInflation:
+		return &inflaterFacade{
+			apiInflater:   createAPIInflater(request, computeClient, storageClient, logger, false),
+			daisyInflater: di,
+			logger:        logger,
+		}, nil
+	default:
+		return di, nil
+	}
+}
+
+// inflationMethod is how the disk is created from a request's source.
+type inflationMethod int
+
+const (
+	// daisyInflation uses a Daisy workflow.
+	daisyInflation inflationMethod = iota
+	// shadowTestInflation uses a Daisy workflow, and compares its disk with
+	// one that's created by the Compute Engine API.
+	shadowTestInflation
+	// fallbackInflation uses the Compute Engine API, and falls back to a
+	// Daisy workflow when the API doesn't support the file's format.
+	fallbackInflation
+)
+
+// chooseInflationMethod returns the inflation method of request. Both
+// newInflater and PreviewImport use it, so that a preview matches the import.
+func chooseInflationMethod(request ImageImportRequest) inflationMethod {
+	// This boolean switch controls whether native PD inflation is used, either
+	// as the primary inflation method or in a shadow test mode. Files of
+	// archives are only inflated by daisy, since the API reads whole objects.
+	tryNativePDInflation := true
+	if isImage(request.Source) || isTarMember(request.Source) || !tryNativePDInflation {
+		return daisyInflation
 	}
+	if isShadowTestFormat(request) {
+		return shadowTestInflation
+	}
+	return fallbackInflation
+}
 
-	return &inflaterFacade{
-		apiInflater:   createAPIInflater(request, computeClient, storageClient, logger, false),
-		daisyInflater: di,
-		logger:        logger,
-	}, nil
+// describe returns a description of the method for users.
+func (method inflationMethod) describe(request ImageImportRequest) string {
+	workflow := inflateFilePath
+	if isImage(request.Source) {
+		workflow = inflateImagePath
+	}
+	switch method {
+	case shadowTestInflation:
+		return "Daisy workflow " + workflow +
+			", compared with the Compute Engine API's inflation of the file as a test"
+	case fallbackInflation:
+		return "Compute Engine API, or Daisy workflow " + workflow +
+			" when the API doesn't support the file's format"
+	default:
+		return "Daisy workflow " + workflow
+	}
 }
 
 func isShadowTestFormat(request ImageImportRequest) bool {
@@ -0,0 +1,240 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"strconv"
+
+	"google.golang.org/api/compute/v1"
+
+	daisyUtils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/daisy"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	string_utils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/string"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+// integrityChecker hashes the disk of the source file, and the disk that was
+// inflated from it, before the disk is translated.
+type integrityChecker interface {
+	check(ctx context.Context, pd persistentDisk) (integrityReport, error)
+	cancel(reason string) bool
+}
+
+// integrityReport has the SHA-256 of the source file's disk, as it's read by
+// qemu, and of the same number of bytes at the start of the inflated disk.
+type integrityReport struct {
+	sourceSizeBytes int64
+	sourceSHA256    string
+	diskSHA256      string
+}
+
+func (r integrityReport) matches() bool {
+	return len(r.sourceSHA256) == 2*sha256.Size && r.sourceSHA256 == r.diskSHA256
+}
+
+// sourceSHA256Label is added to images whose disk was verified. Label values
+// are limited to 63 characters, so it has the first half of the hash; the
+// provenance record has all of it.
+const sourceSHA256Label = "gce-image-import-source-sha256"
+
+// labels returns the labels of the image of a verified disk.
+func (r integrityReport) labels() map[string]string {
+	return map[string]string{sourceSHA256Label: r.sourceSHA256[:sha256.Size]}
+}
+
+// workerIntegrityChecker hashes the disks on a worker instance, which
+// copies the source file to a scratch disk and reads it with qemu-nbd.
+type workerIntegrityChecker struct {
+	request ImageImportRequest
+	wf      *daisy.Workflow
+	logger  logging.Logger
+}
+
+func newWorkerIntegrityChecker(request ImageImportRequest, logger logging.Logger) *workerIntegrityChecker {
+	return &workerIntegrityChecker{
+		request: request,
+		wf:      newIntegrityWorkflow(request),
+		logger:  logger,
+	}
+}
+
+func (c *workerIntegrityChecker) check(ctx context.Context, pd persistentDisk) (integrityReport, error) {
+	c.logger.User("Verifying that the disk matches " + c.request.Source.Path())
+	// Like import_image.sh, the scratch disk has 10% more capacity than the
+	// file, for the file system's overhead.
+	sourceGb := pd.sourceGb
+	if sourceGb <= 0 {
+		sourceGb = defaultInflationDiskSizeGB
+	}
+	c.wf.AddVar("scratch_disk_size_gb", strconv.FormatInt(sourceGb*11/10+1, 10))
+	c.wf.AddVar("inflated_disk", pd.uri)
+	err := daisyUtils.RunWorkflowWithCancelSignal(ctx, c.wf)
+	if c.wf.Logger != nil {
+		for _, trace := range c.wf.Logger.ReadSerialPortLogs() {
+			c.logger.Trace(trace)
+		}
+	}
+	if err != nil {
+		return integrityReport{}, daisy.Errf("Failed to verify the disk: %v", err)
+	}
+	return integrityReport{
+		sourceSizeBytes: string_utils.SafeStringToInt(c.wf.GetSerialConsoleOutputValue("source-size-bytes")),
+		sourceSHA256:    c.wf.GetSerialConsoleOutputValue("source-sha256"),
+		diskSHA256:      c.wf.GetSerialConsoleOutputValue("disk-sha256"),
+	}, nil
+}
+
+func (c *workerIntegrityChecker) cancel(reason string) bool {
+	c.wf.CancelWithReason(reason)
+	return true
+}
+
+func newIntegrityWorkflow(request ImageImportRequest) *daisy.Workflow {
+	w := daisy.New()
+	w.Name = "verify-integrity"
+	if request.DaisyLogLinePrefix != "" {
+		w.Name = request.DaisyLogLinePrefix + "-" + w.Name
+	}
+	script := integrityScript
+	sourceFile := request.Source.Path()
+	w.Steps = map[string]*daisy.Step{
+		"create-disks": {
+			CreateDisks: &daisy.CreateDisks{
+				{
+					Disk: compute.Disk{
+						Name:        "disk-${NAME}",
+						SourceImage: "projects/compute-image-tools/global/images/family/debian-9-worker",
+						Type:        "pd-ssd",
+					},
+					FallbackToPdStandard: true,
+				},
+				{
+					Disk: compute.Disk{
+						Name: "disk-${NAME}-scratch",
+						Type: "pd-ssd",
+					},
+					SizeGb:               "${scratch_disk_size_gb}",
+					FallbackToPdStandard: true,
+				},
+			},
+		},
+		"create-instance": {
+			CreateInstances: &daisy.CreateInstances{
+				Instances: []*daisy.Instance{
+					{
+						Instance: compute.Instance{
+							Name: "inst-${NAME}",
+							Disks: []*compute.AttachedDisk{
+								{Source: "disk-${NAME}"},
+								{Source: "disk-${NAME}-scratch"},
+								{Source: "${inflated_disk}", Mode: "READ_ONLY"},
+							},
+							MachineType: "n1-highcpu-4",
+							Metadata: &compute.Metadata{
+								Items: []*compute.MetadataItems{
+									{Key: "startup-script", Value: &script},
+									{Key: "source_file", Value: &sourceFile},
+								},
+							},
+							NetworkInterfaces: []*compute.NetworkInterface{
+								{
+									AccessConfigs: []*compute.AccessConfig{},
+								},
+							},
+							ServiceAccounts: []*compute.ServiceAccount{
+								{
+									Email:  "${compute_service_account}",
+									Scopes: []string{"https://www.googleapis.com/auth/devstorage.read_only"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"wait-for-hashes": {
+			WaitForInstancesSignal: &daisy.WaitForInstancesSignal{
+				{
+					Name: "inst-${NAME}",
+					SerialOutput: &daisy.SerialOutput{
+						Port:         1,
+						SuccessMatch: "IntegritySuccess:",
+						FailureMatch: []string{"IntegrityFailed:"},
+						StatusMatch:  "Integrity:",
+					},
+				},
+			},
+		},
+	}
+	w.Dependencies = map[string][]string{
+		"create-instance": {"create-disks"},
+		"wait-for-hashes": {"create-instance"},
+	}
+
+	request.EnvironmentSettings().ApplyToWorkflow(w)
+	daisyUtils.UpdateAllInstanceNoExternalIP(w, request.NoExternalIP)
+	computeServiceAccount := "default"
+	if request.ComputeServiceAccount != "" {
+		computeServiceAccount = request.ComputeServiceAccount
+	}
+	w.AddVar("compute_service_account", computeServiceAccount)
+	return w
+}
+
+// integrityScript runs on the worker, where the scratch disk is sdb and the
+// inflated disk is sdc.
+const integrityScript = `#!/bin/bash
+set -o pipefail
+
+function serialOutputPrefixedKeyValue() {
+  stdbuf -oL echo "$1: <serial-output key:'$2' value:'$3'>"
+}
+
+SOURCE_URL="$(curl -f -H Metadata-Flavor:Google http://metadata/computeMetadata/v1/instance/attributes/source_file)"
+SOURCE_PATH=/daisy-scratch/source
+
+mkfs.ext4 -m 0 /dev/sdb && mkdir -p /daisy-scratch && mount /dev/sdb /daisy-scratch
+if [[ $? -ne 0 ]]; then
+  echo "IntegrityFailed: Failed to prepare scratch disk."
+  exit
+fi
+if ! gsutil -q cp "${SOURCE_URL}" "${SOURCE_PATH}"; then
+  echo "IntegrityFailed: Failed to download the source file to the worker instance."
+  exit
+fi
+echo "Integrity: Downloaded the source file."
+
+modprobe nbd
+if ! qemu-nbd --read-only --connect=/dev/nbd0 "${SOURCE_PATH}"; then
+  echo "IntegrityFailed: qemu can't read the source file."
+  exit
+fi
+udevadm settle
+SOURCE_SIZE_BYTES=$(blockdev --getsize64 /dev/nbd0)
+SOURCE_SHA256=$(sha256sum /dev/nbd0 | cut -d' ' -f1)
+qemu-nbd --disconnect /dev/nbd0
+echo "Integrity: Hashed the source file's disk."
+
+DISK_SHA256=$(head -c "${SOURCE_SIZE_BYTES}" /dev/sdc | sha256sum | cut -d' ' -f1)
+if [[ $? -ne 0 ]]; then
+  echo "IntegrityFailed: Failed to read the imported disk."
+  exit
+fi
+serialOutputPrefixedKeyValue "Integrity" "source-size-bytes" "${SOURCE_SIZE_BYTES}"
+serialOutputPrefixedKeyValue "Integrity" "source-sha256" "${SOURCE_SHA256}"
+serialOutputPrefixedKeyValue "Integrity" "disk-sha256" "${DISK_SHA256}"
+echo "IntegritySuccess: Hashed the disks."`
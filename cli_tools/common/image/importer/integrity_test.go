@@ -0,0 +1,85 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+func sha256Of(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestIntegrityReport_Matches(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		report   integrityReport
+		expected bool
+	}{
+		{"same hashes", integrityReport{sourceSHA256: sha256Of("a"), diskSHA256: sha256Of("a")}, true},
+		{"different hashes", integrityReport{sourceSHA256: sha256Of("a"), diskSHA256: sha256Of("b")}, false},
+		{"no hashes", integrityReport{}, false},
+		{"truncated hashes", integrityReport{sourceSHA256: "abc", diskSHA256: "abc"}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.report.matches())
+		})
+	}
+}
+
+func TestIntegrityReport_Labels(t *testing.T) {
+	report := integrityReport{sourceSHA256: sha256Of("a"), diskSHA256: sha256Of("a")}
+	labels := report.labels()
+	assert.Equal(t, map[string]string{sourceSHA256Label: sha256Of("a")[:32]}, labels)
+	assert.True(t, len(labels[sourceSHA256Label]) <= 63)
+}
+
+func TestNewIntegrityWorkflow(t *testing.T) {
+	request := makeValidRequest()
+	request.Source = fileSource{gcsPath: "gs://bucket/disk.vmdk"}
+	request.DaisyLogLinePrefix = "disk-1"
+	request.ComputeServiceAccount = "account@project.iam.gserviceaccount.com"
+	request.NoExternalIP = true
+
+	wf := newIntegrityWorkflow(request)
+	assert.Equal(t, "disk-1-verify-integrity", wf.Name)
+	assert.Equal(t, request.Project, wf.Project)
+	assert.Equal(t, request.Zone, wf.Zone)
+	assert.Equal(t, "account@project.iam.gserviceaccount.com", wf.Vars["compute_service_account"].Value)
+
+	instance := wf.Steps["create-instance"].CreateInstances.Instances[0]
+	assert.Equal(t, "${inflated_disk}", instance.Disks[2].Source)
+	assert.Equal(t, "READ_ONLY", instance.Disks[2].Mode)
+	metadata := map[string]string{}
+	for _, item := range instance.Instance.Metadata.Items {
+		metadata[item.Key] = *item.Value
+	}
+	assert.Equal(t, "gs://bucket/disk.vmdk", metadata["source_file"])
+	assert.Equal(t, integrityScript, metadata["startup-script"])
+	assert.Empty(t, instance.NetworkInterfaces[0].AccessConfigs)
+
+	signal := (*wf.Steps["wait-for-hashes"].WaitForInstancesSignal)[0]
+	assert.Equal(t, "IntegritySuccess:", signal.SerialOutput.SuccessMatch)
+	assert.Equal(t, daisy.FailureMatches{"IntegrityFailed:"}, signal.SerialOutput.FailureMatch)
+	assert.Equal(t, "Integrity:", signal.SerialOutput.StatusMatch)
+	assert.Equal(t, []string{"create-instance"}, wf.Dependencies["wait-for-hashes"])
+}
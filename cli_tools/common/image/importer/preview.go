@@ -0,0 +1,134 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/imagefile"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+)
+
+// ImportPreview describes what an import would do.
+type ImportPreview struct {
+	Source string
+
+	// FileFormat, PhysicalSizeGB, and DiskSizeGB are empty when the source
+	// is an image, or when the file couldn't be inspected.
+	FileFormat     string
+	PhysicalSizeGB int64
+	DiskSizeGB     int64
+
+	// Inflation describes how the disk is created from the source.
+	Inflation string
+
+	// OS, TranslationWorkflowPath, Licenses, and GuestOsFeatures are empty
+	// when they depend on the OS that's detected during import.
+	OS                      string
+	TranslationWorkflowPath string
+	Licenses                []string
+	GuestOsFeatures         []string
+
+	// Notes explain the values that can't be determined before import.
+	Notes []string
+}
+
+// String formats the preview for users.
+func (p ImportPreview) String() string {
+	var b strings.Builder
+	line := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%-22s %s\n", label+":", value)
+		}
+	}
+	gb := func(size int64) string {
+		if size == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%d GB", size)
+	}
+	line("Source", p.Source)
+	line("File format", p.FileFormat)
+	line("File size", gb(p.PhysicalSizeGB))
+	line("Disk size", gb(p.DiskSizeGB))
+	line("Inflation", p.Inflation)
+	line("OS", p.OS)
+	line("Translation workflow", p.TranslationWorkflowPath)
+	line("Licenses", strings.Join(p.Licenses, ", "))
+	line("Guest OS features", strings.Join(p.GuestOsFeatures, ", "))
+	for _, note := range p.Notes {
+		fmt.Fprintf(&b, "Note: %s\n", note)
+	}
+	return b.String()
+}
+
+// PreviewImport determines what an import of request would do, using the
+// same inflation and processing decisions as Importer, without creating
+// any resources. Disk inspection requires a disk, so the OS is only
+// known when it's specified by the request.
+func PreviewImport(ctx context.Context, request ImageImportRequest, fileInspector imagefile.Inspector,
+	logger logging.Logger) (ImportPreview, error) {
+
+	if err := request.validate(); err != nil {
+		return ImportPreview{}, err
+	}
+	preview := ImportPreview{
+		Source:    request.Source.Path(),
+		Inflation: chooseInflationMethod(request).describe(request),
+	}
+
+	switch {
+	case isImage(request.Source):
+		// Images aren't inspected.
+	case IsRemoteSource(request.Source):
+		preview.Notes = append(preview.Notes,
+			"The file is copied to the scratch bucket, and inspected, when the import runs.")
+	default:
+		deadline, cancelFunc := context.WithDeadline(ctx, time.Now().Add(inspectionTimeout))
+		defer cancelFunc()
+		metadata, err := fileInspector.Inspect(deadline, request.Source.Path())
+		if err != nil {
+			logger.Debug(fmt.Sprintf("File inspection error=%v", err))
+			preview.Notes = append(preview.Notes, "The file's format and size couldn't be determined.")
+			break
+		}
+		preview.FileFormat = metadata.FileFormat
+		preview.PhysicalSizeGB = metadata.PhysicalSizeGB
+		preview.DiskSizeGB = calculateInflatedSize(metadata)
+	}
+
+	switch {
+	case request.DataDisk:
+		preview.Licenses = []string{dataDiskLicense}
+	case request.OS == "" && request.CustomWorkflow == "":
+		preview.Notes = append(preview.Notes, "The OS is detected after the disk is created. "+
+			"The translation workflow, licenses, and guest OS features depend on the detected OS.")
+	default:
+		plan, err := newProcessPlanner(request, nil, logger).plan(persistentDisk{})
+		if err != nil {
+			return preview, err
+		}
+		preview.OS = request.OS
+		preview.TranslationWorkflowPath = plan.translationWorkflowPath
+		preview.Licenses = plan.requiredLicenses
+		for _, feature := range plan.requiredFeatures {
+			preview.GuestOsFeatures = append(preview.GuestOsFeatures, feature.Type)
+		}
+	}
+	return preview, nil
+}
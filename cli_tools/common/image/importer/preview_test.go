@@ -0,0 +1,194 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/imagefile"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
+)
+
+func TestPreviewImport(t *testing.T) {
+	vmdk := fileSource{gcsPath: "gs://bucket/disk.vmdk"}
+	vmdkInspector := mockInspector{
+		expectedReference: vmdk.gcsPath,
+		metaToReturn:      imagefile.Metadata{PhysicalSizeGB: 3, VirtualSizeGB: 20, FileFormat: "vmdk"},
+	}
+	fileInflation := "Daisy workflow image_import/inflate_file.wf.json, " +
+		"compared with the Compute Engine API's inflation of the file as a test"
+	for _, tt := range []struct {
+		name      string
+		setup     func(request *ImageImportRequest)
+		inspector mockInspector
+		expected  ImportPreview
+	}{
+		{
+			name: "file with os",
+			setup: func(request *ImageImportRequest) {
+				request.Source = vmdk
+				request.OS = "ubuntu-1804"
+				request.UefiCompatible = true
+			},
+			inspector: vmdkInspector,
+			expected: ImportPreview{
+				Source:                  vmdk.gcsPath,
+				FileFormat:              "vmdk",
+				PhysicalSizeGB:          3,
+				DiskSizeGB:              20,
+				Inflation:               fileInflation,
+				OS:                      "ubuntu-1804",
+				TranslationWorkflowPath: "path/to/workflows/image_import/ubuntu/translate_ubuntu_1804.wf.json",
+				Licenses:                []string{"projects/ubuntu-os-cloud/global/licenses/ubuntu-1804-lts"},
+				GuestOsFeatures:         []string{"UEFI_COMPATIBLE"},
+			},
+		},
+		{
+			name: "file that can't be inspected",
+			setup: func(request *ImageImportRequest) {
+				request.Source = vmdk
+				request.OS = "windows-2019"
+			},
+			inspector: mockInspector{expectedReference: vmdk.gcsPath, errorToReturn: errors.New("not found")},
+			expected: ImportPreview{
+				Source:                  vmdk.gcsPath,
+				Inflation:               fileInflation,
+				OS:                      "windows-2019",
+				TranslationWorkflowPath: "path/to/workflows/image_import/windows/translate_windows_2019.wf.json",
+				Licenses:                []string{"projects/windows-cloud/global/licenses/windows-server-2019-dc"},
+				GuestOsFeatures:         []string{"WINDOWS"},
+				Notes:                   []string{"The file's format and size couldn't be determined."},
+			},
+		},
+		{
+			name: "image with detected os",
+			setup: func(request *ImageImportRequest) {
+				request.Source = imageSource{uri: "global/images/source"}
+				request.OS = ""
+			},
+			expected: ImportPreview{
+				Source:    "global/images/source",
+				Inflation: "Daisy workflow image_import/inflate_image.wf.json",
+				Notes: []string{"The OS is detected after the disk is created. " +
+					"The translation workflow, licenses, and guest OS features depend on the detected OS."},
+			},
+		},
+		{
+			name: "remote file",
+			setup: func(request *ImageImportRequest) {
+				request.Source = httpSource{url: "https://example.com/disk.vmdk?signature=secret"}
+				request.OS = ""
+				request.CustomWorkflow = "translate.wf.json"
+			},
+			expected: ImportPreview{
+				Source:                  "https://example.com/disk.vmdk",
+				Inflation:               fileInflation,
+				TranslationWorkflowPath: "translate.wf.json",
+				Notes:                   []string{"The file is copied to the scratch bucket, and inspected, when the import runs."},
+			},
+		},
+		{
+			name: "data disk",
+			setup: func(request *ImageImportRequest) {
+				request.Source = vmdk
+				request.OS = ""
+				request.DataDisk = true
+			},
+			inspector: vmdkInspector,
+			expected: ImportPreview{
+				Source:         vmdk.gcsPath,
+				FileFormat:     "vmdk",
+				PhysicalSizeGB: 3,
+				DiskSizeGB:     20,
+				Inflation:      fileInflation,
+				Licenses:       []string{dataDiskLicense},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			request := makeValidRequest()
+			request.UefiCompatible = false
+			tt.setup(&request)
+			tt.inspector.t = t
+			actual, err := PreviewImport(context.Background(), request, tt.inspector, logging.NewToolLogger(t.Name()))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestPreviewImport_InflationMatchesInflater(t *testing.T) {
+	index, entry := createTestTarIndex()
+	tarMember, err := NewTarMemberSource(index, entry, createMockArchiveStorageClient(t, "disk content"))
+	assert.NoError(t, err)
+	for _, source := range []Source{
+		fileSource{gcsPath: "gs://bucket/disk.vmdk"},
+		imageSource{uri: "global/images/source"},
+		tarMember,
+	} {
+		t.Run(source.Path(), func(t *testing.T) {
+			request := makeValidRequest()
+			request.Source = source
+			request.WorkflowDir = daisyWorkflows
+			inspector := mockInspector{t: t, expectedReference: source.Path()}
+			inflater, err := newInflater(request, nil, &storage.Client{}, inspector, logging.NewToolLogger(t.Name()))
+			assert.NoError(t, err)
+			var method inflationMethod
+			switch inflater.(type) {
+			case *daisyInflater:
+				method = daisyInflation
+			case *shadowTestInflaterFacade:
+				method = shadowTestInflation
+			case *inflaterFacade:
+				method = fallbackInflation
+			default:
+				t.Fatalf("unexpected inflater %T", inflater)
+			}
+
+			preview, err := PreviewImport(context.Background(), request, inspector, logging.NewToolLogger(t.Name()))
+			assert.NoError(t, err)
+			assert.Equal(t, method.describe(request), preview.Inflation)
+		})
+	}
+}
+
+func TestPreviewImport_ValidatesRequest(t *testing.T) {
+	request := makeValidRequest()
+	request.ImageName = ""
+	_, err := PreviewImport(context.Background(), request, nil, logging.NewToolLogger(t.Name()))
+	assert.Error(t, err)
+}
+
+func TestImportPreview_String(t *testing.T) {
+	assert.Equal(t, `Source:                gs://bucket/disk.vmdk
+File format:           vmdk
+Disk size:             10 GB
+Inflation:             api
+Licenses:              license-1, license-2
+Note: note
+`, ImportPreview{
+		Source:     "gs://bucket/disk.vmdk",
+		FileFormat: "vmdk",
+		DiskSizeGB: 10,
+		Inflation:  "api",
+		Licenses:   []string{"license-1", "license-2"},
+		Notes:      []string{"note"},
+	}.String())
+}
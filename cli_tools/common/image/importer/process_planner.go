@@ -69,7 +69,12 @@ func (p *defaultPlanner) plan(pd persistentDisk) (*processingPlan, error) {
 		return &processingPlan{translationWorkflowPath: p.request.CustomWorkflow}, nil
 	}
 
-	inspectionResults, inspectionError := p.inspectDisk(pd.uri)
+	// Previews plan without a disk, so they don't inspect.
+	var inspectionResults *pb.InspectionResults
+	var inspectionError error
+	if p.diskInspector != nil {
+		inspectionResults, inspectionError = p.inspectDisk(pd.uri)
+	}
 	var detectedOs distro.Release
 	osID := p.request.OS
 	requiresUEFI := p.request.UefiCompatible
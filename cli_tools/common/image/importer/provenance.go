@@ -0,0 +1,253 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+const provenanceDir = "gce-image-import-provenance"
+
+// Signature algorithms of SignedProvenance.
+const (
+	SignatureECDSASHA256    = "ECDSA_SHA256"
+	SignatureED25519        = "ED25519"
+	SignatureRSAPKCS1SHA256 = "RSA_PKCS1_SHA256"
+)
+
+// ProvenanceRecord describes the file that an image was imported from, and
+// the hashes that show the image's disk has the file's content. Files outside
+// of Cloud Storage are recorded with their original URI and their ETag or
+// modification time as SourceVersion, rather than the copy that was imported.
+type ProvenanceRecord struct {
+	SourceURI        string    `json:"sourceUri"`
+	SourceGeneration int64     `json:"sourceGeneration"`
+	SourceVersion    string    `json:"sourceVersion,omitempty"`
+	SourceSizeBytes  int64     `json:"sourceSizeBytes"`
+	SourceSHA256     string    `json:"sourceSha256"`
+	DiskSHA256       string    `json:"diskSha256"`
+	ToolVersion      string    `json:"toolVersion"`
+	Image            string    `json:"image"`
+	Created          time.Time `json:"created"`
+}
+
+// SignedProvenance is the JSON file of a ProvenanceRecord. The signature is
+// of Record's bytes, so that it can be verified without re-encoding the
+// record. It's omitted when no signing key was given.
+type SignedProvenance struct {
+	Record             json.RawMessage `json:"record"`
+	SignatureAlgorithm string          `json:"signatureAlgorithm,omitempty"`
+	Signature          []byte          `json:"signature,omitempty"`
+}
+
+// VerifyProvenance parses a SignedProvenance file, and checks its signature
+// with publicKey.
+func VerifyProvenance(file []byte, publicKey crypto.PublicKey) (ProvenanceRecord, error) {
+	var signed SignedProvenance
+	if err := json.Unmarshal(file, &signed); err != nil {
+		return ProvenanceRecord{}, err
+	}
+	if len(signed.Signature) == 0 {
+		return ProvenanceRecord{}, errors.New("provenance record isn't signed")
+	}
+	digest := sha256.Sum256(signed.Record)
+	var valid bool
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		var sig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(signed.Signature, &sig); err == nil {
+			valid = signed.SignatureAlgorithm == SignatureECDSASHA256 && ecdsa.Verify(key, digest[:], sig.R, sig.S)
+		}
+	case ed25519.PublicKey:
+		valid = signed.SignatureAlgorithm == SignatureED25519 && ed25519.Verify(key, signed.Record, signed.Signature)
+	case *rsa.PublicKey:
+		valid = signed.SignatureAlgorithm == SignatureRSAPKCS1SHA256 &&
+			rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signed.Signature) == nil
+	default:
+		return ProvenanceRecord{}, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	if !valid {
+		return ProvenanceRecord{}, errors.New("provenance record's signature is invalid")
+	}
+	var record ProvenanceRecord
+	return record, json.Unmarshal(signed.Record, &record)
+}
+
+// signProvenance encodes record, and signs it when key isn't nil.
+func signProvenance(record ProvenanceRecord, key crypto.Signer) (SignedProvenance, error) {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return SignedProvenance{}, err
+	}
+	signed := SignedProvenance{Record: encoded}
+	if key == nil {
+		return signed, nil
+	}
+	digest := sha256.Sum256(encoded)
+	switch key.Public().(type) {
+	case *ecdsa.PublicKey:
+		signed.SignatureAlgorithm = SignatureECDSASHA256
+		signed.Signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case ed25519.PublicKey:
+		signed.SignatureAlgorithm = SignatureED25519
+		signed.Signature, err = key.Sign(rand.Reader, encoded, crypto.Hash(0))
+	case *rsa.PublicKey:
+		signed.SignatureAlgorithm = SignatureRSAPKCS1SHA256
+		signed.Signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	default:
+		return SignedProvenance{}, fmt.Errorf("unsupported signing key type %T", key.Public())
+	}
+	return signed, err
+}
+
+// loadSigningKey reads a PEM-encoded PKCS #8 private key.
+func loadSigningKey(filename string) (crypto.Signer, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%q isn't a PEM file", filename)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%q isn't a PKCS #8 private key: %w", filename, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%q has an unsupported key type %T", filename, key)
+	}
+	return signer, nil
+}
+
+// provenancePath is where the provenance record of an import is written,
+// when the request doesn't set it.
+func provenancePath(request ImageImportRequest) string {
+	if request.ProvenanceGcsPath != "" {
+		return request.ProvenanceGcsPath
+	}
+	bucket, err := storage.GetBucketNameFromGCSPath(request.ScratchBucketGcsPath)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("gs://%s/%s/%s.json", bucket, provenanceDir, request.ImageName)
+}
+
+// provenanceWriter writes the provenance record of an imported image.
+type provenanceWriter interface {
+	write(report integrityReport) error
+}
+
+// gcsProvenanceWriter writes provenance records to Cloud Storage.
+type gcsProvenanceWriter struct {
+	request       ImageImportRequest
+	storageClient domain.StorageClientInterface
+	imageClient   imageGetter
+	signingKey    crypto.Signer
+	logger        logging.Logger
+}
+
+type imageGetter interface {
+	GetImage(project, name string) (*compute.Image, error)
+}
+
+func newProvenanceWriter(request ImageImportRequest, storageClient domain.StorageClientInterface,
+	imageClient imageGetter, logger logging.Logger) (*gcsProvenanceWriter, error) {
+	writer := &gcsProvenanceWriter{
+		request:       request,
+		storageClient: storageClient,
+		imageClient:   imageClient,
+		logger:        logger,
+	}
+	if request.ProvenanceSigningKey != "" {
+		var err error
+		if writer.signingKey, err = loadSigningKey(request.ProvenanceSigningKey); err != nil {
+			return nil, daisy.Errf("Failed to load -%s: %v", ProvenanceSigningKeyFlag, err)
+		}
+	}
+	return writer, nil
+}
+
+func (w *gcsProvenanceWriter) write(report integrityReport) error {
+	record := ProvenanceRecord{
+		SourceURI:       w.request.Source.Path(),
+		SourceSizeBytes: report.sourceSizeBytes,
+		SourceSHA256:    report.sourceSHA256,
+		DiskSHA256:      report.diskSHA256,
+		ToolVersion:     w.request.ToolVersion,
+		Created:         time.Now().UTC(),
+	}
+	// The staged copy of a remote source is deleted once the import ends.
+	if file, ok := w.request.Source.(fileSource); ok && file.origin != "" {
+		record.SourceURI, record.SourceVersion = file.origin, file.originVersion
+	} else {
+		sourceBucket, sourceObject, err := storage.GetGCSObjectPathElements(w.request.Source.Path())
+		if err != nil {
+			return err
+		}
+		attrs, err := w.storageClient.GetObjectAttrs(sourceBucket, sourceObject)
+		if err != nil {
+			return daisy.Errf("Failed to get source file attributes: %v", err)
+		}
+		record.SourceGeneration = attrs.Generation
+	}
+	image, err := w.imageClient.GetImage(w.request.Project, w.request.ImageName)
+	if err != nil {
+		return daisy.Errf("Failed to get image %q: %v", w.request.ImageName, err)
+	}
+	record.Image = image.SelfLink
+	signed, err := signProvenance(record, w.signingKey)
+	if err != nil {
+		return daisy.Errf("Failed to sign provenance record: %v", err)
+	}
+	content, err := json.MarshalIndent(signed, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := provenancePath(w.request)
+	bucket, object, err := storage.GetGCSObjectPathElements(path)
+	if err != nil {
+		return err
+	}
+	if err := w.storageClient.WriteToGCS(bucket, object, bytes.NewReader(content)); err != nil {
+		return daisy.Errf("Failed to write provenance record to %s: %v", path, err)
+	}
+	w.logger.User("Wrote provenance record to " + path)
+	return nil
+}
@@ -0,0 +1,220 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/mocks"
+)
+
+var testRecord = ProvenanceRecord{
+	SourceURI:        "gs://bucket/disk.vmdk",
+	SourceGeneration: 12,
+	SourceSizeBytes:  1024,
+	SourceSHA256:     sha256Of("a"),
+	DiskSHA256:       sha256Of("a"),
+	ToolVersion:      "v1.0.0",
+	Image:            "https://www.googleapis.com/compute/v1/projects/p/global/images/i",
+	Created:          time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+}
+
+func TestSignProvenance_IsVerified(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name              string
+		key               crypto.Signer
+		expectedAlgorithm string
+	}{
+		{"ecdsa", ecdsaKey, SignatureECDSASHA256},
+		{"ed25519", ed25519Key, SignatureED25519},
+		{"rsa", rsaKey, SignatureRSAPKCS1SHA256},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := signProvenance(testRecord, tt.key)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedAlgorithm, signed.SignatureAlgorithm)
+			file, err := json.Marshal(signed)
+			require.NoError(t, err)
+
+			record, err := VerifyProvenance(file, tt.key.Public())
+			assert.NoError(t, err)
+			assert.Equal(t, testRecord, record)
+
+			signed.Record = []byte(`{"sourceUri":"gs://bucket/other.vmdk"}`)
+			file, err = json.Marshal(signed)
+			require.NoError(t, err)
+			_, err = VerifyProvenance(file, tt.key.Public())
+			assert.EqualError(t, err, "provenance record's signature is invalid")
+		})
+	}
+}
+
+func TestSignProvenance_WithoutKey(t *testing.T) {
+	signed, err := signProvenance(testRecord, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, signed.Signature)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	file, err := json.Marshal(signed)
+	require.NoError(t, err)
+	_, err = VerifyProvenance(file, ed25519Key.Public())
+	assert.EqualError(t, err, "provenance record isn't signed")
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provenance")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	filename := filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	loaded, err := loadSigningKey(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Public(), loaded.Public())
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte("key"), 0600))
+	_, err = loadSigningKey(filename)
+	assert.EqualError(t, err, `"`+filename+`" isn't a PEM file`)
+}
+
+func TestProvenancePath(t *testing.T) {
+	request := makeValidRequest()
+	request.ScratchBucketGcsPath = "gs://scratch/gce-image-import-execution-id"
+	assert.Equal(t, "gs://scratch/gce-image-import-provenance/ubuntu20.json", provenancePath(request))
+	request.ProvenanceGcsPath = "gs://bucket/provenance.json"
+	assert.Equal(t, "gs://bucket/provenance.json", provenancePath(request))
+}
+
+func TestGCSProvenanceWriter_Write(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	request := makeValidRequest()
+	request.Source = fileSource{gcsPath: "gs://bucket/disk.vmdk"}
+	request.ProvenanceGcsPath = "gs://records/import.json"
+	request.ToolVersion = "v1.0.0"
+
+	storageClient := mocks.NewMockStorageClientInterface(ctrl)
+	storageClient.EXPECT().GetObjectAttrs("bucket", "disk.vmdk").Return(&gcs.ObjectAttrs{Generation: 12}, nil)
+	var written []byte
+	storageClient.EXPECT().WriteToGCS("records", "import.json", gomock.Any()).DoAndReturn(
+		func(bucket, object string, r io.Reader) error {
+			var err error
+			written, err = ioutil.ReadAll(r)
+			return err
+		})
+	imageClient := mockGetImageClient{
+		t:                 t,
+		expectedProject:   request.Project,
+		expectedImageName: request.ImageName,
+		img:               &compute.Image{SelfLink: testRecord.Image},
+	}
+	writer, err := newProvenanceWriter(request, storageClient, imageClient, logging.NewToolLogger(t.Name()))
+	require.NoError(t, err)
+
+	assert.NoError(t, writer.write(integrityReport{
+		sourceSizeBytes: 1024,
+		sourceSHA256:    sha256Of("a"),
+		diskSHA256:      sha256Of("a"),
+	}))
+	var signed SignedProvenance
+	require.NoError(t, json.Unmarshal(written, &signed))
+	assert.Empty(t, signed.Signature)
+	var record ProvenanceRecord
+	require.NoError(t, json.Unmarshal(signed.Record, &record))
+	record.Created = testRecord.Created
+	assert.Equal(t, testRecord, record)
+}
+
+func TestGCSProvenanceWriter_Write_StagedRemoteSource(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	content := fakeDisk(100)
+	srv, _ := newFileServer(content)
+	defer srv.Close()
+	staged, err := newTestStager(t, srv.URL+"/disk.vmdk?sig=secret", newFakeGCS()).stage(context.Background())
+	require.NoError(t, err)
+
+	request := makeValidRequest()
+	request.Source = staged
+	request.ProvenanceGcsPath = "gs://records/import.json"
+	// The staged copy is deleted once the import ends, so it isn't looked up.
+	storageClient := mocks.NewMockStorageClientInterface(ctrl)
+	var written []byte
+	storageClient.EXPECT().WriteToGCS("records", "import.json", gomock.Any()).DoAndReturn(
+		func(bucket, object string, r io.Reader) error {
+			var err error
+			written, err = ioutil.ReadAll(r)
+			return err
+		})
+	imageClient := mockGetImageClient{
+		t:                 t,
+		expectedProject:   request.Project,
+		expectedImageName: request.ImageName,
+		img:               &compute.Image{SelfLink: testRecord.Image},
+	}
+	writer, err := newProvenanceWriter(request, storageClient, imageClient, logging.NewToolLogger(t.Name()))
+	require.NoError(t, err)
+
+	assert.NoError(t, writer.write(integrityReport{sourceSizeBytes: 100}))
+	var signed SignedProvenance
+	require.NoError(t, json.Unmarshal(written, &signed))
+	var record ProvenanceRecord
+	require.NoError(t, json.Unmarshal(signed.Record, &record))
+	assert.Equal(t, srv.URL+"/disk.vmdk", record.SourceURI)
+	assert.Equal(t, fmt.Sprintf(`"%08x"`, crc32.Checksum(content, crc32cTable)), record.SourceVersion)
+	assert.Zero(t, record.SourceGeneration)
+}
+
+func TestNewProvenanceWriter_FailsWhenKeyCantBeLoaded(t *testing.T) {
+	request := makeValidRequest()
+	request.ProvenanceSigningKey = "/does/not/exist.pem"
+	_, err := newProvenanceWriter(request, nil, nil, logging.NewToolLogger(t.Name()))
+	assert.EqualError(t, err, "Failed to load -provenance_signing_key: open /does/not/exist.pem: no such file or directory")
+}
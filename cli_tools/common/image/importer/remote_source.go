@@ -0,0 +1,656 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	storageutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+// S3Options configure access to s3:// sources, either in AWS or in an
+// S3-compatible object store, such as MinIO or Ceph.
+type S3Options struct {
+	// Endpoint is the URL of an S3-compatible object store. Empty for AWS.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+const (
+	// Size of the chunks that remote sources are copied in.
+	stagingChunkSize = 64 << 20
+	// Number of chunks that are copied at the same time.
+	stagingWorkers = 8
+	// Maximum number of objects in a single GCS compose request.
+	maxComposeSources = 32
+	// Bytes read from remote sources to validate them.
+	remoteValidationSize = 4096
+)
+
+var (
+	// Delays before retrying to copy a chunk.
+	stagingRetryDelays = []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	crc32cTable        = crc32.MakeTable(crc32.Castagnoli)
+	s3SourcePattern    = regexp.MustCompile(`^s3://([a-z0-9][-_.a-z0-9]*)/(.+)$`)
+	contentRangeSize   = regexp.MustCompile(`/(\d+)$`)
+)
+
+// remoteSource is a disk file outside of Cloud Storage. It has to be copied
+// to Cloud Storage with StageSource before it's imported.
+type remoteSource interface {
+	Source
+	// fileSize returns the size of the file in bytes.
+	fileSize() int64
+	// version identifies the content of the file, such as an ETag or the time
+	// it was last modified. It's empty if the file's store reports neither.
+	version() string
+	// readRange reads the bytes start to end of the file, inclusive.
+	readRange(ctx context.Context, start, end int64) (io.ReadCloser, error)
+}
+
+// IsRemoteSource returns whether s is outside of Cloud Storage and has to be
+// copied with StageSource.
+func IsRemoteSource(s Source) bool {
+	_, ok := s.(remoteSource)
+	return ok
+}
+
+// isRemotePath returns whether sourceFile refers to a file outside of Cloud Storage.
+func isRemotePath(sourceFile string) bool {
+	lower := strings.ToLower(sourceFile)
+	for _, prefix := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRemoteSource creates the remoteSource of sourceFile and reads a few bytes
+// from it. It is an error if the file is empty, or if the file is compressed
+// with gzip.
+func (factory sourceFactory) newRemoteSource(sourceFile string) (Source, error) {
+	var source remoteSource
+	var err error
+	if strings.HasPrefix(strings.ToLower(sourceFile), "s3://") {
+		source, err = newS3Source(sourceFile, factory.s3Options)
+	} else {
+		source, err = newHTTPSource(sourceFile, factory.httpClient)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if source.fileSize() <= 0 {
+		return nil, daisy.Errf("cannot import an image from an empty file")
+	}
+	end := source.fileSize()
+	if end > remoteValidationSize {
+		end = remoteValidationSize
+	}
+	rc, err := source.readRange(context.Background(), 0, end-1)
+	if err != nil {
+		return nil, daisy.Errf("failed to read %v when validating resource file: %v", source.Path(), err)
+	}
+	defer rc.Close()
+	return source, validateFileContent(rc)
+}
+
+// An importable source read over HTTP or HTTPS.
+type httpSource struct {
+	// url includes the query, which may contain credentials, such as the
+	// signature of a pre-signed URL.
+	url    string
+	client *http.Client
+	size   int64
+	etag   string
+	// lastModified is only used when the server doesn't send a strong ETag.
+	lastModified string
+}
+
+// newHTTPSource creates an httpSource and gets the size of the file. A ranged
+// GET is used instead of HEAD, since pre-signed URLs are only valid for GET.
+func newHTTPSource(sourceURL string, client *http.Client) (remoteSource, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, daisy.Errf("%q is not a valid URL of a file", redactURL(sourceURL))
+	}
+	source := httpSource{url: sourceURL, client: client}
+
+	resp, err := source.get(context.Background(), "bytes=0-0")
+	if err != nil {
+		return nil, daisy.Errf("failed to get the size of %v: %v", source.Path(), err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		m := contentRangeSize.FindStringSubmatch(resp.Header.Get("Content-Range"))
+		if m == nil {
+			return nil, daisy.Errf("failed to get the size of %v: unexpected Content-Range %q",
+				source.Path(), resp.Header.Get("Content-Range"))
+		}
+		source.size, _ = strconv.ParseInt(m[1], 10, 64)
+	case http.StatusOK:
+		// The server doesn't support ranges, so the file can't be split in chunks.
+		source.size = resp.ContentLength
+		if source.size < 0 {
+			// The size is unknown, such as for chunked responses. The file
+			// is read to count its bytes, up to the size of a chunk.
+			source.size, err = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, stagingChunkSize+1))
+			if err != nil {
+				return nil, daisy.Errf("failed to get the size of %v: %v", source.Path(), err)
+			}
+		}
+		if source.size > stagingChunkSize {
+			return nil, daisy.Errf("failed to read %v: server doesn't support range requests", source.Path())
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The file is empty.
+	default:
+		return nil, daisy.Errf("failed to get the size of %v: unexpected response: %v", source.Path(), resp.Status)
+	}
+	// Weak ETags don't guarantee identical bytes.
+	if etag := resp.Header.Get("ETag"); !strings.HasPrefix(etag, "W/") {
+		source.etag = etag
+	}
+	if source.etag == "" {
+		source.lastModified = resp.Header.Get("Last-Modified")
+	}
+	return source, nil
+}
+
+func (s httpSource) get(ctx context.Context, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", byteRange)
+	if s.etag != "" {
+		req.Header.Set("If-Match", s.etag)
+	} else if s.lastModified != "" {
+		req.Header.Set("If-Unmodified-Since", s.lastModified)
+	}
+	return s.client.Do(req.WithContext(ctx))
+}
+
+// The resource path for httpSource is its URL without the query.
+func (s httpSource) Path() string {
+	return redactURL(s.url)
+}
+
+func (s httpSource) fileSize() int64 {
+	return s.size
+}
+
+func (s httpSource) version() string {
+	if s.etag != "" {
+		return s.etag
+	}
+	return s.lastModified
+}
+
+func (s httpSource) readRange(ctx context.Context, start, end int64) (io.ReadCloser, error) {
+	resp, err := s.get(ctx, fmt.Sprintf("bytes=%v-%v", start, end))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		return resp.Body, nil
+	}
+	// Servers that don't support ranges send the whole file, which is only
+	// usable for ranges at the start of the file.
+	if resp.StatusCode == http.StatusOK && start == 0 {
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, end+1), resp.Body}, nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("server doesn't support range requests")
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return nil, fmt.Errorf("file was modified during import")
+	}
+	return nil, fmt.Errorf("unexpected response: %v", resp.Status)
+}
+
+// redactURL removes the query and credentials from rawURL, to keep
+// signatures out of logs.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	u.RawQuery = ""
+	u.User = nil
+	return u.String()
+}
+
+// An importable source in S3, or in an S3-compatible object store.
+type s3Source struct {
+	bucket string
+	key    string
+	client s3iface.S3API
+	size   int64
+	etag   string
+}
+
+// newS3Source creates an s3Source and gets the size of the file.
+func newS3Source(s3Path string, options S3Options) (remoteSource, error) {
+	m := s3SourcePattern.FindStringSubmatch(s3Path)
+	if m == nil {
+		return nil, daisy.Errf("%q is not a valid S3 path of a file", s3Path)
+	}
+
+	config := &aws.Config{Region: aws.String(options.Region)}
+	if options.Region == "" {
+		config.Region = aws.String("us-east-1")
+	}
+	if options.Endpoint != "" {
+		// S3-compatible stores don't all support virtual hosted buckets.
+		config.Endpoint = aws.String(options.Endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+	if options.AccessKeyID != "" {
+		config.Credentials = credentials.NewStaticCredentials(
+			options.AccessKeyID, options.SecretAccessKey, options.SessionToken)
+	} else {
+		config.Credentials = credentials.AnonymousCredentials
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, daisy.Errf("failed to create S3 session: %v", err)
+	}
+	return newS3SourceWithClient(m[1], m[2], s3.New(sess))
+}
+
+func newS3SourceWithClient(bucket, key string, client s3iface.S3API) (remoteSource, error) {
+	source := s3Source{bucket: bucket, key: key, client: client}
+	resp, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, daisy.Errf("failed to get the size of %v: %v", source.Path(), err)
+	}
+	source.size = aws.Int64Value(resp.ContentLength)
+	source.etag = aws.StringValue(resp.ETag)
+	return source, nil
+}
+
+// The resource path for s3Source is its s3:// path.
+func (s s3Source) Path() string {
+	return fmt.Sprintf("s3://%v/%v", s.bucket, s.key)
+}
+
+func (s s3Source) fileSize() int64 {
+	return s.size
+}
+
+func (s s3Source) version() string {
+	return s.etag
+}
+
+func (s s3Source) readRange(ctx context.Context, start, end int64) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+		Range:  aws.String(fmt.Sprintf("bytes=%v-%v", start, end)),
+	}
+	if s.etag != "" {
+		input.IfMatch = aws.String(s.etag)
+	}
+	resp, err := s.client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// StageSource copies source to the Cloud Storage directory gcsDir if it's a
+// remote source, and returns the fileSource of the copy. The copy keeps the
+// path and version of source, for the provenance record. Other sources are
+// returned as-is.
+//
+// The file is copied in parallel chunks. Each chunk is stored as an object and
+// checked against the CRC32C of the bytes read from the source, and retried if
+// they don't match. Once all chunks are stored, they are composed into the
+// copy, whose CRC32C is checked as well. Chunks of an interrupted copy of the
+// same version of the file to the same gcsDir are reused. Files whose store
+// reports no version are copied from scratch every time.
+func StageSource(ctx context.Context, source Source, storageClient domain.StorageClientInterface,
+	gcsDir string, logger logging.Logger) (Source, error) {
+
+	remote, ok := source.(remoteSource)
+	if !ok {
+		return source, nil
+	}
+	bucket, dir, err := storageutils.SplitGCSPath(gcsDir)
+	if err != nil {
+		return nil, err
+	}
+	// The directory is derived from the file, so that retries find the chunks
+	// of earlier attempts. Without a version, chunks of an earlier attempt may
+	// be of different content, so each copy uses its own directory.
+	key := fmt.Sprintf("%v\n%v\n%v", remote.Path(), remote.fileSize(), remote.version())
+	reuseChunks := remote.version() != ""
+	if !reuseChunks {
+		key += fmt.Sprintf("\n%v", time.Now().UnixNano())
+	}
+	id := sha256.Sum256([]byte(key))
+	s := &stager{
+		reuseChunks:   reuseChunks,
+		source:        remote,
+		storageClient: storageClient,
+		logger:        logger,
+		bucket:        bucket,
+		dir:           path.Join(dir, fmt.Sprintf("%x", id[:8])),
+		chunkSize:     stagingChunkSize,
+		workers:       stagingWorkers,
+		retryDelays:   stagingRetryDelays,
+	}
+	return s.stage(ctx)
+}
+
+// stager copies a remoteSource to Cloud Storage.
+type stager struct {
+	source        remoteSource
+	storageClient domain.StorageClientInterface
+	logger        logging.Logger
+	bucket, dir   string
+	chunkSize     int64
+	workers       int
+	retryDelays   []time.Duration
+	// reuseChunks is set when the chunks of an earlier attempt are known to
+	// be of the same version of the file. Otherwise, chunks are deleted when
+	// the copy fails.
+	reuseChunks bool
+	copied      int64
+	// intermediates are the objects composed from chunks, when there are too
+	// many chunks to compose them at once.
+	intermediates []string
+}
+
+func (s *stager) stage(ctx context.Context) (Source, error) {
+	start := time.Now()
+	size := s.source.fileSize()
+	object := path.Join(s.dir, path.Base(strings.TrimSuffix(s.source.Path(), "/")))
+	s.logger.User(fmt.Sprintf("Copying %v to gs://%v/%v.", s.source.Path(), s.bucket, object))
+
+	chunks := (size + s.chunkSize - 1) / s.chunkSize
+	crcs := make([]uint32, chunks)
+	g, gctx := errgroup.WithContext(ctx)
+	indexes := make(chan int64)
+	g.Go(func() error {
+		defer close(indexes)
+		for i := int64(0); i < chunks; i++ {
+			select {
+			case indexes <- i:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		}
+		return nil
+	})
+	for w := 0; w < s.workers; w++ {
+		g.Go(func() error {
+			for i := range indexes {
+				crc, err := s.stageChunk(gctx, i)
+				if err != nil {
+					return err
+				}
+				crcs[i] = crc
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		if !s.reuseChunks {
+			for i := int64(0); i < chunks; i++ {
+				s.storageClient.GetObject(s.bucket, s.chunkName(i)).Delete()
+			}
+		}
+		return nil, err
+	}
+
+	var names []string
+	var crc uint32
+	for i := int64(0); i < chunks; i++ {
+		names = append(names, s.chunkName(i))
+		crc = crc32cCombine(crc, crcs[i], s.chunkLength(i))
+	}
+	attrs, err := s.compose(object, names)
+	if err != nil {
+		return nil, daisy.Errf("failed to compose gs://%v/%v: %v", s.bucket, object, err)
+	}
+	if attrs.Size != size || attrs.CRC32C != crc {
+		s.storageClient.GetObject(s.bucket, object).Delete()
+		return nil, daisy.Errf("checksum mismatch for gs://%v/%v: got %v bytes with CRC32C %08x, want %v bytes with CRC32C %08x",
+			s.bucket, object, attrs.Size, attrs.CRC32C, size, crc)
+	}
+	for _, name := range append(names, s.intermediates...) {
+		if err := s.storageClient.GetObject(s.bucket, name).Delete(); err != nil {
+			s.logger.Debug(fmt.Sprintf("Failed to delete gs://%v/%v: %v", s.bucket, name, err))
+		}
+	}
+	s.logger.User(fmt.Sprintf("Copied %v in %v.", s.source.Path(), time.Since(start).Round(time.Second)))
+
+	return fileSource{
+		gcsPath:       fmt.Sprintf("gs://%v/%v", s.bucket, object),
+		bucket:        s.bucket,
+		object:        object,
+		origin:        s.source.Path(),
+		originVersion: s.source.version(),
+	}, nil
+}
+
+func (s *stager) chunkDir() string {
+	return path.Join(s.dir, "chunks")
+}
+
+func (s *stager) chunkName(i int64) string {
+	return path.Join(s.chunkDir(), fmt.Sprintf("%08d", i))
+}
+
+func (s *stager) chunkLength(i int64) int64 {
+	if end := (i + 1) * s.chunkSize; end < s.source.fileSize() {
+		return s.chunkSize
+	}
+	return s.source.fileSize() - i*s.chunkSize
+}
+
+// stageChunk copies chunk i, retrying failed attempts, and returns its CRC32C.
+func (s *stager) stageChunk(ctx context.Context, i int64) (uint32, error) {
+	name := s.chunkName(i)
+	length := s.chunkLength(i)
+	// Chunks are only kept once their checksum matched, an object of the
+	// right size is a chunk of an earlier attempt.
+	if !s.reuseChunks {
+		// Chunks can't be of an earlier attempt.
+	} else if attrs, err := s.storageClient.GetObjectAttrs(s.bucket, name); err == nil && attrs.Size == length {
+		s.progress(length)
+		return attrs.CRC32C, nil
+	}
+
+	start := i * s.chunkSize
+	end := start + length - 1
+	for attempt := 0; ; attempt++ {
+		crc, err := s.copyChunk(ctx, name, start, end)
+		if err == nil {
+			s.progress(length)
+			return crc, nil
+		}
+		if attempt >= len(s.retryDelays) || ctx.Err() != nil {
+			return 0, daisy.Errf("failed to copy bytes %v-%v of %v: %v", start, end, s.source.Path(), err)
+		}
+		select {
+		case <-time.After(s.retryDelays[attempt]):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// copyChunk copies bytes start to end of the source to the object name, and
+// returns their CRC32C once it's verified.
+func (s *stager) copyChunk(ctx context.Context, name string, start, end int64) (uint32, error) {
+	body, err := s.source.readRange(ctx, start, end)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	hash := crc32.New(crc32cTable)
+	obj := s.storageClient.GetObject(s.bucket, name)
+	writer := obj.NewWriter()
+	n, copyErr := io.Copy(writer, io.TeeReader(body, hash))
+	closeErr := writer.Close()
+	if copyErr == nil && n != end-start+1 {
+		copyErr = fmt.Errorf("read %v bytes, want %v", n, end-start+1)
+	}
+	if copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr == nil {
+		var attrs *storage.ObjectAttrs
+		attrs, copyErr = s.storageClient.GetObjectAttrs(s.bucket, name)
+		if copyErr == nil && attrs.CRC32C != hash.Sum32() {
+			copyErr = fmt.Errorf("checksum mismatch: stored CRC32C %08x, read CRC32C %08x", attrs.CRC32C, hash.Sum32())
+		}
+	}
+	if copyErr != nil {
+		// A partial chunk is stored when the copy fails.
+		obj.Delete()
+		return 0, copyErr
+	}
+	return hash.Sum32(), nil
+}
+
+// progress logs every ten percent of the file that's copied.
+func (s *stager) progress(n int64) {
+	size := s.source.fileSize()
+	copied := atomic.AddInt64(&s.copied, n)
+	if (copied-n)*10/size != copied*10/size {
+		s.logger.Debug(fmt.Sprintf("Copied %v of %v bytes.", copied, size))
+	}
+}
+
+// compose composes the objects srcs into object, in rounds of up to
+// maxComposeSources objects.
+func (s *stager) compose(object string, srcs []string) (*storage.ObjectAttrs, error) {
+	for round := 0; len(srcs) > maxComposeSources; round++ {
+		var next []string
+		for i := 0; i < len(srcs); i += maxComposeSources {
+			end := i + maxComposeSources
+			if end > len(srcs) {
+				end = len(srcs)
+			}
+			name := path.Join(s.chunkDir(), fmt.Sprintf("compose-%v-%08d", round, i/maxComposeSources))
+			if _, err := s.composeObjects(name, srcs[i:end]); err != nil {
+				return nil, err
+			}
+			next = append(next, name)
+			s.intermediates = append(s.intermediates, name)
+		}
+		srcs = next
+	}
+	return s.composeObjects(object, srcs)
+}
+
+func (s *stager) composeObjects(object string, srcs []string) (*storage.ObjectAttrs, error) {
+	var objs []domain.StorageObject
+	for _, src := range srcs {
+		objs = append(objs, s.storageClient.GetObject(s.bucket, src))
+	}
+	return s.storageClient.GetObject(s.bucket, object).Compose(objs...)
+}
+
+// crc32cCombine returns the CRC32C of two concatenated byte sequences, given
+// their CRC32Cs and the length of the second one. It's zlib's crc32_combine.
+func crc32cCombine(crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1
+	}
+	var even, odd [32]uint32
+	// odd is the operator for one zero bit.
+	odd[0] = crc32.Castagnoli
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	gf2MatrixSquare(even[:], odd[:]) // two zero bits
+	gf2MatrixSquare(odd[:], even[:]) // four zero bits
+	// Apply len2 zero bytes to crc1.
+	for {
+		gf2MatrixSquare(even[:], odd[:])
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(even[:], crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(odd[:], even[:])
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(odd[:], crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat []uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat []uint32) {
+	for n := range square {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
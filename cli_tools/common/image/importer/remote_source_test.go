@@ -0,0 +1,406 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/test"
+)
+
+func TestCRC32CCombine(t *testing.T) {
+	a, b := []byte("first part of the file"), bytes.Repeat([]byte("second part"), 1000)
+	got := crc32cCombine(crc32.Checksum(a, crc32cTable), crc32.Checksum(b, crc32cTable), int64(len(b)))
+	assert.Equal(t, crc32.Checksum(append(a, b...), crc32cTable), got)
+	assert.Equal(t, uint32(42), crc32cCombine(42, 0, 0))
+}
+
+func TestRemotePathsCreateRemoteSources(t *testing.T) {
+	content := fakeDisk(1000)
+	srv, _ := newFileServer(content)
+	defer srv.Close()
+
+	source, err := NewSourceFactory(nil).Init(srv.URL+"/disks/disk.vmdk?sig=secret", "")
+	assert.NoError(t, err)
+	assert.True(t, IsRemoteSource(source))
+	assert.False(t, isFile(source))
+	assert.Equal(t, srv.URL+"/disks/disk.vmdk", source.Path())
+	assert.Equal(t, int64(len(content)), source.(remoteSource).fileSize())
+	assert.NotEmpty(t, source.(remoteSource).version())
+}
+
+func TestRemoteSourcesAreValidated(t *testing.T) {
+	var cases = []struct {
+		name    string
+		content string
+		path    string
+		want    string
+	}{
+		{"empty", "", "/disk.vmdk", "cannot import an image from an empty file"},
+		{"gzip", test.CreateCompressedFile(), "/disk.vmdk", "the input file is a gzip file"},
+		{"not found", "content", "/missing.vhd", "unexpected response: 404"},
+		{"no file", "content", "/", "is not a valid URL of a file"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newFileServer([]byte(tt.content))
+			defer srv.Close()
+			_, err := NewSourceFactory(nil).Init(srv.URL+tt.path, "")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestS3Source(t *testing.T) {
+	content := fakeDisk(100)
+	source, err := newS3SourceWithClient("bucket", "dir/disk.vhd", &fakeS3Client{content: content})
+	assert.NoError(t, err)
+	assert.Equal(t, "s3://bucket/dir/disk.vhd", source.Path())
+	assert.Equal(t, int64(100), source.fileSize())
+
+	rc, err := source.readRange(context.Background(), 10, 19)
+	assert.NoError(t, err)
+	got, _ := ioutil.ReadAll(rc)
+	assert.Equal(t, content[10:20], got)
+
+	_, err = NewSourceFactory(nil).Init("s3://bucket", "")
+	assert.EqualError(t, err, `"s3://bucket" is not a valid S3 path of a file`)
+}
+
+func TestStageSourceKeepsOtherSources(t *testing.T) {
+	source := imageSource{uri: "global/images/ubuntu-1604"}
+	staged, err := StageSource(context.Background(), source, nil, "gs://bucket/staging", logging.NewToolLogger("test"))
+	assert.NoError(t, err)
+	assert.Equal(t, source, staged)
+}
+
+func TestStageSourceCopiesInChunks(t *testing.T) {
+	// More chunks than can be composed at once.
+	content := fakeDisk(1000)
+	srv, _ := newFileServer(content)
+	defer srv.Close()
+	gcs := newFakeGCS()
+
+	staged, err := newTestStager(t, srv.URL+"/disk.vmdk", gcs).stage(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, isFile(staged))
+	assert.True(t, strings.HasPrefix(staged.Path(), "gs://bucket/staging/"))
+	assert.True(t, strings.HasSuffix(staged.Path(), "/disk.vmdk"))
+	_, object := splitFakePath(staged.Path())
+	assert.Equal(t, content, gcs.objects[object])
+	assert.Len(t, gcs.objects, 1, "chunks should be deleted")
+}
+
+func TestStageSourceRetriesCorruptChunks(t *testing.T) {
+	content := fakeDisk(100)
+	srv, _ := newFileServer(content)
+	defer srv.Close()
+	gcs := newFakeGCS()
+	gcs.corruptWrites = 2
+
+	staged, err := newTestStager(t, srv.URL+"/disk.vmdk", gcs).stage(context.Background())
+	assert.NoError(t, err)
+	_, object := splitFakePath(staged.Path())
+	assert.Equal(t, content, gcs.objects[object])
+	assert.Equal(t, 0, gcs.corruptWrites)
+}
+
+func TestStageSourceFailsAfterRetries(t *testing.T) {
+	srv, _ := newFileServer(fakeDisk(100))
+	defer srv.Close()
+	gcs := newFakeGCS()
+	gcs.corruptWrites = 100
+
+	_, err := newTestStager(t, srv.URL+"/disk.vmdk", gcs).stage(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "checksum mismatch")
+	}
+	assert.Empty(t, gcs.objects, "partial chunks should be deleted")
+}
+
+func TestStageSourceReusesChunks(t *testing.T) {
+	content := fakeDisk(100)
+	srv, requests := newFileServer(content)
+	defer srv.Close()
+	gcs := newFakeGCS()
+
+	s := newTestStager(t, srv.URL+"/disk.vmdk", gcs)
+	// Chunks of an interrupted attempt.
+	gcs.objects[s.chunkName(0)] = content[:10]
+	gcs.objects[s.chunkName(5)] = content[50:60]
+	before := atomic.LoadInt32(requests)
+
+	staged, err := s.stage(context.Background())
+	assert.NoError(t, err)
+	_, object := splitFakePath(staged.Path())
+	assert.Equal(t, content, gcs.objects[object])
+	assert.Equal(t, int32(8), atomic.LoadInt32(requests)-before)
+}
+
+func TestStageSourceFailsWhenFileChanges(t *testing.T) {
+	srv, _ := newFileServer(fakeDisk(100))
+	defer srv.Close()
+
+	s := newTestStager(t, srv.URL+"/disk.vmdk", newFakeGCS())
+	s.source = httpSource{url: s.source.(httpSource).url, client: srv.Client(), size: 100, etag: `"old"`}
+	_, err := s.stage(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "file was modified during import")
+	}
+}
+
+func TestStageSourceWithoutVersionDoesNotReuseChunks(t *testing.T) {
+	content := fakeDisk(100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+	gcs := newFakeGCS()
+
+	s := newTestStager(t, srv.URL+"/disk.vmdk", gcs)
+	assert.Empty(t, s.source.version())
+	assert.False(t, s.reuseChunks)
+	// Chunk of an interrupted attempt, which may be of another version.
+	gcs.objects[s.chunkName(0)] = bytes.Repeat([]byte("x"), 10)
+
+	staged, err := s.stage(context.Background())
+	assert.NoError(t, err)
+	_, object := splitFakePath(staged.Path())
+	assert.Equal(t, content, gcs.objects[object])
+}
+
+func TestStageSourceWithoutVersionDeletesChunksOnFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(fakeDisk(100)))
+	}))
+	defer srv.Close()
+	gcs := newFakeGCS()
+	gcs.corruptWrites = 100
+
+	_, err := newTestStager(t, srv.URL+"/disk.vmdk", gcs).stage(context.Background())
+	assert.Error(t, err)
+	assert.Empty(t, gcs.objects)
+}
+
+func TestHTTPSourceWithoutRangesOrContentLength(t *testing.T) {
+	content := fakeDisk(100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Flushing before the body is written makes the response chunked.
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	source, err := NewSourceFactory(nil).Init(srv.URL+"/disk.vmdk", "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), source.(remoteSource).fileSize())
+	body, err := source.(remoteSource).readRange(context.Background(), 0, 9)
+	assert.NoError(t, err)
+	got, _ := ioutil.ReadAll(body)
+	body.Close()
+	assert.Equal(t, content[:10], got)
+}
+
+func TestHTTPSourceUsesLastModifiedWithoutETag(t *testing.T) {
+	modified := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	var conditions []string
+	var mx sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		conditions = append(conditions, r.Header.Get("If-Unmodified-Since"))
+		m := modified
+		mx.Unlock()
+		http.ServeContent(w, r, "", m, bytes.NewReader(fakeDisk(100)))
+	}))
+	defer srv.Close()
+
+	source, err := newHTTPSource(srv.URL+"/disk.vmdk", srv.Client())
+	assert.NoError(t, err)
+	want := modified.Format(http.TimeFormat)
+	assert.Equal(t, want, source.version())
+	body, err := source.readRange(context.Background(), 0, 9)
+	assert.NoError(t, err)
+	body.Close()
+	mx.Lock()
+	assert.Equal(t, []string{"", want}, conditions)
+	// The file changed since its size was read.
+	modified = modified.Add(time.Hour)
+	mx.Unlock()
+	_, err = source.readRange(context.Background(), 0, 9)
+	assert.EqualError(t, err, "file was modified during import")
+}
+
+// fakeDisk returns n bytes of a fake disk file.
+func fakeDisk(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('a' + i%26)
+	}
+	return b
+}
+
+// newFileServer serves content at every path that ends with .vmdk, and
+// counts the requests it receives.
+func newFileServer(content []byte) (*httptest.Server, *int32) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if !strings.HasSuffix(r.URL.Path, ".vmdk") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%08x"`, crc32.Checksum(content, crc32cTable)))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	return srv, &requests
+}
+
+func newTestStager(t *testing.T, url string, gcs *fakeGCS) *stager {
+	source, err := newHTTPSource(url, http.DefaultClient)
+	assert.NoError(t, err)
+	return &stager{
+		source:        source,
+		storageClient: gcs,
+		logger:        logging.NewToolLogger("test"),
+		bucket:        "bucket",
+		dir:           "staging/abc",
+		chunkSize:     10,
+		workers:       3,
+		retryDelays:   []time.Duration{0, 0},
+		reuseChunks:   source.version() != "",
+	}
+}
+
+func splitFakePath(gcsPath string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(gcsPath, "gs://"), "/", 2)
+	return parts[0], parts[1]
+}
+
+// fakeGCS is an in-memory StorageClientInterface for a single bucket.
+type fakeGCS struct {
+	domain.StorageClientInterface
+	mx      sync.Mutex
+	objects map[string][]byte
+	// corruptWrites is the number of writes to corrupt.
+	corruptWrites int
+}
+
+func newFakeGCS() *fakeGCS {
+	return &fakeGCS{objects: map[string][]byte{}}
+}
+
+func (f *fakeGCS) GetObject(bucket, object string) domain.StorageObject {
+	return &fakeObject{gcs: f, name: object}
+}
+
+func (f *fakeGCS) GetObjectAttrs(bucket, object string) (*storage.ObjectAttrs, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	b, ok := f.objects[object]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	return &storage.ObjectAttrs{Name: object, Size: int64(len(b)), CRC32C: crc32.Checksum(b, crc32cTable)}, nil
+}
+
+type fakeObject struct {
+	domain.StorageObject
+	gcs  *fakeGCS
+	name string
+	buf  bytes.Buffer
+}
+
+func (o *fakeObject) NewWriter() io.WriteCloser {
+	return o
+}
+
+func (o *fakeObject) Write(p []byte) (int, error) {
+	return o.buf.Write(p)
+}
+
+func (o *fakeObject) Close() error {
+	b := o.buf.Bytes()
+	o.gcs.mx.Lock()
+	defer o.gcs.mx.Unlock()
+	if o.gcs.corruptWrites > 0 && len(b) > 0 {
+		o.gcs.corruptWrites--
+		b[0]++
+	}
+	o.gcs.objects[o.name] = b
+	return nil
+}
+
+func (o *fakeObject) Delete() error {
+	o.gcs.mx.Lock()
+	defer o.gcs.mx.Unlock()
+	delete(o.gcs.objects, o.name)
+	return nil
+}
+
+func (o *fakeObject) Compose(srcs ...domain.StorageObject) (*storage.ObjectAttrs, error) {
+	o.gcs.mx.Lock()
+	var b []byte
+	for _, src := range srcs {
+		b = append(b, o.gcs.objects[src.(*fakeObject).name]...)
+	}
+	o.gcs.objects[o.name] = b
+	o.gcs.mx.Unlock()
+	return o.gcs.GetObjectAttrs("bucket", o.name)
+}
+
+// fakeS3Client serves content for every object.
+type fakeS3Client struct {
+	s3iface.S3API
+	content []byte
+}
+
+func (c *fakeS3Client) HeadObject(*s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(c.content))), ETag: aws.String(`"etag"`)}, nil
+}
+
+func (c *fakeS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	var start, end int
+	if _, err := fmt.Sscanf(aws.StringValue(input.Range), "bytes=%d-%d", &start, &end); err != nil {
+		return nil, err
+	}
+	if aws.StringValue(input.IfMatch) != `"etag"` {
+		return nil, fmt.Errorf("precondition failed")
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(c.content[start : end+1]))}, nil
+}
@@ -32,6 +32,10 @@ const (
 	DataDiskFlag       = "data_disk"
 	OSFlag             = "os"
 	CustomWorkflowFlag = "custom_translate_workflow"
+
+	VerifyIntegrityFlag      = "verify_integrity"
+	ProvenanceGcsPathFlag    = "provenance_gcs_path"
+	ProvenanceSigningKeyFlag = "provenance_signing_key"
 )
 
 func (args *ImageImportRequest) validate() error {
@@ -59,6 +63,13 @@ func (args *ImageImportRequest) validate() error {
 			return err
 		}
 	}
+	if args.VerifyIntegrity && isImage(args.Source) {
+		return fmt.Errorf("-%s can only be used when importing a file", VerifyIntegrityFlag)
+	}
+	if !args.VerifyIntegrity && (args.ProvenanceGcsPath != "" || args.ProvenanceSigningKey != "") {
+		return fmt.Errorf("-%s and -%s can only be used with -%s",
+			ProvenanceGcsPathFlag, ProvenanceSigningKeyFlag, VerifyIntegrityFlag)
+	}
 	return nil
 }
 
@@ -68,6 +79,15 @@ func (args *ImageImportRequest) checkRequiredArguments() error {
 
 // ImageImportRequest includes the parameters required to perform an image import.
 //
+// When VerifyIntegrity is set, the disk is compared with the source file
+// before it's translated, and a provenance record of the image is written to
+// ProvenanceGcsPath. ToolVersion is included in the record. The import
+// succeeds with a warning if the record can't be written, as the image was
+// verified by then.
+//
+// When InspectHeaders is set, the source file is inspected by parsing its
+// header with ranged reads, instead of with qemu-img over gcsfuse.
+//
 // DaisyLogLinePrefix configures Daisy's stdout to include this prefix. During inflation,
 // for example, a prefix of `ovf` would create a log line of `[ovf-inflate]`.
 //
@@ -86,6 +106,7 @@ type ImageImportRequest struct {
 	GcsLogsDisabled       bool
 	ImageName             string `name:"image_name" validate:"required,gce_disk_image_name"`
 	Inspect               bool
+	InspectHeaders        bool
 	Labels                map[string]string
 	Network               string
 	NoExternalIP          bool
@@ -94,6 +115,8 @@ type ImageImportRequest struct {
 	BYOL                  bool
 	OS                    string
 	Project               string `name:"project" validate:"required"`
+	ProvenanceGcsPath     string
+	ProvenanceSigningKey  string
 	ScratchBucketGcsPath  string `name:"scratch_bucket_gcs_path" validate:"required"`
 	Source                Source `name:"source" validate:"required"`
 	StdoutLogsDisabled    bool
@@ -101,7 +124,9 @@ type ImageImportRequest struct {
 	Subnet                string
 	SysprepWindows        bool
 	Timeout               time.Duration `name:"timeout" validate:"required"`
+	ToolVersion           string
 	UefiCompatible        bool
+	VerifyIntegrity       bool
 	Zone                  string `name:"zone" validate:"required"`
 }
 
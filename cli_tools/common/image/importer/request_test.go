@@ -249,6 +249,48 @@ func Test_validate_ChecksForConflictingArguments(t *testing.T) {
 	}
 }
 
+func Test_validate_ChecksIntegrityArguments(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		setup         func(request *ImageImportRequest)
+		expectedError string
+	}{
+		{
+			name: "file",
+			setup: func(request *ImageImportRequest) {
+				request.VerifyIntegrity = true
+				request.ProvenanceSigningKey = "key.pem"
+			},
+		},
+		{
+			name: "image",
+			setup: func(request *ImageImportRequest) {
+				request.VerifyIntegrity = true
+				request.Source = imageSource{uri: "global/images/source"}
+			},
+			expectedError: "-verify_integrity can only be used when importing a file",
+		},
+		{
+			name: "provenance without verification",
+			setup: func(request *ImageImportRequest) {
+				request.ProvenanceGcsPath = "gs://bucket/provenance.json"
+			},
+			expectedError: "-provenance_gcs_path and -provenance_signing_key can only be used with -verify_integrity",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			request := makeValidRequest()
+			tt.setup(&request)
+			err := request.validate()
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedError)
+			}
+		})
+	}
+}
+
 func Test_EnvironmentSettings(t *testing.T) {
 	request := ImageImportRequest{
 		Project:               "panda",
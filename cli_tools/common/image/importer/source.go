@@ -16,6 +16,8 @@ package importer
 
 import (
 	"compress/gzip"
+	"io"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
@@ -39,17 +41,30 @@ type Source interface {
 // SourceFactory takes the sourceFile and sourceImage specified by the user
 // and determines which, if any, is importable. It is an error if both sourceFile and
 // sourceImage are specified.
+//
+// Besides Cloud Storage files, sourceFile can be an http:// or https:// URL, or
+// an s3:// path. Those sources have to be copied to Cloud Storage with
+// StageSource before they're imported.
 type SourceFactory interface {
 	Init(sourceFile, sourceImage string) (Source, error)
 }
 
-// NewSourceFactory returns an instance of SourceFactory.
+// NewSourceFactory returns an instance of SourceFactory. s3:// files are
+// read anonymously from AWS.
 func NewSourceFactory(storageClient domain.StorageClientInterface) SourceFactory {
-	return sourceFactory{storageClient: storageClient}
+	return NewSourceFactoryWithS3(storageClient, S3Options{})
+}
+
+// NewSourceFactoryWithS3 returns an instance of SourceFactory that reads
+// s3:// files using s3Options.
+func NewSourceFactoryWithS3(storageClient domain.StorageClientInterface, s3Options S3Options) SourceFactory {
+	return sourceFactory{storageClient: storageClient, httpClient: http.DefaultClient, s3Options: s3Options}
 }
 
 type sourceFactory struct {
 	storageClient domain.StorageClientInterface
+	httpClient    *http.Client
+	s3Options     S3Options
 }
 
 func (factory sourceFactory) Init(sourceFile, sourceImage string) (Source, error) {
@@ -67,6 +82,9 @@ func (factory sourceFactory) Init(sourceFile, sourceImage string) (Source, error
 	}
 
 	if sourceFile != "" {
+		if isRemotePath(sourceFile) {
+			return factory.newRemoteSource(sourceFile)
+		}
 		return newFileSource(sourceFile, factory.storageClient)
 	}
 
@@ -90,6 +108,10 @@ type fileSource struct {
 	gcsPath string
 	bucket  string
 	object  string
+	// origin and originVersion are the path and version of the remote
+	// source that StageSource copied the file from, if any.
+	origin        string
+	originVersion string
 }
 
 // Create a fileSource from a gcsPath to a disk image. This method uses storageClient
@@ -123,10 +145,15 @@ func (s fileSource) validate(storageClient domain.StorageObjectCreatorInterface)
 			"file from bucket %q, file %q: %v", s.bucket, s.object, err)
 	}
 	defer rc.Close()
+	return validateFileContent(rc)
+}
 
-	byteCountingReader := daisycommon.NewByteCountingReader(rc)
+// validateFileContent reads the beginning of a disk file from r. It is an
+// error if the file is empty, or if the file is compressed with gzip.
+func validateFileContent(r io.Reader) error {
+	byteCountingReader := daisycommon.NewByteCountingReader(r)
 	// Detect whether it's a compressed file by extracting compressed file header
-	if _, err = gzip.NewReader(byteCountingReader); err == nil {
+	if _, err := gzip.NewReader(byteCountingReader); err == nil {
 		return daisy.Errf("the input file is a gzip file, which is not supported by " +
 			"image import. To import a file that was exported from Google Compute " +
 			"Engine, please use image create. To import a file that was exported " +
@@ -0,0 +1,85 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/imagefile"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+// An importable source backed by a file of a tar archive in GCS, such as a
+// disk of an OVA. The file is read in place with ranged reads of the archive,
+// so the archive doesn't have to be extracted.
+type tarMemberSource struct {
+	index         *storage.TarIndex
+	entry         storage.TarEntry
+	storageClient domain.StorageClientInterface
+}
+
+// NewTarMemberSource creates a Source from a file of a tar archive in GCS.
+// This method uses storageClient to read a few bytes from the file. It is an
+// error if the file is empty, or if the file is compressed with gzip.
+func NewTarMemberSource(index *storage.TarIndex, entry storage.TarEntry,
+	storageClient domain.StorageClientInterface) (Source, error) {
+	source := tarMemberSource{index: index, entry: entry, storageClient: storageClient}
+	return source, source.validate()
+}
+
+// The resource path for tarMemberSource is the archive's GCS path followed by
+// the name of the file, such as `gs://bucket/vm.ova/disk1.vmdk`.
+func (s tarMemberSource) Path() string {
+	return s.index.EntryPath(s.entry)
+}
+
+// Whether the resource is a file of a tar archive.
+func isTarMember(s Source) bool {
+	_, ok := s.(tarMemberSource)
+	return ok
+}
+
+func (s tarMemberSource) validate() error {
+	rc, err := storage.NewTarEntryReader(s.storageClient, s.index, s.entry)
+	if err != nil {
+		return daisy.Errf("failed to read GCS file when validating resource file: unable to open "+
+			"file %q: %v", s.Path(), err)
+	}
+	defer rc.Close()
+	return validateFileContent(rc)
+}
+
+// daisyVars returns the variables of inflate_file.wf.json that make the
+// worker download the file with a ranged read of the archive.
+func (s tarMemberSource) daisyVars() map[string]string {
+	return map[string]string{
+		"source_disk_file":        s.index.GcsPath,
+		"source_disk_file_offset": fmt.Sprint(s.entry.Offset),
+		"source_disk_file_length": fmt.Sprint(s.entry.Size),
+		"source_disk_file_name":   path.Base(s.entry.Name),
+	}
+}
+
+// inspect reads the file's header with ranged reads of the archive.
+func (s tarMemberSource) inspect() (imagefile.Metadata, error) {
+	r, err := storage.NewTarEntryReaderAt(s.storageClient, s.index, s.entry)
+	if err != nil {
+		return imagefile.Metadata{}, err
+	}
+	return imagefile.InspectReaderAt(r, s.entry.Size)
+}
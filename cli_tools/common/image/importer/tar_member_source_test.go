@@ -0,0 +1,114 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/test"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/mocks"
+)
+
+func TestNewTarMemberSource(t *testing.T) {
+	index, entry := createTestTarIndex()
+	source, err := NewTarMemberSource(index, entry, createMockArchiveStorageClient(t, "disk content"))
+	assert.NoError(t, err)
+	assert.Equal(t, "gs://bucket/vm.ova/disks/disk1.vmdk", source.Path())
+	assert.True(t, isTarMember(source))
+	assert.False(t, isFile(source))
+}
+
+func TestNewTarMemberSource_RejectsInvalidFiles(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{"empty", "", "cannot import an image from an empty file"},
+		{"gzip", test.CreateCompressedFile(), "the input file is a gzip file, which is not supported"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			index, entry := createTestTarIndex()
+			entry.Size = int64(len(tt.content))
+			_, err := NewTarMemberSource(index, entry, createMockArchiveStorageClient(t, tt.content))
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
+
+func TestCreateDaisyInflater_TarMember_ReadsRangeOfArchive(t *testing.T) {
+	index, entry := createTestTarIndex()
+	source, err := NewTarMemberSource(index, entry, createMockArchiveStorageClient(t, "disk content"))
+	assert.NoError(t, err)
+
+	// The inspector isn't used, since it reads whole objects.
+	inflater := createDaisyInflaterSafe(t, ImageImportRequest{
+		Source:      source,
+		Zone:        "us-west1-c",
+		ExecutionID: "1234",
+	}, nil)
+
+	assert.Equal(t, "gs://bucket/vm.ova", inflater.wf.Vars["source_disk_file"].Value)
+	assert.Equal(t, "1024", inflater.wf.Vars["source_disk_file_offset"].Value)
+	assert.Equal(t, "12", inflater.wf.Vars["source_disk_file_length"].Value)
+	assert.Equal(t, "disk1.vmdk", inflater.wf.Vars["source_disk_file_name"].Value)
+	assert.Equal(t, "10", inflater.wf.Vars["inflated_disk_size_gb"].Value)
+	assert.NotContains(t, inflater.wf.Sources, "source_disk_file",
+		"The archive isn't copied to the workflow's sources.")
+}
+
+func TestCreateInflater_TarMember_UsesDaisyInflater(t *testing.T) {
+	index, entry := createTestTarIndex()
+	source, err := NewTarMemberSource(index, entry, createMockArchiveStorageClient(t, "disk content"))
+	assert.NoError(t, err)
+
+	inflater, err := newInflater(ImageImportRequest{
+		Source:      source,
+		Zone:        "us-west1-b",
+		ExecutionID: "1234",
+		WorkflowDir: daisyWorkflows,
+	}, nil, nil, nil, nil)
+	assert.NoError(t, err)
+	_, ok := inflater.(*daisyInflater)
+	assert.True(t, ok)
+}
+
+func createTestTarIndex() (*storage.TarIndex, storage.TarEntry) {
+	entry := storage.TarEntry{Name: "disks/disk1.vmdk", Offset: 1024, Size: 12}
+	return &storage.TarIndex{GcsPath: "gs://bucket/vm.ova", Entries: []storage.TarEntry{entry}}, entry
+}
+
+// createMockArchiveStorageClient returns a storage client whose gs://bucket/vm.ova
+// object has content at offset 1024.
+func createMockArchiveStorageClient(t *testing.T, content string) *mocks.MockStorageClientInterface {
+	mockCtrl := gomock.NewController(t)
+	archive := append(make([]byte, 1024), []byte(content)...)
+	mockStorageObject := mocks.NewMockStorageObject(mockCtrl)
+	mockStorageObject.EXPECT().NewRangeReader(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(offset, length int64) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(archive[offset : offset+length])), nil
+		}).AnyTimes()
+	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
+	mockStorageClient.EXPECT().GetObject("bucket", "vm.ova").Return(mockStorageObject).AnyTimes()
+	return mockStorageClient
+}
@@ -0,0 +1,465 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/compute/v1"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/disk"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/param"
+	pathutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/path"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+	daisyCompute "github.com/GoogleCloudPlatform/compute-image-tools/daisy/compute"
+	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
+)
+
+// Flags of a VMImportRequest.
+const (
+	SourceFilesFlag      = "source_files"
+	InstanceTemplateFlag = "instance_template"
+	MachineTypeFlag      = "machine_type"
+)
+
+// VMImportRequest includes the parameters required to import the disks of a
+// VM, such as the disk files of a multi-disk virtual appliance.
+//
+// The disks are inspected together to find the boot disk, which is the only
+// one that's translated. Its image is named ImageName, and the image of the
+// disk at position N of Sources is named ImageName-disk-N. The other fields
+// of ImageImportRequest apply to all of the disks; its Source is ignored.
+//
+// When InstanceTemplate is set, an instance template with the images and
+// MachineType is created after the images.
+type VMImportRequest struct {
+	ImageImportRequest
+	Sources          []Source
+	InstanceTemplate string
+	MachineType      string
+}
+
+func (r VMImportRequest) validate() error {
+	if len(r.Sources) == 0 {
+		return fmt.Errorf("-%s must have at least one file", SourceFilesFlag)
+	}
+	// The provenance records of the disks would overwrite each other.
+	if len(r.Sources) > 1 && r.ProvenanceGcsPath != "" {
+		return fmt.Errorf("-%s can't be used when importing more than one disk", ProvenanceGcsPathFlag)
+	}
+	if r.InstanceTemplate != "" && r.DataDisk {
+		return fmt.Errorf("-%s can't be used with -%s, since the template needs a boot disk",
+			InstanceTemplateFlag, DataDiskFlag)
+	}
+	if r.InstanceTemplate != "" && r.MachineType == "" {
+		return fmt.Errorf("-%s is required when -%s is specified", MachineTypeFlag, InstanceTemplateFlag)
+	}
+	return nil
+}
+
+// diskRequests returns the import request of each disk. Like the OVF
+// importer's requests, each disk has its own execution ID, scratch
+// directory, and log prefix, so that their resources don't collide.
+func (r VMImportRequest) diskRequests() []ImageImportRequest {
+	requests := make([]ImageImportRequest, len(r.Sources))
+	for i, source := range r.Sources {
+		request := r.ImageImportRequest
+		request.Source = source
+		request.ImageName = dataDiskImageName(r.ImageName, i)
+		request.ExecutionID = fmt.Sprintf("%s-%d", r.ExecutionID, i+1)
+		request.ScratchBucketGcsPath = pathutils.JoinURL(r.ScratchBucketGcsPath, request.ExecutionID)
+		request.DaisyLogLinePrefix = fmt.Sprintf("disk-%d", i+1)
+		if r.DaisyLogLinePrefix != "" {
+			request.DaisyLogLinePrefix = r.DaisyLogLinePrefix + "-" + request.DaisyLogLinePrefix
+		}
+		request.Labels = map[string]string{}
+		for k, v := range r.Labels {
+			request.Labels[k] = v
+		}
+		requests[i] = request
+	}
+	return requests
+}
+
+// dataDiskImageName is the name of the image of the disk at index i, when
+// it isn't the boot disk.
+func dataDiskImageName(imageName string, i int) string {
+	return fmt.Sprintf("%s-disk-%d", imageName, i+1)
+}
+
+// NewVMImporter constructs an Importer that imports the disks of a VM.
+func NewVMImporter(request VMImportRequest, computeClient daisyCompute.Client,
+	storageClient domain.StorageClientInterface, logger logging.Logger) (Importer, error) {
+	if err := request.validate(); err != nil {
+		return nil, err
+	}
+	v := &vmImporter{
+		request:       request,
+		computeClient: computeClient,
+		storageClient: storageClient,
+		newImageNameValidator: func(name string) validator {
+			return validateImageNameAvailable{project: request.Project, name: name, client: computeClient}
+		},
+		newProcessorProvider: func(request ImageImportRequest, inspector disk.Inspector) processorProvider {
+			return defaultProcessorProvider{
+				request,
+				computeClient,
+				newProcessPlanner(request, inspector, logger),
+				logger,
+			}
+		},
+		logger: logger,
+	}
+	for _, diskRequest := range request.diskRequests() {
+		if err := diskRequest.validate(); err != nil {
+			return nil, err
+		}
+		i, err := newImporter(diskRequest, computeClient, storageClient, logger)
+		if err != nil {
+			return nil, err
+		}
+		diskRequest.Labels = i.labels
+		d := &vmDisk{request: diskRequest, importer: i}
+		if !request.DataDisk {
+			if d.inspector, err = disk.NewInspector(diskRequest.EnvironmentSettings(), logger); err != nil {
+				return nil, err
+			}
+		}
+		v.disks = append(v.disks, d)
+	}
+	if boot, ok := v.knownBootDisk(); ok {
+		v.preValidators = v.imageNameValidators(boot)
+	} else {
+		// The names of the other images are validated once the boot disk
+		// is found.
+		v.preValidators = []validator{v.newImageNameValidator(request.ImageName)}
+	}
+	if request.InstanceTemplate != "" {
+		v.preValidators = append(v.preValidators, validateInstanceTemplateNameAvailable{
+			project: request.Project, name: request.InstanceTemplate, client: computeClient})
+	}
+	return v, nil
+}
+
+// vmImporter imports the disks of a VM concurrently. It uses the steps of
+// importer for each disk, and chooses the processors of the disks once all
+// of them are inflated and inspected.
+type vmImporter struct {
+	request       VMImportRequest
+	disks         []*vmDisk
+	computeClient daisyCompute.Client
+	storageClient domain.StorageClientInterface
+	preValidators []validator
+
+	// newImageNameValidator returns a validator that ensures an image name
+	// isn't used.
+	newImageNameValidator func(name string) validator
+
+	// newProcessorProvider returns the processors of the boot disk, whose
+	// planner uses inspector, and of the data disks.
+	newProcessorProvider func(request ImageImportRequest, inspector disk.Inspector) processorProvider
+	logger               logging.Logger
+}
+
+// vmDisk is a disk of a VM import.
+type vmDisk struct {
+	request    ImageImportRequest
+	importer   *importer
+	inspector  disk.Inspector
+	inspection *pb.InspectionResults
+}
+
+func (v *vmImporter) Run(ctx context.Context) error {
+	if v.request.Timeout.Nanoseconds() > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, v.request.Timeout)
+		defer cancel()
+	}
+	for _, validator := range v.preValidators {
+		if err := validator.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range v.disks {
+		defer d.importer.deleteDisk()
+	}
+
+	err := v.forEachDisk(ctx, func(ctx context.Context, d *vmDisk) error {
+		if err := d.importer.runInflate(ctx); err != nil {
+			return err
+		}
+		if d.importer.integrityChecker != nil {
+			return d.importer.runIntegrityCheck(ctx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	boot, err := v.findBootDisk(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := v.knownBootDisk(); !ok {
+		for _, validator := range v.imageNameValidators(boot) {
+			if err := validator.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := v.assignProcessors(boot); err != nil {
+		return err
+	}
+
+	err = v.forEachDisk(ctx, func(ctx context.Context, d *vmDisk) error {
+		return d.importer.runProcess(ctx)
+	})
+	if err != nil {
+		v.deleteImages()
+		return err
+	}
+
+	for _, d := range v.disks {
+		d.importer.writeProvenance()
+	}
+
+	if v.request.InstanceTemplate != "" {
+		return v.createInstanceTemplate(boot)
+	}
+	return nil
+}
+
+// forEachDisk runs step for the disks concurrently. When a step fails, the
+// others are cancelled.
+func (v *vmImporter) forEachDisk(ctx context.Context, step func(ctx context.Context, d *vmDisk) error) error {
+	group, ctx := errgroup.WithContext(ctx)
+	for _, d := range v.disks {
+		d := d
+		group.Go(func() error {
+			return step(ctx, d)
+		})
+	}
+	return group.Wait()
+}
+
+// findBootDisk returns the index of the disk that's translated, or -1 when
+// all of the disks are imported as data disks.
+//
+// When there's more than one disk, they're inspected, and the first disk
+// that has an operating system and a bootloader is chosen. A disk with an
+// operating system but no detected bootloader is the fallback, and the first
+// disk is used when the user specified the operating system or workflow.
+func (v *vmImporter) findBootDisk(ctx context.Context) (int, error) {
+	if boot, ok := v.knownBootDisk(); ok {
+		return boot, nil
+	}
+
+	// An inspection error isn't fatal, since another disk may be bootable.
+	_ = v.forEachDisk(ctx, func(ctx context.Context, d *vmDisk) error {
+		return d.importer.runStep(ctx, func() error {
+			var err error
+			d.inspection, err = d.inspector.Inspect(d.importer.pd.uri)
+			if err != nil {
+				d.importer.logger.Debug(fmt.Sprintf("Disk inspection error=%v", err))
+				d.inspection = nil
+			}
+			return nil
+		}, d.inspector.Cancel)
+	})
+	if ctx.Err() != nil {
+		return -1, v.disks[0].importer.getCtxError(ctx)
+	}
+
+	boot := -1
+	for i, d := range v.disks {
+		if d.inspection.GetOsCount() > 0 && (d.inspection.GetBiosBootable() || d.inspection.GetUefiBootable()) {
+			boot = i
+			break
+		}
+	}
+	if boot < 0 {
+		for i, d := range v.disks {
+			if d.inspection.GetOsCount() > 0 {
+				boot = i
+				break
+			}
+		}
+	}
+	if boot < 0 {
+		if v.request.OS == "" && v.request.CustomWorkflow == "" {
+			return -1, daisy.Errf("None of the disks has a detectable operating system. "+
+				"Re-import with -%s or -%s to translate the first disk, or with -%s to import all of the disks as data disks.",
+				OSFlag, CustomWorkflowFlag, DataDiskFlag)
+		}
+		boot = 0
+	}
+	v.logger.User(fmt.Sprintf("Using %s as the boot disk.", v.disks[boot].request.Source.Path()))
+	return boot, nil
+}
+
+// knownBootDisk returns the index of the boot disk, or -1 when all of the
+// disks are imported as data disks, when it's known without inspection.
+func (v *vmImporter) knownBootDisk() (int, bool) {
+	if v.request.DataDisk {
+		return -1, true
+	}
+	if len(v.disks) == 1 {
+		return 0, true
+	}
+	return 0, false
+}
+
+// imageNameValidators returns validators of the names of the images that are
+// created when boot is the index of the boot disk, as named by
+// assignProcessors.
+func (v *vmImporter) imageNameValidators(boot int) []validator {
+	var validators []validator
+	for i := range v.disks {
+		name := dataDiskImageName(v.request.ImageName, i)
+		if i == boot {
+			name = v.request.ImageName
+		}
+		validators = append(validators, v.newImageNameValidator(name))
+	}
+	return validators
+}
+
+// assignProcessors names the images and sets the processors of the disks.
+// The boot disk is translated, and the others are imported as data disks.
+func (v *vmImporter) assignProcessors(boot int) error {
+	for i, d := range v.disks {
+		var inspector disk.Inspector
+		if i == boot {
+			d.request.ImageName = v.request.ImageName
+			inspector = d.inspector
+			if d.inspection != nil {
+				inspector = cachedInspector{d.inspection}
+			}
+		} else {
+			d.request.DataDisk = true
+			d.request.OS = ""
+			d.request.BYOL = false
+			d.request.CustomWorkflow = ""
+		}
+		d.importer.processorProvider = v.newProcessorProvider(d.request, inspector)
+		if d.request.VerifyIntegrity {
+			var err error
+			if d.importer.provenanceWriter, err = newProvenanceWriter(d.request, v.storageClient, v.computeClient, d.importer.logger); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteImages deletes the images that were created before an import failed.
+func (v *vmImporter) deleteImages() {
+	for _, d := range v.disks {
+		if image, _ := v.computeClient.GetImage(v.request.Project, d.request.ImageName); image == nil {
+			continue
+		}
+		if err := v.computeClient.DeleteImage(v.request.Project, d.request.ImageName); err != nil {
+			v.logger.User(fmt.Sprintf("Failed to delete image %q: %v", d.request.ImageName, err))
+		}
+	}
+}
+
+// createInstanceTemplate creates a template for VMs with the imported
+// disks. The boot disk is first, and the data disks are in source order.
+func (v *vmImporter) createInstanceTemplate(boot int) error {
+	order := []int{boot}
+	for i := range v.disks {
+		if i != boot {
+			order = append(order, i)
+		}
+	}
+	var disks []*compute.AttachedDisk
+	var sources []string
+	for _, i := range order {
+		disks = append(disks, &compute.AttachedDisk{
+			AutoDelete: true,
+			Boot:       i == boot,
+			Mode:       "READ_WRITE",
+			Type:       "PERSISTENT",
+			InitializeParams: &compute.AttachedDiskInitializeParams{
+				SourceImage: param.GetImageResourcePath(v.request.Project, v.disks[i].request.ImageName),
+			},
+		})
+		sources = append(sources, v.disks[i].request.Source.Path())
+	}
+	networkInterface := &compute.NetworkInterface{
+		Network:    v.request.Network,
+		Subnetwork: v.request.Subnet,
+	}
+	if !v.request.NoExternalIP {
+		networkInterface.AccessConfigs = []*compute.AccessConfig{{Name: "External NAT", Type: "ONE_TO_ONE_NAT"}}
+	}
+	template := &compute.InstanceTemplate{
+		Name:        v.request.InstanceTemplate,
+		Description: "Imported from " + strings.Join(sources, ", "),
+		Properties: &compute.InstanceProperties{
+			MachineType:       v.request.MachineType,
+			Disks:             disks,
+			NetworkInterfaces: []*compute.NetworkInterface{networkInterface},
+			Labels:            v.request.Labels,
+		},
+	}
+	if err := v.computeClient.CreateInstanceTemplate(v.request.Project, template); err != nil {
+		return daisy.Errf("Failed to create instance template %q: %v", v.request.InstanceTemplate, err)
+	}
+	v.logger.User("Created instance template " + v.request.InstanceTemplate)
+	return nil
+}
+
+// cachedInspector is a disk.Inspector that returns the results of an
+// inspection that already ran.
+type cachedInspector struct {
+	results *pb.InspectionResults
+}
+
+func (c cachedInspector) Inspect(reference string) (*pb.InspectionResults, error) {
+	return c.results, nil
+}
+
+func (c cachedInspector) Cancel(reason string) bool {
+	return false
+}
+
+// validateInstanceTemplateNameAvailable is a validator that ensures the
+// instance template of a VM import doesn't exist.
+type validateInstanceTemplateNameAvailable struct {
+	project, name string
+	client        instanceTemplateGetter
+}
+
+func (v validateInstanceTemplateNameAvailable) validate() error {
+	template, _ := v.client.GetInstanceTemplate(v.project, v.name)
+	if template != nil {
+		return fmt.Errorf("The instance template '%s' already exists. "+
+			"Please pick a name that isn't already used.", v.name)
+	}
+	return nil
+}
+
+type instanceTemplateGetter interface {
+	GetInstanceTemplate(project, name string) (*compute.InstanceTemplate, error)
+}
@@ -0,0 +1,363 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/disk"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/mocks"
+	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
+)
+
+func makeValidVMRequest() VMImportRequest {
+	request := VMImportRequest{
+		ImageImportRequest: makeValidRequest(),
+		Sources: []Source{
+			fileSource{gcsPath: "gs://bucket/disk1.vmdk"},
+			fileSource{gcsPath: "gs://bucket/disk2.vmdk"},
+		},
+	}
+	request.ExecutionID = "execution-id"
+	request.ScratchBucketGcsPath = "gs://bucket/execution-id"
+	request.Labels = map[string]string{"env": "test"}
+	request.OS = ""
+	return request
+}
+
+func TestVMImportRequest_diskRequests(t *testing.T) {
+	request := makeValidVMRequest()
+	requests := request.diskRequests()
+	assert.Len(t, requests, 2)
+	for i, diskRequest := range requests {
+		n := i + 1
+		assert.Equal(t, request.Sources[i], diskRequest.Source)
+		assert.Equal(t, fmt.Sprintf("ubuntu20-disk-%d", n), diskRequest.ImageName)
+		assert.Equal(t, fmt.Sprintf("execution-id-%d", n), diskRequest.ExecutionID)
+		assert.Equal(t, fmt.Sprintf("gs://bucket/execution-id/execution-id-%d", n), diskRequest.ScratchBucketGcsPath)
+		assert.Equal(t, fmt.Sprintf("import-image-disk-%d", n), diskRequest.DaisyLogLinePrefix)
+		assert.Equal(t, request.Labels, diskRequest.Labels)
+		assert.NoError(t, diskRequest.validate())
+	}
+	requests[0].Labels["hash"] = "value"
+	assert.NotContains(t, requests[1].Labels, "hash", "Each disk should have its own labels")
+	assert.NotContains(t, request.Labels, "hash", "Each disk should have its own labels")
+}
+
+func TestVMImportRequest_validate(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		modify        func(r *VMImportRequest)
+		expectedError string
+	}{
+		{
+			name:   "valid",
+			modify: func(r *VMImportRequest) {},
+		},
+		{
+			name:          "no sources",
+			modify:        func(r *VMImportRequest) { r.Sources = nil },
+			expectedError: "-source_files must have at least one file",
+		},
+		{
+			name:          "provenance path with many disks",
+			modify:        func(r *VMImportRequest) { r.ProvenanceGcsPath = "gs://bucket/record.json" },
+			expectedError: "-provenance_gcs_path can't be used when importing more than one disk",
+		},
+		{
+			name: "template of data disks",
+			modify: func(r *VMImportRequest) {
+				r.InstanceTemplate = "template"
+				r.MachineType = "n1-standard-1"
+				r.DataDisk = true
+			},
+			expectedError: "-instance_template can't be used with -data_disk, since the template needs a boot disk",
+		},
+		{
+			name:          "template without machine type",
+			modify:        func(r *VMImportRequest) { r.InstanceTemplate = "template" },
+			expectedError: "-machine_type is required when -instance_template is specified",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			request := makeValidVMRequest()
+			tt.modify(&request)
+			err := request.validate()
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestVMImporter_Run_TranslatesBootableDisk_AndCreatesTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	request := makeValidVMRequest()
+	request.Sources = append(request.Sources, fileSource{gcsPath: "gs://bucket/disk3.vmdk"})
+	request.InstanceTemplate = "template"
+	request.MachineType = "n1-standard-4"
+	request.Network = "global/networks/default"
+	request.Subnet = "regions/us-central1/subnetworks/default"
+	request.NoExternalIP = true
+	mockComputeClient := mocks.NewMockClient(ctrl)
+	var template *compute.InstanceTemplate
+	mockComputeClient.EXPECT().CreateInstanceTemplate("project-name", gomock.Any()).Do(
+		func(project string, it *compute.InstanceTemplate) { template = it })
+	expectedTemplate := &compute.InstanceTemplate{
+		Name:        "template",
+		Description: "Imported from gs://bucket/disk2.vmdk, gs://bucket/disk1.vmdk, gs://bucket/disk3.vmdk",
+		Properties: &compute.InstanceProperties{
+			MachineType: "n1-standard-4",
+			Disks: []*compute.AttachedDisk{
+				templateDisk(true, "ubuntu20"),
+				templateDisk(false, "ubuntu20-disk-1"),
+				templateDisk(false, "ubuntu20-disk-3"),
+			},
+			NetworkInterfaces: []*compute.NetworkInterface{{
+				Network:    "global/networks/default",
+				Subnetwork: "regions/us-central1/subnetworks/default",
+			}},
+			Labels: map[string]string{"env": "test"},
+		},
+	}
+	v, providers := newTestVMImporter(request, mockComputeClient, []*pb.InspectionResults{
+		{},
+		{OsCount: 1, BiosBootable: true},
+		{OsCount: 1},
+	})
+
+	assert.NoError(t, v.Run(context.Background()))
+	assert.Equal(t, expectedTemplate, template)
+	assert.Equal(t, []string{"ubuntu20-disk-1", "ubuntu20", "ubuntu20-disk-3"}, imageNames(v))
+	assert.True(t, providers.requests[0].DataDisk)
+	assert.False(t, providers.requests[1].DataDisk)
+	assert.True(t, providers.requests[2].DataDisk)
+	assert.Equal(t, cachedInspector{v.disks[1].inspection}, providers.inspectors[1])
+	for _, d := range v.disks {
+		assert.Equal(t, 1, d.importer.diskClient.(*mockDiskClient).interactions, "Inflated disks should be deleted")
+	}
+}
+
+func TestVMImporter_Run_FallsBackToDiskWithOS(t *testing.T) {
+	v, providers := newTestVMImporter(makeValidVMRequest(), nil, []*pb.InspectionResults{
+		{},
+		{OsCount: 1},
+	})
+	assert.NoError(t, v.Run(context.Background()))
+	assert.Equal(t, []string{"ubuntu20-disk-1", "ubuntu20"}, imageNames(v))
+	assert.True(t, providers.requests[0].DataDisk)
+	assert.False(t, providers.requests[1].DataDisk)
+}
+
+func TestVMImporter_Run_UsesFirstDisk_WhenOSIsSpecified(t *testing.T) {
+	request := makeValidVMRequest()
+	request.OS = "ubuntu-2004"
+	v, providers := newTestVMImporter(request, nil, []*pb.InspectionResults{{}, {}})
+	assert.NoError(t, v.Run(context.Background()))
+	assert.Equal(t, []string{"ubuntu20", "ubuntu20-disk-2"}, imageNames(v))
+	assert.Equal(t, "ubuntu-2004", providers.requests[0].OS)
+	assert.Empty(t, providers.requests[1].OS)
+	assert.True(t, providers.requests[1].DataDisk)
+}
+
+func TestVMImporter_Run_FailsWhenNoDiskHasOS(t *testing.T) {
+	v, providers := newTestVMImporter(makeValidVMRequest(), nil, []*pb.InspectionResults{{}, nil})
+	err := v.Run(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "None of the disks has a detectable operating system")
+	assert.Contains(t, err.Error(), "-data_disk")
+	assert.Empty(t, providers.requests, "Disks shouldn't be processed")
+}
+
+func TestVMImporter_Run_ImportsDataDisks_WithoutInspection(t *testing.T) {
+	request := makeValidVMRequest()
+	request.DataDisk = true
+	v, providers := newTestVMImporter(request, nil, []*pb.InspectionResults{nil, nil})
+	for _, d := range v.disks {
+		d.inspector = nil
+	}
+	assert.NoError(t, v.Run(context.Background()))
+	assert.Equal(t, []string{"ubuntu20-disk-1", "ubuntu20-disk-2"}, imageNames(v))
+	for _, r := range providers.requests {
+		assert.True(t, r.DataDisk)
+	}
+}
+
+func TestVMImporter_Run_DontProcess_IfPreValidationFails(t *testing.T) {
+	v, providers := newTestVMImporter(makeValidVMRequest(), nil, []*pb.InspectionResults{{OsCount: 1}, {}})
+	v.preValidators = append(v.preValidators, mockValidator{err: errors.New("image exists")})
+	assert.EqualError(t, v.Run(context.Background()), "image exists")
+	for _, d := range v.disks {
+		assert.Equal(t, 0, d.importer.inflater.(*mockInflater).interactions)
+	}
+	assert.Empty(t, providers.requests)
+}
+
+func TestVMImporter_Run_ValidatesNamesOfCreatedImages(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		existing      string
+		expectedError string
+	}{
+		{"boot disk's data disk name is unused", "ubuntu20-disk-2", ""},
+		{"data disk name", "ubuntu20-disk-3", "ubuntu20-disk-3 exists"},
+		{"boot disk name", "ubuntu20", "ubuntu20 exists"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			request := makeValidVMRequest()
+			request.Sources = append(request.Sources, fileSource{gcsPath: "gs://bucket/disk3.vmdk"})
+			v, providers := newTestVMImporter(request, nil, []*pb.InspectionResults{
+				{},
+				{OsCount: 1, BiosBootable: true},
+				{},
+			})
+			var validated []string
+			v.newImageNameValidator = func(name string) validator {
+				validated = append(validated, name)
+				if name == tt.existing {
+					return mockValidator{err: errors.New(name + " exists")}
+				}
+				return mockValidator{}
+			}
+
+			err := v.Run(context.Background())
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedError)
+				assert.Empty(t, providers.requests, "Disks shouldn't be processed")
+			}
+			assert.NotContains(t, validated, "ubuntu20-disk-2")
+		})
+	}
+}
+
+func TestVMImporter_imageNameValidators(t *testing.T) {
+	v, _ := newTestVMImporter(makeValidVMRequest(), nil, []*pb.InspectionResults{nil, nil})
+	var validated []string
+	v.newImageNameValidator = func(name string) validator {
+		validated = append(validated, name)
+		return mockValidator{}
+	}
+
+	v.imageNameValidators(-1)
+	assert.Equal(t, []string{"ubuntu20-disk-1", "ubuntu20-disk-2"}, validated, "data disks")
+	validated = nil
+	v.imageNameValidators(1)
+	assert.Equal(t, []string{"ubuntu20-disk-1", "ubuntu20"}, validated, "second disk boots")
+}
+
+func TestVMImporter_Run_DeletesImages_WhenProcessingFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockComputeClient := mocks.NewMockClient(ctrl)
+	mockComputeClient.EXPECT().GetImage("project-name", "ubuntu20").Return(nil, errors.New("not found"))
+	mockComputeClient.EXPECT().GetImage("project-name", "ubuntu20-disk-2").Return(&compute.Image{}, nil)
+	mockComputeClient.EXPECT().DeleteImage("project-name", "ubuntu20-disk-2")
+	v, providers := newTestVMImporter(makeValidVMRequest(), mockComputeClient, []*pb.InspectionResults{{OsCount: 1}, {}})
+	providers.errs = map[string]error{"ubuntu20": errors.New("translation failed")}
+
+	assert.EqualError(t, v.Run(context.Background()), "translation failed")
+}
+
+func TestValidateInstanceTemplateNameAvailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockComputeClient := mocks.NewMockClient(ctrl)
+	mockComputeClient.EXPECT().GetInstanceTemplate("project", "exists").Return(&compute.InstanceTemplate{}, nil)
+	mockComputeClient.EXPECT().GetInstanceTemplate("project", "new").Return(nil, errors.New("not found"))
+
+	assert.EqualError(t, validateInstanceTemplateNameAvailable{"project", "exists", mockComputeClient}.validate(),
+		"The instance template 'exists' already exists. Please pick a name that isn't already used.")
+	assert.NoError(t, validateInstanceTemplateNameAvailable{"project", "new", mockComputeClient}.validate())
+}
+
+// newTestVMImporter returns a vmImporter whose disks have the inspection
+// results, and whose processors are recorded by the returned provider.
+func newTestVMImporter(request VMImportRequest, computeClient *mocks.MockClient,
+	inspections []*pb.InspectionResults) (*vmImporter, *recordingProcessorProviders) {
+	providers := &recordingProcessorProviders{}
+	v := &vmImporter{
+		request:       request,
+		computeClient: computeClient,
+		newImageNameValidator: func(name string) validator {
+			return mockValidator{}
+		},
+		newProcessorProvider: providers.newProvider,
+		logger:               logging.NewToolLogger("[test]"),
+	}
+	for i, diskRequest := range request.diskRequests() {
+		v.disks = append(v.disks, &vmDisk{
+			request: diskRequest,
+			importer: &importer{
+				preValidator: mockValidator{},
+				inflater:     &mockInflater{pd: persistentDisk{uri: fmt.Sprintf("disk-%d", i+1)}},
+				diskClient:   &mockDiskClient{},
+				logger:       logging.NewToolLogger("[test]"),
+			},
+			inspector: cachedInspector{inspections[i]},
+		})
+	}
+	return v, providers
+}
+
+func imageNames(v *vmImporter) []string {
+	var names []string
+	for _, d := range v.disks {
+		names = append(names, d.request.ImageName)
+	}
+	return names
+}
+
+func templateDisk(boot bool, image string) *compute.AttachedDisk {
+	return &compute.AttachedDisk{
+		AutoDelete: true,
+		Boot:       boot,
+		Mode:       "READ_WRITE",
+		Type:       "PERSISTENT",
+		InitializeParams: &compute.AttachedDiskInitializeParams{
+			SourceImage: "projects/project-name/global/images/" + image,
+		},
+	}
+}
+
+// recordingProcessorProviders records the requests and inspectors of the
+// processor providers of a vmImporter, in the order of its disks.
+type recordingProcessorProviders struct {
+	requests   []ImageImportRequest
+	inspectors []disk.Inspector
+	errs       map[string]error
+	mu         sync.Mutex
+}
+
+func (r *recordingProcessorProviders) newProvider(request ImageImportRequest, inspector disk.Inspector) processorProvider {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, request)
+	r.inspectors = append(r.inspectors, inspector)
+	return &mockProcessorProvider{processors: []processor{&mockProcessor{err: r.errs[request.ImageName]}}}
+}
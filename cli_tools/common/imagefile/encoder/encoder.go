@@ -0,0 +1,139 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package encoder writes raw disks as virtual disk files, without qemu-img.
+// The files are written sequentially, so that they can be streamed to Cloud
+// Storage, and blocks of zeros are left unallocated when the format allows it.
+package encoder
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const sectorSize = 512
+
+// Formats that can be written. They're named like qemu-img's formats, except
+// for vpc-fixed, which qemu-img writes with `-O vpc -o subformat=fixed`.
+const (
+	QCOW2    = "qcow2"
+	VMDK     = "vmdk"
+	VPC      = "vpc"
+	VPCFixed = "vpc-fixed"
+)
+
+type encodeFunc func(w io.Writer, disk io.ReaderAt, size int64) error
+
+var encoders = map[string]encodeFunc{
+	QCOW2: encodeQCOW2,
+	VMDK:  encodeVMDK,
+	VPC: func(w io.Writer, disk io.ReaderAt, size int64) error {
+		return encodeVHD(w, disk, size, false)
+	},
+	VPCFixed: func(w io.Writer, disk io.ReaderAt, size int64) error {
+		return encodeVHD(w, disk, size, true)
+	},
+}
+
+// Formats returns the formats that can be written, sorted by name.
+func Formats() []string {
+	var formats []string
+	for format := range encoders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Encode writes the first size bytes of disk to w as a file of format:
+//
+//	qcow2: version 3, with 64 KiB clusters
+//	vmdk: streamOptimized, with compressed 64 KiB grains
+//	vpc: a dynamic VHD, with 2 MiB blocks
+//	vpc-fixed: a fixed VHD
+//
+// The disk is read twice by the formats that list allocated blocks before
+// the data.
+func Encode(w io.Writer, disk io.ReaderAt, size int64, format string) error {
+	encode, ok := encoders[format]
+	if !ok {
+		return fmt.Errorf("format %q is not supported; supported formats are %s",
+			format, strings.Join(Formats(), ", "))
+	}
+	if size <= 0 {
+		return fmt.Errorf("invalid disk size %d", size)
+	}
+	return encode(w, disk, size)
+}
+
+// readBlock reads the block at index into b, padding it with zeros after
+// the end of the disk.
+func readBlock(disk io.ReaderAt, size int64, index int64, b []byte) error {
+	offset := index * int64(len(b))
+	n, err := io.NewSectionReader(disk, 0, size).ReadAt(b, offset)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read disk at offset %d: %w", offset, err)
+	}
+	for i := n; i < len(b); i++ {
+		b[i] = 0
+	}
+	return nil
+}
+
+// allocatedBlocks returns whether each block of the disk has data other
+// than zeros.
+func allocatedBlocks(disk io.ReaderAt, size int64, blockSize int) ([]bool, error) {
+	allocated := make([]bool, ceilDiv(size, int64(blockSize)))
+	b := make([]byte, blockSize)
+	for i := range allocated {
+		if err := readBlock(disk, size, int64(i), b); err != nil {
+			return nil, err
+		}
+		allocated[i] = !isZero(b)
+	}
+	return allocated, nil
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+// offsetWriter counts the bytes that have been written.
+type offsetWriter struct {
+	w      io.Writer
+	offset int64
+}
+
+func (w *offsetWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	return n, err
+}
+
+// padToSector writes zeros up to the next sector boundary.
+func (w *offsetWriter) padToSector() error {
+	_, err := w.Write(make([]byte, (sectorSize-w.offset%sectorSize)%sectorSize))
+	return err
+}
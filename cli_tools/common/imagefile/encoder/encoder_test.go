@@ -0,0 +1,98 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/imagefile"
+)
+
+// testDisk returns a disk of 20 MiB and a partial sector, which has data in
+// its first, tenth, and last MiB.
+func testDisk() []byte {
+	disk := make([]byte, 20<<20+100)
+	copy(disk, "first sector")
+	copy(disk[9<<20+17:], "middle of the disk")
+	disk[len(disk)-1] = 0xaa
+	return disk
+}
+
+func encode(t *testing.T, disk []byte, format string) []byte {
+	var b bytes.Buffer
+	assert.NoError(t, Encode(&b, bytes.NewReader(disk), int64(len(disk)), format))
+	return b.Bytes()
+}
+
+func TestEncode_WritesFormat(t *testing.T) {
+	disk := testDisk()
+	roundedSize := int64(ceilDiv(int64(len(disk)), sectorSize) * sectorSize)
+	for _, tt := range []struct {
+		format         string
+		expectedFormat string
+		expectedSize   int64
+	}{
+		{QCOW2, "qcow2", int64(len(disk))},
+		{VMDK, "vmdk", roundedSize},
+		{VPC, "vpc", roundedSize},
+		{VPCFixed, "vpc", roundedSize},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			file := encode(t, disk, tt.format)
+			info, err := imagefile.ReadImageInfo(bytes.NewReader(file), int64(len(file)))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedFormat, info.Format)
+			assert.Equal(t, tt.expectedSize, info.VirtualSizeBytes)
+		})
+	}
+}
+
+func TestEncode_LeavesZerosUnallocated(t *testing.T) {
+	disk := testDisk()
+	for _, format := range []string{QCOW2, VMDK, VPC} {
+		t.Run(format, func(t *testing.T) {
+			assert.Less(t, len(encode(t, disk, format)), len(disk)/2)
+		})
+	}
+}
+
+func TestEncode_RejectsUnsupportedFormat(t *testing.T) {
+	err := Encode(&bytes.Buffer{}, bytes.NewReader(testDisk()), 100, "vhdx")
+	assert.EqualError(t, err, `format "vhdx" is not supported; supported formats are qcow2, vmdk, vpc, vpc-fixed`)
+}
+
+func TestEncode_RejectsInvalidSize(t *testing.T) {
+	err := Encode(&bytes.Buffer{}, bytes.NewReader(nil), 0, QCOW2)
+	assert.EqualError(t, err, "invalid disk size 0")
+}
+
+func TestEncode_ReturnsReadErrors(t *testing.T) {
+	for _, format := range Formats() {
+		t.Run(format, func(t *testing.T) {
+			err := Encode(&bytes.Buffer{}, failingReader{}, 1<<20, format)
+			assert.EqualError(t, err, "failed to read disk at offset 0: disk failed")
+		})
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) ReadAt(p []byte, off int64) (int, error) {
+	return 0, errors.New("disk failed")
+}
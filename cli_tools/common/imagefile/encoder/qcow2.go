@@ -0,0 +1,156 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package encoder
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	qcow2ClusterBits  = 16
+	qcow2ClusterSize  = 1 << qcow2ClusterBits
+	qcow2HeaderSize   = 104
+	qcow2CopiedFlag   = uint64(1) << 63
+	qcow2RefcountBits = 16
+)
+
+// encodeQCOW2 writes a qcow2 file whose clusters are in this order:
+//
+//	header
+//	refcount table and blocks, which cover every cluster of the file
+//	L1 table
+//	L2 tables, of the L1 entries that have allocated clusters
+//	data
+func encodeQCOW2(w io.Writer, disk io.ReaderAt, size int64) error {
+	allocated, err := allocatedBlocks(disk, size, qcow2ClusterSize)
+	if err != nil {
+		return err
+	}
+	const l2Entries = qcow2ClusterSize / 8
+	l1Entries := ceilDiv(int64(len(allocated)), l2Entries)
+	l1Clusters := ceilDiv(l1Entries*8, qcow2ClusterSize)
+	usedL2 := make([]bool, l1Entries)
+	var l2Clusters, dataClusters int64
+	for i, a := range allocated {
+		if !a {
+			continue
+		}
+		dataClusters++
+		if !usedL2[i/l2Entries] {
+			usedL2[i/l2Entries] = true
+			l2Clusters++
+		}
+	}
+
+	// The refcount blocks count themselves, so their number is found by
+	// iterating until it doesn't change.
+	const refcountsPerBlock = qcow2ClusterSize * 8 / qcow2RefcountBits
+	var tableClusters, blockClusters, totalClusters int64 = 1, 1, 0
+	for {
+		totalClusters = 1 + tableClusters + blockClusters + l1Clusters + l2Clusters + dataClusters
+		blocks := ceilDiv(totalClusters, refcountsPerBlock)
+		table := ceilDiv(blocks*8, qcow2ClusterSize)
+		if blocks == blockClusters && table == tableClusters {
+			break
+		}
+		blockClusters, tableClusters = blocks, table
+	}
+	tableOffset := int64(1)
+	blocksOffset := tableOffset + tableClusters
+	l1Offset := blocksOffset + blockClusters
+	l2Offset := l1Offset + l1Clusters
+	dataOffset := l2Offset + l2Clusters
+
+	header := make([]byte, qcow2ClusterSize)
+	copy(header, "QFI\xfb")
+	binary.BigEndian.PutUint32(header[4:], 3)
+	binary.BigEndian.PutUint32(header[20:], qcow2ClusterBits)
+	binary.BigEndian.PutUint64(header[24:], uint64(size))
+	binary.BigEndian.PutUint32(header[36:], uint32(l1Entries))
+	binary.BigEndian.PutUint64(header[40:], uint64(l1Offset*qcow2ClusterSize))
+	binary.BigEndian.PutUint64(header[48:], uint64(tableOffset*qcow2ClusterSize))
+	binary.BigEndian.PutUint32(header[56:], uint32(tableClusters))
+	binary.BigEndian.PutUint32(header[96:], 4)
+	binary.BigEndian.PutUint32(header[100:], qcow2HeaderSize)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	table := make([]byte, tableClusters*qcow2ClusterSize)
+	for i := int64(0); i < blockClusters; i++ {
+		binary.BigEndian.PutUint64(table[8*i:], uint64((blocksOffset+i)*qcow2ClusterSize))
+	}
+	if _, err := w.Write(table); err != nil {
+		return err
+	}
+	block := make([]byte, qcow2ClusterSize)
+	for i := int64(0); i < blockClusters; i++ {
+		for j := int64(0); j < refcountsPerBlock; j++ {
+			var refcount uint16
+			if i*refcountsPerBlock+j < totalClusters {
+				refcount = 1
+			}
+			binary.BigEndian.PutUint16(block[2*j:], refcount)
+		}
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+	}
+
+	l1 := make([]byte, l1Clusters*qcow2ClusterSize)
+	next := l2Offset
+	for i, used := range usedL2 {
+		if used {
+			binary.BigEndian.PutUint64(l1[8*i:], uint64(next*qcow2ClusterSize)|qcow2CopiedFlag)
+			next++
+		}
+	}
+	if _, err := w.Write(l1); err != nil {
+		return err
+	}
+	next = dataOffset
+	l2 := make([]byte, qcow2ClusterSize)
+	for i, used := range usedL2 {
+		if !used {
+			continue
+		}
+		for j := int64(0); j < l2Entries; j++ {
+			var entry uint64
+			if cluster := int64(i)*l2Entries + j; cluster < int64(len(allocated)) && allocated[cluster] {
+				entry = uint64(next*qcow2ClusterSize) | qcow2CopiedFlag
+				next++
+			}
+			binary.BigEndian.PutUint64(l2[8*j:], entry)
+		}
+		if _, err := w.Write(l2); err != nil {
+			return err
+		}
+	}
+
+	cluster := make([]byte, qcow2ClusterSize)
+	for i, a := range allocated {
+		if !a {
+			continue
+		}
+		if err := readBlock(disk, size, int64(i), cluster); err != nil {
+			return err
+		}
+		if _, err := w.Write(cluster); err != nil {
+			return err
+		}
+	}
+	return nil
+}
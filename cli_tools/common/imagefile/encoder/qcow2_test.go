@@ -0,0 +1,63 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/disk/offline"
+)
+
+func TestEncodeQCOW2_ReadsAsDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qcow2")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	disk := testDisk()
+	filename := filepath.Join(dir, "disk.qcow2")
+	require.NoError(t, ioutil.WriteFile(filename, encode(t, disk, QCOW2), 0644))
+
+	image, err := offline.OpenImage(filename)
+	require.NoError(t, err)
+	defer image.Close()
+	assert.Equal(t, int64(len(disk)), image.Size())
+	actual := make([]byte, len(disk))
+	_, err = image.ReadAt(actual, 0)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(disk, actual), "disk content differs")
+}
+
+func TestEncodeQCOW2_CountsReferencesOfEveryCluster(t *testing.T) {
+	file := encode(t, testDisk(), QCOW2)
+	clusters := len(file) / qcow2ClusterSize
+	assert.Equal(t, 0, len(file)%qcow2ClusterSize)
+
+	tableOffset := binary.BigEndian.Uint64(file[48:])
+	blockOffset := binary.BigEndian.Uint64(file[tableOffset:])
+	for i := 0; i < qcow2ClusterSize/2; i++ {
+		expected := uint16(0)
+		if i < clusters {
+			expected = 1
+		}
+		assert.Equal(t, expected, binary.BigEndian.Uint16(file[blockOffset+uint64(2*i):]), "cluster %d", i)
+	}
+}
@@ -0,0 +1,201 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package encoder
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	vhdBlockSize         = 2 << 20
+	vhdFooterSize        = 512
+	vhdDynamicHeaderSize = 1024
+	vhdTypeFixed         = 2
+	vhdTypeDynamic       = 3
+	vhdNoOffset          = ^uint64(0)
+	vhdUnallocated       = ^uint32(0)
+)
+
+// vhdEpoch is the start of VHD timestamps.
+var vhdEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// encodeVHD writes a fixed VHD, which is the disk followed by a footer, or a
+// dynamic VHD:
+//
+//	copy of the footer
+//	dynamic disk header
+//	block allocation table
+//	blocks, each of which is a sector bitmap followed by the data
+//	footer
+func encodeVHD(w io.Writer, disk io.ReaderAt, size int64, fixed bool) error {
+	// The size of VHDs is a number of sectors.
+	vhdSize := ceilDiv(size, sectorSize) * sectorSize
+	if fixed {
+		block := make([]byte, vhdBlockSize)
+		for i := int64(0); i < ceilDiv(vhdSize, vhdBlockSize); i++ {
+			if err := readBlock(disk, size, i, block); err != nil {
+				return err
+			}
+			n := minInt64(vhdBlockSize, vhdSize-i*vhdBlockSize)
+			if _, err := w.Write(block[:n]); err != nil {
+				return err
+			}
+		}
+		_, err := w.Write(vhdFooter(vhdSize, vhdTypeFixed))
+		return err
+	}
+
+	allocated, err := allocatedBlocks(disk, size, vhdBlockSize)
+	if err != nil {
+		return err
+	}
+	footer := vhdFooter(vhdSize, vhdTypeDynamic)
+	tableOffset := int64(vhdFooterSize + vhdDynamicHeaderSize)
+	tableSize := ceilDiv(int64(len(allocated))*4, sectorSize) * sectorSize
+	header := make([]byte, vhdDynamicHeaderSize)
+	copy(header, "cxsparse")
+	binary.BigEndian.PutUint64(header[8:], vhdNoOffset)
+	binary.BigEndian.PutUint64(header[16:], uint64(tableOffset))
+	binary.BigEndian.PutUint32(header[24:], 0x00010000)
+	binary.BigEndian.PutUint32(header[28:], uint32(len(allocated)))
+	binary.BigEndian.PutUint32(header[32:], vhdBlockSize)
+	binary.BigEndian.PutUint32(header[36:], vhdChecksum(header))
+
+	// Each block is preceded by a bitmap of its sectors, padded to a sector.
+	const bitmapSize = (vhdBlockSize/sectorSize/8 + sectorSize - 1) / sectorSize * sectorSize
+	table := make([]byte, tableSize)
+	next := tableOffset + tableSize
+	for i, a := range allocated {
+		entry := vhdUnallocated
+		if a {
+			entry = uint32(next / sectorSize)
+			next += bitmapSize + vhdBlockSize
+		}
+		binary.BigEndian.PutUint32(table[4*i:], entry)
+	}
+	for i := len(allocated) * 4; i < len(table); i++ {
+		table[i] = 0xff
+	}
+	for _, b := range [][]byte{footer, header, table} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	bitmap := make([]byte, bitmapSize)
+	for i := range bitmap {
+		bitmap[i] = 0xff
+	}
+	block := make([]byte, vhdBlockSize)
+	for i, a := range allocated {
+		if !a {
+			continue
+		}
+		if err := readBlock(disk, size, int64(i), block); err != nil {
+			return err
+		}
+		if _, err := w.Write(bitmap); err != nil {
+			return err
+		}
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(footer)
+	return err
+}
+
+// vhdFooter returns the footer of a VHD of size bytes.
+func vhdFooter(size int64, diskType uint32) []byte {
+	footer := make([]byte, vhdFooterSize)
+	copy(footer, "conectix")
+	binary.BigEndian.PutUint32(footer[8:], 2)
+	binary.BigEndian.PutUint32(footer[12:], 0x00010000)
+	dataOffset := vhdNoOffset
+	if diskType == vhdTypeDynamic {
+		dataOffset = vhdFooterSize
+	}
+	binary.BigEndian.PutUint64(footer[16:], dataOffset)
+	binary.BigEndian.PutUint32(footer[24:], uint32(time.Since(vhdEpoch).Seconds()))
+	// Readers such as qemu use the current size, rather than the geometry,
+	// when the creator is Hyper-V.
+	copy(footer[28:], "win ")
+	binary.BigEndian.PutUint32(footer[32:], 0x000a0000)
+	copy(footer[36:], "Wi2k")
+	binary.BigEndian.PutUint64(footer[40:], uint64(size))
+	binary.BigEndian.PutUint64(footer[48:], uint64(size))
+	cylinders, heads, sectors := vhdGeometry(size / sectorSize)
+	binary.BigEndian.PutUint16(footer[56:], cylinders)
+	footer[58], footer[59] = heads, sectors
+	binary.BigEndian.PutUint32(footer[60:], diskType)
+	rand.Read(footer[68:84])
+	binary.BigEndian.PutUint32(footer[64:], vhdChecksum(footer))
+	return footer
+}
+
+// vhdGeometry calculates the CHS geometry of a disk, using the algorithm of
+// the VHD specification.
+func vhdGeometry(totalSectors int64) (cylinders uint16, heads, sectorsPerTrack uint8) {
+	if totalSectors > 65535*16*255 {
+		totalSectors = 65535 * 16 * 255
+	}
+	var spt, h, cylinderTimesHeads int64
+	if totalSectors >= 65535*16*63 {
+		spt, h = 255, 16
+		cylinderTimesHeads = totalSectors / spt
+	} else {
+		spt = 17
+		cylinderTimesHeads = totalSectors / spt
+		h = (cylinderTimesHeads + 1023) / 1024
+		if h < 4 {
+			h = 4
+		}
+		if cylinderTimesHeads >= h*1024 || h > 16 {
+			spt, h = 31, 16
+			cylinderTimesHeads = totalSectors / spt
+		}
+		if cylinderTimesHeads >= h*1024 {
+			spt, h = 63, 16
+			cylinderTimesHeads = totalSectors / spt
+		}
+	}
+	return uint16(cylinderTimesHeads / h), uint8(h), uint8(spt)
+}
+
+// vhdChecksum is the one's complement of the sum of the bytes of a footer or
+// dynamic disk header, excluding its checksum field.
+func vhdChecksum(b []byte) uint32 {
+	checksumOffset := 64
+	if string(b[:8]) == "cxsparse" {
+		checksumOffset = 36
+	}
+	var sum uint32
+	for i, v := range b {
+		if i < checksumOffset || i >= checksumOffset+4 {
+			sum += uint32(v)
+		}
+	}
+	return ^sum
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,86 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeVHD_Fixed(t *testing.T) {
+	disk := testDisk()
+	file := encode(t, disk, VPCFixed)
+	vhdSize := len(file) - vhdFooterSize
+	assert.Equal(t, ceilDiv(int64(len(disk)), sectorSize)*sectorSize, int64(vhdSize))
+	assert.True(t, bytes.Equal(disk, file[:len(disk)]), "disk content differs")
+	assert.True(t, isZero(file[len(disk):vhdSize]))
+
+	footer := file[vhdSize:]
+	assert.Equal(t, uint32(vhdTypeFixed), binary.BigEndian.Uint32(footer[60:]))
+	assert.Equal(t, vhdNoOffset, binary.BigEndian.Uint64(footer[16:]))
+	assert.Equal(t, vhdChecksum(footer), binary.BigEndian.Uint32(footer[64:]))
+}
+
+func TestEncodeVHD_Dynamic(t *testing.T) {
+	disk := testDisk()
+	file := encode(t, disk, VPC)
+	footer := file[len(file)-vhdFooterSize:]
+	require.Equal(t, footer, file[:vhdFooterSize])
+	assert.Equal(t, uint32(vhdTypeDynamic), binary.BigEndian.Uint32(footer[60:]))
+	assert.Equal(t, vhdChecksum(footer), binary.BigEndian.Uint32(footer[64:]))
+
+	header := file[binary.BigEndian.Uint64(footer[16:]):][:vhdDynamicHeaderSize]
+	require.Equal(t, "cxsparse", string(header[:8]))
+	assert.Equal(t, vhdChecksum(header), binary.BigEndian.Uint32(header[36:]))
+	tableOffset := binary.BigEndian.Uint64(header[16:])
+	entries := int(binary.BigEndian.Uint32(header[28:]))
+	blockSize := int(binary.BigEndian.Uint32(header[32:]))
+	require.Equal(t, 11, entries)
+
+	// Each block's bitmap is one sector.
+	actual := make([]byte, entries*blockSize)
+	var allocated []int
+	for i := 0; i < entries; i++ {
+		sector := binary.BigEndian.Uint32(file[tableOffset+uint64(4*i):])
+		if sector == vhdUnallocated {
+			continue
+		}
+		allocated = append(allocated, i)
+		data := int(sector)*sectorSize + sectorSize
+		copy(actual[i*blockSize:], file[data:data+blockSize])
+	}
+	assert.Equal(t, []int{0, 4, 10}, allocated)
+	assert.True(t, bytes.Equal(disk, actual[:len(disk)]), "disk content differs")
+}
+
+func TestVHDGeometry(t *testing.T) {
+	for _, tt := range []struct {
+		sectors   int64
+		cylinders uint16
+		heads     uint8
+		spt       uint8
+	}{
+		{sectors: 20 << 11, cylinders: 602, heads: 4, spt: 17},
+		{sectors: 10 << 21, cylinders: 20805, heads: 16, spt: 63},
+		{sectors: 1 << 40, cylinders: 65535, heads: 16, spt: 255},
+	} {
+		cylinders, heads, spt := vhdGeometry(tt.sectors)
+		assert.Equal(t, []interface{}{tt.cylinders, tt.heads, tt.spt}, []interface{}{cylinders, heads, spt}, "sectors %d", tt.sectors)
+	}
+}
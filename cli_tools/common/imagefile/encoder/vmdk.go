@@ -0,0 +1,192 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	vmdkGrainSectors = 128
+	vmdkGrainSize    = vmdkGrainSectors * sectorSize
+	vmdkGTEntries    = 512
+	// Flags for a valid newline test, compressed grains, and markers.
+	vmdkStreamFlags   = 1 | 1<<16 | 1<<17
+	vmdkCompressDefl  = 1
+	vmdkGDAtEnd       = ^uint64(0)
+	vmdkMarkerEOS     = 0
+	vmdkMarkerGT      = 1
+	vmdkMarkerGD      = 2
+	vmdkMarkerFooter  = 3
+	vmdkMaxCylinders  = 65535
+	vmdkGeometryHeads = 255
+	vmdkGeometrySecs  = 63
+)
+
+// encodeVMDK writes a streamOptimized VMDK, which is written in one pass:
+//
+//	header, with the grain directory at the end
+//	descriptor
+//	for each grain table that has data: its grains, then the table
+//	grain directory
+//	footer, which is the header with the grain directory's offset
+//	end-of-stream marker
+//
+// Grains of zeros are left out.
+func encodeVMDK(w io.Writer, disk io.ReaderAt, size int64) error {
+	capacity := ceilDiv(size, sectorSize)
+	descriptor := vmdkDescriptor(capacity)
+	descriptorSectors := ceilDiv(int64(len(descriptor)), sectorSize)
+	out := &offsetWriter{w: w}
+	if _, err := out.Write(vmdkHeader(capacity, descriptorSectors, vmdkGDAtEnd)); err != nil {
+		return err
+	}
+	if _, err := out.Write([]byte(descriptor)); err != nil {
+		return err
+	}
+	if err := out.padToSector(); err != nil {
+		return err
+	}
+
+	grains := ceilDiv(size, vmdkGrainSize)
+	directory := make([]byte, ceilDiv(grains, vmdkGTEntries)*4)
+	table := make([]byte, vmdkGTEntries*4)
+	grain := make([]byte, vmdkGrainSize)
+	var compressed bytes.Buffer
+	for gt := int64(0); gt*vmdkGTEntries < grains; gt++ {
+		used := false
+		for i := int64(0); i < vmdkGTEntries; i++ {
+			var entry uint32
+			index := gt*vmdkGTEntries + i
+			if index < grains {
+				if err := readBlock(disk, size, index, grain); err != nil {
+					return err
+				}
+			}
+			if index < grains && !isZero(grain) {
+				compressed.Reset()
+				z := zlib.NewWriter(&compressed)
+				if _, err := z.Write(grain); err != nil {
+					return err
+				}
+				if err := z.Close(); err != nil {
+					return err
+				}
+				entry = uint32(out.offset / sectorSize)
+				marker := make([]byte, 12)
+				binary.LittleEndian.PutUint64(marker, uint64(index*vmdkGrainSectors))
+				binary.LittleEndian.PutUint32(marker[8:], uint32(compressed.Len()))
+				if _, err := out.Write(marker); err != nil {
+					return err
+				}
+				if _, err := out.Write(compressed.Bytes()); err != nil {
+					return err
+				}
+				if err := out.padToSector(); err != nil {
+					return err
+				}
+				used = true
+			}
+			binary.LittleEndian.PutUint32(table[4*i:], entry)
+		}
+		if !used {
+			continue
+		}
+		if err := writeVMDKMarker(out, int64(len(table)), vmdkMarkerGT); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(directory[4*gt:], uint32(out.offset/sectorSize))
+		if _, err := out.Write(table); err != nil {
+			return err
+		}
+	}
+
+	if err := writeVMDKMarker(out, int64(len(directory)), vmdkMarkerGD); err != nil {
+		return err
+	}
+	directoryOffset := out.offset / sectorSize
+	if _, err := out.Write(directory); err != nil {
+		return err
+	}
+	if err := out.padToSector(); err != nil {
+		return err
+	}
+	if err := writeVMDKMarker(out, sectorSize, vmdkMarkerFooter); err != nil {
+		return err
+	}
+	if _, err := out.Write(vmdkHeader(capacity, descriptorSectors, uint64(directoryOffset))); err != nil {
+		return err
+	}
+	return writeVMDKMarker(out, 0, vmdkMarkerEOS)
+}
+
+// writeVMDKMarker writes the sector of a metadata marker, whose metadata
+// is size bytes.
+func writeVMDKMarker(w io.Writer, size int64, markerType uint32) error {
+	marker := make([]byte, sectorSize)
+	binary.LittleEndian.PutUint64(marker, uint64(ceilDiv(size, sectorSize)))
+	binary.LittleEndian.PutUint32(marker[12:], markerType)
+	_, err := w.Write(marker)
+	return err
+}
+
+func vmdkHeader(capacity, descriptorSectors int64, directoryOffset uint64) []byte {
+	header := make([]byte, sectorSize)
+	copy(header, "KDMV")
+	binary.LittleEndian.PutUint32(header[4:], 3)
+	binary.LittleEndian.PutUint32(header[8:], vmdkStreamFlags)
+	binary.LittleEndian.PutUint64(header[12:], uint64(capacity))
+	binary.LittleEndian.PutUint64(header[20:], vmdkGrainSectors)
+	binary.LittleEndian.PutUint64(header[28:], 1)
+	binary.LittleEndian.PutUint64(header[36:], uint64(descriptorSectors))
+	binary.LittleEndian.PutUint32(header[44:], vmdkGTEntries)
+	binary.LittleEndian.PutUint64(header[56:], directoryOffset)
+	binary.LittleEndian.PutUint64(header[64:], uint64(1+descriptorSectors))
+	copy(header[73:], "\n \r\n")
+	binary.LittleEndian.PutUint16(header[77:], vmdkCompressDefl)
+	return header
+}
+
+func vmdkDescriptor(capacity int64) string {
+	cid := make([]byte, 4)
+	rand.Read(cid)
+	cylinders := capacity / (vmdkGeometryHeads * vmdkGeometrySecs)
+	if cylinders > vmdkMaxCylinders {
+		cylinders = vmdkMaxCylinders
+	}
+	return fmt.Sprintf(`# Disk DescriptorFile
+version=1
+CID=%x
+parentCID=ffffffff
+createType="streamOptimized"
+
+# Extent description
+RW %d SPARSE "disk.vmdk"
+
+# The Disk Data Base
+#DDB
+
+ddb.virtualHWVersion = "4"
+ddb.geometry.cylinders = "%d"
+ddb.geometry.heads = "%d"
+ddb.geometry.sectors = "%d"
+ddb.adapterType = "lsilogic"
+`, cid, capacity, cylinders, vmdkGeometryHeads, vmdkGeometrySecs)
+}
@@ -0,0 +1,80 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeVMDK(t *testing.T) {
+	disk := testDisk()
+	file := encode(t, disk, VMDK)
+	require.Equal(t, 0, len(file)%sectorSize)
+	header := file[:sectorSize]
+	assert.Equal(t, vmdkGDAtEnd, binary.LittleEndian.Uint64(header[56:]))
+	descriptor := file[binary.LittleEndian.Uint64(header[28:])*sectorSize:][:binary.LittleEndian.Uint64(header[36:])*sectorSize]
+	assert.Contains(t, string(descriptor), `createType="streamOptimized"`)
+	assert.Contains(t, string(descriptor), `RW 40961 SPARSE "disk.vmdk"`)
+
+	// The stream ends with the footer's marker, the footer, and the
+	// end-of-stream marker.
+	end := len(file)
+	assert.True(t, isZero(file[end-sectorSize:]))
+	assert.Equal(t, uint32(vmdkMarkerFooter), binary.LittleEndian.Uint32(file[end-3*sectorSize+12:]))
+	footer := file[end-2*sectorSize : end-sectorSize]
+	assert.Equal(t, header[:56], footer[:56])
+
+	capacity := binary.LittleEndian.Uint64(footer[12:]) * sectorSize
+	directory := file[binary.LittleEndian.Uint64(footer[56:])*sectorSize:]
+	actual := make([]byte, capacity)
+	var grains int
+	for gt := 0; uint64(gt*vmdkGTEntries*vmdkGrainSize) < capacity; gt++ {
+		tableSector := binary.LittleEndian.Uint32(directory[4*gt:])
+		if tableSector == 0 {
+			continue
+		}
+		assert.Equal(t, uint32(vmdkMarkerGT), binary.LittleEndian.Uint32(file[(tableSector-1)*sectorSize+12:]))
+		for i := 0; i < vmdkGTEntries; i++ {
+			grainSector := binary.LittleEndian.Uint32(file[int(tableSector)*sectorSize+4*i:])
+			if grainSector == 0 {
+				continue
+			}
+			grains++
+			marker := file[grainSector*sectorSize:]
+			lba := binary.LittleEndian.Uint64(marker)
+			assert.Equal(t, uint64((gt*vmdkGTEntries+i)*vmdkGrainSectors), lba)
+			z, err := zlib.NewReader(bytes.NewReader(marker[12 : 12+binary.LittleEndian.Uint32(marker[8:])]))
+			require.NoError(t, err)
+			grain, err := ioutil.ReadAll(z)
+			require.NoError(t, err)
+			copy(actual[lba*sectorSize:], grain)
+		}
+	}
+	assert.Equal(t, 3, grains)
+	assert.True(t, bytes.Equal(disk, actual[:len(disk)]), "disk content differs")
+	assert.True(t, isZero(actual[len(disk):]))
+}
+
+func TestVMDKDescriptor_LimitsCylinders(t *testing.T) {
+	assert.True(t, strings.Contains(vmdkDescriptor(1<<40), `ddb.geometry.cylinders = "65535"`))
+}
@@ -0,0 +1,389 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package imagefile
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
+)
+
+const (
+	sectorSize = 512
+
+	// Both the header of a VMDK descriptor file, and the descriptor
+	// itself, are expected to fit in this many bytes.
+	maxVMDKDescriptorSize = 64 * 1024
+
+	// The VHDX region tables are at 192 KiB and 256 KiB.
+	vhdxRegionTableOffset       = 192 * 1024
+	vhdxRegionTableBackupOffset = 256 * 1024
+)
+
+var (
+	// GUIDs of VHDX regions and metadata items, in their on-disk encoding.
+	vhdxMetadataRegionGUID = []byte{
+		0x06, 0xa2, 0x7c, 0x8b, 0x90, 0x47, 0x9a, 0x4b, 0xb8, 0xfe, 0x57, 0x5f, 0x05, 0x0f, 0x88, 0x6e}
+	vhdxVirtualDiskSizeGUID = []byte{
+		0x24, 0x42, 0xa5, 0x2f, 0x1b, 0xcd, 0x76, 0x48, 0xb2, 0x11, 0x5d, 0xbe, 0xd8, 0x3b, 0xf4, 0xb8}
+)
+
+// NewGCSHeaderInspector returns an inspector that inspects image files
+// that are stored in GCS, by parsing their headers with ranged reads. Unlike
+// the inspector returned by NewGCSInspector, it doesn't require qemu-img or
+// gcsfuse. The Inspect method expects a GCS URI to the file to be inspected.
+//
+// VMDK, VHD, VHDX, QCOW, QCOW2 and VDI files are recognized. Other files
+// are reported as raw.
+func NewGCSHeaderInspector(storageClient domain.StorageClientInterface) Inspector {
+	return headerInspector{open: func(ctx context.Context, gcsURI string) (imageReader, error) {
+		return openGCSImage(storageClient, gcsURI)
+	}}
+}
+
+// NewLocalHeaderInspector returns an inspector that inspects image files on
+// the local filesystem, in the same way as the inspector returned by
+// NewGCSHeaderInspector. The Inspect method expects the path to the file.
+func NewLocalHeaderInspector() Inspector {
+	return headerInspector{open: func(ctx context.Context, filename string) (imageReader, error) {
+		return openLocalImage(filename)
+	}}
+}
+
+// imageReader reads ranges of an image file.
+type imageReader interface {
+	io.ReaderAt
+	io.Closer
+	// Size returns the size of the file, in bytes.
+	Size() int64
+}
+
+// headerInspector implements Inspector by parsing the headers of image files.
+type headerInspector struct {
+	open func(ctx context.Context, reference string) (imageReader, error)
+}
+
+func (inspector headerInspector) Inspect(ctx context.Context, reference string) (metadata Metadata, err error) {
+	operation := func() error {
+		metadata, err = inspector.inspectOnce(ctx, reference)
+		return err
+	}
+	return metadata, backoff.Retry(operation,
+		backoff.WithContext(backoff.NewConstantBackOff(50*time.Millisecond), ctx))
+}
+
+func (inspector headerInspector) inspectOnce(ctx context.Context, reference string) (metadata Metadata, err error) {
+	r, err := inspector.open(ctx, reference)
+	if err != nil {
+		return metadata, err
+	}
+	defer r.Close()
+	metadata, err = InspectReaderAt(r, r.Size())
+	if err != nil {
+		var formatErr formatError
+		if errors.As(err, &formatErr) {
+			// The file won't change between attempts.
+			return metadata, backoff.Permanent(fmt.Errorf("failed to inspect %q: %w", reference, err))
+		}
+		return metadata, err
+	}
+	return metadata, nil
+}
+
+// InspectReaderAt returns the Metadata of the image file read by r, whose
+// size is size. It allows files that aren't objects, such as the files of
+// an archive, to be inspected.
+func InspectReaderAt(r io.ReaderAt, size int64) (Metadata, error) {
+	info, err := ReadImageInfo(r, size)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return Metadata{
+		PhysicalSizeGB: bytesToGB(info.ActualSizeBytes),
+		VirtualSizeGB:  bytesToGB(info.VirtualSizeBytes),
+		FileFormat:     info.Format,
+	}, nil
+}
+
+// formatError is returned when the header of an image file is invalid.
+type formatError string
+
+func (e formatError) Error() string {
+	return string(e)
+}
+
+func formatErrorf(format string, a ...interface{}) error {
+	return formatError(fmt.Sprintf(format, a...))
+}
+
+// ReadImageInfo determines the format and sizes of the image file read by r,
+// using the same format names as `qemu-img info`. size is the size of the
+// file, which is reported as its actual size.
+func ReadImageInfo(r io.ReaderAt, size int64) (ImageInfo, error) {
+	header := make([]byte, sectorSize)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return ImageInfo{}, err
+	}
+	header = header[:n]
+
+	info := ImageInfo{ActualSizeBytes: size}
+	switch {
+	case bytes.HasPrefix(header, []byte("QFI\xfb")):
+		info.Format, info.VirtualSizeBytes, err = parseQCOW(header)
+	case bytes.HasPrefix(header, []byte("KDMV")):
+		info.Format, info.VirtualSizeBytes, err = parseSparseVMDK(header)
+	case bytes.HasPrefix(header, []byte("# Disk DescriptorFile")):
+		info.Format, info.VirtualSizeBytes, err = parseVMDKDescriptor(r, size)
+	case bytes.HasPrefix(header, []byte("vhdxfile")):
+		info.Format, info.VirtualSizeBytes, err = parseVHDX(r)
+	case len(header) >= 0x48 && binary.LittleEndian.Uint32(header[0x40:]) == 0xbeda107f:
+		info.Format, info.VirtualSizeBytes, err = parseVDI(header)
+	default:
+		var isVHD bool
+		isVHD, info.VirtualSizeBytes, err = parseVHD(r, header, size)
+		if !isVHD {
+			info.Format, info.VirtualSizeBytes = "raw", size
+		} else {
+			info.Format = "vpc"
+		}
+	}
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	if info.VirtualSizeBytes < 0 {
+		return ImageInfo{}, formatErrorf("invalid %s header: virtual size %d", info.Format, info.VirtualSizeBytes)
+	}
+	return info, nil
+}
+
+// parseQCOW reads the size from a QCOW header. The size has the same offset
+// in all versions of the format.
+func parseQCOW(header []byte) (string, int64, error) {
+	if len(header) < 32 {
+		return "", 0, formatErrorf("truncated qcow header")
+	}
+	format := "qcow2"
+	if binary.BigEndian.Uint32(header[4:]) == 1 {
+		format = "qcow"
+	}
+	return format, int64(binary.BigEndian.Uint64(header[24:])), nil
+}
+
+// parseSparseVMDK reads the capacity, in sectors, from the header of a
+// sparse or stream-optimized VMDK extent.
+func parseSparseVMDK(header []byte) (string, int64, error) {
+	if len(header) < 20 {
+		return "", 0, formatErrorf("truncated vmdk header")
+	}
+	return "vmdk", int64(binary.LittleEndian.Uint64(header[12:])) * sectorSize, nil
+}
+
+// parseVMDKDescriptor sums the sizes of the extents of a VMDK descriptor file.
+func parseVMDKDescriptor(r io.ReaderAt, size int64) (string, int64, error) {
+	if size > maxVMDKDescriptorSize {
+		size = maxVMDKDescriptorSize
+	}
+	var sectors int64
+	scanner := bufio.NewScanner(io.NewSectionReader(r, 0, size))
+	for scanner.Scan() {
+		// Extents are described as: ACCESS SECTORS TYPE ["FILENAME" [OFFSET]]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		switch fields[0] {
+		case "RW", "RDONLY", "NOACCESS":
+			n, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return "", 0, formatErrorf("invalid vmdk extent %q", scanner.Text())
+			}
+			sectors += n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", 0, err
+	}
+	return "vmdk", sectors * sectorSize, nil
+}
+
+// parseVDI reads the disk size from a VDI header.
+func parseVDI(header []byte) (string, int64, error) {
+	if len(header) < 0x178 {
+		return "", 0, formatErrorf("truncated vdi header")
+	}
+	return "vdi", int64(binary.LittleEndian.Uint64(header[0x170:])), nil
+}
+
+// parseVHD reads the current size from the footer of a VHD. The footer is
+// at the end of the file, and dynamic disks also have a copy at the start.
+// The first return value is false when neither has the VHD cookie.
+func parseVHD(r io.ReaderAt, header []byte, size int64) (bool, int64, error) {
+	footer := make([]byte, sectorSize)
+	if size >= sectorSize {
+		if _, err := r.ReadAt(footer, size-sectorSize); err != nil && err != io.EOF {
+			return false, 0, err
+		}
+	}
+	if !bytes.HasPrefix(footer, []byte("conectix")) {
+		if !bytes.HasPrefix(header, []byte("conectix")) || len(header) < 56 {
+			return false, 0, nil
+		}
+		footer = header
+	}
+	return true, int64(binary.BigEndian.Uint64(footer[48:])), nil
+}
+
+// parseVHDX finds the virtual disk size in the metadata region of a VHDX.
+func parseVHDX(r io.ReaderAt) (string, int64, error) {
+	metadataOffset, err := findVHDXMetadataRegion(r, vhdxRegionTableOffset)
+	if err != nil {
+		// The region tables are identical, the backup is only read when
+		// the first is corrupt.
+		if metadataOffset, err = findVHDXMetadataRegion(r, vhdxRegionTableBackupOffset); err != nil {
+			return "", 0, err
+		}
+	}
+
+	table := make([]byte, 32*1024)
+	if _, err := r.ReadAt(table, metadataOffset); err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	if !bytes.HasPrefix(table, []byte("metadata")) {
+		return "", 0, formatErrorf("vhdx metadata table not found")
+	}
+	count := int(binary.LittleEndian.Uint16(table[10:]))
+	for i := 0; i < count && 32+32*(i+1) <= len(table); i++ {
+		entry := table[32+32*i:]
+		if bytes.Equal(entry[:16], vhdxVirtualDiskSizeGUID) {
+			value := make([]byte, 8)
+			offset := metadataOffset + int64(binary.LittleEndian.Uint32(entry[16:]))
+			if _, err := r.ReadAt(value, offset); err != nil && err != io.EOF {
+				return "", 0, err
+			}
+			return "vhdx", int64(binary.LittleEndian.Uint64(value)), nil
+		}
+	}
+	return "", 0, formatErrorf("vhdx virtual disk size not found")
+}
+
+// findVHDXMetadataRegion returns the file offset of the metadata region,
+// using the region table at offset.
+func findVHDXMetadataRegion(r io.ReaderAt, offset int64) (int64, error) {
+	table := make([]byte, 64*1024)
+	if _, err := r.ReadAt(table, offset); err != nil && err != io.EOF {
+		return 0, err
+	}
+	if !bytes.HasPrefix(table, []byte("regi")) {
+		return 0, formatErrorf("vhdx region table not found")
+	}
+	count := int(binary.LittleEndian.Uint32(table[8:]))
+	for i := 0; i < count && 16+32*(i+1) <= len(table); i++ {
+		entry := table[16+32*i:]
+		if bytes.Equal(entry[:16], vhdxMetadataRegionGUID) {
+			return int64(binary.LittleEndian.Uint64(entry[16:])), nil
+		}
+	}
+	return 0, formatErrorf("vhdx metadata region not found")
+}
+
+// gcsImage reads ranges of a GCS object.
+type gcsImage struct {
+	object domain.StorageObject
+	size   int64
+}
+
+func openGCSImage(storageClient domain.StorageClientInterface, gcsURI string) (imageReader, error) {
+	bucket, object, err := storage.GetGCSObjectPathElements(gcsURI)
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	attrs, err := storageClient.GetObjectAttrs(bucket, object)
+	if err == gcs.ErrObjectNotExist {
+		return nil, backoff.Permanent(fmt.Errorf("the file %q was not found", gcsURI))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return gcsImage{object: storageClient.GetObject(bucket, object), size: attrs.Size}, nil
+}
+
+func (image gcsImage) ReadAt(p []byte, off int64) (int, error) {
+	if off >= image.size {
+		return 0, io.EOF
+	}
+	length := int64(len(p))
+	if off+length > image.size {
+		length = image.size - off
+	}
+	reader, err := image.object.NewRangeReader(off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	n, err := io.ReadFull(reader, p[:length])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (image gcsImage) Size() int64 {
+	return image.size
+}
+
+func (image gcsImage) Close() error {
+	return nil
+}
+
+// localImage reads ranges of a local file.
+type localImage struct {
+	*os.File
+	size int64
+}
+
+func openLocalImage(filename string) (imageReader, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, backoff.Permanent(fmt.Errorf("file %q not found", filename))
+	}
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return localImage{File: f, size: stat.Size()}, nil
+}
+
+func (image localImage) Size() int64 {
+	return image.size
+}
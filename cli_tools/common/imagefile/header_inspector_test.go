@@ -0,0 +1,264 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package imagefile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+)
+
+func TestReadImageInfo(t *testing.T) {
+	cases := []struct {
+		name                string
+		file                []byte
+		expectedFormat      string
+		expectedVirtualSize int64
+	}{
+		{"qcow2", qcowFixture(3, 10*bytesPerGB), "qcow2", 10 * bytesPerGB},
+		{"qcow", qcowFixture(1, 3*bytesPerGB), "qcow", 3 * bytesPerGB},
+		{"sparse vmdk", sparseVMDKFixture(2 * bytesPerGB), "vmdk", 2 * bytesPerGB},
+		{"vmdk descriptor", vmdkDescriptorFixture(), "vmdk", 3 * 1024 * sectorSize},
+		{"vhdx", vhdxFixture(vhdxRegionTableOffset, 20*bytesPerGB), "vhdx", 20 * bytesPerGB},
+		{"vhdx with corrupt region table", vhdxFixture(vhdxRegionTableBackupOffset, bytesPerGB), "vhdx", bytesPerGB},
+		{"vdi", vdiFixture(5 * bytesPerGB), "vdi", 5 * bytesPerGB},
+		{"fixed vhd", fixedVHDFixture(4096), "vpc", 4096},
+		{"dynamic vhd", dynamicVHDFixture(8 * bytesPerGB), "vpc", 8 * bytesPerGB},
+		{"raw", bytes.Repeat([]byte{1}, 2048), "raw", 2048},
+		{"small raw", []byte("abc"), "raw", 3},
+		{"empty", nil, "raw", 0},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ReadImageInfo(bytes.NewReader(tt.file), int64(len(tt.file)))
+			assert.NoError(t, err)
+			assert.Equal(t, ImageInfo{
+				Format:           tt.expectedFormat,
+				ActualSizeBytes:  int64(len(tt.file)),
+				VirtualSizeBytes: tt.expectedVirtualSize,
+			}, info)
+		})
+	}
+}
+
+func TestReadImageInfo_FailsWhenHeaderIsInvalid(t *testing.T) {
+	cases := []struct {
+		name          string
+		file          []byte
+		expectedError string
+	}{
+		{"truncated qcow2", []byte("QFI\xfb\x00\x00\x00\x03"), "truncated qcow header"},
+		{"truncated vdi", vdiFixture(bytesPerGB)[:0x100], "truncated vdi header"},
+		{"vhdx without region table", append([]byte("vhdxfile"), make([]byte, 300*1024)...), "vhdx region table not found"},
+		{"vmdk descriptor with invalid extent", []byte("# Disk DescriptorFile\nRW abc SPARSE \"disk.vmdk\"\n"), "invalid vmdk extent"},
+		{"negative virtual size", qcowFixture(3, -1), "invalid qcow2 header: virtual size -1"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadImageInfo(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestLocalHeaderInspector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "disk.vmdk")
+	assert.NoError(t, ioutil.WriteFile(filename, sparseVMDKFixture(bytesPerGB+sectorSize), 0644))
+
+	metadata, err := NewLocalHeaderInspector().Inspect(context.Background(), filename)
+	assert.NoError(t, err)
+	assert.Equal(t, Metadata{PhysicalSizeGB: 1, VirtualSizeGB: 2, FileFormat: "vmdk"}, metadata)
+}
+
+func TestLocalHeaderInspector_FailsWhenFileNotFound(t *testing.T) {
+	_, err := NewLocalHeaderInspector().Inspect(context.Background(), "/not/a/file.vmdk")
+	assert.EqualError(t, err, `file "/not/a/file.vmdk" not found`)
+}
+
+func TestGCSHeaderInspector(t *testing.T) {
+	client := &fakeStorageClient{t: t, content: vhdxFixture(vhdxRegionTableOffset, 20*bytesPerGB)}
+	metadata, err := NewGCSHeaderInspector(client).Inspect(context.Background(), "gs://bucket/dir/disk.vhdx")
+	assert.NoError(t, err)
+	assert.Equal(t, Metadata{PhysicalSizeGB: 1, VirtualSizeGB: 20, FileFormat: "vhdx"}, metadata)
+	// The header, the region table, the metadata table, and the size.
+	assert.Equal(t, 4, client.rangeReads)
+}
+
+func TestGCSHeaderInspector_PerformRetry_WhenReadFails(t *testing.T) {
+	client := &fakeStorageClient{t: t, content: qcowFixture(3, bytesPerGB), failuresRemaining: 3}
+	metadata, err := NewGCSHeaderInspector(client).Inspect(context.Background(), "gs://bucket/dir/disk.qcow2")
+	assert.NoError(t, err)
+	assert.Equal(t, "qcow2", metadata.FileFormat)
+}
+
+func TestGCSHeaderInspector_StopInspecting_IfContextCancelled(t *testing.T) {
+	client := &fakeStorageClient{t: t, content: qcowFixture(3, bytesPerGB), failuresRemaining: 1000}
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(120*time.Millisecond))
+	defer cancel()
+	_, err := NewGCSHeaderInspector(client).Inspect(ctx, "gs://bucket/dir/disk.qcow2")
+	assert.EqualError(t, err, inspectionError)
+}
+
+func TestGCSHeaderInspector_DoesntRetry_WhenFileNotFound(t *testing.T) {
+	client := &fakeStorageClient{t: t}
+	_, err := NewGCSHeaderInspector(client).Inspect(context.Background(), "gs://bucket/dir/disk.qcow2")
+	assert.EqualError(t, err, `the file "gs://bucket/dir/disk.qcow2" was not found`)
+	assert.Equal(t, 1, client.attrReads)
+}
+
+func TestGCSHeaderInspector_DoesntRetry_WhenHeaderIsInvalid(t *testing.T) {
+	client := &fakeStorageClient{t: t, content: []byte("QFI\xfb")}
+	_, err := NewGCSHeaderInspector(client).Inspect(context.Background(), "gs://bucket/dir/disk.qcow2")
+	assert.EqualError(t, err, `failed to inspect "gs://bucket/dir/disk.qcow2": truncated qcow header`)
+	assert.Equal(t, 1, client.attrReads)
+}
+
+func qcowFixture(version uint32, virtualSize int64) []byte {
+	b := make([]byte, 4096)
+	copy(b, "QFI\xfb")
+	binary.BigEndian.PutUint32(b[4:], version)
+	binary.BigEndian.PutUint64(b[24:], uint64(virtualSize))
+	return b
+}
+
+func sparseVMDKFixture(virtualSize int64) []byte {
+	b := make([]byte, 4096)
+	copy(b, "KDMV")
+	binary.LittleEndian.PutUint32(b[4:], 1)
+	binary.LittleEndian.PutUint64(b[12:], uint64(virtualSize/sectorSize))
+	return b
+}
+
+func vmdkDescriptorFixture() []byte {
+	return []byte(`# Disk DescriptorFile
+version=1
+CID=fffffffe
+parentCID=ffffffff
+createType="twoGbMaxExtentFlat"
+
+# Extent description
+RW 2048 FLAT "disk-f001.vmdk" 0
+RDONLY 1024 FLAT "disk-f002.vmdk" 0
+
+# The Disk Data Base
+ddb.virtualHWVersion = "4"
+`)
+}
+
+func vhdxFixture(regionTableOffset int64, virtualSize int64) []byte {
+	const metadataOffset = 1024 * 1024
+	b := make([]byte, metadataOffset+0x10008)
+	copy(b, "vhdxfile")
+
+	regions := b[regionTableOffset:]
+	copy(regions, "regi")
+	binary.LittleEndian.PutUint32(regions[8:], 2)
+	// A BAT region, followed by the metadata region.
+	copy(regions[16:], bytes.Repeat([]byte{0xba}, 16))
+	copy(regions[48:], vhdxMetadataRegionGUID)
+	binary.LittleEndian.PutUint64(regions[64:], metadataOffset)
+
+	metadata := b[metadataOffset:]
+	copy(metadata, "metadata")
+	binary.LittleEndian.PutUint16(metadata[10:], 2)
+	copy(metadata[32:], bytes.Repeat([]byte{0xf1}, 16))
+	copy(metadata[64:], vhdxVirtualDiskSizeGUID)
+	binary.LittleEndian.PutUint32(metadata[80:], 0x10000)
+	binary.LittleEndian.PutUint32(metadata[84:], 8)
+	binary.LittleEndian.PutUint64(metadata[0x10000:], uint64(virtualSize))
+	return b
+}
+
+func vdiFixture(virtualSize int64) []byte {
+	b := make([]byte, 4096)
+	copy(b, "<<< Oracle VM VirtualBox Disk Image >>>\n")
+	binary.LittleEndian.PutUint32(b[0x40:], 0xbeda107f)
+	binary.LittleEndian.PutUint32(b[0x44:], 0x00010001)
+	binary.LittleEndian.PutUint64(b[0x170:], uint64(virtualSize))
+	return b
+}
+
+func vhdFooter(virtualSize int64) []byte {
+	footer := make([]byte, sectorSize)
+	copy(footer, "conectix")
+	binary.BigEndian.PutUint64(footer[40:], uint64(virtualSize))
+	binary.BigEndian.PutUint64(footer[48:], uint64(virtualSize))
+	return footer
+}
+
+func fixedVHDFixture(virtualSize int64) []byte {
+	return append(bytes.Repeat([]byte{1}, int(virtualSize)), vhdFooter(virtualSize)...)
+}
+
+func dynamicVHDFixture(virtualSize int64) []byte {
+	b := append(vhdFooter(virtualSize), make([]byte, 3*sectorSize)...)
+	return append(b, vhdFooter(virtualSize)...)
+}
+
+// fakeStorageClient serves content for every object in "bucket".
+type fakeStorageClient struct {
+	domain.StorageClientInterface
+	t                 *testing.T
+	content           []byte
+	failuresRemaining int
+	attrReads         int
+	rangeReads        int
+}
+
+func (c *fakeStorageClient) GetObjectAttrs(bucket, object string) (*storage.ObjectAttrs, error) {
+	assert.Equal(c.t, "bucket", bucket)
+	c.attrReads++
+	if c.content == nil {
+		return nil, storage.ErrObjectNotExist
+	}
+	return &storage.ObjectAttrs{Bucket: bucket, Name: object, Size: int64(len(c.content))}, nil
+}
+
+func (c *fakeStorageClient) GetObject(bucket, object string) domain.StorageObject {
+	return &fakeStorageObject{client: c}
+}
+
+type fakeStorageObject struct {
+	domain.StorageObject
+	client *fakeStorageClient
+}
+
+func (o *fakeStorageObject) NewRangeReader(offset, length int64) (io.ReadCloser, error) {
+	c := o.client
+	c.rangeReads++
+	if c.failuresRemaining > 0 {
+		c.failuresRemaining--
+		return nil, errors.New(inspectionError)
+	}
+	assert.True(c.t, offset+length <= int64(len(c.content)), "range %d+%d past end of object", offset, length)
+	return ioutil.NopCloser(bytes.NewReader(c.content[offset : offset+length])), nil
+}
@@ -206,6 +206,33 @@ func (b *BufferedWriter) Close() error {
 	return nil
 }
 
+// Abort discards what's been written, without composing the object. The
+// current chunk is removed, and the uploaded chunks are deleted.
+func (b *BufferedWriter) Abort() error {
+	b.Lock()
+	defer b.Unlock()
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+	}
+	close(b.upload)
+	b.Wait()
+
+	client, err := b.client(b.ctx, b.oauth)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var firstErr error
+	for _, obj := range b.tmpObjs {
+		if err := client.GetObject(b.bkt, obj).Delete(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 // Write writes the passed in bytes to buffer.
 func (b *BufferedWriter) Write(d []byte) (int, error) {
 	b.Lock()
@@ -394,6 +394,35 @@ func TestErrorWhenComposeFails(t *testing.T) {
 	assert.Equal(t, "Fail to compose", err.Error())
 }
 
+func TestAbortDeletesChunksWithoutComposing(t *testing.T) {
+	resetArgs()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStorageObject := mocks.NewMockStorageObject(mockCtrl)
+	mockStorageObject.EXPECT().NewWriter().Return(testWriteCloser{ioutil.Discard}).Times(1)
+	mockStorageObject.EXPECT().Delete().Return(nil).Times(1)
+
+	mockStorageClient = mocks.NewMockStorageClientInterface(mockCtrl)
+	mockStorageClient.EXPECT().Close().Return(nil).AnyTimes()
+	mockStorageClient.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(mockStorageObject).AnyTimes()
+
+	ctx := context.Background()
+	data := []byte("This is a sample data to write")
+	buf := NewBufferedWriter(ctx, bufferSize, workerNum, mockGcsClient, oauth, prefix, bkt, obj)
+	_, err := buf.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, buf.flush())
+	assert.Nil(t, buf.newChunk())
+	_, err = buf.Write(data)
+	assert.Nil(t, err)
+	current := buf.file.Name()
+
+	assert.Nil(t, buf.Abort())
+	assert.Len(t, buf.tmpObjs, 1)
+	_, err = os.Stat(current)
+	assert.True(t, os.IsNotExist(err), "current chunk must be removed")
+}
+
 func TestClientErrorWhenUploadFailed(t *testing.T) {
 	resetArgs()
 	mockCtrl := gomock.NewController(t)
@@ -132,6 +132,39 @@ func (c *ScratchBucketCreator) createBucketIfNotExisting(project string,
 	return bucketAttrs.Location, nil
 }
 
+// DryRunScratchBucketCreator determines the scratch bucket that
+// ScratchBucketCreator would use, without creating it.
+type DryRunScratchBucketCreator struct {
+	*ScratchBucketCreator
+}
+
+// NewDryRunScratchBucketCreator creates a DryRunScratchBucketCreator
+func NewDryRunScratchBucketCreator(ctx context.Context, storageClient domain.StorageClientInterface) *DryRunScratchBucketCreator {
+	return &DryRunScratchBucketCreator{NewScratchBucketCreator(ctx, storageClient)}
+}
+
+// CreateScratchBucket returns the scratch bucket that would be used for
+// sourceFileFlag, and its region. The bucket is not created if it doesn't
+// exist. Returns (bucket_name, region, error)
+func (c *DryRunScratchBucketCreator) CreateScratchBucket(sourceFileFlag string, project string,
+	fallbackZone string) (string, string, error) {
+
+	bucketAttrs, err := c.getBucketAttrs(sourceFileFlag, project, fallbackZone)
+	if err != nil {
+		return "", "", err
+	}
+
+	foundBucketAttrs, err := c.getBucketAttrsIfInProject(project, bucketAttrs.Name)
+	if err != nil {
+		return "", "", err
+	}
+	if foundBucketAttrs != nil {
+		return bucketAttrs.Name, foundBucketAttrs.Location, nil
+	}
+	log.Printf("Scratch bucket `%v` would be created in %v region", bucketAttrs.Name, bucketAttrs.Location)
+	return bucketAttrs.Name, bucketAttrs.Location, nil
+}
+
 // IsBucketInProject checks if bucket belongs to a project
 func (c *ScratchBucketCreator) IsBucketInProject(project string, bucketName string) bool {
 	foundBucketAttrs, _ := c.getBucketAttrsIfInProject(project, bucketName)
@@ -343,6 +343,51 @@ func TestCreateScratchBucketReturnsExistingScratchBucketNoCreate(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestDryRunCreateScratchBucketDoesNotCreateBucket(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	project := "project1"
+	ctx := context.Background()
+
+	// The mock fails the test if CreateBucket is called.
+	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
+
+	c := DryRunScratchBucketCreator{&ScratchBucketCreator{mockStorageClient, ctx,
+		createMockBucketIteratorWithRandomBuckets(mockCtrl, &ctx, mockStorageClient, project)}}
+	bucket, region, err := c.CreateScratchBucket("", project, "europe-west2-b")
+	assert.Equal(t, "project1-daisy-bkt-europe-west2", bucket)
+	assert.Equal(t, "europe-west2", region)
+	assert.Nil(t, err)
+}
+
+func TestDryRunCreateScratchBucketReturnsRegionOfExistingBucket(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	project := "project1"
+	ctx := context.Background()
+
+	existingBucketAttrs := &storage.BucketAttrs{
+		Name:         "project1-daisy-bkt-us",
+		Location:     "US",
+		StorageClass: "multi_regional",
+	}
+	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
+	mockBucketIterator := mocks.NewMockBucketIteratorInterface(mockCtrl)
+	mockBucketIterator.EXPECT().Next().Return(existingBucketAttrs, nil)
+	mockBucketIteratorCreator := mocks.NewMockBucketIteratorCreatorInterface(mockCtrl)
+	mockBucketIteratorCreator.EXPECT().
+		CreateBucketIterator(ctx, mockStorageClient, project).
+		Return(mockBucketIterator)
+
+	c := DryRunScratchBucketCreator{&ScratchBucketCreator{mockStorageClient, ctx, mockBucketIteratorCreator}}
+	bucket, region, err := c.CreateScratchBucket("", project, "")
+	assert.Equal(t, "project1-daisy-bkt-us", bucket)
+	assert.Equal(t, "US", region)
+	assert.Nil(t, err)
+}
+
 func TestCreateScratchBucketErrorWhenCreatingBucket(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
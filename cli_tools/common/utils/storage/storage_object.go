@@ -56,6 +56,12 @@ func (so *storageObject) NewReader() (io.ReadCloser, error) {
 	return so.oh.NewReader(so.ctx)
 }
 
+// NewRangeReader creates a new Reader to read length bytes of the object,
+// starting at offset.
+func (so *storageObject) NewRangeReader(offset, length int64) (io.ReadCloser, error) {
+	return so.oh.NewRangeReader(so.ctx, offset, length)
+}
+
 // NewWriter creates a new Writer to write to the object.
 func (so *storageObject) NewWriter() io.WriteCloser {
 	return so.oh.NewWriter(so.ctx)
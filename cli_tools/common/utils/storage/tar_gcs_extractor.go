@@ -76,9 +76,8 @@ func (tge *TarGcsExtractor) ExtractTarToGcs(tarGcsPath string, destinationGcsPat
 		}
 
 		switch header.Typeflag {
-		case tar.TypeDir:
-			return daisy.Errf("tar subdirectories not supported")
-
+		// Files in subdirectories are extracted to the same subdirectories
+		// of the destination, which GCS creates implicitly.
 		case tar.TypeReg:
 			destinationFilePath := path.Join(destinationPath, header.Name)
 			tge.logger.User(fmt.Sprintf("Extracting: %v to gs://%v", header.Name, path.Join(destinationBucketName, destinationFilePath)))
@@ -16,6 +16,7 @@ package storage
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -154,24 +155,30 @@ func TestExtractTarToGcsErrorWhenErrorReadingTarFile(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
-func TestExtractTarToGcsErrorIfDirPresentInTar(t *testing.T) {
+func TestExtractTarToGcsExtractsFilesInSubdirectories(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
-	ctx := context.Background()
-	testTarFile, _ := os.Open("../../../test_data/test_tar_with_dir.tar")
-	testTarFileReader := bufio.NewReader(testTarFile)
+	content := createTestTar(t, []testTarFile{
+		{name: "adir/", dir: true},
+		{name: "adir/file1.txt", content: "content1"},
+		{name: "file2.txt", content: "content2"},
+	})
 
 	mockStorageObject := mocks.NewMockStorageObject(mockCtrl)
-	mockStorageObject.EXPECT().NewReader().Return(ioutil.NopCloser(testTarFileReader), nil)
+	mockStorageObject.EXPECT().NewReader().Return(ioutil.NopCloser(bytes.NewReader(content)), nil)
 
 	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
 	mockStorageClient.EXPECT().
 		GetObject("sourcebucket", "sourcepath/sometar.tar").
 		Return(mockStorageObject)
 
-	tge := TarGcsExtractor{ctx: ctx, storageClient: mockStorageClient, logger: logging.NewToolLogger("[import-ovf]")}
+	first := mockStorageClient.EXPECT().WriteToGCS("destbucket", "destpath/adir/file1.txt", gomock.Any()).Return(nil)
+	second := mockStorageClient.EXPECT().WriteToGCS("destbucket", "destpath/file2.txt", gomock.Any()).Return(nil)
+	gomock.InOrder(first, second)
+
+	tge := TarGcsExtractor{ctx: context.Background(), storageClient: mockStorageClient, logger: logging.NewToolLogger("[import-ovf]")}
 	err := tge.ExtractTarToGcs("gs://sourcebucket/sourcepath/sometar.tar", "gs://destbucket/destpath/")
 
-	assert.NotNil(t, err)
+	assert.Nil(t, err)
 }
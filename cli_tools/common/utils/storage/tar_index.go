@@ -0,0 +1,249 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package storage
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+// Size of the ranged reads of tar headers. Headers are 512 byte blocks, and
+// PAX or GNU long name headers are a few blocks.
+const tarHeaderReadSize = 64 * 1024
+
+// TarEntry is a file in a tar archive. Its content is the Size bytes of the
+// archive starting at Offset.
+type TarEntry struct {
+	Name   string
+	Offset int64
+	Size   int64
+}
+
+// TarIndex is the list of files of a tar archive in GCS, which allows them
+// to be read in place with ranged reads, rather than extracted.
+type TarIndex struct {
+	GcsPath string
+	Entries []TarEntry
+}
+
+// Find returns the entry of the file called name. Names are relative to the
+// root of the archive, and may be in subdirectories, such as `disks/a.vmdk`.
+func (index *TarIndex) Find(name string) (TarEntry, bool) {
+	name = cleanTarName(name)
+	for _, entry := range index.Entries {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return TarEntry{}, false
+}
+
+// FindByExtension returns the first entry whose name has the extension,
+// ignoring case.
+func (index *TarIndex) FindByExtension(extension string) (TarEntry, bool) {
+	for _, entry := range index.Entries {
+		if strings.EqualFold(path.Ext(entry.Name), extension) {
+			return entry, true
+		}
+	}
+	return TarEntry{}, false
+}
+
+// EntryPath returns the path of an entry, which is the archive's GCS path
+// followed by the entry's name, such as `gs://bucket/vm.ova/disk1.vmdk`.
+func (index *TarIndex) EntryPath(entry TarEntry) string {
+	return index.GcsPath + "/" + entry.Name
+}
+
+// FindByPath returns the entry whose EntryPath is entryPath.
+func (index *TarIndex) FindByPath(entryPath string) (TarEntry, bool) {
+	prefix := index.GcsPath + "/"
+	if !strings.HasPrefix(entryPath, prefix) {
+		return TarEntry{}, false
+	}
+	return index.Find(strings.TrimPrefix(entryPath, prefix))
+}
+
+// TarIndexer builds the indexes of tar archives in GCS.
+type TarIndexer struct {
+	storageClient domain.StorageClientInterface
+}
+
+// NewTarIndexer creates a new TarIndexer
+func NewTarIndexer(sc domain.StorageClientInterface) *TarIndexer {
+	return &TarIndexer{storageClient: sc}
+}
+
+// IndexTar reads the headers of a tar archive in GCS, skipping over the
+// content of its files, and returns the archive's index. Directories are
+// indexed through their files; links and other special files are skipped.
+func (ti *TarIndexer) IndexTar(tarGcsPath string) (*TarIndex, error) {
+	bucket, object, err := GetGCSObjectPathElements(tarGcsPath)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := ti.storageClient.GetObjectAttrs(bucket, object)
+	if err != nil {
+		return nil, daisy.Errf("error while opening archive %v: %v", tarGcsPath, err)
+	}
+	reader := &rangeReadSeeker{object: ti.storageClient.GetObject(bucket, object), size: attrs.Size}
+	defer reader.Close()
+
+	index := &TarIndex{GcsPath: tarGcsPath}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return nil, daisy.Errf("error while reading archive %v: %v", tarGcsPath, err)
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		// After the header, the reader is at the start of the file's content.
+		index.Entries = append(index.Entries, TarEntry{
+			Name:   cleanTarName(header.Name),
+			Offset: reader.offset,
+			Size:   header.Size,
+		})
+	}
+}
+
+// NewTarEntryReader returns a reader of the content of an entry of an
+// archive in GCS.
+func NewTarEntryReader(storageClient domain.StorageClientInterface, index *TarIndex,
+	entry TarEntry) (io.ReadCloser, error) {
+	bucket, object, err := GetGCSObjectPathElements(index.GcsPath)
+	if err != nil {
+		return nil, err
+	}
+	return storageClient.GetObject(bucket, object).NewRangeReader(entry.Offset, entry.Size)
+}
+
+// NewTarEntryReaderAt returns a reader of ranges of the content of an entry
+// of an archive in GCS.
+func NewTarEntryReaderAt(storageClient domain.StorageClientInterface, index *TarIndex,
+	entry TarEntry) (io.ReaderAt, error) {
+	bucket, object, err := GetGCSObjectPathElements(index.GcsPath)
+	if err != nil {
+		return nil, err
+	}
+	return entryReaderAt{object: storageClient.GetObject(bucket, object), entry: entry}, nil
+}
+
+func cleanTarName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// entryReaderAt reads ranges of the content of a tar entry.
+type entryReaderAt struct {
+	object domain.StorageObject
+	entry  TarEntry
+}
+
+func (r entryReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.entry.Size {
+		return 0, io.EOF
+	}
+	length := int64(len(p))
+	if off+length > r.entry.Size {
+		length = r.entry.Size - off
+	}
+	reader, err := r.object.NewRangeReader(r.entry.Offset+off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	n, err := io.ReadFull(reader, p[:length])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// rangeReadSeeker reads a GCS object with ranged reads of at most
+// tarHeaderReadSize bytes. Seeking closes the current read, which is how
+// tar.Reader skips the content of files without downloading it.
+type rangeReadSeeker struct {
+	object  domain.StorageObject
+	size    int64
+	offset  int64
+	current io.ReadCloser
+}
+
+func (r *rangeReadSeeker) Read(p []byte) (int, error) {
+	for {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+		if r.current == nil {
+			length := r.size - r.offset
+			if length > tarHeaderReadSize {
+				length = tarHeaderReadSize
+			}
+			reader, err := r.object.NewRangeReader(r.offset, length)
+			if err != nil {
+				return 0, err
+			}
+			r.current = reader
+		}
+		n, err := r.current.Read(p)
+		r.offset += int64(n)
+		if err == io.EOF {
+			r.Close()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *rangeReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, daisy.Errf("invalid whence %v", whence)
+	}
+	if offset < 0 {
+		return 0, daisy.Errf("negative offset %v", offset)
+	}
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return r.offset, nil
+}
+
+func (r *rangeReadSeeker) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
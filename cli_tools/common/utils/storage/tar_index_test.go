@@ -0,0 +1,204 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/mocks"
+)
+
+func TestIndexTar(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	disk := strings.Repeat("d", 1024*1024)
+	longName := "disks/" + strings.Repeat("n", 120) + ".vmdk"
+	content := createTestTar(t, []testTarFile{
+		{name: "vm.ovf", content: "<Envelope/>"},
+		{name: "./disks/", dir: true},
+		{name: "./disks/disk1.vmdk", content: disk},
+		{name: longName, content: "long"},
+		{name: "link.vmdk", link: "disks/disk1.vmdk"},
+	})
+	mockStorageClient, bytesRead := mockTarObject(mockCtrl, content)
+
+	index, err := NewTarIndexer(mockStorageClient).IndexTar("gs://bucket/folder/vm.ova")
+	assert.NoError(t, err)
+	assert.Equal(t, "gs://bucket/folder/vm.ova", index.GcsPath)
+	assert.Len(t, index.Entries, 3)
+	for i, expected := range []struct {
+		name    string
+		content string
+	}{
+		{"vm.ovf", "<Envelope/>"},
+		{"disks/disk1.vmdk", disk},
+		{longName, "long"},
+	} {
+		entry := index.Entries[i]
+		assert.Equal(t, expected.name, entry.Name)
+		assert.Equal(t, expected.content, string(content[entry.Offset:entry.Offset+entry.Size]))
+	}
+	assert.Less(t, *bytesRead, int64(len(disk)), "The content of files isn't read.")
+}
+
+func TestIndexTarErrorWhenObjectNotFound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
+	mockStorageClient.EXPECT().GetObjectAttrs("bucket", "vm.ova").Return(nil, storage.ErrObjectNotExist)
+
+	_, err := NewTarIndexer(mockStorageClient).IndexTar("gs://bucket/vm.ova")
+	assert.EqualError(t, err, "error while opening archive gs://bucket/vm.ova: storage: object doesn't exist")
+}
+
+func TestIndexTarErrorWhenNotTar(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStorageClient, _ := mockTarObject(mockCtrl, []byte(strings.Repeat("not a tar", 100)))
+	_, err := NewTarIndexer(mockStorageClient).IndexTar("gs://bucket/folder/vm.ova")
+	assert.Error(t, err)
+}
+
+func TestIndexTarErrorWhenInvalidPath(t *testing.T) {
+	_, err := NewTarIndexer(nil).IndexTar("NOT_GCS_PATH")
+	assert.Error(t, err)
+}
+
+func TestTarIndexFind(t *testing.T) {
+	index := &TarIndex{GcsPath: "gs://bucket/vm.ova", Entries: []TarEntry{
+		{Name: "vm.ovf", Offset: 512, Size: 10},
+		{Name: "disks/disk1.VMDK", Offset: 1536, Size: 20},
+	}}
+
+	entry, ok := index.Find("./disks//disk1.VMDK")
+	assert.True(t, ok)
+	assert.Equal(t, index.Entries[1], entry)
+	_, ok = index.Find("disk1.VMDK")
+	assert.False(t, ok)
+
+	entry, ok = index.FindByExtension(".vmdk")
+	assert.True(t, ok)
+	assert.Equal(t, index.Entries[1], entry)
+	_, ok = index.FindByExtension(".mf")
+	assert.False(t, ok)
+
+	assert.Equal(t, "gs://bucket/vm.ova/disks/disk1.VMDK", index.EntryPath(entry))
+	entry, ok = index.FindByPath("gs://bucket/vm.ova/vm.ovf")
+	assert.True(t, ok)
+	assert.Equal(t, index.Entries[0], entry)
+	_, ok = index.FindByPath("gs://bucket/other.ova/vm.ovf")
+	assert.False(t, ok)
+}
+
+func TestNewTarEntryReader(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	content := createTestTar(t, []testTarFile{{name: "disks/disk1.vmdk", content: "disk content"}})
+	mockStorageClient, _ := mockTarObject(mockCtrl, content)
+	index, err := NewTarIndexer(mockStorageClient).IndexTar("gs://bucket/folder/vm.ova")
+	assert.NoError(t, err)
+
+	reader, err := NewTarEntryReader(mockStorageClient, index, index.Entries[0])
+	assert.NoError(t, err)
+	defer reader.Close()
+	actual, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "disk content", string(actual))
+}
+
+func TestNewTarEntryReaderAt(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	content := createTestTar(t, []testTarFile{
+		{name: "vm.ovf", content: "<Envelope/>"},
+		{name: "disk1.vmdk", content: "0123456789"},
+	})
+	mockStorageClient, _ := mockTarObject(mockCtrl, content)
+	index, err := NewTarIndexer(mockStorageClient).IndexTar("gs://bucket/folder/vm.ova")
+	assert.NoError(t, err)
+
+	readerAt, err := NewTarEntryReaderAt(mockStorageClient, index, index.Entries[1])
+	assert.NoError(t, err)
+	p := make([]byte, 4)
+	n, err := readerAt.ReadAt(p, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "2345", string(p[:n]))
+	n, err = readerAt.ReadAt(p, 8)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "89", string(p[:n]))
+	_, err = readerAt.ReadAt(p, 10)
+	assert.Equal(t, io.EOF, err)
+}
+
+type testTarFile struct {
+	name    string
+	content string
+	dir     bool
+	link    string
+}
+
+func createTestTar(t *testing.T, files []testTarFile) []byte {
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), Typeflag: tar.TypeReg}
+		if file.dir {
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		}
+		if file.link != "" {
+			header.Typeflag, header.Linkname = tar.TypeSymlink, file.link
+		}
+		assert.NoError(t, writer.WriteHeader(header))
+		_, err := writer.Write([]byte(file.content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+// mockTarObject returns a storage client whose gs://bucket/folder/vm.ova
+// object has content, and the count of bytes that were read from it.
+func mockTarObject(mockCtrl *gomock.Controller, content []byte) (*mocks.MockStorageClientInterface, *int64) {
+	var bytesRead int64
+	mockStorageObject := mocks.NewMockStorageObject(mockCtrl)
+	mockStorageObject.EXPECT().NewRangeReader(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(offset, length int64) (io.ReadCloser, error) {
+			if offset < 0 || offset+length > int64(len(content)) {
+				return nil, fmt.Errorf("invalid range %d-%d", offset, offset+length)
+			}
+			bytesRead += length
+			return ioutil.NopCloser(bytes.NewReader(content[offset : offset+length])), nil
+		}).AnyTimes()
+	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
+	mockStorageClient.EXPECT().GetObjectAttrs(gomock.Any(), gomock.Any()).Return(
+		&storage.ObjectAttrs{Size: int64(len(content))}, nil).AnyTimes()
+	mockStorageClient.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(mockStorageObject).AnyTimes()
+	return mockStorageClient, &bytesRead
+}
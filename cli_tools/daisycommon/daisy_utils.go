@@ -100,6 +100,8 @@ func (env EnvironmentSettings) ApplyToWorkflow(w *daisy.Workflow) {
 	}
 	if env.DisableGCSLogs {
 		w.DisableGCSLogging()
+	} else {
+		w.EnableSerialLogArchive()
 	}
 	if env.DisableCloudLogs {
 		w.DisableCloudLogging()
@@ -189,6 +189,7 @@ func Test_ApplyToWorkflow(t *testing.T) {
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.env.ApplyToWorkflow(tt.original)
+			tt.expected.EnableSerialLogArchive()
 			assert.Equal(t, tt.original, tt.expected)
 		})
 	}
@@ -218,6 +219,15 @@ func Test_ApplyToWorkflow_PropagatesLogging(t *testing.T) {
 	}
 }
 
+func Test_ApplyToWorkflow_ArchivesSerialLogsUnlessGCSLogsDisabled(t *testing.T) {
+	for _, disableGCSLogs := range []bool{false, true} {
+		w := &daisy.Workflow{}
+		EnvironmentSettings{DisableGCSLogs: disableGCSLogs}.ApplyToWorkflow(w)
+		archive := reflect.ValueOf(w).Elem().FieldByName("serialLogs")
+		assert.Equal(t, disableGCSLogs, archive.IsNil(), "DisableGCSLogs: %v", disableGCSLogs)
+	}
+}
+
 func assertWorkflow(t *testing.T, w *daisy.Workflow, project string, zone string, gcsPath string,
 	oauth string, dTimeout string, endpoint string, varMap map[string]string) {
 	tests := []struct {
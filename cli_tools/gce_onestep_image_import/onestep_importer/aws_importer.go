@@ -20,9 +20,6 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
-	"runtime"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -40,7 +37,6 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
-	"github.com/dustin/go-humanize"
 	"google.golang.org/api/option"
 	htransport "google.golang.org/api/transport/http"
 )
@@ -54,13 +50,9 @@ const (
 
 // awsImporter is responsible for importing image from AWS.
 type awsImporter struct {
+	gcsFileImporter
 	args           *awsImportArguments
-	gcsClient      domain.StorageClientInterface
-	ctx            context.Context
-	oauth          string
 	paramPopulator param.Populator
-	timeoutChan    chan struct{}
-	uploader       *uploader
 
 	// AWS clients for SDK
 	ec2Client ec2iface.EC2API
@@ -105,14 +97,16 @@ func newAWSImporter(oauth string, timeoutChan chan struct{}, args *awsImportArgu
 	}
 
 	importer := &awsImporter{
+		gcsFileImporter: gcsFileImporter{
+			gcsClient:   client,
+			ctx:         ctx,
+			oauth:       oauth,
+			timeoutChan: timeoutChan,
+		},
 		args:           args,
-		gcsClient:      client,
 		s3Client:       s3.New(awsSession),
 		ec2Client:      ec2.New(awsSession),
-		ctx:            ctx,
-		oauth:          oauth,
 		paramPopulator: paramPopulator,
-		timeoutChan:    timeoutChan,
 	}
 
 	return importer, nil
@@ -212,19 +206,12 @@ func (importer *awsImporter) cleanUp(gcsFilePath string, shouldDeleteS3File bool
 		return
 	}
 
-	err := importer.gcsClient.DeleteGcsPath(gcsFilePath)
-	if err != nil {
-		log.Printf("Could not delete image file %v: %v. "+
-			"To avoid incurring charges to your billing account, "+
-			"you must manually delete the file from the storage location.\n", gcsFilePath, err.Error())
-	}
-
-	importer.gcsClient.Close()
+	importer.cleanUpGCS(gcsFilePath)
 
 	// Only delete s3 file if the file is not pased
 	if shouldDeleteS3File {
 		log.Printf("Deleting %v.\n", importer.args.sourceFilePath)
-		_, err = importer.s3Client.DeleteObject(&s3.DeleteObjectInput{
+		_, err := importer.s3Client.DeleteObject(&s3.DeleteObjectInput{
 			Bucket: aws.String(importer.args.exportBucket),
 			Key:    aws.String(importer.args.exportKey),
 		})
@@ -242,30 +229,7 @@ func (importer *awsImporter) importImage(importArgs *OneStepImportArguments, sta
 	if importer.importImageFn != nil {
 		return importer.importImageFn()
 	}
-
-	// update source file flag to copied GCS destination
-	importArgs.SourceFile = gcsFilePath
-
-	// adjust timeout to pass into image import
-	importArgs.Timeout = importArgs.Timeout - time.Since(startTime)
-	if importArgs.Timeout <= 0 {
-		return daisy.Errf("timeout exceeded")
-	}
-
-	// add label to indicate the image import is run from onestep import
-	if importArgs.Labels == nil {
-		importArgs.Labels = make(map[string]string)
-	}
-	importArgs.Labels["onestep-image-import"] = "aws"
-
-	err := runImageImport(importArgs)
-	if err != nil {
-		log.Printf("Failed to import image. "+
-			"The image file is copied to Cloud Storage, located at %v.\n", gcsFilePath)
-		return err
-	}
-
-	return nil
+	return importer.importFromGCS(importArgs, startTime, gcsFilePath, "aws")
 }
 
 // getAWSFileSize gets the size of the file to copy from S3 to GCS.
@@ -396,40 +360,11 @@ func (importer *awsImporter) copyFromS3ToGCS() (string, error) {
 		return importer.copyFromS3ToGCSFn()
 	}
 
-	start := time.Now()
-	// 1. get GCS path as copy destination.
 	gcsFilePath := pathutils.JoinURL(importer.args.gcsScratchBucket,
 		fmt.Sprintf("onestep-image-import-aws-%v.vmdk", pathutils.RandString(5)))
-
-	log.Printf("Copying %v to %v.\n", importer.args.sourceFilePath, gcsFilePath)
-
-	// 2. create a new folder for local buffer
-	path := filepath.Join(filepath.Dir(importer.args.executablePath), fmt.Sprint("upload", pathutils.RandString(5)))
-
-	err := os.Mkdir(path, 0755)
-	if err != nil {
-		return "", daisy.ToDError(err)
-	}
-	defer os.RemoveAll(path)
-
-	// 3. get writer
-	bs, err := humanize.ParseBytes(uploadBufSize)
-	if err != nil {
-		return "", daisy.ToDError(err)
-	}
-	bkt, obj, err := storageutils.GetGCSObjectPathElements(gcsFilePath)
-	if err != nil {
-		return "", err
-	}
-	workers := int64(runtime.NumCPU())
-	writer := storageutils.NewBufferedWriter(importer.ctx, int64(bs), workers, createGCSClient, importer.oauth, path, bkt, obj)
-
-	// 4. Transfer file from S3 to GCS
-	if err := importer.transferFile(writer); err != nil {
+	if err := importer.copyToGCS(importer.args.sourceFilePath, gcsFilePath, importer.args.executablePath, importer.transferFile); err != nil {
 		return gcsFilePath, err
 	}
-	log.Printf("Successfully copied to %v in %v.\n", gcsFilePath, time.Since(start))
-
 	return gcsFilePath, nil
 }
 
@@ -452,70 +387,19 @@ func (importer *awsImporter) transferFile(writer io.WriteCloser) error {
 	if importer.transferFileFn != nil {
 		return importer.transferFileFn()
 	}
-	// 1. Set up download size and get number of chunks to download
-	output, err := humanize.ParseBytes(downloadBufSize)
-	if err != nil {
-		return daisy.ToDError(err)
-	}
-	readSize := int64(output)
-	// Take ceiling to get number of chunks to download.
-	readers := (importer.args.exportFileSize-1)/readSize + 1
-	// Set up download retry delay interval
-	delayTime := []int{1, 2, 4, 8, 8}
-	maxRetryTimes := len(delayTime)
-
-	// 2. Set up upload info
-	importer.uploader = importer.getUploader(writer)
-	importer.uploader.Add(1)
-	go importer.uploader.uploadFile()
-
-	// 3. Range download
-	for i := int64(0); i < readers; i++ {
-		startRange := i * readSize
-		endRange := startRange + readSize - 1
-		for retryAttempt := 0; ; retryAttempt++ {
-			res, err := importer.s3Client.GetObject(&s3.GetObjectInput{
-				Bucket: aws.String(importer.args.exportBucket),
-				Key:    aws.String(importer.args.exportKey),
-				Range:  aws.String(fmt.Sprintf("bytes=%v-%v", startRange, endRange)),
-			})
-			if err != nil {
-				if retryAttempt >= maxRetryTimes {
-					return daisy.Errf("error in downloading from %v: %v", importer.args.sourceFilePath, err)
-				}
-				time.Sleep(time.Duration(delayTime[retryAttempt]) * time.Second)
-				continue
-			}
-			importer.uploader.readerChan <- res.Body
-			break
-		}
-
-		// Stop downloading as soon as one of the upload fails.
-		select {
-		case err := <-importer.uploader.uploadErrChan:
-			importer.uploader.cleanup()
-			return err
-		default:
-			// No error, continue to download.
-		}
-
-		// Stop downloading if timeout exceeded.
-		select {
-		case <-importer.timeoutChan:
-			importer.uploader.cleanup()
-			return daisy.Errf("timeout exceeded during transfer file")
-		default:
-			// Did not timeout, continue to download.
-		}
-	}
-
-	// All file chunks are downloaded, wait for upload to finish.
-	close(importer.uploader.readerChan)
-	importer.uploader.Wait()
+	return importer.gcsFileImporter.transferFile(importer.getUploader(writer), importer.args.sourceFilePath,
+		importer.args.exportFileSize, importer.getS3Range)
+}
 
-	err = importer.uploader.writer.Close()
+// getS3Range downloads bytes start to end, inclusive, of the S3 file.
+func (importer *awsImporter) getS3Range(start, end int64) (io.ReadCloser, error) {
+	res, err := importer.s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(importer.args.exportBucket),
+		Key:    aws.String(importer.args.exportKey),
+		Range:  aws.String(fmt.Sprintf("bytes=%v-%v", start, end)),
+	})
 	if err != nil {
-		return daisy.ToDError(err)
+		return nil, err
 	}
-	return nil
+	return res.Body, nil
 }
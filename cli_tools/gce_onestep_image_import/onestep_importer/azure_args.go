@@ -0,0 +1,145 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/param"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/validation"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+// azureImportArguments holds the structured results of parsing CLI arguments,
+// and optionally allows for validating and populating the arguments.
+type azureImportArguments struct {
+	// Passed in by user
+	clientID           string
+	executablePath     string
+	sourceURI          string
+	sasToken           string
+	gcsComputeEndpoint string
+	gcsProjectPtr      *string
+	gcsZone            string
+	gcsRegion          string
+	gcsScratchBucket   string
+	gcsStorageLocation string
+
+	// Internal generated
+	sourceURL      string
+	sourceFileSize int64
+}
+
+// Flags
+const (
+	azureSourceURIFlag = "azure_source_uri"
+	azureSASTokenFlag  = "azure_sas_token"
+)
+
+// redactedBlobURI replaces blob URIs that can't be parsed in errors and logs.
+const redactedBlobURI = "<unparseable Azure blob URI>"
+
+// newAzureImportArguments creates a new azureImportArguments instance.
+func newAzureImportArguments(args *OneStepImportArguments) *azureImportArguments {
+	return &azureImportArguments{
+		clientID:           args.ClientID,
+		executablePath:     args.ExecutablePath,
+		sourceURI:          args.AzureSourceURI,
+		sasToken:           args.AzureSASToken,
+		gcsComputeEndpoint: args.ComputeEndpoint,
+		gcsProjectPtr:      args.ProjectPtr,
+		gcsZone:            args.Zone,
+		gcsRegion:          args.Region,
+		gcsScratchBucket:   args.ScratchBucketGcsPath,
+		gcsStorageLocation: args.StorageLocation,
+	}
+}
+
+// validateAndPopulate validates args related to import from Azure, and
+// populates any missing parameters.
+func (args *azureImportArguments) validateAndPopulate(populator param.Populator) error {
+	if err := args.validate(); err != nil {
+		return err
+	}
+
+	return populator.PopulateMissingParameters(args.gcsProjectPtr, args.clientID, &args.gcsZone,
+		&args.gcsRegion, &args.gcsScratchBucket, "", &args.gcsStorageLocation)
+}
+
+// validate checks the source URI and builds the URL the VHD is read from,
+// with the SAS token appended when it's given separately.
+func (args *azureImportArguments) validate() error {
+	if err := validation.ValidateStringFlagNotEmpty(args.sourceURI, azureSourceURIFlag); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(args.sourceURI)
+	if err != nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return daisy.Errf("%v is not a valid Azure blob URI", redactBlobURI(args.sourceURI))
+	}
+	// Plain HTTP would expose the SAS token, it's only allowed for local
+	// stand-ins of blob storage.
+	if u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname())) {
+		return daisy.Errf("%v is not a valid Azure blob URI: scheme must be https", redactBlobURI(args.sourceURI))
+	}
+
+	if args.sasToken != "" {
+		if u.RawQuery != "" {
+			return daisy.Errf("-%v must not be specified when -%v already has a SAS token", azureSASTokenFlag, azureSourceURIFlag)
+		}
+		u.RawQuery = strings.TrimPrefix(args.sasToken, "?")
+	}
+	args.sourceURL = u.String()
+	return nil
+}
+
+// redactedSourceURL returns the source URL without its SAS token, for logging.
+func (args *azureImportArguments) redactedSourceURL() string {
+	return redactBlobURI(args.sourceURL)
+}
+
+// redactError removes the SAS token from the URL of a *url.Error, which
+// net/http returns with the full URL of the request.
+func (args *azureImportArguments) redactError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return &url.Error{Op: urlErr.Op, URL: redactBlobURI(urlErr.URL), Err: urlErr.Err}
+	}
+	return err
+}
+
+// redactBlobURI returns uri without its query string, which holds the SAS
+// token. A placeholder is returned when uri can't be parsed, as any part of
+// it could be the token.
+func redactBlobURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return redactedBlobURI
+	}
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.User = nil
+	return u.String()
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,106 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAzureFailWhenSourceURINotProvided(t *testing.T) {
+	azureArgs := getAzureImportArgs(setUpArgs(""))
+	assert.EqualError(t, azureArgs.validate(), "The flag -azure_source_uri must be provided")
+}
+
+func TestAzureSourceURIWithSASToken(t *testing.T) {
+	azureArgs := getAzureImportArgs(setUpArgs("",
+		"-azure_source_uri=https://md-abc.blob.core.windows.net/xyz/abcd?sv=2018&sig=secret"))
+	assert.NoError(t, azureArgs.validate())
+	assert.Equal(t, "https://md-abc.blob.core.windows.net/xyz/abcd?sv=2018&sig=secret", azureArgs.sourceURL)
+	assert.Equal(t, "https://md-abc.blob.core.windows.net/xyz/abcd", azureArgs.redactedSourceURL())
+}
+
+func TestAzureSASTokenAppendedToSourceURI(t *testing.T) {
+	azureArgs := getAzureImportArgs(setUpArgs("",
+		"-azure_source_uri=https://account.blob.core.windows.net/vhds/disk.vhd",
+		"-azure_sas_token=?sv=2018&sig=secret"))
+	assert.NoError(t, azureArgs.validate())
+	assert.Equal(t, "https://account.blob.core.windows.net/vhds/disk.vhd?sv=2018&sig=secret", azureArgs.sourceURL)
+}
+
+func TestAzureFailWhenSASTokenSpecifiedTwice(t *testing.T) {
+	azureArgs := getAzureImportArgs(setUpArgs("",
+		"-azure_source_uri=https://account.blob.core.windows.net/vhds/disk.vhd?sig=a",
+		"-azure_sas_token=sig=b"))
+	assert.EqualError(t, azureArgs.validate(),
+		"-azure_sas_token must not be specified when -azure_source_uri already has a SAS token")
+}
+
+func TestAzureFailWhenSourceURIInvalid(t *testing.T) {
+	for _, uri := range []string{
+		"https://account.blob.core.windows.net",
+		"account.blob.core.windows.net/vhds/disk.vhd",
+		"http://account.blob.core.windows.net/vhds/disk.vhd",
+		"s3://bucket/object",
+	} {
+		azureArgs := getAzureImportArgs(setUpArgs("", "-azure_source_uri="+uri))
+		assert.Error(t, azureArgs.validate(), uri)
+	}
+}
+
+func TestAzureValidationErrorsHideSASToken(t *testing.T) {
+	for _, uri := range []string{
+		"https://account.blob.core.windows.net?sv=2018&sig=topsecret",
+		"http://account.blob.core.windows.net/vhds/disk.vhd?sv=2018&sig=topsecret",
+		"https://account.blob.core.windows.net/vhds/%zz?sv=2018&sig=topsecret",
+		"https://account.blob.core.windows.net/%zz/sig=topsecret",
+	} {
+		azureArgs := getAzureImportArgs(setUpArgs("", "-azure_source_uri="+uri))
+		err := azureArgs.validate()
+		if assert.Error(t, err, uri) {
+			assert.NotContains(t, err.Error(), "topsecret", uri)
+		}
+	}
+}
+
+func TestAzureRedactedSourceURLHidesUnparseableURL(t *testing.T) {
+	azureArgs := getAzureImportArgs(setUpArgs(""))
+	azureArgs.sourceURL = "https://account.blob.core.windows.net/%zz?sig=topsecret"
+	assert.Equal(t, redactedBlobURI, azureArgs.redactedSourceURL())
+}
+
+func TestAzureAllowHTTPForLoopback(t *testing.T) {
+	for _, uri := range []string{"http://127.0.0.1:1234/c/disk.vhd", "http://localhost/c/disk.vhd"} {
+		azureArgs := getAzureImportArgs(setUpArgs("", "-azure_source_uri="+uri))
+		assert.NoError(t, azureArgs.validate(), uri)
+	}
+}
+
+func TestAzurePopulatorError(t *testing.T) {
+	azureArgs := getAzureImportArgs(setUpArgs("", "-azure_source_uri=https://account.blob.core.windows.net/vhds/disk.vhd"))
+	err := azureArgs.validateAndPopulate(mockPopulator{err: fmt.Errorf("populate failed")})
+	assert.EqualError(t, err, "populate failed")
+}
+
+func TestAzurePopulatesMissingParameters(t *testing.T) {
+	azureArgs := getAzureImportArgs(setUpArgs("", "-azure_source_uri=https://account.blob.core.windows.net/vhds/disk.vhd"))
+	err := azureArgs.validateAndPopulate(mockPopulator{project: "project", zone: "zone", scratchBucket: "gs://bucket"})
+	assert.NoError(t, err)
+	assert.Equal(t, "project", *azureArgs.gcsProjectPtr)
+	assert.Equal(t, "zone", azureArgs.gcsZone)
+	assert.Equal(t, "gs://bucket", azureArgs.gcsScratchBucket)
+}
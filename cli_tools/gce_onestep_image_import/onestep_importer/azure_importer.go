@@ -0,0 +1,264 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/compute"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/param"
+	pathutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/path"
+	storageutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+const (
+	// azureAPIVersion is sent with blob requests, Range headers need at
+	// least 2011-08-18.
+	azureAPIVersion = "2019-12-12"
+
+	vhdFooterSize     = 512
+	vhdFooterCookie   = "conectix"
+	vhdDiskTypeOffset = 60
+	vhdDiskTypeFixed  = 2
+)
+
+// azureImporter is responsible for importing a VHD from Azure blob storage,
+// such as the SAS URL of an exported managed disk.
+type azureImporter struct {
+	gcsFileImporter
+	args           *azureImportArguments
+	httpClient     *http.Client
+	paramPopulator param.Populator
+
+	// Impl of the functions
+	getAzureFileSizeFn   func() error
+	copyFromAzureToGCSFn func() (string, error)
+	transferFileFn       func() error
+	importImageFn        func() error
+	cleanUpFn            func()
+}
+
+// newAzureImporter creates an new azureImporter instance.
+// Automatically populating dependencies, such as compute/storage clients.
+func newAzureImporter(oauth string, timeoutChan chan struct{}, args *azureImportArguments) (*azureImporter, error) {
+	ctx := context.Background()
+	client, err := createGCSClient(ctx, oauth)
+	if err != nil {
+		return nil, err
+	}
+
+	computeClient, err := param.CreateComputeClient(&ctx, oauth, args.gcsComputeEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataGCE := &compute.MetadataGCE{}
+	paramPopulator := param.NewPopulator(
+		metadataGCE,
+		client,
+		storageutils.NewResourceLocationRetriever(metadataGCE, computeClient),
+		storageutils.NewScratchBucketCreator(ctx, client),
+	)
+
+	importer := &azureImporter{
+		gcsFileImporter: gcsFileImporter{
+			gcsClient:   client,
+			ctx:         ctx,
+			oauth:       oauth,
+			timeoutChan: timeoutChan,
+		},
+		args:           args,
+		httpClient:     &http.Client{},
+		paramPopulator: paramPopulator,
+	}
+
+	return importer, nil
+}
+
+// run runs the azure importer to import a VHD.
+func (importer *azureImporter) run(importArgs *OneStepImportArguments) error {
+	startTime := time.Now()
+	// 1. validate Azure args
+	err := importer.args.validateAndPopulate(importer.paramPopulator)
+	if err != nil {
+		return err
+	}
+
+	// 2. check the VHD can be imported
+	if err := importer.getAzureFileSize(); err != nil {
+		return err
+	}
+
+	// 3. copy from Azure to GCS
+	log.Println("Starting to copy ...")
+	gcsFilePath, err := importer.copyFromAzureToGCS()
+	if err != nil {
+		return err
+	}
+
+	// 4. run image import
+	log.Println("Starting to import image ...")
+	err = importer.importImage(importArgs, startTime, gcsFilePath)
+	if err != nil {
+		return err
+	}
+	log.Println("Image import from Azure finished successfully!")
+
+	// 5. clean up temporary image file created in GCS
+	log.Println("Cleaning up ...")
+	importer.cleanUp(gcsFilePath)
+
+	return nil
+}
+
+// cleanUp deletes the temporary file created during image import, and closes GCS client.
+func (importer *azureImporter) cleanUp(gcsFilePath string) {
+	if importer.cleanUpFn != nil {
+		importer.cleanUpFn()
+		return
+	}
+	importer.cleanUpGCS(gcsFilePath)
+}
+
+// importImage updates importArgs to contain the image source file and updated timeout duration.
+// It runs image import to import from gcsFilePath to Compute Engine.
+func (importer *azureImporter) importImage(importArgs *OneStepImportArguments, startTime time.Time, gcsFilePath string) error {
+	if importer.importImageFn != nil {
+		return importer.importImageFn()
+	}
+	return importer.importFromGCS(importArgs, startTime, gcsFilePath, "azure")
+}
+
+// newBlobRequest creates a request for the source blob.
+func (importer *azureImporter) newBlobRequest(method string) (*http.Request, error) {
+	req, err := http.NewRequest(method, importer.args.sourceURL, nil)
+	if err != nil {
+		return nil, daisy.Errf("failed to create request for %v: %v", importer.args.redactedSourceURL(), importer.args.redactError(err))
+	}
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	return req.WithContext(importer.ctx), nil
+}
+
+// getBlobRange downloads bytes start to end, inclusive, of the source blob.
+func (importer *azureImporter) getBlobRange(start, end int64) (io.ReadCloser, error) {
+	req, err := importer.newBlobRequest(http.MethodGet)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%v-%v", start, end))
+	resp, err := importer.httpClient.Do(req)
+	if err != nil {
+		return nil, importer.args.redactError(err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response: %v", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// getAzureFileSize gets the size of the VHD to copy from Azure to GCS, and
+// checks its footer to make sure it's a fixed VHD.
+func (importer *azureImporter) getAzureFileSize() error {
+	if importer.getAzureFileSizeFn != nil {
+		return importer.getAzureFileSizeFn()
+	}
+
+	req, err := importer.newBlobRequest(http.MethodHead)
+	if err != nil {
+		return err
+	}
+	resp, err := importer.httpClient.Do(req)
+	if err != nil {
+		return daisy.Errf("failed to get file size: %v", importer.args.redactError(err))
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return daisy.Errf("failed to get file size: unexpected response: %v", resp.Status)
+	}
+	fileSize := resp.ContentLength
+	if fileSize <= 0 {
+		return daisy.Errf("file is empty")
+	}
+	if fileSize < vhdFooterSize || fileSize%vhdFooterSize != 0 {
+		return daisy.Errf("%v is not a fixed VHD: size %v is not a multiple of %v bytes",
+			importer.args.redactedSourceURL(), fileSize, vhdFooterSize)
+	}
+
+	body, err := importer.getBlobRange(fileSize-vhdFooterSize, fileSize-1)
+	if err != nil {
+		return daisy.Errf("failed to read VHD footer: %v", err)
+	}
+	defer body.Close()
+	footer, err := ioutil.ReadAll(io.LimitReader(body, vhdFooterSize))
+	if err != nil {
+		return daisy.Errf("failed to read VHD footer: %v", err)
+	}
+	if err := checkFixedVHDFooter(footer); err != nil {
+		return daisy.Errf("%v is not a fixed VHD: %v", importer.args.redactedSourceURL(), err)
+	}
+
+	importer.args.sourceFileSize = fileSize
+	return nil
+}
+
+// checkFixedVHDFooter returns an error unless footer is the footer of a fixed
+// VHD, the only type of VHD Azure stores disks as.
+func checkFixedVHDFooter(footer []byte) error {
+	if len(footer) != vhdFooterSize || string(footer[:len(vhdFooterCookie)]) != vhdFooterCookie {
+		return fmt.Errorf("VHD footer not found")
+	}
+	if diskType := binary.BigEndian.Uint32(footer[vhdDiskTypeOffset:]); diskType != vhdDiskTypeFixed {
+		return fmt.Errorf("disk type is %v, want %v", diskType, vhdDiskTypeFixed)
+	}
+	return nil
+}
+
+// copyFromAzureToGCS copies the VHD from Azure to GCS.
+func (importer *azureImporter) copyFromAzureToGCS() (string, error) {
+	if importer.copyFromAzureToGCSFn != nil {
+		return importer.copyFromAzureToGCSFn()
+	}
+
+	gcsFilePath := pathutils.JoinURL(importer.args.gcsScratchBucket,
+		fmt.Sprintf("onestep-image-import-azure-%v.vhd", pathutils.RandString(5)))
+	if err := importer.copyToGCS(importer.args.redactedSourceURL(), gcsFilePath, importer.args.executablePath, importer.transferFile); err != nil {
+		return gcsFilePath, err
+	}
+	return gcsFilePath, nil
+}
+
+// transferFile downloads the VHD in ranges and uploads them to GCS concurrently.
+func (importer *azureImporter) transferFile(writer io.WriteCloser) error {
+	if importer.transferFileFn != nil {
+		return importer.transferFileFn()
+	}
+	u := &uploader{
+		readerChan:    make(chan io.ReadCloser, downloadBufNum),
+		writer:        writer,
+		totalFileSize: importer.args.sourceFileSize,
+		uploadErrChan: make(chan error),
+	}
+	return importer.gcsFileImporter.transferFile(u, importer.args.redactedSourceURL(),
+		importer.args.sourceFileSize, importer.getBlobRange)
+}
@@ -0,0 +1,214 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVHD returns a VHD of diskType with size bytes of data.
+func fakeVHD(size int, diskType uint32) []byte {
+	vhd := bytes.Repeat([]byte("d"), size+vhdFooterSize)
+	footer := vhd[size:]
+	copy(footer, vhdFooterCookie)
+	binary.BigEndian.PutUint32(footer[vhdDiskTypeOffset:], diskType)
+	return vhd
+}
+
+// newBlobServer starts a local stand-in for Azure blob storage serving blob
+// at /container/disk, for requests carrying the SAS signature "secret".
+func newBlobServer(t *testing.T, blob []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/container/disk" || r.URL.Query().Get("sig") != "secret" {
+			http.Error(w, "blob not found", http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, azureAPIVersion, r.Header.Get("x-ms-version"))
+		w.Header().Set("x-ms-blob-type", "PageBlob")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+	}))
+}
+
+func getAzureImporter(t *testing.T, srv *httptest.Server, uri string) *azureImporter {
+	azureArgs := getAzureImportArgs(setUpArgs("", "-azure_source_uri="+srv.URL+uri))
+	assert.NoError(t, azureArgs.validate())
+	return &azureImporter{
+		gcsFileImporter: gcsFileImporter{
+			ctx:         context.Background(),
+			timeoutChan: make(chan struct{}),
+		},
+		args:           azureArgs,
+		httpClient:     srv.Client(),
+		paramPopulator: mockPopulator{},
+	}
+}
+
+func TestAzureGetFileSize(t *testing.T) {
+	srv := newBlobServer(t, fakeVHD(4096, vhdDiskTypeFixed))
+	defer srv.Close()
+
+	importer := getAzureImporter(t, srv, "/container/disk?sig=secret")
+	assert.NoError(t, importer.getAzureFileSize())
+	assert.Equal(t, int64(4096+vhdFooterSize), importer.args.sourceFileSize)
+}
+
+func TestAzureGetFileSizeReturnErrorWhenNotFound(t *testing.T) {
+	srv := newBlobServer(t, fakeVHD(4096, vhdDiskTypeFixed))
+	defer srv.Close()
+
+	importer := getAzureImporter(t, srv, "/container/disk?sig=wrong")
+	err := importer.getAzureFileSize()
+	assert.Contains(t, err.Error(), "failed to get file size: unexpected response: 404")
+	assert.NotContains(t, err.Error(), "wrong")
+}
+
+func TestAzureGetFileSizeErrorHidesSASToken(t *testing.T) {
+	srv := newBlobServer(t, fakeVHD(4096, vhdDiskTypeFixed))
+	importer := getAzureImporter(t, srv, "/container/disk?sig=secret")
+	srv.Close()
+
+	err := importer.getAzureFileSize()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to get file size")
+		assert.NotContains(t, err.Error(), "sig=secret")
+	}
+}
+
+func TestAzureGetFileSizeReturnErrorWhenNotFixedVHD(t *testing.T) {
+	tests := []struct {
+		name string
+		blob []byte
+		want string
+	}{
+		{"dynamic", fakeVHD(4096, 3), "disk type is 3, want 2"},
+		{"no footer", bytes.Repeat([]byte("d"), 4096), "VHD footer not found"},
+		{"unaligned", []byte("conectix"), "is not a multiple of 512 bytes"},
+	}
+	for _, tt := range tests {
+		srv := newBlobServer(t, tt.blob)
+		importer := getAzureImporter(t, srv, "/container/disk?sig=secret")
+		err := importer.getAzureFileSize()
+		if assert.Error(t, err, tt.name) {
+			assert.Contains(t, err.Error(), "is not a fixed VHD", tt.name)
+			assert.Contains(t, err.Error(), tt.want, tt.name)
+		}
+		srv.Close()
+	}
+}
+
+func TestAzureTransferFile(t *testing.T) {
+	vhd := fakeVHD(8192, vhdDiskTypeFixed)
+	srv := newBlobServer(t, vhd)
+	defer srv.Close()
+
+	importer := getAzureImporter(t, srv, "/container/disk?sig=secret")
+	assert.NoError(t, importer.getAzureFileSize())
+	var output bytes.Buffer
+	writer := testWriteCloser{Writer: bufio.NewWriter(&output)}
+	assert.NoError(t, importer.transferFile(writer))
+	assert.Equal(t, vhd, output.Bytes())
+}
+
+func TestAzureTransferFileReturnErrorWhenWriterCloseFail(t *testing.T) {
+	srv := newBlobServer(t, fakeVHD(512, vhdDiskTypeFixed))
+	defer srv.Close()
+
+	importer := getAzureImporter(t, srv, "/container/disk?sig=secret")
+	assert.NoError(t, importer.getAzureFileSize())
+	var output bytes.Buffer
+	writer := testWriteCloser{Writer: bufio.NewWriter(&output), closeReturnVal: fmt.Errorf("close writer failed")}
+	err := importer.transferFile(writer)
+	assert.EqualError(t, err, "close writer failed")
+}
+
+func TestAzureTransferFileReturnErrorWhenDownloadFails(t *testing.T) {
+	defer func(d time.Duration) { downloadRetryDelay = d }(downloadRetryDelay)
+	downloadRetryDelay = 0
+	srv := newBlobServer(t, fakeVHD(512, vhdDiskTypeFixed))
+	defer srv.Close()
+
+	importer := getAzureImporter(t, srv, "/container/disk?sig=secret")
+	assert.NoError(t, importer.getAzureFileSize())
+	importer.args.sourceURL = srv.URL + "/container/disk?sig=wrong"
+	var output bytes.Buffer
+	err := importer.transferFile(testWriteCloser{Writer: bufio.NewWriter(&output)})
+	assert.Contains(t, err.Error(), "error in downloading from")
+	assert.Contains(t, err.Error(), "404")
+	assert.NotContains(t, err.Error(), "wrong")
+}
+
+func TestAzureRun(t *testing.T) {
+	srv := newBlobServer(t, fakeVHD(512, vhdDiskTypeFixed))
+	defer srv.Close()
+
+	importer := getAzureImporter(t, srv, "/container/disk")
+	importer.args.sasToken = "sig=secret"
+	importArgs := expectSuccessfulParse(t)
+
+	var copied, imported, cleanedUp bool
+	importer.copyFromAzureToGCSFn = func() (string, error) {
+		copied = true
+		return "gs://bucket/disk.vhd", nil
+	}
+	importer.importImageFn = func() error {
+		imported = true
+		return nil
+	}
+	importer.cleanUpFn = func() { cleanedUp = true }
+
+	assert.NoError(t, importer.run(importArgs))
+	assert.True(t, copied)
+	assert.True(t, imported)
+	assert.True(t, cleanedUp)
+	assert.True(t, strings.HasSuffix(importer.args.sourceURL, "/container/disk?sig=secret"))
+}
+
+func TestAzureRunStopsWhenCopyFails(t *testing.T) {
+	srv := newBlobServer(t, fakeVHD(512, vhdDiskTypeFixed))
+	defer srv.Close()
+
+	importer := getAzureImporter(t, srv, "/container/disk?sig=secret")
+	importer.copyFromAzureToGCSFn = func() (string, error) {
+		return "", fmt.Errorf("failed")
+	}
+	importer.importImageFn = func() error {
+		t.Error("image import should not run")
+		return nil
+	}
+	assert.EqualError(t, importer.run(expectSuccessfulParse(t)), "failed")
+}
+
+func TestAzureImportImageUpdateImporterArgs(t *testing.T) {
+	srv := newBlobServer(t, fakeVHD(512, vhdDiskTypeFixed))
+	defer srv.Close()
+
+	importer := getAzureImporter(t, srv, "/container/disk?sig=secret")
+	importArgs := expectSuccessfulParse(t)
+	importArgs.Timeout = 0
+	err := importer.importImage(importArgs, time.Now(), "gs://bucket/disk.vhd")
+	assert.EqualError(t, err, "timeout exceeded")
+	assert.Equal(t, "gs://bucket/disk.vhd", importArgs.SourceFile)
+}
@@ -0,0 +1,195 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	pathutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/path"
+	storageutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+	"github.com/dustin/go-humanize"
+)
+
+// downloadRetryDelay is the unit of the delays between download retries.
+var downloadRetryDelay = time.Second
+
+// gcsFileImporter is shared by the importers of all cloud providers. It copies
+// a file from the cloud provider to GCS, downloading it in ranges with a
+// provider specific function, imports the copy and deletes it.
+type gcsFileImporter struct {
+	gcsClient   domain.StorageClientInterface
+	ctx         context.Context
+	oauth       string
+	timeoutChan chan struct{}
+	uploader    *uploader
+}
+
+// copyToGCS copies source to gcsFilePath. transfer writes the file to the
+// writer it is given, which buffers chunks in a folder next to executablePath.
+func (importer *gcsFileImporter) copyToGCS(source, gcsFilePath, executablePath string, transfer func(io.WriteCloser) error) error {
+	start := time.Now()
+	log.Printf("Copying %v to %v.\n", source, gcsFilePath)
+
+	// 1. create a new folder for local buffer
+	path := filepath.Join(filepath.Dir(executablePath), fmt.Sprint("upload", pathutils.RandString(5)))
+
+	err := os.Mkdir(path, 0755)
+	if err != nil {
+		return daisy.ToDError(err)
+	}
+	defer os.RemoveAll(path)
+
+	// 2. get writer
+	bs, err := humanize.ParseBytes(uploadBufSize)
+	if err != nil {
+		return daisy.ToDError(err)
+	}
+	bkt, obj, err := storageutils.GetGCSObjectPathElements(gcsFilePath)
+	if err != nil {
+		return err
+	}
+	workers := int64(runtime.NumCPU())
+	writer := storageutils.NewBufferedWriter(importer.ctx, int64(bs), workers, createGCSClient, importer.oauth, path, bkt, obj)
+
+	// 3. transfer file to GCS
+	if err := transfer(writer); err != nil {
+		return err
+	}
+	log.Printf("Successfully copied to %v in %v.\n", gcsFilePath, time.Since(start))
+	return nil
+}
+
+// transferFile downloads a file of fileSize bytes in ranges with getRange,
+// which returns bytes start to end, inclusive, and uploads them with u
+// concurrently. source names the file in errors.
+func (importer *gcsFileImporter) transferFile(u *uploader, source string, fileSize int64,
+	getRange func(start, end int64) (io.ReadCloser, error)) error {
+	// 1. Set up download size and get number of chunks to download
+	output, err := humanize.ParseBytes(downloadBufSize)
+	if err != nil {
+		return daisy.ToDError(err)
+	}
+	readSize := int64(output)
+	// Take ceiling to get number of chunks to download.
+	readers := (fileSize-1)/readSize + 1
+	// Set up download retry delay interval
+	delayTime := []int{1, 2, 4, 8, 8}
+	maxRetryTimes := len(delayTime)
+
+	// 2. Set up upload info
+	importer.uploader = u
+	importer.uploader.Add(1)
+	go importer.uploader.uploadFile()
+
+	// 3. Range download
+	for i := int64(0); i < readers; i++ {
+		startRange := i * readSize
+		endRange := startRange + readSize - 1
+		if endRange >= fileSize {
+			endRange = fileSize - 1
+		}
+		for retryAttempt := 0; ; retryAttempt++ {
+			body, err := getRange(startRange, endRange)
+			if err != nil {
+				if retryAttempt >= maxRetryTimes {
+					importer.uploader.cleanup()
+					return daisy.Errf("error in downloading from %v: %v", source, err)
+				}
+				time.Sleep(time.Duration(delayTime[retryAttempt]) * downloadRetryDelay)
+				continue
+			}
+			importer.uploader.readerChan <- body
+			break
+		}
+
+		// Stop downloading as soon as one of the upload fails.
+		select {
+		case err := <-importer.uploader.uploadErrChan:
+			importer.uploader.cleanup()
+			return err
+		default:
+			// No error, continue to download.
+		}
+
+		// Stop downloading if timeout exceeded.
+		select {
+		case <-importer.timeoutChan:
+			importer.uploader.cleanup()
+			return daisy.Errf("timeout exceeded during transfer file")
+		default:
+			// Did not timeout, continue to download.
+		}
+	}
+
+	// All file chunks are downloaded, wait for upload to finish.
+	close(importer.uploader.readerChan)
+	importer.uploader.Wait()
+
+	err = importer.uploader.writer.Close()
+	if err != nil {
+		return daisy.ToDError(err)
+	}
+	return nil
+}
+
+// importFromGCS updates importArgs to contain the image source file and
+// updated timeout duration. It runs image import to import from gcsFilePath
+// to Compute Engine, labelling the image with the cloud provider it came from.
+func (importer *gcsFileImporter) importFromGCS(importArgs *OneStepImportArguments, startTime time.Time, gcsFilePath, provider string) error {
+	// update source file flag to copied GCS destination
+	importArgs.SourceFile = gcsFilePath
+
+	// adjust timeout to pass into image import
+	importArgs.Timeout = importArgs.Timeout - time.Since(startTime)
+	if importArgs.Timeout <= 0 {
+		return daisy.Errf("timeout exceeded")
+	}
+
+	// add label to indicate the image import is run from onestep import
+	if importArgs.Labels == nil {
+		importArgs.Labels = make(map[string]string)
+	}
+	importArgs.Labels["onestep-image-import"] = provider
+
+	err := runImageImport(importArgs)
+	if err != nil {
+		log.Printf("Failed to import image. "+
+			"The image file is copied to Cloud Storage, located at %v.\n", gcsFilePath)
+		return err
+	}
+
+	return nil
+}
+
+// cleanUpGCS deletes the file copied to gcsFilePath, and closes GCS client.
+func (importer *gcsFileImporter) cleanUpGCS(gcsFilePath string) {
+	err := importer.gcsClient.DeleteGcsPath(gcsFilePath)
+	if err != nil {
+		log.Printf("Could not delete image file %v: %v. "+
+			"To avoid incurring charges to your billing account, "+
+			"you must manually delete the file from the storage location.\n", gcsFilePath, err.Error())
+	}
+
+	importer.gcsClient.Close()
+}
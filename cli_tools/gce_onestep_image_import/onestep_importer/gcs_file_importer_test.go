@@ -0,0 +1,63 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferFileCallsCleanupWhenDownloadRetriesExhausted(t *testing.T) {
+	defer func(d time.Duration) { downloadRetryDelay = d }(downloadRetryDelay)
+	downloadRetryDelay = 0
+
+	var output bytes.Buffer
+	u := getTestUploader(testWriteCloser{Writer: bufio.NewWriter(&output)})
+	isCleanupCalled := false
+	u.cleanupFn = func() { isCleanupCalled = true }
+
+	downloads := 0
+	importer := &gcsFileImporter{timeoutChan: make(chan struct{})}
+	err := importer.transferFile(u, "source", 100, func(start, end int64) (io.ReadCloser, error) {
+		downloads++
+		return nil, fmt.Errorf("download failed")
+	})
+	assert.EqualError(t, err, "error in downloading from source: download failed")
+	assert.Equal(t, 6, downloads)
+	assert.True(t, isCleanupCalled)
+}
+
+func TestTransferFileDownloadsRanges(t *testing.T) {
+	var output bytes.Buffer
+	writer := testWriteCloser{Writer: bufio.NewWriter(&output)}
+	u := getTestUploader(writer)
+
+	var ranges [][2]int64
+	importer := &gcsFileImporter{timeoutChan: make(chan struct{})}
+	err := importer.transferFile(u, "source", 10, func(start, end int64) (io.ReadCloser, error) {
+		ranges = append(ranges, [2]int64{start, end})
+		return ioutil.NopCloser(bytes.NewReader([]byte("file data!"))), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int64{{0, 9}}, ranges)
+	assert.Equal(t, "file data!", output.String())
+}
@@ -69,6 +69,9 @@ type OneStepImportArguments struct {
 	AWSAMIID             string
 	AWSAMIExportLocation string
 	AWSSourceAMIFilePath string
+
+	AzureSourceURI string
+	AzureSASToken  string
 }
 
 // Flags that are validated.
@@ -129,6 +132,14 @@ func (args *OneStepImportArguments) registerFlags(flagSet *flag.FlagSet) {
 			"This credential is associated with an IAM user or role. "+
 			"This IAM user must have permissions to import images.")
 
+	flagSet.Var((*flags.TrimmedString)(&args.AzureSourceURI), azureSourceURIFlag,
+		"The URI of the fixed VHD to import from Azure blob storage, "+
+			"such as the SAS URL of an exported managed disk.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.AzureSASToken), azureSASTokenFlag,
+		"A SAS token granting read access to -"+azureSourceURIFlag+", "+
+			"if the URI doesn't include one.")
+
 	flagSet.Var((*flags.LowerTrimmedString)(&args.ClientID), clientFlag,
 		"Identifies the client of the importer, e.g. 'gcloud', 'pantheon', or 'api'.")
 
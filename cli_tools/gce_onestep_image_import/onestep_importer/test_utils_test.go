@@ -118,3 +118,8 @@ func getTestUploader(writer io.WriteCloser) *uploader {
 		uploadErrChan: make(chan error),
 	}
 }
+
+func getAzureImportArgs(args []string) *azureImportArguments {
+	importerArgs, _ := NewOneStepImportArguments(args)
+	return newAzureImportArguments(importerArgs)
+}
@@ -52,11 +52,27 @@ type cloudProviderImporter interface {
 	run(args *OneStepImportArguments) error
 }
 
+// Constructors of the importers of each cloud provider, replaced in tests.
+var (
+	newAWSImporterFn = func(args *OneStepImportArguments) (cloudProviderImporter, error) {
+		return newAWSImporter(args.Oauth, args.TimeoutChan, newAWSImportArguments(args))
+	}
+	newAzureImporterFn = func(args *OneStepImportArguments) (cloudProviderImporter, error) {
+		return newAzureImporter(args.Oauth, args.TimeoutChan, newAzureImportArguments(args))
+	}
+)
+
 // newImporterFormCloudProvider evaluates the cloud provider of the source image
-// and creates a new instance of cloudProviderImporter. Currently, only AWS cloud
-// provider is supported.
+// and creates a new instance of cloudProviderImporter. Azure is used when
+// -azure_source_uri is specified, AWS otherwise.
 func newImporterForCloudProvider(args *OneStepImportArguments) (cloudProviderImporter, error) {
-	return newAWSImporter(args.Oauth, args.TimeoutChan, newAWSImportArguments(args))
+	if args.AzureSourceURI != "" {
+		if args.AWSAMIID != "" || args.AWSAMIExportLocation != "" || args.AWSSourceAMIFilePath != "" {
+			return nil, daisy.Errf("specify either -%v to import from Azure, or AWS flags to import from AWS, not both", azureSourceURIFlag)
+		}
+		return newAzureImporterFn(args)
+	}
+	return newAWSImporterFn(args)
 }
 
 // importFromCloudProvider imports image from the specified cloud provider
@@ -178,3 +178,47 @@ func TestRunCmd(t *testing.T) {
 
 	assert.Contains(t, string(expected), actual)
 }
+
+// fakeImporterConstructors replaces the importer constructors with fakes
+// that return the name of the cloud provider, and restores them when the
+// returned function is called.
+func fakeImporterConstructors() func() {
+	awsFn, azureFn := newAWSImporterFn, newAzureImporterFn
+	newAWSImporterFn = func(args *OneStepImportArguments) (cloudProviderImporter, error) {
+		return fakeCloudProviderImporter("aws"), nil
+	}
+	newAzureImporterFn = func(args *OneStepImportArguments) (cloudProviderImporter, error) {
+		return fakeCloudProviderImporter("azure"), nil
+	}
+	return func() { newAWSImporterFn, newAzureImporterFn = awsFn, azureFn }
+}
+
+type fakeCloudProviderImporter string
+
+func (fakeCloudProviderImporter) run(args *OneStepImportArguments) error {
+	return nil
+}
+
+func TestNewImporterForAzure(t *testing.T) {
+	defer fakeImporterConstructors()()
+	importer, err := newImporterForCloudProvider(expectSuccessfulParse(t,
+		"-azure_source_uri=https://account.blob.core.windows.net/vhds/disk.vhd"))
+	assert.Nil(t, err)
+	assert.Equal(t, fakeCloudProviderImporter("azure"), importer)
+}
+
+func TestNewImporterForAWS(t *testing.T) {
+	defer fakeImporterConstructors()()
+	importer, err := newImporterForCloudProvider(expectSuccessfulParse(t,
+		"-aws_source_ami_file_path=s3://bucket/object"))
+	assert.Nil(t, err)
+	assert.Equal(t, fakeCloudProviderImporter("aws"), importer)
+}
+
+func TestNewImporterFailWhenAzureAndAWSSpecified(t *testing.T) {
+	defer fakeImporterConstructors()()
+	_, err := newImporterForCloudProvider(expectSuccessfulParse(t,
+		"-azure_source_uri=https://account.blob.core.windows.net/vhds/disk.vhd",
+		"-aws_source_ami_file_path=s3://bucket/object"))
+	assert.EqualError(t, err, "specify either -azure_source_uri to import from Azure, or AWS flags to import from AWS, not both")
+}
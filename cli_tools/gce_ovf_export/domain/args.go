@@ -48,6 +48,9 @@ const (
 	// OvfFormatFlagKey is key for OVF format flag
 	OvfFormatFlagKey = "ovf-format"
 
+	// OvaFlagKey is key for the flag that packs the export into an OVA
+	OvaFlagKey = "ova"
+
 	mainWorkflowDir = "daisy_workflows/"
 
 	//Alpha represents alpha release track
@@ -73,6 +76,7 @@ type OVFExportArgs struct {
 	ClientID              string
 	ClientVersion         string
 	DestinationURI        string
+	Ova                   bool
 	DiskExportFormat      string
 	OsID                  string
 	Network               string
@@ -103,6 +107,12 @@ type OVFExportArgs struct {
 	OvfName string
 }
 
+// GetOvaPath returns the GCS path of the OVA that the export is packed into,
+// e.g. `gs://my-bucket/my-folder/vm.ova`.
+func (args *OVFExportArgs) GetOvaPath() string {
+	return fmt.Sprintf("%v%v.ova", args.DestinationDirectory, args.OvfName)
+}
+
 // NewOVFExportArgs parses args to create an NewOVFExportArgs instance.
 // No validation is done here.
 func NewOVFExportArgs(args []string) (*OVFExportArgs, error) {
@@ -187,7 +197,9 @@ func (args *OVFExportArgs) registerFlags(cliArgs []string) error {
 	flagSet.Var((*flags.TrimmedString)(&args.ClientVersion), "client-version",
 		"Identifies the version of the client of the exporter.")
 	flagSet.Var((*flags.TrimmedString)(&args.DestinationURI), DestinationURIFlagKey,
-		"Google Cloud Storage URI of the OVF descriptor or directory to export to. For example: `gs://my-bucket/my-vm.ovf` or `gs://my-bucket/my-ovf/`.")
+		"Google Cloud Storage URI of the OVF descriptor, OVA or directory to export to. For example: `gs://my-bucket/my-vm.ovf`, `gs://my-bucket/my-vm.ova` or `gs://my-bucket/my-ovf/`.")
+	flagSet.BoolVar(&args.Ova, OvaFlagKey, false,
+		"Pack the exported OVF descriptor, manifest and disks into a single OVA file. Implied when -destination-uri ends with `.ova`.")
 	flagSet.Var((*flags.LowerTrimmedString)(&args.DiskExportFormat), "disk-export-format",
 		"format for disks in OVF, such as vmdk, vhdx, vpc, or qcow2. Any format supported by qemu-img is supported by OVF export. Defaults to `vmdk`.")
 	flagSet.Var((*flags.TrimmedString)(&args.Network), "network",
@@ -32,6 +32,16 @@ func TestIsMachineImageExport(t *testing.T) {
 	assert.True(t, GetAllMachineImageExportArgs().IsMachineImageExport())
 }
 
+func TestGetOvaPath(t *testing.T) {
+	assert.Equal(t, "gs://ovfbucket/OVFpath/ovfinst.ova", GetAllInstanceExportArgs().GetOvaPath())
+}
+
+func TestNewOVFExportArgs_Ova(t *testing.T) {
+	args, err := NewOVFExportArgs([]string{"-ova"})
+	assert.NoError(t, err)
+	assert.True(t, args.Ova)
+}
+
 func TestDaisyAttrs(t *testing.T) {
 	params := GetAllInstanceExportArgs()
 	assert.Equal(t,
@@ -54,6 +54,15 @@ type OvfManifestGenerator interface {
 	Cancel(reason string) bool
 }
 
+// OvaPackager packs the files of an exported OVF into an OVA archive in
+// Cloud Storage, and deletes the files once the archive is written.
+// To rebuild the mock, run `go generate ./...`
+//go:generate go run github.com/golang/mock/mockgen -package mocks -destination mocks/mock_ova_packager.go github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_export/domain OvaPackager
+type OvaPackager interface {
+	PackageToGCS(ovaGcsPath string, fileGcsPaths []string) error
+	Cancel(reason string) bool
+}
+
 // OvfDescriptorGenerator is responsible for generating OVF descriptor based on
 // GCE instance being exported.
 // To rebuild the mock, run `go generate ./...`
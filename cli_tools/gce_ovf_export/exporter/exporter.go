@@ -58,6 +58,7 @@ type OVFExporter struct {
 	inspector                 commondisk.Inspector
 	ovfDescriptorGenerator    ovfexportdomain.OvfDescriptorGenerator
 	manifestFileGenerator     ovfexportdomain.OvfManifestGenerator
+	ovaPackager               ovfexportdomain.OvaPackager
 	exportedDisks             []*ovfexportdomain.ExportedDisk
 	bootDiskInspectionResults *pb.InspectionResults
 	loggableBuilder           *service.OvfExportLoggableBuilder
@@ -100,6 +101,7 @@ func NewOVFExporter(params *ovfexportdomain.OVFExportArgs, logger logging.ToolLo
 		loggableBuilder:        service.NewOvfExportLoggableBuilder(),
 		ovfDescriptorGenerator: NewOvfDescriptorGenerator(computeClient, storageClient, params.Project, params.Zone),
 		manifestFileGenerator:  NewManifestFileGenerator(storageClient),
+		ovaPackager:            NewOvaPackager(storageClient),
 		inspector:              inspector,
 		instanceDisksExporter:  NewInstanceDisksExporter(computeClient, storageClient, logger),
 		instanceExportPreparer: NewInstanceExportPreparer(logger),
@@ -172,6 +174,11 @@ func (oe *OVFExporter) run(ctx context.Context) error {
 	if err = oe.generateManifest(ctx); err != nil {
 		return err
 	}
+	if oe.params.Ova {
+		if err = oe.packageOva(ctx); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
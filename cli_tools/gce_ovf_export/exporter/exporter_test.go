@@ -119,6 +119,62 @@ func TestRun_HappyPath(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestRun_PackagesOva(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	params := ovfexportdomain.GetAllInstanceExportArgs()
+	params.Ova = true
+	instance := &compute.Instance{}
+	disks := []*ovfexportdomain.ExportedDisk{{
+		Disk:         &compute.Disk{Name: "bootdisk", SizeGb: 10},
+		AttachedDisk: &compute.AttachedDisk{Boot: true},
+		GcsPath:      "gs://ovfbucket/OVFpath/ovfinst-bootdisk.vmdk",
+	}}
+
+	mockLogger := mocks.NewMockLogger(mockCtrl)
+	mockLogger.EXPECT().User(gomock.Any()).AnyTimes()
+	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
+	mockStorageClient.EXPECT().Close().Return(nil)
+	mockComputeClient := mocks.NewMockClient(mockCtrl)
+	mockComputeClient.EXPECT().GetInstance(params.Project, params.Zone, params.InstanceName).Return(instance, nil)
+
+	mockInstanceExportPreparer := ovfexportmocks.NewMockInstanceExportPreparer(mockCtrl)
+	mockInstanceExportPreparer.EXPECT().Prepare(instance, params).Return(nil)
+	mockInstanceDisksExporter := ovfexportmocks.NewMockInstanceDisksExporter(mockCtrl)
+	mockInstanceDisksExporter.EXPECT().Export(instance, params).Return(disks, nil)
+	mockInspector := mock_disk.NewMockInspector(mockCtrl)
+	mockInspector.EXPECT().Inspect(gomock.Any()).Return(nil, nil)
+	mockOvfDescriptorGenerator := ovfexportmocks.NewMockOvfDescriptorGenerator(mockCtrl)
+	mockOvfDescriptorGenerator.EXPECT().GenerateAndWriteOVFDescriptor(instance, disks, "ovfbucket", "OVFpath/", "ovfinst.ovf", nil).Return(nil)
+	mockOvfManifestGenerator := ovfexportmocks.NewMockOvfManifestGenerator(mockCtrl)
+	mockOvfManifestGenerator.EXPECT().GenerateAndWriteToGCS(params.DestinationDirectory, "ovfinst.mf").Return(nil)
+	mockOvaPackager := ovfexportmocks.NewMockOvaPackager(mockCtrl)
+	mockOvaPackager.EXPECT().PackageToGCS("gs://ovfbucket/OVFpath/ovfinst.ova", []string{
+		"gs://ovfbucket/OVFpath/ovfinst.ovf",
+		"gs://ovfbucket/OVFpath/ovfinst.mf",
+		"gs://ovfbucket/OVFpath/ovfinst-bootdisk.vmdk",
+	}).Return(nil)
+	mockInstanceExportCleaner := ovfexportmocks.NewMockInstanceExportCleaner(mockCtrl)
+	mockInstanceExportCleaner.EXPECT().Clean(instance, params).Return(nil)
+
+	exporter := &OVFExporter{
+		storageClient:          mockStorageClient,
+		computeClient:          mockComputeClient,
+		Logger:                 mockLogger,
+		params:                 params,
+		loggableBuilder:        service.NewOvfExportLoggableBuilder(),
+		ovfDescriptorGenerator: mockOvfDescriptorGenerator,
+		manifestFileGenerator:  mockOvfManifestGenerator,
+		ovaPackager:            mockOvaPackager,
+		inspector:              mockInspector,
+		instanceDisksExporter:  mockInstanceDisksExporter,
+		instanceExportPreparer: mockInstanceExportPreparer,
+		instanceExportCleaner:  mockInstanceExportCleaner,
+	}
+	assert.Nil(t, exporter.Run(context.Background()))
+}
+
 func TestRun_DontRunDiskExporterIfPreparerTimedOut(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
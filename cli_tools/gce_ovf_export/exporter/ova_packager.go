@@ -0,0 +1,126 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovfexporter
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	storageutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
+	ovfexportdomain "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_export/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+type ovaPackagerImpl struct {
+	storageClient domain.StorageClientInterface
+	cancelChan    chan string
+}
+
+// NewOvaPackager creates a new OVA packager
+func NewOvaPackager(storageClient domain.StorageClientInterface) ovfexportdomain.OvaPackager {
+	return &ovaPackagerImpl{
+		storageClient: storageClient,
+		cancelChan:    make(chan string),
+	}
+}
+
+// PackageToGCS streams the files into a tar archive at ovaGcsPath, in the
+// order they are given, and then deletes them. The OVF spec requires the
+// descriptor to be the first file, followed by the manifest.
+func (p *ovaPackagerImpl) PackageToGCS(ovaGcsPath string, fileGcsPaths []string) error {
+	e := make(chan error)
+	go func() {
+		e <- p.packageToGCS(ovaGcsPath, fileGcsPaths)
+	}()
+
+	select {
+	case err := <-e:
+		return err
+	case cancelReason := <-p.cancelChan:
+		return fmt.Errorf("packaging OVA cancelled: %v", cancelReason)
+	}
+}
+
+func (p *ovaPackagerImpl) packageToGCS(ovaGcsPath string, fileGcsPaths []string) error {
+	bucketName, objectPath, err := storageutils.SplitGCSPath(ovaGcsPath)
+	if err != nil {
+		return err
+	}
+	ovaObject := p.storageClient.GetObject(bucketName, objectPath)
+	if err := p.writeTar(ovaObject.NewWriter(), fileGcsPaths); err != nil {
+		// The writer commits what was written when it's closed, so remove the
+		// incomplete archive.
+		ovaObject.Delete()
+		return daisy.Errf("error while writing OVA %v: %v", ovaGcsPath, err)
+	}
+	for _, fileGcsPath := range fileGcsPaths {
+		if err := p.storageClient.DeleteObject(fileGcsPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ovaPackagerImpl) writeTar(writer io.WriteCloser, fileGcsPaths []string) error {
+	tarWriter := tar.NewWriter(writer)
+	for _, fileGcsPath := range fileGcsPaths {
+		if err := p.appendFile(tarWriter, fileGcsPath); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func (p *ovaPackagerImpl) appendFile(tarWriter *tar.Writer, fileGcsPath string) error {
+	bucketName, objectPath, err := storageutils.SplitGCSPath(fileGcsPath)
+	if err != nil {
+		return err
+	}
+	attrs, err := p.storageClient.GetObjectAttrs(bucketName, objectPath)
+	if err != nil {
+		return err
+	}
+	if err := tarWriter.WriteHeader(&tar.Header{
+		Name:     path.Base(objectPath),
+		Mode:     0644,
+		Size:     attrs.Size,
+		ModTime:  attrs.Updated,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	fileReader, err := p.storageClient.GetObject(bucketName, objectPath).NewReader()
+	if err != nil {
+		return err
+	}
+	defer fileReader.Close()
+	if _, err := io.Copy(tarWriter, fileReader); err != nil {
+		return fmt.Errorf("error while copying %v: %v", fileGcsPath, err)
+	}
+	return nil
+}
+
+func (p *ovaPackagerImpl) Cancel(reason string) bool {
+	p.cancelChan <- reason
+	return true
+}
@@ -0,0 +1,97 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovfexporter
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/mocks"
+)
+
+func TestOvaPackager_PackageToGCS(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	files := map[string]string{
+		"folder/vm.ovf":   "<Envelope/>",
+		"folder/vm.mf":    "SHA1(vm.ovf)= abc",
+		"folder/vm-disk1": "disk content",
+	}
+	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
+	for objectPath, content := range files {
+		mockFileObject := mocks.NewMockStorageObject(mockCtrl)
+		mockFileObject.EXPECT().NewReader().Return(ioutil.NopCloser(strings.NewReader(content)), nil)
+		mockStorageClient.EXPECT().GetObject("bucket", objectPath).Return(mockFileObject)
+		mockStorageClient.EXPECT().GetObjectAttrs("bucket", objectPath).Return(
+			&storage.ObjectAttrs{Size: int64(len(content))}, nil)
+		mockStorageClient.EXPECT().DeleteObject("gs://bucket/" + objectPath).Return(nil)
+	}
+	ova := &bufferWriteCloser{}
+	mockOvaObject := mocks.NewMockStorageObject(mockCtrl)
+	mockOvaObject.EXPECT().NewWriter().Return(ova)
+	mockStorageClient.EXPECT().GetObject("bucket", "folder/vm.ova").Return(mockOvaObject)
+
+	err := NewOvaPackager(mockStorageClient).PackageToGCS("gs://bucket/folder/vm.ova", []string{
+		"gs://bucket/folder/vm.ovf", "gs://bucket/folder/vm.mf", "gs://bucket/folder/vm-disk1"})
+	assert.NoError(t, err)
+	assert.True(t, ova.closed)
+
+	tarReader := tar.NewReader(&ova.Buffer)
+	for _, expected := range []string{"vm.ovf", "vm.mf", "vm-disk1"} {
+		header, err := tarReader.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, header.Name)
+		content, err := ioutil.ReadAll(tarReader)
+		assert.NoError(t, err)
+		assert.Equal(t, files["folder/"+expected], string(content))
+	}
+	_, err = tarReader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestOvaPackager_PackageToGCS_DeletesOvaOnError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
+	mockStorageClient.EXPECT().GetObjectAttrs("bucket", "folder/vm.ovf").Return(nil, fmt.Errorf("not found"))
+	mockOvaObject := mocks.NewMockStorageObject(mockCtrl)
+	mockOvaObject.EXPECT().NewWriter().Return(&bufferWriteCloser{})
+	mockOvaObject.EXPECT().Delete().Return(nil)
+	mockStorageClient.EXPECT().GetObject("bucket", "folder/vm.ova").Return(mockOvaObject)
+
+	err := NewOvaPackager(mockStorageClient).PackageToGCS("gs://bucket/folder/vm.ova", []string{"gs://bucket/folder/vm.ovf"})
+	assert.EqualError(t, err, "error while writing OVA gs://bucket/folder/vm.ova: not found")
+}
+
+type bufferWriteCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *bufferWriteCloser) Close() error {
+	w.closed = true
+	return nil
+}
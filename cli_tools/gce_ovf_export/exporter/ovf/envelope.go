@@ -89,27 +89,27 @@ type AnnotationSection struct {
 type ProductSection struct {
 	Section
 
-	Class    *string `xml:"class,attr"`
-	Instance *string `xml:"instance,attr"`
-
-	Product     string     `xml:"Product"`
-	Vendor      string     `xml:"Vendor"`
-	Version     string     `xml:"Version"`
-	FullVersion string     `xml:"FullVersion"`
-	ProductURL  string     `xml:"ProductUrl"`
-	VendorURL   string     `xml:"VendorUrl"`
-	AppURL      string     `xml:"AppUrl"`
+	Class    *string `xml:"ovf:class,attr"`
+	Instance *string `xml:"ovf:instance,attr"`
+
+	Product     string     `xml:"Product,omitempty"`
+	Vendor      string     `xml:"Vendor,omitempty"`
+	Version     string     `xml:"Version,omitempty"`
+	FullVersion string     `xml:"FullVersion,omitempty"`
+	ProductURL  string     `xml:"ProductUrl,omitempty"`
+	VendorURL   string     `xml:"VendorUrl,omitempty"`
+	AppURL      string     `xml:"AppUrl,omitempty"`
 	Property    []Property `xml:"Property"`
 }
 
 // Property represents a property
 type Property struct {
-	Key              string  `xml:"key,attr"`
-	Type             string  `xml:"type,attr"`
-	Qualifiers       *string `xml:"qualifiers,attr"`
-	UserConfigurable *bool   `xml:"userConfigurable,attr"`
-	Default          *string `xml:"value,attr"`
-	Password         *bool   `xml:"password,attr"`
+	Key              string  `xml:"ovf:key,attr"`
+	Type             string  `xml:"ovf:type,attr"`
+	Qualifiers       *string `xml:"ovf:qualifiers,attr"`
+	UserConfigurable *bool   `xml:"ovf:userConfigurable,attr"`
+	Default          *string `xml:"ovf:value,attr"`
+	Password         *bool   `xml:"ovf:password,attr"`
 
 	Label       *string `xml:"Label"`
 	Description *string `xml:"Description"`
@@ -119,8 +119,8 @@ type Property struct {
 
 // PropertyConfigurationValue represents property configuration value
 type PropertyConfigurationValue struct {
-	Value         string  `xml:"value,attr"`
-	Configuration *string `xml:"configuration,attr"`
+	Value         string  `xml:"ovf:value,attr"`
+	Configuration *string `xml:"ovf:configuration,attr"`
 }
 
 // NetworkSection represents network section
@@ -132,7 +132,7 @@ type NetworkSection struct {
 
 // Network represents network
 type Network struct {
-	Name string `xml:"name,attr"`
+	Name string `xml:"ovf:name,attr"`
 
 	Description string `xml:"Description"`
 }
@@ -224,8 +224,8 @@ type DeploymentOptionSection struct {
 
 // DeploymentOptionConfiguration represents deployment options
 type DeploymentOptionConfiguration struct {
-	ID      string `xml:"id,attr"`
-	Default *bool  `xml:"default,attr"`
+	ID      string `xml:"ovf:id,attr"`
+	Default *bool  `xml:"ovf:default,attr"`
 
 	Label       string `xml:"Label"`
 	Description string `xml:"Description"`
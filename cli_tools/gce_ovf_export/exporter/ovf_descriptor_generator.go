@@ -38,6 +38,7 @@ const (
 	ideController          uint16 = 5
 	parallelSCSIController uint16 = 6
 	iSCSIController        uint16 = 8
+	ethernetAdapter        uint16 = 10
 	sataController         uint16 = 20
 	usbController          uint16 = 23
 )
@@ -128,7 +129,9 @@ func (g *ovfDescriptorGeneratorImpl) generate(instance *compute.Instance, export
 		}
 	}
 
+	g.populateNetworks(instance, descriptor)
 	g.populateOS(descriptor, diskInspectionResult)
+	g.populateProperties(instance, descriptor)
 
 	return descriptor, nil
 }
@@ -173,9 +176,102 @@ func (g *ovfDescriptorGeneratorImpl) populateMachineType(instance *compute.Insta
 	descriptor.VirtualSystem.VirtualHardware[0].Item = append(
 		descriptor.VirtualSystem.VirtualHardware[0].Item,
 		*g.createMemoryItem(machineType, strconv.Itoa(len(descriptor.VirtualSystem.VirtualHardware[0].Item)+1)))
+
+	// The machine type is the only deployment configuration, so that vSphere
+	// shows the size of the GCE instance when the OVF is deployed.
+	descriptor.DeploymentOption = &ovf.DeploymentOptionSection{
+		Section: ovf.Section{Info: "Deployment configuration"},
+		Configuration: []ovf.DeploymentOptionConfiguration{{
+			ID:          machineTypeID,
+			Default:     func() *bool { v := true; return &v }(),
+			Label:       machineTypeID,
+			Description: fmt.Sprintf("%v virtual CPU(s) and %vMB of memory", machineType.GuestCpus, machineType.MemoryMb),
+		}},
+	}
 	return nil
 }
 
+// populateNetworks adds an OVF network and an Ethernet adapter item for each
+// network interface of the instance.
+func (g *ovfDescriptorGeneratorImpl) populateNetworks(instance *compute.Instance, descriptor *ovf.Envelope) {
+	if len(instance.NetworkInterfaces) == 0 {
+		return
+	}
+	descriptor.Network = &ovf.NetworkSection{Section: ovf.Section{Info: "The list of logical networks"}}
+	networks := map[string]bool{}
+	for nicIndex, networkInterface := range instance.NetworkInterfaces {
+		networkName := getNetworkName(networkInterface)
+		if !networks[networkName] {
+			networks[networkName] = true
+			descriptor.Network.Networks = append(descriptor.Network.Networks, ovf.Network{
+				Name:        networkName,
+				Description: formatNetworkDescription(networkInterface),
+			})
+		}
+		descriptor.VirtualSystem.VirtualHardware[0].Item = append(
+			descriptor.VirtualSystem.VirtualHardware[0].Item,
+			*createEthernetItem(generateVirtualHardwareItemID(descriptor), nicIndex, networkName))
+	}
+}
+
+// populateProperties adds the instance metadata as properties of a
+// ProductSection, which vSphere shows as vApp options. SSH and Windows keys
+// are skipped, since they are credentials of the GCE instance.
+func (g *ovfDescriptorGeneratorImpl) populateProperties(instance *compute.Instance, descriptor *ovf.Envelope) {
+	if instance.Metadata == nil {
+		return
+	}
+	var properties []ovf.Property
+	for _, item := range instance.Metadata.Items {
+		if item == nil || credentialMetadataKeys[item.Key] {
+			continue
+		}
+		value := ""
+		if item.Value != nil {
+			value = *item.Value
+		}
+		properties = append(properties, ovf.Property{
+			Key:              item.Key,
+			Type:             "string",
+			UserConfigurable: func() *bool { v := true; return &v }(),
+			Default:          strPtr(value),
+		})
+	}
+	if len(properties) == 0 {
+		return
+	}
+	descriptor.VirtualSystem.Product = []ovf.ProductSection{{
+		Section:  ovf.Section{Info: "Metadata of the GCE instance"},
+		Property: properties,
+	}}
+}
+
+// Metadata keys whose values are credentials, which aren't exported.
+var credentialMetadataKeys = map[string]bool{
+	"ssh-keys":     true,
+	"sshKeys":      true,
+	"windows-keys": true,
+}
+
+// getNetworkName returns the name of the network of a network interface,
+// which is the last segment of the network's URL, such as `default`.
+func getNetworkName(networkInterface *compute.NetworkInterface) string {
+	if networkInterface.Network == "" {
+		return networkInterface.Name
+	}
+	networkURLSplits := strings.Split(networkInterface.Network, "/")
+	return networkURLSplits[len(networkURLSplits)-1]
+}
+
+func formatNetworkDescription(networkInterface *compute.NetworkInterface) string {
+	desc := fmt.Sprintf("The %v network", getNetworkName(networkInterface))
+	if networkInterface.Subnetwork != "" {
+		subnetURLSplits := strings.Split(networkInterface.Subnetwork, "/")
+		desc = fmt.Sprintf("%v, subnetwork %v", desc, subnetURLSplits[len(subnetURLSplits)-1])
+	}
+	return desc
+}
+
 func (g *ovfDescriptorGeneratorImpl) populateOS(descriptor *ovf.Envelope, ir *pb.InspectionResults) error {
 	descriptor.VirtualSystem.OperatingSystem = make([]ovf.OperatingSystemSection, 1)
 	descriptor.VirtualSystem.OperatingSystem[0].Info = "The kind of installed guest operating system"
@@ -232,6 +328,20 @@ func createDiskItem(instanceID string, parentID string, addressOnParent int, dis
 	}
 }
 
+func createEthernetItem(instanceID string, nicIndex int, networkName string) *ovf.ResourceAllocationSettingData {
+	return &ovf.ResourceAllocationSettingData{
+		CIMResourceAllocationSettingData: ovf.CIMResourceAllocationSettingData{
+			AutomaticAllocation: func() *bool { v := true; return &v }(),
+			Connection:          []string{networkName},
+			Description:         strPtr(fmt.Sprintf("VmxNet3 ethernet adapter on %v", networkName)),
+			ElementName:         fmt.Sprintf("nic%v", nicIndex),
+			InstanceID:          instanceID,
+			ResourceSubType:     strPtr("VmxNet3"),
+			ResourceType:        func() *uint16 { v := ethernetAdapter; return &v }(),
+		},
+	}
+}
+
 func (g *ovfDescriptorGeneratorImpl) createCPUItem(machineType *compute.MachineType, instanceID string) *ovf.ResourceAllocationSettingData {
 	return &ovf.ResourceAllocationSettingData{
 		CIMResourceAllocationSettingData: ovf.CIMResourceAllocationSettingData{
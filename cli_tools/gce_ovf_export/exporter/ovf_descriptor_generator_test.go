@@ -55,6 +55,22 @@ func TestOvfDescriptorGenerator_GenerateAndWriteOVFDescriptor(t *testing.T) {
 	instance := &compute.Instance{
 		Name:        instanceName,
 		MachineType: machineTypeURI,
+		NetworkInterfaces: []*compute.NetworkInterface{
+			{
+				Name:       "nic0",
+				Network:    "https://www.googleapis.com/compute/v1/projects/a-project/global/networks/default",
+				Subnetwork: "https://www.googleapis.com/compute/v1/projects/a-project/regions/us-west1/subnetworks/default",
+			},
+			{
+				Name:    "nic1",
+				Network: "projects/a-project/global/networks/backend",
+			},
+		},
+		Metadata: &compute.Metadata{Items: []*compute.MetadataItems{
+			{Key: "appliance-mode", Value: strPtr("standalone")},
+			{Key: "ssh-keys", Value: strPtr("user:ssh-rsa AAAA")},
+			{Key: "empty"},
+		}},
 	}
 	disk1 := &ovfexportdomain.ExportedDisk{
 		AttachedDisk: &compute.AttachedDisk{Boot: true},
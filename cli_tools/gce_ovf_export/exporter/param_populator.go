@@ -81,11 +81,13 @@ func (populator *ovfExportParamPopulatorImpl) populateDestinationURI(params *ovf
 	if err != nil {
 		panic("params.DestinationURI should be validated before calling populate")
 	}
-	if objectPath != "" && strings.HasSuffix(strings.ToLower(objectPath), ".ovf") {
+	lowerObjectPath := strings.ToLower(objectPath)
+	if objectPath != "" && (strings.HasSuffix(lowerObjectPath, ".ovf") || strings.HasSuffix(lowerObjectPath, ".ova")) {
 		if lastSlashIndex := strings.LastIndex(params.DestinationURI, "/"); lastSlashIndex > -1 {
 			params.DestinationDirectory = pathutils.ToDirectoryURL(params.DestinationURI[:lastSlashIndex])
-			// get the file name of the descriptor and use it for all the exported files
+			// get the file name of the descriptor or OVA and use it for all the exported files
 			params.OvfName = params.DestinationURI[lastSlashIndex+1 : len(params.DestinationURI)-4]
+			params.Ova = params.Ova || strings.HasSuffix(lowerObjectPath, ".ova")
 			return
 		}
 	}
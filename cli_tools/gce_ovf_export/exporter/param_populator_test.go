@@ -92,6 +92,19 @@ func TestPopulate_DestinationWhenURIOVFFile(t *testing.T) {
 	assert.Equal(t, "descriptor", params.OvfName)
 }
 
+func TestPopulate_DestinationWhenURIOVAFile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	params := ovfexportdomain.GetAllInstanceExportArgs()
+	params.DestinationURI = "gs://bucket/folder/appliance.OVA"
+	err := runPopulateParams(params, mockCtrl)
+	assert.Nil(t, err)
+	assert.Equal(t, "gs://bucket/folder/", params.DestinationDirectory)
+	assert.Equal(t, "appliance", params.OvfName)
+	assert.True(t, params.Ova)
+	assert.Equal(t, "gs://bucket/folder/appliance.ova", params.GetOvaPath())
+}
+
 func TestPopulate_DestinationWhenURIDirectory_Instance(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
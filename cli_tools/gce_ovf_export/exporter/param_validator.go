@@ -60,8 +60,8 @@ func (validator *ovfExportParamValidatorImpl) ValidateAndParseParams(params *ovf
 	if _, err := storage.GetBucketNameFromGCSPath(params.DestinationURI); err != nil {
 		return daisy.Errf("%v should be a path a Cloud Storage directory", ovfexportdomain.DestinationURIFlagKey)
 	}
-	if strings.HasSuffix(strings.ToLower(params.DestinationURI), ".ova") {
-		return daisy.Errf("Export to OVA is currently not supported")
+	if params.Ova && strings.HasSuffix(strings.ToLower(params.DestinationURI), ".ovf") {
+		return daisy.Errf("-%v can't be used when %v is an OVF descriptor", ovfexportdomain.OvaFlagKey, ovfexportdomain.DestinationURIFlagKey)
 	}
 
 	if params.ReleaseTrack != "" {
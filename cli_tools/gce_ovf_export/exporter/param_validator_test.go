@@ -122,6 +122,24 @@ func TestInstanceExportFlagsAllValidBucketOnlyPathNoTrailingSlash(t *testing.T)
 	assert.Nil(t, validator.ValidateAndParseParams(ovfexportdomain.GetAllInstanceExportArgs()))
 }
 
+func TestInstanceExportFlagsAllValidOvaDestination(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	params := ovfexportdomain.GetAllInstanceExportArgs()
+	params.DestinationURI = "gs://bucket/folder/vm.ova"
+	assert.Nil(t, createDefaultParamValidator(mockCtrl, true).ValidateAndParseParams(params))
+}
+
+func TestInstanceExportFlagsOvaWithOvfDestinationNotValid(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	params := ovfexportdomain.GetAllInstanceExportArgs()
+	params.DestinationURI = "gs://bucket/folder/vm.ovf"
+	params.Ova = true
+	assert.EqualError(t, createDefaultParamValidator(mockCtrl, false).ValidateAndParseParams(params),
+		"-ova can't be used when destination-uri is an OVF descriptor")
+}
+
 func TestMachineImageExportFlagsAllValid(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
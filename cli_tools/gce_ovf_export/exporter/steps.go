@@ -84,6 +84,20 @@ func (oe *OVFExporter) generateManifest(ctx context.Context) error {
 	}, oe.manifestFileGenerator.Cancel)
 }
 
+func (oe *OVFExporter) packageOva(ctx context.Context) error {
+	return oe.runStep(ctx, func() error {
+		oe.Logger.User(fmt.Sprintf("Packaging OVA %v.", oe.params.GetOvaPath()))
+		files := []string{
+			fmt.Sprintf("%v%v.ovf", oe.params.DestinationDirectory, oe.params.OvfName),
+			fmt.Sprintf("%v%v.mf", oe.params.DestinationDirectory, oe.params.OvfName),
+		}
+		for _, exportedDisk := range oe.exportedDisks {
+			files = append(files, exportedDisk.GcsPath)
+		}
+		return oe.ovaPackager.PackageToGCS(oe.params.GetOvaPath(), files)
+	}, oe.ovaPackager.Cancel)
+}
+
 func (oe *OVFExporter) cleanup(instance *compute.Instance, exportError error) error {
 	// cleanup shouldn't react to time out as it's necessary to perform this step.
 	// Otherwise, instance being exported would be left shut down and disks detached.
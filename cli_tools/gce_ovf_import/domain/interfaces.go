@@ -21,6 +21,7 @@ import (
 
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/image/importer"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 )
 
 // To rebuild mocks, run `go generate ./...`
@@ -29,11 +30,19 @@ import (
 // OvfDescriptorValidatorInterface represents OVF descriptor validator
 type OvfDescriptorValidatorInterface interface {
 	ValidateOvfPackage(ovfDescriptor *ovf.Envelope, ovfGcsPath string) (*ovf.Envelope, error)
+	ValidateOvaPackage(ovfDescriptor *ovf.Envelope, ovaIndex *storage.TarIndex, descriptorDir string) (*ovf.Envelope, error)
 }
 
 // OvfDescriptorLoaderInterface represents a loader for OVF descriptors
 type OvfDescriptorLoaderInterface interface {
 	Load(ovfGcsPath string) (*ovf.Envelope, error)
+	LoadFromTar(ovaIndex *storage.TarIndex, descriptor storage.TarEntry) (*ovf.Envelope, error)
+}
+
+// TarIndexerInterface builds the index of an OVA, so that its files can be
+// read without extracting it.
+type TarIndexerInterface interface {
+	IndexTar(tarGcsPath string) (*storage.TarIndex, error)
 }
 
 // MachineTypeProviderInterface is responsible for providing GCE machine type
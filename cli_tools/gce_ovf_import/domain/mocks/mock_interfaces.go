@@ -13,6 +13,7 @@ import (
 
 	importer "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/image/importer"
 	logging "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	storage "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 	domain "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain"
 )
 
@@ -54,6 +55,21 @@ func (mr *MockOvfDescriptorValidatorInterfaceMockRecorder) ValidateOvfPackage(ov
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateOvfPackage", reflect.TypeOf((*MockOvfDescriptorValidatorInterface)(nil).ValidateOvfPackage), ovfDescriptor, ovfGcsPath)
 }
 
+// ValidateOvaPackage mocks base method
+func (m *MockOvfDescriptorValidatorInterface) ValidateOvaPackage(ovfDescriptor *ovf.Envelope, ovaIndex *storage.TarIndex, descriptorDir string) (*ovf.Envelope, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateOvaPackage", ovfDescriptor, ovaIndex, descriptorDir)
+	ret0, _ := ret[0].(*ovf.Envelope)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ValidateOvaPackage indicates an expected call of ValidateOvaPackage
+func (mr *MockOvfDescriptorValidatorInterfaceMockRecorder) ValidateOvaPackage(ovfDescriptor, ovaIndex, descriptorDir interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateOvaPackage", reflect.TypeOf((*MockOvfDescriptorValidatorInterface)(nil).ValidateOvaPackage), ovfDescriptor, ovaIndex, descriptorDir)
+}
+
 // MockOvfDescriptorLoaderInterface is a mock of OvfDescriptorLoaderInterface interface
 type MockOvfDescriptorLoaderInterface struct {
 	ctrl     *gomock.Controller
@@ -92,6 +108,59 @@ func (mr *MockOvfDescriptorLoaderInterfaceMockRecorder) Load(ovfGcsPath interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Load", reflect.TypeOf((*MockOvfDescriptorLoaderInterface)(nil).Load), ovfGcsPath)
 }
 
+// LoadFromTar mocks base method
+func (m *MockOvfDescriptorLoaderInterface) LoadFromTar(ovaIndex *storage.TarIndex, descriptor storage.TarEntry) (*ovf.Envelope, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoadFromTar", ovaIndex, descriptor)
+	ret0, _ := ret[0].(*ovf.Envelope)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoadFromTar indicates an expected call of LoadFromTar
+func (mr *MockOvfDescriptorLoaderInterfaceMockRecorder) LoadFromTar(ovaIndex, descriptor interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadFromTar", reflect.TypeOf((*MockOvfDescriptorLoaderInterface)(nil).LoadFromTar), ovaIndex, descriptor)
+}
+
+// MockTarIndexerInterface is a mock of TarIndexerInterface interface
+type MockTarIndexerInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockTarIndexerInterfaceMockRecorder
+}
+
+// MockTarIndexerInterfaceMockRecorder is the mock recorder for MockTarIndexerInterface
+type MockTarIndexerInterfaceMockRecorder struct {
+	mock *MockTarIndexerInterface
+}
+
+// NewMockTarIndexerInterface creates a new mock instance
+func NewMockTarIndexerInterface(ctrl *gomock.Controller) *MockTarIndexerInterface {
+	mock := &MockTarIndexerInterface{ctrl: ctrl}
+	mock.recorder = &MockTarIndexerInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockTarIndexerInterface) EXPECT() *MockTarIndexerInterfaceMockRecorder {
+	return m.recorder
+}
+
+// IndexTar mocks base method
+func (m *MockTarIndexerInterface) IndexTar(tarGcsPath string) (*storage.TarIndex, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IndexTar", tarGcsPath)
+	ret0, _ := ret[0].(*storage.TarIndex)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IndexTar indicates an expected call of IndexTar
+func (mr *MockTarIndexerInterfaceMockRecorder) IndexTar(tarGcsPath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IndexTar", reflect.TypeOf((*MockTarIndexerInterface)(nil).IndexTar), tarGcsPath)
+}
+
 // MockMachineTypeProviderInterface is a mock of MachineTypeProviderInterface interface
 type MockMachineTypeProviderInterface struct {
 	ctrl     *gomock.Controller
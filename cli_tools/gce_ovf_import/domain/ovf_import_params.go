@@ -22,6 +22,7 @@ import (
 	"google.golang.org/api/compute/v1"
 
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/flags"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 )
 
 const (
@@ -57,6 +58,7 @@ type OVFImportParams struct {
 	Network                     string
 	NetworkTier                 string
 	Subnet                      string
+	NetworkMappingFile          string
 	PrivateNetworkIP            string
 	NoExternalIP                bool
 	NoRestartOnFailure          bool
@@ -101,10 +103,25 @@ type OVFImportParams struct {
 	CurrentExecutablePath string
 	Region                string
 
+	// NetworkMappings maps the names of the OVF's networks to GCE networks,
+	// and is read from NetworkMappingFile.
+	NetworkMappings map[string]NetworkMapping
+
+	// OvaIndex is the index of the OVA when OvfOvaGcsPath is an OVA. Its
+	// disks are imported from the OVA, rather than from extracted files.
+	OvaIndex *storage.TarIndex
+
 	// Path to daisy_workflows directory.
 	WorkflowDir string
 }
 
+// NetworkMapping is the GCE network and subnet that an OVF network is
+// imported to.
+type NetworkMapping struct {
+	Network string `yaml:"network"`
+	Subnet  string `yaml:"subnet"`
+}
+
 func (oip *OVFImportParams) String() string {
 	return fmt.Sprintf("%#v", oip)
 }
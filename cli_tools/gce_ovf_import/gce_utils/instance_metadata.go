@@ -0,0 +1,57 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovfgceutils
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	ovfutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/ovf_utils"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+const maxMetadataKeyLength = 128
+
+// invalidMetadataKeyChars matches the characters that can't be in a GCE
+// metadata key.
+var invalidMetadataKeyChars = regexp.MustCompile("[^a-zA-Z0-9_-]")
+
+// PropertiesToMetadata converts the ProductSection properties of an OVF to
+// instance metadata, so that appliances that read their configuration from
+// vApp options can read it from the metadata server. A key's characters that
+// metadata keys can't have, such as '.', are replaced with '_'. Password
+// properties are skipped, since metadata isn't secret.
+func PropertiesToMetadata(properties []ovfutils.ProductProperty, logger logging.Logger) (map[string]string, error) {
+	metadata := map[string]string{}
+	propertyKeys := map[string]string{}
+	for _, property := range properties {
+		if property.Password {
+			logger.User(fmt.Sprintf("Skipping OVF property %q, since password properties aren't copied to instance metadata.",
+				property.Key))
+			continue
+		}
+		key := invalidMetadataKeyChars.ReplaceAllString(property.Key, "_")
+		if len(key) > maxMetadataKeyLength {
+			return nil, daisy.Errf("OVF property %q is too long to be a metadata key", property.Key)
+		}
+		if previous, ok := propertyKeys[key]; ok {
+			return nil, daisy.Errf("OVF properties %q and %q have the same metadata key %q", previous, property.Key, key)
+		}
+		propertyKeys[key] = property.Key
+		metadata[key] = property.Value
+	}
+	return metadata, nil
+}
@@ -0,0 +1,55 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovfgceutils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	ovfutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/ovf_utils"
+)
+
+func TestPropertiesToMetadata(t *testing.T) {
+	metadata, err := PropertiesToMetadata([]ovfutils.ProductProperty{
+		{Key: "vami.ip0.appliance", Value: "10.0.0.10"},
+		{Key: "guestinfo.hostname", Value: "appliance-1"},
+		{Key: "guestinfo.root_password", Value: "secret", Password: true},
+		{Key: "dns-servers", Value: ""},
+	}, logging.NewToolLogger("[test]"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"vami_ip0_appliance": "10.0.0.10",
+		"guestinfo_hostname": "appliance-1",
+		"dns-servers":        "",
+	}, metadata)
+}
+
+func TestPropertiesToMetadataKeyCollision(t *testing.T) {
+	_, err := PropertiesToMetadata([]ovfutils.ProductProperty{
+		{Key: "guestinfo.hostname", Value: "a"},
+		{Key: "guestinfo_hostname", Value: "b"},
+	}, logging.NewToolLogger("[test]"))
+	assert.EqualError(t, err, `OVF properties "guestinfo.hostname" and "guestinfo_hostname" have the same metadata key "guestinfo_hostname"`)
+}
+
+func TestPropertiesToMetadataKeyTooLong(t *testing.T) {
+	_, err := PropertiesToMetadata([]ovfutils.ProductProperty{
+		{Key: strings.Repeat("k", 129), Value: "a"},
+	}, logging.NewToolLogger("[test]"))
+	assert.Error(t, err)
+}
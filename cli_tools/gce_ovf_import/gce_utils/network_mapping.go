@@ -0,0 +1,117 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovfgceutils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	ovfdomain "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+// ReadNetworkMappingFile reads a YAML file that maps the name of each OVF
+// network to a GCE network and subnet. For example:
+//
+//   VM Network:
+//     network: prod-vpc
+//     subnet: prod-subnet
+//   Storage:
+//     network: storage-vpc
+func ReadNetworkMappingFile(filename string) (map[string]ovfdomain.NetworkMapping, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var mappings map[string]ovfdomain.NetworkMapping
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&mappings); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read network mapping file %q: %w", filename, err)
+	}
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("network mapping file %q doesn't map any networks", filename)
+	}
+	for name, mapping := range mappings {
+		if strings.TrimSpace(mapping.Network) == "" && strings.TrimSpace(mapping.Subnet) == "" {
+			return nil, fmt.Errorf("network mapping file %q: OVF network %q needs a network or a subnet", filename, name)
+		}
+	}
+	return mappings, nil
+}
+
+// MapNetworkAdapters returns the GCE network of each OVF network adapter,
+// given the names of the networks that the adapters are connected to. The
+// first adapter is the instance's primary network interface. Adapters that
+// aren't connected to a network are skipped.
+func MapNetworkAdapters(connections []string, mappings map[string]ovfdomain.NetworkMapping,
+	logger logging.Logger) ([]ovfdomain.NetworkMapping, error) {
+	var interfaces []ovfdomain.NetworkMapping
+	var unmapped []string
+	used := map[string]bool{}
+	networkToAdapter := map[string]string{}
+	for i, connection := range connections {
+		if connection == "" {
+			logger.User(fmt.Sprintf("Skipping network adapter %d, since it isn't connected to a network.", i+1))
+			continue
+		}
+		mapping, ok := mappings[connection]
+		if !ok {
+			if !used[connection] {
+				unmapped = append(unmapped, connection)
+			}
+			used[connection] = true
+			continue
+		}
+		used[connection] = true
+		// When only the subnet is mapped, the network is the subnet's.
+		network := mapping.Network
+		if network == "" {
+			network = mapping.Subnet
+		}
+		if previous, ok := networkToAdapter[network]; ok {
+			return nil, daisy.Errf("network adapters connected to OVF networks %q and %q are both mapped to %q. "+
+				"Each network interface of an instance must be in a different network", previous, connection, network)
+		}
+		networkToAdapter[network] = connection
+		interfaces = append(interfaces, mapping)
+	}
+	if len(unmapped) > 0 {
+		return nil, daisy.Errf("the network mapping file doesn't map OVF networks: %s", strings.Join(unmapped, ", "))
+	}
+	if len(interfaces) == 0 {
+		return nil, daisy.Errf("the network mapping file can't be used, since the OVF doesn't have network adapters that are connected to a network")
+	}
+
+	var unused []string
+	for name := range mappings {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		logger.User(fmt.Sprintf("The network mapping file maps networks that no network adapter is connected to: %s",
+			strings.Join(unused, ", ")))
+	}
+	return interfaces, nil
+}
@@ -0,0 +1,120 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovfgceutils
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	ovfdomain "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain"
+)
+
+var testMappings = map[string]ovfdomain.NetworkMapping{
+	"VM Network": {Network: "global/networks/prod", Subnet: "regions/us-west2/subnetworks/prod-sub"},
+	"Storage":    {Network: "global/networks/storage"},
+	"Backup":     {Subnet: "regions/us-west2/subnetworks/backup-sub"},
+}
+
+func TestReadNetworkMappingFile(t *testing.T) {
+	filename := writeMappingFile(t, "VM Network:\n  network: prod\n  subnet: prod-sub\nStorage:\n  network: storage\n")
+	defer os.Remove(filename)
+
+	mappings, err := ReadNetworkMappingFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]ovfdomain.NetworkMapping{
+		"VM Network": {Network: "prod", Subnet: "prod-sub"},
+		"Storage":    {Network: "storage"},
+	}, mappings)
+}
+
+func TestReadNetworkMappingFileErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{name: "empty", content: "", expectedError: "doesn't map any networks"},
+		{name: "unknown field", content: "Storage:\n  vpc: storage\n", expectedError: "field vpc not found"},
+		{name: "no network or subnet", content: "Storage:\n  network: ' '\n", expectedError: `OVF network "Storage" needs a network or a subnet`},
+		{name: "not a map", content: "- Storage\n", expectedError: "cannot unmarshal"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeMappingFile(t, tt.content)
+			defer os.Remove(filename)
+			_, err := ReadNetworkMappingFile(filename)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
+
+func TestMapNetworkAdapters(t *testing.T) {
+	interfaces, err := MapNetworkAdapters([]string{"Storage", "", "VM Network"}, testMappings, logging.NewToolLogger("[test]"))
+	assert.NoError(t, err)
+	assert.Equal(t, []ovfdomain.NetworkMapping{testMappings["Storage"], testMappings["VM Network"]}, interfaces)
+}
+
+func TestMapNetworkAdaptersErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		connections   []string
+		expectedError string
+	}{
+		{
+			name:          "unmapped networks",
+			connections:   []string{"VM Network", "Unknown", "Other", "Unknown"},
+			expectedError: "the network mapping file doesn't map OVF networks: Unknown, Other",
+		},
+		{
+			name:          "no adapters",
+			connections:   nil,
+			expectedError: "doesn't have network adapters that are connected to a network",
+		},
+		{
+			name:          "no connected adapters",
+			connections:   []string{""},
+			expectedError: "doesn't have network adapters that are connected to a network",
+		},
+		{
+			name:          "same network",
+			connections:   []string{"Storage", "Storage"},
+			expectedError: `network adapters connected to OVF networks "Storage" and "Storage" are both mapped to "global/networks/storage"`,
+		},
+		{
+			name:          "same subnet",
+			connections:   []string{"Backup", "Backup"},
+			expectedError: `are both mapped to "regions/us-west2/subnetworks/backup-sub"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MapNetworkAdapters(tt.connections, testMappings, logging.NewToolLogger("[test]"))
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
+
+func writeMappingFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "networks-*.yaml")
+	assert.NoError(t, err)
+	_, err = file.WriteString(content)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	return file.Name()
+}
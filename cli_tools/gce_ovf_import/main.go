@@ -45,6 +45,7 @@ var (
 	network                     = flag.String("network", "", "Name of the network in your project to use for the image import. The network must have access to Google Cloud Storage. If not specified, the network named default is used. If -subnet is also specified subnet must be a subnetwork of network specified by -network.")
 	networkTier                 = flag.String("network-tier", "", "Specifies the network tier that will be used to configure the instance. NETWORK_TIER must be one of: PREMIUM, STANDARD. The default value is PREMIUM.")
 	subnet                      = flag.String("subnet", "", "Name of the subnetwork in your project to use for the image import. If	the network resource is in legacy mode, do not provide this property. If the network is in auto subnet mode, providing the subnetwork is optional. If the network is in custom subnet mode, then this field should be specified. Zone should be specified if this field is specified.")
+	networkMappingFile          = flag.String(ovfimporter.NetworkMappingFlagKey, "", "Path to a YAML file that maps the names of the OVF's networks to the network and subnet of each of the instance's network interfaces. Can't be used with -network or -subnet.")
 	privateNetworkIP            = flag.String("private-network-ip", "", "Specifies the RFC1918 IP to assign to the instance. The IP should be in the subnet or legacy network IP range.")
 	noExternalIP                = flag.Bool("no-external-ip", false, "Specifies that VPC into which instances is being imported doesn't allow external IPs.")
 	noRestartOnFailure          = flag.Bool("no-restart-on-failure", false, "the instance will not be restarted if it’s terminated by Compute Engine. This does not affect terminations performed by the user.")
@@ -97,7 +98,7 @@ func buildOVFImportParams() *domain.OVFImportParams {
 		OvfOvaGcsPath: *ovfOvaGcsPath, NoGuestEnvironment: *noGuestEnvironment,
 		CanIPForward: *canIPForward, DeletionProtection: *deletionProtection, Description: *description,
 		Labels: *labels, MachineType: *machineType, Network: *network, NetworkTier: *networkTier,
-		Subnet: *subnet, PrivateNetworkIP: *privateNetworkIP, NoExternalIP: *noExternalIP,
+		Subnet: *subnet, NetworkMappingFile: *networkMappingFile, PrivateNetworkIP: *privateNetworkIP, NoExternalIP: *noExternalIP,
 		NoRestartOnFailure: *noRestartOnFailure, OsID: *osID, BYOL: *byol,
 		ShieldedIntegrityMonitoring: *shieldedIntegrityMonitoring, ShieldedSecureBoot: *shieldedSecureBoot,
 		ShieldedVtpm: *shieldedVtpm, Tags: *tags, Zone: *zoneFlag, BootDiskKmskey: *bootDiskKmskey,
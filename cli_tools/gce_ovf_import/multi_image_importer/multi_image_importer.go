@@ -29,7 +29,7 @@ import (
 func NewMultiImageImporter(workflowDir string, computeClient daisycompute.Client,
 	storageClient domain.StorageClientInterface, logger logging.ToolLogger) ovfdomain.MultiImageImporterInterface {
 	return &multiImageImporter{
-		builder: &requestBuilder{workflowDir, importer.NewSourceFactory(storageClient)},
+		builder: &requestBuilder{workflowDir, importer.NewSourceFactory(storageClient), storageClient},
 		executor: &requestExecutor{
 			&importAdapter{computeClient, storageClient},
 			computeClient,
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/image/importer"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/path"
 	ovfdomain "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain"
@@ -26,6 +27,7 @@ import (
 type requestBuilder struct {
 	workflowDir   string
 	sourceFactory importer.SourceFactory
+	storageClient domain.StorageClientInterface
 }
 
 // buildRequests constructs a list of ImageImportRequests based on the user's
@@ -33,7 +35,7 @@ type requestBuilder struct {
 func (r *requestBuilder) buildRequests(params *ovfdomain.OVFImportParams, fileURIs []string) (requests []importer.ImageImportRequest, err error) {
 	for i, fileURI := range fileURIs {
 		var source importer.Source
-		if source, err = r.sourceFactory.Init(fileURI, ""); err != nil {
+		if source, err = r.initSource(params, fileURI); err != nil {
 			return nil, err
 		}
 		imageName := fmt.Sprintf("ovf-%s-%d", params.BuildID, i+1)
@@ -71,3 +73,14 @@ func (r *requestBuilder) buildRequests(params *ovfdomain.OVFImportParams, fileUR
 	}
 	return requests, nil
 }
+
+// initSource creates the source of a disk file. Files of an OVA are read
+// from the OVA, rather than from GCS objects.
+func (r *requestBuilder) initSource(params *ovfdomain.OVFImportParams, fileURI string) (importer.Source, error) {
+	if params.OvaIndex != nil {
+		if entry, ok := params.OvaIndex.FindByPath(fileURI); ok {
+			return importer.NewTarMemberSource(params.OvaIndex, entry, r.storageClient)
+		}
+	}
+	return r.sourceFactory.Init(fileURI, "")
+}
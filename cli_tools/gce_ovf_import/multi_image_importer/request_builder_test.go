@@ -16,7 +16,9 @@ package multiimageimporter
 
 import (
 	"errors"
+	"io/ioutil"
 	"math"
+	"strings"
 	"testing"
 	"time"
 
@@ -25,7 +27,9 @@ import (
 
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/image/importer"
 	imagemocks "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/image/importer/mocks"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 	ovfdomain "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/mocks"
 )
 
 func TestBuildRequests_InitsFields(t *testing.T) {
@@ -143,6 +147,32 @@ func TestBuildRequests_ReturnError_WhenSourceInitializationFails(t *testing.T) {
 	}).buildRequests(params, fileURIs)
 	assert.Equal(t, actualError, initError)
 }
+
+func TestBuildRequests_ReadsOvaFilesFromOva(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	params := makeDefaultParams()
+	params.OvaIndex = &storage.TarIndex{GcsPath: "gs://bucket/vm.ova", Entries: []storage.TarEntry{
+		{Name: "disk1.vmdk", Offset: 512, Size: 4},
+	}}
+	mockStorageObject := mocks.NewMockStorageObject(ctrl)
+	mockStorageObject.EXPECT().NewRangeReader(int64(512), int64(4)).Return(
+		ioutil.NopCloser(strings.NewReader("disk")), nil)
+	mockStorageClient := mocks.NewMockStorageClientInterface(ctrl)
+	mockStorageClient.EXPECT().GetObject("bucket", "vm.ova").Return(mockStorageObject)
+
+	requests, err := (&requestBuilder{
+		workflowDir:   "/path/to/daisy_workflows",
+		sourceFactory: initSourceFactory(ctrl, []string{"gs://bucket/disk2.vmdk"}),
+		storageClient: mockStorageClient,
+	}).buildRequests(params, []string{"gs://bucket/vm.ova/disk1.vmdk", "gs://bucket/disk2.vmdk"})
+	assert.NoError(t, err)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "gs://bucket/vm.ova/disk1.vmdk", requests[0].Source.Path())
+	assert.Equal(t, &fakeSource{"gs://bucket/disk2.vmdk"}, requests[1].Source)
+}
+
 func initSourceFactory(ctrl *gomock.Controller, fileURIs []string) importer.SourceFactory {
 	mockSourceFactory := imagemocks.NewMockSourceFactory(ctrl)
 	for _, fileURI := range fileURIs {
@@ -75,10 +75,9 @@ type OVFImporter struct {
 	storageClient       domain.StorageClientInterface
 	computeClient       daisycompute.Client
 	multiImageImporter  ovfdomain.MultiImageImporterInterface
-	tarGcsExtractor     domain.TarGcsExtractorInterface
+	tarIndexer          ovfdomain.TarIndexerInterface
 	ovfDescriptorLoader ovfdomain.OvfDescriptorLoaderInterface
 	Logger              logging.Logger
-	gcsPathToClean      string
 	workflowPath        string
 	params              *ovfdomain.OVFImportParams
 	imageLocation       string
@@ -86,6 +85,12 @@ type OVFImporter struct {
 
 	// Populated when disk file import finishes.
 	imageURIs []string
+
+	// Populated from the OVF descriptor. networkInterfaces are only set
+	// when a network mapping file is used; the first is the primary
+	// network interface.
+	networkInterfaces []ovfdomain.NetworkMapping
+	metadata          map[string]string
 }
 
 // NewOVFImporter creates an OVF importer, including automatically populating dependencies,
@@ -103,14 +108,13 @@ func NewOVFImporter(params *ovfdomain.OVFImportParams) (*OVFImporter, error) {
 	if err != nil {
 		return nil, err
 	}
-	tarGcsExtractor := storageutils.NewTarGcsExtractor(ctx, storageClient, logger)
 	workingDirOVFImportWorkflow := toWorkingDir(getImportWorkflowPath(params), params)
 	ovfImporter := &OVFImporter{
 		ctx:                 ctx,
 		storageClient:       storageClient,
 		computeClient:       computeClient,
 		multiImageImporter:  multiimageimporter.NewMultiImageImporter(params.WorkflowDir, computeClient, storageClient, logger),
-		tarGcsExtractor:     tarGcsExtractor,
+		tarIndexer:          storageutils.NewTarIndexer(storageClient),
 		workflowPath:        workingDirOVFImportWorkflow,
 		ovfDescriptorLoader: ovfutils.NewOvfDescriptorLoader(storageClient),
 		Logger:              logger,
@@ -144,15 +148,19 @@ func (oi *OVFImporter) buildDaisyVars(bootDiskImageURI string, machineType strin
 		varMap["machine_image_name"] = oi.params.MachineImageName
 	}
 	varMap["instance_service_account"] = oi.params.InstanceServiceAccount
-	if oi.params.Subnet != "" {
-		varMap["subnet"] = oi.params.Subnet
+	network, subnet := oi.params.Network, oi.params.Subnet
+	if len(oi.networkInterfaces) > 0 {
+		network, subnet = oi.networkInterfaces[0].Network, oi.networkInterfaces[0].Subnet
+	}
+	if subnet != "" {
+		varMap["subnet"] = subnet
 		// When subnet is set, we need to grant a value to network to avoid fallback to default
-		if oi.params.Network == "" {
+		if network == "" {
 			varMap["network"] = ""
 		}
 	}
-	if oi.params.Network != "" {
-		varMap["network"] = oi.params.Network
+	if network != "" {
+		varMap["network"] = network
 	}
 	if machineType != "" {
 		varMap["machine_type"] = machineType
@@ -215,6 +223,59 @@ func (oi *OVFImporter) updateImportedInstance(w *daisy.Workflow) {
 			serviceAccount.Scopes = oi.params.InstanceAccessScopes
 		}
 	}
+	// The primary network interface is declared by the workflow. The others
+	// don't have an external IP, so their AccessConfigs are empty rather
+	// than nil, which Daisy populates with an external NAT.
+	for i := 1; i < len(oi.networkInterfaces); i++ {
+		mapping := oi.networkInterfaces[i]
+		instance.NetworkInterfaces = append(instance.NetworkInterfaces, &compute.NetworkInterface{
+			Network: mapping.Network, Subnetwork: mapping.Subnet, AccessConfigs: []*compute.AccessConfig{},
+		})
+		instanceBeta.NetworkInterfaces = append(instanceBeta.NetworkInterfaces, &computeBeta.NetworkInterface{
+			Network: mapping.Network, Subnetwork: mapping.Subnet, AccessConfigs: []*computeBeta.AccessConfig{},
+		})
+	}
+	for key, value := range oi.metadata {
+		if _, ok := instance.Metadata[key]; ok {
+			oi.Logger.User(fmt.Sprintf("Skipping OVF property metadata %q, since the instance already has it.", key))
+			continue
+		}
+		if instance.Metadata == nil {
+			instance.Metadata = map[string]string{}
+		}
+		instance.Metadata[key] = value
+		if instanceBeta.Metadata == nil {
+			instanceBeta.Metadata = map[string]string{}
+		}
+		instanceBeta.Metadata[key] = value
+	}
+}
+
+// mapNetworksAndProperties maps the network adapters of the OVF to network
+// interfaces, when a network mapping file is used, and its ProductSection
+// properties to instance metadata.
+func (oi *OVFImporter) mapNetworksAndProperties(ovfDescriptor *ovf.Envelope) error {
+	if len(oi.params.NetworkMappings) > 0 {
+		virtualHardware, err := ovfutils.GetVirtualHardwareSectionFromDescriptor(ovfDescriptor)
+		if err != nil {
+			return err
+		}
+		connections, err := ovfutils.GetNetworkAdapterConnections(virtualHardware)
+		if err != nil {
+			return err
+		}
+		if oi.networkInterfaces, err = ovfgceutils.MapNetworkAdapters(
+			connections, oi.params.NetworkMappings, oi.Logger); err != nil {
+			return err
+		}
+		oi.Logger.User(fmt.Sprintf("Will create instance with %v network interface(s).", len(oi.networkInterfaces)))
+	}
+	metadata, err := ovfgceutils.PropertiesToMetadata(ovfutils.GetProductProperties(ovfDescriptor), oi.Logger)
+	if err != nil {
+		return err
+	}
+	oi.metadata = metadata
+	return nil
 }
 
 func (oi *OVFImporter) updateMachineImage(w *daisy.Workflow) {
@@ -249,32 +310,33 @@ func createComputeClient(ctx *context.Context, params *ovfdomain.OVFImportParams
 	return computeClient, nil
 }
 
-// Returns OVF GCS bucket and object path (director). If ovaOvaGcsPath is pointing to an OVA file,
-// it extracts it to a temporary GCS folder and returns it's path.
-func (oi *OVFImporter) getOvfGcsPath(tmpGcsPath string) (string, bool, error) {
-	ovfOvaGcsPathLowered := strings.ToLower(oi.params.OvfOvaGcsPath)
-
+// Returns OVF GCS bucket and object path (director) when OvfOvaGcsPath isn't an OVA.
+func (oi *OVFImporter) getOvfGcsPath() string {
 	var ovfGcsPath string
-	var shouldCleanUp bool
-	var err error
-
-	if strings.HasSuffix(ovfOvaGcsPathLowered, ".ova") {
-		ovfGcsPath = pathutils.JoinURL(tmpGcsPath, "ovf")
-		oi.Logger.User(
-			fmt.Sprintf("Extracting %v OVA archive to %v", oi.params.OvfOvaGcsPath, ovfGcsPath))
-		err = oi.tarGcsExtractor.ExtractTarToGcs(oi.params.OvfOvaGcsPath, ovfGcsPath)
-		shouldCleanUp = true
-
-	} else if strings.HasSuffix(ovfOvaGcsPathLowered, ".ovf") {
-		// OvfOvaGcsPath is pointing to OVF descriptor, no need to unpack, just extract directory path.
+	if strings.HasSuffix(strings.ToLower(oi.params.OvfOvaGcsPath), ".ovf") {
+		// OvfOvaGcsPath is pointing to OVF descriptor, just extract directory path.
 		ovfGcsPath = (oi.params.OvfOvaGcsPath)[0 : strings.LastIndex(oi.params.OvfOvaGcsPath, "/")+1]
-
 	} else {
 		ovfGcsPath = oi.params.OvfOvaGcsPath
 	}
 
 	// assume OvfOvaGcsPath is a GCS folder for the whole OVF package
-	return pathutils.ToDirectoryURL(ovfGcsPath), shouldCleanUp, err
+	return pathutils.ToDirectoryURL(ovfGcsPath)
+}
+
+// loadDescriptorAndDiskPaths loads the OVF descriptor, and finds the disk files it references.
+// An OVA is indexed rather than extracted, and its disk files are read from the OVA.
+func (oi *OVFImporter) loadDescriptorAndDiskPaths() (*ovf.Envelope, []ovfutils.DiskInfo, error) {
+	if !strings.HasSuffix(strings.ToLower(oi.params.OvfOvaGcsPath), ".ova") {
+		return ovfutils.GetOVFDescriptorAndDiskPaths(oi.ovfDescriptorLoader, oi.getOvfGcsPath())
+	}
+	oi.Logger.User(fmt.Sprintf("Reading %v OVA archive", oi.params.OvfOvaGcsPath))
+	ovaIndex, err := oi.tarIndexer.IndexTar(oi.params.OvfOvaGcsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	oi.params.OvaIndex = ovaIndex
+	return ovfutils.GetOVADescriptorAndDiskPaths(oi.ovfDescriptorLoader, ovaIndex)
 }
 
 func (oi *OVFImporter) modifyWorkflowPreValidate(w *daisy.Workflow) {
@@ -346,16 +408,7 @@ func (oi *OVFImporter) setUpImportWorkflow() (workflow *daisy.Workflow, err erro
 
 	oi.imageLocation = oi.params.Region
 
-	ovfGcsPath, shouldCleanup, err := oi.getOvfGcsPath(oi.params.ScratchBucketGcsPath)
-	if shouldCleanup {
-		oi.gcsPathToClean = ovfGcsPath
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	ovfDescriptor, diskInfos, err := ovfutils.GetOVFDescriptorAndDiskPaths(
-		oi.ovfDescriptorLoader, ovfGcsPath)
+	ovfDescriptor, diskInfos, err := oi.loadDescriptorAndDiskPaths()
 	if err != nil {
 		return nil, err
 	}
@@ -372,6 +425,10 @@ func (oi *OVFImporter) setUpImportWorkflow() (workflow *daisy.Workflow, err erro
 
 	oi.Logger.User(fmt.Sprintf("Will create instance of `%v` machine type.", machineTypeStr))
 
+	if err := oi.mapNetworksAndProperties(ovfDescriptor); err != nil {
+		return nil, err
+	}
+
 	if err := oi.importDisks(osIDValue, &diskInfos); err != nil {
 		return nil, err
 	}
@@ -424,14 +481,6 @@ func (oi *OVFImporter) handleTimeout(w *daisy.Workflow) {
 func (oi *OVFImporter) CleanUp() {
 	oi.Logger.User("Cleaning up.")
 	if oi.storageClient != nil {
-		if oi.gcsPathToClean != "" {
-			err := oi.storageClient.DeleteGcsPath(oi.gcsPathToClean)
-			if err != nil {
-				oi.Logger.User(
-					fmt.Sprintf("couldn't delete GCS path %v: %v", oi.gcsPathToClean, err.Error()))
-			}
-		}
-
 		err := oi.storageClient.Close()
 		if err != nil {
 			oi.Logger.User(fmt.Sprintf("couldn't close storage client: %v", err.Error()))
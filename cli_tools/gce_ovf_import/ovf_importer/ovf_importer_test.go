@@ -22,17 +22,21 @@ import (
 	"testing"
 	"time"
 
+	gcs "cloud.google.com/go/storage"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/vmware/govmomi/ovf"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
 
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/path"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain"
 	ovfdomainmocks "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain/mocks"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/mocks"
 	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+	daisycompute "github.com/GoogleCloudPlatform/compute-image-tools/daisy/compute"
 )
 
 // importTarget hold data specific to either instances or machine images.
@@ -70,7 +74,7 @@ func TestSetupWorkflow_WithUserSpecifiedMachineType(t *testing.T) {
 			params.MachineType = "e2-small2"
 			testCase := mockConfiguration{
 				descriptorFilenames: []string{"Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
-				fileURIs:            []string{"gs://bucket/folder/ovf/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
+				fileURIs:            []string{"gs://ovfbucket/ovfpath/vmware.ova/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
 				imageURIs:           []string{"images/uri/boot-disk"},
 				expectedOS:          params.OsID,
 				expectImportToRun:   true,
@@ -90,7 +94,7 @@ func TestSetupWorkflow_WithMachineTypeInference(t *testing.T) {
 			params.MachineType = ""
 			testCase := mockConfiguration{
 				descriptorFilenames: []string{"Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
-				fileURIs:            []string{"gs://bucket/folder/ovf/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
+				fileURIs:            []string{"gs://ovfbucket/ovfpath/vmware.ova/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
 				imageURIs:           []string{"images/uri/boot-disk"},
 				expectedOS:          params.OsID,
 				expectImportToRun:   true,
@@ -103,7 +107,99 @@ func TestSetupWorkflow_WithMachineTypeInference(t *testing.T) {
 	}
 }
 
-func TestSetUpWorkflow_ErrorUnpackingOVA(t *testing.T) {
+func TestSetupWorkflow_WithNetworkMappingsAndProductProperties(t *testing.T) {
+	for _, mode := range []*importTarget{gmiMode, instanceMode} {
+		t.Run(mode.name, func(t *testing.T) {
+			params := mode.paramGenerator()
+			if params.MachineImageName != "" {
+				params.MachineImageName = "machine-image-1"
+			}
+			params.NoExternalIP = false
+			params.NetworkMappings = map[string]domain.NetworkMapping{
+				"VM Network": {Network: "global/networks/prod", Subnet: "regions/us-west2/subnetworks/prod-sub"},
+				"Storage":    {Network: "global/networks/storage"},
+			}
+			testCase := mockConfiguration{
+				descriptorFilenames: []string{"Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
+				fileURIs:            []string{"gs://ovfbucket/ovfpath/vmware.ova/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
+				imageURIs:           []string{"projects/project-name/global/images/boot-disk"},
+				expectedOS:          params.OsID,
+				expectImportToRun:   true,
+			}
+			descriptor := createOVFDescriptor(testCase.descriptorFilenames)
+			virtualHardware := &descriptor.VirtualSystem.VirtualHardware[0]
+			virtualHardware.Item = append(virtualHardware.Item,
+				createNetworkAdapterItem("14", "Storage"), createNetworkAdapterItem("13", "VM Network"))
+			hostname, password := "appliance-1", "secret"
+			isPassword := true
+			descriptor.VirtualSystem.Product = []ovf.ProductSection{{Property: []ovf.Property{
+				{Key: "guestinfo.hostname", Default: &hostname},
+				{Key: "guestinfo.password", Default: &password, Password: &isPassword},
+			}}}
+
+			w, err := setupMocksAndRun(t, params, mode.wfPath, descriptor, testCase)
+			assert.NoError(t, err)
+			instance := w.Steps["create-instance"].CreateInstances.Instances[0]
+			instanceBeta := w.Steps["create-instance"].CreateInstances.InstancesBeta[0]
+			assert.Equal(t, "global/networks/prod", w.Vars["network"].Value)
+			assert.Equal(t, "regions/us-west2/subnetworks/prod-sub", w.Vars["subnet"].Value)
+			assert.Len(t, instance.NetworkInterfaces, 2)
+			assert.Equal(t, "global/networks/storage", instance.NetworkInterfaces[1].Network)
+			assert.Empty(t, instance.NetworkInterfaces[1].Subnetwork)
+			assert.Empty(t, instance.NetworkInterfaces[1].AccessConfigs)
+			assert.Len(t, instanceBeta.NetworkInterfaces, 2)
+			assert.Equal(t, "global/networks/storage", instanceBeta.NetworkInterfaces[1].Network)
+			assert.Equal(t, "appliance-1", instance.Metadata["guestinfo_hostname"])
+			assert.NotContains(t, instance.Metadata, "guestinfo_password")
+			assert.Equal(t, "appliance-1", instanceBeta.Metadata["guestinfo_hostname"])
+
+			// Daisy gives an external IP to network interfaces whose
+			// AccessConfigs are nil when it populates the workflow.
+			validateWithFakeCompute(t, w)
+			assert.NotEmpty(t, instance.NetworkInterfaces[0].AccessConfigs)
+			assert.Equal(t, "projects/project-name/global/networks/storage", instance.NetworkInterfaces[1].Network)
+			assert.NotNil(t, instance.NetworkInterfaces[1].AccessConfigs)
+			assert.Empty(t, instance.NetworkInterfaces[1].AccessConfigs)
+			assert.NotNil(t, instanceBeta.NetworkInterfaces[1].AccessConfigs)
+			assert.Empty(t, instanceBeta.NetworkInterfaces[1].AccessConfigs)
+		})
+	}
+}
+
+// validateWithFakeCompute populates and validates w against a fake Compute
+// Engine API that has the networks and image of
+// TestSetupWorkflow_WithNetworkMappingsAndProductProperties.
+func validateWithFakeCompute(t *testing.T, w *daisy.Workflow) {
+	computeClient, err := daisycompute.NewFakeClient()
+	assert.NoError(t, err)
+	assert.NoError(t, computeClient.CreateNetwork(defaultProject, &compute.Network{Name: "prod"}))
+	assert.NoError(t, computeClient.CreateNetwork(defaultProject, &compute.Network{Name: "storage"}))
+	assert.NoError(t, computeClient.CreateSubnetwork(defaultProject, "us-west2", &compute.Subnetwork{
+		Name: "prod-sub", Network: "projects/project-name/global/networks/prod"}))
+	assert.NoError(t, computeClient.CreateImage(defaultProject, &compute.Image{Name: "boot-disk"}))
+	w.ComputeClient = computeClient
+	w.StorageClient, err = gcs.NewClient(context.Background(), option.WithoutAuthentication())
+	assert.NoError(t, err)
+	w.Zone = daisycompute.DefaultFakeZones[0]
+	assert.NoError(t, w.Validate(context.Background()))
+}
+
+func TestSetupWorkflow_ErrorWhenNetworkNotMapped(t *testing.T) {
+	params := getAllInstanceImportParams()
+	params.NetworkMappings = map[string]domain.NetworkMapping{"Storage": {Network: "global/networks/storage"}}
+	testCase := mockConfiguration{
+		descriptorFilenames: []string{"Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
+		expectedOS:          params.OsID,
+	}
+	descriptor := createOVFDescriptor(testCase.descriptorFilenames)
+	virtualHardware := &descriptor.VirtualSystem.VirtualHardware[0]
+	virtualHardware.Item = append(virtualHardware.Item, createNetworkAdapterItem("13", "VM Network"))
+
+	_, err := setupMocksAndRun(t, params, instanceMode.wfPath, descriptor, testCase)
+	assert.EqualError(t, err, "the network mapping file doesn't map OVF networks: VM Network")
+}
+
+func TestSetUpWorkflow_ErrorIndexingOVA(t *testing.T) {
 	params := getAllInstanceImportParams()
 	project := defaultProject
 	params.Project = &project
@@ -114,13 +210,11 @@ func TestSetUpWorkflow_ErrorUnpackingOVA(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
-	mockMockTarGcsExtractorInterface := mocks.NewMockTarGcsExtractorInterface(mockCtrl)
-	mockMockTarGcsExtractorInterface.EXPECT().ExtractTarToGcs(
-		"gs://ovfbucket/ovfpath/vmware.ova", params.ScratchBucketGcsPath+"/ovf").
-		Return(expectedError).Times(1)
+	mockTarIndexer := ovfdomainmocks.NewMockTarIndexerInterface(mockCtrl)
+	mockTarIndexer.EXPECT().IndexTar("gs://ovfbucket/ovfpath/vmware.ova").Return(nil, expectedError).Times(1)
 
 	oi := OVFImporter{workflowPath: instanceMode.wfPath,
-		tarGcsExtractor: mockMockTarGcsExtractorInterface, Logger: logging.NewToolLogger("test"),
+		tarIndexer: mockTarIndexer, Logger: logging.NewToolLogger("test"),
 		params: params}
 	w, err := oi.setUpImportWorkflow()
 
@@ -151,7 +245,7 @@ func TestSetUpWorkflow_ErrorLoadingDescriptor(t *testing.T) {
 
 	assert.Equal(t, expectedError, err)
 	assert.Nil(t, w)
-	assert.Equal(t, "", oi.gcsPathToClean)
+	assert.Nil(t, oi.params.OvaIndex)
 }
 
 func TestSetUpWork_OSIDs(t *testing.T) {
@@ -214,7 +308,7 @@ func TestSetUpWork_OSIDs(t *testing.T) {
 			}
 			wf, err := setupMocksAndRun(t, params, instanceMode.wfPath, descriptor, mockConfiguration{
 				descriptorFilenames: descriptorFilenames,
-				fileURIs:            []string{"gs://bucket/folder/ovf/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
+				fileURIs:            []string{"gs://ovfbucket/ovfpath/vmware.ova/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
 				imageURIs:           []string{"images/uri/boot-disk"},
 				expectedOS:          tc.expectedOSID,
 				expectImportToRun:   tc.expectedError == "",
@@ -235,10 +329,9 @@ func TestCleanUp(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
-	mockStorageClient.EXPECT().DeleteGcsPath("aPath")
 	mockStorageClient.EXPECT().Close()
 
-	oi := OVFImporter{storageClient: mockStorageClient, gcsPathToClean: "aPath",
+	oi := OVFImporter{storageClient: mockStorageClient,
 		Logger: logging.NewToolLogger("test")}
 	oi.CleanUp()
 }
@@ -311,43 +404,21 @@ func TestBuildDaisyVars_NetworkAndSubnets(t *testing.T) {
 
 func TestGetOvfGcsPath(t *testing.T) {
 	tests := []struct {
-		name          string
-		tmpGcsPath    string
-		ovfPath       string
-		expectExtract bool
-		expectedPath  string
-		expectedError error
-		expectCleanup bool
+		name         string
+		ovfPath      string
+		expectedPath string
 	}{
 		{
 			name:         "return directory when user gives descriptor",
-			tmpGcsPath:   "gs://tmp-bucket/",
 			ovfPath:      "gs://res-bucket/path/to/descriptor.ovf",
 			expectedPath: "gs://res-bucket/path/to/",
-		}, {
-			name:          "extract to tmp when user gives archive",
-			tmpGcsPath:    "gs://tmp-bucket/",
-			ovfPath:       "gs://res-bucket/archive.ova",
-			expectedPath:  "gs://tmp-bucket/ovf",
-			expectExtract: true,
-			expectCleanup: true,
-		}, {
-			name:          "error when extraction fails",
-			tmpGcsPath:    "gs://tmp-bucket/",
-			ovfPath:       "gs://res-bucket/archive.ova",
-			expectedPath:  "gs://tmp-bucket/ovf",
-			expectedError: errors.New("extraction error"),
-			expectExtract: true,
-			expectCleanup: true,
 		}, {
 			name:         "return directory when user gives directory",
-			tmpGcsPath:   "gs://tmp-bucket/",
 			ovfPath:      "gs://res-bucket/directory/",
 			expectedPath: "gs://res-bucket/directory/",
 		},
 		{
 			name:         "return directory when user gives non-OVA and non-OVF file",
-			tmpGcsPath:   "gs://tmp-bucket/",
 			ovfPath:      "gs://res-bucket/file-like",
 			expectedPath: "gs://res-bucket/file-like/",
 		},
@@ -357,21 +428,12 @@ func TestGetOvfGcsPath(t *testing.T) {
 			params := getAllInstanceImportParams()
 			params.OvfOvaGcsPath = tc.ovfPath
 
-			mockCtrl := gomock.NewController(t)
-			defer mockCtrl.Finish()
-			mockExtractor := mocks.NewMockTarGcsExtractorInterface(mockCtrl)
-			if tc.expectExtract {
-				mockExtractor.EXPECT().ExtractTarToGcs(tc.ovfPath, tc.expectedPath).Return(tc.expectedError)
-			}
 			oi := &OVFImporter{
-				Logger:          logging.NewToolLogger("test"),
-				params:          params,
-				tarGcsExtractor: mockExtractor,
+				Logger: logging.NewToolLogger("test"),
+				params: params,
 			}
-			actualPath, actualCleanup, actualErr := oi.getOvfGcsPath(tc.tmpGcsPath)
+			actualPath := oi.getOvfGcsPath()
 			assert.Equal(t, path.ToDirectoryURL(tc.expectedPath), actualPath, "always return path with trailing slash")
-			assert.Equal(t, tc.expectCleanup, actualCleanup)
-			assert.Equal(t, tc.expectedError, actualErr)
 		})
 	}
 }
@@ -435,9 +497,9 @@ func runImportAndVerify(t *testing.T, params *domain.OVFImportParams, mode *impo
 			"Ubuntu_for_Horizon71_1_1.0-disk3.vmdk",
 		},
 		fileURIs: []string{
-			"gs://bucket/folder/ovf/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk",
-			"gs://bucket/folder/ovf/Ubuntu_for_Horizon71_1_1.0-disk2.vmdk",
-			"gs://bucket/folder/ovf/Ubuntu_for_Horizon71_1_1.0-disk3.vmdk",
+			"gs://ovfbucket/ovfpath/vmware.ova/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk",
+			"gs://ovfbucket/ovfpath/vmware.ova/Ubuntu_for_Horizon71_1_1.0-disk2.vmdk",
+			"gs://ovfbucket/ovfpath/vmware.ova/Ubuntu_for_Horizon71_1_1.0-disk3.vmdk",
 		},
 		imageURIs: []string{
 			"images/uri/boot-disk",
@@ -574,13 +636,17 @@ func setupMocksAndRun(t *testing.T, params *domain.OVFImportParams, wfPath strin
 	if params.MachineType == "" {
 		mockComputeClient.EXPECT().ListMachineTypes(*params.Project, params.Zone).Return(machineTypes, nil)
 	}
+	ovaIndex := &storage.TarIndex{GcsPath: params.OvfOvaGcsPath,
+		Entries: []storage.TarEntry{{Name: "vmware.ovf", Offset: 512, Size: 1024}}}
+	for _, filename := range mockConfig.descriptorFilenames {
+		ovaIndex.Entries = append(ovaIndex.Entries, storage.TarEntry{Name: filename})
+	}
+	expectedParams.OvaIndex = ovaIndex
+	mockTarIndexer := ovfdomainmocks.NewMockTarIndexerInterface(mockCtrl)
+	mockTarIndexer.EXPECT().IndexTar(params.OvfOvaGcsPath).Return(ovaIndex, nil).Times(1)
 	mockOvfDescriptorLoader := ovfdomainmocks.NewMockOvfDescriptorLoaderInterface(mockCtrl)
-	mockOvfDescriptorLoader.EXPECT().Load(params.ScratchBucketGcsPath+"/ovf/").Return(
+	mockOvfDescriptorLoader.EXPECT().LoadFromTar(ovaIndex, ovaIndex.Entries[0]).Return(
 		descriptor, nil)
-	mockMockTarGcsExtractorInterface := mocks.NewMockTarGcsExtractorInterface(mockCtrl)
-	mockMockTarGcsExtractorInterface.EXPECT().ExtractTarToGcs(
-		params.OvfOvaGcsPath, params.ScratchBucketGcsPath+"/ovf").
-		Return(nil).Times(1)
 	mockMultiDiskImporter := ovfdomainmocks.NewMockMultiImageImporterInterface(mockCtrl)
 	if mockConfig.expectImportToRun {
 		mockMultiDiskImporter.EXPECT().ImportAll(
@@ -590,7 +656,7 @@ func setupMocksAndRun(t *testing.T, params *domain.OVFImportParams, wfPath strin
 	}
 	oi := OVFImporter{ctx: context.Background(), workflowPath: wfPath, multiImageImporter: mockMultiDiskImporter,
 		storageClient: mockStorageClient, computeClient: mockComputeClient,
-		ovfDescriptorLoader: mockOvfDescriptorLoader, tarGcsExtractor: mockMockTarGcsExtractorInterface,
+		ovfDescriptorLoader: mockOvfDescriptorLoader, tarIndexer: mockTarIndexer,
 		Logger: logging.NewToolLogger("test"), params: params}
 	w, err := oi.setUpImportWorkflow()
 
@@ -627,6 +693,12 @@ func createDiskItem(instanceID string, addressOnParent string,
 	}
 }
 
+func createNetworkAdapterItem(instanceID string, connection string) ovf.ResourceAllocationSettingData {
+	item := createControllerItem(instanceID, 10)
+	item.Connection = []string{connection}
+	return item
+}
+
 func createOVFDescriptor(vmdkNames []string) *ovf.Envelope {
 	virtualHardware := ovf.VirtualHardwareSection{
 		Item: []ovf.ResourceAllocationSettingData{
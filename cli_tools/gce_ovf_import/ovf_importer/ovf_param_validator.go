@@ -33,6 +33,7 @@ import (
 	storageutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/validation"
 	ovfdomain "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain"
+	ovfgceutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/gce_utils"
 	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
 )
 
@@ -55,6 +56,9 @@ const (
 	// HostnameFlagKey is key for hostname CLI flag
 	HostnameFlagKey = "hostname"
 
+	// NetworkMappingFlagKey is key for network mapping file CLI flag
+	NetworkMappingFlagKey = "network-mapping"
+
 	// Prefix for valid instance access config scopes
 	instanceAccessScopePrefix = "https://www.googleapis.com/auth/"
 )
@@ -100,6 +104,15 @@ func (p *ParamValidatorAndPopulator) ValidateAndPopulate(params *ovfdomain.OVFIm
 
 	params.InstanceNames = strings.ToLower(strings.TrimSpace(params.InstanceNames))
 	params.MachineImageName = strings.ToLower(strings.TrimSpace(params.MachineImageName))
+	params.NetworkMappingFile = strings.TrimSpace(params.NetworkMappingFile)
+	if params.NetworkMappingFile != "" {
+		if params.Network != "" || params.Subnet != "" {
+			return daisy.Errf("-%v can't be provided with -network or -subnet", NetworkMappingFlagKey)
+		}
+		if params.NetworkMappings, err = p.readNetworkMappings(params.NetworkMappingFile, params.Region); err != nil {
+			return err
+		}
+	}
 	params.Network, params.Subnet = param.ResolveNetworkAndSubnet(params.Network, params.Subnet, params.Region)
 	params.Description = strings.TrimSpace(params.Description)
 	params.PrivateNetworkIP = strings.TrimSpace(params.PrivateNetworkIP)
@@ -188,6 +201,19 @@ func (p *ParamValidatorAndPopulator) ValidateAndPopulate(params *ovfdomain.OVFIm
 	return nil
 }
 
+func (p *ParamValidatorAndPopulator) readNetworkMappings(
+	filename, region string) (map[string]ovfdomain.NetworkMapping, error) {
+	mappings, err := ovfgceutils.ReadNetworkMappingFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	for name, mapping := range mappings {
+		mapping.Network, mapping.Subnet = param.ResolveNetworkAndSubnet(mapping.Network, mapping.Subnet, region)
+		mappings[name] = mapping
+	}
+	return mappings, nil
+}
+
 func (p *ParamValidatorAndPopulator) lookupProjectIfMissing(originalProject string) (*string, error) {
 	project, err := param.GetProjectID(p.metadataClient, strings.TrimSpace(originalProject))
 	return &project, err
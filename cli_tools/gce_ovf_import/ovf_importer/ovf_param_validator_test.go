@@ -17,6 +17,7 @@ package ovfimporter
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
 	"reflect"
@@ -238,6 +239,20 @@ func Test_ValidateAndParseParams_ErrorMessages(t *testing.T) {
 				params.Labels = "NOT_VALID"
 			},
 			expectErrorToContain: "failed to parse key-value pair",
+		}, {
+			name: "network mapping can't be used with network",
+			paramModifier: func(params *domain.OVFImportParams) {
+				params.NetworkMappingFile = "networks.yaml"
+			},
+			expectErrorToContain: "-network-mapping can't be provided with -network or -subnet",
+		}, {
+			name: "network mapping file must exist",
+			paramModifier: func(params *domain.OVFImportParams) {
+				params.Network = ""
+				params.Subnet = ""
+				params.NetworkMappingFile = "/does/not/exist.yaml"
+			},
+			expectErrorToContain: "no such file or directory",
 		}, {
 			name: "don't allow empty tag",
 			paramModifier: func(params *domain.OVFImportParams) {
@@ -529,6 +544,25 @@ func Test_ValidateAndParseParams_SuccessfulCases(t *testing.T) {
 	}
 }
 
+func Test_ValidateAndParseParams_ReadsNetworkMappingFile(t *testing.T) {
+	mappingFile, err := ioutil.TempFile("", "networks-*.yaml")
+	assert.NoError(t, err)
+	defer os.Remove(mappingFile.Name())
+	_, err = mappingFile.WriteString("VM Network:\n  network: prod\n  subnet: prod-sub\nStorage:\n  network: storage\n")
+	assert.NoError(t, err)
+	assert.NoError(t, mappingFile.Close())
+
+	params := getAllInstanceImportParams()
+	params.Network = ""
+	params.Subnet = ""
+	params.NetworkMappingFile = " " + mappingFile.Name() + " "
+	assertNoErrorOnValidate(t, params)
+	assert.Equal(t, map[string]domain.NetworkMapping{
+		"VM Network": {Network: "global/networks/prod", Subnet: "regions/us-west2/subnetworks/prod-sub"},
+		"Storage":    {Network: "global/networks/storage"},
+	}, params.NetworkMappings)
+}
+
 func TestInstanceImportFlagsAllValid(t *testing.T) {
 	assertNoErrorOnValidate(t, getAllInstanceImportParams())
 }
@@ -16,8 +16,12 @@ package ovfutils
 
 import (
 	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"path"
 
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 	ovfdomain "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain"
 	"github.com/vmware/govmomi/ovf"
 )
@@ -46,11 +50,87 @@ func (l *OvfDescriptorLoader) Load(ovfGcsPath string) (*ovf.Envelope, error) {
 	if err != nil {
 		return nil, err
 	}
-	descriptorReader := bytes.NewReader(descriptorContent)
-	ovfDescriptor, err := ovf.Unmarshal(descriptorReader)
+	ovfDescriptor, err := unmarshalDescriptor(descriptorContent)
 	if err != nil {
 		return nil, err
 	}
 
 	return l.validator.ValidateOvfPackage(ovfDescriptor, ovfGcsPath)
 }
+
+// LoadFromTar loads the OVF descriptor of an OVA in GCS with a ranged read of
+// the OVA, rather than extracting it. descriptor is the entry of the
+// descriptor in ovaIndex.
+func (l *OvfDescriptorLoader) LoadFromTar(ovaIndex *storage.TarIndex, descriptor storage.TarEntry) (*ovf.Envelope, error) {
+	reader, err := storage.NewTarEntryReader(l.storageClient, ovaIndex, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	descriptorContent, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	ovfDescriptor, err := unmarshalDescriptor(descriptorContent)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.validator.ValidateOvaPackage(ovfDescriptor, ovaIndex, path.Dir(descriptor.Name))
+}
+
+func unmarshalDescriptor(descriptorContent []byte) (*ovf.Envelope, error) {
+	ovfDescriptor, err := ovf.Unmarshal(bytes.NewReader(descriptorContent))
+	if err != nil {
+		return nil, err
+	}
+	if err := addEthernetPortItems(descriptorContent, ovfDescriptor); err != nil {
+		return nil, err
+	}
+	return ovfDescriptor, nil
+}
+
+// ethernetPortItems are the EthernetPortItem elements of an OVF 2.0
+// descriptor, which ovf.Unmarshal doesn't read.
+type ethernetPortItems struct {
+	VirtualHardware []struct {
+		EthernetPortItem []struct {
+			InstanceID   string   `xml:"InstanceID"`
+			ResourceType *uint16  `xml:"ResourceType"`
+			Connection   []string `xml:"Connection"`
+		} `xml:"EthernetPortItem"`
+	} `xml:"VirtualSystem>VirtualHardwareSection"`
+}
+
+// addEthernetPortItems adds the EthernetPortItems of descriptorContent, such
+// as the network adapters of VirtualBox appliances, to the items of
+// ovfDescriptor's virtual hardware, where OVF 1.0 declares them.
+func addEthernetPortItems(descriptorContent []byte, ovfDescriptor *ovf.Envelope) error {
+	var ports ethernetPortItems
+	if err := xml.Unmarshal(descriptorContent, &ports); err != nil {
+		return err
+	}
+	if ovfDescriptor.VirtualSystem == nil {
+		return nil
+	}
+	for i, virtualHardware := range ports.VirtualHardware {
+		if i >= len(ovfDescriptor.VirtualSystem.VirtualHardware) {
+			break
+		}
+		for _, port := range virtualHardware.EthernetPortItem {
+			resourceType := ethernetAdapter
+			if port.ResourceType != nil {
+				resourceType = *port.ResourceType
+			}
+			ovfDescriptor.VirtualSystem.VirtualHardware[i].Item = append(
+				ovfDescriptor.VirtualSystem.VirtualHardware[i].Item, ovf.ResourceAllocationSettingData{
+					CIMResourceAllocationSettingData: ovf.CIMResourceAllocationSettingData{
+						InstanceID:   port.InstanceID,
+						ResourceType: &resourceType,
+						Connection:   port.Connection,
+					},
+				})
+		}
+	}
+	return nil
+}
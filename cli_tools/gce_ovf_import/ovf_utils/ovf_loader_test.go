@@ -15,7 +15,10 @@
 package ovfutils
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"cloud.google.com/go/storage"
@@ -23,6 +26,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/vmware/govmomi/ovf"
 
+	storageutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 	ovfdomainmocks "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain/mocks"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/mocks"
 )
@@ -85,6 +89,28 @@ func TestOvfDescriptorLoader(t *testing.T) {
 	assert.Nil(t, resultError)
 }
 
+func TestOvfDescriptorLoaderFromTar(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	descriptor := storageutils.TarEntry{Name: "vm/descriptor.ovf", Offset: 1024, Size: int64(len(ovfDescriptorStr))}
+	ovaIndex := &storageutils.TarIndex{GcsPath: "gs://bucket/vm.ova", Entries: []storageutils.TarEntry{descriptor}}
+	mockStorageObject := mocks.NewMockStorageObject(mockCtrl)
+	mockStorageObject.EXPECT().NewRangeReader(descriptor.Offset, descriptor.Size).Return(
+		ioutil.NopCloser(strings.NewReader(ovfDescriptorStr)), nil)
+	mockStorageClient := mocks.NewMockStorageClientInterface(mockCtrl)
+	mockStorageClient.EXPECT().GetObject("bucket", "vm.ova").Return(mockStorageObject)
+
+	mockOvfDescriptorValidator := ovfdomainmocks.NewMockOvfDescriptorValidatorInterface(mockCtrl)
+	mockOvfDescriptorValidator.EXPECT().ValidateOvaPackage(ovfDescriptor, ovaIndex, "vm").Return(ovfDescriptor, nil)
+
+	l := OvfDescriptorLoader{storageClient: mockStorageClient, validator: mockOvfDescriptorValidator}
+	result, resultError := l.LoadFromTar(ovaIndex, descriptor)
+
+	assert.Equal(t, ovfDescriptor, result)
+	assert.Nil(t, resultError)
+}
+
 func TestOvfDescriptorLoaderNoDescriptorInGcs(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -155,3 +181,17 @@ func TestOvfDescriptorLoaderFromVbox(t *testing.T) {
 	assert.Equal(t, result, vboxOSDescriptor)
 	assert.Nil(t, resultError)
 }
+
+func TestAddEthernetPortItems(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/from-virtualbox.ovf")
+	assert.NoError(t, err)
+	envelope, err := ovf.Unmarshal(bytes.NewReader(content))
+	assert.NoError(t, err)
+
+	assert.NoError(t, addEthernetPortItems(content, envelope))
+	virtualHardware, err := GetVirtualHardwareSectionFromDescriptor(envelope)
+	assert.NoError(t, err)
+	connections, err := GetNetworkAdapterConnections(virtualHardware)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bridged"}, connections)
+}
@@ -15,11 +15,13 @@
 package ovfutils
 
 import (
+	"path"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/distro"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain"
 	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
 	"github.com/GoogleCloudPlatform/compute-image-tools/proto/go/pb"
@@ -29,6 +31,7 @@ import (
 const (
 	cpu                    uint16 = 3
 	memory                 uint16 = 4
+	ethernetAdapter        uint16 = 10
 	disk                   uint16 = 17
 	ideController          uint16 = 5
 	parallelSCSIController uint16 = 6
@@ -371,6 +374,92 @@ func GetMemoryInMB(virtualHardware *ovf.VirtualHardwareSection) (int64, error) {
 
 }
 
+// GetNetworkAdapterConnections returns the name of the OVF network that each
+// ethernet adapter is connected to, ordered by the adapters' instance IDs.
+// An adapter that isn't connected to a network has an empty name.
+func GetNetworkAdapterConnections(virtualHardware *ovf.VirtualHardwareSection) ([]string, error) {
+	if virtualHardware == nil {
+		return nil, daisy.Errf("virtualHardware cannot be nil")
+	}
+
+	adapterItems := filterItemsByResourceTypes(virtualHardware, ethernetAdapter)
+	sortItemsByStringValue(adapterItems, func(item ovf.ResourceAllocationSettingData) string {
+		return item.InstanceID
+	})
+	connections := make([]string, 0, len(adapterItems))
+	for _, item := range adapterItems {
+		var connection string
+		if len(item.Connection) > 0 {
+			connection = strings.TrimSpace(item.Connection[0])
+		}
+		connections = append(connections, connection)
+	}
+	return connections, nil
+}
+
+// ProductProperty is a property of a ProductSection, such as a vApp option
+// that configures an appliance's hostname or IP address.
+type ProductProperty struct {
+	// Key is the property's fully-qualified key: class.key.instance, where
+	// class and instance are the ProductSection's, when it has them.
+	Key      string
+	Value    string
+	Password bool
+}
+
+// GetProductProperties returns the properties of the ProductSections of an
+// OVF descriptor that have a value, in document order. The envelope's
+// ProductSection is first, followed by the virtual system's.
+func GetProductProperties(ovfDescriptor *ovf.Envelope) []ProductProperty {
+	if ovfDescriptor == nil {
+		return nil
+	}
+	var sections []ovf.ProductSection
+	if ovfDescriptor.Product != nil {
+		sections = append(sections, *ovfDescriptor.Product)
+	}
+	if ovfDescriptor.VirtualSystem != nil {
+		sections = append(sections, ovfDescriptor.VirtualSystem.Product...)
+	}
+
+	var properties []ProductProperty
+	for _, section := range sections {
+		for _, property := range section.Property {
+			value, ok := getPropertyValue(property)
+			if !ok {
+				continue
+			}
+			key := property.Key
+			if section.Class != nil && *section.Class != "" {
+				key = *section.Class + "." + key
+			}
+			if section.Instance != nil && *section.Instance != "" {
+				key = key + "." + *section.Instance
+			}
+			properties = append(properties, ProductProperty{
+				Key:      key,
+				Value:    value,
+				Password: property.Password != nil && *property.Password,
+			})
+		}
+	}
+	return properties
+}
+
+// getPropertyValue returns the property's default value, or else its value
+// that isn't specific to a deployment configuration.
+func getPropertyValue(property ovf.Property) (string, bool) {
+	if property.Default != nil {
+		return *property.Default, true
+	}
+	for _, value := range property.Values {
+		if value.Configuration == nil || *value.Configuration == "" {
+			return value.Value, true
+		}
+	}
+	return "", false
+}
+
 // GetVirtualHardwareSection returns VirtualHardwareSection from OVF VirtualSystem
 func GetVirtualHardwareSection(virtualSystem *ovf.VirtualSystem) (*ovf.VirtualHardwareSection, error) {
 	//TODO: support for multiple VirtualHardwareSection for different environments
@@ -418,20 +507,53 @@ func GetOVFDescriptorAndDiskPaths(ovfDescriptorLoader domain.OvfDescriptorLoader
 		return nil, nil, err
 	}
 
-	virtualHardware, err := GetVirtualHardwareSectionFromDescriptor(ovfDescriptor)
+	diskInfos, err := getDiskInfosFromDescriptor(ovfDescriptor)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, d := range diskInfos {
+		diskInfos[i].FilePath = ovfGcsPath + d.FilePath
+	}
+	return ovfDescriptor, diskInfos, nil
+}
+
+// GetOVADescriptorAndDiskPaths loads the OVF descriptor of an OVA using the OVA's index, so that
+// the OVA doesn't have to be extracted. It returns descriptor object and the paths of disk files
+// in the OVA, such as `gs://bucket/vm.ova/disk1.vmdk`.
+func GetOVADescriptorAndDiskPaths(ovfDescriptorLoader domain.OvfDescriptorLoaderInterface,
+	ovaIndex *storage.TarIndex) (*ovf.Envelope, []DiskInfo, error) {
+	descriptor, ok := ovaIndex.FindByExtension(".ovf")
+	if !ok {
+		return nil, nil, daisy.Errf("OVF descriptor not found in OVA %v", ovaIndex.GcsPath)
+	}
+	ovfDescriptor, err := ovfDescriptorLoader.LoadFromTar(ovaIndex, descriptor)
 	if err != nil {
 		return nil, nil, err
 	}
-	diskInfos, err := GetDiskInfos(virtualHardware, ovfDescriptor.Disk, &ovfDescriptor.References)
+
+	diskInfos, err := getDiskInfosFromDescriptor(ovfDescriptor)
 	if err != nil {
 		return nil, nil, err
 	}
+	// References are relative to the descriptor, which may be in a directory of the OVA.
 	for i, d := range diskInfos {
-		diskInfos[i].FilePath = ovfGcsPath + d.FilePath
+		entry, ok := ovaIndex.Find(path.Join(path.Dir(descriptor.Name), d.FilePath))
+		if !ok {
+			return nil, nil, daisy.Errf("disk file %v not found in OVA %v", d.FilePath, ovaIndex.GcsPath)
+		}
+		diskInfos[i].FilePath = ovaIndex.EntryPath(entry)
 	}
 	return ovfDescriptor, diskInfos, nil
 }
 
+func getDiskInfosFromDescriptor(ovfDescriptor *ovf.Envelope) ([]DiskInfo, error) {
+	virtualHardware, err := GetVirtualHardwareSectionFromDescriptor(ovfDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	return GetDiskInfos(virtualHardware, ovfDescriptor.Disk, &ovfDescriptor.References)
+}
+
 // GetOSId returns OS ID from OVF descriptor, or error if OS ID could not be retrieved.
 func GetOSId(ovfDescriptor *ovf.Envelope) (string, error) {
 
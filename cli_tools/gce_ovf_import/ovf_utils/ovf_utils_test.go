@@ -24,6 +24,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/vmware/govmomi/ovf"
 
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 	ovfdomainmocks "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_ovf_import/domain/mocks"
 )
 
@@ -539,6 +540,50 @@ func TestGetOVFDescriptorAndDiskPaths(t *testing.T) {
 	assert.Equal(t, ovfDescriptor, ovfDescriptorResult)
 }
 
+func TestGetOVADescriptorAndDiskPaths(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	virtualHardware := ovf.VirtualHardwareSection{
+		Item: []ovf.ResourceAllocationSettingData{
+			createControllerItem("5", parallelSCSIController),
+			createDiskItem("6", "0", "disk0", "ovf:/disk/vmdisk1", "5"),
+			createDiskItem("7", "1", "disk1", "ovf:/disk/vmdisk2", "5"),
+		},
+	}
+	ovfDescriptor := &ovf.Envelope{
+		Disk:       defaultDisks,
+		References: *defaultReferences,
+		VirtualSystem: &ovf.VirtualSystem{
+			VirtualHardware: []ovf.VirtualHardwareSection{virtualHardware},
+		},
+	}
+	ovaIndex := &storage.TarIndex{GcsPath: "gs://abucket/vm.ova", Entries: []storage.TarEntry{
+		{Name: "vm/vm.mf"},
+		{Name: "vm/vm.ovf"},
+		{Name: "vm/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk"},
+		{Name: "vm/Ubuntu_for_Horizon71_1_1.0-disk2.vmdk"},
+	}}
+
+	mockOvfDescriptorLoader := ovfdomainmocks.NewMockOvfDescriptorLoaderInterface(mockCtrl)
+	mockOvfDescriptorLoader.EXPECT().LoadFromTar(ovaIndex, ovaIndex.Entries[1]).Return(ovfDescriptor, nil)
+
+	ovfDescriptorResult, diskPaths, err := GetOVADescriptorAndDiskPaths(mockOvfDescriptorLoader, ovaIndex)
+	assert.NoError(t, err)
+	assert.Equal(t, ovfDescriptor, ovfDescriptorResult)
+	assert.Equal(t, []DiskInfo{
+		{"gs://abucket/vm.ova/vm/Ubuntu_for_Horizon71_1_1.0-disk1.vmdk", 20},
+		{"gs://abucket/vm.ova/vm/Ubuntu_for_Horizon71_1_1.0-disk2.vmdk", 1},
+	}, diskPaths)
+}
+
+func TestGetOVADescriptorAndDiskPathsErrorWhenNoDescriptor(t *testing.T) {
+	ovaIndex := &storage.TarIndex{GcsPath: "gs://abucket/vm.ova", Entries: []storage.TarEntry{{Name: "disk1.vmdk"}}}
+
+	_, _, err := GetOVADescriptorAndDiskPaths(nil, ovaIndex)
+	assert.EqualError(t, err, "OVF descriptor not found in OVA gs://abucket/vm.ova")
+}
+
 func TestGetOVFDescriptorAndDiskPathsErrorWhenLoadingDescriptor(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -796,3 +841,54 @@ func createMemoryItem(instanceID string, quantity uint) ovf.ResourceAllocationSe
 		},
 	}
 }
+
+func TestGetNetworkAdapterConnections(t *testing.T) {
+	envelope := parseOVF(t, "testdata/multi-nic-vapp.ovf")
+	virtualHardware, err := GetVirtualHardwareSectionFromDescriptor(envelope)
+	assert.NoError(t, err)
+
+	connections, err := GetNetworkAdapterConnections(virtualHardware)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Management", "Storage"}, connections)
+}
+
+func TestGetNetworkAdapterConnectionsUnconnectedAdapter(t *testing.T) {
+	virtualHardware := &ovf.VirtualHardwareSection{
+		Item: []ovf.ResourceAllocationSettingData{
+			createControllerItem("1", ethernetAdapter),
+			createControllerItem("2", sataController),
+		},
+	}
+	connections, err := GetNetworkAdapterConnections(virtualHardware)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, connections)
+}
+
+func TestGetNetworkAdapterConnectionsErrorWhenVirtualHardwareNil(t *testing.T) {
+	_, err := GetNetworkAdapterConnections(nil)
+	assert.Error(t, err)
+}
+
+func TestGetProductProperties(t *testing.T) {
+	assert.Equal(t, []ProductProperty{
+		{Key: "vami.ip0.appliance", Value: "10.0.0.10"},
+		{Key: "guestinfo.hostname", Value: "appliance-1"},
+		{Key: "guestinfo.root_password", Value: "secret", Password: true},
+		{Key: "size", Value: "M"},
+	}, GetProductProperties(parseOVF(t, "testdata/multi-nic-vapp.ovf")))
+}
+
+func TestGetProductPropertiesIncludesEnvelopeSection(t *testing.T) {
+	value := "value"
+	envelope := &ovf.Envelope{
+		Product: &ovf.ProductSection{Property: []ovf.Property{{Key: "envelope", Default: &value}}},
+		VirtualSystem: &ovf.VirtualSystem{
+			Product: []ovf.ProductSection{{Property: []ovf.Property{{Key: "system", Default: &value}}}},
+		},
+	}
+	assert.Equal(t, []ProductProperty{
+		{Key: "envelope", Value: "value"},
+		{Key: "system", Value: "value"},
+	}, GetProductProperties(envelope))
+	assert.Empty(t, GetProductProperties(nil))
+}
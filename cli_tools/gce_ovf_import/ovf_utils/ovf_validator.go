@@ -15,7 +15,10 @@
 package ovfutils
 
 import (
+	"path"
+
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
 	"github.com/vmware/govmomi/ovf"
 )
@@ -45,6 +48,23 @@ func (v *OvfValidator) ValidateOvfPackage(
 	return ovfDescriptor, nil
 }
 
+// ValidateOvaPackage validates the OVF package of an OVA. This includes checking that references
+// to resources exist in the OVA, relative to descriptorDir, the directory of the descriptor in the OVA.
+func (v *OvfValidator) ValidateOvaPackage(
+	ovfDescriptor *ovf.Envelope, ovaIndex *storage.TarIndex, descriptorDir string) (*ovf.Envelope, error) {
+	if ovfDescriptor == nil {
+		return nil, daisy.Errf("OVF descriptor cannot be nil")
+	}
+
+	for _, reference := range ovfDescriptor.References {
+		if _, ok := ovaIndex.Find(path.Join(descriptorDir, reference.Href)); !ok {
+			return nil, daisy.Errf("OVF reference %v not found in OVA %v", reference.Href, ovaIndex.GcsPath)
+		}
+	}
+
+	return ovfDescriptor, nil
+}
+
 func (v *OvfValidator) validateReferencesExistInGcs(
 	references []ovf.File, ovfGcsPath string) error {
 	if references == nil {
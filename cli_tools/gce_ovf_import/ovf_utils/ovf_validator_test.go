@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"cloud.google.com/go/storage"
+	storageutils "github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/mocks"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -111,6 +112,40 @@ func TestValidateOvfPackageMissingFirstReferenceInGcs(t *testing.T) {
 	assert.Nil(t, result)
 }
 
+func TestValidateOvaPackage(t *testing.T) {
+	ovaIndex := &storageutils.TarIndex{GcsPath: "gs://bucket/vm.ova", Entries: []storageutils.TarEntry{
+		{Name: "vm/descriptor.ovf"}, {Name: "vm/ref1"}, {Name: "vm/disks/ref2"},
+	}}
+	references := []ovf.File{file(1), {ID: "id2", Href: "disks/ref2"}}
+	ovfDescriptorForValidation := envelope(references)
+
+	v := OvfValidator{}
+	result, resultError := v.ValidateOvaPackage(ovfDescriptorForValidation, ovaIndex, "vm")
+
+	assert.Equal(t, ovfDescriptorForValidation, result)
+	assert.Nil(t, resultError)
+}
+
+func TestValidateOvaPackageMissingReference(t *testing.T) {
+	ovaIndex := &storageutils.TarIndex{GcsPath: "gs://bucket/vm.ova", Entries: []storageutils.TarEntry{
+		{Name: "descriptor.ovf"}, {Name: "ref1"},
+	}}
+
+	v := OvfValidator{}
+	result, resultError := v.ValidateOvaPackage(envelope([]ovf.File{file(1), file(2)}), ovaIndex, ".")
+
+	assert.EqualError(t, resultError, "OVF reference ref2 not found in OVA gs://bucket/vm.ova")
+	assert.Nil(t, result)
+}
+
+func TestValidateOvaPackageErrorWhenDescriptorNil(t *testing.T) {
+	v := OvfValidator{}
+	result, resultError := v.ValidateOvaPackage(nil, &storageutils.TarIndex{}, ".")
+
+	assert.NotNil(t, resultError)
+	assert.Nil(t, result)
+}
+
 func file(index int) ovf.File {
 	return ovf.File{
 		ID:   fmt.Sprintf("id%v", index),
@@ -0,0 +1,276 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package exporter
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"google.golang.org/api/option"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/imagefile/encoder"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/storage"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/validation"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+const (
+	// SourceFileFlagKey is the flag of the file that's converted locally.
+	SourceFileFlagKey = "source_file"
+
+	// The disk file of an image's tar.gz.
+	imageTarDiskName = "disk.raw"
+
+	// Buffering for uploads, matching gce_export's defaults.
+	uploadBufferSize = 1 << 30
+	uploadWorkers    = 4
+
+	sparseChunkSize = 64 << 10
+)
+
+// encode is replaced in tests.
+var encode = encoder.Encode
+
+func createStorageClient(ctx context.Context, oauth string) (domain.StorageClientInterface, error) {
+	return storage.NewStorageClient(ctx, logging.NewToolLogger(logPrefix), option.WithCredentialsFile(oauth))
+}
+
+// RunLocal converts sourceFile to format, and writes it to destinationURI,
+// without running a workflow. sourceFile is a raw disk, or an image's
+// tar.gz, in Cloud Storage or on the local filesystem. destinationURI is
+// a Cloud Storage object or a local file.
+//
+// The disk is copied to a sparse temporary file when it's compressed or in
+// Cloud Storage, since the formats are written in two passes.
+func RunLocal(ctx context.Context, sourceFile, destinationURI, format, oauth string) error {
+	log.SetPrefix(logPrefix + " ")
+
+	if err := validation.ValidateStringFlagNotEmpty(sourceFile, SourceFileFlagKey); err != nil {
+		return err
+	}
+	if err := validation.ValidateStringFlagNotEmpty(destinationURI, DestinationURIFlagKey); err != nil {
+		return err
+	}
+	if !isLocallySupportedFormat(format) {
+		return daisy.Errf("-%s converts to %s, but not to %q",
+			SourceFileFlagKey, strings.Join(encoder.Formats(), ", "), format)
+	}
+
+	disk, size, err := openSourceDisk(ctx, sourceFile, oauth)
+	if err != nil {
+		return err
+	}
+	defer disk.Close()
+
+	w, err := createDestination(ctx, destinationURI, oauth)
+	if err != nil {
+		return err
+	}
+	log.Printf("Converting %q to %s at %q.", sourceFile, format, destinationURI)
+	if err := encode(w, disk, size, format); err != nil {
+		// Closing would publish a truncated file.
+		if abortErr := w.Abort(); abortErr != nil {
+			log.Printf("Failed to delete the partially written %q: %v", destinationURI, abortErr)
+		}
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write %q: %w", destinationURI, err)
+	}
+	log.Printf("Finished writing %q.", destinationURI)
+	return nil
+}
+
+func isLocallySupportedFormat(format string) bool {
+	for _, f := range encoder.Formats() {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceDisk is the raw disk of the source file. Temporary files are
+// deleted when it's closed.
+type sourceDisk struct {
+	*os.File
+	temporary bool
+}
+
+func (d sourceDisk) Close() error {
+	err := d.File.Close()
+	if d.temporary {
+		os.Remove(d.Name())
+	}
+	return err
+}
+
+// openSourceDisk opens the raw disk of sourceFile, and returns its size.
+func openSourceDisk(ctx context.Context, sourceFile, oauth string) (sourceDisk, int64, error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(sourceFile, "gs://") {
+		bkt, obj, err := storage.GetGCSObjectPathElements(sourceFile)
+		if err != nil {
+			return sourceDisk{}, 0, err
+		}
+		client, err := createStorageClient(ctx, oauth)
+		if err != nil {
+			return sourceDisk{}, 0, err
+		}
+		defer client.Close()
+		if r, err = client.GetObject(bkt, obj).NewReader(); err != nil {
+			return sourceDisk{}, 0, fmt.Errorf("failed to read %q: %w", sourceFile, err)
+		}
+	} else {
+		f, err := os.Open(sourceFile)
+		if err != nil {
+			return sourceDisk{}, 0, err
+		}
+		r = f
+	}
+	keepOpen := false
+	defer func() {
+		if !keepOpen {
+			r.Close()
+		}
+	}()
+
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		if f, ok := r.(*os.File); ok {
+			stat, err := f.Stat()
+			if err != nil {
+				return sourceDisk{}, 0, err
+			}
+			keepOpen = true
+			return sourceDisk{File: f}, stat.Size(), nil
+		}
+		return spool(br)
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return sourceDisk{}, 0, fmt.Errorf("failed to read %q: %w", sourceFile, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return sourceDisk{}, 0, daisy.Errf("%q doesn't have a %s file", sourceFile, imageTarDiskName)
+		}
+		if err != nil {
+			return sourceDisk{}, 0, fmt.Errorf("failed to read %q: %w", sourceFile, err)
+		}
+		if header.Name == imageTarDiskName && header.Typeflag == tar.TypeReg {
+			return spool(tr)
+		}
+	}
+}
+
+// spool copies r to a temporary file, leaving holes where r has zeros.
+func spool(r io.Reader) (sourceDisk, int64, error) {
+	f, err := ioutil.TempFile("", "export-disk-")
+	if err != nil {
+		return sourceDisk{}, 0, err
+	}
+	disk := sourceDisk{File: f, temporary: true}
+	size, err := copySparse(f, r)
+	if err != nil {
+		disk.Close()
+		return sourceDisk{}, 0, fmt.Errorf("failed to copy disk to %q: %w", f.Name(), err)
+	}
+	return disk, size, nil
+}
+
+func copySparse(f *os.File, r io.Reader) (int64, error) {
+	chunk := make([]byte, sparseChunkSize)
+	var size int64
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			var writeErr error
+			if isZero(chunk[:n]) {
+				_, writeErr = f.Seek(int64(n), io.SeekCurrent)
+			} else {
+				_, writeErr = f.Write(chunk[:n])
+			}
+			if writeErr != nil {
+				return 0, writeErr
+			}
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// Holes at the end of the file are only kept by truncating.
+			return size, f.Truncate(size)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// destination is the file that's written. Abort discards what's been
+// written, instead of closing it.
+type destination interface {
+	io.WriteCloser
+	Abort() error
+}
+
+// localDestination is a destination on the local filesystem.
+type localDestination struct {
+	*os.File
+}
+
+func (d localDestination) Abort() error {
+	d.File.Close()
+	return os.Remove(d.Name())
+}
+
+func createDestination(ctx context.Context, destinationURI, oauth string) (destination, error) {
+	if !strings.HasPrefix(destinationURI, "gs://") {
+		f, err := os.Create(destinationURI)
+		if err != nil {
+			return nil, err
+		}
+		return localDestination{f}, nil
+	}
+	bkt, obj, err := storage.GetGCSObjectPathElements(destinationURI)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewBufferedWriter(ctx, uploadBufferSize, uploadWorkers, createStorageClient, oauth,
+		os.TempDir(), bkt, obj), nil
+}
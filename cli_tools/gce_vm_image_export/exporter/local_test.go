@@ -0,0 +1,157 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package exporter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/disk/offline"
+)
+
+func makeDisk() []byte {
+	disk := make([]byte, 3<<20)
+	copy(disk[1<<20:], "data")
+	return disk
+}
+
+func makeImageTar(t *testing.T, files map[string][]byte) []byte {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gz)
+	for _, name := range []string{"manifest.json", "disk.raw"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}))
+		_, err := tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return b.Bytes()
+}
+
+func readQCOW2(t *testing.T, filename string) []byte {
+	image, err := offline.OpenImage(filename)
+	require.NoError(t, err)
+	defer image.Close()
+	disk := make([]byte, image.Size())
+	_, err = image.ReadAt(disk, 0)
+	require.NoError(t, err)
+	return disk
+}
+
+func TestRunLocal_ConvertsFile(t *testing.T) {
+	disk := makeDisk()
+	for _, tt := range []struct {
+		name    string
+		content []byte
+	}{
+		{"raw disk", disk},
+		{"image tar", makeImageTar(t, map[string][]byte{"manifest.json": []byte("{}"), "disk.raw": disk})},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "export")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			source := filepath.Join(dir, "source")
+			destination := filepath.Join(dir, "disk.qcow2")
+			require.NoError(t, ioutil.WriteFile(source, tt.content, 0644))
+
+			assert.NoError(t, RunLocal(context.Background(), source, destination, "qcow2", ""))
+			assert.True(t, bytes.Equal(disk, readQCOW2(t, destination)), "disk content differs")
+			_, err = os.Stat(source)
+			assert.NoError(t, err, "source must not be deleted")
+		})
+	}
+}
+
+func TestRunLocal_DeletesDestination_WhenConversionFails(t *testing.T) {
+	defer func(original func(io.Writer, io.ReaderAt, int64, string) error) { encode = original }(encode)
+	encode = func(w io.Writer, disk io.ReaderAt, size int64, format string) error {
+		if _, err := w.Write([]byte("partial")); err != nil {
+			return err
+		}
+		return errors.New("conversion failed")
+	}
+	dir, err := ioutil.TempDir("", "export")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source")
+	destination := filepath.Join(dir, "disk.vmdk")
+	require.NoError(t, ioutil.WriteFile(source, makeDisk(), 0644))
+
+	assert.EqualError(t, RunLocal(context.Background(), source, destination, "vmdk", ""), "conversion failed")
+	_, err = os.Stat(destination)
+	assert.True(t, os.IsNotExist(err), "partial destination must be deleted")
+}
+
+func TestRunLocal_RequiresDiskInTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "root.tar.gz")
+	require.NoError(t, ioutil.WriteFile(source, makeImageTar(t, map[string][]byte{"manifest.json": []byte("{}")}), 0644))
+
+	err = RunLocal(context.Background(), source, filepath.Join(dir, "disk.vmdk"), "vmdk", "")
+	assert.EqualError(t, err, `"`+source+`" doesn't have a disk.raw file`)
+}
+
+func TestRunLocal_ValidatesFlags(t *testing.T) {
+	for _, tt := range []struct {
+		name                               string
+		sourceFile, destinationURI, format string
+		expectedError                      string
+	}{
+		{"no source", "", "gs://bucket/disk.vmdk", "vmdk", "The flag -source_file must be provided"},
+		{"no destination", "disk.raw", "", "vmdk", "The flag -destination_uri must be provided"},
+		{"unsupported format", "disk.raw", "gs://bucket/disk.vhdx", "vhdx",
+			`-source_file converts to qcow2, vmdk, vpc, vpc-fixed, but not to "vhdx"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RunLocal(context.Background(), tt.sourceFile, tt.destinationURI, tt.format, "")
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestCopySparse(t *testing.T) {
+	f, err := ioutil.TempFile("", "sparse")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	disk := make([]byte, 3*sparseChunkSize+10)
+	disk[sparseChunkSize+1] = 1
+
+	size, err := copySparse(f, bytes.NewReader(disk))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(disk)), size)
+	actual, err := ioutil.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(disk, actual), "content differs")
+}
@@ -16,6 +16,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 
@@ -29,6 +30,7 @@ var (
 	destinationURI        = flag.String(exporter.DestinationURIFlagKey, "", "The Google Cloud Storage URI destination for the exported virtual disk file. For example: gs://my-bucket/my-exported-image.vmdk.")
 	sourceImage           = flag.String(exporter.SourceImageFlagKey, "", "Compute Engine image from which to export")
 	sourceDiskSnapshot    = flag.String(exporter.SourceDiskSnapshotFlagKey, "", "Compute Engine disk snapshot from which to export")
+	sourceFile            = flag.String(exporter.SourceFileFlagKey, "", "Raw disk, or an image's tar.gz, to convert on this machine rather than on a worker instance. Either a Cloud Storage URI or a local path.")
 	format                = flag.String("format", "", "Specify the format to export to, such as vmdk, vhdx, vpc, or qcow2.")
 	project               = flag.String("project", "", "Project to run in, overrides what is set in workflow.")
 	network               = flag.String("network", "", "Name of the network in your project to use for the image export. The network must have access to Google Cloud Storage. If not specified, the network named default is used.")
@@ -46,6 +48,9 @@ var (
 )
 
 func exportEntry() (service.Loggable, error) {
+	if *sourceFile != "" {
+		return nil, exporter.RunLocal(context.Background(), *sourceFile, *destinationURI, *format, *oauth)
+	}
 	currentExecutablePath := string(os.Args[0])
 	wf, err := exporter.Run(*clientID, *destinationURI, *sourceImage, *sourceDiskSnapshot, *format, project,
 		*network, *subnet, *zone, *timeout, *scratchBucketGcsPath, *oauth, *ce, *computeServiceAccount,
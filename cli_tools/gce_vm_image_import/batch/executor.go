@@ -0,0 +1,134 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+)
+
+// Importer imports the image of a manifest entry.
+type Importer interface {
+	Import(ctx context.Context, entry Entry, logger logging.Logger) error
+}
+
+// Options configures how the images of a manifest are imported.
+type Options struct {
+	// MaxConcurrentImports is the number of images imported at once.
+	MaxConcurrentImports int
+	// Retries is the number of times that an import that failed with a
+	// transient error is retried.
+	Retries int
+	// RetryDelay is the time between an import's failure and its retry.
+	RetryDelay time.Duration
+}
+
+// Run imports entries with a pool of MaxConcurrentImports workers, and
+// blocks until all of them are finished. Unlike the OVF importer's
+// requestExecutor, a failed import doesn't stop the others.
+//
+// Returns a result for each entry, in the same order as entries.
+func Run(ctx context.Context, entries []Entry, importer Importer, options Options, logger logging.ToolLogger) []Result {
+	workers := options.MaxConcurrentImports
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(entries) {
+		workers = len(entries)
+	}
+	results := make([]Result, len(entries))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = runEntry(ctx, entries[i], importer, options, logger)
+			}
+		}()
+	}
+	for i := range entries {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+// runEntry imports entry, retrying it when it fails with a transient error.
+func runEntry(ctx context.Context, entry Entry, importer Importer, options Options, toolLogger logging.ToolLogger) Result {
+	logger := toolLogger.NewLogger(fmt.Sprintf("[import-%s]", entry.ImageName))
+	result := Result{ImageName: entry.ImageName, Source: entry.Source()}
+	start := time.Now()
+	retries := options.Retries
+	if retries < 0 {
+		retries = 0
+	}
+	policy := backoff.WithContext(backoff.WithMaxRetries(
+		backoff.NewConstantBackOff(options.RetryDelay), uint64(retries)), ctx)
+	err := backoff.Retry(func() error {
+		if ctx.Err() != nil {
+			return backoff.Permanent(ctx.Err())
+		}
+		result.Attempts++
+		if result.Attempts > 1 {
+			logger.User(fmt.Sprintf("Retrying the import of %q (attempt %d of %d).",
+				entry.ImageName, result.Attempts, retries+1))
+		}
+		err := importer.Import(ctx, entry, logger)
+		if err != nil {
+			logger.User(fmt.Sprintf("Failed to import %q: %v", entry.ImageName, err))
+			if !isTransient(err) {
+				return backoff.Permanent(err)
+			}
+		}
+		return err
+	}, policy)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	} else {
+		result.Status = StatusSucceeded
+	}
+	return result
+}
+
+// transientErrorPattern matches the messages of errors that can succeed when
+// retried. Daisy reports API errors as text, so server errors and rate
+// limiting are matched by their messages, in addition to dropped
+// connections and exhausted zonal capacity.
+var transientErrorPattern = regexp.MustCompile(`googleapi: Error (429|5\d\d)|rateLimitExceeded|` +
+	`connection reset by peer|unexpected EOF|server sent GOAWAY|ZONE_RESOURCE_POOL_EXHAUSTED`)
+
+// isTransient returns whether an import that failed with err can succeed
+// when it's retried.
+func isTransient(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && (apiErr.Code == 429 || apiErr.Code >= 500 && apiErr.Code <= 599) {
+		return true
+	}
+	return transientErrorPattern.MatchString(err.Error())
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+)
+
+// mockImporter fails the first failures[ImageName] imports of an entry, with
+// a transient error unless permanent is set.
+type mockImporter struct {
+	failures  map[string]int
+	permanent bool
+	delay     time.Duration
+
+	mutex      sync.Mutex
+	attempts   map[string]int
+	running    int
+	maxRunning int
+}
+
+func (m *mockImporter) Import(ctx context.Context, entry Entry, logger logging.Logger) error {
+	m.mutex.Lock()
+	if m.attempts == nil {
+		m.attempts = map[string]int{}
+	}
+	m.attempts[entry.ImageName]++
+	attempt := m.attempts[entry.ImageName]
+	m.running++
+	if m.running > m.maxRunning {
+		m.maxRunning = m.running
+	}
+	m.mutex.Unlock()
+
+	time.Sleep(m.delay)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.running--
+	if attempt <= m.failures[entry.ImageName] {
+		if m.permanent {
+			return errors.New("failed " + entry.ImageName)
+		}
+		return &googleapi.Error{Code: 503, Message: "failed " + entry.ImageName}
+	}
+	return nil
+}
+
+func entriesNamed(names ...string) []Entry {
+	var entries []Entry
+	for _, name := range names {
+		entries = append(entries, Entry{ImageName: name, SourceFile: "gs://bucket/" + name + ".vmdk"})
+	}
+	return entries
+}
+
+func TestRun_ReturnsResultsInOrder(t *testing.T) {
+	importer := &mockImporter{failures: map[string]int{"b": 5}}
+	results := Run(context.Background(), entriesNamed("a", "b", "c"), importer,
+		Options{MaxConcurrentImports: 2, Retries: 2}, logging.NewToolLogger(t.Name()))
+
+	assert.Len(t, results, 3)
+	for i, name := range []string{"a", "b", "c"} {
+		assert.Equal(t, name, results[i].ImageName)
+		assert.Equal(t, "gs://bucket/"+name+".vmdk", results[i].Source)
+	}
+	assert.Equal(t, StatusSucceeded, results[0].Status)
+	assert.Equal(t, 1, results[0].Attempts)
+	assert.Empty(t, results[0].Error)
+	assert.Equal(t, StatusFailed, results[1].Status)
+	assert.Equal(t, 3, results[1].Attempts)
+	assert.Equal(t, "googleapi: Error 503: failed b", results[1].Error)
+	assert.Equal(t, StatusSucceeded, results[2].Status)
+}
+
+func TestRun_RetriesFailedImports(t *testing.T) {
+	importer := &mockImporter{failures: map[string]int{"a": 1, "b": 2}}
+	results := Run(context.Background(), entriesNamed("a", "b"), importer,
+		Options{MaxConcurrentImports: 2, Retries: 2}, logging.NewToolLogger(t.Name()))
+
+	assert.Equal(t, StatusSucceeded, results[0].Status)
+	assert.Equal(t, 2, results[0].Attempts)
+	assert.Equal(t, StatusSucceeded, results[1].Status)
+	assert.Equal(t, 3, results[1].Attempts)
+	assert.Equal(t, 0, Failed(results))
+}
+
+func TestRun_DoesntRetryPermanentErrors(t *testing.T) {
+	importer := &mockImporter{failures: map[string]int{"a": 1}, permanent: true}
+	results := Run(context.Background(), entriesNamed("a"), importer,
+		Options{MaxConcurrentImports: 1, Retries: 2}, logging.NewToolLogger(t.Name()))
+
+	assert.Equal(t, StatusFailed, results[0].Status)
+	assert.Equal(t, 1, results[0].Attempts)
+	assert.Equal(t, "failed a", results[0].Error)
+}
+
+func TestIsTransient(t *testing.T) {
+	for _, tt := range []struct {
+		err       error
+		transient bool
+	}{
+		{&googleapi.Error{Code: 503}, true},
+		{&googleapi.Error{Code: 429}, true},
+		{fmt.Errorf("creating disk: %w", &googleapi.Error{Code: 500}), true},
+		{errors.New("step \"create-instance\" run error: googleapi: Error 503: backendError"), true},
+		{errors.New("googleapi: Error 403: Rate Limit Exceeded, rateLimitExceeded"), true},
+		{errors.New("The zone does not have enough resources: ZONE_RESOURCE_POOL_EXHAUSTED"), true},
+		{errors.New("read tcp: connection reset by peer"), true},
+		{&googleapi.Error{Code: 404}, false},
+		{errors.New("googleapi: Error 400: Invalid value for field"), false},
+		{errors.New(`"ubuntu-1804" was detected on your disk, but "windows-2019" was specified`), false},
+	} {
+		assert.Equal(t, tt.transient, isTransient(tt.err), tt.err.Error())
+	}
+}
+
+func TestRun_LimitsConcurrentImports(t *testing.T) {
+	importer := &mockImporter{delay: 20 * time.Millisecond}
+	results := Run(context.Background(), entriesNamed("a", "b", "c", "d", "e", "f"), importer,
+		Options{MaxConcurrentImports: 3}, logging.NewToolLogger(t.Name()))
+
+	assert.Equal(t, 0, Failed(results))
+	assert.Equal(t, 3, importer.maxRunning)
+	assert.Len(t, importer.attempts, 6)
+}
+
+func TestRun_DoesntImportWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	importer := &mockImporter{}
+	results := Run(ctx, entriesNamed("a"), importer,
+		Options{MaxConcurrentImports: 1, Retries: 3}, logging.NewToolLogger(t.Name()))
+
+	assert.Equal(t, StatusFailed, results[0].Status)
+	assert.Equal(t, 0, results[0].Attempts)
+	assert.Equal(t, "context canceled", results[0].Error)
+	assert.Empty(t, importer.attempts)
+}
@@ -0,0 +1,178 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package batch imports the images of a manifest file concurrently.
+package batch
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/param"
+)
+
+// Entry is an image of a manifest. The other arguments of its import are
+// the command line's.
+type Entry struct {
+	ImageName   string            `yaml:"image_name"`
+	SourceFile  string            `yaml:"source_file"`
+	SourceImage string            `yaml:"source_image"`
+	OS          string            `yaml:"os"`
+	DataDisk    bool              `yaml:"data_disk"`
+	BYOL        bool              `yaml:"byol"`
+	Family      string            `yaml:"family"`
+	Description string            `yaml:"description"`
+	Labels      map[string]string `yaml:"labels"`
+}
+
+// Source returns the file or image that the entry is imported from.
+func (e Entry) Source() string {
+	if e.SourceFile != "" {
+		return e.SourceFile
+	}
+	return e.SourceImage
+}
+
+// yamlManifest is the document of a YAML manifest.
+type yamlManifest struct {
+	Images []Entry `yaml:"images"`
+}
+
+// csvColumns are the columns that a CSV manifest's header can have. Labels
+// are KEY=VALUE pairs separated by commas, as in -labels.
+var csvColumns = map[string]func(e *Entry, value string) error{
+	"image_name":   func(e *Entry, value string) error { e.ImageName = value; return nil },
+	"source_file":  func(e *Entry, value string) error { e.SourceFile = value; return nil },
+	"source_image": func(e *Entry, value string) error { e.SourceImage = value; return nil },
+	"os":           func(e *Entry, value string) error { e.OS = value; return nil },
+	"family":       func(e *Entry, value string) error { e.Family = value; return nil },
+	"description":  func(e *Entry, value string) error { e.Description = value; return nil },
+	"data_disk":    func(e *Entry, value string) (err error) { e.DataDisk, err = parseBool(value); return err },
+	"byol":         func(e *Entry, value string) (err error) { e.BYOL, err = parseBool(value); return err },
+	"labels": func(e *Entry, value string) (err error) {
+		if value != "" {
+			e.Labels, err = param.ParseKeyValues(value)
+		}
+		return err
+	},
+}
+
+// ReadManifest reads the entries of a YAML manifest, which has a list of
+// images, or a CSV manifest, which has a header row and a row per image.
+// The format is chosen by the file's extension.
+func ReadManifest(filename string) ([]Entry, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		entries, err = parseYAML(content)
+	case ".csv":
+		entries, err = parseCSV(content)
+	default:
+		return nil, fmt.Errorf("manifest %q must be a .yaml, .yml, or .csv file", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %q: %w", filename, err)
+	}
+	if err := validateEntries(entries); err != nil {
+		return nil, fmt.Errorf("manifest %q is invalid: %w", filename, err)
+	}
+	return entries, nil
+}
+
+func parseYAML(content []byte) ([]Entry, error) {
+	var manifest yamlManifest
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&manifest); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return manifest.Images, nil
+}
+
+func parseCSV(content []byte) ([]Entry, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		if csvColumns[header[i]] == nil {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+	}
+	var entries []Entry
+	for row := 1; ; row++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var entry Entry
+		for i, value := range values {
+			if err := csvColumns[header[i]](&entry, strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("row %d: %s: %w", row, header[i], err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// validateEntries checks the arguments that are specific to manifests. The
+// other arguments are validated when each image is imported.
+func validateEntries(entries []Entry) error {
+	if len(entries) == 0 {
+		return fmt.Errorf("it doesn't have any images")
+	}
+	names := map[string]bool{}
+	for i, entry := range entries {
+		if entry.ImageName == "" {
+			return fmt.Errorf("image %d doesn't have an image_name", i+1)
+		}
+		if names[entry.ImageName] {
+			return fmt.Errorf("image_name %q is used more than once", entry.ImageName)
+		}
+		names[entry.ImageName] = true
+		if (entry.SourceFile == "") == (entry.SourceImage == "") {
+			return fmt.Errorf("image %q must have either a source_file or a source_image", entry.ImageName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package batch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeManifest writes a manifest to a new directory, which the caller
+// deletes.
+func writeManifest(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "manifest")
+	require.NoError(t, err)
+	filename := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+	return filename
+}
+
+var expectedEntries = []Entry{
+	{
+		ImageName:  "web-1",
+		SourceFile: "gs://bucket/web-1.vmdk",
+		OS:         "ubuntu-1804",
+		Labels:     map[string]string{"env": "prod", "team": "web"},
+	},
+	{
+		ImageName:   "data-1",
+		SourceImage: "projects/p/global/images/data-1",
+		DataDisk:    true,
+		Family:      "data",
+		Description: "Data disk",
+	},
+	{
+		ImageName:  "rhel-1",
+		SourceFile: "gs://bucket/rhel-1.vhd",
+		OS:         "rhel-8",
+		BYOL:       true,
+	},
+}
+
+func TestReadManifest_YAML(t *testing.T) {
+	filename := writeManifest(t, "images.yaml", `
+images:
+- image_name: web-1
+  source_file: gs://bucket/web-1.vmdk
+  os: ubuntu-1804
+  labels:
+    env: prod
+    team: web
+- image_name: data-1
+  source_image: projects/p/global/images/data-1
+  data_disk: true
+  family: data
+  description: Data disk
+- image_name: rhel-1
+  source_file: gs://bucket/rhel-1.vhd
+  os: rhel-8
+  byol: true
+`)
+	defer os.RemoveAll(filepath.Dir(filename))
+	entries, err := ReadManifest(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedEntries, entries)
+}
+
+func TestReadManifest_CSV(t *testing.T) {
+	filename := writeManifest(t, "images.CSV", `image_name, source_file, source_image, os, data_disk, byol, family, description, labels
+# Comments are ignored.
+web-1, gs://bucket/web-1.vmdk, , ubuntu-1804, , , , , "env=prod,team=web"
+data-1, , projects/p/global/images/data-1, , true, , data, Data disk,
+rhel-1, gs://bucket/rhel-1.vhd, , rhel-8, false, true, , ,
+`)
+	defer os.RemoveAll(filepath.Dir(filename))
+	entries, err := ReadManifest(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedEntries, entries)
+}
+
+func TestReadManifest_Errors(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		filename      string
+		content       string
+		expectedError string
+	}{
+		{
+			name:          "unknown extension",
+			filename:      "images.json",
+			content:       "{}",
+			expectedError: "manifest %q must be a .yaml, .yml, or .csv file",
+		},
+		{
+			name:          "unknown YAML field",
+			filename:      "images.yml",
+			content:       "images:\n- image_name: a\n  source: gs://bucket/a.vmdk\n",
+			expectedError: "failed to read manifest %q: yaml: unmarshal errors:\n  line 3: field source not found in type batch.Entry",
+		},
+		{
+			name:          "unknown CSV column",
+			filename:      "images.csv",
+			content:       "image_name,source\na,gs://bucket/a.vmdk\n",
+			expectedError: "failed to read manifest %q: unknown column \"source\"",
+		},
+		{
+			name:          "invalid CSV value",
+			filename:      "images.csv",
+			content:       "image_name,source_file,data_disk\na,gs://bucket/a.vmdk,maybe\n",
+			expectedError: "failed to read manifest %q: row 1: data_disk: strconv.ParseBool: parsing \"maybe\": invalid syntax",
+		},
+		{
+			name:          "empty",
+			filename:      "images.csv",
+			content:       "image_name,source_file\n",
+			expectedError: "manifest %q is invalid: it doesn't have any images",
+		},
+		{
+			name:          "no image name",
+			filename:      "images.csv",
+			content:       "image_name,source_file\na,gs://bucket/a.vmdk\n,gs://bucket/b.vmdk\n",
+			expectedError: "manifest %q is invalid: image 2 doesn't have an image_name",
+		},
+		{
+			name:          "duplicate image name",
+			filename:      "images.csv",
+			content:       "image_name,source_file\na,gs://bucket/a.vmdk\na,gs://bucket/b.vmdk\n",
+			expectedError: "manifest %q is invalid: image_name \"a\" is used more than once",
+		},
+		{
+			name:          "no source",
+			filename:      "images.csv",
+			content:       "image_name,source_file\na,\n",
+			expectedError: "manifest %q is invalid: image \"a\" must have either a source_file or a source_image",
+		},
+		{
+			name:          "two sources",
+			filename:      "images.csv",
+			content:       "image_name,source_file,source_image\na,gs://bucket/a.vmdk,image\n",
+			expectedError: "manifest %q is invalid: image \"a\" must have either a source_file or a source_image",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeManifest(t, tt.filename, tt.content)
+			defer os.RemoveAll(filepath.Dir(filename))
+			_, err := ReadManifest(filename)
+			assert.EqualError(t, err, fmt.Sprintf(tt.expectedError, filename))
+		})
+	}
+}
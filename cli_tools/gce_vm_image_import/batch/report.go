@@ -0,0 +1,175 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package batch
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Statuses of a Result.
+const (
+	StatusSucceeded = "SUCCEEDED"
+	StatusFailed    = "FAILED"
+)
+
+// Result is the outcome of importing a manifest entry.
+type Result struct {
+	ImageName string
+	Source    string
+	Status    string
+	Attempts  int
+	Duration  time.Duration
+	Error     string
+}
+
+// Failed returns the number of results whose import failed.
+func Failed(results []Result) int {
+	failed := 0
+	for _, r := range results {
+		if r.Status != StatusSucceeded {
+			failed++
+		}
+	}
+	return failed
+}
+
+// FormatTable returns a table of results, with a row per image.
+func FormatTable(results []Result) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tSTATUS\tATTEMPTS\tDURATION\tSOURCE\tERROR")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", r.ImageName, r.Status, r.Attempts,
+			r.Duration.Round(time.Second), r.Source, firstLine(r.Error))
+	}
+	w.Flush()
+	fmt.Fprintf(&b, "%d of %d images were imported.", len(results)-Failed(results), len(results))
+	return b.String()
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " ..."
+	}
+	return s
+}
+
+type jsonReport struct {
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Images    []jsonResult `json:"images"`
+}
+
+type jsonResult struct {
+	ImageName       string  `json:"imageName"`
+	Source          string  `json:"source"`
+	Status          string  `json:"status"`
+	Attempts        int     `json:"attempts"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// WriteJSON writes a JSON report of results.
+func WriteJSON(w io.Writer, results []Result) error {
+	report := jsonReport{
+		Succeeded: len(results) - Failed(results),
+		Failed:    Failed(results),
+		Images:    []jsonResult{},
+	}
+	for _, r := range results {
+		report.Images = append(report.Images, jsonResult{
+			ImageName:       r.ImageName,
+			Source:          r.Source,
+			Status:          r.Status,
+			Attempts:        r.Attempts,
+			DurationSeconds: r.Duration.Seconds(),
+			Error:           r.Error,
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes a JUnit XML report of results, with a test case per
+// image, so that CI systems can show the results of a migration.
+func WriteJUnit(w io.Writer, results []Result) error {
+	suite := junitTestSuite{
+		Name:     "gce_vm_image_import",
+		Tests:    len(results),
+		Failures: Failed(results),
+	}
+	var total time.Duration
+	for _, r := range results {
+		total += r.Duration
+		c := junitTestCase{
+			Name:      r.ImageName,
+			ClassName: "gce_vm_image_import",
+			Time:      junitSeconds(r.Duration),
+			SystemOut: fmt.Sprintf("source: %s\nattempts: %d", r.Source, r.Attempts),
+		}
+		if r.Status != StatusSucceeded {
+			c.Failure = &junitFailure{Message: firstLine(r.Error), Text: r.Error}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = junitSeconds(total)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
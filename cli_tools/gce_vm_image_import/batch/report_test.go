@@ -0,0 +1,80 @@
+// Copyright 2021 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package batch
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testResults = []Result{
+	{
+		ImageName: "web-1",
+		Source:    "gs://bucket/web-1.vmdk",
+		Status:    StatusSucceeded,
+		Attempts:  1,
+		Duration:  90 * time.Second,
+	},
+	{
+		ImageName: "data-1",
+		Source:    "projects/p/global/images/data-1",
+		Status:    StatusFailed,
+		Attempts:  2,
+		Duration:  1500 * time.Millisecond,
+		Error:     "Image \"data-1\" already exists\nin project p",
+	},
+}
+
+func TestFormatTable(t *testing.T) {
+	assert.Equal(t, `IMAGE   STATUS     ATTEMPTS  DURATION  SOURCE                           ERROR
+web-1   SUCCEEDED  1         1m30s     gs://bucket/web-1.vmdk           
+data-1  FAILED     2         2s        projects/p/global/images/data-1  Image "data-1" already exists ...
+1 of 2 images were imported.`, FormatTable(testResults))
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, WriteJSON(&b, testResults))
+	assert.JSONEq(t, `{
+  "succeeded": 1,
+  "failed": 1,
+  "images": [
+    {"imageName": "web-1", "source": "gs://bucket/web-1.vmdk", "status": "SUCCEEDED",
+     "attempts": 1, "durationSeconds": 90},
+    {"imageName": "data-1", "source": "projects/p/global/images/data-1", "status": "FAILED",
+     "attempts": 2, "durationSeconds": 1.5, "error": "Image \"data-1\" already exists\nin project p"}
+  ]
+}`, b.String())
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, WriteJUnit(&b, testResults))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="gce_vm_image_import" tests="2" failures="1" time="91.500">
+    <testcase name="web-1" classname="gce_vm_image_import" time="90.000">
+      <system-out>source: gs://bucket/web-1.vmdk&#xA;attempts: 1</system-out>
+    </testcase>
+    <testcase name="data-1" classname="gce_vm_image_import" time="1.500">
+      <failure message="Image &#34;data-1&#34; already exists ...">Image &#34;data-1&#34; already exists&#xA;in project p</failure>
+      <system-out>source: projects/p/global/images/data-1&#xA;attempts: 2</system-out>
+    </testcase>
+  </testsuite>
+</testsuites>
+`, b.String())
+}
@@ -36,10 +36,20 @@ type imageImportArgs struct {
 	Region        string
 	SourceFile    string
 	SourceImage   string
+	S3            importer.S3Options
+	Preview       bool
 	Started       time.Time
+	batchArgs
+	vmArgs
 	importer.ImageImportRequest
 }
 
+const (
+	manifestFlag             = "manifest"
+	maxConcurrentImportsFlag = "max_concurrent_imports"
+	retriesFlag              = "retries"
+)
+
 // parseArgsFromUser creates an imageImportArgs instance from the arguments
 // passed by the user.
 func parseArgsFromUser(argsFromUser []string) (imageImportArgs, error) {
@@ -70,13 +80,27 @@ func (args *imageImportArgs) populateAndValidate(populator param.Populator,
 		return fmt.Errorf("%s has to be specified", importer.ClientFlag)
 	}
 
+	if args.InstanceTemplate != "" && !args.isVMImport() {
+		return fmt.Errorf("-%s can only be used with -%s", importer.InstanceTemplateFlag, importer.SourceFilesFlag)
+	}
+
 	importer.FixBYOLAndOSArguments(&args.OS, &args.BYOL)
-	args.Source, err = sourceFactory.Init(args.SourceFile, args.SourceImage)
-	if err != nil {
+	fileForPopulation := args.SourceFile
+	if args.isVMImport() {
+		if err := args.initVMSources(sourceFactory); err != nil {
+			return err
+		}
+		fileForPopulation = args.Source.Path()
+	} else if args.Source, err = sourceFactory.Init(args.SourceFile, args.SourceImage); err != nil {
 		return err
 	}
+	// Remote files are copied to the scratch bucket, so they can't be used
+	// to choose its location.
+	if importer.IsRemoteSource(args.Source) {
+		fileForPopulation = ""
+	}
 	if err := populator.PopulateMissingParameters(&args.Project, args.ClientID, &args.Zone, &args.Region,
-		&args.ScratchBucketGcsPath, args.SourceFile, &args.StorageLocation); err != nil {
+		&args.ScratchBucketGcsPath, fileForPopulation, &args.StorageLocation); err != nil {
 		return err
 	}
 
@@ -172,7 +196,37 @@ func (args *imageImportArgs) registerFlags(flagSet *flag.FlagSet) {
 			"location closest to the source is chosen automatically.")
 
 	flagSet.Var((*flags.TrimmedString)(&args.SourceFile), "source_file",
-		"The Cloud Storage URI of the virtual disk file to import.")
+		"The URI of the virtual disk file to import: a Cloud Storage URI, an https:// URL, "+
+			"or an s3:// path in AWS or an S3-compatible object store. Files outside of Cloud Storage "+
+			"are copied to the scratch bucket before the import.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.S3.Endpoint), "s3_endpoint",
+		"URL of the S3-compatible object store, such as MinIO or Ceph, of an s3:// source_file. "+
+			"If not specified, AWS is used.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.S3.Region), "s3_region",
+		"Region of the bucket of an s3:// source_file. If not specified, us-east-1 is used.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.S3.AccessKeyID), "s3_access_key_id",
+		"Access key ID used to read an s3:// source_file. If not specified, the file is read anonymously.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.S3.SecretAccessKey), "s3_secret_access_key",
+		"Secret access key used to read an s3:// source_file.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.S3.SessionToken), "s3_session_token",
+		"Session token of a temporary credential used to read an s3:// source_file.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.SourceFiles), importer.SourceFilesFlag,
+		"Comma-separated URIs of the disk files of a VM with more than one disk, in the VM's disk order. "+
+			"The disk with a bootable OS is translated and its image is named -image_name; the image of "+
+			"the Nth file is named IMAGE_NAME-disk-N. Can't be used with -source_file or -source_image.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.InstanceTemplate), importer.InstanceTemplateFlag,
+		"Name of an instance template to create with the images of -"+importer.SourceFilesFlag+
+			", using -network, -subnet, and -"+importer.MachineTypeFlag+".")
+
+	flagSet.StringVar(&args.MachineType, importer.MachineTypeFlag, "n1-standard-1",
+		"Machine type of the instance template of -"+importer.InstanceTemplateFlag+".")
 
 	flagSet.Var((*flags.TrimmedString)(&args.SourceImage), "source_image",
 		"An existing Compute Engine image from which to import.")
@@ -206,4 +260,45 @@ func (args *imageImportArgs) registerFlags(flagSet *flag.FlagSet) {
 
 	flagSet.BoolVar(&args.SysprepWindows, "sysprep_windows", false,
 		"Generalize image using Windows Sysprep. Only applicable to Windows.")
+
+	flagSet.BoolVar(&args.InspectHeaders, "inspect_headers", false,
+		"Inspect the source file by parsing its header with ranged reads from Cloud Storage, "+
+			"instead of with qemu-img and gcsfuse.")
+
+	flagSet.BoolVar(&args.VerifyIntegrity, importer.VerifyIntegrityFlag, false,
+		"Compare the imported disk with the source file on a worker instance, and fail the import "+
+			"when their SHA-256 hashes differ. The image is labelled with the hash, and a provenance "+
+			"record of the import is written to Cloud Storage.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.ProvenanceGcsPath), importer.ProvenanceGcsPathFlag,
+		"Cloud Storage path of the provenance record written by -"+importer.VerifyIntegrityFlag+". If not specified, "+
+			"gs://SCRATCH_BUCKET/gce-image-import-provenance/IMAGE_NAME.json is used.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.ProvenanceSigningKey), importer.ProvenanceSigningKeyFlag,
+		"PEM file of a PKCS #8 private key (ECDSA, Ed25519, or RSA) that signs the provenance record. "+
+			"If not specified, the record isn't signed.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.Manifest), manifestFlag,
+		"A YAML or CSV file of images to import. Each image has an image_name, and either a source_file "+
+			"or a source_image, and can override os, data_disk, byol, family, description, and labels. "+
+			"The other flags apply to all of the images.")
+
+	flagSet.IntVar(&args.MaxConcurrentImports, maxConcurrentImportsFlag, 4,
+		"The number of images of -"+manifestFlag+" that are imported at the same time.")
+
+	flagSet.IntVar(&args.Retries, retriesFlag, 1,
+		"The number of times that an import of -"+manifestFlag+" that failed with a transient error is retried.")
+
+	flagSet.DurationVar(&args.RetryDelay, "retry_delay", time.Minute,
+		"The time to wait before retrying a failed import of -"+manifestFlag+".")
+
+	flagSet.Var((*flags.TrimmedString)(&args.ReportJSON), "report_json",
+		"A file where the JSON report of the imports of -"+manifestFlag+" is written.")
+
+	flagSet.Var((*flags.TrimmedString)(&args.ReportJUnit), "report_junit",
+		"A file where the JUnit XML report of the imports of -"+manifestFlag+" is written.")
+
+	flagSet.BoolVar(&args.Preview, "preview", false,
+		"Report the detected file format, disk size, inflation method, translation workflow, "+
+			"licenses, and guest OS features, and exit without creating any resources.")
 }
@@ -17,6 +17,8 @@ package cli
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -141,6 +143,21 @@ func Test_populateAndValidate_TrimsSourceFile(t *testing.T) {
 		t, "-source_file", " gs://bucket/image.vmdk ").SourceFile)
 }
 
+func Test_populateAndValidate_TrimsS3Options(t *testing.T) {
+	assert.Equal(t, importer.S3Options{
+		Endpoint:        "https://minio.example.com:9000",
+		Region:          "eu-west-1",
+		AccessKeyID:     "key-id",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+	}, parseAndPopulate(t,
+		"-s3_endpoint", " https://minio.example.com:9000 ",
+		"-s3_region", " eu-west-1 ",
+		"-s3_access_key_id", " key-id ",
+		"-s3_secret_access_key", " secret ",
+		"-s3_session_token", " token ").S3)
+}
+
 func Test_populateAndValidate_TrimsSourceImage(t *testing.T) {
 	assert.Equal(t, "path/source-image", parseAndPopulate(
 		t, "-source_image", "  path/source-image  ").SourceImage)
@@ -164,6 +181,41 @@ func Test_populateAndValidate_SupportsDataDisk(t *testing.T) {
 	assert.True(t, parseAndPopulate(t, "-data_disk").DataDisk)
 }
 
+func Test_populateAndValidate_SupportsPreview(t *testing.T) {
+	assert.False(t, parseAndPopulate(t).Preview)
+	assert.False(t, parseAndPopulate(t, "-preview=false").Preview)
+	assert.True(t, parseAndPopulate(t, "-preview").Preview)
+}
+
+func Test_populateAndValidate_SupportsIntegrityVerification(t *testing.T) {
+	assert.False(t, parseAndPopulate(t).VerifyIntegrity)
+	actual := parseAndPopulate(t, "-verify_integrity",
+		"-provenance_gcs_path", " gs://bucket/provenance.json ",
+		"-provenance_signing_key", " key.pem ")
+	assert.True(t, actual.VerifyIntegrity)
+	assert.Equal(t, "gs://bucket/provenance.json", actual.ProvenanceGcsPath)
+	assert.Equal(t, "key.pem", actual.ProvenanceSigningKey)
+}
+
+func Test_parseArgsFromUser_SupportsManifest(t *testing.T) {
+	actual, err := parseArgsFromUser([]string{"-client_id=pantheon", "-manifest", " images.yaml ",
+		"-max_concurrent_imports=8", "-retries=3", "-retry_delay=5s",
+		"-report_json", " report.json ", "-report_junit", " report.xml "})
+	assert.NoError(t, err)
+	assert.Equal(t, "images.yaml", actual.Manifest)
+	assert.Equal(t, 8, actual.MaxConcurrentImports)
+	assert.Equal(t, 3, actual.Retries)
+	assert.Equal(t, 5*time.Second, actual.RetryDelay)
+	assert.Equal(t, "report.json", actual.ReportJSON)
+	assert.Equal(t, "report.xml", actual.ReportJUnit)
+
+	actual, err = parseArgsFromUser([]string{"-client_id=pantheon", "-manifest=images.yaml"})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, actual.MaxConcurrentImports)
+	assert.Equal(t, 1, actual.Retries)
+	assert.Equal(t, time.Minute, actual.RetryDelay)
+}
+
 func Test_populateAndValidate_DefaultsBYOLToFalse(t *testing.T) {
 	assert.False(t, parseAndPopulate(t).BYOL)
 }
@@ -364,6 +416,27 @@ func Test_populateAndValidate_CreatesSourceObjectFromSourceFile(t *testing.T) {
 	assert.Equal(t, "gs://path/file", actual.Source.Path())
 }
 
+func Test_populateAndValidate_DoesntPopulateFromRemoteSourceFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("disk content"))
+	}))
+	defer srv.Close()
+
+	args := []string{"-source_file", srv.URL + "/disk.vmdk", "-image_name=i", "-client_id=c", "-data_disk"}
+	actual, err := parseArgsFromUser(args)
+	assert.NoError(t, err)
+	err = actual.populateAndValidate(mockPopulator{
+		zone:          "us-west2-a",
+		region:        "us-west2",
+		scratchBucket: "gs://custom-bucket/",
+		expectedFile:  "",
+		t:             t,
+	}, importer.NewSourceFactory(nil))
+	assert.NoError(t, err)
+	assert.True(t, importer.IsRemoteSource(actual.Source))
+	assert.Equal(t, srv.URL+"/disk.vmdk", actual.Source.Path())
+}
+
 func Test_populateAndValidate_FailsWhenSourceValidateFails(t *testing.T) {
 	args := []string{"-image_name=i", "-client_id=c", "-data_disk"}
 	actual, err := parseArgsFromUser(args)
@@ -421,12 +494,18 @@ type mockPopulator struct {
 	scratchBucket   string
 	storageLocation string
 	err             error
+	// Skip verification of the file unless t is provided.
+	expectedFile string
+	t            *testing.T
 }
 
 func (m mockPopulator) PopulateMissingParameters(project *string, client string, zone *string, region *string, scratchBucketGcsPath *string, file string, storageLocation *string) error {
 	if m.err != nil {
 		return m.err
 	}
+	if m.t != nil {
+		assert.Equal(m.t, m.expectedFile, file)
+	}
 	if *project == "" {
 		*project = m.project
 	}
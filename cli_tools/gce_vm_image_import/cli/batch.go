@@ -0,0 +1,196 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/image/importer"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/param"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_vm_image_import/batch"
+	daisycompute "github.com/GoogleCloudPlatform/compute-image-tools/daisy/compute"
+)
+
+// batchArgs are the arguments of importing the images of a manifest.
+type batchArgs struct {
+	Manifest    string
+	ReportJSON  string
+	ReportJUnit string
+	batch.Options
+}
+
+// validateBatchArgs checks that the arguments of a single image weren't
+// used with -manifest, since the manifest has them.
+func (args *imageImportArgs) validateBatchArgs() error {
+	for _, arg := range []struct{ flag, value string }{
+		{importer.ImageFlag, args.ImageName},
+		{"source_file", args.SourceFile},
+		{"source_image", args.SourceImage},
+	} {
+		if arg.value != "" {
+			return fmt.Errorf("-%s can't be used with -%s; set it in the manifest", arg.flag, manifestFlag)
+		}
+	}
+	if args.SourceFiles != "" {
+		return fmt.Errorf("-%s can't be used with -%s", importer.SourceFilesFlag, manifestFlag)
+	}
+	// The provenance records of the images would overwrite each other.
+	if args.ProvenanceGcsPath != "" {
+		return fmt.Errorf("-%s can't be used with -%s", importer.ProvenanceGcsPathFlag, manifestFlag)
+	}
+	if args.Preview {
+		return fmt.Errorf("-preview can't be used with -%s", manifestFlag)
+	}
+	if args.MaxConcurrentImports < 1 {
+		return fmt.Errorf("-%s must be at least 1", maxConcurrentImportsFlag)
+	}
+	if args.Retries < 0 {
+		return fmt.Errorf("-%s can't be negative", retriesFlag)
+	}
+	return nil
+}
+
+// forEntry returns the arguments of importing entry. The manifest's values
+// are used instead of the command line's, and labels are merged.
+func (args imageImportArgs) forEntry(entry batch.Entry) imageImportArgs {
+	args.ImageName = entry.ImageName
+	args.SourceFile = entry.SourceFile
+	args.SourceImage = entry.SourceImage
+	if entry.OS != "" {
+		args.OS = entry.OS
+	}
+	args.DataDisk = args.DataDisk || entry.DataDisk
+	args.BYOL = args.BYOL || entry.BYOL
+	if entry.Family != "" {
+		args.Family = entry.Family
+	}
+	if entry.Description != "" {
+		args.Description = entry.Description
+	}
+	labels := map[string]string{}
+	for k, v := range args.Labels {
+		labels[k] = v
+	}
+	for k, v := range entry.Labels {
+		labels[k] = v
+	}
+	args.Labels = labels
+	// Each import has its own execution ID and start time, so that their
+	// resources and logs don't collide.
+	args.ExecutionID = ""
+	args.Started = time.Time{}
+	return args
+}
+
+// entryImporter imports a manifest entry in the same way as an import of a
+// single image.
+type entryImporter struct {
+	args          imageImportArgs
+	populator     param.Populator
+	computeClient daisycompute.Client
+	storageClient domain.StorageClientInterface
+
+	// populateMutex serializes population, since it can create the scratch
+	// bucket that's shared by the imports.
+	populateMutex sync.Mutex
+}
+
+func (i *entryImporter) Import(ctx context.Context, entry batch.Entry, logger logging.Logger) error {
+	args := i.args.forEntry(entry)
+	if err := i.populate(&args); err != nil {
+		return err
+	}
+	var err error
+	var deleteStaged func()
+	args.Source, deleteStaged, err = stageSource(ctx, args.Source, i.storageClient, args.ScratchBucketGcsPath, logger)
+	if err != nil {
+		return err
+	}
+	defer deleteStaged()
+	imageImporter, err := importer.NewImporter(args.ImageImportRequest, i.computeClient, i.storageClient, logger)
+	if err != nil {
+		return err
+	}
+	return userFriendlyError(imageImporter.Run(ctx), args)
+}
+
+func (i *entryImporter) populate(args *imageImportArgs) error {
+	i.populateMutex.Lock()
+	defer i.populateMutex.Unlock()
+	return args.populateAndValidate(i.populator, importer.NewSourceFactoryWithS3(i.storageClient, args.S3))
+}
+
+// runBatch imports the images of the manifest, writes their results, and
+// fails when any of them failed.
+func runBatch(ctx context.Context, importArgs imageImportArgs, populator param.Populator,
+	computeClient daisycompute.Client, storageClient domain.StorageClientInterface, toolLogger logging.ToolLogger) error {
+	if err := importArgs.validateBatchArgs(); err != nil {
+		toolLogger.User(err.Error())
+		return err
+	}
+	entries, err := batch.ReadManifest(importArgs.Manifest)
+	if err != nil {
+		toolLogger.User(err.Error())
+		return err
+	}
+	toolLogger.User(fmt.Sprintf("Importing %d images, %d at a time.", len(entries), importArgs.MaxConcurrentImports))
+	results := batch.Run(ctx, entries, &entryImporter{
+		args:          importArgs,
+		populator:     populator,
+		computeClient: computeClient,
+		storageClient: storageClient,
+	}, importArgs.Options, toolLogger)
+	toolLogger.User("Import results:\n" + batch.FormatTable(results))
+
+	for _, report := range []struct {
+		filename string
+		write    func(io.Writer, []batch.Result) error
+	}{
+		{importArgs.ReportJSON, batch.WriteJSON},
+		{importArgs.ReportJUnit, batch.WriteJUnit},
+	} {
+		if report.filename == "" {
+			continue
+		}
+		if err := writeReport(report.filename, results, report.write); err != nil {
+			toolLogger.User(fmt.Sprintf("Failed to write report %q: %v", report.filename, err))
+			return err
+		}
+	}
+
+	if failed := batch.Failed(results); failed > 0 {
+		return fmt.Errorf("%d of %d images failed to import", failed, len(results))
+	}
+	return nil
+}
+
+func writeReport(filename string, results []batch.Result, write func(io.Writer, []batch.Result) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(f, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
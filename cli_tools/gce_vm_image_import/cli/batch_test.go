@@ -0,0 +1,95 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/gce_vm_image_import/batch"
+)
+
+func Test_validateBatchArgs(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		args          []string
+		expectedError string
+	}{
+		{"valid", []string{"-verify_integrity"}, ""},
+		{"image name", []string{"-image_name=image"}, "-image_name can't be used with -manifest; set it in the manifest"},
+		{"source file", []string{"-source_file=gs://bucket/disk.vmdk"}, "-source_file can't be used with -manifest; set it in the manifest"},
+		{"source image", []string{"-source_image=image"}, "-source_image can't be used with -manifest; set it in the manifest"},
+		{"provenance path", []string{"-verify_integrity", "-provenance_gcs_path=gs://bucket/p.json"}, "-provenance_gcs_path can't be used with -manifest"},
+		{"preview", []string{"-preview"}, "-preview can't be used with -manifest"},
+		{"no workers", []string{"-max_concurrent_imports=0"}, "-max_concurrent_imports must be at least 1"},
+		{"negative retries", []string{"-retries=-1"}, "-retries can't be negative"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := parseArgsFromUser(append([]string{"-client_id=pantheon", "-manifest=images.csv"}, tt.args...))
+			require.NoError(t, err)
+			err = args.validateBatchArgs()
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedError)
+			}
+		})
+	}
+}
+
+func Test_forEntry_OverridesCommandLine(t *testing.T) {
+	args, err := parseArgsFromUser([]string{"-client_id=pantheon", "-manifest=images.csv",
+		"-os=ubuntu-1804", "-family=linux", "-description=migrated", "-labels=env=prod,team=db",
+		"-execution_id=abc", "-zone=us-west2-a"})
+	require.NoError(t, err)
+	args.Started = time.Now()
+
+	actual := args.forEntry(batch.Entry{
+		ImageName:  "web-1",
+		SourceFile: "gs://bucket/web-1.vmdk",
+		OS:         "centos-7",
+		BYOL:       true,
+		Labels:     map[string]string{"team": "web", "app": "nginx"},
+	})
+	assert.Equal(t, "web-1", actual.ImageName)
+	assert.Equal(t, "gs://bucket/web-1.vmdk", actual.SourceFile)
+	assert.Equal(t, "centos-7", actual.OS)
+	assert.True(t, actual.BYOL)
+	assert.Equal(t, "linux", actual.Family)
+	assert.Equal(t, "migrated", actual.Description)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "web", "app": "nginx"}, actual.Labels)
+	assert.Equal(t, "us-west2-a", actual.Zone)
+	assert.Empty(t, actual.ExecutionID)
+	assert.True(t, actual.Started.IsZero())
+
+	// The command line's arguments aren't modified.
+	assert.Equal(t, map[string]string{"env": "prod", "team": "db"}, args.Labels)
+	assert.Equal(t, "abc", args.ExecutionID)
+}
+
+func Test_forEntry_UsesCommandLineDefaults(t *testing.T) {
+	args, err := parseArgsFromUser([]string{"-client_id=pantheon", "-manifest=images.csv",
+		"-data_disk", "-family=data"})
+	require.NoError(t, err)
+
+	actual := args.forEntry(batch.Entry{ImageName: "data-1", SourceImage: "projects/p/global/images/data-1"})
+	assert.Equal(t, "projects/p/global/images/data-1", actual.SourceImage)
+	assert.True(t, actual.DataDisk)
+	assert.Equal(t, "data", actual.Family)
+	assert.Empty(t, actual.Labels)
+}
@@ -17,10 +17,12 @@ package cli
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
 	"strings"
 
 	"google.golang.org/api/option"
 
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/image/importer"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/compute"
 	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
@@ -47,6 +49,7 @@ func Main(args []string, toolLogger logging.ToolLogger, workflowDir string) erro
 		return err
 	}
 	importArgs.WorkflowDir = workflowDir
+	importArgs.ToolVersion = toolVersion()
 
 	// 2. Setup dependencies.
 	storageClient, err := storage.NewStorageClient(
@@ -63,22 +66,63 @@ func Main(args []string, toolLogger logging.ToolLogger, workflowDir string) erro
 		return err
 	}
 	metadataGCE := &compute.MetadataGCE{}
+	var scratchBucketCreator domain.ScratchBucketCreatorInterface = storage.NewScratchBucketCreator(ctx, storageClient)
+	if importArgs.Preview {
+		scratchBucketCreator = storage.NewDryRunScratchBucketCreator(ctx, storageClient)
+	}
 	paramPopulator := param.NewPopulator(
 		metadataGCE,
 		storageClient,
 		storage.NewResourceLocationRetriever(metadataGCE, computeClient),
-		storage.NewScratchBucketCreator(ctx, storageClient),
+		scratchBucketCreator,
 	)
 
+	if importArgs.Manifest != "" {
+		return runBatch(ctx, importArgs, paramPopulator, computeClient, storageClient, toolLogger)
+	}
+
 	// 3. Populate missing arguments.
-	err = importArgs.populateAndValidate(paramPopulator, importer.NewSourceFactory(storageClient))
+	err = importArgs.populateAndValidate(paramPopulator, importer.NewSourceFactoryWithS3(storageClient, importArgs.S3))
+	if err != nil {
+		logFailure(importArgs, err)
+		return err
+	}
+
+	if importArgs.Preview {
+		preview, err := importer.PreviewImport(ctx, importArgs.ImageImportRequest,
+			importer.NewFileInspector(importArgs.ImageImportRequest, storageClient), toolLogger)
+		if err != nil {
+			toolLogger.User(err.Error())
+			return err
+		}
+		toolLogger.User("Import preview; no resources were created.\n" + preview.String())
+		return nil
+	}
+
+	// Copy files from outside of Cloud Storage to the scratch bucket. The
+	// copies are deleted once the import finished, whether it succeeded or not.
+	var deleteStaged func()
+	if importArgs.isVMImport() {
+		deleteStaged, err = importArgs.stageVMSources(ctx, storageClient, toolLogger)
+	} else {
+		importArgs.Source, deleteStaged, err = stageSource(ctx, importArgs.Source, storageClient,
+			importArgs.ScratchBucketGcsPath, toolLogger)
+	}
+	if deleteStaged != nil {
+		defer deleteStaged()
+	}
 	if err != nil {
 		logFailure(importArgs, err)
 		return err
 	}
 
 	// Run the import.
-	importRunner, err := importer.NewImporter(importArgs.ImageImportRequest, computeClient, storageClient, toolLogger)
+	var importRunner importer.Importer
+	if importArgs.isVMImport() {
+		importRunner, err = importer.NewVMImporter(importArgs.vmImportRequest(), computeClient, storageClient, toolLogger)
+	} else {
+		importRunner, err = importer.NewImporter(importArgs.ImageImportRequest, computeClient, storageClient, toolLogger)
+	}
 	if err != nil {
 		logFailure(importArgs, err)
 		return err
@@ -97,6 +141,44 @@ func Main(args []string, toolLogger logging.ToolLogger, workflowDir string) erro
 	return nil
 }
 
+// toolVersion returns the version of the module that the tool was built from.
+func toolVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// stagingDir returns the directory that remote source files are copied to.
+// It's shared by all imports using the scratch bucket, so that a failed
+// copy can be resumed by the next import of the same file.
+func stagingDir(scratchBucketGcsPath string) string {
+	bucket, err := storage.GetBucketNameFromGCSPath(scratchBucketGcsPath)
+	if err != nil {
+		return scratchBucketGcsPath
+	}
+	return fmt.Sprintf("gs://%s/gce-image-import-staging", bucket)
+}
+
+// stageSource copies source to the staging directory of the scratch bucket if
+// it's outside of Cloud Storage. It returns the source to import and a
+// function that deletes the copy.
+func stageSource(ctx context.Context, source importer.Source, storageClient domain.StorageClientInterface,
+	scratchBucketGcsPath string, logger logging.Logger) (importer.Source, func(), error) {
+	if !importer.IsRemoteSource(source) {
+		return source, func() {}, nil
+	}
+	staged, err := importer.StageSource(ctx, source, storageClient, stagingDir(scratchBucketGcsPath), logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return staged, func() {
+		if err := storageClient.DeleteObject(staged.Path()); err != nil {
+			logger.User(fmt.Sprintf("Failed to delete the copy of %v at %v: %v", source.Path(), staged.Path(), err))
+		}
+	}, nil
+}
+
 func userFriendlyError(err error, importArgs imageImportArgs) error {
 	if err == nil {
 		return err
@@ -0,0 +1,102 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/domain"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/image/importer"
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/utils/logging"
+)
+
+// vmArgs are the arguments of importing the disks of a VM.
+type vmArgs struct {
+	// SourceFiles is a comma-separated list of the VM's disk files.
+	SourceFiles      string
+	Sources          []importer.Source
+	InstanceTemplate string
+	MachineType      string
+}
+
+// isVMImport returns whether the disks of a VM are imported, rather than a
+// single disk.
+func (args *imageImportArgs) isVMImport() bool {
+	return args.SourceFiles != ""
+}
+
+// initVMSources validates the arguments of a VM import, and initializes the
+// source of each of its files. Source is set to the first disk's, so that
+// the arguments are populated in the same way as for a single disk.
+func (args *imageImportArgs) initVMSources(sourceFactory importer.SourceFactory) error {
+	if args.SourceFile != "" || args.SourceImage != "" {
+		return fmt.Errorf("-%s can't be used with -source_file or -source_image", importer.SourceFilesFlag)
+	}
+	if args.Preview {
+		return fmt.Errorf("-preview can't be used with -%s", importer.SourceFilesFlag)
+	}
+	args.Sources = nil
+	for _, file := range strings.Split(args.SourceFiles, ",") {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+		source, err := sourceFactory.Init(file, "")
+		if err != nil {
+			return err
+		}
+		args.Sources = append(args.Sources, source)
+	}
+	if len(args.Sources) == 0 {
+		return fmt.Errorf("-%s must have at least one file", importer.SourceFilesFlag)
+	}
+	args.Source = args.Sources[0]
+	return nil
+}
+
+// vmImportRequest returns the request of importing the VM's disks.
+func (args imageImportArgs) vmImportRequest() importer.VMImportRequest {
+	return importer.VMImportRequest{
+		ImageImportRequest: args.ImageImportRequest,
+		Sources:            args.Sources,
+		InstanceTemplate:   args.InstanceTemplate,
+		MachineType:        args.MachineType,
+	}
+}
+
+// stageVMSources copies the VM's files from outside of Cloud Storage to the
+// scratch bucket. The returned function deletes the copies, including those
+// made before staging failed.
+func (args *imageImportArgs) stageVMSources(ctx context.Context, storageClient domain.StorageClientInterface,
+	logger logging.Logger) (func(), error) {
+	var deletes []func()
+	deleteAll := func() {
+		for _, d := range deletes {
+			d()
+		}
+	}
+	for i, source := range args.Sources {
+		staged, deleteStaged, err := stageSource(ctx, source, storageClient, args.ScratchBucketGcsPath, logger)
+		if err != nil {
+			return deleteAll, err
+		}
+		deletes = append(deletes, deleteStaged)
+		args.Sources[i] = staged
+	}
+	args.Source = args.Sources[0]
+	return deleteAll, nil
+}
@@ -0,0 +1,110 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/cli_tools/common/image/importer"
+)
+
+func Test_populateAndValidate_CreatesSourcesFromSourceFiles(t *testing.T) {
+	actual := addRequiredArgsAndParse(t, "-source_files", " gs://bucket/disk1.vmdk, gs://bucket/disk2.vmdk ,",
+		"-instance_template=template")
+	err := actual.populateAndValidate(mockPopulator{
+		zone:          "us-west2-a",
+		region:        "us-west2",
+		scratchBucket: "gs://custom-bucket/",
+		expectedFile:  "gs://bucket/disk1.vmdk",
+		t:             t,
+	}, fileSourceFactory{})
+	assert.NoError(t, err)
+	assert.True(t, actual.isVMImport())
+	assert.Equal(t, []importer.Source{
+		mockSource{sourcePath: "gs://bucket/disk1.vmdk"},
+		mockSource{sourcePath: "gs://bucket/disk2.vmdk"},
+	}, actual.Sources)
+	assert.Equal(t, actual.Sources[0], actual.Source)
+
+	request := actual.vmImportRequest()
+	assert.Equal(t, actual.Sources, request.Sources)
+	assert.Equal(t, "template", request.InstanceTemplate)
+	assert.Equal(t, "n1-standard-1", request.MachineType)
+	assert.Equal(t, actual.ImageImportRequest, request.ImageImportRequest)
+}
+
+func Test_populateAndValidate_SupportsMachineType(t *testing.T) {
+	actual := addRequiredArgsAndParse(t, "-source_files=gs://bucket/disk1.vmdk", "-machine_type=e2-standard-4")
+	assert.Equal(t, "e2-standard-4", actual.MachineType)
+}
+
+func Test_populateAndValidate_FailsWithInvalidVMArguments(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		args          []string
+		expectedError string
+	}{
+		{
+			name:          "source_file",
+			args:          []string{"-source_files=gs://bucket/disk1.vmdk", "-source_file=gs://bucket/disk.vmdk"},
+			expectedError: "-source_files can't be used with -source_file or -source_image",
+		},
+		{
+			name:          "source_image",
+			args:          []string{"-source_files=gs://bucket/disk1.vmdk", "-source_image=image"},
+			expectedError: "-source_files can't be used with -source_file or -source_image",
+		},
+		{
+			name:          "preview",
+			args:          []string{"-source_files=gs://bucket/disk1.vmdk", "-preview"},
+			expectedError: "-preview can't be used with -source_files",
+		},
+		{
+			name:          "no files",
+			args:          []string{"-source_files= , "},
+			expectedError: "-source_files must have at least one file",
+		},
+		{
+			name:          "template without files",
+			args:          []string{"-source_file=gs://bucket/disk.vmdk", "-instance_template=template"},
+			expectedError: "-instance_template can only be used with -source_files",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := addRequiredArgsAndParse(t, tt.args...)
+			err := actual.populateAndValidate(mockPopulator{}, fileSourceFactory{})
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
+
+func Test_validateBatchArgs_RejectsSourceFiles(t *testing.T) {
+	actual := addRequiredArgsAndParse(t, "-manifest=images.yaml", "-source_files=gs://bucket/disk1.vmdk")
+	actual.ImageName = ""
+	assert.EqualError(t, actual.validateBatchArgs(),
+		"-source_files can't be used with -manifest")
+}
+
+// fileSourceFactory is a SourceFactory that returns a mockSource for each file.
+type fileSourceFactory struct{}
+
+func (fileSourceFactory) Init(sourceFile, sourceImage string) (importer.Source, error) {
+	if sourceFile != "" {
+		return mockSource{sourcePath: sourceFile}, nil
+	}
+	return mockSource{sourcePath: sourceImage}, nil
+}
@@ -294,6 +294,20 @@ func (mr *MockClientMockRecorder) CreateInstanceBeta(arg0, arg1, arg2 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInstanceBeta", reflect.TypeOf((*MockClient)(nil).CreateInstanceBeta), arg0, arg1, arg2)
 }
 
+// CreateInstanceTemplate mocks base method.
+func (m *MockClient) CreateInstanceTemplate(arg0 string, arg1 *compute2.InstanceTemplate) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateInstanceTemplate", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateInstanceTemplate indicates an expected call of CreateInstanceTemplate.
+func (mr *MockClientMockRecorder) CreateInstanceTemplate(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInstanceTemplate", reflect.TypeOf((*MockClient)(nil).CreateInstanceTemplate), arg0, arg1)
+}
+
 // CreateMachineImage mocks base method.
 func (m *MockClient) CreateMachineImage(arg0 string, arg1 *compute1.MachineImage) error {
 	m.ctrl.T.Helper()
@@ -741,6 +755,21 @@ func (mr *MockClientMockRecorder) GetInstanceBeta(arg0, arg1, arg2 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInstanceBeta", reflect.TypeOf((*MockClient)(nil).GetInstanceBeta), arg0, arg1, arg2)
 }
 
+// GetInstanceTemplate mocks base method.
+func (m *MockClient) GetInstanceTemplate(arg0, arg1 string) (*compute2.InstanceTemplate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInstanceTemplate", arg0, arg1)
+	ret0, _ := ret[0].(*compute2.InstanceTemplate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInstanceTemplate indicates an expected call of GetInstanceTemplate.
+func (mr *MockClientMockRecorder) GetInstanceTemplate(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInstanceTemplate", reflect.TypeOf((*MockClient)(nil).GetInstanceTemplate), arg0, arg1)
+}
+
 // GetLicense mocks base method.
 func (m *MockClient) GetLicense(arg0, arg1 string) (*compute2.License, error) {
 	m.ctrl.T.Helper()
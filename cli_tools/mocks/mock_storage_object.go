@@ -127,6 +127,21 @@ func (mr *MockStorageObjectMockRecorder) NewReader() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewReader", reflect.TypeOf((*MockStorageObject)(nil).NewReader))
 }
 
+// NewRangeReader mocks base method.
+func (m *MockStorageObject) NewRangeReader(arg0, arg1 int64) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewRangeReader", arg0, arg1)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewRangeReader indicates an expected call of NewRangeReader.
+func (mr *MockStorageObjectMockRecorder) NewRangeReader(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewRangeReader", reflect.TypeOf((*MockStorageObject)(nil).NewRangeReader), arg0, arg1)
+}
+
 // NewWriter mocks base method.
 func (m *MockStorageObject) NewWriter() io.WriteCloser {
 	m.ctrl.T.Helper()
@@ -0,0 +1,290 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// ResourceBudget limits the resources requested by the steps running at the
+// same time. A step whose request doesn't fit in what is left of the budget
+// waits for running steps to finish. Zero values mean no limit.
+type ResourceBudget struct {
+	// Total vCPUs of the instances created by running steps.
+	VCPUs int64 `json:",omitempty"`
+	// Total size in GB of the disks created by running steps, including the
+	// disks created along with instances. Disks without an explicit size,
+	// e.g. sized by their source image, are not counted.
+	DiskGb int64 `json:",omitempty"`
+}
+
+// resourceDemand is what a step requests from a ResourceBudget.
+type resourceDemand struct {
+	vcpus, diskGb int64
+}
+
+func (d resourceDemand) add(o resourceDemand) resourceDemand {
+	return resourceDemand{vcpus: d.vcpus + o.vcpus, diskGb: d.diskGb + o.diskGb}
+}
+
+func (d resourceDemand) sub(o resourceDemand) resourceDemand {
+	return resourceDemand{vcpus: d.vcpus - o.vcpus, diskGb: d.diskGb - o.diskGb}
+}
+
+func (d resourceDemand) isZero() bool {
+	return d.vcpus == 0 && d.diskGb == 0
+}
+
+// exceeds returns true if d doesn't fit in an otherwise unused budget b.
+func (d resourceDemand) exceeds(b *ResourceBudget) bool {
+	return (b.VCPUs > 0 && d.vcpus > b.VCPUs) || (b.DiskGb > 0 && d.diskGb > b.DiskGb)
+}
+
+var machineTypeCPUsRgx = regexp.MustCompile(`(?:^custom-|-custom-|-)(\d+)(?:-\d+(?:-ext)?)?$`)
+
+// sharedCoreMachineTypeCPUs are the vCPUs of the machine types whose name
+// doesn't end with their number of vCPUs.
+var sharedCoreMachineTypeCPUs = map[string]int64{
+	"e2-micro":  2,
+	"e2-small":  2,
+	"e2-medium": 2,
+	"f1-micro":  1,
+	"g1-small":  1,
+}
+
+// machineTypeCPUs returns the vCPUs of a machine type, using the machine types
+// looked up during validation and falling back to the type's name.
+func (w *Workflow) machineTypeCPUs(link string) (int64, DError) {
+	m := NamedSubexp(machineTypeURLRegex, link)
+	if m == nil {
+		return 0, Errf("cannot get vCPUs of machine type %q: not a machine type URL", link)
+	}
+	w.machineTypeCache.mu.Lock()
+	mt, ok := w.machineTypeCache.exists[m["project"]][m["zone"]][m["machinetype"]].(*compute.MachineType)
+	w.machineTypeCache.mu.Unlock()
+	if ok && mt.GuestCpus > 0 {
+		return mt.GuestCpus, nil
+	}
+	if n, ok := sharedCoreMachineTypeCPUs[m["machinetype"]]; ok {
+		return n, nil
+	}
+	// e.g. n1-standard-4, n2-custom-8-16384, custom-2-13312-ext.
+	if match := machineTypeCPUsRgx.FindStringSubmatch(m["machinetype"]); match != nil {
+		if n, err := strconv.ParseInt(match[1], 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, Errf("cannot get vCPUs of unknown machine type %q", m["machinetype"])
+}
+
+// resourceDemand returns what s requests from a ResourceBudget. Steps
+// nested in s are included; steps of included and sub workflows are not, as
+// they are scheduled by their own workflow.
+func (s *Step) resourceDemand() (resourceDemand, DError) {
+	var d resourceDemand
+	if s.CreateDisks != nil {
+		for _, cd := range *s.CreateDisks {
+			d.diskGb += cd.Disk.SizeGb
+		}
+	}
+	if s.CreateInstances != nil {
+		for _, i := range s.CreateInstances.Instances {
+			cpus, err := s.w.machineTypeCPUs(i.MachineType)
+			if err != nil {
+				return d, err
+			}
+			d.vcpus += cpus
+			for _, ad := range i.Disks {
+				if ad.InitializeParams != nil {
+					d.diskGb += ad.InitializeParams.DiskSizeGb
+				}
+			}
+		}
+		for _, i := range s.CreateInstances.InstancesBeta {
+			cpus, err := s.w.machineTypeCPUs(i.MachineType)
+			if err != nil {
+				return d, err
+			}
+			d.vcpus += cpus
+			for _, ad := range i.Disks {
+				if ad.InitializeParams != nil {
+					d.diskGb += ad.InitializeParams.DiskSizeGb
+				}
+			}
+		}
+	}
+	for _, n := range s.nestedSteps() {
+		if n.w == nil {
+			n.w = s.w
+		}
+		nd, err := n.resourceDemand()
+		if err != nil {
+			return d, err
+		}
+		d = d.add(nd)
+	}
+	return d, nil
+}
+
+// budgetPool tracks the use of a ResourceBudget. Steps waiting for the pool
+// are started in the order they asked for it.
+type budgetPool struct {
+	budget  *ResourceBudget
+	used    resourceDemand
+	waiters []*budgetWaiter
+	mx      sync.Mutex
+}
+
+type budgetWaiter struct {
+	demand resourceDemand
+	ready  chan struct{}
+}
+
+func (p *budgetPool) fits(d resourceDemand) bool {
+	return !p.used.add(d).exceeds(p.budget)
+}
+
+// acquire waits until d fits in the pool and takes it. It returns false if
+// cancel is closed first.
+func (p *budgetPool) acquire(d resourceDemand, cancel <-chan struct{}) bool {
+	p.mx.Lock()
+	if len(p.waiters) == 0 && p.fits(d) {
+		p.used = p.used.add(d)
+		p.mx.Unlock()
+		return true
+	}
+	bw := &budgetWaiter{demand: d, ready: make(chan struct{})}
+	p.waiters = append(p.waiters, bw)
+	p.mx.Unlock()
+
+	select {
+	case <-bw.ready:
+		return true
+	case <-cancel:
+	}
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	for i, w := range p.waiters {
+		if w == bw {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			p.grant()
+			return false
+		}
+	}
+	// Granted while canceling, give it back.
+	p.used = p.used.sub(d)
+	p.grant()
+	return false
+}
+
+// release gives d back to the pool and starts the waiters that now fit.
+func (p *budgetPool) release(d resourceDemand) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.used = p.used.sub(d)
+	p.grant()
+}
+
+func (p *budgetPool) grant() {
+	for len(p.waiters) > 0 && p.fits(p.waiters[0].demand) {
+		p.used = p.used.add(p.waiters[0].demand)
+		close(p.waiters[0].ready)
+		p.waiters = p.waiters[1:]
+	}
+}
+
+// budgetPool returns the pool of the closest workflow, w or one of its
+// ancestors, that sets a ResourceBudget, or nil if none does.
+func (w *Workflow) budgetPool() *budgetPool {
+	for rw := w; rw != nil; rw = rw.parent {
+		if rw.ResourceBudget == nil {
+			continue
+		}
+		rw.budgetMx.Lock()
+		defer rw.budgetMx.Unlock()
+		if rw.budget == nil {
+			rw.budget = &budgetPool{budget: rw.ResourceBudget}
+		}
+		return rw.budget
+	}
+	return nil
+}
+
+// validateBudget checks that every step of the workflow can ever start.
+func (w *Workflow) validateBudget() DError {
+	if w.MaxParallelSteps < 0 {
+		return Errf("MaxParallelSteps must not be negative: %d", w.MaxParallelSteps)
+	}
+	p := w.budgetPool()
+	if p == nil {
+		return nil
+	}
+	for name, s := range w.Steps {
+		d, err := s.resourceDemand()
+		if err != nil {
+			return Errf("step %q: %v", name, err)
+		}
+		if d.exceeds(p.budget) {
+			return Errf("step %q needs %d vCPUs and %d GB of disk, more than the ResourceBudget of %d vCPUs and %d GB of disk", name, d.vcpus, d.diskGb, p.budget.VCPUs, p.budget.DiskGb)
+		}
+	}
+	return nil
+}
+
+// waitToStart throttles the start of step s by the workflow's
+// MaxParallelSteps and ResourceBudget. It returns a function to call once s
+// finished, or false if the workflow was canceled while waiting.
+func (w *Workflow) waitToStart(s *Step) (func(), bool) {
+	var releases []func()
+	done := func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+	if w.parallelSteps != nil {
+		select {
+		case w.parallelSteps <- struct{}{}:
+		default:
+			w.LogWorkflowInfo("Step %q waiting for one of the %d MaxParallelSteps to finish.", s.name, w.MaxParallelSteps)
+			select {
+			case w.parallelSteps <- struct{}{}:
+			case <-w.Cancel:
+				return nil, false
+			}
+		}
+		releases = append(releases, func() { <-w.parallelSteps })
+	}
+	if p := w.budgetPool(); p != nil {
+		// Errors are reported by validateBudget before the workflow runs.
+		if d, _ := s.resourceDemand(); !d.isZero() {
+			p.mx.Lock()
+			throttled := len(p.waiters) > 0 || !p.fits(d)
+			p.mx.Unlock()
+			if throttled {
+				w.LogWorkflowInfo("Step %q waiting for %d vCPUs and %d GB of disk of the ResourceBudget.", s.name, d.vcpus, d.diskGb)
+			}
+			if !p.acquire(d, w.Cancel) {
+				done()
+				return nil, false
+			}
+			releases = append(releases, func() { p.release(d) })
+		}
+	}
+	return done, true
+}
@@ -0,0 +1,199 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestMachineTypeCPUs(t *testing.T) {
+	w := testWorkflow()
+	w.machineTypeCache.exists = map[string]map[string]map[string]interface{}{
+		"p": {"z": {"a2-highgpu-1g": &compute.MachineType{Name: "a2-highgpu-1g", GuestCpus: 12}}},
+	}
+	tests := []struct {
+		machineType string
+		want        int64
+		shouldErr   bool
+	}{
+		{"projects/p/zones/z/machineTypes/a2-highgpu-1g", 12, false},
+		{"projects/p/zones/z/machineTypes/n1-standard-4", 4, false},
+		{"projects/p/zones/z/machineTypes/n2-custom-8-16384", 8, false},
+		{"projects/p/zones/z/machineTypes/custom-2-13312-ext", 2, false},
+		{"projects/p/zones/z/machineTypes/e2-medium", 2, false},
+		{"projects/p/zones/z/machineTypes/e2-micro", 2, false},
+		{"projects/p/zones/z/machineTypes/f1-micro", 1, false},
+		{"projects/p/zones/z/machineTypes/g1-small", 1, false},
+		{"projects/p/zones/z/machineTypes/x9-unknown", 0, true},
+		{"bad", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := w.machineTypeCPUs(tt.machineType)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("machineTypeCPUs(%q): unexpected error: %v", tt.machineType, err)
+		}
+		if got != tt.want {
+			t.Errorf("machineTypeCPUs(%q) = %d, want %d", tt.machineType, got, tt.want)
+		}
+	}
+}
+
+func TestStepResourceDemand(t *testing.T) {
+	w := testWorkflow()
+	tests := []struct {
+		desc      string
+		s         *Step
+		want      resourceDemand
+		shouldErr bool
+	}{
+		{"instances", &Step{w: w, CreateInstances: &CreateInstances{
+			Instances: []*Instance{
+				{Instance: compute.Instance{
+					MachineType: "projects/p/zones/z/machineTypes/n1-standard-4",
+					Disks:       []*compute.AttachedDisk{{InitializeParams: &compute.AttachedDiskInitializeParams{DiskSizeGb: 20}}, {Source: "d"}},
+				}},
+				{Instance: compute.Instance{MachineType: "projects/p/zones/z/machineTypes/n1-standard-2"}},
+			},
+		}}, resourceDemand{vcpus: 6, diskGb: 20}, false},
+		{"disks", &Step{w: w, CreateDisks: &CreateDisks{{Disk: compute.Disk{SizeGb: 100}}, {Disk: compute.Disk{SizeGb: 50}}}}, resourceDemand{diskGb: 150}, false},
+		{"nested", &Step{w: w, Retry: &Retry{Step: &Step{CreateDisks: &CreateDisks{{Disk: compute.Disk{SizeGb: 10}}}}}}, resourceDemand{diskGb: 10}, false},
+		{"unknown machine type", &Step{w: w, CreateInstances: &CreateInstances{
+			Instances: []*Instance{{Instance: compute.Instance{MachineType: "projects/p/zones/z/machineTypes/x9-unknown"}}},
+		}}, resourceDemand{}, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.s.resourceDemand()
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+		}
+		if !tt.shouldErr && got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestBudgetPool(t *testing.T) {
+	p := &budgetPool{budget: &ResourceBudget{VCPUs: 8}}
+	cancel := make(chan struct{})
+
+	if !p.acquire(resourceDemand{vcpus: 6}, cancel) {
+		t.Fatal("first acquire should succeed")
+	}
+	started := make(chan int, 2)
+	var wg sync.WaitGroup
+	for i, d := range []resourceDemand{{vcpus: 4}, {vcpus: 1}} {
+		wg.Add(1)
+		go func(i int, d resourceDemand) {
+			defer wg.Done()
+			if p.acquire(d, cancel) {
+				started <- i
+			}
+		}(i, d)
+		// Make sure the waiters queue up in order.
+		for {
+			p.mx.Lock()
+			n := len(p.waiters)
+			p.mx.Unlock()
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// The second waiter would fit, but must not overtake the first one.
+	select {
+	case i := <-started:
+		t.Fatalf("waiter %d started before any release", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.release(resourceDemand{vcpus: 6})
+	wg.Wait()
+	if len(started) != 2 {
+		t.Errorf("%d waiters started after release, want 2", len(started))
+	}
+	if want := (resourceDemand{vcpus: 5}); p.used != want {
+		t.Errorf("used = %+v, want %+v", p.used, want)
+	}
+
+	// Canceled waiters give up their place.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if p.acquire(resourceDemand{vcpus: 8}, cancel) {
+			t.Error("acquire should fail when canceled")
+		}
+	}()
+	close(cancel)
+	wg.Wait()
+	if len(p.waiters) != 0 {
+		t.Errorf("canceled waiter still queued: %v", p.waiters)
+	}
+}
+
+func TestValidateBudget(t *testing.T) {
+	w := testWorkflow()
+	w.ResourceBudget = &ResourceBudget{DiskGb: 100}
+	w.Steps["s"] = &Step{name: "s", w: w, CreateDisks: &CreateDisks{{Disk: compute.Disk{SizeGb: 200}}}}
+	if err := w.validateBudget(); err == nil {
+		t.Error("expected error for step exceeding the budget")
+	}
+	w.ResourceBudget.DiskGb = 200
+	w.budget = nil
+	if err := w.validateBudget(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	w.MaxParallelSteps = -1
+	if err := w.validateBudget(); err == nil {
+		t.Error("expected error for negative MaxParallelSteps")
+	}
+}
+
+func TestMaxParallelSteps(t *testing.T) {
+	w := testWorkflow()
+	w.MaxParallelSteps = 2
+	var mx sync.Mutex
+	var running, maxRunning int
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("s%d", i)
+		w.Steps[name] = &Step{name: name, w: w, timeout: time.Minute, testType: &mockStep{
+			runImpl: func(ctx context.Context, s *Step) DError {
+				mx.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mx.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				mx.Lock()
+				running--
+				mx.Unlock()
+				return nil
+			},
+		}}
+	}
+	if err := w.run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if maxRunning != 2 {
+		t.Errorf("at most %d steps ran at once, want 2", maxRunning)
+	}
+}
@@ -0,0 +1,324 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+const lintUsage = `Usage: daisy lint [flags] <workflow files or directories>
+
+Checks workflow files, and the workflows they include, without using any GCP
+project or credentials. Directories are searched for .wf.json files. Exits with
+an error if any problem of level error, or of the -fail_on level, is found.
+Warnings listed in the -baseline file are ignored.
+
+`
+
+// runLint implements the lint command.
+func runLint(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), lintUsage)
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "text", "output format, text or sarif")
+	output := fs.String("output", "", "local path to write the findings to, instead of stdout")
+	baseline := fs.String("baseline", "", "local file of known warnings to ignore")
+	updateBaseline := fs.Bool("update_baseline", false, "write the warnings found to the -baseline file, instead of checking them")
+	failOn := fs.String("fail_on", "error", "lowest level of the findings that fail lint, error or warning")
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("lint takes at least one workflow file or directory")
+	}
+	if *format != "text" && *format != "sarif" {
+		return fmt.Errorf("unknown lint format %q, must be text or sarif", *format)
+	}
+	if *failOn != string(daisy.LintError) && *failOn != string(daisy.LintWarning) {
+		return fmt.Errorf("unknown lint level %q, must be error or warning", *failOn)
+	}
+	if *updateBaseline && *baseline == "" {
+		return errors.New("-update_baseline needs a -baseline file")
+	}
+
+	files, err := workflowFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	findings := daisy.Lint(files...)
+	if *updateBaseline {
+		return writeBaseline(*baseline, findings)
+	}
+	if *baseline != "" {
+		if findings, err = filterBaseline(*baseline, findings); err != nil {
+			return err
+		}
+	}
+
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if *format == "sarif" {
+		err = writeSARIF(out, findings)
+	} else {
+		err = printFindings(out, findings)
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs, warnings int
+	for _, f := range findings {
+		switch f.Level {
+		case daisy.LintError:
+			errs++
+		case daisy.LintWarning:
+			warnings++
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("found %d error(s) in workflows", errs)
+	}
+	if *failOn == string(daisy.LintWarning) && warnings > 0 {
+		return fmt.Errorf("found %d warning(s) in workflows", warnings)
+	}
+	return nil
+}
+
+const baselineHeader = `# Known daisy lint warnings, ignored by daisy lint -baseline. Regenerate with
+# daisy lint -baseline <this file> -update_baseline <workflows>.
+`
+
+// baselineEntry identifies a finding in a baseline file. Files are relative
+// to the baseline, and lines are left out so that entries survive edits.
+func baselineEntry(baseline string, f daisy.LintFinding) string {
+	file := f.File
+	dir, err1 := filepath.Abs(filepath.Dir(baseline))
+	abs, err2 := filepath.Abs(f.File)
+	if err1 == nil && err2 == nil {
+		if rel, err := filepath.Rel(dir, abs); err == nil {
+			file = filepath.ToSlash(rel)
+		}
+	}
+	return fmt.Sprintf("%s: %s [%s]", file, f.Message, f.Rule)
+}
+
+// writeBaseline writes the warnings of findings to the baseline file.
+func writeBaseline(baseline string, findings []daisy.LintFinding) error {
+	var entries []string
+	for _, f := range findings {
+		if f.Level == daisy.LintWarning {
+			entries = append(entries, baselineEntry(baseline, f))
+		}
+	}
+	sort.Strings(entries)
+	data := baselineHeader
+	for _, e := range entries {
+		data += e + "\n"
+	}
+	return ioutil.WriteFile(baseline, []byte(data), 0644)
+}
+
+// filterBaseline returns the findings that aren't warnings listed in the
+// baseline file.
+func filterBaseline(baseline string, findings []daisy.LintFinding) ([]daisy.LintFinding, error) {
+	f, err := os.Open(baseline)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	known := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if l := strings.TrimSpace(sc.Text()); l != "" && !strings.HasPrefix(l, "#") {
+			known[l] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	var res []daisy.LintFinding
+	for _, f := range findings {
+		if f.Level != daisy.LintWarning || !known[baselineEntry(baseline, f)] {
+			res = append(res, f)
+		}
+	}
+	return res, nil
+}
+
+// workflowFiles returns the files of paths, and the .wf.json files of the
+// directories of paths.
+func workflowFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(path, ".wf.json") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func printFindings(out io.Writer, findings []daisy.LintFinding) error {
+	for _, f := range findings {
+		loc := f.File
+		if f.Line > 0 {
+			loc = fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		if _, err := fmt.Fprintf(out, "%s: %s: %s [%s]\n", loc, f.Level, f.Message, f.Rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SARIF 2.1.0 log, with only the properties written by the linter.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writeSARIF writes findings as a SARIF log, for code scanning tools.
+func writeSARIF(out io.Writer, findings []daisy.LintFinding) error {
+	driver := sarifDriver{
+		Name:           "daisy lint",
+		InformationURI: "https://github.com/GoogleCloudPlatform/compute-image-tools/tree/master/daisy",
+	}
+	ruleIndex := map[string]int{}
+	for i, r := range daisy.LintRules {
+		ruleIndex[r.ID] = i
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   r.ID,
+			ShortDescription:     sarifMessage{Text: r.Description},
+			DefaultConfiguration: sarifConfiguration{Level: string(r.Level)},
+		})
+	}
+	run := sarifRun{Tool: sarifTool{Driver: driver}, Results: []sarifResult{}}
+	for _, f := range findings {
+		loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(f.File)}}
+		if f.Line > 0 {
+			loc.Region = &sarifRegion{StartLine: f.Line}
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    f.Rule,
+			RuleIndex: ruleIndex[f.Rule],
+			Level:     string(f.Level),
+			Message:   sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{{PhysicalLocation: loc}},
+		})
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	})
+}
@@ -0,0 +1,154 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	findings := []daisy.LintFinding{
+		{Rule: daisy.LintUnusedVar, Level: daisy.LintWarning, File: "wf/a.wf.json", Line: 3, Message: "unused"},
+		{Rule: daisy.LintInvalidWorkflow, Level: daisy.LintError, File: "wf/b.wf.json", Message: "bad"},
+	}
+	var buf bytes.Buffer
+	if err := writeSARIF(&buf, findings); err != nil {
+		t.Fatalf("error writing SARIF: %v", err)
+	}
+	var got sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("SARIF is not JSON: %v", err)
+	}
+	if got.Version != "2.1.0" || len(got.Runs) != 1 || len(got.Runs[0].Tool.Driver.Rules) != len(daisy.LintRules) {
+		t.Fatalf("unexpected SARIF log: %+v", got)
+	}
+	want := []sarifResult{
+		{RuleID: daisy.LintUnusedVar, RuleIndex: 2, Level: "warning", Message: sarifMessage{"unused"}, Locations: []sarifLocation{{
+			PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{"wf/a.wf.json"}, Region: &sarifRegion{3}}}}},
+		{RuleID: daisy.LintInvalidWorkflow, RuleIndex: 0, Level: "error", Message: sarifMessage{"bad"}, Locations: []sarifLocation{{
+			PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{"wf/b.wf.json"}}}}},
+	}
+	if !reflect.DeepEqual(got.Runs[0].Results, want) {
+		t.Errorf("unexpected results, got: %+v, want: %+v", got.Runs[0].Results, want)
+	}
+	for _, r := range got.Runs[0].Results {
+		if rule := got.Runs[0].Tool.Driver.Rules[r.RuleIndex]; rule.ID != r.RuleID {
+			t.Errorf("result %q points to rule %q", r.RuleID, rule.ID)
+		}
+	}
+}
+
+func TestRunLint(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	files := map[string]string{
+		"ok.wf.json":         `{"Steps": {"s": {"DeleteResources": {"Disks": ["d"]}}}}`,
+		"sub/bad.wf.json":    `{"Steps": {"s": {"DeleteResources": {"Disks": ["${nope}"]}}}}`,
+		"sub/notes.txt":      "not a workflow",
+		"sub/unused.wf.json": `{"Vars": {"v": "x"}, "Steps": {"s": {"DeleteResources": {"Disks": ["d"]}}}}`,
+	}
+	for f, data := range files {
+		p := filepath.Join(td, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	err = runLint([]string{td}, &out)
+	if err == nil || err.Error() != "found 1 error(s) in workflows" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	want := filepath.Join(td, "sub/bad.wf.json") + `:1: error: ${nope} references undeclared Var "nope" [undeclared-reference]` + "\n" +
+		filepath.Join(td, "sub/unused.wf.json") + `:1: warning: Var "v" is never used [unused-var]` + "\n"
+	if out.String() != want {
+		t.Errorf("unexpected output, got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := runLint([]string{filepath.Join(td, "ok.wf.json"), filepath.Join(td, "sub/unused.wf.json")}, &out); err != nil {
+		t.Errorf("warnings should not fail lint: %v", err)
+	}
+	if err := runLint([]string{"-format", "xml", td}, &out); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestRunLintBaseline(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	wf := filepath.Join(td, "wf", "a.wf.json")
+	if err := os.MkdirAll(filepath.Dir(wf), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(wf, []byte(`{"Vars": {"old": "x"}, "Steps": {"s": {"DeleteResources": {"Disks": ["d"]}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	baseline := filepath.Join(td, "baseline.txt")
+
+	var out bytes.Buffer
+	if err := runLint([]string{"-fail_on", "warning", wf}, &out); err == nil || err.Error() != "found 1 warning(s) in workflows" {
+		t.Errorf("unexpected error without baseline: %v", err)
+	}
+	if err := runLint([]string{"-update_baseline", wf}, &out); err == nil {
+		t.Error("expected error for -update_baseline without -baseline")
+	}
+	if err := runLint([]string{"-baseline", baseline, "-update_baseline", wf}, &out); err != nil {
+		t.Fatalf("error updating baseline: %v", err)
+	}
+	data, err := ioutil.ReadFile(baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := baselineHeader + `wf/a.wf.json: Var "old" is never used [unused-var]` + "\n"; string(data) != want {
+		t.Errorf("unexpected baseline, got:\n%s\nwant:\n%s", data, want)
+	}
+
+	// Known warnings are ignored, new ones still fail.
+	out.Reset()
+	if err := runLint([]string{"-baseline", baseline, "-fail_on", "warning", wf}, &out); err != nil || out.Len() != 0 {
+		t.Errorf("baselined warnings should be ignored, got error %v and output %q", err, out.String())
+	}
+	if err := ioutil.WriteFile(wf, []byte(`{"Vars": {"old": "x", "new": "y"}, "Steps": {"s": {"DeleteResources": {"Disks": ["d"]}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := runLint([]string{"-baseline", baseline, "-fail_on", "warning", wf}, &out); err == nil || err.Error() != "found 1 warning(s) in workflows" {
+		t.Errorf("unexpected error for new warning: %v", err)
+	}
+	if want := wf + `:1: warning: Var "new" is never used [unused-var]` + "\n"; out.String() != want {
+		t.Errorf("unexpected output, got:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if err := runLint([]string{"-fail_on", "info", wf}, &out); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
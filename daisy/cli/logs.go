@@ -0,0 +1,139 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+	"google.golang.org/api/option"
+)
+
+const logsUsage = `Usage: daisy logs [flags] <run ID or archive>
+
+Prints the serial logs archived by a run of a workflow with -serial_log_archive.
+The archive is given by the ID of the run, which is looked up in -gcs_path, or
+by its local or GCS path.
+
+`
+
+// runLogs implements the logs command.
+func runLogs(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), logsUsage)
+		fs.PrintDefaults()
+	}
+	gcsPath := fs.String("gcs_path", "", "GCS bucket or path the workflow ran with, to look the run up in")
+	oauth := fs.String("oauth", "", "path to oauth json file")
+	step := fs.String("step", "", "only print the logs of the instances that the step created or matched signals of")
+	index := fs.Bool("index", false, "print the index of the archive as JSON instead of the logs")
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("logs takes a single run ID or archive")
+	}
+
+	r, err := openSerialLogArchive(ctx, fs.Arg(0), *gcsPath, *oauth)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return printSerialLogs(out, r, *step, *index)
+}
+
+// openSerialLogArchive opens the archive at a local or GCS path, or the
+// archive of the run with the given ID in gcsPath.
+func openSerialLogArchive(ctx context.Context, arg, gcsPath, oauth string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(arg, "gs://") {
+		if _, err := os.Stat(arg); err == nil {
+			return os.Open(arg)
+		}
+	}
+	var opts []option.ClientOption
+	if oauth != "" {
+		opts = append(opts, option.WithCredentialsFile(oauth))
+	}
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p := arg
+	if !strings.HasPrefix(arg, "gs://") {
+		if gcsPath == "" {
+			return nil, fmt.Errorf("-gcs_path is needed to look up run %q", arg)
+		}
+		if p, err = daisy.FindSerialLogArchive(ctx, client, gcsPath, arg); err != nil {
+			return nil, err
+		}
+	}
+	bkt, obj := splitGCSObject(p)
+	return client.Bucket(bkt).Object(obj).NewReader(ctx)
+}
+
+func splitGCSObject(p string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(p, "gs://"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// printSerialLogs prints the logs, or the index, of the instances of an
+// archive that step created or matched signals of.
+func printSerialLogs(out io.Writer, r io.Reader, step string, index bool) error {
+	idx, logs, err := daisy.ReadSerialLogArchive(r)
+	if err != nil {
+		return err
+	}
+	instances := idx.Filter(step)
+	if index {
+		idx.Instances = instances
+		b, err := json.MarshalIndent(idx, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", b)
+		return err
+	}
+	for _, i := range instances {
+		for _, p := range i.Ports {
+			fmt.Fprintf(out, "==> %s serial port %d (%s) <==\n", i.Name, p.Port, i.Step)
+			out.Write(logs[p.File])
+			if l := logs[p.File]; len(l) > 0 && l[len(l)-1] != '\n' {
+				fmt.Fprintln(out)
+			}
+		}
+		if len(i.Signals) > 0 {
+			fmt.Fprintf(out, "==> %s signals <==\n", i.Name)
+		}
+		for _, sig := range i.Signals {
+			fmt.Fprintf(out, "%s %s %s: %s\n", sig.Time.Format("2006-01-02T15:04:05Z07:00"), sig.Step, sig.Kind, sig.Match)
+		}
+	}
+	return nil
+}
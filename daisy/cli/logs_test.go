@@ -0,0 +1,104 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
+)
+
+func testSerialLogArchive(t *testing.T) []byte {
+	ts := time.Date(2021, 3, 4, 10, 11, 12, 0, time.UTC)
+	idx := daisy.SerialLogIndex{Workflow: "wf", ID: "abc12", Instances: []daisy.SerialLogInstance{
+		{Name: "inst-a", Step: "wf.create-a", Ports: []daisy.SerialLogPort{{Port: 1, File: "inst-a/serial-port1.log"}}},
+		{Name: "inst-b", Step: "wf.create-b", Ports: []daisy.SerialLogPort{{Port: 1, File: "inst-b/serial-port1.log"}},
+			Signals: []daisy.SerialLogSignal{{Time: ts, Step: "wf.wait", Kind: "SuccessMatch", Match: "done"}}},
+	}}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range []struct{ name, content string }{
+		{"index.json", string(data)},
+		{"inst-a/serial-port1.log", "a booting\n"},
+		{"inst-b/serial-port1.log", "b booting\ndone"},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestPrintSerialLogs(t *testing.T) {
+	archive := testSerialLogArchive(t)
+	tests := []struct {
+		step, want string
+	}{
+		{"", "==> inst-a serial port 1 (wf.create-a) <==\na booting\n" +
+			"==> inst-b serial port 1 (wf.create-b) <==\nb booting\ndone\n" +
+			"==> inst-b signals <==\n2021-03-04T10:11:12Z wf.wait SuccessMatch: done\n"},
+		{"create-a", "==> inst-a serial port 1 (wf.create-a) <==\na booting\n"},
+		{"wait", "==> inst-b serial port 1 (wf.create-b) <==\nb booting\ndone\n" +
+			"==> inst-b signals <==\n2021-03-04T10:11:12Z wf.wait SuccessMatch: done\n"},
+		{"other", ""},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := printSerialLogs(&out, bytes.NewReader(archive), tt.step, false); err != nil {
+			t.Fatalf("%q: error printing logs: %v", tt.step, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%q: unexpected output, got:\n%s\nwant:\n%s", tt.step, out.String(), tt.want)
+		}
+	}
+}
+
+func TestPrintSerialLogsIndex(t *testing.T) {
+	var out bytes.Buffer
+	if err := printSerialLogs(&out, bytes.NewReader(testSerialLogArchive(t)), "create-b", true); err != nil {
+		t.Fatalf("error printing index: %v", err)
+	}
+	var idx daisy.SerialLogIndex
+	if err := json.Unmarshal(out.Bytes(), &idx); err != nil {
+		t.Fatalf("index is not JSON: %v", err)
+	}
+	if len(idx.Instances) != 1 || idx.Instances[0].Name != "inst-b" || idx.ID != "abc12" {
+		t.Errorf("unexpected index: %+v", idx)
+	}
+}
+
+func TestSplitGCSObject(t *testing.T) {
+	if b, o := splitGCSObject("gs://bucket/a/b.tar.gz"); b != "bucket" || o != "a/b.tar.gz" {
+		t.Errorf("unexpected split: %q %q", b, o)
+	}
+	if b, o := splitGCSObject("gs://bucket"); b != "bucket" || o != "" {
+		t.Errorf("unexpected split: %q %q", b, o)
+	}
+}
@@ -41,12 +41,20 @@ var (
 	print              = flag.Bool("print", false, "print out the parsed workflow for debugging")
 	printPerf          = flag.Bool("print_perf", false, "print out the performance profile")
 	validate           = flag.Bool("validate", false, "validate the workflow and exit")
+	plan               = flag.Bool("plan", false, "print the API calls the workflow would make and exit, without using any GCP project")
 	format             = flag.Bool("format_workflow", false, "format the workflow file(s) and exit")
 	defaultTimeout     = flag.String("default_timeout", "", "sets the default timeout for the workflow")
 	ce                 = flag.String("compute_endpoint_override", "", "API endpoint to override default")
 	gcsLogsDisabled    = flag.Bool("disable_gcs_logging", false, "do not stream logs to GCS")
 	cloudLogsDisabled  = flag.Bool("disable_cloud_logging", false, "do not stream logs to Cloud Logging")
 	stdoutLogsDisabled = flag.Bool("disable_stdout_logging", false, "do not display individual workflow logs on stdout")
+	journal            = flag.String("journal", "", "local path or GCS object to write the execution journal of the workflow to")
+	resume             = flag.String("resume", "", "local path or GCS object of a journal to resume the workflow from")
+	events             = flag.String("events", "", "local path to write workflow events to as JSON lines, or - for stdout")
+	graph              = flag.String("graph", "", "print the expanded step graph of the workflow in the given format, dot or mermaid, and exit")
+	graphTimes         = flag.String("graph_times", "", "local path of the time records of a completed run, written by -time_records, to annotate -graph with")
+	timeRecords        = flag.String("time_records", "", "local path to write the time records of the workflow's steps to, for -graph_times")
+	serialLogArchive   = flag.Bool("serial_log_archive", false, "archive serial ports 1-4 of every instance to logs/serial-logs.tar.gz in the scratch path, see 'daisy logs'")
 )
 
 const (
@@ -216,12 +224,35 @@ func printPerfProfile(workflow *daisy.Workflow) {
 	fmt.Printf("Total time: %v\n\n", formatDuration(wfEndTime.Sub(wfStartTime)))
 }
 
+func writeTimeRecords(w *daisy.Workflow, path string) {
+	b, err := json.MarshalIndent(w.GetStepTimeRecords(), "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(path, b, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[Daisy] Error writing time records: %v\n", err)
+	}
+}
+
 func formatDuration(d time.Duration) string {
 	s := int(d.Seconds())
 	return fmt.Sprintf("[hh:mm:ss] %v:%v:%v", s/3600, s/60%60, s%60)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "logs" {
+		if err := runLogs(context.Background(), os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		if err := runLint(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	addFlags(os.Args[1:])
 	flag.Parse()
 
@@ -252,6 +283,50 @@ func main() {
 		ws = append(ws, w)
 	}
 
+	if (*journal != "" || *resume != "" || *timeRecords != "") && len(ws) > 1 {
+		log.Fatal("-journal, -resume and -time_records can only be used with a single workflow.")
+	}
+	if *resume != "" {
+		if err := ws[0].ResumeFromJournal(ctx, *resume); err != nil {
+			log.Fatalf("error resuming workflow %q: %v", ws[0].Name, err)
+		}
+	} else if *journal != "" {
+		ws[0].EnableJournal(*journal)
+	}
+
+	if *serialLogArchive {
+		for _, w := range ws {
+			w.EnableSerialLogArchive()
+		}
+	}
+
+	if *events != "" {
+		out := os.Stdout
+		if *events != "-" {
+			f, err := os.Create(*events)
+			if err != nil {
+				log.Fatalf("error creating events file: %v", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		sink := daisy.NewJSONEventSink(out)
+		for _, w := range ws {
+			w.AddEventSink(sink)
+		}
+	}
+
+	var records []daisy.TimeRecord
+	if *graphTimes != "" {
+		b, err := ioutil.ReadFile(*graphTimes)
+		if err != nil {
+			log.Fatalf("error reading time records: %v", err)
+		}
+		if err := json.Unmarshal(b, &records); err != nil {
+			log.Fatalf("error parsing time records %q: %v", *graphTimes, err)
+		}
+	}
+
 	errors := make(chan error, len(ws))
 	var wg sync.WaitGroup
 	for _, w := range ws {
@@ -278,6 +353,29 @@ func main() {
 			}
 			continue
 		}
+		if *graph != "" {
+			// Only print the graph, so it can be piped to a renderer.
+			w.DisableStdoutLogging()
+			g, err := w.Graph(ctx, *graph, records)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[Daisy] Error graphing workflow %q: %v\n", w.Name, err)
+				continue
+			}
+			fmt.Print(g)
+			continue
+		}
+		if *plan {
+			fmt.Printf("[Daisy] Planning workflow %q\n", w.Name)
+			entries, err := w.Plan(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[Daisy] Error planning workflow %q: %v\n", w.Name, err)
+				continue
+			}
+			for _, e := range entries {
+				fmt.Printf("  %s\n", e)
+			}
+			continue
+		}
 		wg.Add(1)
 		go func(w *daisy.Workflow) {
 			defer wg.Done()
@@ -285,6 +383,9 @@ func main() {
 				defer printPerfProfile(w)
 			}
 			fmt.Printf("[Daisy] Running workflow %q (id=%s)\n", w.Name, w.ID())
+			if *timeRecords != "" {
+				defer writeTimeRecords(w, *timeRecords)
+			}
 			if err := w.Run(ctx); err != nil {
 				errors <- fmt.Errorf("%s: %v", w.Name, err)
 				return
@@ -308,7 +409,7 @@ func main() {
 			}
 		}
 	default:
-		if !*print && !*validate {
+		if !*print && !*validate && !*plan && *graph == "" {
 			fmt.Println("[Daisy] All workflows completed successfully.")
 		}
 	}
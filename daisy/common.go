@@ -98,6 +98,15 @@ func strIn(s string, ss []string) bool {
 	return false
 }
 
+func int64In(i int64, is []int64) bool {
+	for _, x := range is {
+		if i == x {
+			return true
+		}
+	}
+	return false
+}
+
 func strLitPtr(s string) *string {
 	return &s
 }
@@ -179,6 +188,10 @@ func traverseData(v reflect.Value, f func(reflect.Value) DError) DError {
 		if v.IsNil() {
 			return nil
 		}
+		// Registered step types are held by interface, traverse what they point to.
+		if v.Type() == stepImplType && v.Elem().Kind() == reflect.Ptr {
+			return traverseData(v.Elem().Elem(), f)
+		}
 		// I'm a pointer, dereference me.
 		return traverseData(v.Elem(), f)
 	}
@@ -45,6 +45,7 @@ type Client interface {
 	CreateImageAlpha(project string, i *computeAlpha.Image) error
 	CreateImageBeta(project string, i *computeBeta.Image) error
 	CreateInstance(project, zone string, i *compute.Instance) error
+	CreateInstanceTemplate(project string, it *compute.InstanceTemplate) error
 	CreateInstanceAlpha(project, zone string, i *computeAlpha.Instance) error
 	CreateInstanceBeta(project, zone string, i *computeBeta.Instance) error
 	CreateNetwork(project string, n *compute.Network) error
@@ -68,6 +69,7 @@ type Client interface {
 	GetSerialPortOutput(project, zone, name string, port, start int64) (*compute.SerialPortOutput, error)
 	GetZone(project, zone string) (*compute.Zone, error)
 	GetInstance(project, zone, name string) (*compute.Instance, error)
+	GetInstanceTemplate(project, name string) (*compute.InstanceTemplate, error)
 	GetInstanceAlpha(project, zone, name string) (*computeAlpha.Instance, error)
 	GetInstanceBeta(project, zone, name string) (*computeBeta.Instance, error)
 	GetDisk(project, zone, name string) (*compute.Disk, error)
@@ -567,6 +569,34 @@ func (c *client) CreateImage(project string, i *compute.Image) error {
 	return nil
 }
 
+// CreateInstanceTemplate creates a GCE instance template.
+func (c *client) CreateInstanceTemplate(project string, it *compute.InstanceTemplate) error {
+	op, err := c.Retry(c.raw.InstanceTemplates.Insert(project, it).Do)
+	if err != nil {
+		return err
+	}
+
+	if err := c.i.globalOperationsWait(project, op.Name); err != nil {
+		return err
+	}
+
+	var createdInstanceTemplate *compute.InstanceTemplate
+	if createdInstanceTemplate, err = c.i.GetInstanceTemplate(project, it.Name); err != nil {
+		return err
+	}
+	*it = *createdInstanceTemplate
+	return nil
+}
+
+// GetInstanceTemplate gets a GCE instance template.
+func (c *client) GetInstanceTemplate(project, name string) (*compute.InstanceTemplate, error) {
+	it, err := c.raw.InstanceTemplates.Get(project, name).Do()
+	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		return c.raw.InstanceTemplates.Get(project, name).Do()
+	}
+	return it, err
+}
+
 // CreateImageBeta creates a GCE image using Beta API.
 // Only one of sourceDisk or sourceFile must be specified, sourceDisk is the
 // url (full or partial) to the source disk, sourceFile is the full Google
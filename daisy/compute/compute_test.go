@@ -31,24 +31,25 @@ import (
 )
 
 var (
-	testProject              = "test-project"
-	testZone                 = "test-zone"
-	testRegion               = "test-region"
-	testDisk                 = "test-disk"
-	testDisk2                = "test-disk2"
-	testResize         int64 = 128
-	testForwardingRule       = "test-forwarding-rule"
-	testFirewallRule         = "test-firewall-rule"
-	testImage                = "test-image"
-	testImageAlpha           = "test-image-alpha"
-	testImageBeta            = "test-image-beta"
-	testMachineImage         = "test-machine-image"
-	testInstance             = "test-instance"
-	testInstanceAlpha        = "test-instance-alpha"
-	testInstanceBeta         = "test-instance-beta"
-	testNetwork              = "test-network"
-	testSubnetwork           = "test-subnetwork"
-	testTargetInstance       = "test-target-instance"
+	testProject                = "test-project"
+	testZone                   = "test-zone"
+	testRegion                 = "test-region"
+	testDisk                   = "test-disk"
+	testDisk2                  = "test-disk2"
+	testResize           int64 = 128
+	testForwardingRule         = "test-forwarding-rule"
+	testFirewallRule           = "test-firewall-rule"
+	testImage                  = "test-image"
+	testImageAlpha             = "test-image-alpha"
+	testImageBeta              = "test-image-beta"
+	testMachineImage           = "test-machine-image"
+	testInstance               = "test-instance"
+	testInstanceAlpha          = "test-instance-alpha"
+	testInstanceBeta           = "test-instance-beta"
+	testInstanceTemplate       = "test-instance-template"
+	testNetwork                = "test-network"
+	testSubnetwork             = "test-subnetwork"
+	testTargetInstance         = "test-target-instance"
 )
 
 func TestShouldRetryWithWait(t *testing.T) {
@@ -132,6 +133,7 @@ func TestCreates(t *testing.T) {
 	in := &compute.Instance{Name: testInstance}
 	inAlpha := &computeAlpha.Instance{Name: testInstanceAlpha}
 	inBeta := &computeBeta.Instance{Name: testInstanceBeta}
+	it := &compute.InstanceTemplate{Name: testInstanceTemplate}
 	n := &compute.Network{Name: testNetwork}
 	sn := &compute.Subnetwork{Name: testSubnetwork}
 	ti := &compute.TargetInstance{Name: testTargetInstance}
@@ -221,6 +223,14 @@ func TestCreates(t *testing.T) {
 			&computeBeta.Instance{Name: testInstanceBeta},
 			inBeta,
 		},
+		{
+			"instanceTemplates",
+			func() error { return c.CreateInstanceTemplate(testProject, it) },
+			fmt.Sprintf("/%s/global/instanceTemplates/%s?alt=json&prettyPrint=false", testProject, testInstanceTemplate),
+			fmt.Sprintf("/%s/global/instanceTemplates?alt=json&prettyPrint=false", testProject),
+			&compute.InstanceTemplate{Name: testInstanceTemplate},
+			it,
+		},
 		{
 			"networks",
 			func() error { return c.CreateNetwork(testProject, n) },
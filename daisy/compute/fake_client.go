@@ -0,0 +1,842 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/option"
+)
+
+const fakeLinkPrefix = "https://www.googleapis.com/compute/v1/"
+
+// DefaultFakeZones are the zones that exist in every project of a FakeClient.
+var DefaultFakeZones = []string{"us-central1-a", "us-central1-b", "us-central1-c", "us-central1-f", "us-east1-b", "europe-west1-b"}
+
+var fakeMachineTypes = map[string]int64{
+	"e2-medium": 2, "e2-standard-2": 2, "e2-standard-4": 4, "e2-standard-8": 8,
+	"n1-standard-1": 1, "n1-standard-2": 2, "n1-standard-4": 4, "n1-standard-8": 8, "n1-highcpu-4": 4,
+	"n2-standard-2": 2, "n2-standard-4": 4, "n2-standard-8": 8,
+}
+
+// InstanceScript scripts the guest of the instances of a FakeClient.
+type InstanceScript struct {
+	// SerialOutput is written to the serial ports, keyed by port number, each
+	// time the instance boots.
+	SerialOutput map[int64]string
+	// GuestAttributes are set, keyed by "namespace/key", when the instance
+	// boots.
+	GuestAttributes map[string]string
+	// Shutdown makes the instance stop by itself once all of its serial
+	// output has been read.
+	Shutdown bool
+}
+
+type fakeInstance struct {
+	script     *InstanceScript
+	serial     map[int64]string
+	read       map[int64]int64
+	guestAttrs map[string]string
+}
+
+type fakeScript struct {
+	prefix string
+	script InstanceScript
+}
+
+// FakeClient is a Client backed by a stateful, in-memory fake of the GCE API.
+// Disks, images, instances, networks and the other resources Daisy creates
+// are stored as they are inserted, and operations complete immediately.
+// Projects get a default network the first time they are used. Instances go
+// through PROVISIONING, STAGING and RUNNING, advancing one status each time
+// they are read, and their guests can be scripted with ScriptInstances.
+// Images and image families of public image projects, whose names end in
+// "-cloud", always exist. List filters are ignored.
+type FakeClient struct {
+	client
+	ts *httptest.Server
+
+	mx        sync.Mutex
+	resources map[string]map[string]interface{}
+	instances map[string]*fakeInstance
+	scripts   []fakeScript
+	metadata  map[string]interface{}
+	projects  map[string]bool
+	zones     []string
+	nextID    uint64
+}
+
+// NewFakeClient starts a FakeClient. It must be closed with Close.
+func NewFakeClient() (*FakeClient, error) {
+	f := &FakeClient{
+		resources: map[string]map[string]interface{}{},
+		instances: map[string]*fakeInstance{},
+		metadata:  map[string]interface{}{},
+		projects:  map[string]bool{},
+		zones:     DefaultFakeZones,
+		nextID:    1000,
+	}
+	f.ts = httptest.NewServer(http.HandlerFunc(f.handle))
+	c, err := NewClient(context.Background(), option.WithEndpoint(f.ts.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		f.ts.Close()
+		return nil, err
+	}
+	f.client = *c.(*client)
+	f.client.i = f
+	return f, nil
+}
+
+// Close shuts the fake down.
+func (f *FakeClient) Close() {
+	f.ts.Close()
+}
+
+// AddZones makes zones exist in addition to DefaultFakeZones.
+func (f *FakeClient) AddZones(zones ...string) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.zones = append(append([]string{}, f.zones...), zones...)
+}
+
+// ScriptInstances scripts the guest of the instances whose name starts with
+// prefix and that are created afterwards. Instances without a script run
+// forever and write no serial output.
+func (f *FakeClient) ScriptInstances(prefix string, script InstanceScript) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.scripts = append(f.scripts, fakeScript{prefix: prefix, script: script})
+}
+
+// AddResource stores a resource as if it had been created, e.g. a public
+// image. link is the partial URL of the resource and v is its API
+// representation.
+func (f *FakeClient) AddResource(link string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	res := map[string]interface{}{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+	p, err := parseFakePath(link)
+	if err != nil {
+		return err
+	}
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.initProject(p.project)
+	res["name"] = p.name
+	f.store(p, res)
+	return nil
+}
+
+// Resources returns the partial URLs of the stored resources of a collection,
+// e.g. "disks", sorted.
+func (f *FakeClient) Resources(collection string) []string {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	var links []string
+	for link := range f.resources {
+		if p, err := parseFakePath(link); err == nil && p.collection == collection {
+			links = append(links, link)
+		}
+	}
+	sort.Strings(links)
+	return links
+}
+
+// fakePath is a parsed GCE API path.
+type fakePath struct {
+	project    string
+	scope      string // "global", "zones/z", "regions/r", "aggregated" or "".
+	collection string
+	name       string
+	method     string
+}
+
+func (p fakePath) collectionLink() string {
+	parts := []string{"projects", p.project}
+	if p.scope != "" {
+		parts = append(parts, p.scope)
+	}
+	return strings.Join(append(parts, p.collection), "/")
+}
+
+func (p fakePath) link() string {
+	return p.collectionLink() + "/" + p.name
+}
+
+func parseFakePath(path string) (fakePath, error) {
+	var p fakePath
+	i := strings.Index(path, "projects/")
+	if i == -1 {
+		return p, fmt.Errorf("not a project path: %q", path)
+	}
+	parts := strings.Split(strings.Trim(path[i:], "/"), "/")
+	p.project = parts[1]
+	rest := parts[2:]
+	switch {
+	case len(rest) == 0:
+		return p, nil
+	case len(rest) == 1 && rest[0] != "zones" && rest[0] != "regions":
+		p.method = rest[0]
+		return p, nil
+	case rest[0] == "global" || rest[0] == "aggregated":
+		p.scope = rest[0]
+		rest = rest[1:]
+	case (rest[0] == "zones" || rest[0] == "regions") && len(rest) > 2:
+		p.scope = rest[0] + "/" + rest[1]
+		rest = rest[2:]
+	}
+	if len(rest) == 0 {
+		return p, fmt.Errorf("no collection in path %q", path)
+	}
+	p.collection = rest[0]
+	if len(rest) > 1 {
+		p.name = rest[1]
+	}
+	if len(rest) > 2 {
+		p.method = strings.Join(rest[2:], "/")
+	}
+	return p, nil
+}
+
+// normalize turns a reference to a resource into a partial URL.
+func normalize(project, ref string) string {
+	if i := strings.Index(ref, "projects/"); i != -1 {
+		return ref[i:]
+	}
+	if ref == "" {
+		return ""
+	}
+	return fmt.Sprintf("projects/%s/%s", project, ref)
+}
+
+func fakeError(w http.ResponseWriter, code int, reason, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code": code, "message": msg,
+			"errors": []interface{}{map[string]interface{}{"reason": reason, "message": msg}},
+		},
+	})
+}
+
+func writeFakeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *FakeClient) operation(p fakePath, opType, target string) map[string]interface{} {
+	f.nextID++
+	op := map[string]interface{}{
+		"kind":          "compute#operation",
+		"name":          fmt.Sprintf("operation-%d", f.nextID),
+		"operationType": opType,
+		"status":        "DONE",
+		"progress":      100,
+	}
+	if target != "" {
+		op["targetLink"] = fakeLinkPrefix + target
+	}
+	if strings.HasPrefix(p.scope, "zones/") {
+		op["zone"] = fakeLinkPrefix + fmt.Sprintf("projects/%s/%s", p.project, p.scope)
+	}
+	return op
+}
+
+// store must be called with f.mx held.
+func (f *FakeClient) store(p fakePath, res map[string]interface{}) {
+	f.nextID++
+	res["id"] = strconv.FormatUint(f.nextID, 10)
+	res["selfLink"] = fakeLinkPrefix + p.link()
+	if _, ok := res["creationTimestamp"]; !ok {
+		res["creationTimestamp"] = time.Now().Format(time.RFC3339)
+	}
+	if strings.HasPrefix(p.scope, "zones/") {
+		res["zone"] = fakeLinkPrefix + fmt.Sprintf("projects/%s/%s", p.project, p.scope)
+	}
+	if strings.HasPrefix(p.scope, "regions/") {
+		res["region"] = fakeLinkPrefix + fmt.Sprintf("projects/%s/%s", p.project, p.scope)
+	}
+	f.resources[p.link()] = res
+}
+
+func (f *FakeClient) handle(w http.ResponseWriter, r *http.Request) {
+	p, err := parseFakePath(r.URL.Path)
+	if err != nil {
+		fakeError(w, http.StatusNotFound, "notFound", "%v", err)
+		return
+	}
+	var body map[string]interface{}
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+	}
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.initProject(p.project)
+
+	switch {
+	case p.collection == "operations":
+		op := f.operation(p, "", "")
+		op["name"] = p.name
+		writeFakeJSON(w, op)
+	case p.collection == "" && p.method == "":
+		writeFakeJSON(w, map[string]interface{}{"name": p.project, "commonInstanceMetadata": f.projectMetadata(p.project)})
+	case p.collection == "" && p.method == "setCommonInstanceMetadata":
+		f.metadata[p.project] = body
+		writeFakeJSON(w, f.operation(p, "setMetadata", "projects/"+p.project))
+	case p.scope == "" && (p.collection == "zones" || p.collection == "regions"):
+		f.handleLocation(w, p)
+	case p.scope == "aggregated":
+		f.handleAggregated(w, p)
+	case p.collection == "machineTypes":
+		f.handleMachineType(w, p)
+	case p.name == "" && r.Method == http.MethodGet:
+		f.list(w, p)
+	case p.name == "" && r.Method == http.MethodPost:
+		f.insert(w, p, body)
+	case p.method != "" && !(p.collection == "images" && p.name == "family"):
+		f.handleMethod(w, r, p, body)
+	case r.Method == http.MethodDelete:
+		f.delete(w, p)
+	default:
+		f.get(w, p)
+	}
+}
+
+// initProject creates the default network of a project, like GCE does, the
+// first time the project is used.
+func (f *FakeClient) initProject(project string) {
+	if f.projects[project] {
+		return
+	}
+	f.projects[project] = true
+	network := fakePath{project: project, scope: "global", collection: "networks", name: "default"}
+	f.store(network, map[string]interface{}{"name": "default", "autoCreateSubnetworks": true})
+	seen := map[string]bool{}
+	for _, z := range f.zones {
+		region := z[:strings.LastIndex(z, "-")]
+		if seen[region] {
+			continue
+		}
+		seen[region] = true
+		f.store(fakePath{project: project, scope: "regions/" + region, collection: "subnetworks", name: "default"},
+			map[string]interface{}{"name": "default", "network": fakeLinkPrefix + network.link()})
+	}
+}
+
+func (f *FakeClient) projectMetadata(project string) interface{} {
+	if md, ok := f.metadata[project]; ok {
+		return md
+	}
+	return map[string]interface{}{"kind": "compute#metadata", "fingerprint": "fake"}
+}
+
+func (f *FakeClient) handleLocation(w http.ResponseWriter, p fakePath) {
+	var items []interface{}
+	seen := map[string]bool{}
+	for _, z := range f.zones {
+		name := z
+		if p.collection == "regions" {
+			name = z[:strings.LastIndex(z, "-")]
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		item := map[string]interface{}{"name": name, "status": "UP", "selfLink": fakeLinkPrefix + fmt.Sprintf("projects/%s/%s/%s", p.project, p.collection, name)}
+		if p.name == name {
+			writeFakeJSON(w, item)
+			return
+		}
+		items = append(items, item)
+	}
+	if p.name != "" {
+		fakeError(w, http.StatusNotFound, "notFound", "The resource 'projects/%s/%s/%s' was not found", p.project, p.collection, p.name)
+		return
+	}
+	writeFakeJSON(w, map[string]interface{}{"items": items})
+}
+
+func (f *FakeClient) handleMachineType(w http.ResponseWriter, p fakePath) {
+	mt := func(name string, cpus int64) map[string]interface{} {
+		return map[string]interface{}{
+			"name": name, "guestCpus": cpus, "memoryMb": cpus * 3840,
+			"selfLink": fakeLinkPrefix + fmt.Sprintf("projects/%s/%s/machineTypes/%s", p.project, p.scope, name),
+		}
+	}
+	if p.name != "" {
+		if cpus, ok := fakeMachineTypes[p.name]; ok {
+			writeFakeJSON(w, mt(p.name, cpus))
+			return
+		}
+		fakeError(w, http.StatusNotFound, "notFound", "The resource '%s' was not found", p.link())
+		return
+	}
+	var names []string
+	for n := range fakeMachineTypes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var items []interface{}
+	for _, n := range names {
+		items = append(items, mt(n, fakeMachineTypes[n]))
+	}
+	writeFakeJSON(w, map[string]interface{}{"items": items})
+}
+
+// matching returns the stored resources of a collection, sorted by link.
+func (f *FakeClient) matching(match func(fakePath) bool) []map[string]interface{} {
+	var links []string
+	for link := range f.resources {
+		if p, err := parseFakePath(link); err == nil && match(p) {
+			links = append(links, link)
+		}
+	}
+	sort.Strings(links)
+	var items []map[string]interface{}
+	for _, link := range links {
+		if p, _ := parseFakePath(link); p.collection == "instances" {
+			f.advance(link)
+		}
+		items = append(items, f.resources[link])
+	}
+	return items
+}
+
+func (f *FakeClient) list(w http.ResponseWriter, p fakePath) {
+	items := f.matching(func(o fakePath) bool {
+		return o.project == p.project && o.scope == p.scope && o.collection == p.collection
+	})
+	writeFakeJSON(w, map[string]interface{}{"items": items})
+}
+
+func (f *FakeClient) handleAggregated(w http.ResponseWriter, p fakePath) {
+	scoped := map[string]interface{}{}
+	for _, res := range f.matching(func(o fakePath) bool { return o.project == p.project && o.collection == p.collection }) {
+		o, _ := parseFakePath(res["selfLink"].(string))
+		list, _ := scoped[o.scope].(map[string]interface{})
+		if list == nil {
+			list = map[string]interface{}{p.collection: []interface{}{}}
+			scoped[o.scope] = list
+		}
+		list[p.collection] = append(list[p.collection].([]interface{}), res)
+	}
+	writeFakeJSON(w, map[string]interface{}{"items": scoped})
+}
+
+func isPublicImageProject(project string) bool {
+	return strings.HasSuffix(project, "-cloud")
+}
+
+func (f *FakeClient) get(w http.ResponseWriter, p fakePath) {
+	if p.collection == "images" && p.name == "family" {
+		f.getImageFromFamily(w, p)
+		return
+	}
+	link := p.link()
+	if res, ok := f.resources[link]; ok {
+		if p.collection == "instances" {
+			f.advance(link)
+		}
+		writeFakeJSON(w, res)
+		return
+	}
+	switch {
+	case p.collection == "images" && isPublicImageProject(p.project),
+		p.collection == "licenses",
+		p.collection == "diskTypes":
+		writeFakeJSON(w, map[string]interface{}{"name": p.name, "status": "READY", "selfLink": fakeLinkPrefix + link})
+	default:
+		fakeError(w, http.StatusNotFound, "notFound", "The resource '%s' was not found", link)
+	}
+}
+
+func (f *FakeClient) getImageFromFamily(w http.ResponseWriter, p fakePath) {
+	family := p.method
+	var newest map[string]interface{}
+	for _, img := range f.matching(func(o fakePath) bool { return o.project == p.project && o.collection == "images" }) {
+		if img["family"] != family {
+			continue
+		}
+		if dep, ok := img["deprecated"].(map[string]interface{}); ok && dep["state"] != nil && dep["state"] != "" && dep["state"] != "ACTIVE" {
+			continue
+		}
+		if newest == nil || img["creationTimestamp"].(string) >= newest["creationTimestamp"].(string) {
+			newest = img
+		}
+	}
+	if newest == nil && isPublicImageProject(p.project) {
+		newest = map[string]interface{}{
+			"name": family + "-v20210101", "family": family, "status": "READY",
+			"selfLink": fakeLinkPrefix + fmt.Sprintf("projects/%s/global/images/%s-v20210101", p.project, family),
+		}
+	}
+	if newest == nil {
+		fakeError(w, http.StatusNotFound, "notFound", "The resource 'projects/%s/global/images/family/%s' was not found", p.project, family)
+		return
+	}
+	writeFakeJSON(w, newest)
+}
+
+// exists returns true if a referenced resource exists. References to
+// resources of public image projects are always valid.
+func (f *FakeClient) exists(link string) bool {
+	if link == "" {
+		return true
+	}
+	p, err := parseFakePath(link)
+	if err != nil {
+		return false
+	}
+	if isPublicImageProject(p.project) {
+		return true
+	}
+	_, ok := f.resources[p.link()]
+	return ok
+}
+
+func (f *FakeClient) insert(w http.ResponseWriter, p fakePath, body map[string]interface{}) {
+	name, _ := body["name"].(string)
+	if name == "" {
+		fakeError(w, http.StatusBadRequest, "required", "Required field 'resource.name' not specified")
+		return
+	}
+	p.name = name
+	if _, ok := f.resources[p.link()]; ok {
+		fakeError(w, http.StatusConflict, "alreadyExists", "The resource '%s' already exists", p.link())
+		return
+	}
+	for _, key := range []string{"sourceDisk", "sourceSnapshot", "sourceMachineImage", "network"} {
+		if ref, _ := body[key].(string); ref != "" && !f.exists(normalize(p.project, ref)) {
+			fakeError(w, http.StatusNotFound, "notFound", "The resource '%s' was not found", normalize(p.project, ref))
+			return
+		}
+	}
+
+	switch p.collection {
+	case "disks":
+		if _, ok := body["sizeGb"]; !ok {
+			body["sizeGb"] = "10"
+		}
+		body["status"] = "READY"
+	case "instances":
+		if err := f.insertInstanceDisks(p, body); err != nil {
+			fakeError(w, http.StatusNotFound, "notFound", "%v", err)
+			return
+		}
+		body["status"] = "PROVISIONING"
+		inst := &fakeInstance{serial: map[int64]string{}, read: map[int64]int64{}, guestAttrs: map[string]string{}}
+		for _, s := range f.scripts {
+			if strings.HasPrefix(name, s.prefix) {
+				script := s.script
+				inst.script = &script
+			}
+		}
+		f.instances[p.link()] = inst
+	default:
+		body["status"] = "READY"
+	}
+	f.store(p, body)
+	writeFakeJSON(w, f.operation(p, "insert", p.link()))
+}
+
+// insertInstanceDisks creates the disks of an instance that are created along
+// with it, and marks all of its disks as used by the instance.
+func (f *FakeClient) insertInstanceDisks(p fakePath, body map[string]interface{}) error {
+	disks, _ := body["disks"].([]interface{})
+	instLink := fakeLinkPrefix + p.link()
+	for i, d := range disks {
+		ad, _ := d.(map[string]interface{})
+		if ad == nil {
+			continue
+		}
+		src, _ := ad["source"].(string)
+		if src == "" {
+			params, _ := ad["initializeParams"].(map[string]interface{})
+			dp := fakePath{project: p.project, scope: p.scope, collection: "disks", name: p.name}
+			if n, _ := params["diskName"].(string); n != "" {
+				dp.name = n
+			} else if i > 0 {
+				dp.name = fmt.Sprintf("%s-%d", p.name, i)
+			}
+			disk := map[string]interface{}{"name": dp.name, "sizeGb": "10", "status": "READY"}
+			for from, to := range map[string]string{"diskSizeGb": "sizeGb", "diskType": "type", "sourceImage": "sourceImage", "sourceSnapshot": "sourceSnapshot", "labels": "labels"} {
+				if v, ok := params[from]; ok {
+					disk[to] = v
+				}
+			}
+			f.store(dp, disk)
+			src = dp.link()
+			ad["source"] = fakeLinkPrefix + src
+			if _, ok := ad["autoDelete"]; !ok {
+				ad["autoDelete"] = true
+			}
+		}
+		disk, ok := f.resources[normalize(p.project, src)]
+		if !ok {
+			return fmt.Errorf("The resource '%s' was not found", normalize(p.project, src))
+		}
+		users, _ := disk["users"].([]interface{})
+		disk["users"] = append(users, instLink)
+		if _, ok := ad["deviceName"]; !ok {
+			dp, _ := parseFakePath(src)
+			ad["deviceName"] = dp.name
+		}
+		if i == 0 {
+			ad["boot"] = true
+		}
+	}
+	return nil
+}
+
+func (f *FakeClient) delete(w http.ResponseWriter, p fakePath) {
+	link := p.link()
+	res, ok := f.resources[link]
+	if !ok {
+		fakeError(w, http.StatusNotFound, "notFound", "The resource '%s' was not found", link)
+		return
+	}
+	if users, _ := res["users"].([]interface{}); p.collection == "disks" && len(users) > 0 {
+		fakeError(w, http.StatusBadRequest, "resourceInUseByAnotherResource", "The disk resource '%s' is already being used by '%s'", link, users[0])
+		return
+	}
+	if p.collection == "instances" {
+		disks, _ := res["disks"].([]interface{})
+		for _, d := range disks {
+			ad, _ := d.(map[string]interface{})
+			src, _ := ad["source"].(string)
+			dl := normalize(p.project, src)
+			f.detach(dl, link)
+			if autoDelete, _ := ad["autoDelete"].(bool); autoDelete {
+				delete(f.resources, dl)
+			}
+		}
+		delete(f.instances, link)
+	}
+	delete(f.resources, link)
+	writeFakeJSON(w, f.operation(p, "delete", link))
+}
+
+// detach removes an instance from the users of a disk.
+func (f *FakeClient) detach(diskLink, instLink string) {
+	disk, ok := f.resources[diskLink]
+	if !ok {
+		return
+	}
+	users, _ := disk["users"].([]interface{})
+	var kept []interface{}
+	for _, u := range users {
+		if s, _ := u.(string); normalize("", s) != instLink {
+			kept = append(kept, u)
+		}
+	}
+	disk["users"] = kept
+}
+
+func (f *FakeClient) handleMethod(w http.ResponseWriter, r *http.Request, p fakePath, body map[string]interface{}) {
+	link := p.link()
+	res, ok := f.resources[link]
+	if !ok {
+		fakeError(w, http.StatusNotFound, "notFound", "The resource '%s' was not found", link)
+		return
+	}
+	q := r.URL.Query()
+	switch p.method {
+	case "serialPort":
+		f.serialPort(w, link, q.Get("port"), q.Get("start"))
+		return
+	case "getGuestAttributes":
+		f.guestAttributes(w, link, q.Get("queryPath"), q.Get("variableKey"))
+		return
+	case "start":
+		res["status"] = "STAGING"
+	case "stop":
+		res["status"] = "TERMINATED"
+	case "attachDisk":
+		src, _ := body["source"].(string)
+		dl := normalize(p.project, src)
+		disk, ok := f.resources[dl]
+		if !ok {
+			fakeError(w, http.StatusNotFound, "notFound", "The resource '%s' was not found", dl)
+			return
+		}
+		users, _ := disk["users"].([]interface{})
+		disk["users"] = append(users, fakeLinkPrefix+link)
+		if _, ok := body["deviceName"]; !ok {
+			dp, _ := parseFakePath(dl)
+			body["deviceName"] = dp.name
+		}
+		body["source"] = fakeLinkPrefix + dl
+		disks, _ := res["disks"].([]interface{})
+		res["disks"] = append(disks, body)
+	case "detachDisk":
+		disks, _ := res["disks"].([]interface{})
+		var kept []interface{}
+		for _, d := range disks {
+			ad, _ := d.(map[string]interface{})
+			if ad["deviceName"] == q.Get("deviceName") {
+				src, _ := ad["source"].(string)
+				f.detach(normalize(p.project, src), link)
+				continue
+			}
+			kept = append(kept, d)
+		}
+		if len(kept) == len(disks) {
+			fakeError(w, http.StatusBadRequest, "invalid", "No attached disk found with device name '%s'", q.Get("deviceName"))
+			return
+		}
+		res["disks"] = kept
+	case "setDiskAutoDelete":
+		disks, _ := res["disks"].([]interface{})
+		for _, d := range disks {
+			if ad, _ := d.(map[string]interface{}); ad["deviceName"] == q.Get("deviceName") {
+				ad["autoDelete"] = q.Get("autoDelete") == "true"
+			}
+		}
+	case "setMetadata":
+		res["metadata"] = body
+	case "setLabels":
+		res["labels"] = body["labels"]
+	case "resize":
+		res["sizeGb"] = body["sizeGb"]
+	case "deprecate":
+		res["deprecated"] = body
+	case "createSnapshot":
+		name, _ := body["name"].(string)
+		sp := fakePath{project: p.project, scope: "global", collection: "snapshots", name: name}
+		if _, ok := f.resources[sp.link()]; ok {
+			fakeError(w, http.StatusConflict, "alreadyExists", "The resource '%s' already exists", sp.link())
+			return
+		}
+		body["sourceDisk"] = fakeLinkPrefix + link
+		body["diskSizeGb"] = res["sizeGb"]
+		body["status"] = "READY"
+		f.store(sp, body)
+	}
+	writeFakeJSON(w, f.operation(p, p.method, link))
+}
+
+// advance moves an instance to its next status, as if time had passed.
+func (f *FakeClient) advance(link string) {
+	res := f.resources[link]
+	inst := f.instances[link]
+	if res == nil || inst == nil {
+		return
+	}
+	switch res["status"] {
+	case "PROVISIONING":
+		res["status"] = "STAGING"
+	case "STAGING":
+		res["status"] = "RUNNING"
+		f.boot(inst)
+	case "RUNNING":
+		if inst.script != nil && inst.script.Shutdown && inst.outputRead() {
+			res["status"] = "STOPPING"
+		}
+	case "STOPPING":
+		res["status"] = "TERMINATED"
+	}
+}
+
+func (f *FakeClient) boot(inst *fakeInstance) {
+	if inst.script == nil {
+		return
+	}
+	for port, out := range inst.script.SerialOutput {
+		inst.serial[port] += out
+	}
+	for k, v := range inst.script.GuestAttributes {
+		inst.guestAttrs[k] = v
+	}
+}
+
+func (inst *fakeInstance) outputRead() bool {
+	for port, out := range inst.serial {
+		if inst.read[port] < int64(len(out)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *FakeClient) serialPort(w http.ResponseWriter, link, portStr, startStr string) {
+	f.advance(link)
+	inst := f.instances[link]
+	port, _ := strconv.ParseInt(portStr, 10, 64)
+	if port == 0 {
+		port = 1
+	}
+	start, _ := strconv.ParseInt(startStr, 10, 64)
+	out := inst.serial[port]
+	if start > int64(len(out)) {
+		start = int64(len(out))
+	}
+	next := int64(len(out))
+	if next > inst.read[port] {
+		inst.read[port] = next
+	}
+	writeFakeJSON(w, map[string]interface{}{
+		"kind": "compute#serialPortOutput", "contents": out[start:],
+		"start": strconv.FormatInt(start, 10), "next": strconv.FormatInt(next, 10),
+	})
+}
+
+func (f *FakeClient) guestAttributes(w http.ResponseWriter, link, queryPath, variableKey string) {
+	inst := f.instances[link]
+	if variableKey != "" {
+		v, ok := inst.guestAttrs[variableKey]
+		if !ok {
+			fakeError(w, http.StatusNotFound, "notFound", "The resource 'guestAttributes/%s' was not found", variableKey)
+			return
+		}
+		writeFakeJSON(w, map[string]interface{}{"variableKey": variableKey, "variableValue": v})
+		return
+	}
+	var keys []string
+	for k := range inst.guestAttrs {
+		if strings.HasPrefix(k, strings.TrimSuffix(queryPath, "*")) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		fakeError(w, http.StatusNotFound, "notFound", "The resource 'guestAttributes/%s' was not found", queryPath)
+		return
+	}
+	sort.Strings(keys)
+	var items []interface{}
+	for _, k := range keys {
+		i := strings.LastIndex(k, "/")
+		items = append(items, map[string]interface{}{"namespace": k[:i], "key": k[i+1:], "value": inst.guestAttrs[k]})
+	}
+	writeFakeJSON(w, map[string]interface{}{"queryPath": queryPath, "queryValue": map[string]interface{}{"items": items}})
+}
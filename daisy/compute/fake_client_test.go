@@ -0,0 +1,149 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func TestFakeClientInstanceLifecycle(t *testing.T) {
+	f, err := NewFakeClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.ScriptInstances("inst", InstanceScript{
+		SerialOutput:    map[int64]string{1: "booting\nSUCCESS\n"},
+		GuestAttributes: map[string]string{"daisy/status": "done"},
+		Shutdown:        true,
+	})
+	p, z := "p", "us-central1-a"
+
+	if err := f.CreateDisk(p, z, &compute.Disk{Name: "data", SizeGb: 20}); err != nil {
+		t.Fatalf("error creating disk: %v", err)
+	}
+	i := &compute.Instance{
+		Name: "inst-1",
+		Disks: []*compute.AttachedDisk{
+			{InitializeParams: &compute.AttachedDiskInitializeParams{SourceImage: "projects/debian-cloud/global/images/family/debian-10"}},
+			{Source: "zones/us-central1-a/disks/data"},
+		},
+	}
+	if err := f.CreateInstance(p, z, i); err != nil {
+		t.Fatalf("error creating instance: %v", err)
+	}
+	// CreateInstance reads the instance back, which advances its status.
+	if i.Status != "STAGING" || len(i.Disks) != 2 || !i.Disks[0].AutoDelete || i.Disks[1].AutoDelete {
+		t.Errorf("unexpected created instance: %+v", i)
+	}
+	if err := f.CreateInstance(p, z, &compute.Instance{Name: "inst-1"}); !isCode(err, http.StatusConflict) {
+		t.Errorf("creating an existing instance should fail with 409, got %v", err)
+	}
+
+	var statuses []string
+	for j := 0; j < 2; j++ {
+		s, err := f.InstanceStatus(p, z, "inst-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, s)
+	}
+	if want := []string{"RUNNING", "RUNNING"}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("got statuses %v, want %v", statuses, want)
+	}
+
+	ga, err := f.GetGuestAttributes(p, z, "inst-1", "", "daisy/status")
+	if err != nil || ga.VariableValue != "done" {
+		t.Errorf("unexpected guest attribute: %v, %v", ga, err)
+	}
+	sp, err := f.GetSerialPortOutput(p, z, "inst-1", 1, 8)
+	if err != nil || sp.Contents != "SUCCESS\n" || sp.Next != 16 {
+		t.Errorf("unexpected serial output: %+v, %v", sp, err)
+	}
+	// All output was read, the guest shuts down.
+	for _, want := range []string{"STOPPING", "TERMINATED"} {
+		if s, _ := f.InstanceStatus(p, z, "inst-1"); s != want {
+			t.Errorf("got status %q, want %q", s, want)
+		}
+	}
+
+	if err := f.DeleteDisk(p, z, "data"); !isCode(err, http.StatusBadRequest) {
+		t.Errorf("deleting a disk in use should fail with 400, got %v", err)
+	}
+	if err := f.DeleteInstance(p, z, "inst-1"); err != nil {
+		t.Fatalf("error deleting instance: %v", err)
+	}
+	// The boot disk is auto-deleted, the data disk is detached.
+	if got, want := f.Resources("disks"), []string{"projects/p/zones/us-central1-a/disks/data"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got disks %v, want %v", got, want)
+	}
+	if err := f.DeleteDisk(p, z, "data"); err != nil {
+		t.Errorf("error deleting detached disk: %v", err)
+	}
+	if _, err := f.GetDisk(p, z, "data"); !isCode(err, http.StatusNotFound) {
+		t.Errorf("deleted disk should not exist, got %v", err)
+	}
+}
+
+func TestFakeClientImages(t *testing.T) {
+	f, err := NewFakeClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := f.CreateImage("p", &compute.Image{Name: "img", SourceDisk: "zones/z/disks/dne"}); !isCode(err, http.StatusNotFound) {
+		t.Errorf("creating an image from a missing disk should fail with 404, got %v", err)
+	}
+	if err := f.CreateImage("p", &compute.Image{Name: "img", Family: "fam", SourceImage: "projects/debian-cloud/global/images/debian-10"}); err != nil {
+		t.Fatalf("error creating image: %v", err)
+	}
+	if img, err := f.GetImageFromFamily("p", "fam"); err != nil || img.Name != "img" {
+		t.Errorf("unexpected image from family: %v, %v", img, err)
+	}
+	if _, err := f.GetImageFromFamily("p", "dne"); !isCode(err, http.StatusNotFound) {
+		t.Errorf("missing family should return 404, got %v", err)
+	}
+	if img, err := f.GetImageFromFamily("debian-cloud", "debian-10"); err != nil || img.Family != "debian-10" {
+		t.Errorf("public image families should exist: %v, %v", img, err)
+	}
+	if is, err := f.ListImages("p"); err != nil || len(is) != 1 {
+		t.Errorf("unexpected images: %v, %v", is, err)
+	}
+	if zs, err := f.ListZones("p"); err != nil || len(zs) != len(DefaultFakeZones) {
+		t.Errorf("unexpected zones: %v, %v", zs, err)
+	}
+	if _, err := f.GetMachineType("p", "us-central1-a", "n1-standard-2"); err != nil {
+		t.Errorf("unexpected machine type error: %v", err)
+	}
+
+	md := &compute.Metadata{Items: []*compute.MetadataItems{{Key: "k", Value: googleapi.String("v")}}}
+	if err := f.SetCommonInstanceMetadata("p", md); err != nil {
+		t.Fatal(err)
+	}
+	if pr, err := f.GetProject("p"); err != nil || len(pr.CommonInstanceMetadata.Items) != 1 {
+		t.Errorf("project metadata not stored: %v, %v", pr, err)
+	}
+}
+
+func isCode(err error, code int) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == code
+}
@@ -56,6 +56,7 @@ type TestClient struct {
 	CreateFirewallRuleFn        func(project string, i *compute.Firewall) error
 	CreateImageFn               func(project string, i *compute.Image) error
 	CreateInstanceFn            func(project, zone string, i *compute.Instance) error
+	CreateInstanceTemplateFn    func(project string, it *compute.InstanceTemplate) error
 	CreateNetworkFn             func(project string, n *compute.Network) error
 	CreateSnapshotFn            func(project, zone, disk string, s *compute.Snapshot) error
 	CreateSubnetworkFn          func(project, region string, n *compute.Subnetwork) error
@@ -78,6 +79,7 @@ type TestClient struct {
 	GetZoneFn                   func(project, zone string) (*compute.Zone, error)
 	ListZonesFn                 func(project string, opts ...ListCallOption) ([]*compute.Zone, error)
 	GetInstanceFn               func(project, zone, name string) (*compute.Instance, error)
+	GetInstanceTemplateFn       func(project, name string) (*compute.InstanceTemplate, error)
 	AggregatedListInstancesFn   func(project string, opts ...ListCallOption) ([]*compute.Instance, error)
 	ListInstancesFn             func(project, zone string, opts ...ListCallOption) ([]*compute.Instance, error)
 	ListSnapshotsFn             func(project string, opts ...ListCallOption) ([]*compute.Snapshot, error)
@@ -189,6 +191,14 @@ func (c *TestClient) CreateInstance(project, zone string, i *compute.Instance) e
 	return c.client.CreateInstance(project, zone, i)
 }
 
+// CreateInstanceTemplate uses the override method CreateInstanceTemplateFn or the real implementation.
+func (c *TestClient) CreateInstanceTemplate(project string, it *compute.InstanceTemplate) error {
+	if c.CreateInstanceTemplateFn != nil {
+		return c.CreateInstanceTemplateFn(project, it)
+	}
+	return c.client.CreateInstanceTemplate(project, it)
+}
+
 // CreateNetwork uses the override method CreateNetworkFn or the real implementation.
 func (c *TestClient) CreateNetwork(project string, n *compute.Network) error {
 	if c.CreateNetworkFn != nil {
@@ -381,6 +391,14 @@ func (c *TestClient) GetInstance(project, zone, name string) (*compute.Instance,
 	return c.client.GetInstance(project, zone, name)
 }
 
+// GetInstanceTemplate uses the override method GetInstanceTemplateFn or the real implementation.
+func (c *TestClient) GetInstanceTemplate(project, name string) (*compute.InstanceTemplate, error) {
+	if c.GetInstanceTemplateFn != nil {
+		return c.GetInstanceTemplateFn(project, name)
+	}
+	return c.client.GetInstanceTemplate(project, name)
+}
+
 // ListInstances uses the override method ListInstancesFn or the real implementation.
 func (c *TestClient) ListInstances(project, zone string, opts ...ListCallOption) ([]*compute.Instance, error) {
 	if c.ListInstancesFn != nil {
@@ -51,6 +51,7 @@ func TestTestClient(t *testing.T) {
 		{"create firewall rule", func() { c.CreateFirewallRule("a", &compute.Firewall{}) }, "/projects/a/global/firewalls?alt=json&prettyPrint=false"},
 		{"create image", func() { c.CreateImage("a", &compute.Image{}) }, "/projects/a/global/images?alt=json&prettyPrint=false"},
 		{"create instance", func() { c.CreateInstance("a", "b", &compute.Instance{}) }, "/projects/a/zones/b/instances?alt=json&prettyPrint=false"},
+		{"create instance template", func() { c.CreateInstanceTemplate("a", &compute.InstanceTemplate{}) }, "/projects/a/global/instanceTemplates?alt=json&prettyPrint=false"},
 		{"create network", func() { c.CreateNetwork("a", &compute.Network{}) }, "/projects/a/global/networks?alt=json&prettyPrint=false"},
 		{"create subnetwork", func() { c.CreateSubnetwork("a", "b", &compute.Subnetwork{}) }, "/projects/a/regions/b/subnetworks?alt=json&prettyPrint=false"},
 		{"instances start", func() { c.StartInstance("a", "b", "c") }, "/projects/a/zones/b/instances/c/start?alt=json&prettyPrint=false"},
@@ -71,6 +72,7 @@ func TestTestClient(t *testing.T) {
 		{"get zone", func() { c.GetZone("a", "b") }, "/projects/a/zones/b?alt=json&prettyPrint=false"},
 		{"list zones", func() { c.ListZones("a", listOpts...) }, "/projects/a/zones?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"get instance", func() { c.GetInstance("a", "b", "c") }, "/projects/a/zones/b/instances/c?alt=json&prettyPrint=false"},
+		{"get instance template", func() { c.GetInstanceTemplate("a", "b") }, "/projects/a/global/instanceTemplates/b?alt=json&prettyPrint=false"},
 		{"aggregated list instances", func() { c.AggregatedListInstances("a", listOpts...) }, "/projects/a/aggregated/instances?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"list instances", func() { c.ListInstances("a", "b", listOpts...) }, "/projects/a/zones/b/instances?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"get image from family", func() { c.GetImageFromFamily("a", "b") }, "/projects/a/global/images/family/b?alt=json&prettyPrint=false"},
@@ -133,6 +135,7 @@ func TestTestClient(t *testing.T) {
 	c.CreateFirewallRuleFn = func(_ string, _ *compute.Firewall) error { fakeCalled = true; return nil }
 	c.CreateImageFn = func(_ string, _ *compute.Image) error { fakeCalled = true; return nil }
 	c.CreateInstanceFn = func(_, _ string, _ *compute.Instance) error { fakeCalled = true; return nil }
+	c.CreateInstanceTemplateFn = func(_ string, _ *compute.InstanceTemplate) error { fakeCalled = true; return nil }
 	c.CreateNetworkFn = func(_ string, _ *compute.Network) error { fakeCalled = true; return nil }
 	c.CreateSubnetworkFn = func(_, _ string, _ *compute.Subnetwork) error { fakeCalled = true; return nil }
 	c.StartInstanceFn = func(_, _, _ string) error { fakeCalled = true; return nil }
@@ -160,6 +163,7 @@ func TestTestClient(t *testing.T) {
 		return nil, nil
 	}
 	c.GetInstanceFn = func(_, _, _ string) (*compute.Instance, error) { fakeCalled = true; return nil, nil }
+	c.GetInstanceTemplateFn = func(_, _ string) (*compute.InstanceTemplate, error) { fakeCalled = true; return nil, nil }
 	c.AggregatedListInstancesFn = func(_ string, _ ...ListCallOption) ([]*compute.Instance, error) {
 		fakeCalled = true
 		return nil, nil
@@ -37,6 +37,7 @@ import (
 
 	"github.com/GoogleCloudPlatform/compute-image-tools/daisy"
 	daisyCompute "github.com/GoogleCloudPlatform/compute-image-tools/daisy/compute"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy/fakegcs"
 	"github.com/google/uuid"
 	"google.golang.org/api/compute/v1"
 )
@@ -57,6 +58,10 @@ var (
 	filter        = flag.String("filter", "", "test name filter")
 	outPath       = flag.String("out_path", "junit.xml", "junit xml path")
 	parallelCount = flag.Int("parallel_count", 0, "TestParallelCount")
+	fake          = flag.Bool("fake", false, "run the tests against in-memory fakes of GCE and GCS instead of real projects")
+
+	fakeCompute *daisyCompute.FakeClient
+	fakeStorage *fakegcs.Server
 
 	funcMap = map[string]interface{}{
 		"randItem": randItem,
@@ -133,6 +138,10 @@ type TestCase struct {
 	// impact other concurrent test runs.
 	ProjectLock       bool
 	CustomProjectLock string
+
+	// Scripted guest behavior for instances created by this test when running
+	// with -fake, keyed by instance name prefix.
+	FakeInstances map[string]daisyCompute.InstanceScript
 }
 
 type logger struct {
@@ -173,6 +182,14 @@ func createTestCase(ctx context.Context, testLogger *logger, path, project, zone
 		w.ComputeEndpoint = ce
 	}
 
+	if fakeCompute != nil {
+		w.ComputeClient = fakeCompute
+		if w.StorageClient, err = fakeStorage.Client(ctx); err != nil {
+			return nil, err
+		}
+		w.DisableCloudLogging()
+	}
+
 	if err := w.PopulateClients(ctx); err != nil {
 		return nil, err
 	}
@@ -220,6 +237,9 @@ func createTestSuite(ctx context.Context, path string, varMap map[string]string,
 	if *projects != "" {
 		t.Projects = strings.Split(*projects, ",")
 	}
+	if fakeCompute != nil && len(t.Projects) == 0 {
+		t.Projects = []string{"fake-project"}
+	}
 	if len(t.Projects) == 0 {
 		return nil, errors.New("no projects provided")
 	}
@@ -280,6 +300,15 @@ func createTestSuite(ctx context.Context, path string, varMap map[string]string,
 			computeEndpoint = test.ComputeEndpoint
 		}
 
+		if fakeCompute != nil {
+			if zone != "" {
+				fakeCompute.AddZones(zone)
+			}
+			for prefix, script := range test.FakeInstances {
+				fakeCompute.ScriptInstances(prefix, script)
+			}
+		}
+
 		rand.Seed(time.Now().UnixNano())
 		test.logger = &logger{}
 		w, err := createTestCase(ctx, test.logger, wfPath, t.Projects[rand.Intn(len(t.Projects))], zone, oauthPath, computeEndpoint, varMap)
@@ -629,6 +658,16 @@ func main() {
 
 	ctx := context.Background()
 
+	if *fake {
+		var err error
+		if fakeCompute, err = daisyCompute.NewFakeClient(); err != nil {
+			log.Fatalln("error creating fake compute backend:", err)
+		}
+		defer fakeCompute.Close()
+		fakeStorage = fakegcs.NewServer()
+		defer fakeStorage.Close()
+	}
+
 	ts, err := createTestSuite(ctx, flag.Arg(0), varMap, regex)
 	if err != nil {
 		log.Fatalln("test case creation error:", err)
@@ -0,0 +1,143 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType identifies what an Event reports.
+type EventType string
+
+// Types of events emitted while a workflow runs.
+const (
+	EventStepStarted         EventType = "StepStarted"
+	EventStepFinished        EventType = "StepFinished"
+	EventStepFailed          EventType = "StepFailed"
+	EventResourceCreated     EventType = "ResourceCreated"
+	EventResourceDeleted     EventType = "ResourceDeleted"
+	EventSerialMatch         EventType = "SerialMatch"
+	EventGuestAttributeMatch EventType = "GuestAttributeMatch"
+	EventCleanup             EventType = "Cleanup"
+)
+
+// Event is a structured record of something that happened while running a
+// workflow. Unlike LogEntry, events are meant to be consumed by tools.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     EventType `json:"type"`
+	Workflow string    `json:"workflow"`
+	Step     string    `json:"step,omitempty"`
+	StepType string    `json:"stepType,omitempty"`
+	// Seconds spent in the step, or in cleanup, for events ending those.
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	// Partial URL and collection (e.g. "disks") of the resource.
+	Resource     string `json:"resource,omitempty"`
+	ResourceType string `json:"resourceType,omitempty"`
+	// Instance whose serial output or guest attribute matched, which match
+	// kind (SuccessMatch, FailureMatch, StatusMatch, SuccessValue or
+	// FailureValue) and the matching output.
+	Instance  string `json:"instance,omitempty"`
+	MatchKind string `json:"matchKind,omitempty"`
+	Match     string `json:"match,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// EventSink receives the events of a workflow. WriteEvent may be called
+// concurrently from the goroutines running steps.
+type EventSink interface {
+	WriteEvent(e *Event)
+}
+
+// EventSinkFunc adapts a function to an EventSink.
+type EventSinkFunc func(e *Event)
+
+// WriteEvent calls f(e).
+func (f EventSinkFunc) WriteEvent(e *Event) {
+	f(e)
+}
+
+type jsonEventSink struct {
+	enc *json.Encoder
+	mx  sync.Mutex
+}
+
+// NewJSONEventSink returns an EventSink writing one JSON object per line to
+// out, e.g. a file or os.Stdout.
+func NewJSONEventSink(out io.Writer) EventSink {
+	return &jsonEventSink{enc: json.NewEncoder(out)}
+}
+
+func (s *jsonEventSink) WriteEvent(e *Event) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.enc.Encode(e)
+}
+
+// AddEventSink registers sink to receive the events of this workflow and of
+// its included and sub workflows.
+func (w *Workflow) AddEventSink(sink EventSink) {
+	w.eventSinksMx.Lock()
+	defer w.eventSinksMx.Unlock()
+	w.eventSinks = append(w.eventSinks, sink)
+}
+
+// emitEvent stamps e and delivers it to the sinks of w and its ancestors.
+func (w *Workflow) emitEvent(e *Event) {
+	e.Time = time.Now()
+	e.Workflow = getAbsoluteName(w)
+	for rw := w; rw != nil; rw = rw.parent {
+		rw.eventSinksMx.Lock()
+		sinks := rw.eventSinks
+		rw.eventSinksMx.Unlock()
+		for _, sink := range sinks {
+			sink.WriteEvent(e)
+		}
+	}
+	if a := w.serialLogArchive(); a != nil {
+		a.recordSignal(e)
+	}
+}
+
+// emitStepEvent emits an event of type t for step s.
+func (s *Step) emitStepEvent(t EventType, stepType string, startTime time.Time, err DError) {
+	e := &Event{Type: t, Step: s.name, StepType: stepType}
+	if t != EventStepStarted {
+		e.DurationSeconds = time.Since(startTime).Seconds()
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.w.emitEvent(e)
+}
+
+// emitResourceEvent emits an event of type t for the resource at link.
+func emitResourceEvent(s *Step, w *Workflow, t EventType, link string) {
+	e := &Event{Type: t, Resource: link}
+	if parts := strings.Split(link, "/"); len(parts) > 1 {
+		e.ResourceType = parts[len(parts)-2]
+	}
+	if s != nil {
+		e.Step = s.name
+		w = s.w
+	}
+	if w != nil {
+		w.emitEvent(e)
+	}
+}
@@ -0,0 +1,110 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type eventRecorder struct {
+	events []Event
+	mx     sync.Mutex
+}
+
+func (r *eventRecorder) WriteEvent(e *Event) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	// Only compare the fields that are deterministic.
+	r.events = append(r.events, Event{Type: e.Type, Workflow: e.Workflow, Step: e.Step, StepType: e.StepType, Resource: e.Resource, ResourceType: e.ResourceType, Error: e.Error})
+}
+
+func TestStepEvents(t *testing.T) {
+	w := testWorkflow()
+	w.disks.baseResourceRegistry.deleteFn = func(res *Resource) DError { return nil }
+	w.Steps["s1"] = &Step{name: "s1", w: w, timeout: time.Minute, testType: &mockStep{
+		runImpl: func(ctx context.Context, s *Step) DError {
+			w.disks.m["d1"].markCreated()
+			return w.disks.delete("d1")
+		},
+	}}
+	w.Steps["s2"] = &Step{name: "s2", w: w, timeout: time.Minute, testType: &mockStep{
+		runImpl: func(ctx context.Context, s *Step) DError { return Errf("fail") },
+	}}
+	w.Dependencies["s2"] = []string{"s1"}
+	w.disks.m = map[string]*Resource{
+		"d1": {link: "projects/p/zones/z/disks/d1", creator: w.Steps["s1"], deleter: w.Steps["s1"]},
+	}
+
+	r := &eventRecorder{}
+	w.AddEventSink(r)
+	if err := w.run(context.Background()); err == nil {
+		t.Fatal("expected run error")
+	}
+
+	want := []Event{
+		{Type: EventStepStarted, Workflow: testWf, Step: "s1", StepType: "mockStep"},
+		{Type: EventResourceCreated, Workflow: testWf, Step: "s1", Resource: "projects/p/zones/z/disks/d1", ResourceType: "disks"},
+		{Type: EventResourceDeleted, Workflow: testWf, Step: "s1", Resource: "projects/p/zones/z/disks/d1", ResourceType: "disks"},
+		{Type: EventStepFinished, Workflow: testWf, Step: "s1", StepType: "mockStep"},
+		{Type: EventStepStarted, Workflow: testWf, Step: "s2", StepType: "mockStep"},
+		{Type: EventStepFailed, Workflow: testWf, Step: "s2", StepType: "mockStep", Error: `step "s2" run error: fail`},
+	}
+	if diffRes := diff(r.events, want, 0); diffRes != "" {
+		t.Errorf("events don't match expectation: (-got +want)\n%s", diffRes)
+	}
+}
+
+func TestEventsReachParent(t *testing.T) {
+	w := testWorkflow()
+	sw := w.NewSubWorkflow()
+	sw.Name = "child"
+	r := &eventRecorder{}
+	w.AddEventSink(r)
+
+	sw.emitEvent(&Event{Type: EventCleanup})
+	want := []Event{{Type: EventCleanup, Workflow: testWf + ".child"}}
+	if diffRes := diff(r.events, want, 0); diffRes != "" {
+		t.Errorf("events don't match expectation: (-got +want)\n%s", diffRes)
+	}
+}
+
+func TestJSONEventSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONEventSink(&buf)
+	sink.WriteEvent(&Event{Type: EventSerialMatch, Workflow: "wf", Step: "wait", Instance: "i", MatchKind: "SuccessMatch", Match: "done"})
+	sink.WriteEvent(&Event{Type: EventCleanup, Workflow: "wf"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, got %d: %q", len(lines), buf.String())
+	}
+	var got Event
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("error unmarshalling event: %v", err)
+	}
+	want := Event{Type: EventSerialMatch, Workflow: "wf", Step: "wait", Instance: "i", MatchKind: "SuccessMatch", Match: "done"}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("event doesn't match expectation: (-got +want)\n%s", diffRes)
+	}
+	if strings.Contains(lines[1], "resource") {
+		t.Errorf("empty fields should be omitted: %s", lines[1])
+	}
+}
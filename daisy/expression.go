@@ -0,0 +1,445 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// varRefRgx matches the innermost ${...} references of a string, so that
+// `${SOURCE:${NAME}.sh}` is substituted from the inside out.
+var varRefRgx = regexp.MustCompile(`\$\{([^{}]*)}`)
+
+// substituteVars replaces the var references in the strings of v. A
+// reference is either the name of a var, such as `${disk-name}`, or an
+// expression over vars, such as `${lower(NAME)}`, `${DISK_SIZE + 10}` or
+// `${ZONE ?: "us-central1-a"}`.
+//
+// References to unknown vars, and references that aren't expressions, such as
+// `${SOURCE:file}`, are kept, since they are substituted by later passes.
+// So are references that only have literals, such as `${1}` or `${"x"}`.
+func substituteVars(v reflect.Value, vars map[string]string) DError {
+	return traverseData(v, func(val reflect.Value) DError {
+		switch val.Interface().(type) {
+		case string:
+			s, err := expandVars(val.String(), vars)
+			if err != nil {
+				return err
+			}
+			val.SetString(s)
+		}
+		return nil
+	})
+}
+
+// expandVars replaces the var references of s.
+func expandVars(s string, vars map[string]string) (string, DError) {
+	var errs DError
+	res := varRefRgx.ReplaceAllStringFunc(s, func(ref string) string {
+		content := ref[2 : len(ref)-1]
+		if v, ok := vars[content]; ok {
+			return v
+		}
+		e, err := parseExpression(content)
+		if err != nil || !e.dynamic() || !e.resolvable(vars) {
+			return ref
+		}
+		v, err := e.eval(vars)
+		if err != nil {
+			errs = addErrs(errs, Errf("cannot evaluate %q: %v", ref, err))
+			return ref
+		}
+		return v
+	})
+	return res, errs
+}
+
+// Values of expressions are strings. Operators and functions that need
+// numbers or booleans parse them from their operands.
+type expression interface {
+	eval(vars map[string]string) (string, error)
+	// resolvable reports whether the vars of the expression are known.
+	resolvable(vars map[string]string) bool
+	// dynamic reports whether the expression has a var or a function call.
+	dynamic() bool
+}
+
+type literalExpr string
+
+func (e literalExpr) eval(map[string]string) (string, error) { return string(e), nil }
+func (e literalExpr) resolvable(map[string]string) bool      { return true }
+func (e literalExpr) dynamic() bool                          { return false }
+
+type varExpr string
+
+func (e varExpr) eval(vars map[string]string) (string, error) { return vars[string(e)], nil }
+func (e varExpr) resolvable(vars map[string]string) bool {
+	_, ok := vars[string(e)]
+	return ok
+}
+func (e varExpr) dynamic() bool { return true }
+
+type unaryExpr struct {
+	op      string
+	operand expression
+}
+
+func (e unaryExpr) eval(vars map[string]string) (string, error) {
+	v, err := e.operand.eval(vars)
+	if err != nil {
+		return "", err
+	}
+	if e.op == "!" {
+		return strconv.FormatBool(!truthy(v)), nil
+	}
+	i, err := toInt(v)
+	if err != nil {
+		return "", err
+	}
+	if i == math.MinInt64 {
+		return "", fmt.Errorf("integer overflow in -%d", i)
+	}
+	return strconv.FormatInt(-i, 10), nil
+}
+
+func (e unaryExpr) resolvable(vars map[string]string) bool { return e.operand.resolvable(vars) }
+func (e unaryExpr) dynamic() bool                          { return e.operand.dynamic() }
+
+type binaryExpr struct {
+	op          string
+	left, right expression
+}
+
+func (e binaryExpr) eval(vars map[string]string) (string, error) {
+	l, err := e.left.eval(vars)
+	if err != nil {
+		return "", err
+	}
+	// The right operand of ?:, && and || is only evaluated when needed.
+	switch e.op {
+	case "?:":
+		if l != "" {
+			return l, nil
+		}
+		return e.right.eval(vars)
+	case "&&":
+		if !truthy(l) {
+			return "false", nil
+		}
+		r, err := e.right.eval(vars)
+		return strconv.FormatBool(truthy(r)), err
+	case "||":
+		if truthy(l) {
+			return "true", nil
+		}
+		r, err := e.right.eval(vars)
+		return strconv.FormatBool(truthy(r)), err
+	}
+	r, err := e.right.eval(vars)
+	if err != nil {
+		return "", err
+	}
+	switch e.op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return strconv.FormatBool(compare(e.op, l, r)), nil
+	}
+	li, err := toInt(l)
+	if err != nil {
+		return "", err
+	}
+	ri, err := toInt(r)
+	if err != nil {
+		return "", err
+	}
+	var v int64
+	var overflow bool
+	switch e.op {
+	case "+":
+		v = li + ri
+		overflow = (ri > 0 && v < li) || (ri < 0 && v > li)
+	case "-":
+		v = li - ri
+		overflow = (ri > 0 && v > li) || (ri < 0 && v < li)
+	case "*":
+		v = li * ri
+		overflow = li != 0 && (v/li != ri || (li == -1 && ri == math.MinInt64))
+	default:
+		if ri == 0 {
+			return "", fmt.Errorf("division by zero")
+		}
+		if e.op == "/" {
+			v = li / ri
+			overflow = li == math.MinInt64 && ri == -1
+		} else {
+			v = li % ri
+		}
+	}
+	if overflow {
+		return "", fmt.Errorf("integer overflow in %d %s %d", li, e.op, ri)
+	}
+	return strconv.FormatInt(v, 10), nil
+}
+
+func (e binaryExpr) resolvable(vars map[string]string) bool {
+	return e.left.resolvable(vars) && e.right.resolvable(vars)
+}
+
+func (e binaryExpr) dynamic() bool { return e.left.dynamic() || e.right.dynamic() }
+
+type callExpr struct {
+	name string
+	args []expression
+}
+
+// exprFuncs are the functions of expressions, by name and number of args.
+var exprFuncs = map[string]struct {
+	nargs int
+	f     func(args []string) string
+}{
+	"lower":   {1, func(args []string) string { return strings.ToLower(args[0]) }},
+	"upper":   {1, func(args []string) string { return strings.ToUpper(args[0]) }},
+	"trim":    {1, func(args []string) string { return strings.TrimSpace(args[0]) }},
+	"len":     {1, func(args []string) string { return strconv.Itoa(len(args[0])) }},
+	"replace": {3, func(args []string) string { return strings.Replace(args[0], args[1], args[2], -1) }},
+}
+
+func (e callExpr) eval(vars map[string]string) (string, error) {
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return "", err
+		}
+		args[i] = v
+	}
+	return exprFuncs[e.name].f(args), nil
+}
+
+func (e callExpr) resolvable(vars map[string]string) bool {
+	for _, arg := range e.args {
+		if !arg.resolvable(vars) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e callExpr) dynamic() bool { return true }
+
+func toInt(s string) (int64, error) {
+	i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an integer", s)
+	}
+	return i, nil
+}
+
+// truthy reports whether a value is true: booleans are parsed, and any other
+// value is true if it isn't empty.
+func truthy(s string) bool {
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b
+	}
+	return s != ""
+}
+
+// compare compares integers by value, and anything else as strings.
+func compare(op, l, r string) bool {
+	c := strings.Compare(l, r)
+	if li, err := toInt(l); err == nil {
+		if ri, err := toInt(r); err == nil {
+			c = 0
+			if li < ri {
+				c = -1
+			} else if li > ri {
+				c = 1
+			}
+		}
+	}
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// exprTokenRgx matches the tokens of expressions: identifiers, integers,
+// double quoted strings and operators.
+var exprTokenRgx = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*|[0-9]+|"(?:[^"\\]|\\.)*"|\?:|&&|\|\||[=!<>]=|[-+*/%<>!(),])`)
+
+// exprParser is a recursive descent parser of expressions. From lowest to
+// highest precedence, the operators are ?:, ||, &&, comparisons, + and -,
+// then *, / and %.
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseExpression(s string) (expression, error) {
+	p := &exprParser{}
+	for rest := s; strings.TrimSpace(rest) != ""; {
+		m := exprTokenRgx.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("unexpected %q", strings.TrimSpace(rest))
+		}
+		p.tokens = append(p.tokens, m[1])
+		rest = rest[len(m[0]):]
+	}
+	e, err := p.parseElvis()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *exprParser) parseElvis() (expression, error) {
+	left, err := p.parseBinary(0)
+	if err != nil || p.peek() != "?:" {
+		return left, err
+	}
+	p.next()
+	right, err := p.parseElvis()
+	if err != nil {
+		return nil, err
+	}
+	return binaryExpr{op: "?:", left: left, right: right}, nil
+}
+
+// exprPrecedence lists the binary operators from lowest to highest
+// precedence.
+var exprPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseBinary(level int) (expression, error) {
+	if level == len(exprPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for strIn(p.peek(), exprPrecedence[level]) {
+		op := p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (expression, error) {
+	if op := p.peek(); op == "-" || op == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (expression, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case t == "(":
+		e, err := p.parseElvis()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return e, nil
+	case t[0] == '"':
+		s, err := strconv.Unquote(t)
+		if err != nil {
+			return nil, err
+		}
+		return literalExpr(s), nil
+	case t[0] >= '0' && t[0] <= '9':
+		return literalExpr(t), nil
+	case t == "true" || t == "false":
+		return literalExpr(t), nil
+	case t[0] == '_' || t[0] >= 'A' && t[0] <= 'Z' || t[0] >= 'a' && t[0] <= 'z':
+		if p.peek() != "(" {
+			return varExpr(t), nil
+		}
+		return p.parseCall(t)
+	}
+	return nil, fmt.Errorf("unexpected %q", t)
+}
+
+func (p *exprParser) parseCall(name string) (expression, error) {
+	f, ok := exprFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	p.next() // (
+	call := callExpr{name: name}
+	for p.peek() != ")" {
+		if len(call.args) > 0 && p.next() != "," {
+			return nil, fmt.Errorf("expected , in call of %v", name)
+		}
+		arg, err := p.parseElvis()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+	p.next() // )
+	if len(call.args) != f.nargs {
+		return nil, fmt.Errorf("%v takes %d argument(s), got %d", name, f.nargs, len(call.args))
+	}
+	return call, nil
+}
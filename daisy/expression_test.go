@@ -0,0 +1,121 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandVars(t *testing.T) {
+	vars := map[string]string{
+		"NAME":      "My-Workflow",
+		"DISK_SIZE": "10",
+		"empty":     "",
+		"vm-name":   "vm",
+		"flag":      "true",
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"${NAME}", "My-Workflow"},
+		{"${vm-name}-disk", "vm-disk"},
+		{"${lower(NAME)}", "my-workflow"},
+		{"${upper(trim(\" a \"))}", "A"},
+		{"${replace(NAME, \"-\", \"_\")}", "My_Workflow"},
+		{"${len(NAME)}", "11"},
+		{"${DISK_SIZE + 10}", "20"},
+		{"${DISK_SIZE * 2 - 4 / 2}", "18"},
+		{"${(DISK_SIZE + 2) % 5}", "2"},
+		{"${-DISK_SIZE}", "-10"},
+		{"${empty ?: \"default\"}", "default"},
+		{"${NAME ?: \"default\"}", "My-Workflow"},
+		{"${empty ?: empty ?: DISK_SIZE}", "10"},
+		{"${DISK_SIZE > 9}", "true"},
+		{"${DISK_SIZE == \"10\" && !empty}", "true"},
+		{"${flag || unknown}", "${flag || unknown}"},
+		{"size-${DISK_SIZE + 1}-${NAME}", "size-11-My-Workflow"},
+		// Kept for later passes.
+		{"${unknown}", "${unknown}"},
+		{"${lower(unknown)}", "${lower(unknown)}"},
+		{"${SOURCE:file.sh}", "${SOURCE:file.sh}"},
+		{"${SOURCE:${NAME}.sh}", "${SOURCE:My-Workflow.sh}"},
+		{"${not an expression}", "${not an expression}"},
+		{"${nofunc(NAME)}", "${nofunc(NAME)}"},
+		// Only literals.
+		{"${1}", "${1}"},
+		{"${true}", "${true}"},
+		{"${\"x\"}", "${\"x\"}"},
+		{"${-5}", "${-5}"},
+		{"${1 + 2}", "${1 + 2}"},
+		{"${lower(\"A\")}", "a"},
+		{"${DISK_SIZE + 9223372036854775797}", "9223372036854775807"},
+	}
+	for _, tt := range tests {
+		got, err := expandVars(tt.in, vars)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("%q: want %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestExpandVarsErrors(t *testing.T) {
+	vars := map[string]string{"NAME": "wf", "DISK_SIZE": "10"}
+	tests := []struct {
+		in, wantErr string
+	}{
+		{"${NAME + 1}", `cannot evaluate "${NAME + 1}": "wf" is not an integer`},
+		{"${DISK_SIZE / 0}", `cannot evaluate "${DISK_SIZE / 0}": division by zero`},
+		{"${DISK_SIZE + 9223372036854775807}", "integer overflow in 10 + 9223372036854775807"},
+		{"${-DISK_SIZE - 9223372036854775807}", "integer overflow in -10 - 9223372036854775807"},
+		{"${DISK_SIZE * 1000000000000000000}", "integer overflow in 10 * 1000000000000000000"},
+		{"${-(-DISK_SIZE / 10 - 9223372036854775807)}", "integer overflow in --9223372036854775808"},
+		{"${(-DISK_SIZE / 10 - 9223372036854775807) / -1}", "integer overflow in -9223372036854775808 / -1"},
+	}
+	for _, tt := range tests {
+		_, err := expandVars(tt.in, vars)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: want error %q, got: %v", tt.in, tt.wantErr, err)
+		}
+	}
+}
+
+func TestSubstituteVars(t *testing.T) {
+	type test struct {
+		String    string
+		StringMap map[string]string
+		Slice     []string
+	}
+	got := test{
+		String:    "${lower(NAME)}",
+		StringMap: map[string]string{"key": "${SIZE + 1}"},
+		Slice:     []string{"${unknown ?: \"x\"}", "${SIZE}"},
+	}
+	want := test{
+		String:    "wf",
+		StringMap: map[string]string{"key": "11"},
+		Slice:     []string{"${unknown ?: \"x\"}", "10"},
+	}
+	if err := substituteVars(reflect.ValueOf(&got).Elem(), map[string]string{"NAME": "WF", "SIZE": "10"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("substituteVars result does not match expectation: (-got +want)\n%s", diffRes)
+	}
+}
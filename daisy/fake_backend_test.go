@@ -0,0 +1,168 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-image-tools/daisy/compute"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy/fakegcs"
+)
+
+func TestRunWithFakeBackends(t *testing.T) {
+	ctx := context.Background()
+	c, err := daisyCompute.NewFakeClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.ScriptInstances("inst-build", daisyCompute.InstanceScript{
+		SerialOutput: map[int64]string{1: "installing\nBuildSuccess: done\n"},
+		Shutdown:     true,
+	})
+	gcs := fakegcs.NewServer()
+	defer gcs.Close()
+	gcs.CreateBucket("p", "bkt")
+
+	w := New()
+	w.Logger = &MockLogger{}
+	wf := `{
+	  "Name": "build",
+	  "Project": "p",
+	  "Zone": "us-central1-a",
+	  "GCSPath": "gs://bkt/path",
+	  "Sources": {"script.sh": "./test_data/test.txt"},
+	  "Steps": {
+	    "create-disk": {
+	      "CreateDisks": [{"Name": "disk", "SourceImage": "projects/debian-cloud/global/images/family/debian-10"}]
+	    },
+	    "create-instance": {
+	      "CreateInstances": [{"Name": "inst", "Disks": [{"Source": "disk"}], "StartupScript": "script.sh"}]
+	    },
+	    "wait": {
+	      "WaitForInstancesSignal": [{"Name": "inst", "Interval": "10ms", "SerialOutput": {"Port": 1, "SuccessMatch": "BuildSuccess"}}]
+	    },
+	    "delete-instance": {
+	      "DeleteResources": {"Instances": ["inst"]}
+	    },
+	    "create-image": {
+	      "CreateImages": [{"Name": "image", "SourceDisk": "disk", "Family": "fam", "NoCleanup": true, "ExactName": true}]
+	    }
+	  },
+	  "Dependencies": {
+	    "create-instance": ["create-disk"],
+	    "wait": ["create-instance"],
+	    "delete-instance": ["wait"],
+	    "create-image": ["delete-instance"]
+	  }
+	}`
+	if err := json.Unmarshal([]byte(wf), w); err != nil {
+		t.Fatal(err)
+	}
+	w.workflowDir = "."
+	w.ComputeClient = c
+	w.StorageClient, err = gcs.Client(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.DisableCloudLogging()
+
+	if err := w.Run(ctx); err != nil {
+		t.Fatalf("error running workflow: %v", err)
+	}
+
+	// Only the image is left after cleanup.
+	if got := c.Resources("disks"); len(got) != 0 {
+		t.Errorf("disks should be cleaned up, got %v", got)
+	}
+	if got := c.Resources("instances"); len(got) != 0 {
+		t.Errorf("instances should be deleted, got %v", got)
+	}
+	if got, want := c.Resources("images"), []string{"projects/p/global/images/image"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got images %v, want %v", got, want)
+	}
+	if _, ok := gcs.ReadObject("bkt", w.sourcesPath+"/script.sh"); !ok {
+		t.Errorf("source not uploaded, objects: %v", gcs.Objects("bkt"))
+	}
+}
+
+func TestRunDaisyWorkflowWithFakeBackends(t *testing.T) {
+	ctx := context.Background()
+	c, err := daisyCompute.NewFakeClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.ScriptInstances("inst-disk-export", daisyCompute.InstanceScript{
+		SerialOutput: map[int64]string{1: "GCEExport: exporting disk\nExportSuccess\n"},
+		Shutdown:     true,
+	})
+	if err := c.CreateDisk("p", "us-central1-a", &compute.Disk{Name: "source-disk"}); err != nil {
+		t.Fatal(err)
+	}
+	gcs := fakegcs.NewServer()
+	defer gcs.Close()
+	gcs.CreateBucket("p", "bkt")
+
+	w, err := NewFromFile("../daisy_workflows/export/disk_export.wf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Logger = &MockLogger{}
+	w.Project = "p"
+	w.Zone = "us-central1-a"
+	w.GCSPath = "gs://bkt/path"
+	w.AddVar("source_disk", "projects/p/zones/us-central1-a/disks/source-disk")
+	w.AddVar("destination", "gs://bkt/export/disk.tar.gz")
+	// The default worker image is in a project that the fake doesn't have.
+	w.AddVar("export_instance_disk_image", "projects/debian-cloud/global/images/family/debian-10")
+	w.ComputeClient = c
+	if w.StorageClient, err = gcs.Client(ctx); err != nil {
+		t.Fatal(err)
+	}
+	w.DisableCloudLogging()
+	// Check for the signal without waiting for the default interval.
+	for _, is := range *w.Steps["wait-for-inst-${NAME}"].WaitForInstancesSignal {
+		is.Interval = "10ms"
+	}
+	// The fake guest doesn't run the export script, write what it uploads.
+	w.AddEventSink(EventSinkFunc(func(e *Event) {
+		if e.Type == EventSerialMatch && e.MatchKind == "SuccessMatch" {
+			gcs.WriteObject(w.bucket, w.outsPath+"/disk-export.tar.gz", []byte("exported"))
+		}
+	}))
+
+	if err := w.Run(ctx); err != nil {
+		t.Fatalf("error running workflow: %v", err)
+	}
+
+	if got, ok := gcs.ReadObject("bkt", "export/disk.tar.gz"); !ok || string(got) != "exported" {
+		t.Errorf("export not copied to destination, objects: %v", gcs.Objects("bkt"))
+	}
+	if _, ok := gcs.ReadObject("bkt", w.sourcesPath+"/disk-export_export_disk.sh"); !ok {
+		t.Errorf("export script not uploaded, objects: %v", gcs.Objects("bkt"))
+	}
+	if got := c.Resources("instances"); len(got) != 0 {
+		t.Errorf("instances should be deleted, got %v", got)
+	}
+	if got, want := c.Resources("disks"), []string{"projects/p/zones/us-central1-a/disks/source-disk"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got disks %v, want %v", got, want)
+	}
+}
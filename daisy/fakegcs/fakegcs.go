@@ -0,0 +1,490 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package fakegcs provides an in-memory fake of the Google Cloud Storage APIs
+// used by Daisy, for running workflows without a GCP project.
+package fakegcs
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+	metadata    map[string]string
+	generation  int64
+	updated     time.Time
+}
+
+type bucket struct {
+	project string
+	objects map[string]*object
+}
+
+type upload struct {
+	bucket string
+	attrs  objectAttrs
+	data   []byte
+}
+
+// objectAttrs are the writable fields of the JSON representation of objects.
+type objectAttrs struct {
+	Name        string            `json:"name"`
+	ContentType string            `json:"contentType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// Server is a fake GCS server. Buckets and objects only live in memory.
+// Both the JSON API and the XML API used by storage.Reader are served.
+type Server struct {
+	ts *httptest.Server
+
+	mx         sync.Mutex
+	buckets    map[string]*bucket
+	uploads    map[string]*upload
+	generation int64
+}
+
+// NewServer starts a fake GCS server. It must be closed with Close.
+func NewServer() *Server {
+	s := &Server{buckets: map[string]*bucket{}, uploads: map[string]*upload{}}
+	// storage.Reader always uses https, hence the TLS server.
+	s.ts = httptest.NewTLSServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.ts.Close()
+}
+
+// URL returns the endpoint of the server.
+func (s *Server) URL() string {
+	return s.ts.URL
+}
+
+// Client returns a storage client talking to the server.
+func (s *Server) Client(ctx context.Context) (*storage.Client, error) {
+	return storage.NewClient(ctx, option.WithEndpoint(s.ts.URL), option.WithHTTPClient(s.ts.Client()))
+}
+
+// CreateBucket creates a bucket owned by project, if it doesn't exist yet.
+func (s *Server) CreateBucket(project, name string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if _, ok := s.buckets[name]; !ok {
+		s.buckets[name] = &bucket{project: project, objects: map[string]*object{}}
+	}
+}
+
+// WriteObject writes an object, creating its bucket if needed.
+func (s *Server) WriteObject(bkt, name string, data []byte) {
+	s.CreateBucket("", bkt)
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.putObject(bkt, objectAttrs{Name: name}, data)
+}
+
+// ReadObject returns the content of an object.
+func (s *Server) ReadObject(bkt, name string) ([]byte, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if b, ok := s.buckets[bkt]; ok {
+		if o, ok := b.objects[name]; ok {
+			return o.data, true
+		}
+	}
+	return nil, false
+}
+
+// Objects returns the sorted names of the objects of a bucket.
+func (s *Server) Objects(bkt string) []string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	var names []string
+	if b, ok := s.buckets[bkt]; ok {
+		for n := range b.objects {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// putObject must be called with s.mx held, and the bucket must exist.
+func (s *Server) putObject(bkt string, attrs objectAttrs, data []byte) *object {
+	s.generation++
+	o := &object{data: data, contentType: attrs.ContentType, metadata: attrs.Metadata, generation: s.generation, updated: time.Now().UTC()}
+	s.buckets[bkt].objects[attrs.Name] = o
+	return o
+}
+
+func objectJSON(bkt, name string, o *object) map[string]interface{} {
+	sum := md5.Sum(o.data)
+	return map[string]interface{}{
+		"kind":        "storage#object",
+		"bucket":      bkt,
+		"name":        name,
+		"size":        strconv.Itoa(len(o.data)),
+		"contentType": o.contentType,
+		"metadata":    o.metadata,
+		"generation":  strconv.FormatInt(o.generation, 10),
+		"updated":     o.updated.Format(time.RFC3339Nano),
+		"md5Hash":     base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, format string, a ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	msg := fmt.Sprintf(format, a...)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": msg, "errors": []interface{}{map[string]interface{}{"message": msg}}},
+	})
+}
+
+// pathSegments splits the escaped path of r, unescaping each segment so that
+// object names may contain slashes.
+func pathSegments(r *http.Request) []string {
+	var segs []string
+	for _, p := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		u, err := url.PathUnescape(p)
+		if err != nil {
+			u = p
+		}
+		segs = append(segs, u)
+	}
+	return segs
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	segs := pathSegments(r)
+	switch {
+	case len(segs) >= 4 && segs[0] == "upload" && segs[3] == "b":
+		s.handleUpload(w, r, segs[4:])
+	case len(segs) >= 1 && segs[0] == "b":
+		s.handleJSON(w, r, segs[1:])
+	default:
+		s.handleXML(w, r)
+	}
+}
+
+func (s *Server) handleJSON(w http.ResponseWriter, r *http.Request, segs []string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	q := r.URL.Query()
+
+	if len(segs) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			var items []interface{}
+			var names []string
+			for n, b := range s.buckets {
+				if b.project == q.Get("project") && strings.HasPrefix(n, q.Get("prefix")) {
+					names = append(names, n)
+				}
+			}
+			sort.Strings(names)
+			for _, n := range names {
+				items = append(items, map[string]interface{}{"kind": "storage#bucket", "name": n})
+			}
+			writeJSON(w, map[string]interface{}{"kind": "storage#buckets", "items": items})
+		case http.MethodPost:
+			var attrs struct{ Name string }
+			json.NewDecoder(r.Body).Decode(&attrs)
+			if _, ok := s.buckets[attrs.Name]; ok {
+				writeError(w, http.StatusConflict, "bucket %q already exists", attrs.Name)
+				return
+			}
+			s.buckets[attrs.Name] = &bucket{project: q.Get("project"), objects: map[string]*object{}}
+			writeJSON(w, map[string]interface{}{"kind": "storage#bucket", "name": attrs.Name})
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+		}
+		return
+	}
+
+	bkt := segs[0]
+	b, ok := s.buckets[bkt]
+	if !ok {
+		writeError(w, http.StatusNotFound, "bucket %q not found", bkt)
+		return
+	}
+	if len(segs) == 1 {
+		if r.Method == http.MethodDelete {
+			if len(b.objects) != 0 {
+				writeError(w, http.StatusConflict, "bucket %q is not empty", bkt)
+				return
+			}
+			delete(s.buckets, bkt)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"kind": "storage#bucket", "name": bkt})
+		return
+	}
+	if segs[1] != "o" {
+		writeError(w, http.StatusNotFound, "unsupported path %q", r.URL.Path)
+		return
+	}
+	if len(segs) == 2 {
+		s.listObjects(w, bkt, b, q.Get("prefix"), q.Get("delimiter"))
+		return
+	}
+
+	name := segs[2]
+	o, ok := b.objects[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "object %q not found in bucket %q", name, bkt)
+		return
+	}
+	switch {
+	case len(segs) == 8 && (segs[3] == "rewriteTo" || segs[3] == "copyTo") && segs[4] == "b" && segs[6] == "o":
+		if _, ok := s.buckets[segs[5]]; !ok {
+			writeError(w, http.StatusNotFound, "bucket %q not found", segs[5])
+			return
+		}
+		no := s.putObject(segs[5], objectAttrs{Name: segs[7], ContentType: o.contentType, Metadata: o.metadata}, o.data)
+		res := objectJSON(segs[5], segs[7], no)
+		if segs[3] == "copyTo" {
+			writeJSON(w, res)
+			return
+		}
+		size := strconv.Itoa(len(o.data))
+		writeJSON(w, map[string]interface{}{"kind": "storage#rewriteResponse", "done": true, "objectSize": size, "totalBytesRewritten": size, "resource": res})
+	case len(segs) > 3 && segs[3] == "acl":
+		writeJSON(w, map[string]interface{}{})
+	case len(segs) == 3 && r.Method == http.MethodDelete:
+		delete(b.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	case len(segs) == 3 && r.Method == http.MethodPatch:
+		var attrs objectAttrs
+		json.NewDecoder(r.Body).Decode(&attrs)
+		if attrs.ContentType != "" {
+			o.contentType = attrs.ContentType
+		}
+		if attrs.Metadata != nil {
+			o.metadata = attrs.Metadata
+		}
+		writeJSON(w, objectJSON(bkt, name, o))
+	case len(segs) == 3:
+		writeJSON(w, objectJSON(bkt, name, o))
+	default:
+		writeError(w, http.StatusNotFound, "unsupported path %q", r.URL.Path)
+	}
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, bkt string, b *bucket, prefix, delimiter string) {
+	var names []string
+	prefixes := map[string]bool{}
+	for n := range b.objects {
+		if !strings.HasPrefix(n, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(n[len(prefix):], delimiter); i != -1 {
+				prefixes[n[:len(prefix)+i+len(delimiter)]] = true
+				continue
+			}
+		}
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var items []interface{}
+	for _, n := range names {
+		items = append(items, objectJSON(bkt, n, b.objects[n]))
+	}
+	var ps []string
+	for p := range prefixes {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+	writeJSON(w, map[string]interface{}{"kind": "storage#objects", "items": items, "prefixes": ps})
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, segs []string) {
+	q := r.URL.Query()
+	if len(segs) < 2 || segs[1] != "o" {
+		writeError(w, http.StatusNotFound, "unsupported path %q", r.URL.Path)
+		return
+	}
+	bkt := segs[0]
+
+	if id := q.Get("upload_id"); id != "" {
+		s.resumeUpload(w, r, id)
+		return
+	}
+
+	var attrs objectAttrs
+	var data []byte
+	switch q.Get("uploadType") {
+	case "multipart":
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad multipart upload: %v", err)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		for i := 0; ; i++ {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "bad multipart upload: %v", err)
+				return
+			}
+			if i == 0 {
+				json.NewDecoder(p).Decode(&attrs)
+			} else {
+				data, _ = ioutil.ReadAll(p)
+			}
+		}
+	case "resumable":
+		json.NewDecoder(r.Body).Decode(&attrs)
+		if attrs.Name == "" {
+			attrs.Name = q.Get("name")
+		}
+		s.mx.Lock()
+		s.generation++
+		id := strconv.FormatInt(s.generation, 10)
+		s.uploads[id] = &upload{bucket: bkt, attrs: attrs}
+		s.mx.Unlock()
+		w.Header().Set("Location", fmt.Sprintf("%s%s?uploadType=resumable&upload_id=%s", s.ts.URL, r.URL.EscapedPath(), id))
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		attrs.Name = q.Get("name")
+		data, _ = ioutil.ReadAll(r.Body)
+	}
+	if attrs.Name == "" {
+		attrs.Name = q.Get("name")
+	}
+	s.finishUpload(w, bkt, attrs, data)
+}
+
+func (s *Server) resumeUpload(w http.ResponseWriter, r *http.Request, id string) {
+	s.mx.Lock()
+	u, ok := s.uploads[id]
+	s.mx.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "upload %q not found", id)
+		return
+	}
+	data, _ := ioutil.ReadAll(r.Body)
+	u.data = append(u.data, data...)
+
+	// Content-Range is "bytes first-last/total", where total is "*" until
+	// the last chunk.
+	cr := r.Header.Get("Content-Range")
+	if strings.HasSuffix(cr, "/*") {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(u.data)-1))
+		if r.Header.Get("X-GUploader-No-308") == "yes" {
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+	s.mx.Lock()
+	delete(s.uploads, id)
+	s.mx.Unlock()
+	s.finishUpload(w, u.bucket, u.attrs, u.data)
+}
+
+func (s *Server) finishUpload(w http.ResponseWriter, bkt string, attrs objectAttrs, data []byte) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if _, ok := s.buckets[bkt]; !ok {
+		writeError(w, http.StatusNotFound, "bucket %q not found", bkt)
+		return
+	}
+	if attrs.Name == "" {
+		writeError(w, http.StatusBadRequest, "missing object name")
+		return
+	}
+	o := s.putObject(bkt, attrs, data)
+	writeJSON(w, objectJSON(bkt, attrs.Name, o))
+}
+
+// handleXML serves the object reads of storage.Reader.
+func (s *Server) handleXML(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	i := strings.Index(path, "/")
+	if i == -1 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	data, ok := s.ReadObject(path[:i], path[i+1:])
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	start, end := 0, len(data)
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); strings.HasPrefix(rng, "bytes=") {
+		parts := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+		if parts[0] == "" && len(parts) == 2 {
+			// Suffix range: the last n bytes.
+			n, _ := strconv.Atoi(parts[1])
+			if n < end {
+				start = end - n
+			}
+		} else {
+			start, _ = strconv.Atoi(parts[0])
+			if len(parts) == 2 && parts[1] != "" {
+				if e, err := strconv.Atoi(parts[1]); err == nil && e+1 < end {
+					end = e + 1
+				}
+			}
+		}
+		if start > len(data) {
+			start = len(data)
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(data)))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(end-start))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(data[start:end])
+	}
+}
@@ -0,0 +1,127 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package fakegcs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+func write(ctx context.Context, t *testing.T, c *storage.Client, bkt, name string, data []byte, chunkSize int) {
+	w := c.Bucket(bkt).Object(name).NewWriter(ctx)
+	w.ChunkSize = chunkSize
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("error writing %s: %v", name, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing writer of %s: %v", name, err)
+	}
+}
+
+func read(ctx context.Context, t *testing.T, c *storage.Client, bkt, name string, offset, length int64) []byte {
+	r, err := c.Bucket(bkt).Object(name).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		t.Fatalf("error reading %s: %v", name, err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("error reading %s: %v", name, err)
+	}
+	return data
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer()
+	defer s.Close()
+	c, err := s.Client(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Bucket("bkt").Create(ctx, "p", nil); err != nil {
+		t.Fatalf("error creating bucket: %v", err)
+	}
+	if err := c.Bucket("bkt").Create(ctx, "p", nil); err == nil {
+		t.Error("creating an existing bucket should fail")
+	}
+	if b, err := c.Buckets(ctx, "p").Next(); err != nil || b.Name != "bkt" {
+		t.Errorf("unexpected bucket list result: %v, %v", b, err)
+	}
+
+	small := []byte("hello")
+	large := bytes.Repeat([]byte("0123456789"), 60*1024)
+	write(ctx, t, c, "bkt", "dir/small", small, 0)
+	write(ctx, t, c, "bkt", "dir/sub/large", large, 256*1024)
+
+	if got := read(ctx, t, c, "bkt", "dir/small", 0, -1); !bytes.Equal(got, small) {
+		t.Errorf("unexpected content of small object: %q", got)
+	}
+	if got := read(ctx, t, c, "bkt", "dir/sub/large", 0, -1); !bytes.Equal(got, large) {
+		t.Errorf("resumable upload content mismatch, got %d bytes, want %d", len(got), len(large))
+	}
+	if got := read(ctx, t, c, "bkt", "dir/sub/large", 5, 3); string(got) != "567" {
+		t.Errorf("unexpected range read: %q", got)
+	}
+	attrs, err := c.Bucket("bkt").Object("dir/sub/large").Attrs(ctx)
+	if err != nil || attrs.Size != int64(len(large)) {
+		t.Errorf("unexpected attrs: %v, %v", attrs, err)
+	}
+
+	dst := c.Bucket("bkt").Object("copy")
+	if _, err := dst.CopierFrom(c.Bucket("bkt").Object("dir/small")).Run(ctx); err != nil {
+		t.Fatalf("error copying: %v", err)
+	}
+	if got, ok := s.ReadObject("bkt", "copy"); !ok || !bytes.Equal(got, small) {
+		t.Errorf("unexpected copy content: %q", got)
+	}
+
+	var names, prefixes []string
+	it := c.Bucket("bkt").Objects(ctx, &storage.Query{Prefix: "dir/", Delimiter: "/"})
+	for {
+		a, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Prefix != "" {
+			prefixes = append(prefixes, a.Prefix)
+		} else {
+			names = append(names, a.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"dir/small"}) || !reflect.DeepEqual(prefixes, []string{"dir/sub/"}) {
+		t.Errorf("unexpected listing: names %v, prefixes %v", names, prefixes)
+	}
+
+	if err := c.Bucket("bkt").Object("copy").Delete(ctx); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+	if _, err := c.Bucket("bkt").Object("copy").Attrs(ctx); err != storage.ErrObjectNotExist {
+		t.Errorf("deleted object should not exist, got %v", err)
+	}
+	if want := []string{"dir/small", "dir/sub/large"}; !reflect.DeepEqual(s.Objects("bkt"), want) {
+		t.Errorf("got objects %v, want %v", s.Objects("bkt"), want)
+	}
+}
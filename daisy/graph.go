@@ -0,0 +1,334 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats supported by Graph.
+const (
+	GraphDOT     = "dot"
+	GraphMermaid = "mermaid"
+)
+
+// graphNode is a step of the expanded DAG. Its id matches the name of the
+// step's TimeRecord: the step name prefixed by the names of the workflows
+// between the root workflow and the step.
+type graphNode struct {
+	id, name, stepType string
+	duration           time.Duration
+	timed, critical    bool
+}
+
+// graphCluster groups the steps of an included or sub workflow.
+type graphCluster struct {
+	label    string
+	nodes    []string
+	clusters []*graphCluster
+}
+
+type graphEdge struct {
+	from, to string
+	critical bool
+}
+
+// stepGraph is the DAG of a workflow with the steps of included and sub
+// workflows expanded in place of the steps running them.
+type stepGraph struct {
+	name     string
+	nodes    map[string]*graphNode
+	edges    []*graphEdge
+	root     graphCluster
+	critical time.Duration
+	timed    bool
+}
+
+// Graph populates the workflow and renders its fully expanded step DAG in
+// format, GraphDOT or GraphMermaid. Steps of included and sub workflows are
+// grouped by the step running them. If records of a completed run are given,
+// steps are annotated with their durations and the critical path, the chain
+// of dependent steps that took the longest, is highlighted.
+// Like Plan, Graph needs no access to a GCP project.
+func (w *Workflow) Graph(ctx context.Context, format string, records []TimeRecord) (string, DError) {
+	if format != GraphDOT && format != GraphMermaid {
+		return "", Errf("unknown graph format %q, must be %q or %q", format, GraphDOT, GraphMermaid)
+	}
+	p, err := newPlanRecorder(ctx)
+	if err != nil {
+		return "", newErr("failed to create graph backend", err)
+	}
+	defer p.close()
+	w.plan = p
+	w.ComputeClient = p.computeClient
+	w.StorageClient = p.storageClient
+	w.externalLogging = false
+	w.DisableCloudLogging()
+	w.DisableGCSLogging()
+	if err := w.populate(ctx); err != nil {
+		return "", err
+	}
+
+	g := newStepGraph(w)
+	g.applyTimeRecords(records)
+	if format == GraphDOT {
+		return g.dot(), nil
+	}
+	return g.mermaid(), nil
+}
+
+func newStepGraph(w *Workflow) *stepGraph {
+	g := &stepGraph{name: w.Name, nodes: map[string]*graphNode{}}
+	g.addWorkflow(w, "", &g.root)
+	sort.Slice(g.edges, func(i, j int) bool {
+		if g.edges[i].from != g.edges[j].from {
+			return g.edges[i].from < g.edges[j].from
+		}
+		return g.edges[i].to < g.edges[j].to
+	})
+	return g
+}
+
+// addWorkflow adds the steps of w to cluster c and returns the nodes
+// starting and ending w.
+func (g *stepGraph) addWorkflow(w *Workflow, prefix string, c *graphCluster) (entries, exits []string) {
+	var names []string
+	for name := range w.Steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stepEntries := map[string][]string{}
+	stepExits := map[string][]string{}
+	for _, name := range names {
+		s := w.Steps[name]
+		var child *Workflow
+		if s.IncludeWorkflow != nil {
+			child = s.IncludeWorkflow.Workflow
+		} else if s.SubWorkflow != nil {
+			child = s.SubWorkflow.Workflow
+		}
+		stepType := ""
+		if impl, err := s.stepImpl(); err == nil {
+			stepType = stepImplName(impl)
+		}
+		if child != nil && len(child.Steps) > 0 {
+			cc := &graphCluster{label: fmt.Sprintf("%s (%s)", name, stepType)}
+			c.clusters = append(c.clusters, cc)
+			stepEntries[name], stepExits[name] = g.addWorkflow(child, prefix+child.Name+".", cc)
+			continue
+		}
+		id := prefix + name
+		g.nodes[id] = &graphNode{id: id, name: name, stepType: stepType}
+		c.nodes = append(c.nodes, id)
+		stepEntries[name] = []string{id}
+		stepExits[name] = []string{id}
+	}
+
+	dependedOn := map[string]bool{}
+	for _, name := range names {
+		deps := w.Dependencies[name]
+		if len(deps) == 0 {
+			entries = append(entries, stepEntries[name]...)
+		}
+		for _, dep := range deps {
+			dependedOn[dep] = true
+			for _, from := range stepExits[dep] {
+				for _, to := range stepEntries[name] {
+					g.edges = append(g.edges, &graphEdge{from: from, to: to})
+				}
+			}
+		}
+	}
+	for _, name := range names {
+		if !dependedOn[name] {
+			exits = append(exits, stepExits[name]...)
+		}
+	}
+	return entries, exits
+}
+
+// applyTimeRecords sets the durations of the steps and marks the critical
+// path.
+func (g *stepGraph) applyTimeRecords(records []TimeRecord) {
+	for _, r := range records {
+		if n, ok := g.nodes[r.Name]; ok {
+			n.duration = r.EndTime.Sub(r.StartTime)
+			n.timed = true
+			g.timed = true
+		}
+	}
+	if !g.timed {
+		return
+	}
+
+	// Longest path by duration, visiting steps in topological order.
+	preds := map[string][]*graphEdge{}
+	indegree := map[string]int{}
+	for _, e := range g.edges {
+		preds[e.to] = append(preds[e.to], e)
+		indegree[e.to]++
+	}
+	var ready []string
+	for id := range g.nodes {
+		if indegree[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	sort.Strings(ready)
+	finish := map[string]time.Duration{}
+	via := map[string]*graphEdge{}
+	var last string
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		var start time.Duration
+		for _, e := range preds[id] {
+			if finish[e.from] > start || via[id] == nil {
+				start = finish[e.from]
+				via[id] = e
+			}
+		}
+		finish[id] = start + g.nodes[id].duration
+		if last == "" || finish[id] > finish[last] {
+			last = id
+		}
+		for _, e := range g.edges {
+			if e.from == id {
+				if indegree[e.to]--; indegree[e.to] == 0 {
+					ready = append(ready, e.to)
+				}
+			}
+		}
+	}
+
+	g.critical = finish[last]
+	for id := last; id != ""; {
+		g.nodes[id].critical = true
+		e := via[id]
+		if e == nil {
+			break
+		}
+		e.critical = true
+		id = e.from
+	}
+}
+
+func (g *stepGraph) nodeLabel(n *graphNode, newline string) string {
+	parts := []string{n.name}
+	if n.stepType != "" {
+		parts = append(parts, n.stepType)
+	}
+	if n.timed {
+		parts = append(parts, n.duration.Round(time.Second).String())
+	}
+	return strings.Join(parts, newline)
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (g *stepGraph) dot() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "digraph %s {\n", dotQuote(g.name))
+	buf.WriteString("  node [shape=box];\n")
+	if g.timed {
+		fmt.Fprintf(&buf, "  label=%s;\n", dotQuote("critical path: "+g.critical.Round(time.Second).String()))
+	}
+	clusters := 0
+	var writeCluster func(c *graphCluster, indent string)
+	writeCluster = func(c *graphCluster, indent string) {
+		for _, id := range c.nodes {
+			n := g.nodes[id]
+			attrs := "label=" + strings.Replace(dotQuote(g.nodeLabel(n, "\n")), "\n", `\n`, -1)
+			if n.critical {
+				attrs += ", color=red, penwidth=2"
+			}
+			fmt.Fprintf(&buf, "%s%s [%s];\n", indent, dotQuote(id), attrs)
+		}
+		for _, cc := range c.clusters {
+			fmt.Fprintf(&buf, "%ssubgraph %s {\n", indent, dotQuote(fmt.Sprintf("cluster_%d", clusters)))
+			clusters++
+			fmt.Fprintf(&buf, "%s  label=%s;\n", indent, dotQuote(cc.label))
+			writeCluster(cc, indent+"  ")
+			fmt.Fprintf(&buf, "%s}\n", indent)
+		}
+	}
+	writeCluster(&g.root, "  ")
+	for _, e := range g.edges {
+		attrs := ""
+		if e.critical {
+			attrs = " [color=red, penwidth=2]"
+		}
+		fmt.Fprintf(&buf, "  %s -> %s%s;\n", dotQuote(e.from), dotQuote(e.to), attrs)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.Replace(s, `"`, "#quot;", -1) + `"`
+}
+
+func (g *stepGraph) mermaid() string {
+	var buf bytes.Buffer
+	buf.WriteString("flowchart TD\n")
+	if g.timed {
+		fmt.Fprintf(&buf, "  %%%% critical path: %s\n", g.critical.Round(time.Second))
+	}
+	// Mermaid ids can't contain most punctuation, number the nodes instead.
+	ids := map[string]string{}
+	var critical []string
+	clusters := 0
+	var writeCluster func(c *graphCluster, indent string)
+	writeCluster = func(c *graphCluster, indent string) {
+		for _, id := range c.nodes {
+			n := g.nodes[id]
+			ids[id] = fmt.Sprintf("n%d", len(ids))
+			fmt.Fprintf(&buf, "%s%s[%s]\n", indent, ids[id], mermaidQuote(g.nodeLabel(n, "<br/>")))
+			if n.critical {
+				critical = append(critical, ids[id])
+			}
+		}
+		for _, cc := range c.clusters {
+			fmt.Fprintf(&buf, "%ssubgraph c%d[%s]\n", indent, clusters, mermaidQuote(cc.label))
+			clusters++
+			writeCluster(cc, indent+"  ")
+			fmt.Fprintf(&buf, "%send\n", indent)
+		}
+	}
+	writeCluster(&g.root, "  ")
+	var criticalEdges []string
+	for i, e := range g.edges {
+		fmt.Fprintf(&buf, "  %s --> %s\n", ids[e.from], ids[e.to])
+		if e.critical {
+			criticalEdges = append(criticalEdges, fmt.Sprint(i))
+		}
+	}
+	if len(critical) > 0 {
+		buf.WriteString("  classDef critical stroke:#d00,stroke-width:3px\n")
+		fmt.Fprintf(&buf, "  class %s critical\n", strings.Join(critical, ","))
+	}
+	if len(criticalEdges) > 0 {
+		fmt.Fprintf(&buf, "  linkStyle %s stroke:#d00,stroke-width:3px\n", strings.Join(criticalEdges, ","))
+	}
+	return buf.String()
+}
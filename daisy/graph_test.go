@@ -0,0 +1,109 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// graphTestWorkflow returns a workflow where "create" and "inc" run in
+// parallel after "start", and "inc" includes the steps "a" then "b".
+func graphTestWorkflow() *Workflow {
+	w := testWorkflow()
+	child := &Workflow{Name: "inc", Steps: map[string]*Step{
+		"a": {CreateDisks: &CreateDisks{}},
+		"b": {DeleteResources: &DeleteResources{}},
+	}, Dependencies: map[string][]string{"b": {"a"}}}
+	w.Steps = map[string]*Step{
+		"start":  {CreateDisks: &CreateDisks{}},
+		"create": {CreateImages: &CreateImages{}},
+		"inc":    {IncludeWorkflow: &IncludeWorkflow{Workflow: child}},
+	}
+	w.Dependencies = map[string][]string{"create": {"start"}, "inc": {"start"}}
+	return w
+}
+
+func graphTestRecords() []TimeRecord {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec := func(name string, start, end time.Duration) TimeRecord {
+		return TimeRecord{Name: name, StartTime: t0.Add(start), EndTime: t0.Add(end)}
+	}
+	return []TimeRecord{
+		rec("start", 0, time.Minute),
+		rec("create", time.Minute, 3*time.Minute),
+		rec("inc.a", time.Minute, 2*time.Minute),
+		rec("inc.b", 2*time.Minute, 4*time.Minute),
+		rec("inc", time.Minute, 4*time.Minute),
+		rec("workflow cleanup", 4*time.Minute, 5*time.Minute),
+	}
+}
+
+func TestGraphDOT(t *testing.T) {
+	g := newStepGraph(graphTestWorkflow())
+	g.applyTimeRecords(graphTestRecords())
+	want := `digraph "test-wf" {
+  node [shape=box];
+  label="critical path: 4m0s";
+  "create" [label="create\nCreateImages\n2m0s"];
+  "start" [label="start\nCreateDisks\n1m0s", color=red, penwidth=2];
+  subgraph "cluster_0" {
+    label="inc (IncludeWorkflow)";
+    "inc.a" [label="a\nCreateDisks\n1m0s", color=red, penwidth=2];
+    "inc.b" [label="b\nDeleteResources\n2m0s", color=red, penwidth=2];
+  }
+  "inc.a" -> "inc.b" [color=red, penwidth=2];
+  "start" -> "create";
+  "start" -> "inc.a" [color=red, penwidth=2];
+}
+`
+	if got := g.dot(); got != want {
+		t.Errorf("unexpected DOT graph:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGraphMermaid(t *testing.T) {
+	g := newStepGraph(graphTestWorkflow())
+	want := `flowchart TD
+  n0["create<br/>CreateImages"]
+  n1["start<br/>CreateDisks"]
+  subgraph c0["inc (IncludeWorkflow)"]
+    n2["a<br/>CreateDisks"]
+    n3["b<br/>DeleteResources"]
+  end
+  n2 --> n3
+  n1 --> n0
+  n1 --> n2
+`
+	if got := g.mermaid(); got != want {
+		t.Errorf("unexpected Mermaid graph:\n%s\nwant:\n%s", got, want)
+	}
+
+	g.applyTimeRecords(graphTestRecords())
+	got := g.mermaid()
+	for _, line := range []string{"  %% critical path: 4m0s\n", "  class n1,n2,n3 critical\n", "  linkStyle 0,2 stroke:#d00,stroke-width:3px\n"} {
+		if !strings.Contains(got, line) {
+			t.Errorf("Mermaid graph is missing %q:\n%s", line, got)
+		}
+	}
+}
+
+func TestGraphBadFormat(t *testing.T) {
+	if _, err := testWorkflow().Graph(context.Background(), "svg", nil); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
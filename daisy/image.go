@@ -113,6 +113,7 @@ type ImageInterface interface {
 	setRawDiskSource(rawDiskSource string)
 	create(cc daisyCompute.Client) error
 	markCreatedInWorkflow()
+	publishOutputs(s *Step)
 	delete(cc daisyCompute.Client) error
 	populateGuestOSFeatures()
 }
@@ -187,7 +188,11 @@ func (i *Image) create(cc daisyCompute.Client) error {
 }
 
 func (i *Image) markCreatedInWorkflow() {
-	i.createdInWorkflow = true
+	i.markCreated()
+}
+
+func (i *Image) publishOutputs(s *Step) {
+	s.SetOutput(i.daisyName+".selfLink", i.SelfLink)
 }
 
 func (i *Image) delete(cc daisyCompute.Client) error {
@@ -262,7 +267,11 @@ func (i *ImageBeta) create(cc daisyCompute.Client) error {
 }
 
 func (i *ImageBeta) markCreatedInWorkflow() {
-	i.createdInWorkflow = true
+	i.markCreated()
+}
+
+func (i *ImageBeta) publishOutputs(s *Step) {
+	s.SetOutput(i.daisyName+".selfLink", i.SelfLink)
 }
 
 func (i *ImageBeta) delete(cc daisyCompute.Client) error {
@@ -337,7 +346,11 @@ func (i *ImageAlpha) create(cc daisyCompute.Client) error {
 }
 
 func (i *ImageAlpha) markCreatedInWorkflow() {
-	i.createdInWorkflow = true
+	i.markCreated()
+}
+
+func (i *ImageAlpha) publishOutputs(s *Step) {
+	s.SetOutput(i.daisyName+".selfLink", i.SelfLink)
 }
 
 func (i *ImageAlpha) delete(cc daisyCompute.Client) error {
@@ -83,6 +83,7 @@ type InstanceInterface interface {
 	create(cc daisyCompute.Client) error
 	delete(cc daisyCompute.Client, deleteDisk bool) error
 	updateDisksAndNetworksBeforeCreate(w *Workflow)
+	publishOutputs(s *Step)
 	getMetadata() map[string]string
 	setMetadata(md map[string]string)
 	getSourceMachineImage() string
@@ -178,6 +179,20 @@ func (i *Instance) delete(cc daisyCompute.Client, deleteDisk bool) error {
 	return deleteInstance(deleteDisk, cc, i.Project, i.Zone, i.Name)
 }
 
+// publishOutputs publishes the self link of the instance, and the internal and
+// external IPs of its first network interface.
+func (i *Instance) publishOutputs(s *Step) {
+	s.SetOutput(i.daisyName+".selfLink", i.SelfLink)
+	if len(i.NetworkInterfaces) == 0 {
+		return
+	}
+	nic := i.NetworkInterfaces[0]
+	s.SetOutput(i.daisyName+".networkIP", nic.NetworkIP)
+	if len(nic.AccessConfigs) > 0 {
+		s.SetOutput(i.daisyName+".natIP", nic.AccessConfigs[0].NatIP)
+	}
+}
+
 func (i *Instance) updateDisksAndNetworksBeforeCreate(w *Workflow) {
 	for _, d := range i.Disks {
 		if diskRes, ok := w.disks.get(d.Source); ok {
@@ -284,6 +299,18 @@ func (i *InstanceBeta) delete(cc daisyCompute.Client, deleteDisk bool) error {
 	return deleteInstance(deleteDisk, cc, i.Project, i.Zone, i.Name)
 }
 
+func (i *InstanceBeta) publishOutputs(s *Step) {
+	s.SetOutput(i.daisyName+".selfLink", i.SelfLink)
+	if len(i.NetworkInterfaces) == 0 {
+		return
+	}
+	nic := i.NetworkInterfaces[0]
+	s.SetOutput(i.daisyName+".networkIP", nic.NetworkIP)
+	if len(nic.AccessConfigs) > 0 {
+		s.SetOutput(i.daisyName+".natIP", nic.AccessConfigs[0].NatIP)
+	}
+}
+
 func (i *InstanceBeta) updateDisksAndNetworksBeforeCreate(w *Workflow) {
 	for _, d := range i.Disks {
 		if diskRes, ok := w.disks.get(d.Source); ok {
@@ -0,0 +1,288 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Journal is the persisted execution state of a workflow run. It is written
+// after every completed step and created resource, and can be used to resume
+// an interrupted run.
+type Journal struct {
+	// Workflow name and ID of the journaled run.
+	Name string
+	ID   string
+	// Time the journaled run was populated, used to regenerate the same
+	// autovars and scratch paths on resume.
+	StartTime time.Time
+	// Completed steps, identified by their absolute name (e.g. wf.include.step).
+	CompletedSteps []string `json:",omitempty"`
+	// Resources created so far, keyed by resource type.
+	Resources map[string][]JournalResource `json:",omitempty"`
+	// Serial-output values collected so far.
+	SerialOutputValues map[string]string `json:",omitempty"`
+	// Outputs published by completed steps, keyed by absolute step name.
+	StepOutputs map[string]map[string]string `json:",omitempty"`
+	// Autovars of the journaled run, for information only.
+	Autovars map[string]string `json:",omitempty"`
+}
+
+// JournalResource is a resource recorded in a Journal.
+type JournalResource struct {
+	// Name of the resource as known to Daisy.
+	Name string
+	// Partial URL of the resource.
+	Link    string
+	Deleted bool `json:",omitempty"`
+}
+
+// workflowJournal is shared by a workflow and its included workflows.
+// SubWorkflows are journaled as a single step of their parent.
+type workflowJournal struct {
+	w    *Workflow
+	path string
+	mx   sync.Mutex
+
+	completed []string
+	outputs   map[string]map[string]string
+	resumed   *Journal
+	// keepResources is set when a run fails and its resources are kept for resuming.
+	keepResources bool
+}
+
+// EnableJournal makes Run write a journal of the workflow execution to path,
+// which may be a local file or a GCS object (gs://bucket/object). Resources of
+// a failed journaled run are not cleaned up, so the run can be resumed.
+func (w *Workflow) EnableJournal(path string) {
+	w.journal = &workflowJournal{w: w, path: path}
+}
+
+// ResumeFromJournal reads the journal at path and prepares the workflow to
+// resume the journaled run: completed steps are skipped and the resources they
+// created are adopted by the workflow. Progress is written back to path.
+func (w *Workflow) ResumeFromJournal(ctx context.Context, path string) error {
+	data, err := w.readJournalData(ctx, path)
+	if err != nil {
+		return err
+	}
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return JSONError(path, data, err)
+	}
+	if j.Name != w.Name {
+		return fmt.Errorf("journal %q is for workflow %q, not %q", path, j.Name, w.Name)
+	}
+	w.EnableJournal(path)
+	w.journal.resumed = &j
+	w.journal.completed = append(w.journal.completed, j.CompletedSteps...)
+	w.journal.outputs = j.StepOutputs
+	return nil
+}
+
+func (w *Workflow) readJournalData(ctx context.Context, p string) ([]byte, error) {
+	if bkt, obj, err := splitGCSPath(p); err == nil {
+		if w.StorageClient == nil {
+			if err := w.PopulateClients(ctx); err != nil {
+				return nil, err
+			}
+		}
+		r, err := w.StorageClient.Bucket(bkt).Object(obj).NewReader(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal %q: %v", p, err)
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return ioutil.ReadFile(p)
+}
+
+// isResuming reports whether the workflow resumes a journaled run.
+func (j *workflowJournal) isResuming() bool {
+	return j != nil && j.resumed != nil
+}
+
+// stepKey identifies a step across runs of the same workflow.
+func stepKey(s *Step) string {
+	return fmt.Sprintf("%s.%s", getAbsoluteName(s.w), s.name)
+}
+
+func (j *workflowJournal) stepCompleted(s *Step) bool {
+	if j == nil {
+		return false
+	}
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	return strIn(stepKey(s), j.completed)
+}
+
+// resourceJournaled reports whether the resumed run created the resource at link.
+func (j *workflowJournal) resourceJournaled(typeName, link string) bool {
+	if !j.isResuming() {
+		return false
+	}
+	for _, res := range j.resumed.Resources[typeName] {
+		if res.Link == link {
+			return true
+		}
+	}
+	return false
+}
+
+// adoptResources marks resources created by the resumed run as created by
+// this run, and restores the collected serial-output values.
+func (j *workflowJournal) adoptResources() {
+	if !j.isResuming() {
+		return
+	}
+	for _, r := range j.w.resourceRegistries() {
+		for _, jr := range j.resumed.Resources[r.typeName] {
+			if res, ok := r.get(jr.Name); ok && res.link == jr.Link && res.creator != nil {
+				res.createdInWorkflow = true
+				res.deleted = jr.Deleted
+			}
+		}
+	}
+	for k, v := range j.resumed.SerialOutputValues {
+		j.w.AddSerialConsoleOutputValue(k, v)
+	}
+}
+
+// restoreStepOutputs restores the outputs that s published in the resumed
+// run, so that the steps depending on s can still reference them.
+func (j *workflowJournal) restoreStepOutputs(s *Step) {
+	j.mx.Lock()
+	outputs := j.outputs[stepKey(s)]
+	j.mx.Unlock()
+	for k, v := range outputs {
+		s.SetOutput(k, v)
+	}
+}
+
+// recordResource persists the journal after a step created a resource, so
+// that a resumed run knows about the resources of steps that failed.
+func (j *workflowJournal) recordResource() {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	if err := j.write(context.Background()); err != nil {
+		j.w.LogWorkflowInfo("Failed to update journal %q: %v", j.path, err)
+	}
+}
+
+// discardResources deletes the resources that s created in the resumed run
+// before it was interrupted, so that s can create them again.
+func (j *workflowJournal) discardResources(s *Step) DError {
+	if !j.isResuming() {
+		return nil
+	}
+	return j.w.deleteStepResources(s)
+}
+
+// recordStep records s as completed and persists the journal.
+func (j *workflowJournal) recordStep(ctx context.Context, s *Step) DError {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	key := stepKey(s)
+	if !strIn(key, j.completed) {
+		j.completed = append(j.completed, key)
+	}
+	if outputs := s.w.getStepOutputs(s.name); outputs != nil {
+		if j.outputs == nil {
+			j.outputs = map[string]map[string]string{}
+		}
+		j.outputs[key] = outputs
+	}
+	return j.write(ctx)
+}
+
+func (j *workflowJournal) snapshot() *Journal {
+	w := j.w
+	st := &Journal{
+		Name:           w.Name,
+		ID:             w.id,
+		StartTime:      w.startTime,
+		CompletedSteps: append([]string{}, j.completed...),
+		Resources:      map[string][]JournalResource{},
+		StepOutputs:    j.outputs,
+		Autovars:       w.autovars,
+	}
+	sort.Strings(st.CompletedSteps)
+	for _, r := range w.resourceRegistries() {
+		r.mx.Lock()
+		for name, res := range r.m {
+			if res.creator == nil || !res.createdInWorkflow {
+				continue
+			}
+			st.Resources[r.typeName] = append(st.Resources[r.typeName], JournalResource{Name: name, Link: res.link, Deleted: res.deleted})
+		}
+		r.mx.Unlock()
+		sort.Slice(st.Resources[r.typeName], func(a, b int) bool {
+			return st.Resources[r.typeName][a].Name < st.Resources[r.typeName][b].Name
+		})
+	}
+	w.serialControlOutputValuesMx.Lock()
+	if len(w.serialControlOutputValues) > 0 {
+		st.SerialOutputValues = map[string]string{}
+		for k, v := range w.serialControlOutputValues {
+			st.SerialOutputValues[k] = v
+		}
+	}
+	w.serialControlOutputValuesMx.Unlock()
+	return st
+}
+
+func (j *workflowJournal) write(ctx context.Context) DError {
+	data, err := json.MarshalIndent(j.snapshot(), "", "  ")
+	if err != nil {
+		return newErr("failed to marshal journal", err)
+	}
+	if bkt, obj, err := splitGCSPath(j.path); err == nil {
+		wc := j.w.StorageClient.Bucket(bkt).Object(obj).NewWriter(ctx)
+		wc.ContentType = "application/json"
+		if _, err := wc.Write(data); err != nil {
+			return typedErr(apiError, "failed to write journal", err)
+		}
+		if err := wc.Close(); err != nil {
+			return typedErr(apiError, "failed to write journal", err)
+		}
+		return nil
+	}
+	if err := ioutil.WriteFile(j.path, data, 0644); err != nil {
+		return typedErr(fileIOError, "failed to write journal", err)
+	}
+	return nil
+}
+
+// resourceRegistries returns the registries of resources created by steps.
+func (w *Workflow) resourceRegistries() []*baseResourceRegistry {
+	return []*baseResourceRegistry{
+		&w.disks.baseResourceRegistry,
+		&w.forwardingRules.baseResourceRegistry,
+		&w.firewallRules.baseResourceRegistry,
+		&w.images.baseResourceRegistry,
+		&w.machineImages.baseResourceRegistry,
+		&w.instances.baseResourceRegistry,
+		&w.networks.baseResourceRegistry,
+		&w.subnetworks.baseResourceRegistry,
+		&w.targetInstances.baseResourceRegistry,
+		&w.snapshots.baseResourceRegistry,
+	}
+}
@@ -0,0 +1,203 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func journalTestWorkflow(runs map[string]int, fail string) *Workflow {
+	w := testWorkflow()
+	for _, name := range []string{"s1", "s2"} {
+		name := name
+		w.Steps[name] = &Step{name: name, w: w, timeout: time.Minute, testType: &mockStep{
+			runImpl: func(ctx context.Context, s *Step) DError {
+				runs[name]++
+				if name == fail {
+					return Errf("fail")
+				}
+				return nil
+			},
+		}}
+	}
+	w.Dependencies["s2"] = []string{"s1"}
+	return w
+}
+
+func TestJournalResume(t *testing.T) {
+	ctx := context.Background()
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "journal.json")
+
+	runs := map[string]int{}
+	w := journalTestWorkflow(runs, "s2")
+	w.EnableJournal(path)
+	w.startTime = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	w.disks.m = map[string]*Resource{
+		"d1": {link: "projects/p/zones/z/disks/d1", creator: w.Steps["s1"], createdInWorkflow: true},
+	}
+	w.AddSerialConsoleOutputValue("k", "v")
+	if err := w.run(ctx); err == nil {
+		t.Fatal("expected run error")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading journal: %v", err)
+	}
+	var got Journal
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("error unmarshalling journal: %v", err)
+	}
+	want := Journal{
+		Name:               testWf,
+		ID:                 w.id,
+		StartTime:          w.startTime,
+		CompletedSteps:     []string{testWf + ".s1"},
+		Resources:          map[string][]JournalResource{"disk": {{Name: "d1", Link: "projects/p/zones/z/disks/d1"}}},
+		SerialOutputValues: map[string]string{"k": "v"},
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("journal doesn't match expectation: (-got +want)\n%s", diffRes)
+	}
+
+	// Resume with a fresh workflow: s1 must be skipped and d1 adopted.
+	runs = map[string]int{}
+	rw := journalTestWorkflow(runs, "")
+	rw.id = "other"
+	if err := rw.ResumeFromJournal(ctx, path); err != nil {
+		t.Fatalf("error resuming from journal: %v", err)
+	}
+	rw.disks.m = map[string]*Resource{
+		"d1": {link: "projects/p/zones/z/disks/d1", creator: rw.Steps["s1"]},
+	}
+	rw.journal.adoptResources()
+	if !rw.disks.m["d1"].createdInWorkflow {
+		t.Error("journaled disk d1 should be adopted by resumed workflow")
+	}
+	if v := rw.GetSerialConsoleOutputValue("k"); v != "v" {
+		t.Errorf("serial-output value not restored, got %q", v)
+	}
+	if !rw.journal.resourceJournaled("disk", "projects/p/zones/z/disks/d1") {
+		t.Error("d1 should be journaled")
+	}
+	if err := rw.run(ctx); err != nil {
+		t.Fatalf("error running resumed workflow: %v", err)
+	}
+	if wantRuns := map[string]int{"s2": 1}; !reflect.DeepEqual(runs, wantRuns) {
+		t.Errorf("unexpected step runs, got %v, want %v", runs, wantRuns)
+	}
+}
+
+func TestJournalResumeFailedCreate(t *testing.T) {
+	ctx := context.Background()
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "journal.json")
+	link := "projects/p/zones/z/disks/d1"
+
+	// s2 creates d1 and then fails.
+	runs := map[string]int{}
+	w := journalTestWorkflow(runs, "")
+	w.EnableJournal(path)
+	w.Steps["s2"].testType = &mockStep{runImpl: func(ctx context.Context, s *Step) DError {
+		w.disks.m["d1"].markCreated()
+		return Errf("fail")
+	}}
+	w.disks.m = map[string]*Resource{"d1": {link: link, creator: w.Steps["s2"]}}
+	if err := w.run(ctx); err == nil {
+		t.Fatal("expected run error")
+	}
+
+	runs = map[string]int{}
+	rw := journalTestWorkflow(runs, "")
+	if err := rw.ResumeFromJournal(ctx, path); err != nil {
+		t.Fatalf("error resuming from journal: %v", err)
+	}
+	if !rw.journal.resourceJournaled("disk", link) {
+		t.Fatal("disk d1 created by the failed step should be journaled")
+	}
+	var deleted []string
+	rw.disks.baseResourceRegistry.deleteFn = func(res *Resource) DError {
+		deleted = append(deleted, res.link)
+		return nil
+	}
+	if err := rw.disks.regCreate("d1", &Resource{link: link}, rw.Steps["s2"], false); err != nil {
+		t.Fatalf("journaled disk should be registered without an existence check: %v", err)
+	}
+	rw.journal.adoptResources()
+	created := false
+	rw.Steps["s2"].testType = &mockStep{runImpl: func(ctx context.Context, s *Step) DError {
+		created = !rw.disks.m["d1"].createdInWorkflow
+		rw.disks.m["d1"].markCreated()
+		return nil
+	}}
+	if err := rw.run(ctx); err != nil {
+		t.Fatalf("error running resumed workflow: %v", err)
+	}
+	if want := []string{link}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("disks deleted before rerunning the failed step: got %v, want %v", deleted, want)
+	}
+	if !created {
+		t.Error("the failed step should create d1 again")
+	}
+	if runs["s1"] != 0 {
+		t.Errorf("s1 completed in the journaled run and should be skipped, ran %d times", runs["s1"])
+	}
+}
+
+func TestJournalKeepsResourcesOnError(t *testing.T) {
+	w := testWorkflow()
+	w.journal = &workflowJournal{w: w, keepResources: true}
+	deleted := false
+	w.disks.baseResourceRegistry.deleteFn = func(res *Resource) DError {
+		deleted = true
+		return nil
+	}
+	w.disks.m = map[string]*Resource{"d1": {creator: &Step{}, createdInWorkflow: true}}
+	w.disks.cleanup()
+	if deleted {
+		t.Error("resources of a failed journaled run should not be cleaned up")
+	}
+}
+
+func TestResumeFromJournalWrongWorkflow(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "journal.json")
+	if err := ioutil.WriteFile(path, []byte(`{"Name": "other-wf"}`), 0644); err != nil {
+		t.Fatalf("error writing journal: %v", err)
+	}
+	if err := testWorkflow().ResumeFromJournal(context.Background(), path); err == nil {
+		t.Error("expected error resuming from journal of another workflow")
+	}
+}
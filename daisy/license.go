@@ -24,6 +24,9 @@ import (
 var licenseURLRegex = regexp.MustCompile(fmt.Sprintf(`^(projects/(?P<project>%[1]s)/)?global/licenses/(?P<license>%[2]s)$`, projectRgxStr, rfc1035))
 
 func (w *Workflow) licenseExists(project, license string) (bool, DError) {
+	if w.planRecorder() != nil {
+		return true, nil
+	}
 	return w.licenseCache.resourceExists(func(project string, opts ...daisyCompute.ListCallOption) (interface{}, error) {
 		return w.ComputeClient.ListLicenses(project)
 	}, project, license)
@@ -0,0 +1,699 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rules checked by Lint.
+const (
+	LintInvalidWorkflow     = "invalid-workflow"
+	LintUndeclaredReference = "undeclared-reference"
+	LintUnusedVar           = "unused-var"
+	LintUnusedSource        = "unused-source"
+	LintIsolatedStep        = "isolated-step"
+	LintSignalTimeout       = "signal-timeout"
+	LintUnusedResource      = "unused-resource"
+	LintDuplicateResource   = "duplicate-resource"
+)
+
+// LintLevel is the severity of a lint finding. Levels are named like the
+// levels of SARIF results.
+type LintLevel string
+
+// Levels of lint findings.
+const (
+	LintError   LintLevel = "error"
+	LintWarning LintLevel = "warning"
+)
+
+// LintRule describes a check of Lint.
+type LintRule struct {
+	ID          string
+	Level       LintLevel
+	Description string
+}
+
+// LintRules are the checks of Lint.
+var LintRules = []LintRule{
+	{LintInvalidWorkflow, LintError, "The workflow file, or a workflow it includes, cannot be read."},
+	{LintUndeclaredReference, LintError, "A ${} reference names a Var, autovar or source that isn't declared, or a workflow is passed a Var it doesn't declare."},
+	{LintUnusedVar, LintWarning, "A Var is declared but never referenced."},
+	{LintUnusedSource, LintWarning, "A source is declared but never referenced. Instances can still read it through the daisy-sources-path metadata."},
+	{LintIsolatedStep, LintWarning, "A step has no dependencies and no dependents, so it runs concurrently with all the other steps."},
+	{LintSignalTimeout, LintWarning, "A step times out before a WaitForInstancesSignal step it contains, or before the first check for a signal."},
+	{LintUnusedResource, LintWarning, "A resource is never used or deleted and NoCleanup is unset, so it is only created to be deleted when the workflow ends."},
+	{LintDuplicateResource, LintError, "Two steps of a workflow and the workflows it includes create resources of the same name."},
+}
+
+// LintFinding is a problem found by Lint.
+type LintFinding struct {
+	Rule  string
+	Level LintLevel
+	// File is the workflow file with the problem, and Line its line in the
+	// file, or 0 if it isn't known.
+	File    string
+	Line    int
+	Message string
+}
+
+// autovarNames are the autovars set by Workflow.populate.
+var autovarNames = []string{"ID", "DATE", "DATETIME", "TIMESTAMP", "USERNAME", "WFDIR", "CWD", "NAME", "FULLNAME",
+	"ZONE", "PROJECT", "GCSPATH", "SCRATCHPATH", "SOURCESPATH", "LOGSPATH", "OUTSPATH"}
+
+// maxLintDepth bounds the nesting of included workflows, in case a workflow
+// includes itself.
+const maxLintDepth = 20
+
+// lintString is a string of a workflow.
+type lintString struct {
+	s string
+	// Name of the top level step holding the string, if any.
+	step string
+	// Where the string is, as the JSON keys leading to it.
+	loc []string
+	// Strings of ForEach step templates can reference ${ITEM}.
+	item bool
+}
+
+// lintWorkflow is a workflow file read by Lint.
+type lintWorkflow struct {
+	*Workflow
+	file string
+	data []byte
+	// values are the known values of Vars and autovars, used to resolve
+	// resource names, paths and timeouts.
+	values map[string]string
+	strs   []lintString
+	// group is the workflow whose resources the workflow shares, itself
+	// unless it is included by an IncludeWorkflow step.
+	group *lintWorkflow
+	// children are the workflows of the IncludeWorkflow and SubWorkflow
+	// steps, by step name.
+	children map[string]*lintWorkflow
+	depth    int
+}
+
+// lintResource is a resource created by a step.
+type lintResource struct {
+	kind, name string
+	noCleanup  bool
+	step       string
+	lw         *lintWorkflow
+}
+
+type linter struct {
+	findings []LintFinding
+	reported map[LintFinding]bool
+	// checked are the files whose own checks already ran.
+	checked map[string]bool
+}
+
+// Lint statically checks workflow files, and the workflows they include,
+// without populating them or using any API. Files included by other files
+// of the list are only checked as part of the workflows including them.
+func Lint(files ...string) []LintFinding {
+	l := &linter{reported: map[LintFinding]bool{}, checked: map[string]bool{}}
+	var roots []*lintWorkflow
+	included := map[string]bool{}
+	for _, f := range files {
+		lw, err := readLintWorkflow(filepath.Clean(f))
+		if err != nil {
+			l.report(LintInvalidWorkflow, f, 0, "%v", err)
+			continue
+		}
+		lw.values["NAME"] = lw.Name
+		l.loadChildren(lw)
+		roots = append(roots, lw)
+		lw.walk(func(c *lintWorkflow) {
+			if c != lw {
+				included[c.file] = true
+			}
+		})
+	}
+	for _, r := range roots {
+		if !included[r.file] {
+			l.lintTree(r)
+		}
+	}
+
+	sort.Slice(l.findings, func(i, j int) bool {
+		a, b := l.findings[i], l.findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Message < b.Message
+	})
+	return l.findings
+}
+
+func readLintWorkflow(file string) (*lintWorkflow, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	w := New()
+	if err := readWorkflow(file, w); err != nil {
+		return nil, err
+	}
+	lw := &lintWorkflow{Workflow: w, file: file, data: data, children: map[string]*lintWorkflow{}}
+	lw.group = lw
+	lw.values = map[string]string{}
+	for k, v := range w.Vars {
+		lw.values[k] = v.Value
+		if v.Value == "" {
+			lw.values[k] = v.Default
+		}
+	}
+	lw.collectStrings()
+	return lw, nil
+}
+
+// resolve substitutes the known values in s.
+func (lw *lintWorkflow) resolve(s string) string {
+	// Values can reference other values, resolve a few levels of them.
+	for i := 0; i < 3 && strings.Contains(s, "${"); i++ {
+		s, _ = expandVars(s, lw.values)
+	}
+	return s
+}
+
+// loadChildren reads the workflows of the IncludeWorkflow and SubWorkflow
+// steps of lw.
+func (l *linter) loadChildren(lw *lintWorkflow) {
+	for _, name := range sortedKeys(lw.Steps) {
+		s := lw.Steps[name]
+		var p string
+		var vars map[string]string
+		include := s.IncludeWorkflow != nil
+		switch {
+		case include:
+			p, vars = s.IncludeWorkflow.Path, s.IncludeWorkflow.Vars
+		case s.SubWorkflow != nil:
+			p, vars = s.SubWorkflow.Path, s.SubWorkflow.Vars
+		default:
+			continue
+		}
+		raw := p
+		p = lw.resolve(p)
+		if p == "" || strings.Contains(p, "${") || lw.depth >= maxLintDepth {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(lw.file), p)
+		}
+		c, err := readLintWorkflow(p)
+		if err != nil && strings.Contains(raw, "${") && os.IsNotExist(err) {
+			// Paths made of Vars are often only valid where the workflow
+			// runs, such as in a container.
+			continue
+		}
+		if err != nil {
+			l.report(LintInvalidWorkflow, lw.file, lintLine(lw.data, `"Steps"`, quote(name)), "step %q: %v", name, err)
+			continue
+		}
+		c.depth = lw.depth + 1
+		c.values["NAME"] = name
+		c.DefaultTimeout = lw.stepTimeout(s)
+		if include {
+			c.group = lw.group
+		}
+		for _, k := range sortedKeys(vars) {
+			if _, ok := c.Vars[k]; !ok {
+				l.report(LintUndeclaredReference, lw.file, lintLine(lw.data, `"Steps"`, quote(name), quote(k)), "step %q passes Var %q, which %s doesn't declare", name, k, relFile(lw.file, c.file))
+				continue
+			}
+			c.values[k] = lw.resolve(vars[k])
+		}
+		lw.children[name] = c
+		l.loadChildren(c)
+	}
+}
+
+// walk calls f on lw and all the workflows it includes.
+func (lw *lintWorkflow) walk(f func(*lintWorkflow)) {
+	f(lw)
+	for _, name := range sortedKeys(lw.children) {
+		lw.children[name].walk(f)
+	}
+}
+
+// collectStrings records the strings of the workflow, along with where they
+// are in the file.
+func (lw *lintWorkflow) collectStrings() {
+	v := reflect.ValueOf(lw.Workflow).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Name == "Steps" || f.Tag.Get("json") == "-" {
+			continue
+		}
+		lw.collect(v.Field(i), lintString{loc: []string{quote(f.Name)}})
+	}
+	for _, name := range sortedKeys(lw.Steps) {
+		s := lw.Steps[name]
+		loc := lintString{step: name, loc: []string{`"Steps"`, quote(name)}}
+		lw.collect(reflect.ValueOf(s).Elem(), loc)
+		// The strings of ForEach templates are kept in raw JSON until
+		// the template is expanded.
+		lintIterateStep(s, func(st *Step) {
+			if st.ForEach == nil || len(st.ForEach.Step) == 0 {
+				return
+			}
+			tmpl := &Step{}
+			if err := json.Unmarshal(st.ForEach.Step, tmpl); err != nil {
+				return
+			}
+			item := loc
+			item.item = true
+			lw.collect(reflect.ValueOf(tmpl).Elem(), item)
+		})
+	}
+}
+
+func (lw *lintWorkflow) collect(v reflect.Value, at lintString) {
+	traverseData(v, func(val reflect.Value) DError {
+		if s, ok := val.Interface().(string); ok && s != "" {
+			ls := at
+			ls.s = s
+			lw.strs = append(lw.strs, ls)
+		}
+		return nil
+	})
+}
+
+// steps calls f on the steps of lw, including nested ones, along with the
+// name of their top level step.
+func (lw *lintWorkflow) steps(f func(name string, s *Step)) {
+	for _, name := range sortedKeys(lw.Steps) {
+		lintIterateStep(lw.Steps[name], func(s *Step) {
+			f(name, s)
+		})
+	}
+}
+
+// lintIterateStep calls f on s and the steps nested in it. Unlike
+// iterateStep, it doesn't need the workflows of IncludeWorkflow steps.
+func lintIterateStep(s *Step, f func(*Step)) {
+	f(s)
+	for _, n := range s.nestedSteps() {
+		lintIterateStep(n, f)
+	}
+}
+
+// stepTimeout returns the timeout of s, resolved as far as possible.
+func (lw *lintWorkflow) stepTimeout(s *Step) string {
+	if s.Timeout != "" {
+		return lw.resolve(s.Timeout)
+	}
+	return lw.resolve(lw.DefaultTimeout)
+}
+
+func (l *linter) report(rule, file string, line int, format string, a ...interface{}) {
+	f := LintFinding{Rule: rule, File: file, Line: line, Message: fmt.Sprintf(format, a...)}
+	for _, r := range LintRules {
+		if r.ID == rule {
+			f.Level = r.Level
+		}
+	}
+	if !l.reported[f] {
+		l.reported[f] = true
+		l.findings = append(l.findings, f)
+	}
+}
+
+// lintTree runs the checks of a workflow and the workflows it includes.
+func (l *linter) lintTree(root *lintWorkflow) {
+	root.walk(func(lw *lintWorkflow) {
+		if l.checked[lw.file] {
+			return
+		}
+		l.checked[lw.file] = true
+		l.checkVars(lw)
+		l.checkIsolatedSteps(lw)
+		l.checkSignalIntervals(lw)
+	})
+	root.walk(l.checkContainedSignals)
+	l.checkSources(root)
+	l.checkResources(root)
+}
+
+// checkVars checks the ${} references of a workflow, and reports the Vars
+// it doesn't reference.
+func (l *linter) checkVars(lw *lintWorkflow) {
+	declared := func(name string) bool {
+		_, ok := lw.Vars[name]
+		return ok || strIn(name, autovarNames)
+	}
+	used := map[string]bool{}
+	for _, ls := range lw.strs {
+		for _, m := range varRefRgx.FindAllStringSubmatch(ls.s, -1) {
+			content := m[1]
+			line := lintLine(lw.data, append(ls.loc, m[0])...)
+			switch {
+			case strings.HasPrefix(content, "SOURCE:"), stepOutputRgx.MatchString(m[0]):
+				continue
+			case ls.item && content == "ITEM", declared(content):
+				used[content] = true
+				continue
+			}
+			e, err := parseExpression(content)
+			if err != nil {
+				l.report(LintUndeclaredReference, lw.file, line, "%s is neither a declared Var nor an expression", m[0])
+				continue
+			}
+			for _, v := range exprVars(e) {
+				if declared(v) || ls.item && v == "ITEM" {
+					used[v] = true
+				} else {
+					l.report(LintUndeclaredReference, lw.file, line, "%s references undeclared Var %q", m[0], v)
+				}
+			}
+		}
+	}
+	lw.steps(func(name string, s *Step) {
+		if s.ForEach == nil {
+			return
+		}
+		if _, ok := lw.Vars[s.ForEach.Var]; !ok {
+			l.report(LintUndeclaredReference, lw.file, lintLine(lw.data, `"Steps"`, quote(name), `"Var"`), "ForEach of step %q iterates over undeclared Var %q", name, s.ForEach.Var)
+		}
+		used[s.ForEach.Var] = true
+	})
+
+	for _, k := range sortedKeys(lw.Vars) {
+		if !used[k] {
+			l.report(LintUnusedVar, lw.file, lintLine(lw.data, `"Vars"`, quote(k)), "Var %q is never used", k)
+		}
+	}
+}
+
+func exprVars(e expression) []string {
+	switch e := e.(type) {
+	case varExpr:
+		return []string{string(e)}
+	case unaryExpr:
+		return exprVars(e.operand)
+	case binaryExpr:
+		return append(exprVars(e.left), exprVars(e.right)...)
+	case callExpr:
+		var vars []string
+		for _, arg := range e.args {
+			vars = append(vars, exprVars(arg)...)
+		}
+		return vars
+	}
+	return nil
+}
+
+// checkIsolatedSteps reports the steps that no other step depends on, and
+// that depend on no other step.
+func (l *linter) checkIsolatedSteps(lw *lintWorkflow) {
+	if len(lw.Steps) < 2 {
+		return
+	}
+	related := map[string]bool{}
+	for s, deps := range lw.Dependencies {
+		if len(deps) > 0 {
+			related[s] = true
+		}
+		for _, d := range deps {
+			related[d] = true
+		}
+	}
+	for _, name := range sortedKeys(lw.Steps) {
+		if !related[name] {
+			l.report(LintIsolatedStep, lw.file, lintLine(lw.data, `"Steps"`, quote(name)), "step %q has no dependencies and no dependents", name)
+		}
+	}
+}
+
+// checkSignalIntervals reports the WaitForInstancesSignal steps that time
+// out before they first check for a signal.
+func (l *linter) checkSignalIntervals(lw *lintWorkflow) {
+	lw.steps(func(name string, s *Step) {
+		timeout, err := time.ParseDuration(lw.stepTimeout(s))
+		if err != nil {
+			return
+		}
+		for _, is := range waitSignals(s) {
+			interval := is.Interval
+			if interval == "" {
+				interval = defaultInterval
+			}
+			d, err := time.ParseDuration(lw.resolve(interval))
+			if err == nil && d > timeout {
+				l.report(LintSignalTimeout, lw.file, lintLine(lw.data, `"Steps"`, quote(name)), "step %q times out after %s, before it first checks instance %q for a signal every %s", name, timeout, is.Name, d)
+			}
+		}
+	})
+}
+
+// checkContainedSignals reports the IncludeWorkflow and SubWorkflow steps of
+// lw that time out before a WaitForInstancesSignal step of their workflow.
+func (l *linter) checkContainedSignals(lw *lintWorkflow) {
+	for _, name := range sortedKeys(lw.children) {
+		s := lw.Steps[name]
+		timeout, err := time.ParseDuration(lw.stepTimeout(s))
+		if err != nil {
+			continue
+		}
+		lw.children[name].walk(func(c *lintWorkflow) {
+			c.steps(func(wait string, ws *Step) {
+				if len(waitSignals(ws)) == 0 {
+					return
+				}
+				d, err := time.ParseDuration(c.stepTimeout(ws))
+				if err == nil && d > timeout {
+					l.report(LintSignalTimeout, lw.file, lintLine(lw.data, `"Steps"`, quote(name)), "step %q times out after %s, before step %q of %s, which waits up to %s for instance signals", name, timeout, wait, relFile(lw.file, c.file), d)
+				}
+			})
+		})
+	}
+}
+
+func waitSignals(s *Step) []*InstanceSignal {
+	switch {
+	case s.WaitForInstancesSignal != nil:
+		return *s.WaitForInstancesSignal
+	case s.WaitForAnyInstancesSignal != nil:
+		return *s.WaitForAnyInstancesSignal
+	}
+	return nil
+}
+
+// checkSources reports the sources of a workflow tree that are never
+// referenced, and the ${SOURCE:} references to undeclared sources. Sources
+// are shared by all the workflows of the tree.
+func (l *linter) checkSources(root *lintWorkflow) {
+	declared := map[string]bool{}
+	root.walk(func(lw *lintWorkflow) {
+		for k := range lw.Sources {
+			declared[lw.resolve(k)] = true
+		}
+	})
+	root.walk(func(lw *lintWorkflow) {
+		for _, ls := range lw.strs {
+			for _, m := range sourceVarRgx.FindAllStringSubmatch(ls.s, -1) {
+				if k := lw.resolve(m[1]); !strings.Contains(k, "$") && !declared[k] {
+					l.report(LintUndeclaredReference, lw.file, lintLine(lw.data, append(ls.loc, m[0])...), "%s references undeclared source %q", m[0], k)
+				}
+			}
+		}
+	})
+	root.walk(func(lw *lintWorkflow) {
+		for _, k := range sortedKeys(lw.Sources) {
+			used := false
+			root.walk(func(o *lintWorkflow) {
+				for _, ls := range o.strs {
+					if ls.loc[0] != `"Sources"` && sourceUsed(o.resolve(ls.s), lw.resolve(k)) {
+						used = true
+						return
+					}
+				}
+			})
+			if !used {
+				l.report(LintUnusedSource, lw.file, lintLine(lw.data, `"Sources"`, quote(k)), "source %q is never referenced, instances can only read it through the daisy-sources-path metadata", k)
+			}
+		}
+	})
+}
+
+// sourceUsed reports whether s references the source key, or a directory of
+// sources holding it, such as ${SOURCESPATH}/scripts for scripts/build.sh.
+func sourceUsed(s, key string) bool {
+	for {
+		if strings.Contains(s, key) {
+			return true
+		}
+		i := strings.LastIndex(key, "/")
+		if i <= 0 {
+			return false
+		}
+		key = key[:i]
+	}
+}
+
+// checkResources reports the resources created under the same name in a
+// workflow and the workflows it includes, and the resources that are never
+// used or deleted.
+func (l *linter) checkResources(root *lintWorkflow) {
+	var all []lintResource
+	byGroup := map[*lintWorkflow]map[string]lintResource{}
+	root.walk(func(lw *lintWorkflow) {
+		if byGroup[lw.group] == nil {
+			byGroup[lw.group] = map[string]lintResource{}
+		}
+		created := byGroup[lw.group]
+		lw.steps(func(name string, s *Step) {
+			for _, r := range createdResources(s) {
+				line := lintLine(lw.data, `"Steps"`, quote(name), quote(r.name))
+				r.name, r.step, r.lw = lw.resolve(r.name), name, lw
+				all = append(all, r)
+				if r.name == "" || hasUnresolvedVars(r.name) {
+					continue
+				}
+				key := r.kind + "/" + r.name
+				if first, ok := created[key]; ok {
+					l.report(LintDuplicateResource, lw.file, line, "%s %q of step %q is also created by step %q of %s", r.kind, r.name, name, first.step, relFile(lw.file, first.lw.file))
+					continue
+				}
+				created[key] = r
+			}
+		})
+	})
+
+	for _, r := range all {
+		if r.noCleanup || r.name == "" {
+			continue
+		}
+		used := regexp.MustCompile(`(^|[^A-Za-z0-9_-])` + regexp.QuoteMeta(r.name) + `($|[^A-Za-z0-9_-])`)
+		found := false
+		root.walk(func(lw *lintWorkflow) {
+			for _, ls := range lw.strs {
+				if (lw != r.lw || ls.step != r.step) && ls.loc[0] != `"Sources"` && used.MatchString(lw.resolve(ls.s)) {
+					found = true
+					return
+				}
+			}
+		})
+		if !found {
+			l.report(LintUnusedResource, r.lw.file, lintLine(r.lw.data, `"Steps"`, quote(r.step)), "%s %q of step %q is never used or deleted, so it is deleted when the workflow ends; set NoCleanup to keep it", r.kind, r.name, r.step)
+		}
+	}
+}
+
+// hasUnresolvedVars reports whether s references vars other than autovars,
+// which are the same in all the workflows of a run.
+func hasUnresolvedVars(s string) bool {
+	for _, m := range varRefRgx.FindAllStringSubmatch(s, -1) {
+		if !strIn(m[1], autovarNames) {
+			return true
+		}
+	}
+	return false
+}
+
+// createdResources returns the resources that s creates. Their names are the
+// names given in the workflow file.
+func createdResources(s *Step) []lintResource {
+	var res []lintResource
+	add := func(kind string, list interface{}) {
+		l := reflect.ValueOf(list)
+		for i := 0; i < l.Len(); i++ {
+			if l.Index(i).IsNil() {
+				continue
+			}
+			r := l.Index(i).Elem()
+			res = append(res, lintResource{kind: kind, name: r.FieldByName("Name").String(), noCleanup: r.FieldByName("NoCleanup").Bool()})
+		}
+	}
+	switch {
+	case s.CreateDisks != nil:
+		add("disk", *s.CreateDisks)
+	case s.CreateImages != nil:
+		add("image", s.CreateImages.Images)
+	case s.CreateInstances != nil:
+		add("instance", s.CreateInstances.Instances)
+	case s.CreateMachineImages != nil:
+		add("machine image", *s.CreateMachineImages)
+	case s.CreateNetworks != nil:
+		add("network", *s.CreateNetworks)
+	case s.CreateSubnetworks != nil:
+		add("subnetwork", *s.CreateSubnetworks)
+	case s.CreateFirewallRules != nil:
+		add("firewall rule", *s.CreateFirewallRules)
+	case s.CreateForwardingRules != nil:
+		add("forwarding rule", *s.CreateForwardingRules)
+	case s.CreateTargetInstances != nil:
+		add("target instance", *s.CreateTargetInstances)
+	case s.CreateSnapshots != nil:
+		add("snapshot", *s.CreateSnapshots)
+	}
+	return res
+}
+
+// lintLine returns the line of the last of needles found in data, looking
+// for each needle after the previous one, or 0 if none is found.
+func lintLine(data []byte, needles ...string) int {
+	line, off := 0, 0
+	for _, n := range needles {
+		i := bytes.Index(data[off:], []byte(n))
+		if i < 0 {
+			break
+		}
+		off += i
+		line = bytes.Count(data[:off], []byte("\n")) + 1
+		off += len(n)
+	}
+	return line
+}
+
+// relFile returns the path of file relative to the directory of from, so
+// that messages don't depend on where the workflows are linted from.
+func relFile(from, file string) string {
+	if rel, err := filepath.Rel(filepath.Dir(from), file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+func quote(s string) string {
+	return `"` + s + `"`
+}
+
+// sortedKeys returns the keys of a map with string keys, sorted.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,173 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const lintParentWf = `{
+  "Name": "parent",
+  "Vars": {
+    "used": "a",
+    "unused": "b",
+    "items": "x,y"
+  },
+  "Sources": {
+    "startup.sh": "./startup.sh",
+    "scripts/a.sh": "./a.sh",
+    "orphan.sh": "./orphan.sh"
+  },
+  "Steps": {
+    "create-disk": {
+      "CreateDisks": [{"Name": "disk-${used}", "SourceImage": "img"}]
+    },
+    "create-inst": {
+      "CreateInstances": [{
+        "Name": "inst",
+        "Disks": [{"Source": "disk-a"}],
+        "StartupScript": "startup.sh",
+        "Metadata": {"dir": "${SOURCESPATH}/scripts", "bad": "${nope}", "expr": "${lower(missing)}"}
+      }]
+    },
+    "wait": {
+      "Timeout": "1m",
+      "WaitForInstancesSignal": [{"Name": "inst", "Interval": "5m", "Stopped": true}]
+    },
+    "each": {
+      "ForEach": {"Var": "items", "Step": {"CreateDisks": [{"Name": "disk-${ITEM}", "SourceImage": "${SOURCE:missing.sh}", "NoCleanup": true}]}}
+    },
+    "include": {
+      "Timeout": "10m",
+      "IncludeWorkflow": {"Path": "./child.wf.json", "Vars": {"child_var": "${used}", "other": "x"}}
+    },
+    "lonely": {
+      "CreateImages": [{"Name": "image-out", "SourceDisk": "disk-a"}]
+    }
+  },
+  "Dependencies": {
+    "create-inst": ["create-disk"],
+    "wait": ["create-inst"],
+    "each": ["wait"],
+    "include": ["each"]
+  }
+}
+`
+
+const lintChildWf = `{
+  "Vars": {
+    "child_var": {"Required": true}
+  },
+  "Steps": {
+    "create-disk": {
+      "CreateDisks": [{"Name": "disk-${child_var}", "SourceImage": "img", "NoCleanup": true}]
+    },
+    "wait": {
+      "Timeout": "1h",
+      "WaitForInstancesSignal": [{"Name": "inst", "Stopped": true}]
+    }
+  },
+  "Dependencies": {
+    "wait": ["create-disk"]
+  }
+}
+`
+
+func TestLint(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	parent := filepath.Join(td, "parent.wf.json")
+	child := filepath.Join(td, "child.wf.json")
+	for f, data := range map[string]string{parent: lintParentWf, child: lintChildWf} {
+		if err := ioutil.WriteFile(f, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The child is included by the parent, so it is only checked with it.
+	got := map[string]bool{}
+	for _, f := range Lint(child, parent) {
+		got[fmt.Sprintf("%s %s:%d %s: %s", f.Level, filepath.Base(f.File), f.Line, f.Rule, f.Message)] = true
+	}
+	want := []string{
+		`warning parent.wf.json:5 unused-var: Var "unused" is never used`,
+		`warning parent.wf.json:11 unused-source: source "orphan.sh" is never referenced, instances can only read it through the daisy-sources-path metadata`,
+		`error parent.wf.json:22 undeclared-reference: ${nope} references undeclared Var "nope"`,
+		`error parent.wf.json:22 undeclared-reference: ${lower(missing)} references undeclared Var "missing"`,
+		`warning parent.wf.json:25 signal-timeout: step "wait" times out after 1m0s, before it first checks instance "inst" for a signal every 5m0s`,
+		`error parent.wf.json:30 undeclared-reference: ${SOURCE:missing.sh} references undeclared source "missing.sh"`,
+		`warning parent.wf.json:32 signal-timeout: step "include" times out after 10m0s, before step "wait" of child.wf.json, which waits up to 1h0m0s for instance signals`,
+		`error parent.wf.json:34 undeclared-reference: step "include" passes Var "other", which child.wf.json doesn't declare`,
+		`warning parent.wf.json:36 isolated-step: step "lonely" has no dependencies and no dependents`,
+		`warning parent.wf.json:36 unused-resource: image "image-out" of step "lonely" is never used or deleted, so it is deleted when the workflow ends; set NoCleanup to keep it`,
+		`error child.wf.json:7 duplicate-resource: disk "disk-a" of step "create-disk" is also created by step "create-disk" of parent.wf.json`,
+	}
+	for _, w := range want {
+		if !got[w] {
+			t.Errorf("missing finding: %s", w)
+		}
+		delete(got, w)
+	}
+	for f := range got {
+		t.Errorf("unexpected finding: %s", f)
+	}
+}
+
+func TestLintInvalidWorkflow(t *testing.T) {
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	f := filepath.Join(td, "bad.wf.json")
+	if err := ioutil.WriteFile(f, []byte(`{"Steps": {"include": {"IncludeWorkflow": {"Path": "./missing.wf.json"}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := Lint(f, filepath.Join(td, "none.wf.json"))
+	if len(got) != 2 {
+		t.Fatalf("expected 2 findings, got: %+v", got)
+	}
+	for _, f := range got {
+		if f.Rule != LintInvalidWorkflow || f.Level != LintError {
+			t.Errorf("unexpected finding: %+v", f)
+		}
+	}
+}
+
+func TestLintLine(t *testing.T) {
+	data := []byte("{\n  \"Vars\": {\n    \"a\": \"x\"\n  },\n  \"Steps\": {\n    \"a\": {}\n  }\n}")
+	tests := []struct {
+		needles []string
+		want    int
+	}{
+		{[]string{`"Steps"`, `"a"`}, 6},
+		{[]string{`"Vars"`, `"a"`}, 3},
+		{[]string{`"Steps"`, `"b"`}, 5},
+		{[]string{`"Other"`}, 0},
+	}
+	for _, tt := range tests {
+		if got := lintLine(data, tt.needles...); got != tt.want {
+			t.Errorf("%q: got line %d, want %d", tt.needles, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/compute-image-tools/daisy/compute"
+	"google.golang.org/api/option"
+)
+
+// PlanEntry is an API call that a workflow would make, as reported by Plan.
+type PlanEntry struct {
+	// Step making the call, "sources" for source uploads and "cleanup" for
+	// the workflow cleanup.
+	Step string
+	// Action is "create", "delete", "upload", "copy", "wait", "run" for steps
+	// of registered types or the name of a custom resource method, e.g. "stop"
+	// or "attachDisk".
+	Action string
+	// Resource is a partial GCE resource URL or a gs:// path.
+	Resource string
+	// Details lists noteworthy request fields, such as sizes and source images.
+	Details string `json:",omitempty"`
+}
+
+func (e PlanEntry) String() string {
+	s := fmt.Sprintf("%s: %s %s", e.Step, e.Action, e.Resource)
+	if e.Details != "" {
+		s += fmt.Sprintf(" (%s)", e.Details)
+	}
+	return s
+}
+
+// planDetailKeys are the request fields reported in PlanEntry.Details.
+var planDetailKeys = []string{"diskSizeGb", "family", "machineType", "network", "rawDisk", "sizeGb", "source", "sourceDisk", "sourceImage", "sourceSnapshot", "subnetwork", "type"}
+
+var (
+	planComputeCollections = map[string]bool{
+		"disks": true, "firewalls": true, "forwardingRules": true, "images": true, "instances": true,
+		"licenses": true, "machineImages": true, "machineTypes": true, "networks": true, "regions": true,
+		"snapshots": true, "subnetworks": true, "targetInstances": true, "zones": true,
+	}
+	planUploadRgx  = regexp.MustCompile(`/b/([^/]+)/o\?`)
+	planRewriteRgx = regexp.MustCompile(`/b/([^/]+)/o/([^/]+)/rewriteTo/b/([^/]+)/o/([^?]+)`)
+	planObjectRgx  = regexp.MustCompile(`/b/([^/]+)/o/([^/?]+)`)
+	planNameRgx    = regexp.MustCompile(`"name":\s*"([^"]+)"`)
+)
+
+// planRecorder is the fake API backend of a plan. It records every mutating
+// request and answers lookups as if all referenced resources exist.
+type planRecorder struct {
+	computeServer, storageServer *httptest.Server
+	computeClient                compute.Client
+	storageClient                *storage.Client
+
+	mx        sync.Mutex
+	step      string
+	entries   []PlanEntry
+	resources map[string]map[string]interface{}
+	opCount   int
+}
+
+func newPlanRecorder(ctx context.Context) (*planRecorder, error) {
+	p := &planRecorder{resources: map[string]map[string]interface{}{}}
+	p.computeServer = httptest.NewServer(http.HandlerFunc(p.handleCompute))
+	p.storageServer = httptest.NewServer(http.HandlerFunc(p.handleStorage))
+
+	var err error
+	p.computeClient, err = compute.NewClient(ctx, option.WithEndpoint(p.computeServer.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+	p.storageClient, err = storage.NewClient(ctx, option.WithEndpoint(p.storageServer.URL), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *planRecorder) close() {
+	p.computeServer.Close()
+	p.storageServer.Close()
+}
+
+func (p *planRecorder) setStep(name string) {
+	p.mx.Lock()
+	p.step = name
+	p.mx.Unlock()
+}
+
+func (p *planRecorder) record(action, resource, details string) {
+	p.mx.Lock()
+	p.entries = append(p.entries, PlanEntry{Step: p.step, Action: action, Resource: resource, Details: details})
+	p.mx.Unlock()
+}
+
+// simulate records steps that only wait on resources, and steps of registered
+// types, instead of running them.
+// It returns true if the step must not be run.
+func (p *planRecorder) simulate(s *Step, impl stepImpl) bool {
+	var signals []*InstanceSignal
+	switch st := impl.(type) {
+	case *WaitForInstancesSignal:
+		signals = *st
+	case *WaitForAnyInstancesSignal:
+		signals = *st
+	case *registeredStep:
+		// Registered step types may act outside of GCP, so they are only listed.
+		p.record("run", st.name, "")
+		return true
+	default:
+		return false
+	}
+	for _, is := range signals {
+		link := is.Name
+		if i, ok := s.w.instances.get(is.Name); ok {
+			link = i.link
+		}
+		var details []string
+		if is.Stopped {
+			details = append(details, "stopped")
+		}
+		if is.SerialOutput != nil && is.SerialOutput.SuccessMatch != "" {
+			details = append(details, fmt.Sprintf("successMatch=%q", is.SerialOutput.SuccessMatch))
+		}
+		p.record("wait", link, strings.Join(details, ", "))
+	}
+	return true
+}
+
+func (p *planRecorder) writeOperation(w http.ResponseWriter) {
+	p.mx.Lock()
+	p.opCount++
+	n := p.opCount
+	p.mx.Unlock()
+	fmt.Fprintf(w, `{"name":"operation-%d","status":"DONE"}`, n)
+}
+
+func (p *planRecorder) handleCompute(w http.ResponseWriter, r *http.Request) {
+	i := strings.Index(r.URL.Path, "projects/")
+	if i == -1 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	link := r.URL.Path[i:]
+	parts := strings.Split(link, "/")
+	last := parts[len(parts)-1]
+
+	if strIn("operations", parts) {
+		p.writeOperation(w)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p.mx.Lock()
+		res, ok := p.resources[link]
+		p.mx.Unlock()
+		switch {
+		case ok:
+			json.NewEncoder(w).Encode(res)
+		case last == "serialPort":
+			// Simulated instances never write serial output.
+			w.WriteHeader(http.StatusNotFound)
+		case planComputeCollections[last]:
+			fmt.Fprint(w, `{}`)
+		default:
+			fmt.Fprintf(w, `{"name":%q,"selfLink":%q,"status":"READY"}`, last, link)
+		}
+		return
+	case http.MethodDelete:
+		p.mx.Lock()
+		delete(p.resources, link)
+		p.mx.Unlock()
+		p.record("delete", link, "")
+	default:
+		body := map[string]interface{}{}
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		if planComputeCollections[last] {
+			name, _ := body["name"].(string)
+			link = path.Join(link, name)
+			body["selfLink"] = link
+			body["status"] = "READY"
+			if last == "instances" {
+				// Stops serial port streaming of simulated instances.
+				body["status"] = "TERMINATED"
+			}
+			p.mx.Lock()
+			p.resources[link] = body
+			p.mx.Unlock()
+			p.record("create", link, planDetails(body))
+		} else {
+			p.record(last, path.Join(parts[:len(parts)-1]...), planDetails(body))
+		}
+	}
+	p.writeOperation(w)
+}
+
+func (p *planRecorder) handleStorage(w http.ResponseWriter, r *http.Request) {
+	u := r.URL.String()
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Path == "/b" {
+			fmt.Fprintf(w, `{"items":[{"name":"%s-daisy-bkt"}]}`, strings.Replace(r.URL.Query().Get("project"), ":", "-", -1))
+			return
+		}
+		if strings.Contains(u, "alt=json") {
+			fmt.Fprint(w, `{}`)
+		}
+		return
+	case http.MethodDelete:
+		if m := planObjectRgx.FindStringSubmatch(u); m != nil {
+			obj, _ := url.PathUnescape(m[2])
+			p.record("delete", fmt.Sprintf("gs://%s/%s", m[1], obj), "")
+		}
+		fmt.Fprint(w, `{}`)
+		return
+	}
+
+	data, _ := ioutil.ReadAll(r.Body)
+	if m := planRewriteRgx.FindStringSubmatch(u); m != nil {
+		src, _ := url.PathUnescape(m[2])
+		dst, _ := url.PathUnescape(m[4])
+		p.record("copy", fmt.Sprintf("gs://%s/%s", m[3], dst), fmt.Sprintf("source=gs://%s/%s", m[1], src))
+		fmt.Fprintf(w, `{"done":true,"resource":{"bucket":%q,"name":%q}}`, m[3], dst)
+		return
+	}
+	if m := planUploadRgx.FindStringSubmatch(u); m != nil {
+		name := r.URL.Query().Get("name")
+		if n := planNameRgx.FindStringSubmatch(string(data)); name == "" && n != nil {
+			name = n[1]
+		}
+		p.record("upload", fmt.Sprintf("gs://%s/%s", m[1], name), "")
+		fmt.Fprintf(w, `{"bucket":%q,"name":%q}`, m[1], name)
+		return
+	}
+	if r.URL.Path == "/b" {
+		if n := planNameRgx.FindStringSubmatch(string(data)); n != nil {
+			p.record("create", "gs://"+n[1], "")
+		}
+	}
+	fmt.Fprint(w, `{}`)
+}
+
+// planDetails formats the noteworthy fields found anywhere in a request body.
+func planDetails(body map[string]interface{}) string {
+	found := map[string][]string{}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, e := range t {
+				if s, ok := e.(string); ok && s != "" && strIn(k, planDetailKeys) {
+					if !strIn(s, found[k]) {
+						found[k] = append(found[k], s)
+					}
+					continue
+				}
+				walk(e)
+			}
+		case []interface{}:
+			for _, e := range t {
+				walk(e)
+			}
+		}
+	}
+	walk(body)
+
+	var details []string
+	for _, k := range planDetailKeys {
+		if vs, ok := found[k]; ok {
+			sort.Strings(vs)
+			details = append(details, fmt.Sprintf("%s=%s", k, strings.Join(vs, ",")))
+		}
+	}
+	return strings.Join(details, ", ")
+}
+
+// planRecorder returns the recorder of the plan being made, if any.
+func (w *Workflow) planRecorder() *planRecorder {
+	for ; w != nil; w = w.parent {
+		if w.plan != nil {
+			return w.plan
+		}
+	}
+	return nil
+}
+
+// Plan populates and validates the workflow, then simulates running it
+// against recording GCE and GCS backends. It returns the API calls the
+// workflow would make, in order, without needing access to a GCP project.
+// Steps are simulated one at a time and WaitForInstancesSignal steps are only
+// recorded, as no instance ever runs.
+func (w *Workflow) Plan(ctx context.Context) ([]PlanEntry, DError) {
+	p, err := newPlanRecorder(ctx)
+	if err != nil {
+		return nil, newErr("failed to create plan backend", err)
+	}
+	defer p.close()
+	w.plan = p
+	w.ComputeClient = p.computeClient
+	w.StorageClient = p.storageClient
+	w.externalLogging = false
+	w.DisableCloudLogging()
+	w.DisableGCSLogging()
+
+	if err := w.Validate(ctx); err != nil {
+		return nil, err
+	}
+
+	p.setStep("sources")
+	if err := w.uploadSources(ctx); err != nil {
+		w.CancelWorkflow()
+		return nil, err
+	}
+	runErr := w.run(ctx)
+	p.setStep("cleanup")
+	w.cleanup()
+	if runErr != nil {
+		return nil, runErr
+	}
+	return p.entries, nil
+}
@@ -0,0 +1,90 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	w := New()
+	w.id = "abcdef"
+	w.Logger = &MockLogger{}
+	wf := `{
+	  "Name": "plan",
+	  "Project": "p",
+	  "Zone": "us-central1-a",
+	  "GCSPath": "gs://bkt/path",
+	  "Steps": {
+	    "create-disk": {
+	      "CreateDisks": [{"Name": "disk", "SourceImage": "projects/debian-cloud/global/images/family/debian-10", "SizeGb": "20"}]
+	    },
+	    "create-instance": {
+	      "CreateInstances": [{"Name": "inst", "Disks": [{"Source": "disk"}], "MachineType": "n1-standard-2"}]
+	    },
+	    "wait": {
+	      "WaitForInstancesSignal": [{"Name": "inst", "SerialOutput": {"Port": 1, "SuccessMatch": "done"}}]
+	    },
+	    "create-image": {
+	      "CreateImages": [{"Name": "image", "SourceDisk": "disk", "NoCleanup": true, "ExactName": true}]
+	    }
+	  },
+	  "Dependencies": {
+	    "create-instance": ["create-disk"],
+	    "wait": ["create-instance"],
+	    "create-image": ["wait"]
+	  }
+	}`
+	if err := json.Unmarshal([]byte(wf), w); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := w.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("error planning workflow: %v", err)
+	}
+
+	disk := "projects/p/zones/us-central1-a/disks/disk-plan-abcdef"
+	inst := "projects/p/zones/us-central1-a/instances/inst-plan-abcdef"
+	want := []PlanEntry{
+		{Step: "plan.create-disk", Action: "create", Resource: disk, Details: "sizeGb=20, sourceImage=projects/debian-cloud/global/images/family/debian-10, type=projects/p/zones/us-central1-a/diskTypes/pd-standard"},
+		{Step: "plan.create-instance", Action: "create", Resource: inst, Details: "machineType=projects/p/zones/us-central1-a/machineTypes/n1-standard-2, network=projects/p/global/networks/default, source=" + disk + ", type=ONE_TO_ONE_NAT"},
+		{Step: "plan.wait", Action: "wait", Resource: inst, Details: `successMatch="done"`},
+		{Step: "plan.create-image", Action: "create", Resource: "projects/p/global/images/image", Details: "sourceDisk=" + disk},
+		{Step: "cleanup", Action: "delete", Resource: inst},
+		{Step: "cleanup", Action: "delete", Resource: disk},
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("plan doesn't match expectation: (-got +want)\n%s", diffRes)
+	}
+}
+
+func TestPlanDetails(t *testing.T) {
+	body := map[string]interface{}{
+		"name":   "i",
+		"sizeGb": "10",
+		"disks": []interface{}{
+			map[string]interface{}{"initializeParams": map[string]interface{}{"sourceImage": "b", "diskSizeGb": "10"}},
+			map[string]interface{}{"initializeParams": map[string]interface{}{"sourceImage": "a"}},
+			map[string]interface{}{"source": ""},
+		},
+	}
+	want := "diskSizeGb=10, sizeGb=10, sourceImage=a,b"
+	if got := planDetails(body); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
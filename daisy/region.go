@@ -19,6 +19,9 @@ import (
 )
 
 func (w *Workflow) regionExists(project, region string) (bool, DError) {
+	if w.planRecorder() != nil {
+		return true, nil
+	}
 	return w.zonesCache.resourceExists(func(project string, opts ...daisyCompute.ListCallOption) (interface{}, error) {
 		return w.ComputeClient.ListRegions(project)
 	}, project, region)
@@ -50,6 +50,17 @@ type Resource struct {
 	users             []*Step
 }
 
+// markCreated records that the workflow created the resource.
+func (r *Resource) markCreated() {
+	r.createdInWorkflow = true
+	if r.creator != nil {
+		emitResourceEvent(r.creator, nil, EventResourceCreated, r.link)
+		if j := r.creator.w.journal; j != nil {
+			j.recordResource()
+		}
+	}
+}
+
 func (r *Resource) populateWithGlobal(ctx context.Context, s *Step, name string) (string, DError) {
 	errs := r.populateHelper(ctx, s, name)
 	return r.RealName, errs
@@ -135,6 +146,10 @@ func (w *Workflow) resourceExists(url string) (bool, DError) {
 	if !strings.HasPrefix(url, "projects/") {
 		return false, Errf("partial GCE resource URL %q needs leading \"projects/PROJECT/\"", url)
 	}
+	// Plans assume that all resources the workflow doesn't create exist.
+	if w.planRecorder() != nil {
+		return true, nil
+	}
 	switch {
 	case machineTypeURLRegex.MatchString(url):
 		result := NamedSubexp(machineTypeURLRegex, url)
@@ -17,6 +17,7 @@ package daisy
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -43,6 +44,7 @@ func (r *baseResourceRegistry) cleanup() {
 		if res.creator == nil || // placeholder resource
 			(res.creator != nil && !res.createdInWorkflow) || // resource isn‘t created successfully
 			(res.NoCleanup && !r.w.forceCleanup) || // resource is flagged to avoid cleanup
+			(r.w.journal != nil && r.w.journal.keepResources) || // resource is kept to resume the workflow
 			res.deleted { // resource has been deleted
 			continue
 		}
@@ -80,6 +82,7 @@ func (r *baseResourceRegistry) delete(name string) DError {
 		return err
 	}
 	res.deleted = true
+	emitResourceEvent(res.deleter, r.w, EventResourceDeleted, res.link)
 	return nil
 }
 
@@ -124,6 +127,32 @@ func (r *baseResourceRegistry) get(name string) (*Resource, bool) {
 	return res, ok
 }
 
+// deleteStepResources deletes the resources that s created, so that s can
+// create them again when it is rerun.
+func (w *Workflow) deleteStepResources(s *Step) DError {
+	for _, r := range w.resourceRegistries() {
+		r.mx.Lock()
+		var names []string
+		for name, res := range r.m {
+			if res.creator == s && res.createdInWorkflow && !res.deleted {
+				names = append(names, name)
+			}
+		}
+		r.mx.Unlock()
+		sort.Strings(names)
+		for _, name := range names {
+			w.LogStepInfo(s.name, "Cleanup", "Deleting %s %q created by the failed run of the step.", r.typeName, name)
+			if err := r.delete(name); err != nil && err.etype() != resourceDNEError {
+				return err
+			}
+			res, _ := r.get(name)
+			res.createdInWorkflow = false
+			res.deleted = false
+		}
+	}
+	return nil
+}
+
 // regCreate registers a Step s as the creator of a resource, res, and identifies the resource by name.
 func (r *baseResourceRegistry) regCreate(name string, res *Resource, s *Step, overWrite bool) DError {
 	// Check:
@@ -134,7 +163,8 @@ func (r *baseResourceRegistry) regCreate(name string, res *Resource, s *Step, ov
 		return Errf("cannot create %s %q; already created by step %q", r.typeName, name, res.creator.name)
 	}
 
-	if !overWrite {
+	// Resources created by a resumed run already exist, and plans can't look up resources.
+	if !overWrite && !r.w.journal.resourceJournaled(r.typeName, res.link) && r.w.planRecorder() == nil {
 		if exists, err := r.w.resourceExists(res.link); err != nil {
 			return Errf("cannot create %s %q; resource lookup error: %v", r.typeName, name, err)
 		} else if exists {
@@ -0,0 +1,342 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// SerialLogArchiveName is the name of the serial log archive in the logs
+	// directory of the scratch path of a run.
+	SerialLogArchiveName = "serial-logs.tar.gz"
+	serialLogIndexName   = "index.json"
+	// serialLogArchivePorts are the serial ports archived for every instance.
+	serialLogArchivePorts = 4
+	// serialLogArchivePortBytes caps the log kept for a port; the oldest
+	// output is dropped past it.
+	serialLogArchivePortBytes = 8 << 20
+)
+
+// SerialLogIndex describes the content of a serial log archive. It is the
+// first file of the archive, index.json.
+type SerialLogIndex struct {
+	// Workflow name and ID of the archived run.
+	Workflow  string              `json:"workflow"`
+	ID        string              `json:"id"`
+	Instances []SerialLogInstance `json:"instances,omitempty"`
+}
+
+// SerialLogInstance indexes the serial logs of an instance.
+type SerialLogInstance struct {
+	// Name of the instance in GCE.
+	Name string `json:"name"`
+	// Absolute name of the step that created the instance.
+	Step  string          `json:"step"`
+	Ports []SerialLogPort `json:"ports,omitempty"`
+	// Signals matched by WaitForInstancesSignal steps.
+	Signals []SerialLogSignal `json:"signals,omitempty"`
+}
+
+// SerialLogPort indexes the log of a serial port of an instance.
+type SerialLogPort struct {
+	Port int64 `json:"port"`
+	// Path of the log in the archive.
+	File string `json:"file"`
+	// Times the first and the last output of the port were read.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Bytes int64     `json:"bytes"`
+	// Dropped is the number of bytes dropped from the start of the log to
+	// keep it under the size cap of a port.
+	Dropped int64 `json:"dropped,omitempty"`
+}
+
+// SerialLogSignal is a signal of an instance matched by a step.
+type SerialLogSignal struct {
+	Time time.Time `json:"time"`
+	// Absolute name of the step that matched the signal.
+	Step  string `json:"step"`
+	Kind  string `json:"kind"`
+	Match string `json:"match"`
+}
+
+// Filter returns the instances that step created, and the instances that
+// step matched signals of, with only those signals. All instances are
+// returned if step is empty.
+func (idx *SerialLogIndex) Filter(step string) []SerialLogInstance {
+	if step == "" {
+		return idx.Instances
+	}
+	var res []SerialLogInstance
+	for _, i := range idx.Instances {
+		if stepMatches(i.Step, step) {
+			res = append(res, i)
+			continue
+		}
+		var signals []SerialLogSignal
+		for _, sig := range i.Signals {
+			if stepMatches(sig.Step, step) {
+				signals = append(signals, sig)
+			}
+		}
+		if len(signals) > 0 {
+			i.Signals = signals
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// stepMatches reports whether an absolute step name, such as wf.include.step,
+// names step. The step can be given with or without its workflows.
+func stepMatches(abs, step string) bool {
+	return abs == step || strings.HasSuffix(abs, "."+step)
+}
+
+// serialLogArchive collects the serial logs of the instances of a run.
+type serialLogArchive struct {
+	mx        sync.Mutex
+	instances map[string]*archivedInstance
+}
+
+type archivedInstance struct {
+	SerialLogInstance
+	logs map[int64]*archivedPort
+}
+
+type archivedPort struct {
+	buf        bytes.Buffer
+	dropped    int64
+	start, end time.Time
+}
+
+// EnableSerialLogArchive makes Run archive ports 1-4 of the serial console of
+// every instance the workflow creates, along with the signals matched by
+// WaitForInstancesSignal steps. The archive is written to
+// logs/serial-logs.tar.gz in the scratch path when the run ends. Only the
+// last 8 MiB of each port are kept.
+func (w *Workflow) EnableSerialLogArchive() {
+	w.serialLogs = &serialLogArchive{instances: map[string]*archivedInstance{}}
+}
+
+// serialLogArchive returns the archive of the run, or nil if it isn't enabled.
+func (w *Workflow) serialLogArchive() *serialLogArchive {
+	for w.parent != nil {
+		w = w.parent
+	}
+	return w.serialLogs
+}
+
+func (a *serialLogArchive) instance(name string) *archivedInstance {
+	i, ok := a.instances[name]
+	if !ok {
+		i = &archivedInstance{SerialLogInstance: SerialLogInstance{Name: name}, logs: map[int64]*archivedPort{}}
+		a.instances[name] = i
+	}
+	return i
+}
+
+// recordOutput appends output read from a serial port of an instance created
+// by s.
+func (a *serialLogArchive) recordOutput(s *Step, instance string, port int64, contents string) {
+	if contents == "" {
+		return
+	}
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	i := a.instance(instance)
+	i.Step = fmt.Sprintf("%s.%s", getAbsoluteName(s.w), s.name)
+	p, ok := i.logs[port]
+	if !ok {
+		p = &archivedPort{start: time.Now()}
+		i.logs[port] = p
+	}
+	p.buf.WriteString(contents)
+	if over := p.buf.Len() - serialLogArchivePortBytes; over > 0 {
+		p.buf.Next(over)
+		p.dropped += int64(over)
+	}
+	p.end = time.Now()
+}
+
+func (a *serialLogArchive) recordSignal(e *Event) {
+	if e.Type != EventSerialMatch && e.Type != EventGuestAttributeMatch {
+		return
+	}
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	i := a.instance(e.Instance)
+	i.Signals = append(i.Signals, SerialLogSignal{
+		Time:  e.Time,
+		Step:  fmt.Sprintf("%s.%s", e.Workflow, e.Step),
+		Kind:  e.MatchKind,
+		Match: e.Match,
+	})
+}
+
+// write writes the archive as a gzipped tar file, with the index first.
+func (a *serialLogArchive) write(wr io.Writer, name, id string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	idx := SerialLogIndex{Workflow: name, ID: id}
+	var names []string
+	for n := range a.instances {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	files := map[string][]byte{}
+	for _, n := range names {
+		i := a.instances[n]
+		inst := i.SerialLogInstance
+		inst.Ports = nil
+		var ports []int64
+		for p := range i.logs {
+			ports = append(ports, p)
+		}
+		sort.Slice(ports, func(x, y int) bool { return ports[x] < ports[y] })
+		for _, p := range ports {
+			l := i.logs[p]
+			f := path.Join(n, fmt.Sprintf("serial-port%d.log", p))
+			files[f] = l.buf.Bytes()
+			inst.Ports = append(inst.Ports, SerialLogPort{Port: p, File: f, Start: l.start, End: l.end, Bytes: int64(l.buf.Len()), Dropped: l.dropped})
+		}
+		idx.Instances = append(idx.Instances, inst)
+	}
+
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(wr)
+	tw := tar.NewWriter(gz)
+	writeFile := func(name string, b []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), ModTime: time.Now(), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err := tw.Write(b)
+		return err
+	}
+	if err := writeFile(serialLogIndexName, data); err != nil {
+		return err
+	}
+	for _, inst := range idx.Instances {
+		for _, p := range inst.Ports {
+			if err := writeFile(p.File, files[p.File]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeSerialLogArchive writes the serial log archive of the run to the logs
+// directory of the scratch path.
+func (w *Workflow) writeSerialLogArchive(ctx context.Context) {
+	if w.serialLogs == nil || w.StorageClient == nil {
+		return
+	}
+	obj := path.Join(w.logsPath, SerialLogArchiveName)
+	wc := w.StorageClient.Bucket(w.bucket).Object(obj).NewWriter(ctx)
+	wc.ContentType = "application/gzip"
+	err := w.serialLogs.write(wc, w.Name, w.id)
+	if cErr := wc.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		w.LogWorkflowInfo("Error writing serial log archive: %v", err)
+		return
+	}
+	w.LogWorkflowInfo("Serial log archive: gs://%s/%s", w.bucket, obj)
+}
+
+// ReadSerialLogArchive reads a serial log archive. It returns the index of
+// the archive and the logs, by path in the archive.
+func ReadSerialLogArchive(r io.Reader) (*SerialLogIndex, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gz.Close()
+	var idx *SerialLogIndex
+	logs := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hdr.Name == serialLogIndexName {
+			idx = &SerialLogIndex{}
+			if err := json.Unmarshal(data, idx); err != nil {
+				return nil, nil, JSONError(serialLogIndexName, data, err)
+			}
+			continue
+		}
+		logs[hdr.Name] = data
+	}
+	if idx == nil {
+		return nil, nil, fmt.Errorf("no %s in serial log archive", serialLogIndexName)
+	}
+	return idx, logs, nil
+}
+
+// FindSerialLogArchive returns the GCS path of the serial log archive of the
+// run with the given ID, in the scratch paths under gcsPath.
+func FindSerialLogArchive(ctx context.Context, client *storage.Client, gcsPath, id string) (string, error) {
+	bkt, prefix, err := splitGCSPath(gcsPath)
+	if err != nil {
+		return "", err
+	}
+	suffix := fmt.Sprintf("-%s/logs/%s", id, SerialLogArchiveName)
+	it := client.Bucket(bkt).Objects(ctx, &storage.Query{Prefix: path.Join(prefix, "daisy-")})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return "", fmt.Errorf("no serial log archive found for run %q in %q", id, gcsPath)
+		}
+		if err != nil {
+			return "", err
+		}
+		if strings.HasSuffix(attrs.Name, suffix) {
+			return fmt.Sprintf("gs://%s/%s", bkt, attrs.Name), nil
+		}
+	}
+}
@@ -0,0 +1,136 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSerialLogArchive(t *testing.T) {
+	w := testWorkflow()
+	w.EnableSerialLogArchive()
+	child := testWorkflow()
+	child.Name = "child"
+	child.parent = w
+	create := &Step{name: "create", w: child}
+	wait := &Step{name: "wait", w: w}
+
+	a := child.serialLogArchive()
+	if a == nil || a != w.serialLogs {
+		t.Fatal("included workflows should use the archive of the root workflow")
+	}
+	a.recordOutput(create, "inst-b", 2, "port 2\n")
+	a.recordOutput(create, "inst-b", 1, "booting\n")
+	a.recordOutput(create, "inst-b", 1, "done\n")
+	a.recordOutput(create, "inst-a", 1, "")
+	wait.w.emitEvent(&Event{Type: EventSerialMatch, Step: "wait", Instance: "inst-b", MatchKind: "SuccessMatch", Match: "done"})
+	wait.w.emitEvent(&Event{Type: EventStepFinished, Step: "wait"})
+
+	var buf bytes.Buffer
+	if err := a.write(&buf, w.Name, w.id); err != nil {
+		t.Fatalf("error writing archive: %v", err)
+	}
+	idx, logs, err := ReadSerialLogArchive(&buf)
+	if err != nil {
+		t.Fatalf("error reading archive: %v", err)
+	}
+
+	if idx.Workflow != testWf || idx.ID != w.id {
+		t.Errorf("unexpected run in index: %q %q", idx.Workflow, idx.ID)
+	}
+	wantLogs := map[string][]byte{
+		"inst-b/serial-port1.log": []byte("booting\ndone\n"),
+		"inst-b/serial-port2.log": []byte("port 2\n"),
+	}
+	if !reflect.DeepEqual(logs, wantLogs) {
+		t.Errorf("unexpected logs, got: %q, want: %q", logs, wantLogs)
+	}
+	if len(idx.Instances) != 1 {
+		t.Fatalf("unexpected instances in index: %+v", idx.Instances)
+	}
+	inst := idx.Instances[0]
+	if inst.Name != "inst-b" || inst.Step != testWf+".child.create" {
+		t.Errorf("unexpected instance in index: %+v", inst)
+	}
+	if len(inst.Ports) != 2 || inst.Ports[0].Port != 1 || inst.Ports[0].Bytes != 13 || inst.Ports[0].Start.IsZero() {
+		t.Errorf("unexpected ports in index: %+v", inst.Ports)
+	}
+	if len(inst.Signals) != 1 || inst.Signals[0].Step != testWf+".wait" || inst.Signals[0].Kind != "SuccessMatch" {
+		t.Errorf("unexpected signals in index: %+v", inst.Signals)
+	}
+}
+
+func TestSerialLogArchiveCapsPorts(t *testing.T) {
+	w := testWorkflow()
+	w.EnableSerialLogArchive()
+	s := &Step{name: "create", w: w}
+	a := w.serialLogArchive()
+	chunk := strings.Repeat("a", serialLogArchivePortBytes/2)
+	a.recordOutput(s, "inst", 1, chunk)
+	a.recordOutput(s, "inst", 1, chunk)
+	a.recordOutput(s, "inst", 1, "end\n")
+
+	var buf bytes.Buffer
+	if err := a.write(&buf, w.Name, w.id); err != nil {
+		t.Fatalf("error writing archive: %v", err)
+	}
+	idx, logs, err := ReadSerialLogArchive(&buf)
+	if err != nil {
+		t.Fatalf("error reading archive: %v", err)
+	}
+	p := idx.Instances[0].Ports[0]
+	if p.Bytes != serialLogArchivePortBytes || p.Dropped != 4 {
+		t.Errorf("unexpected port in index: %+v", p)
+	}
+	if l := logs[p.File]; len(l) != serialLogArchivePortBytes || !bytes.HasSuffix(l, []byte("aend\n")) {
+		t.Errorf("log should keep the last output, got %d bytes ending in %q", len(l), l[len(l)-5:])
+	}
+}
+
+func TestSerialLogIndexFilter(t *testing.T) {
+	idx := &SerialLogIndex{Instances: []SerialLogInstance{
+		{Name: "a", Step: "wf.create-a", Signals: []SerialLogSignal{{Step: "wf.wait", Kind: "SuccessMatch"}}},
+		{Name: "b", Step: "wf.inc.create-b", Signals: []SerialLogSignal{
+			{Step: "wf.wait", Kind: "StatusMatch"}, {Step: "wf.inc.wait", Kind: "SuccessMatch"}}},
+	}}
+
+	tests := []struct {
+		step      string
+		wantNames []string
+		// Number of signals of each instance.
+		wantSignals []int
+	}{
+		{"", []string{"a", "b"}, []int{1, 2}},
+		{"create-a", []string{"a"}, []int{1}},
+		{"wf.inc.create-b", []string{"b"}, []int{2}},
+		{"wf.wait", []string{"a", "b"}, []int{1, 1}},
+		{"inc.wait", []string{"b"}, []int{1}},
+		{"other", nil, nil},
+	}
+	for _, tt := range tests {
+		var names []string
+		var signals []int
+		for _, i := range idx.Filter(tt.step) {
+			names = append(names, i.Name)
+			signals = append(signals, len(i.Signals))
+		}
+		if !reflect.DeepEqual(names, tt.wantNames) || !reflect.DeepEqual(signals, tt.wantSignals) {
+			t.Errorf("%q: got: %v %v, want: %v %v", tt.step, names, signals, tt.wantNames, tt.wantSignals)
+		}
+	}
+}
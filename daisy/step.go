@@ -68,6 +68,13 @@ type Step struct {
 	WaitForInstancesSignal    *WaitForInstancesSignal    `json:",omitempty"`
 	WaitForAnyInstancesSignal *WaitForAnyInstancesSignal `json:",omitempty"`
 	UpdateInstancesMetadata   *UpdateInstancesMetadata   `json:",omitempty"`
+	If                        *If                        `json:",omitempty"`
+	ForEach                   *ForEach                   `json:",omitempty"`
+	Retry                     *Retry                     `json:",omitempty"`
+	// Custom is the implementation of a step type registered with
+	// RegisterStepType, unmarshalled from the JSON key naming the type.
+	Custom     StepImpl `json:"-"`
+	customType string
 	// Used for unit tests.
 	testType stepImpl
 }
@@ -181,6 +188,22 @@ func (s *Step) stepImpl() (stepImpl, DError) {
 		matchCount++
 		result = s.UpdateInstancesMetadata
 	}
+	if s.If != nil {
+		matchCount++
+		result = s.If
+	}
+	if s.ForEach != nil {
+		matchCount++
+		result = s.ForEach
+	}
+	if s.Retry != nil {
+		matchCount++
+		result = s.Retry
+	}
+	if s.Custom != nil {
+		matchCount++
+		result = &registeredStep{name: s.customType, impl: s.Custom}
+	}
 	if s.testType != nil {
 		matchCount++
 		result = s.testType
@@ -259,10 +282,7 @@ func (s *Step) getChain() []*Step {
 		return []*Step{s}
 	}
 	for _, st := range s.w.parent.Steps {
-		if st.IncludeWorkflow != nil && st.IncludeWorkflow.Workflow == s.w {
-			return append(st.getChain(), s)
-		}
-		if st.SubWorkflow != nil && st.SubWorkflow.Workflow == s.w {
+		if st.runsWorkflow(s.w) {
 			return append(st.getChain(), s)
 		}
 	}
@@ -270,6 +290,61 @@ func (s *Step) getChain() []*Step {
 	return nil
 }
 
+// runsWorkflow returns true if w is the workflow of an IncludeWorkflow or
+// SubWorkflow step, either s itself or a step nested in s.
+func (s *Step) runsWorkflow(w *Workflow) bool {
+	if s.IncludeWorkflow != nil && s.IncludeWorkflow.Workflow == w {
+		return true
+	}
+	if s.SubWorkflow != nil && s.SubWorkflow.Workflow == w {
+		return true
+	}
+	for _, n := range s.nestedSteps() {
+		if n.runsWorkflow(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// nestingStep is implemented by control flow steps, which run other steps.
+type nestingStep interface {
+	nestedSteps() []*Step
+}
+
+// nestedSteps returns the steps nested in a control flow step.
+func (s *Step) nestedSteps() []*Step {
+	impl, err := s.stepImpl()
+	if err != nil {
+		return nil
+	}
+	if n, ok := impl.(nestingStep); ok {
+		return n.nestedSteps()
+	}
+	return nil
+}
+
+// nestedImpl returns the implementation of a step nested in s. Nested steps
+// act on behalf of s: they share its name, workflow and timeout, and any
+// resources they create are created by s.
+func (s *Step) nestedImpl(nested *Step) (stepImpl, DError) {
+	if nested == nil {
+		return nil, Errf("no nested step defined")
+	}
+	nested.name = s.name
+	nested.w = s.w
+	nested.timeout = s.timeout
+	return nested.stepImpl()
+}
+
+// runNested runs the implementation of a step nested in s.
+func (s *Step) runNested(ctx context.Context, impl stepImpl) DError {
+	if p := s.w.planRecorder(); p != nil && p.simulate(s, impl) {
+		return nil
+	}
+	return impl.run(ctx, s)
+}
+
 func (s *Step) populate(ctx context.Context) DError {
 	s.w.LogWorkflowInfo("Populating step %q", s.name)
 	impl, err := s.stepImpl()
@@ -287,6 +362,18 @@ func (s *Step) recordStepTime(startTime time.Time) {
 	s.w.recordStepTime(s.name, startTime, endTime)
 }
 
+// stepImplName returns the name of the step type implemented by impl.
+func stepImplName(impl stepImpl) string {
+	if rs, ok := impl.(*registeredStep); ok {
+		return rs.name
+	}
+	t := reflect.TypeOf(impl)
+	if t.Kind() == reflect.Ptr {
+		return t.Elem().Name()
+	}
+	return t.Name()
+}
+
 func (s *Step) run(ctx context.Context) DError {
 	startTime := time.Now()
 	defer s.recordStepTime(startTime)
@@ -294,23 +381,34 @@ func (s *Step) run(ctx context.Context) DError {
 	if err != nil {
 		return s.wrapRunError(err)
 	}
-	var st string
-	if t := reflect.TypeOf(impl); t.Kind() == reflect.Ptr {
-		st = t.Elem().Name()
-	} else {
-		st = t.Name()
-	}
+	st := stepImplName(impl)
 	s.w.LogWorkflowInfo("Running step %q (%s)", s.name, st)
-	if err = impl.run(ctx, s); err != nil {
-		return s.wrapRunError(err)
+	s.emitStepEvent(EventStepStarted, st, startTime, nil)
+	if p := s.w.planRecorder(); p != nil {
+		p.setStep(stepKey(s))
+		if p.simulate(s, impl) {
+			s.emitStepEvent(EventStepFinished, st, startTime, nil)
+			return nil
+		}
+	}
+	if err = s.substituteOutputs(impl); err == nil {
+		err = impl.run(ctx, s)
+	}
+	if err != nil {
+		err = s.wrapRunError(err)
+		s.emitStepEvent(EventStepFailed, st, startTime, err)
+		return err
 	}
 	select {
 	case <-s.w.Cancel:
 		// return an error to indicate a canceled workflow is not 'success'
-		return s.w.onStepCancel(s, st)
+		err = s.w.onStepCancel(s, st)
+		s.emitStepEvent(EventStepFailed, st, startTime, err)
+		return err
 	default:
 		s.w.LogWorkflowInfo("Step %q (%s) successfully finished.", s.name, st)
 	}
+	s.emitStepEvent(EventStepFinished, st, startTime, nil)
 	return nil
 }
 
@@ -326,6 +424,9 @@ func (s *Step) validate(ctx context.Context) DError {
 	if err = impl.validate(ctx, s); err != nil {
 		return s.wrapValidateError(err)
 	}
+	if err = s.validateOutputRefs(impl); err != nil {
+		return s.wrapValidateError(err)
+	}
 	return nil
 }
 
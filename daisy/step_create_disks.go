@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -87,7 +88,9 @@ func (c *CreateDisks) run(ctx context.Context, s *Step) DError {
 					return
 				}
 			}
-			cd.createdInWorkflow = true
+			cd.markCreated()
+			s.SetOutput(cd.daisyName+".selfLink", cd.SelfLink)
+			s.SetOutput(cd.daisyName+".sizeGb", strconv.FormatInt(cd.Disk.SizeGb, 10))
 		}(d)
 	}
 
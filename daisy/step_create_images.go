@@ -139,6 +139,7 @@ func (ci *CreateImages) run(ctx context.Context, s *Step) DError {
 			return
 		}
 		ci.markCreatedInWorkflow()
+		ci.publishOutputs(s)
 	}
 
 	if imageUsesAlphaFeatures(ci.ImagesAlpha) {
@@ -51,13 +51,20 @@ func (ci *CreateInstances) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// logSerialOutput streams a serial port of an instance to GCS and, if it's
+// enabled, to the serial log archive. The archive streams all the ports, and
+// those that aren't in SerialPortsToLog are only streamed to the archive.
 func logSerialOutput(ctx context.Context, s *Step, ii InstanceInterface, ib *InstanceBase, port int64, interval time.Duration) {
 	w := s.w
 	w.stepWait.Add(1)
 	defer w.stepWait.Done()
 
+	archive := w.serialLogArchive()
+	logged := archive == nil || int64In(port, ib.SerialPortsToLog)
 	logsObj := path.Join(w.logsPath, fmt.Sprintf("%s-serial-port%d.log", ii.getName(), port))
-	w.LogStepInfo(s.name, "CreateInstances", "Streaming instance %q serial port %d output to https://storage.cloud.google.com/%s/%s", ii.getName(), port, w.bucket, logsObj)
+	if logged {
+		w.LogStepInfo(s.name, "CreateInstances", "Streaming instance %q serial port %d output to https://storage.cloud.google.com/%s/%s", ii.getName(), port, w.bucket, logsObj)
+	}
 	var start int64
 	var buf bytes.Buffer
 	var gcsErr bool
@@ -95,6 +102,15 @@ Loop:
 			readFromSerial = true
 			numErr = 0
 			start = resp.Next
+			if archive != nil {
+				archive.recordOutput(s, ii.getName(), port, resp.Contents)
+			}
+			if !logged {
+				if w.isCanceled {
+					break Loop
+				}
+				continue
+			}
 			buf.WriteString(resp.Contents)
 			wc := w.StorageClient.Bucket(w.bucket).Object(logsObj).NewWriter(ctx)
 			wc.ContentType = "text/plain"
@@ -117,7 +133,9 @@ Loop:
 		}
 	}
 
-	w.Logger.WriteSerialPortLogs(w, ii.getName(), buf)
+	if logged {
+		w.Logger.WriteSerialPortLogs(w, ii.getName(), buf)
+	}
 }
 
 // populate preprocesses fields: Name, Project, Zone, Description, MachineType, NetworkInterfaces, Scopes, ServiceAccounts, and daisyName.
@@ -196,8 +214,17 @@ func (ci *CreateInstances) run(ctx context.Context, s *Step) DError {
 			}
 		}
 
-		ib.createdInWorkflow = true
-		for _, port := range ib.SerialPortsToLog {
+		ib.markCreated()
+		ii.publishOutputs(s)
+		ports := ib.SerialPortsToLog
+		if w.serialLogArchive() != nil {
+			// Archive all the ports, even those that aren't logged.
+			ports = nil
+			for port := int64(1); port <= serialLogArchivePorts; port++ {
+				ports = append(ports, port)
+			}
+		}
+		for _, port := range ports {
 			go logSerialOutput(ctx, s, ii, ib, port, 3*time.Second)
 		}
 	}
@@ -63,7 +63,7 @@ func (c *CreateSnapshots) run(ctx context.Context, s *Step) DError {
 			e <- newErr("failed to create snapshots", err)
 			return
 		}
-		ss.createdInWorkflow = true
+		ss.markCreated()
 	}
 
 	for _, ss := range *c {
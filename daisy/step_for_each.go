@@ -0,0 +1,134 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const forEachItemVar = "${ITEM}"
+
+// ForEach is a Daisy ForEach workflow step. It expands Step once per item of
+// a list Var and runs the expanded steps concurrently.
+type ForEach struct {
+	// Var is the name of a workflow Var holding a comma separated list of
+	// items.
+	Var string
+	// Step is the template of the expanded steps. ${ITEM} is replaced by the
+	// item in each of them, so it should be part of the names of the
+	// resources they create. The template is kept verbatim until it is
+	// expanded, after the workflow Vars are known.
+	Step json.RawMessage
+
+	steps []*Step
+}
+
+func (f *ForEach) nestedSteps() []*Step {
+	return f.steps
+}
+
+func (f *ForEach) populate(ctx context.Context, s *Step) DError {
+	v, ok := s.w.Vars[f.Var]
+	if !ok {
+		return Errf("unknown workflow Var %q", f.Var)
+	}
+	if len(f.Step) == 0 {
+		return Errf("no step to expand")
+	}
+
+	values := s.w.varValues()
+
+	f.steps = nil
+	for _, item := range strings.Split(v.Value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		// The item is substituted in the JSON template, so escape it.
+		quoted, _ := json.Marshal(item)
+		data := strings.Replace(string(f.Step), forEachItemVar, string(quoted[1:len(quoted)-1]), -1)
+		st := &Step{}
+		if err := json.Unmarshal([]byte(data), st); err != nil {
+			return newErr(fmt.Sprintf("failed to parse step for item %q", item), err)
+		}
+		if err := substituteVars(reflect.ValueOf(st).Elem(), values); err != nil {
+			return err
+		}
+		if err := validateVarsSubbed(reflect.ValueOf(st).Elem()); err != nil {
+			return err
+		}
+		if err := s.w.substituteSourceVars(ctx, reflect.ValueOf(st).Elem()); err != nil {
+			return err
+		}
+		impl, err := s.nestedImpl(st)
+		if err != nil {
+			return err
+		}
+		if err := impl.populate(ctx, s); err != nil {
+			return wrapErrf(err, "item %q", item)
+		}
+		f.steps = append(f.steps, st)
+	}
+	return nil
+}
+
+func (f *ForEach) validate(ctx context.Context, s *Step) DError {
+	var errs DError
+	for _, st := range f.steps {
+		impl, err := s.nestedImpl(st)
+		if err != nil {
+			errs = addErrs(errs, err)
+			continue
+		}
+		errs = addErrs(errs, impl.validate(ctx, s))
+	}
+	return errs
+}
+
+func (f *ForEach) run(ctx context.Context, s *Step) DError {
+	var wg sync.WaitGroup
+	w := s.w
+	e := make(chan DError)
+	for _, st := range f.steps {
+		impl, err := s.nestedImpl(st)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func(impl stepImpl) {
+			defer wg.Done()
+			if err := s.runNested(ctx, impl); err != nil {
+				e <- err
+			}
+		}(impl)
+	}
+
+	go func() {
+		wg.Wait()
+		e <- nil
+	}()
+
+	select {
+	case err := <-e:
+		return err
+	case <-w.Cancel:
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestForEachPopulate(t *testing.T) {
+	w := testWorkflow()
+	w.Vars = map[string]Var{"disks": {Value: "a, b,"}, "size": {Value: "20"}}
+	w.autovars = map[string]string{"ID": w.id}
+	s, _ := w.NewStep("s")
+	f := &ForEach{Var: "disks", Step: json.RawMessage(`{"ResizeDisks": [{"Name": "disk-${ITEM}-${ID}", "SizeGb": "${size}"}]}`)}
+	if err := f.populate(context.Background(), s); err != nil {
+		t.Fatalf("unexpected populate error: %v", err)
+	}
+
+	var got []ResizeDisk
+	for _, st := range f.nestedSteps() {
+		for _, rd := range *st.ResizeDisks {
+			got = append(got, *rd)
+		}
+	}
+	want := []ResizeDisk{{Name: "disk-a-abcdef", SizeGb: "20"}, {Name: "disk-b-abcdef", SizeGb: "20"}}
+	want[0].DisksResizeRequest.SizeGb = 20
+	want[1].DisksResizeRequest.SizeGb = 20
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("ForEach not expanded as expected: (-got,+want)\n%s", diffRes)
+	}
+}
+
+func TestForEachPopulateErrors(t *testing.T) {
+	w := testWorkflow()
+	w.Vars = map[string]Var{"items": {Value: "a"}}
+	s, _ := w.NewStep("s")
+	tests := []struct {
+		desc string
+		f    *ForEach
+	}{
+		{"unknown var", &ForEach{Var: "dne", Step: json.RawMessage(`{"ResizeDisks": []}`)}},
+		{"no step", &ForEach{Var: "items"}},
+		{"bad step", &ForEach{Var: "items", Step: json.RawMessage(`{"ResizeDisks": `)}},
+		{"unresolved var", &ForEach{Var: "items", Step: json.RawMessage(`{"ResizeDisks": [{"Name": "${dne}"}]}`)}},
+	}
+	for _, tt := range tests {
+		if err := tt.f.populate(context.Background(), s); err == nil {
+			t.Errorf("%s: expected error", tt.desc)
+		}
+	}
+}
+
+func TestForEachRun(t *testing.T) {
+	w := testWorkflow()
+	s, _ := w.NewStep("s")
+	f := &ForEach{steps: []*Step{
+		{testType: &mockStep{}},
+		{testType: &mockStep{runImpl: func(ctx context.Context, s *Step) DError { return Errf("fail") }}},
+	}}
+	if err := f.run(context.Background(), s); err == nil {
+		t.Error("expected error from failing expanded step")
+	}
+	f.steps = f.steps[:1]
+	if err := f.run(context.Background(), s); err != nil {
+		t.Errorf("unexpected run error: %v", err)
+	}
+}
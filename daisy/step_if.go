@@ -0,0 +1,131 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+)
+
+// If is a Daisy If workflow step. It runs Then if its condition holds and
+// Else otherwise. The condition is on either a workflow Var, which is
+// evaluated when the workflow is populated, or on a serial-output value
+// captured by a previous WaitForInstancesSignal step, which is evaluated when
+// the step runs. Both branches of serial-output conditions are validated, so
+// they must not create resources with the same name.
+type If struct {
+	// Var is the name of the workflow Var to evaluate.
+	Var string `json:",omitempty"`
+	// SerialOutputKey is the key of the serial-output value to evaluate, as
+	// written by an instance with "<serial-output key:'k' value:'v'>".
+	SerialOutputKey string `json:",omitempty"`
+	// Equals is the value the condition holds for. If unset, the condition
+	// holds for any non-empty value.
+	Equals string `json:",omitempty"`
+	Then   *Step  `json:",omitempty"`
+	Else   *Step  `json:",omitempty"`
+
+	// Set when the condition is on a Var.
+	decided bool
+	result  bool
+}
+
+// nestedSteps returns the branches that can run.
+func (i *If) nestedSteps() []*Step {
+	var steps []*Step
+	if i.Then != nil && (!i.decided || i.result) {
+		steps = append(steps, i.Then)
+	}
+	if i.Else != nil && (!i.decided || !i.result) {
+		steps = append(steps, i.Else)
+	}
+	return steps
+}
+
+func (i *If) holds(value string) bool {
+	if i.Equals == "" {
+		return value != ""
+	}
+	return value == i.Equals
+}
+
+func (i *If) populate(ctx context.Context, s *Step) DError {
+	if (i.Var == "") == (i.SerialOutputKey == "") {
+		return Errf("exactly one of Var and SerialOutputKey must be set")
+	}
+	if i.Then == nil && i.Else == nil {
+		return Errf("at least one of Then and Else must be set")
+	}
+	if i.Var != "" {
+		v, ok := s.w.Vars[i.Var]
+		if !ok {
+			return Errf("unknown workflow Var %q", i.Var)
+		}
+		i.decided = true
+		i.result = i.holds(v.Value)
+	}
+
+	var errs DError
+	for _, st := range i.nestedSteps() {
+		impl, err := s.nestedImpl(st)
+		if err != nil {
+			errs = addErrs(errs, err)
+			continue
+		}
+		errs = addErrs(errs, impl.populate(ctx, s))
+	}
+	return errs
+}
+
+func (i *If) validate(ctx context.Context, s *Step) DError {
+	var errs DError
+	for _, st := range i.nestedSteps() {
+		impl, err := s.nestedImpl(st)
+		if err != nil {
+			errs = addErrs(errs, err)
+			continue
+		}
+		errs = addErrs(errs, impl.validate(ctx, s))
+	}
+	return errs
+}
+
+func (i *If) run(ctx context.Context, s *Step) DError {
+	result := i.result
+	if !i.decided {
+		w := s.w
+		for w.parent != nil {
+			w = w.parent
+		}
+		w.serialControlOutputValuesMx.Lock()
+		v := w.serialControlOutputValues[i.SerialOutputKey]
+		w.serialControlOutputValuesMx.Unlock()
+		result = i.holds(v)
+	}
+
+	st, branch := i.Then, "Then"
+	if !result {
+		st, branch = i.Else, "Else"
+	}
+	if st == nil {
+		s.w.LogStepInfo(s.name, "If", "Condition is %t, nothing to run.", result)
+		return nil
+	}
+	s.w.LogStepInfo(s.name, "If", "Condition is %t, running %s.", result, branch)
+	impl, err := s.nestedImpl(st)
+	if err != nil {
+		return err
+	}
+	return s.runNested(ctx, impl)
+}
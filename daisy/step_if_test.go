@@ -0,0 +1,104 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"testing"
+)
+
+func ifTestBranch(ran map[string]bool, name string) *Step {
+	return &Step{testType: &mockStep{
+		runImpl: func(ctx context.Context, s *Step) DError {
+			ran[name] = true
+			return nil
+		},
+	}}
+}
+
+func TestIfVar(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc, value, equals, want string
+	}{
+		{"equal", "debian", "debian", "then"},
+		{"not equal", "centos", "debian", "else"},
+		{"non-empty", "x", "", "then"},
+		{"empty", "", "", "else"},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.Vars = map[string]Var{"distro": {Value: tt.value}}
+		s, _ := w.NewStep("s")
+		ran := map[string]bool{}
+		i := &If{Var: "distro", Equals: tt.equals, Then: ifTestBranch(ran, "then"), Else: ifTestBranch(ran, "else")}
+		if err := i.populate(ctx, s); err != nil {
+			t.Errorf("%s: unexpected populate error: %v", tt.desc, err)
+			continue
+		}
+		if got := i.nestedSteps(); len(got) != 1 {
+			t.Errorf("%s: only the chosen branch should be nested, got %d steps", tt.desc, len(got))
+		}
+		if err := i.run(ctx, s); err != nil {
+			t.Errorf("%s: unexpected run error: %v", tt.desc, err)
+		}
+		if len(ran) != 1 || !ran[tt.want] {
+			t.Errorf("%s: want %s to run, ran %v", tt.desc, tt.want, ran)
+		}
+	}
+}
+
+func TestIfSerialOutputValue(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s, _ := w.NewStep("s")
+	ran := map[string]bool{}
+	i := &If{SerialOutputKey: "status", Equals: "ok", Then: ifTestBranch(ran, "then")}
+	if err := i.populate(ctx, s); err != nil {
+		t.Fatalf("unexpected populate error: %v", err)
+	}
+	if got := i.nestedSteps(); len(got) != 1 {
+		t.Errorf("Then should be nested, got %d steps", len(got))
+	}
+	if err := i.run(ctx, s); err != nil || ran["then"] {
+		t.Errorf("Then should not run before the value is set, ran %v, err %v", ran, err)
+	}
+
+	w.AddSerialConsoleOutputValue("status", "ok")
+	if err := i.run(ctx, s); err != nil || !ran["then"] {
+		t.Errorf("Then should run once the value is set, ran %v, err %v", ran, err)
+	}
+}
+
+func TestIfPopulateErrors(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s, _ := w.NewStep("s")
+	tests := []struct {
+		desc string
+		i    *If
+	}{
+		{"no condition", &If{Then: &Step{testType: &mockStep{}}}},
+		{"two conditions", &If{Var: "v", SerialOutputKey: "k", Then: &Step{testType: &mockStep{}}}},
+		{"no branch", &If{SerialOutputKey: "k"}},
+		{"unknown var", &If{Var: "dne", Then: &Step{testType: &mockStep{}}}},
+		{"bad branch", &If{SerialOutputKey: "k", Then: &Step{}}},
+	}
+	for _, tt := range tests {
+		if err := tt.i.populate(ctx, s); err == nil {
+			t.Errorf("%s: expected error", tt.desc)
+		}
+	}
+}
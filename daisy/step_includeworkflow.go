@@ -19,7 +19,6 @@ import (
 	"fmt"
 	"path/filepath"
 	"reflect"
-	"strings"
 )
 
 // IncludeWorkflow defines a Daisy workflow injection step. This step will
@@ -81,7 +80,11 @@ Loop:
 		return errs
 	}
 
-	var replacements []string
+	if err := i.Workflow.validateVars(); err != nil {
+		return err
+	}
+
+	autovars := map[string]string{}
 	for k, v := range i.Workflow.autovars {
 		if k == "NAME" {
 			v = s.name
@@ -89,13 +92,21 @@ Loop:
 		if k == "WFDIR" {
 			v = i.Workflow.workflowDir
 		}
-		replacements = append(replacements, fmt.Sprintf("${%s}", k), v)
+		autovars[k] = v
+	}
+	if err := substituteVars(reflect.ValueOf(i.Workflow).Elem(), autovars); err != nil {
+		return err
 	}
-	substitute(reflect.ValueOf(i.Workflow).Elem(), strings.NewReplacer(replacements...))
+	values := map[string]string{}
 	for k, v := range i.Workflow.Vars {
-		replacements = append(replacements, fmt.Sprintf("${%s}", k), v.Value)
+		values[k] = v.Value
+	}
+	for k, v := range autovars {
+		values[k] = v
+	}
+	if err := substituteVars(reflect.ValueOf(i.Workflow).Elem(), values); err != nil {
+		return err
 	}
-	substitute(reflect.ValueOf(i.Workflow).Elem(), strings.NewReplacer(replacements...))
 
 	// We do this here, and not in validate, as embedded startup scripts could
 	// have what we think are daisy variables.
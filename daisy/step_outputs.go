@@ -0,0 +1,134 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"reflect"
+	"regexp"
+)
+
+// stepOutputRgx matches references to step outputs, such as
+// `${steps.create-image.outputs.my-image.selfLink}`.
+var stepOutputRgx = regexp.MustCompile(`\$\{steps\.([^.{}]+)\.outputs\.([^{}]+)}`)
+
+// SetOutput publishes a named output of the step. Steps that depend on s can
+// reference it as ${steps.<step name>.outputs.<key>}.
+func (s *Step) SetOutput(key, value string) {
+	w := s.w
+	w.stepOutputsMx.Lock()
+	defer w.stepOutputsMx.Unlock()
+	if w.stepOutputs == nil {
+		w.stepOutputs = map[string]map[string]string{}
+	}
+	if w.stepOutputs[s.name] == nil {
+		w.stepOutputs[s.name] = map[string]string{}
+	}
+	w.stepOutputs[s.name][key] = value
+}
+
+// GetStepOutput gets an output published by a step of the workflow.
+func (w *Workflow) GetStepOutput(step, key string) (string, bool) {
+	w.stepOutputsMx.Lock()
+	defer w.stepOutputsMx.Unlock()
+	v, ok := w.stepOutputs[step][key]
+	return v, ok
+}
+
+// getStepOutputs returns a copy of the outputs published by a step.
+func (w *Workflow) getStepOutputs(step string) map[string]string {
+	w.stepOutputsMx.Lock()
+	defer w.stepOutputsMx.Unlock()
+	if len(w.stepOutputs[step]) == 0 {
+		return nil
+	}
+	outputs := map[string]string{}
+	for k, v := range w.stepOutputs[step] {
+		outputs[k] = v
+	}
+	return outputs
+}
+
+// outputData returns the fields of impl that may reference step outputs.
+// Workflows run by a step reference the outputs of their own steps, so they
+// are left to their own steps.
+func outputData(impl interface{}) (reflect.Value, bool) {
+	switch impl.(type) {
+	case *IncludeWorkflow, *SubWorkflow:
+		return reflect.Value{}, false
+	}
+	if rs, ok := impl.(*registeredStep); ok {
+		return outputData(rs.impl)
+	}
+	v := reflect.ValueOf(impl)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return reflect.Value{}, false
+	}
+	return v.Elem(), true
+}
+
+// validateOutputRefs checks that the step outputs referenced by s are
+// published by steps that s depends on, so they are set when s starts.
+func (s *Step) validateOutputRefs(impl stepImpl) DError {
+	v, ok := outputData(impl)
+	if !ok {
+		return nil
+	}
+	var errs DError
+	traverseData(v, func(val reflect.Value) DError {
+		switch val.Interface().(type) {
+		case string:
+			for _, m := range stepOutputRgx.FindAllStringSubmatch(val.String(), -1) {
+				dep, ok := s.w.Steps[m[1]]
+				if !ok {
+					errs = addErrs(errs, Errf("%q references the outputs of non existent step %q", m[0], m[1]))
+				} else if !s.depends(dep) {
+					errs = addErrs(errs, Errf("%q references the outputs of step %q, which step %q doesn't depend on", m[0], m[1], s.name))
+				}
+			}
+		}
+		return nil
+	})
+	return errs
+}
+
+// substituteOutputs replaces the step output references of impl with the
+// outputs published so far. Outputs are substituted when the step starts,
+// since they are only known once the steps it depends on have run.
+func (s *Step) substituteOutputs(impl stepImpl) DError {
+	v, ok := outputData(impl)
+	if !ok {
+		return nil
+	}
+	return traverseData(v, func(val reflect.Value) DError {
+		switch val.Interface().(type) {
+		case string:
+			var errs DError
+			res := stepOutputRgx.ReplaceAllStringFunc(val.String(), func(ref string) string {
+				m := stepOutputRgx.FindStringSubmatch(ref)
+				out, ok := s.w.GetStepOutput(m[1], m[2])
+				if !ok {
+					errs = addErrs(errs, Errf("step %q has no output %q", m[1], m[2]))
+					return ref
+				}
+				return out
+			})
+			if errs != nil {
+				return errs
+			}
+			val.SetString(res)
+		}
+		return nil
+	})
+}
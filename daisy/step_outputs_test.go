@@ -0,0 +1,146 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// outputRefStep records the value of its field when it runs.
+type outputRefStep struct {
+	Value string
+	got   *string
+}
+
+func (o *outputRefStep) populate(ctx context.Context, s *Step) DError { return nil }
+func (o *outputRefStep) validate(ctx context.Context, s *Step) DError { return nil }
+func (o *outputRefStep) run(ctx context.Context, s *Step) DError {
+	*o.got = o.Value
+	return nil
+}
+
+func outputsTestWorkflow(ref string, got *string) *Workflow {
+	w := testWorkflow()
+	w.Steps["producer"] = &Step{name: "producer", w: w, timeout: time.Minute, testType: &mockStep{
+		runImpl: func(ctx context.Context, s *Step) DError {
+			s.SetOutput("my-image.selfLink", "projects/p/global/images/i")
+			return nil
+		},
+	}}
+	w.Steps["consumer"] = &Step{name: "consumer", w: w, timeout: time.Minute, testType: &outputRefStep{Value: ref, got: got}}
+	w.Dependencies["consumer"] = []string{"producer"}
+	return w
+}
+
+func TestStepOutputs(t *testing.T) {
+	var got string
+	w := outputsTestWorkflow("image: ${steps.producer.outputs.my-image.selfLink}", &got)
+	if err := w.run(context.Background()); err != nil {
+		t.Fatalf("error running workflow: %v", err)
+	}
+	if want := "image: projects/p/global/images/i"; got != want {
+		t.Errorf("output not substituted, got %q, want %q", got, want)
+	}
+	if v, ok := w.GetStepOutput("producer", "my-image.selfLink"); !ok || v != "projects/p/global/images/i" {
+		t.Errorf("unexpected output, got %q, %v", v, ok)
+	}
+}
+
+func TestStepOutputsMissing(t *testing.T) {
+	var got string
+	w := outputsTestWorkflow("${steps.producer.outputs.other}", &got)
+	err := w.run(context.Background())
+	if err == nil {
+		t.Fatal("expected error for missing output")
+	}
+	if want := `step "consumer" run error: step "producer" has no output "other"`; err.Error() != want {
+		t.Errorf("unexpected error, got %q, want %q", err, want)
+	}
+}
+
+func TestValidateOutputRefs(t *testing.T) {
+	tests := []struct {
+		desc, ref string
+		deps      []string
+		wantErr   string
+	}{
+		{"dependency", "${steps.producer.outputs.k}", []string{"producer"}, ""},
+		{"no refs", "value", nil, ""},
+		{"missing step", "${steps.foo.outputs.k}", []string{"producer"}, `"${steps.foo.outputs.k}" references the outputs of non existent step "foo"`},
+		{"no dependency", "${steps.producer.outputs.k}", nil, `"${steps.producer.outputs.k}" references the outputs of step "producer", which step "consumer" doesn't depend on`},
+	}
+
+	for _, tt := range tests {
+		var got string
+		w := outputsTestWorkflow(tt.ref, &got)
+		w.Dependencies["consumer"] = tt.deps
+		s := w.Steps["consumer"]
+		err := s.validateOutputRefs(s.testType)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+		} else if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tt.desc, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateVarsSubbedStepOutputs(t *testing.T) {
+	var got string
+	w := outputsTestWorkflow("${steps.producer.outputs.k}", &got)
+	if err := w.validateVarsSubbed(); err != nil {
+		t.Errorf("step output references should be substituted later: %v", err)
+	}
+}
+
+func TestStepOutputsRestoredOnResume(t *testing.T) {
+	ctx := context.Background()
+	td, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "journal.json")
+
+	var got string
+	w := outputsTestWorkflow("${steps.producer.outputs.my-image.selfLink}", &got)
+	w.Steps["consumer"].testType = &mockStep{runImpl: func(ctx context.Context, s *Step) DError {
+		return Errf("fail")
+	}}
+	w.EnableJournal(path)
+	if err := w.run(ctx); err == nil {
+		t.Fatal("expected run error")
+	}
+
+	// The producer is skipped on resume, its outputs come from the journal.
+	rw := outputsTestWorkflow("${steps.producer.outputs.my-image.selfLink}", &got)
+	rw.Steps["producer"].testType = &mockStep{runImpl: func(ctx context.Context, s *Step) DError {
+		t.Error("completed step should not run again")
+		return nil
+	}}
+	if err := rw.ResumeFromJournal(ctx, path); err != nil {
+		t.Fatalf("error resuming from journal: %v", err)
+	}
+	if err := rw.run(ctx); err != nil {
+		t.Fatalf("error running resumed workflow: %v", err)
+	}
+	if want := "projects/p/global/images/i"; got != want {
+		t.Errorf("output not restored, got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// StepImpl is the implementation of a step type registered with
+// RegisterStepType. Its exported fields are unmarshalled from the step's JSON
+// and have vars substituted like those of the built-in step types.
+type StepImpl interface {
+	// Populate sets defaults and completes the fields of the step.
+	Populate(ctx context.Context, s *Step) DError
+	// Validate checks the step before the workflow runs.
+	Validate(ctx context.Context, s *Step) DError
+	// Run runs the step. Long running steps should return once s.Workflow()
+	// is canceled.
+	Run(ctx context.Context, s *Step) DError
+}
+
+var (
+	stepTypes    = map[string]func() StepImpl{}
+	stepTypesMx  sync.RWMutex
+	stepImplType = reflect.TypeOf((*StepImpl)(nil)).Elem()
+)
+
+// RegisterStepType makes a step type available to workflows under name, the
+// JSON key of the step type, which is matched case-insensitively like the keys
+// of the built-in step types. factory returns a new, empty StepImpl, which must
+// be a pointer for the step's JSON to be unmarshalled into it.
+// RegisterStepType is meant to be called from init functions and panics if
+// name is already used by a built-in or registered step type.
+func RegisterStepType(name string, factory func() StepImpl) {
+	if name == "" || factory == nil {
+		panic("daisy: RegisterStepType needs a name and a factory")
+	}
+	st := reflect.TypeOf(Step{})
+	for i := 0; i < st.NumField(); i++ {
+		if strings.EqualFold(st.Field(i).Name, name) {
+			panic(fmt.Sprintf("daisy: step type %q is built in", name))
+		}
+	}
+	stepTypesMx.Lock()
+	defer stepTypesMx.Unlock()
+	for n := range stepTypes {
+		if strings.EqualFold(n, name) {
+			panic(fmt.Sprintf("daisy: step type %q is already registered", n))
+		}
+	}
+	stepTypes[name] = factory
+}
+
+// registeredStepType returns the registered step type matching the JSON key
+// name and the name it was registered under.
+func registeredStepType(name string) (func() StepImpl, string, bool) {
+	stepTypesMx.RLock()
+	defer stepTypesMx.RUnlock()
+	if f, ok := stepTypes[name]; ok {
+		return f, name, true
+	}
+	for n, f := range stepTypes {
+		if strings.EqualFold(n, name) {
+			return f, n, true
+		}
+	}
+	return nil, "", false
+}
+
+// registeredStep adapts a StepImpl to stepImpl.
+type registeredStep struct {
+	name string
+	impl StepImpl
+}
+
+func (r *registeredStep) populate(ctx context.Context, s *Step) DError {
+	return r.impl.Populate(ctx, s)
+}
+
+func (r *registeredStep) validate(ctx context.Context, s *Step) DError {
+	return r.impl.Validate(ctx, s)
+}
+
+func (r *registeredStep) run(ctx context.Context, s *Step) DError {
+	return r.impl.Run(ctx, s)
+}
+
+// UnmarshalJSON unmarshals a Step, including a registered step type.
+func (s *Step) UnmarshalJSON(b []byte) error {
+	type step Step
+	if err := json.Unmarshal(b, (*step)(s)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	for key, raw := range fields {
+		factory, name, ok := registeredStepType(key)
+		if !ok {
+			continue
+		}
+		if s.Custom != nil {
+			return fmt.Errorf("step has more than one registered step type: %q and %q", s.customType, name)
+		}
+		impl := factory()
+		if err := json.Unmarshal(raw, impl); err != nil {
+			return err
+		}
+		s.Custom = impl
+		s.customType = name
+	}
+	return nil
+}
+
+// MarshalJSON marshals a Step, including a registered step type.
+func (s *Step) MarshalJSON() ([]byte, error) {
+	type step Step
+	b, err := json.Marshal((*step)(s))
+	if err != nil || s.Custom == nil {
+		return b, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	if fields[s.customType], err = json.Marshal(s.Custom); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// SetCustom sets the registered step type of s, for steps built in Go code.
+func (s *Step) SetCustom(name string, impl StepImpl) {
+	s.customType = name
+	s.Custom = impl
+}
+
+// Name returns the name of the step within its workflow.
+func (s *Step) Name() string {
+	return s.name
+}
+
+// Workflow returns the workflow running the step.
+func (s *Step) Workflow() *Workflow {
+	return s.w
+}
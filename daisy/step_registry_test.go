@@ -0,0 +1,157 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type echoStep struct {
+	Message string
+	ran     bool
+}
+
+func (e *echoStep) Populate(ctx context.Context, s *Step) DError {
+	if e.Message == "" {
+		e.Message = "default"
+	}
+	return nil
+}
+
+func (e *echoStep) Validate(ctx context.Context, s *Step) DError {
+	if strings.Contains(e.Message, "bad") {
+		return Errf("bad message %q", e.Message)
+	}
+	return nil
+}
+
+func (e *echoStep) Run(ctx context.Context, s *Step) DError {
+	s.Workflow().LogStepInfo(s.Name(), "Echo", e.Message)
+	e.ran = true
+	return nil
+}
+
+func init() {
+	RegisterStepType("Echo", func() StepImpl { return &echoStep{} })
+}
+
+func TestRegisteredStepJSON(t *testing.T) {
+	var s Step
+	if err := json.Unmarshal([]byte(`{"Timeout": "5m", "Echo": {"Message": "hi"}}`), &s); err != nil {
+		t.Fatalf("error unmarshalling step: %v", err)
+	}
+	if s.Timeout != "5m" {
+		t.Errorf("Timeout = %q, want 5m", s.Timeout)
+	}
+	if diffRes := diff(s.Custom, &echoStep{Message: "hi"}, 0); diffRes != "" {
+		t.Errorf("registered step doesn't match expectation: (-got +want)\n%s", diffRes)
+	}
+
+	b, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatalf("error marshalling step: %v", err)
+	}
+	if want := `{"Echo":{"Message":"hi"},"Timeout":"5m"}`; string(b) != want {
+		t.Errorf("marshalled step = %s, want %s", b, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"Echo": {"Message": 1}}`), &Step{}); err == nil {
+		t.Error("expected error for bad registered step JSON")
+	}
+}
+
+func TestRegisteredStepJSONCase(t *testing.T) {
+	// Registered step types are matched like the built-in fields, ignoring case.
+	var s Step
+	if err := json.Unmarshal([]byte(`{"timeout": "5m", "echo": {"message": "hi"}}`), &s); err != nil {
+		t.Fatalf("error unmarshalling step: %v", err)
+	}
+	if s.Timeout != "5m" {
+		t.Errorf("Timeout = %q, want 5m", s.Timeout)
+	}
+	if diffRes := diff(s.Custom, &echoStep{Message: "hi"}, 0); diffRes != "" {
+		t.Errorf("registered step doesn't match expectation: (-got +want)\n%s", diffRes)
+	}
+	if s.customType != "Echo" {
+		t.Errorf("customType = %q, want the registered name Echo", s.customType)
+	}
+
+	if err := json.Unmarshal([]byte(`{"Echo": {}, "ECHO": {}}`), &Step{}); err == nil {
+		t.Error("expected error for a registered step type given twice")
+	}
+}
+
+func TestRegisteredStepRun(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.Vars = map[string]Var{"msg": {Value: "hello"}}
+	s := &Step{}
+	if err := json.Unmarshal([]byte(`{"Echo": {"Message": "${msg}"}}`), s); err != nil {
+		t.Fatalf("error unmarshalling step: %v", err)
+	}
+	w.Steps["s"] = s
+	if err := w.populate(ctx); err != nil {
+		t.Fatalf("unexpected populate error: %v", err)
+	}
+	e := s.Custom.(*echoStep)
+	if e.Message != "hello" {
+		t.Errorf("vars not substituted in registered step: Message = %q", e.Message)
+	}
+
+	impl, err := s.stepImpl()
+	if err != nil {
+		t.Fatalf("unexpected stepImpl error: %v", err)
+	}
+	if err := impl.validate(ctx, s); err != nil {
+		t.Errorf("unexpected validate error: %v", err)
+	}
+	if err := s.run(ctx); err != nil {
+		t.Errorf("unexpected run error: %v", err)
+	}
+	if !e.ran {
+		t.Error("registered step didn't run")
+	}
+}
+
+func TestRegisteredStepMultipleTypes(t *testing.T) {
+	s := &Step{DeleteResources: &DeleteResources{}}
+	s.SetCustom("Echo", &echoStep{})
+	if _, err := s.stepImpl(); err == nil {
+		t.Error("expected error for step with a built-in and a registered type")
+	}
+}
+
+func TestRegisterStepTypePanics(t *testing.T) {
+	factory := func() StepImpl { return &echoStep{} }
+	for _, name := range []string{"Echo", "echo", "createDisks", "Custom", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterStepType(%q) should panic", name)
+				}
+			}()
+			RegisterStepType(name, factory)
+		}()
+	}
+	if _, _, ok := registeredStepType("createDisks"); ok {
+		t.Error("built-in name was registered")
+	}
+	if len(stepTypes) != 1 {
+		t.Errorf("registry has %d types, want 1", len(stepTypes))
+	}
+}
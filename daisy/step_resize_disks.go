@@ -84,6 +84,7 @@ func (r *ResizeDisks) run(ctx context.Context, s *Step) DError {
 				e <- newErr("failed to resize disk", err)
 				return
 			}
+			s.SetOutput(rd.Name+".sizeGb", strconv.FormatInt(rd.DisksResizeRequest.SizeGb, 10))
 		}(rd)
 	}
 
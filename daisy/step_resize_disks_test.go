@@ -111,4 +111,7 @@ func TestResizeDisksRun(t *testing.T) {
 			}
 		}
 	}
+	if v, _ := w.GetStepOutput("test", "disk1.sizeGb"); v != "10" {
+		t.Errorf("unexpected sizeGb output, got: %q, want: %q", v, "10")
+	}
 }
@@ -0,0 +1,100 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = "10s"
+)
+
+// Retry is a Daisy Retry workflow step. It runs Step again, after a backoff,
+// until it succeeds or Attempts runs failed. Resources created by a failed run
+// are deleted before Step runs again. The step timeout covers all attempts.
+type Retry struct {
+	Step *Step
+	// Maximum number of runs of Step (default is 3).
+	Attempts int `json:",omitempty"`
+	// Time to wait before the first retry, doubled after each retry
+	// (default is 10s).
+	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
+	Backoff string `json:",omitempty"`
+	backoff time.Duration
+}
+
+func (r *Retry) nestedSteps() []*Step {
+	if r.Step == nil {
+		return nil
+	}
+	return []*Step{r.Step}
+}
+
+func (r *Retry) populate(ctx context.Context, s *Step) DError {
+	if r.Attempts == 0 {
+		r.Attempts = defaultRetryAttempts
+	}
+	if r.Backoff == "" {
+		r.Backoff = defaultRetryBackoff
+	}
+	var err error
+	if r.backoff, err = time.ParseDuration(r.Backoff); err != nil {
+		return newErr(fmt.Sprintf("failed to parse Backoff %q", r.Backoff), err)
+	}
+	impl, derr := s.nestedImpl(r.Step)
+	if derr != nil {
+		return derr
+	}
+	return impl.populate(ctx, s)
+}
+
+func (r *Retry) validate(ctx context.Context, s *Step) DError {
+	if r.Attempts < 1 {
+		return Errf("Attempts must be positive, got %d", r.Attempts)
+	}
+	impl, err := s.nestedImpl(r.Step)
+	if err != nil {
+		return err
+	}
+	return impl.validate(ctx, s)
+}
+
+func (r *Retry) run(ctx context.Context, s *Step) DError {
+	impl, err := s.nestedImpl(r.Step)
+	if err != nil {
+		return err
+	}
+	backoff := r.backoff
+	for attempt := 1; ; attempt++ {
+		err = s.runNested(ctx, impl)
+		if err == nil || attempt >= r.Attempts {
+			return err
+		}
+		s.w.LogStepInfo(s.name, "Retry", "Attempt %d of %d failed, retrying in %s: %v", attempt, r.Attempts, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-s.w.Cancel:
+			return nil
+		}
+		backoff *= 2
+		if err := s.w.deleteStepResources(s); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,118 @@
+//  Copyright 2021 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPopulate(t *testing.T) {
+	w := testWorkflow()
+	s, _ := w.NewStep("s")
+	r := &Retry{Step: &Step{testType: &mockStep{}}}
+	if err := r.populate(context.Background(), s); err != nil {
+		t.Fatalf("unexpected populate error: %v", err)
+	}
+	if r.Attempts != defaultRetryAttempts || r.backoff != 10*time.Second {
+		t.Errorf("unexpected defaults: Attempts %d, backoff %s", r.Attempts, r.backoff)
+	}
+
+	if err := (&Retry{Step: &Step{testType: &mockStep{}}, Backoff: "bad"}).populate(context.Background(), s); err == nil {
+		t.Error("expected error for bad Backoff")
+	}
+	if err := (&Retry{}).populate(context.Background(), s); err == nil {
+		t.Error("expected error for missing Step")
+	}
+}
+
+func TestRetryRun(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc      string
+		failures  int
+		wantRuns  int
+		shouldErr bool
+	}{
+		{"success", 0, 1, false},
+		{"success after retries", 2, 3, false},
+		{"all attempts fail", 5, 3, true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		s, _ := w.NewStep("s")
+		runs := 0
+		r := &Retry{Attempts: 3, backoff: time.Millisecond, Step: &Step{testType: &mockStep{
+			runImpl: func(ctx context.Context, st *Step) DError {
+				if st != s {
+					t.Errorf("%s: nested step should run as the Retry step", tt.desc)
+				}
+				runs++
+				if runs <= tt.failures {
+					return Errf("fail")
+				}
+				return nil
+			},
+		}}}
+		err := r.run(ctx, s)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+		}
+		if runs != tt.wantRuns {
+			t.Errorf("%s: want %d runs, got %d", tt.desc, tt.wantRuns, runs)
+		}
+	}
+}
+
+func TestRetryRunCreateStep(t *testing.T) {
+	w := testWorkflow()
+	s, _ := w.NewStep("s")
+	var deleted []string
+	w.disks.baseResourceRegistry.deleteFn = func(res *Resource) DError {
+		deleted = append(deleted, res.link)
+		return nil
+	}
+	link := "projects/p/zones/z/disks/d1"
+	w.disks.m = map[string]*Resource{"d1": {link: link, creator: s}}
+	runs := 0
+	r := &Retry{Attempts: 2, backoff: time.Millisecond, Step: &Step{testType: &mockStep{
+		runImpl: func(ctx context.Context, st *Step) DError {
+			runs++
+			d, _ := w.disks.get("d1")
+			if d.createdInWorkflow {
+				return Errf("disk %q already exists", d.link)
+			}
+			d.markCreated()
+			if runs == 1 {
+				return Errf("fail after creating disk")
+			}
+			return nil
+		},
+	}}}
+	if err := r.run(context.Background(), s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if runs != 2 {
+		t.Errorf("want 2 runs, got %d", runs)
+	}
+	if want := []string{link}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("disks deleted before retrying: got %v, want %v", deleted, want)
+	}
+	if d, _ := w.disks.get("d1"); !d.createdInWorkflow || d.deleted {
+		t.Error("disk created by the successful attempt should be kept for cleanup")
+	}
+}
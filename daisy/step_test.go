@@ -75,8 +75,12 @@ func TestGetChain(t *testing.T) {
 	b1 := &Step{w: b}
 	b2 := &Step{w: b, SubWorkflow: &SubWorkflow{Workflow: c}}
 	c1 := &Step{w: c}
+	d := &Workflow{parent: a}
+	a3 := &Step{w: a, Retry: &Retry{Step: &Step{IncludeWorkflow: &IncludeWorkflow{Workflow: d}}}}
+	d1 := &Step{w: d}
+	d.Steps = map[string]*Step{"d1": d1}
 	orphan := &Step{}
-	a.Steps = map[string]*Step{"a1": a1, "a2": a2}
+	a.Steps = map[string]*Step{"a1": a1, "a2": a2, "a3": a3}
 	b.Steps = map[string]*Step{"b1": b1, "b2": b2}
 	c.Steps = map[string]*Step{"c1": c1}
 
@@ -88,6 +92,7 @@ func TestGetChain(t *testing.T) {
 		{"leaf case", a1, []*Step{a1}},
 		{"step from include case", b1, []*Step{a2, b1}},
 		{"step from sub case", c1, []*Step{a2, b2, c1}},
+		{"step from nested include case", d1, []*Step{a3, d1}},
 		{"orphan step case", orphan, nil},
 	}
 
@@ -210,6 +215,18 @@ func TestStepImpl(t *testing.T) {
 			Step{WaitForInstancesSignal: &WaitForInstancesSignal{}},
 			reflect.TypeOf(&WaitForInstancesSignal{}),
 		},
+		{
+			Step{If: &If{}},
+			reflect.TypeOf(&If{}),
+		},
+		{
+			Step{ForEach: &ForEach{}},
+			reflect.TypeOf(&ForEach{}),
+		},
+		{
+			Step{Retry: &Retry{}},
+			reflect.TypeOf(&Retry{}),
+		},
 	}
 
 	for _, tt := range tests {
@@ -18,18 +18,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"google.golang.org/api/googleapi"
 )
 
 const (
 	defaultInterval = "10s"
+	// maxSerialLineLength bounds the incomplete last line of the serial
+	// output that is kept until the line ends.
+	maxSerialLineLength = 1 << 20
 )
 
 var (
-	serialOutputValueRegex = regexp.MustCompile(".*<serial-output key:'(.*)' value:'(.*)'>")
+	serialOutputValueRegex = regexp.MustCompile("<serial-output key:'([^']*)' value:'([^']*)'>")
 )
 
 // WaitForInstancesSignal is a Daisy WaitForInstancesSignal workflow step.
@@ -69,6 +76,127 @@ type SerialOutput struct {
 	SuccessMatch string         `json:",omitempty"`
 	FailureMatch FailureMatches `json:"failureMatch,omitempty"`
 	StatusMatch  string         `json:",omitempty"`
+	// Regex makes the matches regular expressions, which are matched within
+	// each complete line; ^ and $ anchor them to the line. The capture groups
+	// of SuccessMatch and StatusMatch are published as step outputs.
+	Regex bool `json:",omitempty"`
+}
+
+// GuestAttribute describes a guest attribute that the instance sets to signal.
+// The instance must have the enable-guest-attributes metadata set to TRUE.
+// This step will not complete until the attribute matches SuccessValue, or
+// until it is set if there's no SuccessValue. A match with FailureValue will
+// cause the step to fail.
+type GuestAttribute struct {
+	Namespace    string         `json:",omitempty"`
+	KeyName      string         `json:",omitempty"`
+	SuccessValue string         `json:",omitempty"`
+	FailureValue FailureMatches `json:"failureValue,omitempty"`
+	// Regex makes the values regular expressions. The capture groups of
+	// SuccessValue are published as step outputs.
+	Regex bool `json:",omitempty"`
+}
+
+// signalMatcher matches signals with a substring or a regular expression.
+type signalMatcher struct {
+	substr string
+	re     *regexp.Regexp
+}
+
+func newSignalMatcher(pattern string, regex bool) (*signalMatcher, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if !regex {
+		return &signalMatcher{substr: pattern}, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &signalMatcher{re: re}, nil
+}
+
+// find returns the index of the first match in ln, or -1, and the capture
+// groups of the match, keyed by name or, for unnamed groups, by number.
+func (m *signalMatcher) find(ln string) (int, map[string]string) {
+	if m == nil {
+		return -1, nil
+	}
+	if m.re == nil {
+		return strings.Index(ln, m.substr), nil
+	}
+	loc := m.re.FindStringSubmatchIndex(ln)
+	if loc == nil {
+		return -1, nil
+	}
+	groups := map[string]string{}
+	for i, name := range m.re.SubexpNames() {
+		if i == 0 || loc[2*i] < 0 {
+			continue
+		}
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		groups[name] = ln[loc[2*i]:loc[2*i+1]]
+	}
+	return loc[0], groups
+}
+
+// signalMatchers are the matchers of a SerialOutput or a GuestAttribute.
+type signalMatchers struct {
+	success, status *signalMatcher
+	failures        []*signalMatcher
+}
+
+func newSignalMatchers(success string, failures []string, status string, regex bool) (*signalMatchers, error) {
+	var ms signalMatchers
+	var err error
+	if ms.success, err = newSignalMatcher(success, regex); err != nil {
+		return nil, err
+	}
+	if ms.status, err = newSignalMatcher(status, regex); err != nil {
+		return nil, err
+	}
+	for _, f := range failures {
+		fm, err := newSignalMatcher(f, regex)
+		if err != nil {
+			return nil, err
+		}
+		ms.failures = append(ms.failures, fm)
+	}
+	return &ms, nil
+}
+
+func (so *SerialOutput) matchers() (*signalMatchers, error) {
+	return newSignalMatchers(so.SuccessMatch, so.FailureMatch, so.StatusMatch, so.Regex)
+}
+
+// matchers matches guest attribute values exactly, unless Regex is set.
+func (ga *GuestAttribute) matchers() (*signalMatchers, error) {
+	success, failures := ga.SuccessValue, []string(ga.FailureValue)
+	if !ga.Regex {
+		if success != "" {
+			success = "^" + regexp.QuoteMeta(success) + "$"
+		}
+		failures = nil
+		for _, f := range ga.FailureValue {
+			failures = append(failures, "^"+regexp.QuoteMeta(f)+"$")
+		}
+	}
+	return newSignalMatchers(success, failures, "", true)
+}
+
+func (ga *GuestAttribute) variableKey() string {
+	return ga.Namespace + "/" + ga.KeyName
+}
+
+// publishGroups publishes the capture groups of a match of the signal of an
+// instance as outputs of s, such as <instance>.<group>.
+func publishGroups(s *Step, instance string, groups map[string]string) {
+	for k, v := range groups {
+		s.SetOutput(instance+"."+k, v)
+	}
 }
 
 // InstanceSignal waits for a signal from an instance.
@@ -83,6 +211,8 @@ type InstanceSignal struct {
 	Stopped bool `json:",omitempty"`
 	// Wait for a string match in the serial output.
 	SerialOutput *SerialOutput `json:",omitempty"`
+	// Wait for a guest attribute to be set.
+	GuestAttribute *GuestAttribute `json:",omitempty"`
 }
 
 func waitForInstanceStopped(s *Step, project, zone, name string, interval time.Duration) DError {
@@ -106,8 +236,13 @@ func waitForInstanceStopped(s *Step, project, zone, name string, interval time.D
 	}
 }
 
-func waitForSerialOutput(s *Step, project, zone, name string, so *SerialOutput, interval time.Duration) DError {
+func waitForSerialOutput(s *Step, is *InstanceSignal, project, zone, name string, interval time.Duration) DError {
 	w := s.w
+	so := is.SerialOutput
+	ms, err := so.matchers()
+	if err != nil {
+		return Errf("%q: invalid SerialOutput match: %v", is.Name, err)
+	}
 	msg := fmt.Sprintf("Instance %q: watching serial port %d", name, so.Port)
 	if so.SuccessMatch != "" {
 		msg += fmt.Sprintf(", SuccessMatch: %q", so.SuccessMatch)
@@ -121,6 +256,11 @@ func waitForSerialOutput(s *Step, project, zone, name string, so *SerialOutput,
 	w.LogStepInfo(s.name, "WaitForInstancesSignal", msg+".")
 	var start int64
 	var errs int
+	// The last line read is kept until it ends, since the output of a read
+	// may end in the middle of a line. tailReported is whether its
+	// StatusMatch was already reported.
+	var tail string
+	var tailReported bool
 	tick := time.Tick(interval)
 	for {
 		select {
@@ -150,40 +290,136 @@ func waitForSerialOutput(s *Step, project, zone, name string, so *SerialOutput,
 				return Errf("WaitForInstancesSignal: instance %q: error getting serial port: %v", name, err)
 			}
 			start = resp.Next
-			for _, ln := range strings.Split(resp.Contents, "\n") {
-				if so.StatusMatch != "" {
-					if i := strings.Index(ln, so.StatusMatch); i != -1 {
-						w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: StatusMatch found: %q", name, strings.TrimSpace(ln[i:]))
-						extractOutputValue(w, ln)
-					}
-				}
-				if len(so.FailureMatch) > 0 {
-					for _, failureMatch := range so.FailureMatch {
-						if i := strings.Index(ln, failureMatch); i != -1 {
-							errMsg := strings.TrimSpace(ln[i:])
-							format := "WaitForInstancesSignal FailureMatch found for %q: %q"
-							return newErr(errMsg, fmt.Errorf(format, name, errMsg))
-						}
-					}
+			lines := strings.Split(tail+resp.Contents, "\n")
+			tail = lines[len(lines)-1]
+			lines = lines[:len(lines)-1]
+			if so.Regex && resp.Contents == "" && tail != "" {
+				// The output stopped in the middle of a line.
+				lines, tail = append(lines, tail), ""
+			}
+			if len(tail) > maxSerialLineLength {
+				tail = tail[len(tail)-maxSerialLineLength:]
+			}
+			// Substrings are also matched in the last line before it ends, since
+			// the instance may never end it. It's only matched again when it
+			// grows, and its StatusMatch is only reported once.
+			partial := tail != "" && !so.Regex && resp.Contents != ""
+			if partial {
+				lines = append(lines, tail)
+			}
+			for i, ln := range lines {
+				// The first line continues the last line of the previous read.
+				continued := i == 0 && tailReported
+				done, reported, err := matchSerialLine(s, is, name, ms, ln, !continued)
+				if done {
+					return err
 				}
-				if so.SuccessMatch != "" {
-					if i := strings.Index(ln, so.SuccessMatch); i != -1 {
-						w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: SuccessMatch found %q", name, strings.TrimSpace(ln[i:]))
-						return nil
-					}
+				if partial && i == len(lines)-1 {
+					tailReported = continued || reported
 				}
 			}
+			if resp.Contents != "" && !partial {
+				tailReported = false
+			}
 			errs = 0
 		}
 	}
 }
 
-func extractOutputValue(w *Workflow, s string) {
-	if matches := serialOutputValueRegex.FindStringSubmatch(s); matches != nil && len(matches) == 3 {
-		for w.parent != nil {
-			w = w.parent
+// matchSerialLine matches a line of the serial output of an instance, and
+// reports whether the signal is done, and whether a StatusMatch was found.
+// The StatusMatch is only logged and emitted when reportStatus is set, but
+// its values are always extracted, since the line may have grown.
+func matchSerialLine(s *Step, is *InstanceSignal, name string, ms *signalMatchers, ln string, reportStatus bool) (bool, bool, DError) {
+	w := s.w
+	var statusFound bool
+	if i, groups := ms.status.find(ln); i != -1 {
+		statusFound = true
+		if reportStatus {
+			w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: StatusMatch found: %q", name, strings.TrimSpace(ln[i:]))
+			w.emitEvent(&Event{Type: EventSerialMatch, Step: s.name, Instance: name, MatchKind: "StatusMatch", Match: strings.TrimSpace(ln[i:])})
+		}
+		extractOutputValue(s, ln)
+		publishGroups(s, is.Name, groups)
+	}
+	for _, fm := range ms.failures {
+		if i, _ := fm.find(ln); i != -1 {
+			errMsg := strings.TrimSpace(ln[i:])
+			w.emitEvent(&Event{Type: EventSerialMatch, Step: s.name, Instance: name, MatchKind: "FailureMatch", Match: errMsg})
+			format := "WaitForInstancesSignal FailureMatch found for %q: %q"
+			return true, statusFound, newErr(errMsg, fmt.Errorf(format, name, errMsg))
 		}
+	}
+	if i, groups := ms.success.find(ln); i != -1 {
+		w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: SuccessMatch found %q", name, strings.TrimSpace(ln[i:]))
+		w.emitEvent(&Event{Type: EventSerialMatch, Step: s.name, Instance: name, MatchKind: "SuccessMatch", Match: strings.TrimSpace(ln[i:])})
+		publishGroups(s, is.Name, groups)
+		return true, statusFound, nil
+	}
+	return false, statusFound, nil
+}
+
+func waitForGuestAttribute(s *Step, is *InstanceSignal, project, zone, name string, interval time.Duration) DError {
+	w := s.w
+	ga := is.GuestAttribute
+	ms, err := ga.matchers()
+	if err != nil {
+		return Errf("%q: invalid GuestAttribute value: %v", is.Name, err)
+	}
+	key := ga.variableKey()
+	w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: waiting for guest attribute %q.", name, key)
+	var errs int
+	tick := time.Tick(interval)
+	for {
+		select {
+		case <-s.w.Cancel:
+			return nil
+		case <-tick:
+			attr, err := w.ComputeClient.GetGuestAttributes(project, zone, name, "", key)
+			if err != nil {
+				// The attribute isn't set yet.
+				if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusNotFound {
+					errs = 0
+					continue
+				}
+				// Retry up to 3 times in a row on any other error.
+				if errs < 3 {
+					errs++
+					continue
+				}
+				return Errf("WaitForInstancesSignal: instance %q: error getting guest attribute %q: %v", name, key, err)
+			}
+			errs = 0
+			v := attr.VariableValue
+			for _, fm := range ms.failures {
+				if i, _ := fm.find(v); i != -1 {
+					w.emitEvent(&Event{Type: EventGuestAttributeMatch, Step: s.name, Instance: name, MatchKind: "FailureValue", Match: v})
+					format := "WaitForInstancesSignal FailureValue found for %q in guest attribute %q: %q"
+					return newErr(v, fmt.Errorf(format, name, key, v))
+				}
+			}
+			i, groups := ms.success.find(v)
+			if ms.success != nil && i == -1 {
+				continue
+			}
+			w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: guest attribute %q set to %q", name, key, v)
+			w.emitEvent(&Event{Type: EventGuestAttributeMatch, Step: s.name, Instance: name, MatchKind: "SuccessValue", Match: v})
+			publishGroups(s, is.Name, groups)
+			return nil
+		}
+	}
+}
+
+// extractOutputValue adds the serial-output values found in ln to the root
+// workflow, and publishes them as outputs of s.
+func extractOutputValue(s *Step, ln string) {
+	w := s.w
+	for w.parent != nil {
+		w = w.parent
+	}
+	for _, matches := range serialOutputValueRegex.FindAllStringSubmatch(ln, -1) {
 		w.AddSerialConsoleOutputValue(matches[1], matches[2])
+		s.SetOutput(matches[1], matches[2])
 	}
 }
 
@@ -236,6 +472,7 @@ func runForWaitForInstancesSignal(w *[]*InstanceSignal, s *Step, waitAll bool) D
 			m := NamedSubexp(instanceURLRgx, i.link)
 			serialSig := make(chan struct{})
 			stoppedSig := make(chan struct{})
+			guestAttrSig := make(chan struct{})
 			if is.Stopped {
 				go func() {
 					if err := waitForInstanceStopped(s, m["project"], m["zone"], m["instance"], is.interval); err != nil {
@@ -246,18 +483,29 @@ func runForWaitForInstancesSignal(w *[]*InstanceSignal, s *Step, waitAll bool) D
 			}
 			if is.SerialOutput != nil {
 				go func() {
-					if err := waitForSerialOutput(s, m["project"], m["zone"], m["instance"], is.SerialOutput, is.interval); err != nil || !waitAll {
+					if err := waitForSerialOutput(s, is, m["project"], m["zone"], m["instance"], is.interval); err != nil || !waitAll {
 						// send a signal to end other waiting instances
 						e <- err
 					}
 					close(serialSig)
 				}()
 			}
+			if is.GuestAttribute != nil {
+				go func() {
+					if err := waitForGuestAttribute(s, is, m["project"], m["zone"], m["instance"], is.interval); err != nil || !waitAll {
+						// send a signal to end other waiting instances
+						e <- err
+					}
+					close(guestAttrSig)
+				}()
+			}
 			select {
 			case <-serialSig:
 				return
 			case <-stoppedSig:
 				return
+			case <-guestAttrSig:
+				return
 			}
 		}(is)
 	}
@@ -292,7 +540,7 @@ func validateForWaitForInstancesSignal(w *[]*InstanceSignal, s *Step) DError {
 		if i.interval == 0*time.Second {
 			return Errf("%q: cannot wait for instance signal, no interval given", i.Name)
 		}
-		if i.SerialOutput == nil && i.Stopped == false {
+		if i.SerialOutput == nil && i.GuestAttribute == nil && i.Stopped == false {
 			return Errf("%q: cannot wait for instance signal, nothing to wait for", i.Name)
 		}
 		if i.SerialOutput != nil {
@@ -302,6 +550,17 @@ func validateForWaitForInstancesSignal(w *[]*InstanceSignal, s *Step) DError {
 			if i.SerialOutput.SuccessMatch == "" && len(i.SerialOutput.FailureMatch) == 0 {
 				return Errf("%q: cannot wait for instance signal via SerialOutput, no SuccessMatch or FailureMatch given", i.Name)
 			}
+			if _, err := i.SerialOutput.matchers(); err != nil {
+				return Errf("%q: cannot wait for instance signal via SerialOutput, invalid match: %v", i.Name, err)
+			}
+		}
+		if i.GuestAttribute != nil {
+			if i.GuestAttribute.Namespace == "" || i.GuestAttribute.KeyName == "" {
+				return Errf("%q: cannot wait for instance signal via GuestAttribute, no Namespace or KeyName given", i.Name)
+			}
+			if _, err := i.GuestAttribute.matchers(); err != nil {
+				return Errf("%q: cannot wait for instance signal via GuestAttribute, invalid value: %v", i.Name, err)
+			}
 		}
 	}
 	return nil
@@ -20,10 +20,12 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	daisyCompute "github.com/GoogleCloudPlatform/compute-image-tools/daisy/compute"
+	computeBeta "google.golang.org/api/compute/v0.beta"
 	compute "google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
 )
@@ -226,6 +228,11 @@ func testWaitForSignalValidate(t *testing.T, waitAny bool) {
 		{"instance DNE error check", getStep(waitAny, []*InstanceSignal{{Name: "instance1", Stopped: true, interval: 1 * time.Second}, {Name: "instance2", Stopped: true, interval: 1 * time.Second}}), true},
 		{"no interval", getStep(waitAny, []*InstanceSignal{{Name: "instance1", Stopped: true, Interval: "0s"}}), true},
 		{"no signal", getStep(waitAny, []*InstanceSignal{{Name: "instance1", interval: 1 * time.Second}}), true},
+		{"SerialOutput Regex", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "done (?P<code>\\d+)", Regex: true}, interval: 1 * time.Second}}), false},
+		{"SerialOutput bad Regex", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "done (", Regex: true}, interval: 1 * time.Second}}), true},
+		{"normal GuestAttribute", getStep(waitAny, []*InstanceSignal{{Name: "instance1", GuestAttribute: &GuestAttribute{Namespace: "daisy", KeyName: "status"}, interval: 1 * time.Second}}), false},
+		{"GuestAttribute no KeyName", getStep(waitAny, []*InstanceSignal{{Name: "instance1", GuestAttribute: &GuestAttribute{Namespace: "daisy"}, interval: 1 * time.Second}}), true},
+		{"GuestAttribute bad Regex", getStep(waitAny, []*InstanceSignal{{Name: "instance1", GuestAttribute: &GuestAttribute{Namespace: "daisy", KeyName: "status", SuccessValue: "(", Regex: true}, interval: 1 * time.Second}}), true},
 	}
 
 	for _, tt := range tests {
@@ -280,6 +287,163 @@ func testWaitForSignalGetOutputValue(t *testing.T, waitAny bool) {
 	}
 }
 
+func TestWaitForInstancesSignalRegex(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	// The line with the SuccessMatch is split across reads.
+	outputs := []string{"booting\nbuild ver", "sion=20210101 ", "done 3\n"}
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, _, start int64) (*compute.SerialPortOutput, error) {
+		if start >= int64(len(outputs)) {
+			return &compute.SerialPortOutput{Next: start}, nil
+		}
+		return &compute.SerialPortOutput{Contents: outputs[start], Next: start + 1}, nil
+	}
+	s := &Step{name: "wait", w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, w.genName("i1"))},
+	}
+	ws := getStep(false, []*InstanceSignal{
+		{Name: "i1", interval: 1 * time.Microsecond, SerialOutput: &SerialOutput{
+			SuccessMatch: `version=(?P<version>\d+) done (\d+)`, FailureMatch: []string{"^error"}, Regex: true}},
+	})
+	if err := ws.run(ctx, s); err != nil {
+		t.Fatalf("error running stepImpl.run(): %v", err)
+	}
+	for k, want := range map[string]string{"i1.version": "20210101", "i1.2": "3"} {
+		if got, _ := w.GetStepOutput("wait", k); got != want {
+			t.Errorf("unexpected output %q, got: %q, want: %q", k, got, want)
+		}
+	}
+}
+
+func TestWaitForInstancesSignalPartialLine(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	// The line with the StatusMatch doesn't end for two reads without new
+	// output, and is then completed.
+	outputs := []string{"booting\nstatus: step 1", "", "", " of 2\n", "status: <serial-output key:'k' value:'v'", "", ">\ndone\n"}
+	var reads int
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, _, start int64) (*compute.SerialPortOutput, error) {
+		reads++
+		if start >= int64(len(outputs)) {
+			return &compute.SerialPortOutput{Next: start}, nil
+		}
+		return &compute.SerialPortOutput{Contents: outputs[start], Next: start + 1}, nil
+	}
+	var matches []string
+	var mx sync.Mutex
+	w.AddEventSink(EventSinkFunc(func(e *Event) {
+		if e.Type == EventSerialMatch {
+			mx.Lock()
+			matches = append(matches, e.MatchKind+": "+e.Match)
+			mx.Unlock()
+		}
+	}))
+	s := &Step{name: "wait", w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, w.genName("i1"))},
+	}
+	ws := getStep(false, []*InstanceSignal{
+		{Name: "i1", interval: 1 * time.Microsecond, SerialOutput: &SerialOutput{StatusMatch: "status:", SuccessMatch: "done"}},
+	})
+	if err := ws.run(ctx, s); err != nil {
+		t.Fatalf("error running stepImpl.run(): %v", err)
+	}
+	want := []string{
+		"StatusMatch: status: step 1",
+		"StatusMatch: status: <serial-output key:'k' value:'v'",
+		"SuccessMatch: done",
+	}
+	if diffRes := diff(matches, want, 0); diffRes != "" {
+		t.Errorf("matches do not match expectation: (-got +want)\n%s", diffRes)
+	}
+	if reads != len(outputs) {
+		t.Errorf("unexpected number of reads, got: %d, want: %d", reads, len(outputs))
+	}
+	if got := w.GetSerialConsoleOutputValue("k"); got != "v" {
+		t.Errorf("unexpected output value, got: %q, want: %q", got, "v")
+	}
+}
+
+func TestWaitForInstancesSignalGuestAttribute(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	var calls int
+	values := map[string][]string{
+		w.genName("i1"): {"", "running", "done:7"},
+		w.genName("i2"): {"running", "failed"},
+	}
+	w.ComputeClient.(*daisyCompute.TestClient).GetGuestAttributesFn = func(_, _, n, _, key string) (*computeBeta.GuestAttributes, error) {
+		if key != "daisy/status" {
+			t.Errorf("unexpected guest attribute %q", key)
+		}
+		calls++
+		vs := values[n]
+		v := vs[0]
+		if len(vs) > 1 {
+			values[n] = vs[1:]
+		}
+		if v == "" {
+			return nil, &googleapi.Error{Code: http.StatusNotFound}
+		}
+		return &computeBeta.GuestAttributes{VariableKey: key, VariableValue: v}, nil
+	}
+	s := &Step{name: "wait", w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, w.genName("i1"))},
+		"i2": {link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, w.genName("i2"))},
+	}
+
+	ws := getStep(false, []*InstanceSignal{
+		{Name: "i1", interval: 1 * time.Microsecond, GuestAttribute: &GuestAttribute{
+			Namespace: "daisy", KeyName: "status", SuccessValue: `^done:(?P<code>\d+)$`, Regex: true}},
+	})
+	if err := ws.run(ctx, s); err != nil {
+		t.Fatalf("error running stepImpl.run(): %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("unexpected number of calls, got: %d, want: 3", calls)
+	}
+	if got, _ := w.GetStepOutput("wait", "i1.code"); got != "7" {
+		t.Errorf("unexpected output, got: %q, want: %q", got, "7")
+	}
+
+	// FailureValue is matched exactly.
+	ws = getStep(false, []*InstanceSignal{
+		{Name: "i2", interval: 1 * time.Microsecond, GuestAttribute: &GuestAttribute{
+			Namespace: "daisy", KeyName: "status", SuccessValue: "done", FailureValue: []string{"fail", "failed"}}},
+	})
+	want := `WaitForInstancesSignal FailureValue found for "` + w.genName("i2") + `" in guest attribute "daisy/status": "failed"`
+	if err := ws.run(ctx, s); err == nil || err.Error() != want {
+		t.Errorf("did not get expected error, got: %v, want: %q", err, want)
+	}
+}
+
+func TestSignalMatcherFind(t *testing.T) {
+	tests := []struct {
+		desc, pattern, ln string
+		regex             bool
+		wantIndex         int
+		wantGroups        map[string]string
+	}{
+		{"substring", "done", "all done", false, 4, nil},
+		{"substring no match", "done", "running", false, -1, nil},
+		{"regex", `v(\d+)\.(?P<minor>\d+)`, "at v1.2", true, 3, map[string]string{"1": "1", "minor": "2"}},
+		{"regex optional group", `done( \d+)?`, "done", true, 0, map[string]string{}},
+		{"regex no match", `^done`, "not done", true, -1, nil},
+	}
+	for _, tt := range tests {
+		m, err := newSignalMatcher(tt.pattern, tt.regex)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.desc, err)
+		}
+		i, groups := m.find(tt.ln)
+		if i != tt.wantIndex || !reflect.DeepEqual(groups, tt.wantGroups) {
+			t.Errorf("%s: got: %d %v, want: %d %v", tt.desc, i, groups, tt.wantIndex, tt.wantGroups)
+		}
+	}
+}
+
 func getStep(waitAny bool, iss []*InstanceSignal) stepImpl {
 	if waitAny {
 		si := WaitForAnyInstancesSignal{}
@@ -19,7 +19,9 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -57,6 +59,9 @@ func (w *Workflow) validateRequiredFields() DError {
 	if len(w.Steps) == 0 {
 		return Errf("must provide at least one step in workflow field 'Steps'")
 	}
+	if err := w.validateVars(); err != nil {
+		return err
+	}
 	for name := range w.Steps {
 		if name == "" {
 			return Errf("no name defined for Step %q", name)
@@ -65,8 +70,83 @@ func (w *Workflow) validateRequiredFields() DError {
 	return nil
 }
 
+// validateVars sets the Vars that have no value to their defaults, and checks
+// their values against their types, patterns and allowed values.
+func (w *Workflow) validateVars() DError {
+	var errs DError
+	for k, v := range w.Vars {
+		if v.Value == "" && v.Default != "" {
+			v.Value = v.Default
+			w.Vars[k] = v
+		}
+		if v.Required && v.Value == "" {
+			errs = addErrs(errs, Errf("required var %q is unset", k))
+			continue
+		}
+		errs = addErrs(errs, v.validate(k))
+	}
+	return errs
+}
+
+func (v Var) validate(name string) DError {
+	if v.Type == VarTypeEnum && len(v.Allowed) == 0 {
+		return Errf("enum var %q must have Allowed values", name)
+	}
+	var pattern *regexp.Regexp
+	if v.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile("^(?:" + v.Pattern + ")$"); err != nil {
+			return Errf("var %q has an invalid Pattern %q: %v", name, v.Pattern, err)
+		}
+	}
+	if v.Value == "" {
+		return nil
+	}
+	values := []string{v.Value}
+	if v.Type == VarTypeList {
+		values = strings.Split(v.Value, ",")
+	}
+	for _, value := range values {
+		if v.Type == VarTypeList {
+			value = strings.TrimSpace(value)
+		}
+		if err := checkVarType(v.Type, value); err != nil {
+			return Errf("var %q: %v", name, err)
+		}
+		if pattern != nil && !pattern.MatchString(value) {
+			return Errf("var %q: %q doesn't match pattern %q", name, value, v.Pattern)
+		}
+		if len(v.Allowed) > 0 && !strIn(value, v.Allowed) {
+			return Errf("var %q: %q is not one of the allowed values %q", name, value, v.Allowed)
+		}
+	}
+	return nil
+}
+
+func checkVarType(t VarType, value string) error {
+	var err error
+	switch t {
+	case "", VarTypeString, VarTypeList, VarTypeEnum:
+	case VarTypeInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case VarTypeBool:
+		_, err = strconv.ParseBool(value)
+	case VarTypeDuration:
+		_, err = time.ParseDuration(value)
+	default:
+		return fmt.Errorf("unknown type %q", t)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %v", value, t)
+	}
+	return nil
+}
+
 func (w *Workflow) validate(ctx context.Context) DError {
-	return w.validateDAG(ctx)
+	if err := w.validateDAG(ctx); err != nil {
+		return err
+	}
+	return w.validateBudget()
 }
 
 // Step through the step DAG, calling each step's validate().
@@ -103,12 +183,17 @@ func (w *Workflow) validateDAG(ctx context.Context) DError {
 }
 
 func (w *Workflow) validateVarsSubbed() DError {
+	return validateVarsSubbed(reflect.ValueOf(w).Elem())
+}
+
+func validateVarsSubbed(v reflect.Value) DError {
 	unsubbedVarRgx := regexp.MustCompile(`\$\{([^}]+)}`)
-	return traverseData(reflect.ValueOf(w).Elem(), func(v reflect.Value) DError {
+	return traverseData(v, func(v reflect.Value) DError {
 		switch v.Interface().(type) {
 		case string:
 			if match := unsubbedVarRgx.FindStringSubmatch(v.String()); match != nil {
-				if !sourceVarRgx.MatchString(v.String()) {
+				// Sources and step outputs are substituted later.
+				if !sourceVarRgx.MatchString(v.String()) && !stepOutputRgx.MatchString(v.String()) {
 					return Errf("Unresolved var %q found in %q", match[0], v.String())
 				}
 			}
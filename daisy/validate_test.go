@@ -17,6 +17,7 @@ package daisy
 import (
 	"context"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -64,6 +65,54 @@ func TestValidateVarsSubbed(t *testing.T) {
 	//}
 }
 
+func TestValidateVars(t *testing.T) {
+	tests := []struct {
+		desc    string
+		v       Var
+		wantErr string
+	}{
+		{"untyped", Var{Value: "anything"}, ""},
+		{"empty int", Var{Type: VarTypeInt}, ""},
+		{"int", Var{Value: "-10", Type: VarTypeInt}, ""},
+		{"bad int", Var{Value: "10GB", Type: VarTypeInt}, `var "v": "10GB" is not a valid int`},
+		{"bool", Var{Value: "true", Type: VarTypeBool}, ""},
+		{"bad bool", Var{Value: "yes", Type: VarTypeBool}, `var "v": "yes" is not a valid bool`},
+		{"duration", Var{Value: "1h30m", Type: VarTypeDuration}, ""},
+		{"bad duration", Var{Value: "90", Type: VarTypeDuration}, `var "v": "90" is not a valid duration`},
+		{"unknown type", Var{Value: "1", Type: "float"}, `var "v": unknown type "float"`},
+		{"default", Var{Default: "5", Type: VarTypeInt}, ""},
+		{"bad default", Var{Default: "five", Type: VarTypeInt}, `var "v": "five" is not a valid int`},
+		{"required", Var{Required: true}, `required var "v" is unset`},
+		{"pattern", Var{Value: "pd-ssd", Pattern: "pd-[a-z]+"}, ""},
+		{"pattern matches whole value", Var{Value: "pd-ssd-1", Pattern: "pd-[a-z]+"}, `var "v": "pd-ssd-1" doesn't match pattern "pd-[a-z]+"`},
+		{"bad pattern", Var{Value: "a", Pattern: "("}, `var "v" has an invalid Pattern "("`},
+		{"enum", Var{Value: "b", Type: VarTypeEnum, Allowed: []string{"a", "b"}}, ""},
+		{"bad enum", Var{Value: "c", Type: VarTypeEnum, Allowed: []string{"a", "b"}}, `var "v": "c" is not one of the allowed values ["a" "b"]`},
+		{"enum without allowed", Var{Value: "c", Type: VarTypeEnum}, `enum var "v" must have Allowed values`},
+		{"list", Var{Value: "1, 2,3", Type: VarTypeList, Pattern: "[0-9]"}, ""},
+		{"bad list", Var{Value: "1,22", Type: VarTypeList, Allowed: []string{"1", "2"}}, `var "v": "22" is not one of the allowed values ["1" "2"]`},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.Vars = map[string]Var{"v": tt.v}
+		err := w.validateVars()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+		} else if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: want error %q, got: %v", tt.desc, tt.wantErr, err)
+		}
+	}
+
+	w := testWorkflow()
+	w.Vars = map[string]Var{"v": {Default: "5", Type: VarTypeInt}}
+	if err := w.validateVars(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := w.Vars["v"].Value; got != "5" {
+		t.Errorf("default not applied, got value %q", got)
+	}
+}
+
 func TestValidateWorkflow(t *testing.T) {
 	ctx := context.Background()
 	// Normal, good validation.
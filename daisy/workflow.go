@@ -25,6 +25,7 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -71,8 +72,31 @@ type Var struct {
 	Value       string
 	Required    bool   `json:",omitempty"`
 	Description string `json:",omitempty"`
+	// Type is one of the VarType constants. Values are checked against it,
+	// and against Pattern and Allowed, before the workflow is populated.
+	Type VarType `json:",omitempty"`
+	// Default is the value of the Var when Value is empty.
+	Default string `json:",omitempty"`
+	// Pattern is a regular expression that the whole value must match.
+	Pattern string `json:",omitempty"`
+	// Allowed lists the allowed values. It is required for enum Vars.
+	Allowed []string `json:",omitempty"`
 }
 
+// VarType is the type of the value of a Var.
+type VarType string
+
+// Types of Vars. The items of list Vars are comma separated, and each of them
+// is checked against Pattern and Allowed.
+const (
+	VarTypeString   VarType = "string"
+	VarTypeInt      VarType = "int"
+	VarTypeBool     VarType = "bool"
+	VarTypeDuration VarType = "duration"
+	VarTypeList     VarType = "list"
+	VarTypeEnum     VarType = "enum"
+)
+
 // UnmarshalJSON unmarshals a Var.
 func (v *Var) UnmarshalJSON(b []byte) error {
 	var s string
@@ -115,6 +139,12 @@ type Workflow struct {
 	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
 	DefaultTimeout string `json:",omitempty"`
 	defaultTimeout time.Duration
+	// Maximum number of steps of this workflow running at the same time,
+	// unlimited if unset.
+	MaxParallelSteps int `json:",omitempty"`
+	// Limits on the resources requested by running steps, shared with the
+	// included and sub workflows that don't set their own.
+	ResourceBudget *ResourceBudget `json:",omitempty"`
 
 	// Working fields.
 	autovars              map[string]string
@@ -177,12 +207,29 @@ type Workflow struct {
 	stepTimeRecords             []TimeRecord
 	serialControlOutputValues   map[string]string
 	serialControlOutputValuesMx sync.Mutex
+	// stepOutputs are the outputs published by steps, by step name, see Step.SetOutput.
+	stepOutputs   map[string]map[string]string
+	stepOutputsMx sync.Mutex
 	//Forces cleanup on error of all resources, including those marked with NoCleanup
 	ForceCleanupOnError bool
 	// forceCleanup is set to true when resources should be forced clean, even when NoCleanup is set to true
 	forceCleanup bool
 	// cancelReason provides custom reason when workflow is canceled. f
 	cancelReason string
+	// journal records execution progress, see EnableJournal.
+	journal *workflowJournal
+	// serialLogs archives the serial output of instances, see EnableSerialLogArchive.
+	serialLogs *serialLogArchive
+	startTime  time.Time
+	// plan records API calls instead of making them, see Plan.
+	plan *planRecorder
+	// eventSinks receive the workflow's events, see AddEventSink.
+	eventSinks   []EventSink
+	eventSinksMx sync.Mutex
+	// parallelSteps and budget throttle running steps, see waitToStart.
+	parallelSteps chan struct{}
+	budget        *budgetPool
+	budgetMx      sync.Mutex
 }
 
 //DisableCloudLogging disables logging to Cloud Logging for this workflow.
@@ -205,7 +252,10 @@ func (w *Workflow) AddVar(k, v string) {
 	if w.Vars == nil {
 		w.Vars = map[string]Var{}
 	}
-	w.Vars[k] = Var{Value: v}
+	// Keep the declaration of the Var, so that its value is still checked.
+	wv := w.Vars[k]
+	wv.Value = v
+	w.Vars[k] = wv
 }
 
 // AddSerialConsoleOutputValue adds an serial-output key-value pair to the Workflow.
@@ -286,10 +336,16 @@ func (w *Workflow) RunWithModifiers(
 	if postValidateWorkflowModifier != nil {
 		postValidateWorkflowModifier(w)
 	}
+	w.journal.adoptResources()
+	defer w.writeSerialLogArchive(ctx)
 	defer w.cleanup()
 	defer func() {
 		if err != nil {
 			w.forceCleanup = w.ForceCleanupOnError
+			if w.journal != nil && !w.forceCleanup {
+				w.journal.keepResources = true
+				w.LogWorkflowInfo("Keeping created resources, resume the workflow with journal %q.", w.journal.path)
+			}
 		}
 	}()
 
@@ -355,12 +411,19 @@ func (w *Workflow) cleanup() {
 	case <-time.After(4 * time.Second):
 	}
 
+	var errs DError
 	for _, hook := range w.cleanupHooks {
 		if err := hook(); err != nil {
 			w.LogWorkflowInfo("Error returned from cleanup hook: %s", err)
+			errs = addErrs(errs, err)
 		}
 	}
 	w.LogWorkflowInfo("Workflow %q finished cleanup.", w.Name)
+	e := &Event{Type: EventCleanup, DurationSeconds: time.Since(startTime).Seconds()}
+	if errs != nil {
+		e.Error = errs.Error()
+	}
+	w.emitEvent(e)
 	w.recordStepTime("workflow cleanup", startTime, time.Now())
 }
 
@@ -388,6 +451,8 @@ func (w *Workflow) getSourceGCSAPIPath(s string) string {
 }
 
 // PopulateClients populates the compute and storage clients for the workflow.
+// The Cloud Logging client isn't created when Cloud Logging is disabled, so
+// that workflows run against fake backends need no credentials.
 func (w *Workflow) PopulateClients(ctx context.Context) error {
 	// API clients instantiation.
 	var err error
@@ -413,7 +478,7 @@ func (w *Workflow) PopulateClients(ctx context.Context) error {
 	}
 
 	loggingOptions := []option.ClientOption{option.WithCredentialsFile(w.OAuthPath)}
-	if w.externalLogging && w.cloudLoggingClient == nil {
+	if w.externalLogging && !w.cloudLoggingDisabled && w.cloudLoggingClient == nil {
 		w.cloudLoggingClient, err = logging.NewClient(ctx, w.Project, loggingOptions...)
 		if err != nil {
 			return err
@@ -449,15 +514,19 @@ func (w *Workflow) populateStep(ctx context.Context, s *Step) DError {
 // - sets up logger.
 // - runs populate on each step.
 func (w *Workflow) populate(ctx context.Context) DError {
-	for k, v := range w.Vars {
-		if v.Required && v.Value == "" {
-			return Errf("cannot populate workflow, required var %q is unset", k)
-		}
+	if err := w.validateVars(); err != nil {
+		return Errf("cannot populate workflow, %v", err)
 	}
 
 	// Set some generic autovars and run first round of var substitution.
 	cwd, _ := os.Getwd()
 	now := time.Now().UTC()
+	if w.journal.isResuming() {
+		// Regenerate the names and paths of the journaled run.
+		w.id = w.journal.resumed.ID
+		now = w.journal.resumed.StartTime.UTC()
+	}
+	w.startTime = now
 	w.username = getUser()
 
 	w.autovars = map[string]string{
@@ -470,14 +539,9 @@ func (w *Workflow) populate(ctx context.Context) DError {
 		"CWD":       cwd,
 	}
 
-	var replacements []string
-	for k, v := range w.autovars {
-		replacements = append(replacements, fmt.Sprintf("${%s}", k), v)
-	}
-	for k, v := range w.Vars {
-		replacements = append(replacements, fmt.Sprintf("${%s}", k), v.Value)
+	if err := substituteVars(reflect.ValueOf(w).Elem(), w.varValues()); err != nil {
+		return err
 	}
-	substitute(reflect.ValueOf(w).Elem(), strings.NewReplacer(replacements...))
 
 	// Parse timeout.
 	timeout, err := time.ParseDuration(w.DefaultTimeout)
@@ -515,11 +579,9 @@ func (w *Workflow) populate(ctx context.Context) DError {
 	w.autovars["LOGSPATH"] = fmt.Sprintf("gs://%s/%s", w.bucket, w.logsPath)
 	w.autovars["OUTSPATH"] = fmt.Sprintf("gs://%s/%s", w.bucket, w.outsPath)
 
-	replacements = []string{}
-	for k, v := range w.autovars {
-		replacements = append(replacements, fmt.Sprintf("${%s}", k), v)
+	if err := substituteVars(reflect.ValueOf(w).Elem(), w.varValues()); err != nil {
+		return err
 	}
-	substitute(reflect.ValueOf(w).Elem(), strings.NewReplacer(replacements...))
 
 	// We do this here, and not in validate, as embedded startup scripts could
 	// have what we think are daisy variables.
@@ -546,6 +608,19 @@ func (w *Workflow) populate(ctx context.Context) DError {
 	return nil
 }
 
+// varValues returns the values of the Vars and autovars by name. Autovars
+// take precedence over Vars with the same name.
+func (w *Workflow) varValues() map[string]string {
+	values := map[string]string{}
+	for k, v := range w.Vars {
+		values[k] = v.Value
+	}
+	for k, v := range w.autovars {
+		values[k] = v
+	}
+	return values
+}
+
 // AddDependency creates a dependency of dependent on each dependency. Returns an
 // error if dependent or dependency are not steps in this workflow.
 func (w *Workflow) AddDependency(dependent *Step, dependencies ...*Step) error {
@@ -580,6 +655,7 @@ func (w *Workflow) includeWorkflow(iw *Workflow) {
 	iw.targetInstances = w.targetInstances
 	iw.snapshots = w.snapshots
 	iw.objects = w.objects
+	iw.journal = w.journal
 }
 
 // ID is the unique identifyier for this Workflow.
@@ -652,8 +728,31 @@ func (w *Workflow) Print(ctx context.Context) {
 }
 
 func (w *Workflow) run(ctx context.Context) DError {
+	if w.MaxParallelSteps > 0 {
+		w.parallelSteps = make(chan struct{}, w.MaxParallelSteps)
+	}
 	return w.traverseDAG(func(s *Step) DError {
-		return w.runStep(ctx, s)
+		if w.journal.stepCompleted(s) {
+			w.LogWorkflowInfo("Step %q already completed in journaled run, skipping.", s.name)
+			w.journal.restoreStepOutputs(s)
+			return nil
+		}
+		if err := w.journal.discardResources(s); err != nil {
+			return err
+		}
+		done, ok := w.waitToStart(s)
+		if !ok {
+			return Errf("step %q canceled before it started", s.name)
+		}
+		err := w.runStep(ctx, s)
+		done()
+		if err != nil {
+			return err
+		}
+		if w.journal != nil {
+			return w.journal.recordStep(ctx, s)
+		}
+		return nil
 	})
 }
 
@@ -719,13 +818,26 @@ func (w *Workflow) traverseDAG(f func(*Step) DError) DError {
 		}
 
 		// Kick off all steps that aren't waiting for anything.
+		var ready []string
 		for name, deps := range waiting {
 			if len(deps) == 0 {
-				delete(waiting, name)
-				running = append(running, name)
-				close(start[name])
+				ready = append(ready, name)
+			}
+		}
+		sort.Strings(ready)
+		if w.planRecorder() != nil && len(ready) > 0 {
+			// Plans run one step at a time so API calls can be attributed to steps.
+			if len(running) > 0 {
+				ready = nil
+			} else {
+				ready = ready[:1]
 			}
 		}
+		for _, name := range ready {
+			delete(waiting, name)
+			running = append(running, name)
+			close(start[name])
+		}
 
 		// Sanity check. There should be at least one running step,
 		// but loop back through if there isn't.
@@ -873,15 +985,23 @@ func stepsListen(names []string, chans map[string]chan DError) (string, DError)
 }
 
 // IterateWorkflowSteps iterates over all workflow steps, including included
-// workflow steps, and calls cb callback function
+// workflow steps and steps nested in control flow steps, and calls cb
+// callback function
 func (w *Workflow) IterateWorkflowSteps(cb func(step *Step)) {
 	for _, step := range w.Steps {
-		if step.IncludeWorkflow != nil {
-			//recurse into included workflow
-			step.IncludeWorkflow.Workflow.IterateWorkflowSteps(cb)
-		}
-		cb(step)
+		iterateStep(step, cb)
+	}
+}
+
+func iterateStep(step *Step, cb func(step *Step)) {
+	if step.IncludeWorkflow != nil {
+		//recurse into included workflow
+		step.IncludeWorkflow.Workflow.IterateWorkflowSteps(cb)
+	}
+	for _, n := range step.nestedSteps() {
+		iterateStep(n, cb)
 	}
+	cb(step)
 }
 
 // CancelWithReason cancels workflow with a specific reason.
@@ -623,6 +623,7 @@ func TestPopulate(t *testing.T) {
 	want.logsPath = fmt.Sprintf("%s/logs", got.scratchPath)
 	want.outsPath = fmt.Sprintf("%s/outs", got.scratchPath)
 	want.username = got.username
+	want.startTime = got.startTime
 	want.Steps = map[string]*Step{
 		"wf-name-step1": {
 			name:    "wf-name-step1",
@@ -664,6 +665,9 @@ func TestRequiredVars(t *testing.T) {
 	}{
 		{"normal case", map[string]Var{"foo": {Value: "foo", Required: true, Description: "foo"}}, false},
 		{"missing req case", map[string]Var{"foo": {Value: "", Required: true, Description: "foo"}}, true},
+		{"req case with default", map[string]Var{"foo": {Required: true, Default: "foo"}}, false},
+		{"bad int case", map[string]Var{"foo": {Value: "10GB", Type: VarTypeInt}}, true},
+		{"expression case", map[string]Var{"size": {Value: "10", Type: VarTypeInt}, "foo": {Value: "${size + 1}"}}, false},
 	}
 
 	for _, tt := range tests {
@@ -1051,6 +1055,18 @@ func TestPopulateClients(t *testing.T) {
 	}
 }
 
+func TestPopulateClientsSkipsDisabledCloudLogging(t *testing.T) {
+	w := testWorkflow()
+	w.cloudLoggingClient = nil
+	w.externalLogging = true
+	w.DisableCloudLogging()
+	// No credentials are needed when the other clients are set.
+	tryPopulateClients(t, w)
+	if w.cloudLoggingClient != nil {
+		t.Errorf("Should not populate Cloud Logging client when Cloud Logging is disabled.")
+	}
+}
+
 func tryPopulateClients(t *testing.T, w *Workflow) {
 	if err := w.PopulateClients(context.Background()); err != nil {
 		t.Errorf("Failed to populate clients for workflow: %v", err)
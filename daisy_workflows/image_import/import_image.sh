@@ -30,14 +30,24 @@ BYTES_1GB=1073741824
 URL="http://metadata/computeMetadata/v1/instance"
 DAISY_SOURCE_URL="$(curl -f -H Metadata-Flavor:Google ${URL}/attributes/daisy-sources-path)"
 SOURCE_URL="$(curl -f -H Metadata-Flavor:Google ${URL}/attributes/source_disk_file)"
+# When the disk file is a file of an archive, such as an OVA, it's the
+# length bytes of source_disk_file starting at offset.
+SOURCE_OFFSET="$(curl -f -H Metadata-Flavor:Google ${URL}/attributes/source_disk_file_offset)"
+SOURCE_LENGTH="$(curl -f -H Metadata-Flavor:Google ${URL}/attributes/source_disk_file_length)"
+SOURCE_NAME="$(curl -f -H Metadata-Flavor:Google ${URL}/attributes/source_disk_file_name)"
 DISKNAME="$(curl -f -H Metadata-Flavor:Google ${URL}/attributes/disk_name)"
 SCRATCH_DISK_NAME="$(curl -f -H Metadata-Flavor:Google ${URL}/attributes/scratch_disk_name)"
 ME="$(curl -f -H Metadata-Flavor:Google ${URL}/name)"
 ZONE=$(curl -f -H Metadata-Flavor:Google ${URL}/zone)
 
-SOURCE_SIZE_BYTES="$(gsutil du "${SOURCE_URL}" | grep -o '^[0-9]\+')"
+if [[ -n "${SOURCE_OFFSET}" ]]; then
+  SOURCE_SIZE_BYTES="${SOURCE_LENGTH}"
+  IMAGE_PATH="/daisy-scratch/${SOURCE_NAME}"
+else
+  SOURCE_SIZE_BYTES="$(gsutil du "${SOURCE_URL}" | grep -o '^[0-9]\+')"
+  IMAGE_PATH="/daisy-scratch/$(basename "${SOURCE_URL}")"
+fi
 SOURCE_SIZE_GB=$(awk "BEGIN {print int(((${SOURCE_SIZE_BYTES}-1)/${BYTES_1GB}) + 1)}")
-IMAGE_PATH="/daisy-scratch/$(basename "${SOURCE_URL}")"
 
 
 # Print info.
@@ -46,6 +56,7 @@ echo "# Configuration #" 2> /dev/null
 echo "#################" 2> /dev/null
 echo "IMAGE_PATH: ${IMAGE_PATH}" 2> /dev/null
 echo "SOURCE_URL: ${SOURCE_URL}" 2> /dev/null
+echo "SOURCE_OFFSET: ${SOURCE_OFFSET}" 2> /dev/null
 echo "SOURCE_SIZE_BYTES: ${SOURCE_SIZE_BYTES}" 2> /dev/null
 echo "DISKNAME: ${DISKNAME}" 2> /dev/null
 echo "ME: ${ME}" 2> /dev/null
@@ -161,7 +172,15 @@ function copyImageToScratchDisk() {
   # The stream may contain useful debugging messages, however, so if there's an
   # error we print any lines that don't have ascii control characters, which
   # are used to generate the progress meter.
-  if ! out=$(gsutil cp "${SOURCE_URL}" "${IMAGE_PATH}" 2> gsutil.cp.err); then
+  # A file of an archive is downloaded with a ranged read of the archive,
+  # rather than downloading the whole archive.
+  if [[ -n "${SOURCE_OFFSET}" ]]; then
+    gsutil cat -r "${SOURCE_OFFSET}-$((SOURCE_OFFSET + SOURCE_LENGTH - 1))" "${SOURCE_URL}" \
+      > "${IMAGE_PATH}" 2> gsutil.cp.err
+  else
+    gsutil cp "${SOURCE_URL}" "${IMAGE_PATH}" 2> gsutil.cp.err
+  fi
+  if [[ $? -ne 0 ]]; then
     echo "Import: Failure while executing gsutil cp:"
     grep -v '[[:cntrl:]]' gsutil.cp.err | while read line; do
       echo "Import: ${line}"
@@ -173,7 +192,7 @@ function copyImageToScratchDisk() {
     fi
     exit
   fi
-  echo "Import: Copied image from ${SOURCE_URL} to ${IMAGE_PATH}: ${out}"
+  echo "Import: Copied image from ${SOURCE_URL} to ${IMAGE_PATH}."
 }
 
 function serialOutputPrefixedKeyValue() {
@@ -28,6 +28,7 @@ fi
 GOFMT_RET=0
 GOLINT_RET=0
 GOVET_RET=0
+DAISYLINT_RET=0
 
 TARGETS=("daisy"
          "cli_tools"
@@ -68,7 +69,19 @@ for TARGET in "${TARGETS[@]}"; do
   fi
 done
 
-if [ ${GOLINT_RET} != 0 ] || [ ${GOFMT_RET} != 0 ] || [ ${GOVET_RET} != 0 ]; then
+echo "Linting daisy_workflows"
+cd "/${REPO_PATH}/daisy"
+# Warnings listed in the baseline are known; new warnings fail like errors.
+go run ./cli lint -fail_on warning -baseline "/${REPO_PATH}/daisy_workflows/lint_baseline.txt" "/${REPO_PATH}/daisy_workflows"
+DAISYLINT_RET=$?
+if [ ! -z "${ARTIFACTS}" ]; then
+  go run ./cli lint -format sarif -output "${ARTIFACTS}/daisy_lint.sarif" "/${REPO_PATH}/daisy_workflows"
+fi
+if [ ${DAISYLINT_RET} != 0 ]; then
+  echo "'daisy lint daisy_workflows' returned ${DAISYLINT_RET}"
+fi
+
+if [ ${GOLINT_RET} != 0 ] || [ ${GOFMT_RET} != 0 ] || [ ${GOVET_RET} != 0 ] || [ ${DAISYLINT_RET} != 0 ]; then
   exit 1
 fi
 exit 0